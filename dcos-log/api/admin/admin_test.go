@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func token(uid string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"` + uid + `"}`))
+	return "token=e30." + payload + ".sig"
+}
+
+func newAdminRouter() *mux.Router {
+	r := mux.NewRouter()
+	InitRoutes(r, &config.Config{FlagAdminUIDs: "alice, bob", FlagDebugEndpoints: true}, http.DefaultClient)
+	return r
+}
+
+func serve(h http.Handler, method, target, uid, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if uid != "" {
+		req.Header.Set("Authorization", token(uid))
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	r := newAdminRouter()
+	if w := serve(r, "GET", "/admin/log-level", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expect 401 without a token. Got %d", w.Code)
+	}
+
+	if w := serve(r, "GET", "/admin/log-level", "mallory", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expect 403 for a user which is not an admin. Got %d", w.Code)
+	}
+
+	if w := serve(r, "GET", "/admin/log-level", "bob", ""); w.Code != http.StatusOK {
+		t.Fatalf("expect 200 for an admin. Got %d", w.Code)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	r := newAdminRouter()
+	w := serve(r, "PUT", "/admin/log-level", "alice", `{"level":"debug"}`)
+	if w.Code != http.StatusOK || logrus.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("expect the debug level. Got %d, %s", w.Code, logrus.GetLevel())
+	}
+
+	var level logLevel
+	if err := json.Unmarshal(serve(r, "GET", "/admin/log-level", "alice", "").Body.Bytes(), &level); err != nil {
+		t.Fatal(err)
+	}
+
+	if level.Level != "debug" {
+		t.Fatalf("expect debug. Got %s", level.Level)
+	}
+
+	if w := serve(r, "PUT", "/admin/log-level", "alice", `{"level":"loud"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for an unknown level. Got %d", w.Code)
+	}
+}
+
+func TestTerminateStream(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/stream", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		middleware.Instrument(router).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream", nil))
+		close(done)
+	}()
+
+	var streams []middleware.Stream
+	for i := 0; len(streams) == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := json.Unmarshal(serve(newAdminRouter(), "GET", "/admin/streams", "alice", "").Body.Bytes(), &streams); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(streams) != 1 || streams[0].Route != "/stream" {
+		t.Fatalf("expect the open stream. Got %+v", streams)
+	}
+
+	target := "/admin/streams/" + strconv.FormatUint(streams[0].ID, 10)
+	if w := serve(newAdminRouter(), "DELETE", target, "alice", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expect 204. Got %d", w.Code)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the stream to be closed")
+	}
+
+	if w := serve(newAdminRouter(), "DELETE", target, "alice", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 for a closed stream. Got %d", w.Code)
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	r := newAdminRouter()
+	for _, target := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+		if w := serve(r, "GET", target, "mallory", ""); w.Code != http.StatusForbidden {
+			t.Fatalf("expect 403 for %s. Got %d", target, w.Code)
+		}
+
+		if w := serve(r, "GET", target, "alice", ""); w.Code != http.StatusOK {
+			t.Fatalf("expect 200 for %s. Got %d", target, w.Code)
+		}
+	}
+
+	r = mux.NewRouter()
+	InitRoutes(r, &config.Config{FlagAdminUIDs: "alice"}, http.DefaultClient)
+	if w := serve(r, "GET", "/debug/vars", "alice", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expect the debug endpoints disabled by default. Got %d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// logLevel is the body of the log level requests and responses.
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// requireAdmin rejects the requests of the users which are not admins with 403.
+func requireAdmin(next http.Handler, uids map[string]bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if uid := middleware.RequestUID(req); !uids[uid] {
+			logError(w, req, fmt.Sprintf("user %q may not use the admin API", uid), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func logError(w http.ResponseWriter, req *http.Request, msg string, code int) {
+	http.Error(w, msg, code)
+	logrus.Errorf("%s; http code: %d, request %s", msg, code, req.URL)
+}
+
+func writeJSON(w http.ResponseWriter, req *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logError(w, req, "unable to encode the response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// getLogLevelHandler responds with the level of the dcos-log logs.
+func getLogLevelHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, req, logLevel{Level: logrus.GetLevel().String()})
+}
+
+// setLogLevelHandler changes the level of the dcos-log logs to the level of the body, such as debug or info. The
+// level is kept until the config is reloaded or dcos-log restarts.
+func setLogLevelHandler(w http.ResponseWriter, req *http.Request) {
+	var body logLevel
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		logError(w, req, "unable to decode the log level: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	level, err := logrus.ParseLevel(body.Level)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logrus.SetLevel(level)
+	logrus.Warnf("log level set to %s by %s", level, middleware.RequestUID(req))
+	writeJSON(w, req, logLevel{Level: level.String()})
+}
+
+// streamsHandler responds with the open streams, with their client, route and duration.
+func streamsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, req, middleware.Streams())
+}
+
+// terminateStreamHandler closes the stream with the id of the route. 404 is returned if there is no such stream.
+func terminateStreamHandler(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(req)["id"], 10, 64)
+	if err != nil {
+		logError(w, req, "invalid stream id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.TerminateStream(id) {
+		logError(w, req, fmt.Sprintf("stream %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	logrus.Warnf("stream %d terminated by %s", id, middleware.RequestUID(req))
+	w.WriteHeader(http.StatusNoContent)
+}
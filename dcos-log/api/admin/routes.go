@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/gorilla/mux"
+)
+
+// InitRoutes inits the /admin routes to manage dcos-log at runtime and, if -debug-endpoints is enabled, the /debug
+// routes of the pprof profiles and expvar variables. Only the users with the uids of -admin-uids may use them, the
+// config requires -jwt-verify with -admin-uids so the uid is verified.
+func InitRoutes(r *mux.Router, cfg *config.Config, client *http.Client) {
+	uids := make(map[string]bool)
+	for _, uid := range strings.Split(cfg.FlagAdminUIDs, ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			uids[uid] = true
+		}
+	}
+
+	wrap := func(h http.Handler) http.Handler {
+		return middleware.RequireToken(requireAdmin(h, uids))
+	}
+	if cfg.FlagJWTVerify {
+		verifier := middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL)
+		wrap = func(h http.Handler) http.Handler {
+			return middleware.VerifyToken(requireAdmin(h, uids), verifier)
+		}
+	}
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Path("/log-level").Handler(wrap(http.HandlerFunc(getLogLevelHandler))).Methods("GET")
+	admin.Path("/log-level").Handler(wrap(http.HandlerFunc(setLogLevelHandler))).Methods("PUT")
+	admin.Path("/streams").Handler(wrap(http.HandlerFunc(streamsHandler))).Methods("GET")
+	admin.Path("/streams/{id}").Handler(wrap(http.HandlerFunc(terminateStreamHandler))).Methods("DELETE")
+
+	if !cfg.FlagDebugEndpoints {
+		return
+	}
+
+	// pprof.Index serves the named profiles, such as /debug/pprof/heap and /debug/pprof/goroutine.
+	debug := r.PathPrefix("/debug").Subrouter()
+	debug.Path("/pprof/cmdline").Handler(wrap(http.HandlerFunc(pprof.Cmdline))).Methods("GET")
+	debug.Path("/pprof/profile").Handler(wrap(http.HandlerFunc(pprof.Profile))).Methods("GET")
+	debug.Path("/pprof/symbol").Handler(wrap(http.HandlerFunc(pprof.Symbol))).Methods("GET", "POST")
+	debug.Path("/pprof/trace").Handler(wrap(http.HandlerFunc(pprof.Trace))).Methods("GET")
+	debug.PathPrefix("/pprof/").Handler(wrap(http.HandlerFunc(pprof.Index))).Methods("GET")
+	debug.Path("/vars").Handler(wrap(expvar.Handler())).Methods("GET")
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-go/dcos/http/transport"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/archive"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/sirupsen/logrus"
+)
+
+// newBackgroundClient returns an http client for requests to the Mesos agent and master which are not made on
+// behalf of a user. If the IAM config is set, requests are authorized with the service account token.
+func newBackgroundClient(cfg *config.Config, timeout time.Duration) (*http.Client, error) {
+	var transportOptions []transport.OptionTransportFunc
+	if cfg.FlagCACertFile != "" {
+		transportOptions = append(transportOptions, transport.OptionCaCertificatePath(cfg.FlagCACertFile))
+	}
+
+	if cfg.FlagIAMConfig != "" {
+		transportOptions = append(transportOptions, transport.OptionIAMConfigPath(cfg.FlagIAMConfig))
+	}
+
+	tr, err := transport.NewTransport(transportOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}, nil
+}
+
+// newExternalClient returns an http client for requests to services outside of the cluster, such as the archive
+// and the forwarder sinks.
+// The IAM transport would replace their Authorization header with the service account token, so it is not used and
+// the token is never sent outside of the cluster.
+func newExternalClient(cfg *config.Config, timeout time.Duration) (*http.Client, error) {
+	external := *cfg
+	external.FlagIAMConfig = ""
+	return newBackgroundClient(&external, timeout)
+}
+
+// startArchiver starts uploading the files of terminated tasks to the archive in background.
+// The decorators are applied to the requests sent to the agent.
+func startArchiver(ctx context.Context, cfg *config.Config, nodeInfo nodeutil.NodeInfo, decorators ...middleware.RequestDecorator) error {
+	if cfg.FlagArchiveURL == "" {
+		return errors.New("archive-url must be set to use archiver")
+	}
+
+	if cfg.FlagRole == dcos.RoleMaster {
+		return errors.New("archiver can only run on agent nodes")
+	}
+
+	interval, err := time.ParseDuration(cfg.FlagArchiveInterval)
+	if err != nil {
+		return err
+	}
+
+	retention, err := time.ParseDuration(cfg.FlagArchiveRetention)
+	if err != nil {
+		return err
+	}
+
+	// downloading big files may take a while, use a bigger timeout than for regular requests.
+	client, err := newBackgroundClient(cfg, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	storeClient, err := newExternalClient(cfg, client.Timeout)
+	if err != nil {
+		return err
+	}
+
+	store, err := archive.NewStore(cfg.FlagArchiveURL, storeClient)
+	if err != nil {
+		return err
+	}
+
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+	if err != nil {
+		return err
+	}
+
+	agentClient := &http.Client{
+		Timeout:   client.Timeout,
+		Transport: middleware.DecorateTransport(client.Transport, decorators...),
+	}
+
+	archiver, err := archive.NewArchiver(store, agentClient, *agentURL,
+		archive.OptionInterval(interval),
+		archive.OptionRetention(retention),
+		archive.OptionFiles(strings.Split(cfg.FlagArchiveFiles, ",")...))
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Archiving terminated tasks to %s every %s", cfg.FlagArchiveURL, interval)
+	go archiver.Run(ctx)
+	return nil
+}
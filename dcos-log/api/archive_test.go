@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/archive"
+	"github.com/dcos/dcos-log/dcos-log/config"
+)
+
+// newIAMLogin returns a fake login endpoint of the IAM service, the token of the service account is
+// "service-account".
+func newIAMLogin() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token": "service-account"}`))
+	}))
+}
+
+// newIAMConfig writes the IAM config of a service account which logs in with loginURL.
+func newIAMConfig(t *testing.T, dir, loginURL string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"uid":            "dcos-log",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"login_endpoint": loginURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "iam.json")
+	if err := ioutil.WriteFile(name, body, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestNewExternalClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	var authorization string
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer s3.Close()
+
+	login := newIAMLogin()
+	defer login.Close()
+
+	cfg := &config.Config{FlagIAMConfig: newIAMConfig(t, dir, login.URL)}
+
+	// the agent requests are authorized with the service account.
+	background, err := newBackgroundClient(cfg, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := background.Get(s3.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if authorization != "token=service-account" {
+		t.Fatalf("expect the service account token. Got %q", authorization)
+	}
+
+	// the SigV4 signature of the archive requests is sent unchanged.
+	client, err := newExternalClient(cfg, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := archive.NewStore("s3://bucket/prefix?region=us-east-1&endpoint="+s3.URL, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(context.Background(), "agent/index.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=key/") {
+		t.Fatalf("expect the SigV4 authorization header. Got %q", authorization)
+	}
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/diagnostics"
+	"github.com/dcos/dcos-log/dcos-log/forward"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/query"
+	"github.com/sirupsen/logrus"
+)
+
+// parseLabels parses a comma separated list of key=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// parseMatches parses a comma separated list of FIELD=value journal matches, the matches of the same field are
+// joined with OR.
+func parseMatches(s string) ([]jr.JournalEntryMatch, error) {
+	var matches []jr.JournalEntryMatch
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid match %q, must be FIELD=value", pair)
+		}
+		matches = append(matches, jr.JournalEntryMatch{Field: strings.ToUpper(kv[0]), Value: kv[1]})
+	}
+	return matches, nil
+}
+
+// startForwarder runs a forwarder to a given sink in background. The forwarder is restarted if it fails.
+func startForwarder(ctx context.Context, cfg *config.Config, sink forward.Sink, opts ...forward.Option) error {
+	if cfg.FlagForwardStateDir != "" {
+		opts = append(opts, forward.OptionStateFile(filepath.Join(cfg.FlagForwardStateDir, sink.Name()+".cursor")))
+	}
+
+	f, err := forward.NewForwarder(sink, opts...)
+	if err != nil {
+		return err
+	}
+
+	diagnostics.Register("forward_"+sink.Name(), func() interface{} { return f.Stats() })
+	goBackground(func() {
+		for {
+			err := f.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			logrus.Errorf("%s forwarder stopped, restarting: %s", sink.Name(), err)
+			time.Sleep(5 * time.Second)
+		}
+	})
+	return nil
+}
+
+// startLoki starts forwarding the journal entries to Loki.
+func startLoki(ctx context.Context, cfg *config.Config) error {
+	labels, err := parseLabels(cfg.FlagLokiLabels)
+	if err != nil {
+		return err
+	}
+
+	client, err := newExternalClient(cfg, 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	sink, err := forward.NewLokiSink(client, cfg.FlagLokiURL,
+		forward.OptionLokiTenant(cfg.FlagLokiTenant),
+		forward.OptionLokiLabels(labels))
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Forwarding journal entries to Loki %s", cfg.FlagLokiURL)
+	return startForwarder(ctx, cfg, sink)
+}
+
+// startSplunk starts forwarding the journal entries to Splunk HTTP Event Collector. Batches which fail
+// after max retries are stored in the dead letter dir and sent again on the next start.
+func startSplunk(ctx context.Context, cfg *config.Config) error {
+	// the IAM transport would replace the HEC token of the Authorization header.
+	client, err := newExternalClient(cfg, 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	sink, err := forward.NewSplunkSink(client, cfg.FlagSplunkURL, cfg.FlagSplunkToken,
+		forward.OptionSplunkIndex(cfg.FlagSplunkIndex, cfg.FlagSplunkIndexField),
+		forward.OptionSplunkSourcetype(cfg.FlagSplunkSourcetype, cfg.FlagSplunkSourcetypeField))
+	if err != nil {
+		return err
+	}
+
+	opts := []forward.Option{forward.OptionMaxRetries(cfg.FlagSplunkMaxRetries)}
+	if cfg.FlagForwardStateDir != "" {
+		opts = append(opts, forward.OptionDeadLetterDir(filepath.Join(cfg.FlagForwardStateDir, "dead-letter", sink.Name())))
+	}
+
+	logrus.Infof("Forwarding journal entries to Splunk %s", cfg.FlagSplunkURL)
+	return startForwarder(ctx, cfg, sink, opts...)
+}
+
+// startKafka starts producing the journal entries matching -kafka-matches to Kafka, and the lines of the
+// -kafka-sandbox-files of the running tasks if it is set. The decorators are applied to the requests sent to the
+// agent.
+func startKafka(ctx context.Context, cfg *config.Config, nodeInfo nodeutil.NodeInfo, decorators ...middleware.RequestDecorator) error {
+	matches, err := parseMatches(cfg.FlagKafkaMatches)
+	if err != nil {
+		return err
+	}
+
+	sink, err := forward.NewKafkaSink(strings.Split(cfg.FlagKafkaBrokers, ","),
+		forward.OptionKafkaTopic(cfg.FlagKafkaTopic),
+		forward.OptionKafkaEncoding(cfg.FlagKafkaEncoding))
+	if err != nil {
+		return err
+	}
+
+	if cfg.FlagKafkaSandboxFiles != "" {
+		if err := startSandboxForwarder(ctx, cfg, sink, nodeInfo, decorators...); err != nil {
+			return err
+		}
+	}
+
+	logrus.Infof("Producing journal entries to Kafka %s", cfg.FlagKafkaBrokers)
+	return startForwarder(ctx, cfg, sink, forward.OptionMatches(matches))
+}
+
+// startSandboxForwarder runs a forwarder of the -kafka-sandbox-files of the running tasks to a given sink in
+// background. The forwarder is restarted if it fails.
+func startSandboxForwarder(ctx context.Context, cfg *config.Config, sink forward.Sink, nodeInfo nodeutil.NodeInfo,
+	decorators ...middleware.RequestDecorator) error {
+	if cfg.FlagRole == dcos.RoleMaster {
+		return errors.New("sandbox files can only be forwarded on agent nodes")
+	}
+
+	client, err := newBackgroundClient(cfg, 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	agentClient := &http.Client{
+		Timeout:   client.Timeout,
+		Transport: middleware.DecorateTransport(client.Transport, decorators...),
+	}
+
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+	if err != nil {
+		return err
+	}
+
+	opts := []forward.SandboxOption{
+		forward.OptionSandboxFiles(strings.Split(cfg.FlagKafkaSandboxFiles, ",")...),
+		forward.OptionSandboxReaderOptions(reader.OptWorkDir(cfg.FlagMesosWorkDir),
+			reader.OptMaxLineSize(cfg.FlagFilesAPIMaxLineSize), reader.OptTruncateLines(cfg.FlagFilesAPITruncateLines)),
+	}
+	if cfg.FlagForwardStateDir != "" {
+		opts = append(opts, forward.OptionSandboxStateFile(filepath.Join(cfg.FlagForwardStateDir, sink.Name()+"-sandbox.cursors")))
+	}
+
+	f, err := forward.NewSandboxForwarder(sink, agentClient, *agentURL, opts...)
+	if err != nil {
+		return err
+	}
+
+	diagnostics.Register("forward_"+sink.Name()+"_sandbox", func() interface{} { return f.Stats() })
+	goBackground(func() {
+		for {
+			err := f.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			logrus.Errorf("%s sandbox forwarder stopped, restarting: %s", sink.Name(), err)
+			time.Sleep(5 * time.Second)
+		}
+	})
+
+	logrus.Infof("Producing sandbox files %s of the running tasks to Kafka %s", cfg.FlagKafkaSandboxFiles, cfg.FlagKafkaBrokers)
+	return nil
+}
+
+// startFluentd starts sending the journal entries matching -fluentd-matches to a fluentd forward input.
+func startFluentd(ctx context.Context, cfg *config.Config) error {
+	matches, err := parseMatches(cfg.FlagFluentdMatches)
+	if err != nil {
+		return err
+	}
+
+	sink, err := forward.NewFluentdSink(cfg.FlagFluentdAddr, forward.OptionFluentdTag(cfg.FlagFluentdTag))
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Forwarding journal entries to fluentd %s", cfg.FlagFluentdAddr)
+	return startForwarder(ctx, cfg, sink, forward.OptionMatches(matches))
+}
+
+// startElastic starts indexing the journal entries matching -elastic-matches to Elasticsearch. The documents
+// rejected by Elasticsearch and the batches rejected as a whole are stored in the forward state dir.
+func startElastic(ctx context.Context, cfg *config.Config) error {
+	matches, err := parseMatches(cfg.FlagElasticMatches)
+	if err != nil {
+		return err
+	}
+
+	// the IAM transport would replace the basic auth or the API key of the Authorization header.
+	client, err := newExternalClient(cfg, 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	sinkOpts := []forward.ElasticOption{forward.OptionElasticIndex(cfg.FlagElasticIndex)}
+	opts := []forward.Option{forward.OptionMatches(matches)}
+	if cfg.FlagForwardStateDir != "" {
+		deadLetterDir := filepath.Join(cfg.FlagForwardStateDir, "dead-letter")
+		sinkOpts = append(sinkOpts, forward.OptionElasticRejectedFile(filepath.Join(deadLetterDir, "elasticsearch-rejected.jsonl")))
+		opts = append(opts, forward.OptionDeadLetterDir(filepath.Join(deadLetterDir, "elasticsearch")))
+	}
+
+	sink, err := forward.NewElasticSink(client, cfg.FlagElasticURL, sinkOpts...)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Indexing journal entries to Elasticsearch %s", cfg.FlagElasticURL)
+	return startForwarder(ctx, cfg, sink, opts...)
+}
+
+// startOTLP starts exporting the journal entries matching -otlp-matches to an OpenTelemetry collector.
+func startOTLP(ctx context.Context, cfg *config.Config) error {
+	matches, err := parseMatches(cfg.FlagOTLPMatches)
+	if err != nil {
+		return err
+	}
+
+	attributes, err := parseLabels(cfg.FlagOTLPAttributes)
+	if err != nil {
+		return err
+	}
+
+	headers, err := parseLabels(cfg.FlagOTLPHeaders)
+	if err != nil {
+		return err
+	}
+
+	// the credentials of the collector are set with -otlp-headers, the IAM transport would replace them.
+	client, err := newExternalClient(cfg, 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	sink, err := forward.NewOTLPSink(client, cfg.FlagOTLPURL,
+		forward.OptionOTLPAttributes(attributes),
+		forward.OptionOTLPHeaders(headers),
+		forward.OptionOTLPProtocol(cfg.FlagOTLPProtocol))
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Exporting journal entries to OpenTelemetry collector %s with %s", cfg.FlagOTLPURL, cfg.FlagOTLPProtocol)
+	return startForwarder(ctx, cfg, sink, forward.OptionMatches(matches))
+}
+
+// startSyslogForwarder starts sending the journal entries matching -syslog-forward-query to a remote syslog
+// collector. The TLS transport verifies the collector certificate with -ca-cert if it is set.
+func startSyslogForwarder(ctx context.Context, cfg *config.Config) error {
+	var opts []forward.Option
+	if cfg.FlagSyslogForwardQuery != "" {
+		q, err := query.Parse(cfg.FlagSyslogForwardQuery)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, forward.OptionQuery(q))
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.FlagCACertFile != "" {
+		if err := reader.TLSCACertificate(cfg.FlagCACertFile)(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	sink, err := forward.NewSyslogSink(cfg.FlagSyslogForwardTransport, cfg.FlagSyslogForwardAddr, forward.OptionSyslogTLS(tlsConfig))
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Forwarding journal entries to syslog %s://%s", cfg.FlagSyslogForwardTransport, cfg.FlagSyslogForwardAddr)
+	return startForwarder(ctx, cfg, sink, opts...)
+}
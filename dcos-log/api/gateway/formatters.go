@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+)
+
+// contentTypeJournalExport is the journal export format content type.
+// https://www.freedesktop.org/wiki/Software/systemd/export/
+const contentTypeJournalExport jr.ContentType = "application/vnd.fdo.journal"
+
+// entryFields returns all fields of the entry including the address fields, the same way
+// systemd-journal-gatewayd outputs them.
+func entryFields(entry *sdjournal.JournalEntry) map[string]string {
+	fields := make(map[string]string, len(entry.Fields)+3)
+	for k, v := range entry.Fields {
+		fields[k] = v
+	}
+
+	fields["__CURSOR"] = entry.Cursor
+	fields["__REALTIME_TIMESTAMP"] = strconv.FormatUint(entry.RealtimeTimestamp, 10)
+	fields["__MONOTONIC_TIMESTAMP"] = strconv.FormatUint(entry.MonotonicTimestamp, 10)
+	return fields
+}
+
+// formatShort implements journalctl short output format.
+// Jan 02 15:04:05 hostname identifier[pid]: message
+type formatShort struct{}
+
+func (f formatShort) GetContentType() jr.ContentType {
+	return jr.ContentTypePlainText
+}
+
+func (f formatShort) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	message, ok := entry.Fields["MESSAGE"]
+	if !ok {
+		return nil, nil
+	}
+
+	identifier := entry.Fields["SYSLOG_IDENTIFIER"]
+	if identifier == "" {
+		identifier = entry.Fields["_COMM"]
+	}
+
+	pid := entry.Fields["_PID"]
+	if pid == "" {
+		pid = entry.Fields["SYSLOG_PID"]
+	}
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s %s", t.Format(time.Stamp), entry.Fields["_HOSTNAME"], identifier)
+	if pid != "" {
+		fmt.Fprintf(buf, "[%s]", pid)
+	}
+	fmt.Fprintf(buf, ": %s\n", message)
+	return buf.Bytes(), nil
+}
+
+// formatJSON outputs an entry per line as a flat JSON object of all fields.
+type formatJSON struct{}
+
+func (f formatJSON) GetContentType() jr.ContentType {
+	return jr.ContentTypeApplicationJSON
+}
+
+func (f formatJSON) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	b, err := json.Marshal(entryFields(entry))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// formatSSE outputs an entry as a server sent event with a flat JSON object of all fields.
+type formatSSE struct{}
+
+func (f formatSSE) GetContentType() jr.ContentType {
+	return jr.ContentTypeEventStream
+}
+
+func (f formatSSE) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	b, err := json.Marshal(entryFields(entry))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("data: %s\n\n", b)), nil
+}
+
+// formatExport implements the journal export format. Fields are written as FIELD=value lines, values
+// containing new lines are written in binary form: FIELD\n<little endian uint64 size><value>\n.
+// Entries are separated by an empty line.
+type formatExport struct{}
+
+func (f formatExport) GetContentType() jr.ContentType {
+	return contentTypeJournalExport
+}
+
+func (f formatExport) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	fields := entryFields(entry)
+
+	// address fields go first, the rest is sorted to make the output stable.
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if !strings.HasPrefix(k, "__") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"__CURSOR", "__REALTIME_TIMESTAMP", "__MONOTONIC_TIMESTAMP"}, keys...)
+
+	buf := &bytes.Buffer{}
+	for _, k := range keys {
+		v := fields[k]
+		if !strings.ContainsAny(v, "\n") {
+			fmt.Fprintf(buf, "%s=%s\n", k, v)
+			continue
+		}
+
+		buf.WriteString(k)
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(v)))
+		buf.WriteString(v)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// newFormatter returns a formatter for the Accept header, journalctl short format is used by default.
+func newFormatter(accept string) jr.EntryFormatter {
+	switch accept {
+	case jr.ContentTypeApplicationJSON.String():
+		return formatJSON{}
+	case jr.ContentTypeEventStream.String():
+		return formatSSE{}
+	case contentTypeJournalExport.String():
+		return formatExport{}
+	}
+	return formatShort{}
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/gorilla/mux"
+)
+
+func TestRoutesVerifyToken(t *testing.T) {
+	jwks := httptest.NewServer(http.NotFoundHandler())
+	defer jwks.Close()
+
+	r := mux.NewRouter()
+	InitRoutes(r, &config.Config{FlagJWTVerify: true, FlagJWKSURL: jwks.URL}, http.DefaultClient, nil)
+
+	for _, token := range []string{"", "token=invalid"} {
+		for _, path := range []string{"/entries", "/fields/_SYSTEMD_UNIT"} {
+			req := httptest.NewRequest("GET", path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expect status 401 for %s with token %q. Got %d", path, token, w.Code)
+			}
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for header, expected := range map[string]entriesRange{
+		"":                   {noLimit: true},
+		"entries=s=1;i=2":    {cursor: "s=1;i=2", noLimit: true},
+		"entries=:10":        {limit: 10},
+		"entries=s=1:-5:10":  {cursor: "s=1", skip: -5, limit: 10},
+		"entries=:-10:":      {skip: -10, noLimit: true},
+		"entries=s=1;i=2:3:": {cursor: "s=1;i=2", skip: 3, noLimit: true},
+	} {
+		r, err := parseRange(header)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", header, err)
+		}
+
+		if *r != expected {
+			t.Fatalf("expect %+v for %q. Got %+v", expected, header, *r)
+		}
+	}
+
+	for _, header := range []string{"bytes=0-10", "entries=a:b:c", "entries=a:1:2:3", "entries=::x"} {
+		if _, err := parseRange(header); err != ErrInvalidRange {
+			t.Fatalf("expect ErrInvalidRange for %q. Got %v", header, err)
+		}
+	}
+}
+
+var testEntry = &sdjournal.JournalEntry{
+	Cursor:             "s=1;i=2",
+	RealtimeTimestamp:  1500000000123456,
+	MonotonicTimestamp: 42,
+	Fields: map[string]string{
+		"MESSAGE":           "hello\nworld",
+		"SYSLOG_IDENTIFIER": "app",
+		"_PID":              "7",
+		"_HOSTNAME":         "agent1",
+	},
+}
+
+func TestFormatShort(t *testing.T) {
+	b, err := formatShort{}.FormatEntry(testEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasSuffix(b, []byte(" agent1 app[7]: hello\nworld\n")) {
+		t.Fatalf("unexpected short format %q", b)
+	}
+}
+
+func TestFormatExport(t *testing.T) {
+	b, err := formatExport{}.FormatEntry(testEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len("hello\nworld")))
+
+	expected := "__CURSOR=s=1;i=2\n__REALTIME_TIMESTAMP=1500000000123456\n__MONOTONIC_TIMESTAMP=42\n" +
+		"MESSAGE\n" + string(size) + "hello\nworld\n" +
+		"SYSLOG_IDENTIFIER=app\n_HOSTNAME=agent1\n_PID=7\n\n"
+	if string(b) != expected {
+		t.Fatalf("expect %q. Got %q", expected, b)
+	}
+}
@@ -0,0 +1,295 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// bootIDFile contains the current boot ID.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// ErrInvalidRange is returned by parseRange if the Range header is not in entries=cursor[[:num_skip]:num_entries] format.
+var ErrInvalidRange = errors.New("invalid Range header, must be entries=cursor[[:num_skip]:num_entries]")
+
+// entriesRange is a parsed Range header.
+type entriesRange struct {
+	cursor  string
+	skip    int64
+	limit   uint64
+	noLimit bool
+}
+
+// parseRange parses Range: entries=cursor[[:num_skip]:num_entries] header. An empty header
+// returns all entries from the beginning of the journal.
+func parseRange(header string) (*entriesRange, error) {
+	r := &entriesRange{noLimit: true}
+	if header == "" {
+		return r, nil
+	}
+
+	if !strings.HasPrefix(header, "entries=") {
+		return nil, ErrInvalidRange
+	}
+
+	parts := strings.Split(strings.TrimPrefix(header, "entries="), ":")
+	if len(parts) > 3 {
+		return nil, ErrInvalidRange
+	}
+
+	r.cursor = strings.TrimSpace(parts[0])
+
+	var err error
+	switch len(parts) {
+	case 3:
+		if r.skip, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err != nil {
+			return nil, ErrInvalidRange
+		}
+		fallthrough
+	case 2:
+		numEntries := strings.TrimSpace(parts[len(parts)-1])
+		if numEntries == "" {
+			break
+		}
+
+		if r.limit, err = strconv.ParseUint(numEntries, 10, 64); err != nil {
+			return nil, ErrInvalidRange
+		}
+		r.noLimit = false
+	}
+
+	return r, nil
+}
+
+// optionRange positions the journal at the first entry of the range. Unlike the cursor parameter of
+// v2 API, the entry pointed by the cursor is included in the range.
+func optionRange(rng *entriesRange) jr.Option {
+	return func(r *jr.Reader) error {
+		j := r.Journal
+		switch {
+		case rng.cursor != "":
+			if err := j.SeekCursor(rng.cursor); err != nil {
+				return err
+			}
+
+			// move to the entry pointed by the cursor.
+			if _, err := j.Next(); err != nil {
+				return err
+			}
+		case rng.skip < 0:
+			if err := j.SeekTail(); err != nil {
+				return err
+			}
+		default:
+			if err := j.SeekHead(); err != nil {
+				return err
+			}
+
+			// the journal is not positioned on any entry after seeking to the head.
+			if rng.skip > 0 {
+				_, err := j.NextSkip(uint64(rng.skip) + 1)
+				return err
+			}
+		}
+
+		var err error
+		if rng.skip > 0 {
+			_, err = j.NextSkip(uint64(rng.skip))
+		} else if rng.skip < 0 {
+			_, err = j.PreviousSkip(uint64(-rng.skip))
+		}
+		return err
+	}
+}
+
+// reservedParams are the query parameters which are not journal matches.
+var reservedParams = map[string]bool{"follow": true, "discrete": true, "boot": true}
+
+// queryMatches returns journal matches from FIELD=value query parameters.
+func queryMatches(req *http.Request) ([]jr.JournalEntryMatch, error) {
+	var matches []jr.JournalEntryMatch
+	for field, values := range req.URL.Query() {
+		if reservedParams[field] {
+			continue
+		}
+
+		for _, value := range values {
+			matches = append(matches, jr.JournalEntryMatch{Field: field, Value: value})
+		}
+	}
+
+	if _, ok := req.URL.Query()["boot"]; ok {
+		b, err := ioutil.ReadFile(bootIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read boot ID: %s", err)
+		}
+
+		bootID := strings.Replace(strings.TrimSpace(string(b)), "-", "", -1)
+		matches = append(matches, jr.JournalEntryMatch{Field: "_BOOT_ID", Value: bootID})
+	}
+	return matches, nil
+}
+
+// entriesHandler implements GET /entries of systemd-journal-gatewayd.
+// https://www.freedesktop.org/software/systemd/man/systemd-journal-gatewayd.service.html
+func entriesHandler(w http.ResponseWriter, req *http.Request) {
+	rng, err := parseRange(req.Header.Get("Range"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	query := req.URL.Query()
+	_, follow := query["follow"]
+	if _, discrete := query["discrete"]; discrete {
+		if rng.cursor == "" {
+			http.Error(w, "discrete requires a cursor in Range header", http.StatusBadRequest)
+			return
+		}
+		rng.limit, rng.noLimit, follow = 1, false, false
+	}
+
+	matches, err := queryMatches(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// a hidden field cannot be used to probe the values.
+	role := middleware.RedactionRole(req)
+	for _, m := range matches {
+		if role.Hidden(m.Field) {
+			http.Error(w, "field "+m.Field+" is not visible", http.StatusForbidden)
+			return
+		}
+	}
+
+	var opts []jr.Option
+	if len(matches) > 0 {
+		opts = append(opts, jr.OptionMatch(matches))
+	}
+	opts = append(opts, optionRange(rng))
+
+	if !rng.noLimit {
+		opts = append(opts, jr.OptionLimit(rng.limit))
+	}
+
+	opts = append(opts, jr.OptionContext(req.Context()))
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		opts = append(opts, jr.OptionMaxEntrySize(cfg.FlagMaxEntrySize))
+	}
+
+	formatter := newFormatter(req.Header.Get("Accept"))
+	if redaction := middleware.Redaction(req); redaction != nil {
+		formatter = jr.FormatTransform{EntryFormatter: formatter, Fields: redaction}
+	}
+
+	j, err := jr.NewReader(formatter, opts...)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		http.Error(w, "unable to open journald: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := j.Close(); err != nil {
+			logrus.Errorf("error closing journald: %s", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", formatter.GetContentType().String())
+	if _, err := io.Copy(w, j); err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		logrus.Errorf("unable to read the journal: %s. Request: %s", err, req.RequestURI)
+		return
+	}
+
+	// gatewayd stops following once num_entries are sent.
+	if !follow || (!rng.noLimit && j.Limit == 0) {
+		return
+	}
+
+	w.Header().Set("X-Accel-Buffering", "no")
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
+		return
+	}
+
+	f.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			logrus.Debugf("closing a client connection.")
+			return
+		case <-time.After(time.Second):
+			if err := j.Follow(time.Millisecond*100, w); err != nil {
+				if req.Context().Err() != nil {
+					logrus.Debugf("client went away. Request URI: %s", req.RequestURI)
+					return
+				}
+				middleware.UpstreamError(req, middleware.UpstreamJournald)
+				logrus.Errorf("error reading journal %s", err)
+				return
+			}
+			f.Flush()
+
+			if !rng.noLimit && j.Limit == 0 {
+				return
+			}
+		}
+	}
+}
+
+// fieldsHandler implements GET /fields/FIELD of systemd-journal-gatewayd, the unique values of a field
+// are returned one per line, or as JSON objects {"FIELD": "value"} if Accept is application/json.
+func fieldsHandler(w http.ResponseWriter, req *http.Request) {
+	field := mux.Vars(req)["field"]
+	if middleware.RedactionRole(req).Hidden(field) {
+		http.Error(w, "field "+field+" is not visible", http.StatusForbidden)
+		return
+	}
+
+	j, err := jr.NewReader(nil)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		http.Error(w, "unable to open journald: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer j.Close()
+
+	values, err := j.Journal.GetUniqueValues(field)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values = redact.Default().MaskValues(field, values)
+
+	if req.Header.Get("Accept") == jr.ContentTypeApplicationJSON.String() {
+		w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+		encoder := json.NewEncoder(w)
+		for _, v := range values {
+			if err := encoder.Encode(map[string]string{field: v}); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jr.ContentTypePlainText.String())
+	for _, v := range values {
+		fmt.Fprintln(w, v)
+	}
+}
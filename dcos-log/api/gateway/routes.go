@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/gorilla/mux"
+)
+
+// InitRoutes inits systemd-journal-gatewayd compatible routes. The routes require a valid JWT if the
+// verification is enabled.
+func InitRoutes(gw *mux.Router, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) {
+	var verifier middleware.TokenVerifier
+	if cfg.FlagJWTVerify {
+		verifier = middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL)
+	}
+
+	wrap := func(h http.HandlerFunc) http.Handler {
+		var handler http.Handler = h
+		if verifier != nil {
+			handler = middleware.VerifyToken(handler, verifier)
+		} else if cfg.FlagAuth {
+			handler = middleware.RequireToken(handler)
+		}
+		return middleware.Wrapped(handler, cfg, client, nodeInfo)
+	}
+
+	gw.Path("/entries").Handler(wrap(entriesHandler)).Methods("GET", "HEAD")
+	gw.Path("/fields/{field}").Handler(wrap(fieldsHandler)).Methods("GET")
+}
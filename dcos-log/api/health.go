@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/health"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/mesos/master"
+)
+
+// healthCheckTimeout is the timeout of each check of /health and /ready.
+const healthCheckTimeout = 5 * time.Second
+
+// healthChecks returns the checks of the local dependencies, used by /health and the systemd watchdog.
+func healthChecks(cfg *config.Config) []health.Check {
+	return []health.Check{{Name: "journald", Run: checkJournal(cfg)}}
+}
+
+// checkJournal opens the journal read by the API and seeks its last entry.
+func checkJournal(cfg *config.Config) func(ctx context.Context) error {
+	var dirs []string
+	if cfg.FlagJournalDirs != "" {
+		dirs = strings.Split(cfg.FlagJournalDirs, ",")
+	}
+
+	return func(ctx context.Context) error {
+		j, err := jr.NewReader(nil, jr.OptionDirectories(dirs...), jr.OptionSkipPrev(1))
+		if j != nil && j.Journal != nil {
+			j.Close()
+		}
+		return err
+	}
+}
+
+// readinessChecks returns the checks of /ready, the local checks and the Mesos files API and the JWKS endpoint
+// if the token verification is enabled.
+func readinessChecks(cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) []health.Check {
+	checks := append(healthChecks(cfg), health.Check{Name: "mesos_files_api", Run: func(ctx context.Context) error {
+		filesURL := master.URL(cfg.FlagAuth)
+		if cfg.FlagRole != dcos.RoleMaster {
+			agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+			if err != nil {
+				return err
+			}
+			filesURL = *agentURL
+		}
+		filesURL.Path = "/files/debug"
+		return health.HTTPCheck(client, filesURL.String())(ctx)
+	}})
+
+	if cfg.FlagJWTVerify {
+		checks = append(checks, health.Check{Name: "auth", Run: health.HTTPCheck(client, cfg.FlagJWKSURL)})
+	}
+	return checks
+}
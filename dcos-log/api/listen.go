@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/coreos/go-systemd/activation"
+	"github.com/dcos/dcos-log/dcos-log/config"
+)
+
+// listen returns the listeners the API is served on: the sockets passed by systemd socket activation or the TCP
+// address of -listen and -port, and the unix socket of -listen-unix. The activated sockets are inherited open, so
+// the clients may connect before dcos-log is started.
+func listen(cfg *config.Config) ([]net.Listener, error) {
+	activated, err := activation.Listeners(true)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get activated listeners: %s", err)
+	}
+
+	var listeners []net.Listener
+	for _, l := range activated {
+		// the datagram sockets of the socket unit are not listeners.
+		if l != nil {
+			listeners = append(listeners, l)
+		}
+	}
+
+	if len(listeners) == 0 {
+		addr := cfg.FlagListen
+		if addr == "" {
+			addr = fmt.Sprintf(":%d", cfg.FlagPort)
+		}
+
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+
+	if cfg.FlagListenUnix != "" {
+		l, err := listenUnix(cfg.FlagListenUnix, cfg.FlagListenUnixMode)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a unix socket with the file mode of an octal string such as 0660. A socket file left by a
+// previous process is removed, any other file is kept and fails the listen. The file is removed when the
+// listener is closed.
+func listenUnix(path, mode string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unix socket mode %q: %s", mode, err)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dcos-log.sock")
+
+	// the socket of a previous process which was not closed.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenUnix(path, "0660")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Fatalf("expect mode 0660. Got %o", perm)
+	}
+
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expect the socket removed on close. Got %v", err)
+	}
+
+	// a regular file is not replaced.
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listenUnix(path, "0660"); err == nil {
+		t.Fatal("expect an error listening on a regular file")
+	}
+}
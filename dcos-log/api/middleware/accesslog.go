@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// accessLogResponseWriter records the status code, the number of bytes and whether the response is a stream.
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	code   int
+	bytes  int64
+	stream bool
+}
+
+func (w *accessLogResponseWriter) writeHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+
+	w.code = code
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = true
+	}
+}
+
+func (w *accessLogResponseWriter) WriteHeader(code int) {
+	w.writeHeader(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	w.writeHeader(http.StatusOK)
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	w.writeHeader(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.code = http.StatusSwitchingProtocols
+		w.stream = true
+	}
+	return conn, rw, err
+}
+
+// AccessLog is a middleware which logs an entry per request with the route, the mux variables of the route
+// such as frameworkID or name, the status code, the number of bytes sent before compression and the duration.
+// For server sent events and WebSocket streams the duration is the lifetime of the stream.
+func AccessLog(next http.Handler, router *mux.Router, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		route := unmatchedRoute
+		if router.Match(r, &match) {
+			route = routeTemplate(match.Route)
+		}
+
+		aw := &accessLogResponseWriter{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(aw, r)
+
+		code := aw.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		fields := logrus.Fields{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"route":    route,
+			"remote":   r.RemoteAddr,
+			"status":   code,
+			"bytes":    aw.bytes,
+			"duration": time.Since(start).Seconds(),
+			"stream":   aw.stream,
+		}
+
+		for k, v := range match.Vars {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+
+		if aw.stream {
+			fields["client_aborted"] = r.Context().Err() != nil
+		}
+
+		logger.WithFields(fields).Info("access")
+	})
+}
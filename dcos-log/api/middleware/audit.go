@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/audit"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+var auditErrors = metrics.NewCounterVec("dcos_log_audit_errors_total",
+	"Log access events which could not be written to the audit log.")
+
+// auditedPrefixes are the prefixes of the routes which read logs. The metrics, health and version routes are not
+// audited.
+var auditedPrefixes = []string{"/v1/", "/v2/", "/gateway/"}
+
+func audited(route string) bool {
+	if strings.HasSuffix(route, "/version") {
+		return false
+	}
+
+	for _, prefix := range auditedPrefixes {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit is a middleware which records an audit event per request to a log route: the uid of the user, the remote
+// address, the route with its variables, such as the task or the component, the filter parameters, the status code
+// and the number of bytes served. The event of a stream is recorded once it's closed. The requests rejected for a
+// missing or invalid token are audited with an empty uid.
+func Audit(next http.Handler, router *mux.Router, logger audit.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if !router.Match(r, &match) || !audited(routeTemplate(match.Route)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		aw := &accessLogResponseWriter{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(aw, r)
+
+		code := aw.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		uid := ""
+		if code != http.StatusUnauthorized {
+			uid = RequestUID(r)
+		}
+
+		e := audit.Event{
+			Time:     start,
+			UID:      uid,
+			Remote:   r.RemoteAddr,
+			Method:   r.Method,
+			Route:    routeTemplate(match.Route),
+			Path:     r.URL.Path,
+			Vars:     match.Vars,
+			Filters:  r.URL.Query()["filter"],
+			Status:   code,
+			Bytes:    aw.bytes,
+			Duration: time.Since(start).Seconds(),
+		}
+
+		if err := logger.Log(e); err != nil {
+			auditErrors.WithLabelValues().Inc()
+			logrus.Errorf("unable to write audit event of %s: %s", r.URL.Path, err)
+		}
+	})
+}
@@ -18,7 +18,7 @@ import (
 const (
 	sandboxURLScheme  = "https"
 	sandboxPath       = "/files/browse"
-	sandboxBrowsePath = "/var/lib/mesos/slave/slaves"
+	sandboxSlaves     = "slaves"
 	sandboxFrameworks = "frameworks"
 	sandboxExecutors  = "executors"
 	sandboxRuns       = "runs"
@@ -68,8 +68,9 @@ func GetAuthFromRequest(r *http.Request) (string, error) {
 	return "", ErrMissingToken
 }
 
-// Auth is a middleware that validates a user has a valid JWT to access the given endpoint.
-func Auth(next http.Handler, client *http.Client, nodeInfo nodeutil.NodeInfo, role string) http.Handler {
+// Auth is a middleware that validates a user has a valid JWT to access the given endpoint. workDir is mesos agent
+// --work_dir the sandboxes are in.
+func Auth(next http.Handler, client *http.Client, nodeInfo nodeutil.NodeInfo, role, workDir string) http.Handler {
 	if nodeInfo == nil {
 		panic("nodeInfo cannot be nil")
 	}
@@ -110,8 +111,8 @@ func Auth(next http.Handler, client *http.Client, nodeInfo nodeutil.NodeInfo, ro
 			return
 		}
 
-		// "/var/lib/mesos/slave/slaves/<mesos_id>/frameworks/<framework_id>/executors/<executor_id>/runs/<container_id>"
-		sandboxPath := filepath.Join(sandboxBrowsePath, mesosID, sandboxFrameworks, frameworkID, sandboxExecutors,
+		// "<work_dir>/slaves/<mesos_id>/frameworks/<framework_id>/executors/<executor_id>/runs/<container_id>"
+		sandboxPath := filepath.Join(workDir, sandboxSlaves, mesosID, sandboxFrameworks, frameworkID, sandboxExecutors,
 			executorID, sandboxRuns, containerID)
 		sandboxBaseURL.RawQuery = "path=" + url.QueryEscape(sandboxPath)
 
@@ -140,3 +141,15 @@ func Auth(next http.Handler, client *http.Client, nodeInfo nodeutil.NodeInfo, ro
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireToken is a middleware which rejects requests without JWT in the Authorization header.
+// The token itself is validated by adminrouter.
+func RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetAuthFromRequest(r); err != nil {
+			http.Error(w, fmt.Sprintf("Token error: %s", err.Error()), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// RequestDecorator modifies an outgoing request to Mesos before it is sent, for instance to add headers, sign
+// the request or rewrite the URL to route it through a proxy. The request is a copy owned by the decorator.
+// An error aborts the request.
+type RequestDecorator func(*http.Request) error
+
+type decoratedTransport struct {
+	base       http.RoundTripper
+	decorators []RequestDecorator
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *decoratedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the request.
+	r := req.WithContext(req.Context())
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+
+	urlCopy := *req.URL
+	r.URL = &urlCopy
+
+	for _, decorate := range t.decorators {
+		if err := decorate(r); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(r)
+}
+
+// DecorateTransport returns a transport which applies the decorators to every request before it is sent
+// with base. If there are no decorators base is returned.
+func DecorateTransport(base http.RoundTripper, decorators ...RequestDecorator) http.RoundTripper {
+	if len(decorators) == 0 {
+		return base
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &decoratedTransport{base: base, decorators: decorators}
+}
+
+// Undecorated returns a copy of the client without request decorators. It's used for requests which are
+// not sent to Mesos, like archive and export storage.
+func Undecorated(client *http.Client) *http.Client {
+	t, ok := client.Transport.(*decoratedTransport)
+	if !ok {
+		return client
+	}
+
+	undecorated := *client
+	undecorated.Transport = t.base
+	return &undecorated
+}
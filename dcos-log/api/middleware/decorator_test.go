@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecorateTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signature") != "signed" || r.Header.Get("Authorization") != "token" {
+			t.Errorf("expect decorated request. Got %v", r.Header)
+		}
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: DecorateTransport(http.DefaultTransport, func(r *http.Request) error {
+		r.Header.Set("X-Signature", "signed")
+		return nil
+	})}
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "token")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if req.Header.Get("X-Signature") != "" {
+		t.Fatal("expect the original request to be unchanged")
+	}
+
+	if Undecorated(client).Transport != http.DefaultTransport {
+		t.Fatal("expect undecorated transport")
+	}
+
+	failing := &http.Client{Transport: DecorateTransport(http.DefaultTransport, func(r *http.Request) error {
+		return errors.New("unable to sign")
+	})}
+	if _, err := failing.Get(ts.URL); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// drainComment is the last event of a server sent events stream closed by a shutdown, EventSource clients
+// reconnect to another instance.
+const drainComment = ": shutdown\n\n"
+
+// Drainer closes the open streams on shutdown. http.Server.Shutdown waits for the handlers to return, but
+// streams only return when their request context is done.
+type Drainer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+// NewDrainer returns a new instance of Drainer.
+func NewDrainer() *Drainer {
+	return &Drainer{done: make(chan struct{})}
+}
+
+// Drain cancels the context of the requests being served and of the new requests.
+func (d *Drainer) Drain() {
+	d.once.Do(func() { close(d.done) })
+}
+
+func (d *Drainer) draining() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// drained returns true if the request context was canceled by Drain.
+func drained(ctx context.Context) bool {
+	d, ok := ctx.Value(drainKey).(*Drainer)
+	return ok && d.draining()
+}
+
+// Handler is a middleware which cancels the request context on Drain. A server sent events stream ends with a
+// comment, so the client can tell the shutdown from a network error.
+func (d *Drainer) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(withKeyContext(r.Context(), drainKey, d))
+		defer cancel()
+
+		go func() {
+			select {
+			case <-d.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if !d.draining() || r.Context().Err() != nil ||
+			!strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+
+		io.WriteString(w, drainComment)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainer(t *testing.T) {
+	d := NewDrainer()
+	started := make(chan struct{}, 1)
+	h := d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: entry\n\n"))
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+
+		if !drained(r.Context()) {
+			t.Error("expect the request to be drained")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/v2/component", nil))
+		close(done)
+	}()
+
+	<-started
+	d.Drain()
+	d.Drain()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the stream to be closed")
+	}
+
+	if body := w.Body.String(); !strings.HasSuffix(body, "data: entry\n\n"+drainComment) || !w.Flushed {
+		t.Fatalf("expect the stream to end with the shutdown comment. Got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v2/component", nil))
+	if !strings.HasSuffix(w.Body.String(), drainComment) {
+		t.Fatalf("expect a new stream to be closed at once. Got %q", w.Body.String())
+	}
+}
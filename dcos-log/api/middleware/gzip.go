@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// acceptsGzip returns true if a client accepts gzip content encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(encoding, ";")
+		name := strings.TrimSpace(parts[0])
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter compresses a response once the headers are written. Responses which set Content-Encoding or
+// Content-Disposition, such as downloads, and responses without a body are sent as is.
+type compressWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" && h.Get("Content-Disposition") == "" && code >= http.StatusOK &&
+		code != http.StatusNoContent && code != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush sends the data compressed so far, so the entries of a stream are not held in the compressor.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) close() {
+	if w.gz == nil {
+		return
+	}
+
+	w.gz.Close()
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+}
+
+// Gzip is a middleware which compresses the responses of the clients sending Accept-Encoding: gzip, except
+// the protocol upgrade and HEAD requests.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the connection of an upgrade request is taken over by the handler, HEAD responses keep the
+		// Content-Length of the uncompressed content. The gRPC messages are framed, not compressed.
+		if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" || r.Method == http.MethodHead ||
+			strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
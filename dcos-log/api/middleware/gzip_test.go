@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, expect := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"gzip;q=0":            false,
+		"*":                   true,
+		"br":                  false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", header)
+		if acceptsGzip(r) != expect {
+			t.Fatalf("%q: expect %t", header, expect)
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download" {
+			w.Header().Set("Content-Disposition", "attachment; filename=stdout")
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expect gzip content encoding. Got %v", rec.Header())
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello" {
+		t.Fatalf("expect hello. Got %s", body)
+	}
+
+	// downloads, HEAD requests and clients without Accept-Encoding get the response as is.
+	for _, r := range []*http.Request{httptest.NewRequest("GET", "/", nil), httptest.NewRequest("GET", "/download", nil),
+		httptest.NewRequest("HEAD", "/", nil)} {
+		if r.URL.Path == "/download" || r.Method == "HEAD" {
+			r.Header.Set("Accept-Encoding", "gzip")
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "hello" {
+			t.Fatalf("%s: expect plain response. Got %v %q", r.URL.Path, rec.Header(), rec.Body.String())
+		}
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	next := make(chan struct{})
+	ts := httptest.NewServer(Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+
+		w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+		<-next
+
+		w.Write([]byte("data: two\n\n"))
+	})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first entry is received before the handler writes the second one.
+	scanner := bufio.NewScanner(gz)
+	if !scanner.Scan() || scanner.Text() != "data: one" {
+		t.Fatalf("expect the first entry. Got %q %v", scanner.Text(), scanner.Err())
+	}
+	close(next)
+
+	scanner.Scan()
+	if !scanner.Scan() || scanner.Text() != "data: two" {
+		t.Fatalf("expect the second entry. Got %q %v", scanner.Text(), scanner.Err())
+	}
+}
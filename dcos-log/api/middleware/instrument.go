@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+	"github.com/gorilla/mux"
+)
+
+// upstream services dcos-log depends on.
+const (
+	UpstreamMaster   = "master"
+	UpstreamAgent    = "agent"
+	UpstreamJournald = "journald"
+	UpstreamDocker   = "docker"
+)
+
+const unmatchedRoute = "unmatched"
+
+// reasons a stream was closed.
+const (
+	closedByClient = "client_aborted"
+	closedByServer = "server_terminated"
+)
+
+var (
+	requestDuration = metrics.NewHistogramVec("dcos_log_http_request_duration_seconds",
+		"Latency of non streaming HTTP requests.", metrics.DefaultLatencyBuckets, "route", "method", "code")
+
+	streamDuration = metrics.NewHistogramVec("dcos_log_stream_duration_seconds",
+		"Duration of server sent events streams.", metrics.DefaultDurationBuckets, "route")
+
+	activeStreams = metrics.NewGaugeVec("dcos_log_active_streams",
+		"Number of currently open server sent events streams.", "route")
+
+	streamsClosed = metrics.NewCounterVec("dcos_log_streams_closed_total",
+		"Server sent events streams closed by the client (client_aborted) or by the server (server_terminated).",
+		"route", "reason")
+
+	upstreamErrors = metrics.NewCounterVec("dcos_log_upstream_errors_total",
+		"Errors returned by upstream services.", "upstream", "route")
+
+	responseBytes = metrics.NewCounterVec("dcos_log_http_response_bytes_total",
+		"Bytes of response bodies before compression.", "route")
+)
+
+// instrumentedResponseWriter records the response status code and keeps the
+// http.Flusher and http.Hijacker interfaces the handlers rely on. A stream is registered in openStreams with the
+// cancel func of the request context.
+type instrumentedResponseWriter struct {
+	http.ResponseWriter
+	route  string
+	code   int
+	stream bool
+
+	req    *http.Request
+	cancel context.CancelFunc
+	id     uint64
+}
+
+// detectStream marks the response as a stream once the headers are sent.
+func (w *instrumentedResponseWriter) detectStream() {
+	if w.code != 0 {
+		return
+	}
+
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.openStream()
+	}
+}
+
+func (w *instrumentedResponseWriter) openStream() {
+	w.stream = true
+	activeStreams.WithLabelValues(w.route).Inc()
+	w.id = openStreams.add(w.req, w.route, w.cancel)
+}
+
+func (w *instrumentedResponseWriter) WriteHeader(code int) {
+	w.detectStream()
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *instrumentedResponseWriter) Write(b []byte) (int, error) {
+	w.detectStream()
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	responseBytes.WithLabelValues(w.route).Add(float64(n))
+	return n, err
+}
+
+func (w *instrumentedResponseWriter) Flush() {
+	w.detectStream()
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection of an upgraded protocol, which is observed as a stream.
+func (w *instrumentedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && !w.stream {
+		w.openStream()
+	}
+	return conn, rw, err
+}
+
+// routeTemplate returns a path template of the route, used as a metric label to keep
+// the cardinality low.
+func routeTemplate(route *mux.Route) string {
+	if route == nil {
+		return unmatchedRoute
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return tpl
+}
+
+// Instrument is a middleware which observes request latencies per route. Server sent events
+// streams are observed separately, since their duration depends on a client. A stream is closed by
+// the client if the request context was canceled before the handler returned, unless it was canceled by a
+// Drainer. Each request is traced with a server span continuing the trace of the traceparent header.
+func Instrument(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		route := unmatchedRoute
+		if router.Match(r, &match) {
+			route = routeTemplate(match.Route)
+		}
+
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+route, tracing.KindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		defer span.End()
+
+		// the context of a stream is canceled by TerminateStream.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req := r.WithContext(ctx)
+		iw := &instrumentedResponseWriter{ResponseWriter: w, route: route, req: req, cancel: cancel}
+		start := time.Now()
+		router.ServeHTTP(iw, req)
+		elapsed := time.Since(start).Seconds()
+
+		if iw.stream {
+			openStreams.remove(iw.id)
+			activeStreams.WithLabelValues(route).Dec()
+			streamDuration.WithLabelValues(route).Observe(elapsed)
+
+			reason := closedByServer
+			if r.Context().Err() != nil && !drained(r.Context()) {
+				reason = closedByClient
+			}
+			streamsClosed.WithLabelValues(route, reason).Inc()
+			return
+		}
+
+		code := iw.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		span.SetAttribute("http.status_code", strconv.Itoa(code))
+		if code >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(code)))
+		}
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(code)).Observe(elapsed)
+	})
+}
+
+// ActiveStreams returns a number of open server sent events streams per route.
+func ActiveStreams() map[string]float64 {
+	return activeStreams.Values()
+}
+
+// UpstreamError increments the error counter of the upstream service for the current route. Errors of
+// requests the client went away from are not counted.
+func UpstreamError(r *http.Request, upstream string) {
+	if r.Context().Err() != nil {
+		return
+	}
+
+	if span := tracing.FromContext(r.Context()); span != nil {
+		span.SetAttribute("upstream.error", upstream)
+	}
+	upstreamErrors.WithLabelValues(upstream, routeTemplate(mux.CurrentRoute(r))).Inc()
+}
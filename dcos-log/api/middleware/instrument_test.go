@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/audit"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func TestInstrumentStreamsClosed(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/stream/{reason}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		if mux.Vars(req)["reason"] == "client" {
+			<-req.Context().Done()
+		}
+	})
+
+	const route = "/stream/{reason}"
+	client := streamsClosed.WithLabelValues(route, closedByClient).Value()
+	server := streamsClosed.WithLabelValues(route, closedByServer).Value()
+
+	h := Instrument(router)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream/server", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream/client", nil).WithContext(ctx))
+
+	if v := streamsClosed.WithLabelValues(route, closedByServer).Value(); v != server+1 {
+		t.Fatalf("expect 1 stream closed by the server. Got %v", v-server)
+	}
+
+	if v := streamsClosed.WithLabelValues(route, closedByClient).Value(); v != client+1 {
+		t.Fatalf("expect 1 stream closed by the client. Got %v", v-client)
+	}
+}
+
+func TestInstrumentTrace(t *testing.T) {
+	var traceparent string
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/component/{name}", func(w http.ResponseWriter, req *http.Request) {
+		header := http.Header{}
+		tracing.Inject(req.Context(), header)
+		traceparent = header.Get(tracing.TraceparentHeader)
+	})
+
+	req := httptest.NewRequest("GET", "/v2/component/dcos-mesos-master", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	Instrument(router).ServeHTTP(httptest.NewRecorder(), req)
+
+	c, err := tracing.ParseTraceparent(traceparent)
+	if err != nil {
+		t.Fatalf("expect a traceparent in the handler context. Got %q", traceparent)
+	}
+
+	if c.Traceparent()[3:35] != "0af7651916cd43dd8448eb211c80319c" || c.Traceparent()[36:52] == "b7ad6b7169203331" {
+		t.Fatalf("expect a server span in the incoming trace. Got %s", traceparent)
+	}
+}
+
+func TestUpstreamErrorClientGone(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	before := upstreamErrors.WithLabelValues(UpstreamAgent, unmatchedRoute).Value()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	UpstreamError(req.WithContext(ctx), UpstreamAgent)
+	if v := upstreamErrors.WithLabelValues(UpstreamAgent, unmatchedRoute).Value(); v != before {
+		t.Fatalf("expect aborted request not to be counted. Got %v", v-before)
+	}
+
+	UpstreamError(req, UpstreamAgent)
+	if v := upstreamErrors.WithLabelValues(UpstreamAgent, unmatchedRoute).Value(); v != before+1 {
+		t.Fatalf("expect upstream error to be counted. Got %v", v-before)
+	}
+}
+
+func TestInstrumentHijack(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	})
+
+	server := streamsClosed.WithLabelValues("/ws", closedByServer).Value()
+	ts := httptest.NewServer(Gzip(Instrument(router)))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Upgrade", "websocket")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	// the handler returns after the client sees the closed connection.
+	for i := 0; i < 100 && streamsClosed.WithLabelValues("/ws", closedByServer).Value() == server; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if v := streamsClosed.WithLabelValues("/ws", closedByServer).Value(); v != server+1 {
+		t.Fatalf("expect the hijacked connection to be observed as a stream. Got %v", v-server)
+	}
+}
+
+func TestInstrumentResponseBytes(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/bytes", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	before := responseBytes.WithLabelValues("/bytes").Value()
+	Instrument(router).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bytes", nil))
+
+	if v := responseBytes.WithLabelValues("/bytes").Value(); v != before+5 {
+		t.Fatalf("expect 5 bytes. Got %v", v-before)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/frameworks/{frameworkID}/tasks/{taskID}", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	})
+
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = buf
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	AccessLog(router, router, logger).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/frameworks/f1/tasks/t1", nil))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]interface{}{
+		"route":       "/frameworks/{frameworkID}/tasks/{taskID}",
+		"frameworkID": "f1",
+		"taskID":      "t1",
+		"status":      float64(http.StatusAccepted),
+		"bytes":       float64(5),
+		"stream":      false,
+	}
+
+	for k, v := range expect {
+		if entry[k] != v {
+			t.Fatalf("expect %s %v. Got %v", k, v, entry[k])
+		}
+	}
+}
+
+type auditRecorder []audit.Event
+
+func (r *auditRecorder) Log(e audit.Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/task/{taskID}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	router.HandleFunc("/v2/version", func(w http.ResponseWriter, req *http.Request) {})
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {})
+
+	events := &auditRecorder{}
+	h := Audit(router, router, events)
+	for _, target := range []string{"/v2/task/t1?filter=unit:a&filter=unit:b", "/v2/version", "/metrics", "/unknown"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	if len(*events) != 1 {
+		t.Fatalf("expect the task log read audited only. Got %+v", *events)
+	}
+
+	e := (*events)[0]
+	if e.Route != "/v2/task/{taskID}" || e.Vars["taskID"] != "t1" || e.Bytes != 5 || e.Status != http.StatusOK ||
+		strings.Join(e.Filters, ",") != "unit:a,unit:b" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
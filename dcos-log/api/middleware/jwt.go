@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// jwksRefreshInterval is the shortest interval between two fetches of the JWKS, a token signed by an unknown
+// key does not trigger a fetch more often.
+const jwksRefreshInterval = time.Minute
+
+// jwtLeeway is the clock skew allowed when the expiry of a token is validated.
+const jwtLeeway = 30 * time.Second
+
+var (
+	// ErrUnknownKey is returned by JWKSVerifier if a token is signed by a key which is not in the JWKS.
+	ErrUnknownKey = errors.New("token is signed by an unknown key")
+
+	// ErrMissingUID is returned by JWKSVerifier if a token has no uid claim.
+	ErrMissingUID = errors.New("token has no uid claim")
+
+	// ErrMissingExpiry is returned by JWKSVerifier if a token has no exp claim.
+	ErrMissingExpiry = errors.New("token has no exp claim")
+)
+
+// TokenVerifier verifies a JWT and returns the uid of the user.
+type TokenVerifier interface {
+	Verify(token string) (string, error)
+}
+
+// JWKSVerifier verifies the RS256 tokens issued by DC/OS IAM, the public keys are fetched from the IAM JWKS
+// endpoint. The keys are fetched again when a token is signed by an unknown key, so rotated keys are picked up.
+type JWKSVerifier struct {
+	client *http.Client
+	url    string
+
+	mu        sync.Mutex
+	keys      jose.JSONWebKeySet
+	fetchedAt time.Time
+
+	now func() time.Time
+}
+
+// NewJWKSVerifier returns a new instance of JWKSVerifier fetching the keys from a given URL, for instance
+// https://leader.mesos/acs/api/v1/auth/jwks.
+func NewJWKSVerifier(client *http.Client, url string) *JWKSVerifier {
+	return &JWKSVerifier{
+		client: client,
+		url:    url,
+		now:    time.Now,
+	}
+}
+
+// fetch reads the JWKS, the caller must hold the lock.
+func (v *JWKSVerifier) fetch() error {
+	v.fetchedAt = v.now()
+
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch JWKS %s. Invalid response code: %d", v.url, resp.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return fmt.Errorf("unable to decode JWKS %s: %s", v.url, err)
+	}
+	v.keys = keys
+	return nil
+}
+
+// lookup returns the keys with a given key ID, or all keys if the token has no key ID.
+func (v *JWKSVerifier) lookup(kid string) ([]jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	find := func() []jose.JSONWebKey {
+		if kid == "" {
+			return v.keys.Keys
+		}
+		return v.keys.Key(kid)
+	}
+
+	if keys := find(); len(keys) > 0 {
+		return keys, nil
+	}
+
+	if !v.fetchedAt.IsZero() && v.now().Sub(v.fetchedAt) < jwksRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	if err := v.fetch(); err != nil {
+		return nil, err
+	}
+
+	if keys := find(); len(keys) > 0 {
+		return keys, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// Verify validates the signature, the expiry and the uid claim of a token. The token may be prefixed with
+// "token=", as in the DC/OS Authorization header.
+func (v *JWKSVerifier) Verify(token string) (string, error) {
+	tok, err := jwt.ParseSigned(strings.TrimPrefix(token, "token="))
+	if err != nil {
+		return "", err
+	}
+
+	if len(tok.Headers) != 1 || tok.Headers[0].Algorithm != string(jose.RS256) {
+		return "", errors.New("token must be signed with RS256")
+	}
+
+	keys, err := v.lookup(tok.Headers[0].KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		claims jwt.Claims
+		custom struct {
+			UID string `json:"uid"`
+		}
+	)
+
+	err = ErrUnknownKey
+	for _, key := range keys {
+		if err = tok.Claims(key.Key, &claims, &custom); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if claims.Expiry == 0 {
+		return "", ErrMissingExpiry
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{Time: v.now()}, jwtLeeway); err != nil {
+		return "", err
+	}
+
+	if custom.UID == "" {
+		return "", ErrMissingUID
+	}
+	return custom.UID, nil
+}
+
+// WithUIDContext puts the uid of an authenticated user into a context.
+func WithUIDContext(ctx context.Context, uid string) context.Context {
+	return withKeyContext(ctx, uidKey, uid)
+}
+
+// FromContextUID returns the uid of the authenticated user if the request was verified by VerifyToken.
+func FromContextUID(ctx context.Context) (string, bool) {
+	instance, ok := fromContextByKey(ctx, uidKey)
+	if !ok {
+		return "", ok
+	}
+
+	uid, ok := instance.(string)
+	return uid, ok
+}
+
+// RequestUID returns the uid of the user of a request: the uid verified by VerifyToken or, if the verification
+// is disabled, the uid claim of the token validated by adminrouter. Empty string is returned if there is no token.
+func RequestUID(r *http.Request) string {
+	if uid, ok := FromContextUID(r.Context()); ok {
+		return uid
+	}
+
+	token, _ := GetAuthFromRequest(r)
+	return redact.UID(token)
+}
+
+// VerifyToken is a middleware which rejects the requests without a valid JWT in the Authorization header. The
+// uid of the user is available to the next handler with FromContextUID.
+func VerifyToken(next http.Handler, verifier TokenVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := GetAuthFromRequest(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Token error: %s", err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		uid, err := verifier.Verify(token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Token error: %s", err.Error()), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUIDContext(r.Context(), uid)))
+	})
+}
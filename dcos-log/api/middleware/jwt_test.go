@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "token=" + token
+}
+
+func TestVerifyToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key1", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	}))
+	defer jwks.Close()
+
+	now := time.Unix(1500000000, 0)
+	verifier := NewJWKSVerifier(http.DefaultClient, jwks.URL)
+	verifier.now = func() time.Time { return now }
+
+	h := VerifyToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, _ := FromContextUID(r.Context())
+		w.Write([]byte(uid))
+	}), verifier)
+
+	exp := jwt.NewNumericDate(now.Add(time.Hour))
+	for _, tc := range []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid", signToken(t, key, "key1", map[string]interface{}{"uid": "alice", "exp": exp}), http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"expired", signToken(t, key, "key1", map[string]interface{}{"uid": "alice", "exp": jwt.NewNumericDate(now.Add(-time.Hour))}), http.StatusUnauthorized},
+		{"no expiry", signToken(t, key, "key1", map[string]interface{}{"uid": "alice"}), http.StatusUnauthorized},
+		{"no uid", signToken(t, key, "key1", map[string]interface{}{"exp": exp}), http.StatusUnauthorized},
+		{"bad signature", signToken(t, other, "key1", map[string]interface{}{"uid": "alice", "exp": exp}), http.StatusUnauthorized},
+		{"unknown key", signToken(t, other, "key2", map[string]interface{}{"uid": "alice", "exp": exp}), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", tc.token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%s: expect status %d. Got %d: %s", tc.name, tc.code, w.Code, w.Body.String())
+		}
+
+		if tc.code == http.StatusOK && w.Body.String() != "alice" {
+			t.Fatalf("%s: expect uid alice. Got %s", tc.name, w.Body.String())
+		}
+	}
+
+	// an unknown key fetches the keys again at most once per interval.
+	if fetches != 1 {
+		t.Fatalf("expect 1 JWKS fetch. Got %d", fetches)
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/dcos/dcos-go/dcos/nodeutil"
@@ -16,6 +17,9 @@ const (
 	httpClientKey
 	nodeInfoKey
 	tokenKey
+	uidKey
+	drainKey
+	clientKeyKey
 )
 
 // withKeyContext returns a context with an encapsulated object by a key.
@@ -88,11 +92,25 @@ func FromContextToken(ctx context.Context) (string, bool) {
 	return *token, ok
 }
 
-// Wrapped wraps an http handler with values in a context.
+// reloadedConfig holds the config set by SetConfig.
+var reloadedConfig atomic.Value
+
+// SetConfig replaces the config of the new requests, the requests being served keep the config they started
+// with.
+func SetConfig(cfg *config.Config) {
+	reloadedConfig.Store(cfg)
+}
+
+// Wrapped wraps an http handler with values in a context. The config is replaced by the one set by SetConfig.
 func Wrapped(next http.Handler, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCfg := cfg
+		if reloaded, ok := reloadedConfig.Load().(*config.Config); ok {
+			requestCfg = reloaded
+		}
+
 		ctx := r.Context()
-		ctx = WithConfigContext(ctx, cfg)
+		ctx = WithConfigContext(ctx, requestCfg)
 		ctx = WithHTTPClientContext(ctx, client)
 		ctx = WithNodeInfoContext(ctx, nodeInfo)
 
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+)
+
+// quotaWindow is the window the response bytes of a client are counted in.
+const quotaWindow = time.Hour
+
+// quotas a stream was closed by, a client over the bytes quota is also rejected with the reason "bytes".
+const (
+	limitedByBytes    = "bytes"
+	limitedByDuration = "duration"
+)
+
+// errQuotaExceeded is returned by the writes of a response closed by a quota.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+var quotaClosed = metrics.NewCounterVec("dcos_log_quota_closed_total",
+	"Responses closed because the client exceeded the bytes per hour (bytes) or the stream duration (duration).",
+	"quota")
+
+// usage is the response bytes of a client in the current window.
+type usage struct {
+	bytes int64
+	start time.Time
+}
+
+// SetQuotas changes the quotas of the clients: the maximum duration of a stream and the response bytes per hour.
+// Zero disables a quota. The bytes already counted in the current hour are kept.
+func (l *Limiter) SetQuotas(maxStreamDuration time.Duration, maxBytesPerHour int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxStreamDuration, l.maxBytesPerHour = maxStreamDuration, maxBytesPerHour
+}
+
+// quotas returns the stream duration and the bytes per hour quotas.
+func (l *Limiter) quotas() (time.Duration, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxStreamDuration, l.maxBytesPerHour
+}
+
+// usageOf returns the usage of a client, a new one if the window of the previous one has passed. l.mu must be held.
+func (l *Limiter) usageOf(key string, now time.Time) *usage {
+	u, ok := l.usage[key]
+	if !ok || now.Sub(u.start) >= quotaWindow {
+		u = &usage{start: now}
+		l.usage[key] = u
+	}
+	return u
+}
+
+// allowBytes returns false and the time until the window ends if a client has used its bytes of the hour.
+func (l *Limiter) allowBytes(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	u := l.usageOf(key, now)
+	if l.maxBytesPerHour > 0 && u.bytes >= l.maxBytesPerHour {
+		return false, u.start.Add(quotaWindow).Sub(now)
+	}
+	return true, 0
+}
+
+// addBytes counts the response bytes of a client, it returns false once the client is over the quota.
+func (l *Limiter) addBytes(key string, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.usageOf(key, l.now())
+	u.bytes += int64(n)
+	return l.maxBytesPerHour <= 0 || u.bytes < l.maxBytesPerHour
+}
+
+// quotaResponseWriter counts the bytes written to a client and closes the response once a quota is exceeded: a
+// server sent events stream gets a last quota event with the reason, the request context is canceled and the
+// next writes fail. The writes are serialized, the stream duration quota closes the response from a timer.
+type quotaResponseWriter struct {
+	http.ResponseWriter
+	limiter *Limiter
+	key     string
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	closed   bool
+	hijacked bool
+	sse      bool
+}
+
+// close closes the response because of quota, it's a no-op if the response is already closed.
+func (w *quotaResponseWriter) close(quota string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeLocked(quota)
+}
+
+func (w *quotaResponseWriter) closeLocked(quota string) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	quotaClosed.WithLabelValues(quota).Inc()
+
+	if w.sse && !w.hijacked {
+		fmt.Fprintf(w.ResponseWriter, "event: quota\ndata: {\"quota\":%q}\n\n", quota)
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	w.cancel()
+}
+
+// detectSSE records if the response is a server sent events stream, the headers are only read by the goroutine of
+// the handler. w.mu must be held.
+func (w *quotaResponseWriter) detectSSE() {
+	if !w.sse {
+		w.sse = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+}
+
+func (w *quotaResponseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.detectSSE()
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *quotaResponseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errQuotaExceeded
+	}
+	w.detectSSE()
+
+	n, err := w.ResponseWriter.Write(b)
+	if !w.limiter.addBytes(w.key, n) {
+		w.closeLocked(limitedByBytes)
+	}
+	return n, err
+}
+
+func (w *quotaResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.closed {
+		w.detectSSE()
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection of an upgraded protocol. The bytes sent over the connection are not counted,
+// the stream duration quota cancels the request context only.
+func (w *quotaResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// serveWithQuotas serves a request of a client with the bytes quota, and the duration quota if it's a stream.
+func (l *Limiter) serveWithQuotas(next http.Handler, w http.ResponseWriter, r *http.Request, key string,
+	stream bool) {
+	maxStreamDuration, maxBytesPerHour := l.quotas()
+	if maxStreamDuration <= 0 && maxBytesPerHour <= 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if ok, retryAfter := l.allowBytes(key); !ok {
+		tooManyRequests(w, limitedByBytes, retryAfter)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	qw := &quotaResponseWriter{ResponseWriter: w, limiter: l, key: key, cancel: cancel}
+	if stream && maxStreamDuration > 0 {
+		timer := time.AfterFunc(maxStreamDuration, func() { qw.close(limitedByDuration) })
+		defer timer.Stop()
+	}
+	next.ServeHTTP(qw, r.WithContext(ctx))
+
+	// a goroutine of the handler writing after it returned must not reach the connection of the next request.
+	qw.mu.Lock()
+	qw.closed = true
+	qw.mu.Unlock()
+}
+
+// sweepUsage removes the usage of the windows which have passed. l.mu must be held.
+func (l *Limiter) sweepUsage(now time.Time) {
+	for key, u := range l.usage {
+		if now.Sub(u.start) >= quotaWindow {
+			delete(l.usage, key)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+)
+
+// streamRetryAfter is the Retry-After value of the requests rejected because the client has too many open
+// streams, there is no way to tell when one of them is closed.
+const streamRetryAfter = 10 * time.Second
+
+// bucketSweepInterval is how often the idle buckets are removed.
+const bucketSweepInterval = time.Minute
+
+// reasons a request was rejected.
+const (
+	limitedByRate    = "rate"
+	limitedByStreams = "streams"
+)
+
+var rateLimited = metrics.NewCounterVec("dcos_log_rate_limited_total",
+	"Requests rejected with 429 because the client exceeded the request rate (rate), the open streams (streams) or the bytes per hour (bytes).",
+	"reason")
+
+// bucket is a token bucket of a client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter limits the request rate of every client with a token bucket and the number of streams a client
+// may keep open. A client is the uid of the JWT in the Authorization header, or the remote IP address of
+// the requests without a token. With a verifier, only the uid of a valid token is used.
+type Limiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	maxStreams int
+	verifier   TokenVerifier
+
+	maxStreamDuration time.Duration
+	maxBytesPerHour   int64
+
+	buckets   map[string]*bucket
+	streams   map[string]int
+	usage     map[string]*usage
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// NewLimiter returns a Limiter allowing rate requests per second with bursts of burst requests and maxStreams
+// open streams per client. A zero rate or maxStreams disables the corresponding limit.
+func NewLimiter(rate float64, burst, maxStreams int) *Limiter {
+	l := &Limiter{
+		buckets: make(map[string]*bucket),
+		streams: make(map[string]int),
+		usage:   make(map[string]*usage),
+		now:     time.Now,
+	}
+	l.SetLimits(rate, burst, maxStreams)
+	return l
+}
+
+// SetLimits changes the limits, for instance when the config is reloaded. The tokens of the clients and their
+// open streams are kept, a lower maxStreams only rejects new streams.
+func (l *Limiter) SetLimits(rate float64, burst, maxStreams int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst, l.maxStreams = rate, float64(burst), maxStreams
+}
+
+// SetVerifier makes the limiter count the requests by the uid only if the token is valid, the requests with
+// an invalid token are counted by the remote IP address. It must be set when the tokens are verified by
+// VerifyToken, which runs after the limiter, otherwise a client could pick the bucket of any uid.
+func (l *Limiter) SetVerifier(verifier TokenVerifier) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.verifier = verifier
+}
+
+// limits returns the request rate and the open streams limits.
+func (l *Limiter) limits() (float64, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, l.maxStreams
+}
+
+// clientKey returns the key the limits of a request are counted by. If verifier is not nil, the uid of the
+// token is used only if the token is valid.
+func clientKey(r *http.Request, verifier TokenVerifier) string {
+	if key, ok := r.Context().Value(clientKeyKey).(string); ok {
+		return key
+	}
+
+	if verifier == nil {
+		if uid := RequestUID(r); uid != "" {
+			return "uid:" + uid
+		}
+	} else if token, err := GetAuthFromRequest(r); err == nil {
+		if uid, err := verifier.Verify(token); err == nil {
+			return "uid:" + uid
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// isStream returns true if the request asks for a response which stays open: server sent events, WebSocket,
+// followed task logs, v1 stream endpoints and the stream methods of the gRPC Logs service.
+func isStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.Header.Get("Upgrade") != "" ||
+		r.URL.Query().Get("follow") == "true" || strings.HasPrefix(r.URL.Path, "/v1/stream/") ||
+		strings.HasPrefix(r.URL.Path, "/dcos.log.v1.Logs/Stream")
+}
+
+// allow takes a token from the bucket of a client. If the bucket is empty, it returns false and the time
+// until the next token.
+func (l *Limiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes the buckets which are full again, a new bucket would be the same, and the usage of the past
+// windows.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	l.sweepUsage(now)
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// acquireStream counts a new stream of a client, it returns false if the client has maxStreams open streams.
+func (l *Limiter) acquireStream(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.streams[key] >= l.maxStreams {
+		return false
+	}
+	l.streams[key]++
+	return true
+}
+
+func (l *Limiter) releaseStream(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.streams[key]--
+	if l.streams[key] <= 0 {
+		delete(l.streams, key)
+	}
+}
+
+// tooManyRequests responds with 429 and Retry-After rounded up to seconds.
+func tooManyRequests(w http.ResponseWriter, reason string, retryAfter time.Duration) {
+	rateLimited.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// Limit is a middleware which applies the limits of a client to range requests and streams. Streams are
+// limited by the number of open streams only. The bytes per hour quota applies to both, the stream duration
+// quota to streams. /metrics, /health and /ready are not limited.
+func (l *Limiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics", "/health", "/ready":
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		l.mu.Lock()
+		verifier := l.verifier
+		l.mu.Unlock()
+
+		// the key is kept in the context, so the token is verified once per request.
+		key := clientKey(r, verifier)
+		r = r.WithContext(withKeyContext(r.Context(), clientKeyKey, key))
+		rate, maxStreams := l.limits()
+		if isStream(r) {
+			if maxStreams > 0 {
+				if !l.acquireStream(key) {
+					tooManyRequests(w, limitedByStreams, streamRetryAfter)
+					return
+				}
+				defer l.releaseStream(key)
+			}
+			l.serveWithQuotas(next, w, r, key, true)
+			return
+		}
+
+		if rate > 0 {
+			if ok, retryAfter := l.allow(key); !ok {
+				tooManyRequests(w, limitedByRate, retryAfter)
+				return
+			}
+		}
+		l.serveWithQuotas(next, w, r, key, false)
+	})
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestLimiterRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLimiter(1, 2, 0)
+	l.now = func() time.Time { return now }
+
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v2/component", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("expect burst request %d to pass. Got %d", i, w.Code)
+		}
+	}
+
+	w := get("10.0.0.1:1235")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect status 429. Got %d", w.Code)
+	}
+
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Fatalf("expect Retry-After 1. Got %s", retryAfter)
+	}
+
+	if w := get("10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expect a different client not to be limited. Got %d", w.Code)
+	}
+
+	now = now.Add(time.Second)
+	if w := get("10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expect a refilled token. Got %d", w.Code)
+	}
+}
+
+func TestLimiterStreams(t *testing.T) {
+	l := NewLimiter(0, 0, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	stream := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v2/component", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		stream()
+		close(done)
+	}()
+	<-started
+
+	w := stream()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect the second stream to be rejected. Got %d", w.Code)
+	}
+
+	close(release)
+	<-done
+
+	go func() { <-started }()
+	if w := stream(); w.Code != http.StatusOK {
+		t.Fatalf("expect a stream after the first one is closed. Got %d", w.Code)
+	}
+}
+
+func TestLimiterVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key1", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	}))
+	defer jwks.Close()
+
+	l := NewLimiter(0.001, 1, 0)
+	l.SetVerifier(NewJWKSVerifier(http.DefaultClient, jwks.URL))
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(token string) int {
+		req := httptest.NewRequest("GET", "/v2/component", nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	claims := map[string]interface{}{"uid": "alice", "exp": jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	forged := signToken(t, other, "key1", claims)
+	if code := get(forged); code != http.StatusOK {
+		t.Fatalf("expect the burst request to pass. Got %d", code)
+	}
+
+	if code := get(forged); code != http.StatusTooManyRequests {
+		t.Fatalf("expect a forged token to be counted by the remote address. Got %d", code)
+	}
+
+	valid := signToken(t, key, "key1", claims)
+	if code := get(valid); code != http.StatusOK {
+		t.Fatalf("expect the bucket of the uid not to be taken by a forged token. Got %d", code)
+	}
+
+	if code := get(valid); code != http.StatusTooManyRequests {
+		t.Fatalf("expect a valid token to be counted by the uid. Got %d", code)
+	}
+}
+
+func TestLimiterSetLimits(t *testing.T) {
+	l := NewLimiter(0, 0, 0)
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/v2/component", nil))
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := get(); code != http.StatusOK {
+			t.Fatalf("expect no limit. Got %d", code)
+		}
+	}
+
+	l.SetLimits(0.001, 1, 0)
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("expect the burst request to pass. Got %d", code)
+	}
+
+	if code := get(); code != http.StatusTooManyRequests {
+		t.Fatalf("expect the new rate to be applied. Got %d", code)
+	}
+}
+
+func TestLimiterQuotas(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLimiter(0, 0, 0)
+	l.SetQuotas(50*time.Millisecond, 10)
+	l.now = func() time.Time { return now }
+
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.URL.Query().Get("follow") != "true" {
+			w.Write([]byte("0123456789"))
+			if _, err := w.Write([]byte("more")); err != errQuotaExceeded {
+				t.Errorf("expect errQuotaExceeded. Got %v", err)
+			}
+			return
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+
+	get := func(target, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/v2/component", "10.0.0.1:1234")
+	if body := w.Body.String(); body != "0123456789event: quota\ndata: {\"quota\":\"bytes\"}\n\n" {
+		t.Fatalf("expect the response closed by the bytes quota. Got %q", body)
+	}
+
+	w = get("/v2/component", "10.0.0.1:1235")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("expect status 429 until the end of the hour. Got %d, %s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// the stream of another client is closed by the duration quota.
+	w = get("/v2/component?follow=true", "10.0.0.2:1234")
+	if body := w.Body.String(); body != "event: quota\ndata: {\"quota\":\"duration\"}\n\n" {
+		t.Fatalf("expect the stream closed by the duration quota. Got %q", body)
+	}
+
+	now = now.Add(time.Hour)
+	if w := get("/v2/component", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expect the bytes quota of a new hour. Got %d", w.Code)
+	}
+}
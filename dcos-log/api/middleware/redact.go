@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/dcos/dcos-log/dcos-log/redact"
+)
+
+// RedactionRole returns the role of the request user in the redaction policy, nil if no fields are hidden
+// from the user.
+func RedactionRole(r *http.Request) *redact.Role {
+	role := redact.Default().Role(RequestUID(r))
+	if role == nil || len(role.Hide) == 0 {
+		return nil
+	}
+	return role
+}
+
+// Redaction returns the func applied to the fields of the entries sent to the request user: the masks of the
+// redaction policy replace the sensitive values, then the fields hidden from the role of the user are removed.
+// nil is returned if the policy has neither.
+func Redaction(r *http.Request) func(map[string]string) {
+	policy, role := redact.Default(), RedactionRole(r)
+	switch {
+	case !policy.Masking() && role == nil:
+		return nil
+	case role == nil:
+		return policy.Mask
+	case !policy.Masking():
+		return role.Redact
+	}
+
+	return func(fields map[string]string) {
+		policy.Mask(fields)
+		role.Redact(fields)
+	}
+}
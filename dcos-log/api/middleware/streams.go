@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stream is an open server sent events or WebSocket stream.
+type Stream struct {
+	ID     uint64    `json:"id"`
+	Client string    `json:"client"`
+	Remote string    `json:"remote"`
+	Route  string    `json:"route"`
+	Path   string    `json:"path"`
+	Start  time.Time `json:"start"`
+
+	// Duration is the number of seconds the stream is open.
+	Duration float64 `json:"duration"`
+}
+
+type openStream struct {
+	Stream
+	cancel context.CancelFunc
+}
+
+// streamRegistry keeps the open streams, so an operator can list and terminate them.
+type streamRegistry struct {
+	mu      sync.Mutex
+	next    uint64
+	streams map[uint64]*openStream
+}
+
+// openStreams are the streams observed by Instrument.
+var openStreams = &streamRegistry{streams: make(map[uint64]*openStream)}
+
+// add registers the stream of a request, cancel ends it. It returns the ID of the stream.
+func (s *streamRegistry) add(r *http.Request, route string, cancel context.CancelFunc) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	s.streams[s.next] = &openStream{
+		Stream: Stream{
+			ID:     s.next,
+			Client: clientKey(r, nil),
+			Remote: r.RemoteAddr,
+			Route:  route,
+			Path:   r.URL.Path,
+			Start:  time.Now(),
+		},
+		cancel: cancel,
+	}
+	return s.next
+}
+
+func (s *streamRegistry) remove(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// Streams returns the open streams, the oldest first.
+func Streams() []Stream {
+	openStreams.mu.Lock()
+	defer openStreams.mu.Unlock()
+
+	now := time.Now()
+	streams := make([]Stream, 0, len(openStreams.streams))
+	for _, s := range openStreams.streams {
+		stream := s.Stream
+		stream.Duration = now.Sub(s.Start).Seconds()
+		streams = append(streams, stream)
+	}
+
+	sort.Slice(streams, func(i, j int) bool { return streams[i].ID < streams[j].ID })
+	return streams
+}
+
+// TerminateStream cancels the request context of the stream with the ID, the handler closes the stream like a
+// stream ended by the server. False is returned if there is no such stream.
+func TerminateStream(id uint64) bool {
+	openStreams.mu.Lock()
+	defer openStreams.mu.Unlock()
+
+	s, ok := openStreams.streams[id]
+	if ok {
+		s.cancel()
+	}
+	return ok
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/sirupsen/logrus"
+)
+
+// loadPolicies validates the SIEM field mapping and sets the redaction and task authorization policies of the
+// config. The policies are replaced only if both are loaded.
+func loadPolicies(cfg *config.Config) error {
+	if _, err := jr.ParseFieldMapping(cfg.FlagSIEMFieldMapping); err != nil {
+		return err
+	}
+
+	var redactionPolicy *redact.Policy
+	if cfg.FlagRedactionPolicy != "" {
+		policy, err := redact.Load(cfg.FlagRedactionPolicy)
+		if err != nil {
+			return fmt.Errorf("Unable to load redaction policy: %s", err)
+		}
+		redactionPolicy = policy
+	}
+
+	var taskPolicy authz.Policy
+	if cfg.FlagTaskPolicy != "" {
+		policy, err := authz.LoadFrameworkPolicy(cfg.FlagTaskPolicy)
+		if err != nil {
+			return fmt.Errorf("Unable to load task authorization policy: %s", err)
+		}
+		taskPolicy = policy
+	}
+
+	redact.SetDefault(redactionPolicy)
+	authz.SetDefault(taskPolicy)
+	return nil
+}
+
+// reload loads the config again and applies the reloadable options. It returns the effective config, the
+// current one if the new config is invalid.
+func reload(current *config.Config, limiter *middleware.Limiter) (*config.Config, error) {
+	reloaded, err := current.Reload()
+	if err != nil {
+		return current, err
+	}
+
+	cfg, restart, err := current.Merge(reloaded)
+	if err != nil {
+		return current, err
+	}
+
+	if err := loadPolicies(cfg); err != nil {
+		return current, err
+	}
+
+	if len(restart) > 0 {
+		logrus.Warnf("Options %v changed, they are applied on restart", restart)
+	}
+
+	level := logrus.InfoLevel
+	if cfg.FlagVerbose {
+		level = logrus.DebugLevel
+	}
+	logrus.SetLevel(level)
+
+	setLimits(limiter, cfg)
+	middleware.SetConfig(cfg)
+	return cfg, nil
+}
+
+// setLimits applies the rate limits and the quotas of the config to the limiter.
+func setLimits(limiter *middleware.Limiter, cfg *config.Config) {
+	maxStreamDuration, _ := time.ParseDuration(cfg.FlagMaxStreamDuration)
+	limiter.SetLimits(float64(cfg.FlagRateLimit), cfg.FlagRateLimitBurst, cfg.FlagMaxStreams)
+	limiter.SetQuotas(maxStreamDuration, int64(cfg.FlagMaxBytesPerHour))
+}
+
+// watchReload reloads the config on SIGHUP. The open streams keep the config they started with.
+func watchReload(cfg *config.Config, limiter *middleware.Limiter) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		var err error
+		if cfg, err = reload(cfg, limiter); err != nil {
+			logrus.Errorf("Unable to reload config, keeping the current config: %s", err)
+			continue
+		}
+		logrus.Info("Config reloaded")
+	}
+}
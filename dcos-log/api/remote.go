@@ -0,0 +1,26 @@
+package api
+
+import (
+	"context"
+
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// startJournalRemote starts receiving systemd-journal-upload entries and writing them to journald in background.
+func startJournalRemote(ctx context.Context, cfg *config.Config) error {
+	s, err := remote.NewServer(cfg.FlagJournalRemote, remote.OptionTLS(cfg.FlagJournalRemoteCertFile,
+		cfg.FlagJournalRemoteKeyFile, cfg.FlagJournalRemoteClientCAFile))
+	if err != nil {
+		return err
+	}
+
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	logrus.Infof("Receiving journal uploads on %s", s.Addr())
+	go s.Serve(ctx)
+	return nil
+}
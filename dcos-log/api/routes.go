@@ -4,9 +4,13 @@ import (
 	"net/http"
 
 	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/admin"
+	"github.com/dcos/dcos-log/dcos-log/api/gateway"
 	"github.com/dcos/dcos-log/dcos-log/api/v1"
 	"github.com/dcos/dcos-log/dcos-log/api/v2"
 	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/health"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
 	"github.com/gorilla/mux"
 )
 
@@ -20,5 +24,26 @@ func newAPIRouter(cfg *config.Config, client *http.Client, nodeInfo nodeutil.Nod
 	v2Subrouter := r.PathPrefix("/v2").Subrouter()
 	v2.InitRoutes(v2Subrouter, cfg, client, nodeInfo)
 
+	// the gRPC Logs service, the calls are served by the v2 handlers.
+	if cfg.FlagGRPC {
+		v2.InitGRPCRoutes(r, cfg, client, nodeInfo)
+	}
+
+	// systemd-journal-gatewayd compatible endpoints
+	gatewaySubrouter := r.PathPrefix("/gateway").Subrouter()
+	gateway.InitRoutes(gatewaySubrouter, cfg, client, nodeInfo)
+
+	// runtime management and profiling of dcos-log by the users of -admin-uids.
+	if cfg.FlagAdminUIDs != "" {
+		admin.InitRoutes(r, cfg, client)
+	}
+
+	// expose service metrics in prometheus format.
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// liveness of the local dependencies and readiness of all dependencies for load balancers.
+	r.Handle("/health", health.Handler(healthCheckTimeout, healthChecks(cfg)...)).Methods("GET")
+	r.Handle("/ready", health.Handler(healthCheckTimeout, readinessChecks(cfg, client, nodeInfo)...)).Methods("GET")
+
 	return r, nil
 }
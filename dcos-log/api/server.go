@@ -1,19 +1,31 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/sirupsen/logrus"
-	"github.com/coreos/go-systemd/activation"
 	"github.com/dcos/dcos-go/dcos"
 	"github.com/dcos/dcos-go/dcos/http/transport"
 	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/api/v2"
+	"github.com/dcos/dcos-log/dcos-log/audit"
 	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/diagnostics"
+	"github.com/dcos/dcos-log/dcos-log/health"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/selflog"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+	"github.com/sirupsen/logrus"
 )
 
 // override the defaultStateURL to use https scheme
@@ -38,8 +50,36 @@ func newNodeInfo(cfg *config.Config, client *http.Client) (nodeutil.NodeInfo, er
 	return nodeInfo, nil
 }
 
+// Option is a functional option that configures StartServer for programs embedding dcos-log.
+type Option func(*serverOptions) error
+
+type serverOptions struct {
+	decorators []middleware.RequestDecorator
+}
+
+// OptionRequestDecorator adds a decorator applied to every request sent to Mesos masters and agents.
+// Decorators are applied in the order they were added.
+func OptionRequestDecorator(d middleware.RequestDecorator) Option {
+	return func(o *serverOptions) error {
+		if d == nil {
+			return errors.New("request decorator cannot be nil")
+		}
+		o.decorators = append(o.decorators, d)
+		return nil
+	}
+}
+
 // StartServer is an entry point to dcos-log service.
-func StartServer(cfg *config.Config) error {
+func StartServer(cfg *config.Config, opts ...Option) error {
+	options := &serverOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(options); err != nil {
+				return err
+			}
+		}
+	}
+
 	transportOptions := []transport.OptionTransportFunc{}
 	if cfg.FlagCACertFile != "" {
 		transportOptions = append(transportOptions, transport.OptionCaCertificatePath(cfg.FlagCACertFile))
@@ -50,6 +90,31 @@ func StartServer(cfg *config.Config) error {
 		return err
 	}
 
+	var tlsOptions []reader.TLSOption
+	if cfg.FlagClientCertFile != "" {
+		tlsOptions = append(tlsOptions, reader.TLSClientCertificate(cfg.FlagClientCertFile, cfg.FlagClientKeyFile))
+	}
+
+	if cfg.FlagTLSServerName != "" {
+		tlsOptions = append(tlsOptions, reader.TLSServerName(cfg.FlagTLSServerName))
+	}
+
+	if len(tlsOptions) > 0 {
+		httpTransport, ok := tr.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("unable to configure TLS of transport %T", tr)
+		}
+
+		if err := reader.ConfigureTransport(httpTransport, tlsOptions...); err != nil {
+			return err
+		}
+	}
+
+	// the task log reads of the same agent share the keep-alive connections.
+	if httpTransport, ok := tr.(*http.Transport); ok {
+		reader.TuneTransport(httpTransport, cfg.FlagFilesAPIMaxIdleConns)
+	}
+
 	// update get request timeout.
 	timeout, err := time.ParseDuration(cfg.FlagGetRequestTimeout)
 	if err != nil {
@@ -58,7 +123,34 @@ func StartServer(cfg *config.Config) error {
 
 	client := &http.Client{
 		Timeout:   timeout,
-		Transport: tr,
+		Transport: middleware.DecorateTransport(tr, options.decorators...),
+	}
+
+	drainTimeout, err := time.ParseDuration(cfg.FlagDrainTimeout)
+	if err != nil {
+		return err
+	}
+
+	// the background context is canceled on shutdown, the forwarders and exporters send their last batch.
+	ctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	if cfg.FlagTraceOTLPURL != "" {
+		exporter := tracing.NewOTLPExporter(&http.Client{Timeout: 10 * time.Second}, cfg.FlagTraceOTLPURL, "dcos-log")
+		tracing.SetExporter(exporter, cfg.FlagTraceSampleRatio)
+		goBackground(func() { exporter.Run(ctx) })
+	}
+
+	if err := loadPolicies(cfg); err != nil {
+		return err
+	}
+
+	if cfg.FlagFilesAPIServiceAccount {
+		tokens, err := reader.NewServiceAccountTokens(tr, cfg.FlagIAMConfig, reader.DefaultTokenExpire)
+		if err != nil {
+			return fmt.Errorf("Unable to log in with the service account of %s: %s", cfg.FlagIAMConfig, err)
+		}
+		v2.SetServiceAccount(tokens)
 	}
 
 	// pass a copy of client because newNodeInfo may modify Transport.
@@ -72,17 +164,134 @@ func StartServer(cfg *config.Config) error {
 		return err
 	}
 
-	listeners, err := activation.Listeners(true)
+	// the limiter is always installed, the limits may be enabled by a reload.
+	limiter := middleware.NewLimiter(float64(cfg.FlagRateLimit), cfg.FlagRateLimitBurst, cfg.FlagMaxStreams)
+	setLimits(limiter, cfg)
+	if cfg.FlagJWTVerify {
+		limiter.SetVerifier(middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL))
+	}
+	drainer := middleware.NewDrainer()
+	handler := drainer.Handler(limiter.Limit(middleware.Instrument(router)))
+
+	if cfg.FlagAccessLog {
+		accessLogger := logrus.New()
+		accessLogger.Out = os.Stdout
+		accessLogger.Formatter = &logrus.JSONFormatter{}
+		handler = middleware.AccessLog(handler, router, accessLogger)
+	}
+
+	if cfg.FlagAuditLog != "" {
+		auditLogger, err := audit.New(cfg.FlagAuditLog, cfg.FlagAuditIdentifier)
+		if err != nil {
+			return fmt.Errorf("Unable to open audit log %s: %s", cfg.FlagAuditLog, err)
+		}
+		handler = middleware.Audit(handler, router, auditLogger)
+	}
+	handler = middleware.Gzip(handler)
+
+	// systemd restarts the service if the journal cannot be read, when WatchdogSec= is set.
+	go health.Watchdog(ctx, healthChecks(cfg)...)
+
+	go watchReload(cfg, limiter)
+
+	// keep the recent dcos-log entries available via /v2/self/logs.
+	logrus.AddHook(selflog.Default)
+	diagnostics.Register("self_log", func() interface{} { return selflog.Default.Stats() })
+	diagnostics.Register("active_streams", func() interface{} { return middleware.ActiveStreams() })
+
+	if cfg.FlagArchive {
+		if err := startArchiver(ctx, cfg, nodeInfo, options.decorators...); err != nil {
+			return fmt.Errorf("Unable to start archiver: %s", err)
+		}
+	}
+
+	if cfg.FlagSyslogUDP != "" || cfg.FlagSyslogTCP != "" {
+		if err := startSyslog(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start syslog listener: %s", err)
+		}
+	}
+
+	if cfg.FlagJournalRemote != "" {
+		if err := startJournalRemote(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start journal remote listener: %s", err)
+		}
+	}
+
+	if cfg.FlagLokiURL != "" {
+		if err := startLoki(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start Loki forwarder: %s", err)
+		}
+	}
+
+	if cfg.FlagSplunkURL != "" {
+		if err := startSplunk(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start Splunk forwarder: %s", err)
+		}
+	}
+
+	if cfg.FlagKafkaBrokers != "" {
+		if err := startKafka(ctx, cfg, nodeInfo, options.decorators...); err != nil {
+			return fmt.Errorf("Unable to start Kafka forwarder: %s", err)
+		}
+	}
+
+	if cfg.FlagFluentdAddr != "" {
+		if err := startFluentd(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start fluentd forwarder: %s", err)
+		}
+	}
+
+	if cfg.FlagElasticURL != "" {
+		if err := startElastic(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start Elasticsearch forwarder: %s", err)
+		}
+	}
+
+	if cfg.FlagOTLPURL != "" {
+		if err := startOTLP(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start OTLP exporter: %s", err)
+		}
+	}
+
+	if cfg.FlagSyslogForwardAddr != "" {
+		if err := startSyslogForwarder(ctx, cfg); err != nil {
+			return fmt.Errorf("Unable to start syslog forwarder: %s", err)
+		}
+	}
+
+	listeners, err := listen(cfg)
 	if err != nil {
-		return fmt.Errorf("Unable to get listeners: %s", err)
+		return err
+	}
+
+	srv := &http.Server{Handler: handler}
+
+	// the gRPC clients connect with HTTP/2 without TLS, the listeners are not encrypted.
+	if cfg.FlagGRPC {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
 	}
+	srv.RegisterOnShutdown(drainer.Drain)
+
+	// stop on SIGTERM and SIGINT before the server starts, so a signal is not missed.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
 
-	// Listen on unix socket
-	if len(listeners) == 1 {
-		logrus.Infof("Listen on %s", listeners[0].Addr().String())
-		return http.Serve(listeners[0], router)
+	// the listeners are closed by the shutdown of the server.
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logrus.Infof("Starting web server on %s %s", l.Addr().Network(), l.Addr())
+		go func(l net.Listener) {
+			errs <- srv.Serve(l)
+		}(l)
 	}
 
-	logrus.Infof("Starting web server on %d", cfg.FlagPort)
-	return http.ListenAndServe(fmt.Sprintf(":%d", cfg.FlagPort), router)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		logrus.Infof("Received %s, shutting down", sig)
+	}
+	return shutdown(srv, stopBackground, drainTimeout)
 }
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// background tracks the forwarders and exporters, which send their last batch on shutdown.
+var background sync.WaitGroup
+
+// goBackground runs f in a goroutine tracked by background.
+func goBackground(f func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		f()
+	}()
+}
+
+// shutdown stops accepting new requests, closes the open streams and waits for the running requests, then it
+// stops the background work and waits for the last batches to be sent. It returns when everything is done or the
+// timeout has passed, the connections left are closed.
+func shutdown(srv *http.Server, stopBackground context.CancelFunc, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	stopBackground()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logrus.Warnf("Background work did not stop within %s", timeout)
+	}
+
+	if err != nil {
+		srv.Close()
+		return fmt.Errorf("Unable to drain connections within %s: %s", timeout, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"context"
+
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/syslog"
+	"github.com/sirupsen/logrus"
+)
+
+// startSyslog starts receiving syslog messages and writing them to journald in background.
+func startSyslog(ctx context.Context, cfg *config.Config) error {
+	s, err := syslog.NewServer(syslog.OptionUDP(cfg.FlagSyslogUDP), syslog.OptionTCP(cfg.FlagSyslogTCP))
+	if err != nil {
+		return err
+	}
+
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	udp, tcp := s.Addrs()
+	logrus.Infof("Receiving syslog messages, udp: %v, tcp: %v", udp, tcp)
+	go s.Serve(ctx)
+	return nil
+}
@@ -11,9 +11,11 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
 	"github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/query"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 // AllowedFields contain `Journald Container Logger module` fields except ExecutorInfo.
@@ -28,6 +30,7 @@ const (
 	getParamFilter      getParam = "filter"
 	getParamCursor      getParam = "cursor"
 	getParamReadReverse getParam = "read_reverse"
+	getParamLevel       getParam = "level"
 )
 
 type getParam string
@@ -120,6 +123,26 @@ func getMatches(req *http.Request) ([]reader.JournalEntryMatch, error) {
 	return matches, nil
 }
 
+// getLevelMatches parses the GET parameter `level`, a syslog priority name or number, and returns the PRIORITY
+// matches of the priority and the more severe priorities. The matches of the same field are joined with OR.
+func getLevelMatches(req *http.Request) ([]reader.JournalEntryMatch, error) {
+	level := req.URL.Query().Get(getParamLevel.String())
+	if level == "" {
+		return nil, nil
+	}
+
+	p, err := query.ParsePriority(level)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing parameter %s: %s", getParamLevel, err)
+	}
+
+	var matches []reader.JournalEntryMatch
+	for _, value := range (&query.Query{MaxPriority: p}).Priorities() {
+		matches = append(matches, reader.JournalEntryMatch{Field: "PRIORITY", Value: value})
+	}
+	return matches, nil
+}
+
 func getReadReverse(req *http.Request, stream bool) (bool, error) {
 	readReverse := req.URL.Query().Get(getParamReadReverse.String())
 	if readReverse == "" {
@@ -169,6 +192,12 @@ func readJournalHandler(w http.ResponseWriter, req *http.Request) {
 	// for streaming endpoints and SSE logs format we include id: CursorID before each log entry.
 	entryFormatter := reader.NewEntryFormatter(req.Header.Get("Accept"), stream)
 
+	// mask the values and hide the fields of the redaction policy.
+	role := middleware.RedactionRole(req)
+	if redaction := middleware.Redaction(req); redaction != nil {
+		entryFormatter = reader.FormatTransform{EntryFormatter: entryFormatter, Fields: redaction}
+	}
+
 	// get a list of matches from request path
 	matches := pathMatches(req)
 
@@ -179,11 +208,27 @@ func readJournalHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// a hidden field cannot be used to probe the values.
+	for _, m := range requestMatches {
+		if role.Hidden(m.Field) {
+			httpError(w, fmt.Sprintf("field %s is not visible", m.Field), http.StatusForbidden, req)
+			return
+		}
+	}
+
 	// Append matches from get params.
 	if len(requestMatches) > 0 {
 		matches = append(matches, requestMatches...)
 	}
 
+	// Read `level` parameter.
+	levelMatches, err := getLevelMatches(req)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest, req)
+		return
+	}
+	matches = append(matches, levelMatches...)
+
 	// Read `cursor` parameter.
 	cursor, err := getCursor(req)
 	if err != nil {
@@ -235,8 +280,10 @@ func readJournalHandler(w http.ResponseWriter, req *http.Request) {
 		reader.OptionLimit(limit),
 		reader.OptionSkipNext(skipNext),
 		reader.OptionSkipPrev(skipPrev),
-		reader.OptionReadReverse(readReverse))
+		reader.OptionReadReverse(readReverse),
+		reader.OptionContext(req.Context()))
 	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
 		httpError(w, fmt.Sprintf("Error opening journal reader: %s", err), http.StatusInternalServerError, req)
 		return
 	}
@@ -268,6 +315,7 @@ func readJournalHandler(w http.ResponseWriter, req *http.Request) {
 	if !stream {
 		b, err := io.Copy(w, j)
 		if err != nil {
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
 			httpError(w, err.Error(), http.StatusInternalServerError, req)
 			return
 		}
@@ -279,19 +327,23 @@ func readJournalHandler(w http.ResponseWriter, req *http.Request) {
 
 	w.Header().Set("X-Accel-Buffering", "no")
 	f := w.(http.Flusher)
-	notify := w.(http.CloseNotifier).CloseNotify()
 
 	f.Flush()
 	for {
 		select {
-		case <-notify:
+		case <-req.Context().Done():
 			{
 				logrus.Debugf("Closing a client connection.Request URI: %s", req.RequestURI)
 				return
 			}
 		case <-time.After(time.Second):
-			err := j.Follow(time.Millisecond * 100, w)
+			err := j.Follow(time.Millisecond*100, w)
 			if err != nil {
+				if req.Context().Err() != nil {
+					logrus.Debugf("client went away. Request URI: %s", req.RequestURI)
+					return
+				}
+				middleware.UpstreamError(req, middleware.UpstreamJournald)
 				logrus.Errorf("error reading journal %s", err)
 				return
 			}
@@ -317,8 +369,14 @@ func fieldHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if middleware.RedactionRole(req).Hidden(field) {
+		httpError(w, fmt.Sprintf("field %s is not visible", field), http.StatusForbidden, req)
+		return
+	}
+
 	j, err := reader.NewReader(nil)
 	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
 		httpError(w, err.Error(), http.StatusBadRequest, req)
 		return
 	}
@@ -326,6 +384,7 @@ func fieldHandler(w http.ResponseWriter, req *http.Request) {
 
 	values, err := j.Journal.GetUniqueValues(field)
 	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
 		httpError(w, err.Error(), http.StatusBadRequest, req)
 		return
 	}
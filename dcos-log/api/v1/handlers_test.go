@@ -2,6 +2,7 @@ package v1
 
 import (
 	"net/http"
+	"strconv"
 	"testing"
 )
 
@@ -146,3 +147,37 @@ func TestGetMatches(t *testing.T) {
 		t.Fatalf("Expecting FOO=bar match. Got %+v", matches[1])
 	}
 }
+
+func TestGetLevelMatches(t *testing.T) {
+	r, err := http.NewRequest("GET", "?level=err", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := getLevelMatches(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 4 {
+		t.Fatalf("Must have 4 matches got %d", len(matches))
+	}
+
+	for i, m := range matches {
+		if m.Field != "PRIORITY" || m.Value != strconv.Itoa(i) {
+			t.Fatalf("Expecting PRIORITY=%d match. Got %+v", i, m)
+		}
+	}
+
+	for _, level := range []string{"debug", "7"} {
+		r, _ = http.NewRequest("GET", "?level="+level, nil)
+		if matches, err = getLevelMatches(r); err != nil || len(matches) != 0 {
+			t.Fatalf("Expecting no matches for %s. Got %+v, %v", level, matches, err)
+		}
+	}
+
+	r, _ = http.NewRequest("GET", "?level=loud", nil)
+	if _, err = getLevelMatches(r); err == nil {
+		t.Fatal("Expecting an error for an invalid level")
+	}
+}
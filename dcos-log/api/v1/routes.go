@@ -19,7 +19,7 @@ func requestStreamKeyFromContext(ctx context.Context) bool {
 	return ctxValue != nil
 }
 
-// InitRoutes inits the v1 logging routes
+// InitRoutes inits the v1 logging routes. Every route requires a valid JWT if the verification is enabled.
 func InitRoutes(v1 *mux.Router, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) {
 	newAuthMiddleware := func(h http.Handler) http.Handler {
 		return h
@@ -27,7 +27,18 @@ func InitRoutes(v1 *mux.Router, cfg *config.Config, client *http.Client, nodeInf
 
 	if cfg.FlagAuth {
 		newAuthMiddleware = func(h http.Handler) http.Handler {
-			return middleware.Auth(h, client, nodeInfo, cfg.FlagRole)
+			return middleware.Auth(h, client, nodeInfo, cfg.FlagRole, cfg.FlagMesosWorkDir)
+		}
+	}
+
+	verify := func(h http.Handler) http.Handler {
+		return h
+	}
+
+	if cfg.FlagJWTVerify {
+		verifier := middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL)
+		verify = func(h http.Handler) http.Handler {
+			return middleware.VerifyToken(h, verifier)
 		}
 	}
 
@@ -40,17 +51,17 @@ func InitRoutes(v1 *mux.Router, cfg *config.Config, client *http.Client, nodeInf
 
 	handler := http.HandlerFunc(readJournalHandler)
 
-	v1.Path("/range/").Handler(handler).Methods("GET")
+	v1.Path("/range/").Handler(verify(handler)).Methods("GET")
 	v1.Path("/range/framework/{framework_id}/executor/{executor_id}/container/{container_id}").
-		Handler(newAuthMiddleware(handler)).Methods("GET")
+		Handler(verify(newAuthMiddleware(handler))).Methods("GET")
 
-	v1.Path("/range/download").Handler(middleware.DownloadGzippedContent(handler, "root-range")).Methods("GET")
+	v1.Path("/range/download").Handler(verify(middleware.DownloadGzippedContent(handler, "root-range"))).Methods("GET")
 	v1.Path("/range/framework/{framework_id}/executor/{executor_id}/container/{container_id}/download").
-		Handler(newAuthMiddleware(middleware.DownloadGzippedContent(handler, "task", "container_id"))).Methods("GET")
+		Handler(verify(newAuthMiddleware(middleware.DownloadGzippedContent(handler, "task", "container_id")))).Methods("GET")
 
-	v1.Path("/stream/").Handler(streamMiddleware(handler)).Methods("GET")
+	v1.Path("/stream/").Handler(verify(streamMiddleware(handler))).Methods("GET")
 	v1.Path("/stream/framework/{framework_id}/executor/{executor_id}/container/{container_id}").
-		Handler(newAuthMiddleware(streamMiddleware(handler))).Methods("GET")
+		Handler(verify(newAuthMiddleware(streamMiddleware(handler)))).Methods("GET")
 
-	v1.Path("/fields/{field}").HandlerFunc(fieldHandler)
+	v1.Path("/fields/{field}").Handler(verify(http.HandlerFunc(fieldHandler)))
 }
@@ -0,0 +1,204 @@
+package v2
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/archive"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// sourceHeader indicates where the served logs were taken from.
+const sourceHeader = "X-DCOS-Log-Source"
+
+// sandboxFromRequest builds an archive.Sandbox from the request mux variables and the current mesos ID.
+func sandboxFromRequest(req *http.Request) (archive.Sandbox, error) {
+	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+	if !ok {
+		return archive.Sandbox{}, fmt.Errorf("invalid context, unable to retrieve a %T object", nodeInfo)
+	}
+
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		return archive.Sandbox{}, fmt.Errorf("unable to get authorization header from a request")
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mesosID, err := nodeInfo.MesosID(nodeutil.NewContextWithHeaders(ctx, header))
+	if err != nil {
+		return archive.Sandbox{}, fmt.Errorf("unable to get mesosID: %s", err)
+	}
+
+	vars := mux.Vars(req)
+	return archive.Sandbox{
+		AgentID:     mesosID,
+		FrameworkID: vars["frameworkID"],
+		ExecutorID:  vars["executorID"],
+		ContainerID: vars["containerID"],
+		TaskPath:    vars["taskPath"],
+	}, nil
+}
+
+// authorizeArchivedTask checks the task policy allows the user to read the archived files of a sandbox. The task is
+// taken from the metadata archived with the files, the agent may no longer list the executor.
+func authorizeArchivedTask(req *http.Request, metadata *archive.Metadata, taskPath string) error {
+	task := authz.Task{
+		FrameworkID: metadata.Sandbox.FrameworkID,
+		ExecutorID:  metadata.Sandbox.ExecutorID,
+		ContainerID: metadata.Sandbox.ContainerID,
+		TaskPath:    taskPath,
+	}
+
+	if uid := middleware.RequestUID(req); !authz.Default().Allowed(uid, task) {
+		return fmt.Errorf("user %q is not allowed to read the logs of framework %s", uid, task.FrameworkID)
+	}
+	return nil
+}
+
+// serveArchivedFile tries to serve a file from the archive if it's configured. If raw is false, the file
+// is served line by line with skip and limit parameters applied. The function returns false if the
+// archive is not configured or the file was not archived, in this case nothing is written to a client.
+// The sandbox is gone so the agent cannot authorize the read, the task policy must allow the user to read the task
+// of the request and the task described by the metadata archived with the files.
+func serveArchivedFile(w http.ResponseWriter, req *http.Request, raw bool) bool {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok || cfg.FlagArchiveURL == "" {
+		return false
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		return false
+	}
+
+	if err := authorizeTask(req); err != nil {
+		logError(w, req, err.Error(), http.StatusForbidden)
+		return true
+	}
+
+	sandbox, err := sandboxFromRequest(req)
+	if err != nil {
+		logrus.Errorf("unable to lookup archived logs: %s", err)
+		return false
+	}
+
+	fetcher, err := archive.NewFetcher(cfg.FlagArchiveURL, middleware.Undecorated(client))
+	if err != nil {
+		logrus.Errorf("unable to initialize archive fetcher: %s", err)
+		return false
+	}
+
+	// the sandboxes archived without metadata are not served, their task cannot be authorized.
+	metadata, err := fetcher.Metadata(req.Context(), sandbox)
+	if err == archive.ErrNotArchived || (err == nil && !metadata.Contains(sandbox)) {
+		return false
+	}
+
+	if err != nil {
+		logError(w, req, "unable to fetch the archived sandbox metadata: "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	if err := authorizeArchivedTask(req, metadata, sandbox.TaskPath); err != nil {
+		logError(w, req, err.Error(), http.StatusForbidden)
+		return true
+	}
+
+	file := mux.Vars(req)["file"]
+	rc, err := fetcher.Fetch(req.Context(), sandbox, file)
+	if err == archive.ErrNotArchived {
+		return false
+	}
+
+	if err != nil {
+		logError(w, req, "unable to fetch archived file: "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	defer rc.Close()
+
+	w.Header().Set(sourceHeader, "archive")
+	if raw {
+		if _, err := io.Copy(w, rc); err != nil {
+			logrus.Errorf("error raised while reading archived file %s: %s", sandbox.Key(file), err)
+		}
+		return true
+	}
+
+	skip, limit, err := archivedLinesParams(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if err := writeArchivedLines(w, rc, skip, limit); err != nil {
+		logrus.Errorf("error raised while reading archived file %s: %s", sandbox.Key(file), err)
+	}
+	return true
+}
+
+func archivedLinesParams(req *http.Request) (skip, limit int, err error) {
+	p, err := parsePagination(req.URL.Query())
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.skip, p.limit, nil
+}
+
+// writeArchivedLines writes lines from r to w. Positive skip skips the lines from the top of the file,
+// negative skip returns the last N lines. Limit 0 means no limit.
+func writeArchivedLines(w io.Writer, r io.Reader, skip, limit int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	var tail []string
+	written := 0
+	for i := 0; scanner.Scan(); i++ {
+		if skip < 0 {
+			tail = append(tail, scanner.Text())
+			if len(tail) > -skip {
+				tail = tail[1:]
+			}
+			continue
+		}
+
+		if i < skip {
+			continue
+		}
+
+		if limit > 0 && written == limit {
+			return nil
+		}
+
+		if _, err := fmt.Fprintln(w, scanner.Text()); err != nil {
+			return err
+		}
+		written++
+	}
+
+	for _, line := range tail {
+		if limit > 0 && written == limit {
+			break
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		written++
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,323 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// policies of a stream queue which is full, set by -stream-backpressure.
+const (
+	backpressureBlock      = "block"
+	backpressureDropOldest = "drop-oldest"
+	backpressureDisconnect = "disconnect"
+)
+
+// defaultStreamQueueSize is the queue size of streams without a config.
+const defaultStreamQueueSize = 1024
+
+// reasons of the gap events.
+const (
+	gapBackpressure = "backpressure"
+	gapRotation     = "rotation"
+)
+
+// gapEvent is the data of a gap event. From and To are the sequence numbers of the dropped events, After is the
+// sequence number of the last event sent before the journal files were rotated, set with ?integrity=true.
+type gapEvent struct {
+	Reason  string `json:"reason"`
+	Dropped int    `json:"dropped,omitempty"`
+	From    uint64 `json:"from,omitempty"`
+	To      uint64 `json:"to,omitempty"`
+	After   uint64 `json:"after,omitempty"`
+}
+
+// checkpointEvent is the data of a checkpoint event, the sequence number and the id of the last queued event.
+type checkpointEvent struct {
+	Seq uint64 `json:"seq"`
+	ID  string `json:"id,omitempty"`
+}
+
+// streamEvent is a queued event, seq is its sequence number with ?integrity=true, 0 for the other events.
+type streamEvent struct {
+	data []byte
+	seq  uint64
+}
+
+// errSlowConsumer is returned by the writes to a full stream queue with the disconnect policy.
+var errSlowConsumer = errors.New("client does not read the stream fast enough")
+
+var slowStreamEvents = metrics.NewCounterVec("dcos_log_slow_stream_events_total",
+	"Server sent events dropped from the queue of slow clients (dropped) and streams of slow clients closed (disconnected).",
+	"action")
+
+// streamQueue is a bounded queue of the events of a server sent events stream, the events are sent to the
+// client by another goroutine. A slow client cannot make the queue grow, when it is full the policy either
+// blocks the writer, drops the oldest event or closes the stream. Dropped events are reported to the client
+// with a gap event before the next sent event.
+//
+// With integrity the data events are numbered by a seq line and a checkpoint event is queued every checkpoint
+// interval, so a client can tell which events it missed.
+type streamQueue struct {
+	w       io.Writer
+	flusher http.Flusher
+	policy  string
+	size    int
+	cancel  context.CancelFunc
+
+	integrity      bool
+	checkpoint     time.Duration
+	lastCheckpoint time.Time
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	events  []streamEvent
+	partial []byte
+	closed  bool
+	err     error
+
+	// seq and id are the sequence number and the id of the last queued data event.
+	seq uint64
+	id  string
+
+	// dropped is the number of events dropped since the last sent event, from and to the sequence numbers of the
+	// dropped data events.
+	dropped  int
+	from, to uint64
+
+	done chan struct{}
+}
+
+// newStreamQueue starts sending the events written to the queue to w. The returned request is canceled if the
+// stream is closed by the disconnect policy or a write to the client fails. The queue must be closed before the
+// handler returns. ?integrity=true numbers the events and sends checkpoints every -stream-checkpoint-interval.
+func newStreamQueue(w http.ResponseWriter, req *http.Request) (*streamQueue, *http.Request) {
+	ctx, cancel := context.WithCancel(req.Context())
+	q := &streamQueue{
+		w:              w,
+		policy:         backpressureBlock,
+		size:           defaultStreamQueueSize,
+		cancel:         cancel,
+		integrity:      boolParam(req, integrityParam, false),
+		lastCheckpoint: time.Now(),
+		done:           make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if f, ok := w.(http.Flusher); ok {
+		q.flusher = f
+	}
+
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		if cfg.FlagStreamBackpressure != "" {
+			q.policy = cfg.FlagStreamBackpressure
+		}
+
+		if cfg.FlagStreamQueueSize > 0 {
+			q.size = cfg.FlagStreamQueueSize
+		}
+
+		// validated on startup.
+		q.checkpoint, _ = time.ParseDuration(cfg.FlagStreamCheckpointInterval)
+	}
+
+	go q.run()
+	return q, req.WithContext(ctx)
+}
+
+// Write queues the complete events of p, an event ends with an empty line.
+func (q *streamQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.partial = append(q.partial, p...)
+	for {
+		i := bytes.Index(q.partial, []byte("\n\n"))
+		if i < 0 {
+			break
+		}
+
+		event := append([]byte(nil), q.partial[:i+2]...)
+		q.partial = q.partial[i+2:]
+		if err := q.enqueue(event); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), q.err
+}
+
+// Flush is a no-op, the events are flushed by the sending goroutine.
+func (q *streamQueue) Flush() {}
+
+// gap queues a gap event, for instance if entries may be lost because the journal files were rotated.
+func (q *streamQueue) gap(reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	g := gapEvent{Reason: reason}
+	if q.integrity {
+		g.After = q.seq
+	}
+	return q.enqueueJSON("gap", g)
+}
+
+// checkpointDue queues a checkpoint event with integrity if the checkpoint interval has passed since the last one.
+func (q *streamQueue) checkpointDue() error {
+	if !q.integrity || q.checkpoint <= 0 || time.Since(q.lastCheckpoint) < q.checkpoint {
+		return nil
+	}
+	q.lastCheckpoint = time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.enqueueJSON("checkpoint", checkpointEvent{Seq: q.seq, ID: q.id})
+}
+
+// enqueueJSON queues an event of a type with v as data, mu must be held.
+func (q *streamQueue) enqueueJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return q.enqueue([]byte("event: " + name + "\ndata: " + string(data) + "\n\n"))
+}
+
+// dataEvent returns true if an event has data and no type, the comments and the control events are not numbered.
+// id is the value of its id line.
+func dataEvent(event []byte) (id string, ok bool) {
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(line, []byte("event:")):
+			return "", false
+		case bytes.HasPrefix(line, []byte("data:")):
+			ok = true
+		case bytes.HasPrefix(line, []byte("id: ")):
+			id = string(line[len("id: "):])
+		}
+	}
+	return id, ok
+}
+
+// enqueue adds an event applying the policy if the queue is full, mu must be held.
+func (q *streamQueue) enqueue(event []byte) error {
+	for len(q.events) >= q.size && q.err == nil && !q.closed {
+		switch q.policy {
+		case backpressureDropOldest:
+			if seq := q.events[0].seq; seq > 0 {
+				if q.from == 0 {
+					q.from = seq
+				}
+				q.to = seq
+			}
+			q.events = q.events[1:]
+			q.dropped++
+			slowStreamEvents.WithLabelValues("dropped").Inc()
+		case backpressureDisconnect:
+			logrus.Warnf("closing a stream, the client did not read %d queued events", len(q.events))
+			slowStreamEvents.WithLabelValues("disconnected").Inc()
+			q.fail(errSlowConsumer)
+		default:
+			q.cond.Wait()
+		}
+	}
+
+	if q.err != nil {
+		return q.err
+	}
+
+	e := streamEvent{data: event}
+	if id, ok := dataEvent(event); ok && q.integrity {
+		q.seq++
+		e.seq, e.data = q.seq, append([]byte("seq: "+strconv.FormatUint(q.seq, 10)+"\n"), event...)
+		if id != "" {
+			q.id = id
+		}
+	}
+
+	q.events = append(q.events, e)
+	q.cond.Broadcast()
+	return nil
+}
+
+// fail stops the queue and cancels the stream, mu must be held.
+func (q *streamQueue) fail(err error) {
+	q.err = err
+	q.cancel()
+	q.cond.Broadcast()
+}
+
+// run sends the queued events until the queue is closed and empty.
+func (q *streamQueue) run() {
+	defer close(q.done)
+
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && !q.closed && q.err == nil {
+			q.cond.Wait()
+		}
+
+		if q.err != nil || len(q.events) == 0 {
+			q.mu.Unlock()
+			return
+		}
+
+		events, g := q.events, gapEvent{Reason: gapBackpressure, Dropped: q.dropped, From: q.from, To: q.to}
+		q.events, q.dropped, q.from, q.to = nil, 0, 0, 0
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		if err := q.send(events, g); err != nil {
+			q.mu.Lock()
+			q.fail(err)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// send writes the gap event of the dropped events, if any, and the events.
+func (q *streamQueue) send(events []streamEvent, g gapEvent) error {
+	if g.Dropped > 0 {
+		data, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(q.w, "event: gap\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		if _, err := q.w.Write(event.data); err != nil {
+			return err
+		}
+	}
+
+	if q.flusher != nil {
+		q.flusher.Flush()
+	}
+	return nil
+}
+
+// close sends the queued events and waits for the sending goroutine to return.
+func (q *streamQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	<-q.done
+	q.cancel()
+}
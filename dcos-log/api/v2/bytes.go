@@ -0,0 +1,87 @@
+package v2
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	offsetParam = "offset"
+	lengthParam = "length"
+)
+
+// defaultByteLength is the number of bytes read by ?offset= without ?length=.
+const defaultByteLength = 1 << 16
+
+// nextOffsetHeader is a header of byte reads of task logs with the offset following the returned bytes, passed as
+// ?offset= it continues with the next bytes.
+const nextOffsetHeader = "X-Task-Log-Next-Offset"
+
+// byteParams returns ?offset= and ?length= of a byte read of a task log, ok is false if there is no offset. Line
+// based parameters cannot be used with them.
+func byteParams(req *http.Request) (offset, length int, ok bool, err error) {
+	query := req.URL.Query()
+	if query.Get(offsetParam) == "" {
+		if query.Get(lengthParam) != "" {
+			return 0, 0, false, fmt.Errorf("%s parameter requires %s", lengthParam, offsetParam)
+		}
+		return 0, 0, false, nil
+	}
+
+	for _, param := range []string{cursorParam, skipParam, limitParam, followParam, skipNextParam, skipPrevParam} {
+		if query.Get(param) != "" {
+			return 0, 0, false, fmt.Errorf("%s parameter cannot be used with %s", param, offsetParam)
+		}
+	}
+
+	if offset, err = intRangeParam(req, offsetParam, 0, 0, math.MaxInt32); err != nil {
+		return 0, 0, false, err
+	}
+
+	if length, err = intRangeParam(req, lengthParam, defaultByteLength, 1, math.MaxInt32); err != nil {
+		return 0, 0, false, err
+	}
+	return offset, length, true, nil
+}
+
+// serveFileBytes responds to ?offset=&length= of the task log routes with at most length bytes of the file at the
+// byte offset, read with a single files API request. The lines are not counted, the next offset header tells the
+// client where to continue, so clients implementing their own tailing poll the end of the file with it.
+func serveFileBytes(w http.ResponseWriter, req *http.Request, offset, length int) {
+	if max := maxRangeBytes(req); max > 0 && length > max {
+		logError(w, req, fmt.Sprintf("length %d exceeds the maximum of %d bytes, read smaller parts", length, max),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
+	r, err := setupFilesAPIReader(req, "/files/read")
+	if err != nil {
+		setupError(w, req, err)
+		return
+	}
+
+	writeFileBytes(w, req, r, offset, length)
+}
+
+// writeFileBytes writes the bytes of the file read by r with the next offset header.
+func writeFileBytes(w http.ResponseWriter, req *http.Request, r *reader.ReadManager, offset, length int) {
+	data, err := r.ReadBytes(offset, length)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to read the file: "+err.Error(), agentErrorCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set(nextOffsetHeader, strconv.Itoa(offset+len(data)))
+	if _, err := w.Write([]byte(data)); err != nil {
+		logrus.Errorf("error writing %d bytes at offset %d: %s", len(data), offset, err)
+	}
+}
@@ -0,0 +1,291 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// combinedSource is a reader of a combined stream and the label of its lines.
+type combinedSource struct {
+	label string
+	r     *reader.ReadManager
+}
+
+// combinedWriter writes the entries of several readers to a single response. ids are the SSE ids of the last
+// events of the sources by label.
+type combinedWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+	ids     url.Values
+}
+
+func (c *combinedWriter) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeLocked(b)
+}
+
+func (c *combinedWriter) writeLocked(b []byte) error {
+	_, err := c.w.Write(b)
+	if c.flusher != nil {
+		c.flusher.Flush()
+	}
+	return err
+}
+
+// writeEvents writes the SSE events of the source with the label. The id of an event, the position in the file of
+// the source, is replaced with the positions of all sources in label=id&label=id form, so a client reconnecting with
+// the id as Last-Event-ID resumes every source where it stopped.
+func (c *combinedWriter) writeEvents(label string, events []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ids == nil {
+		c.ids = url.Values{}
+	}
+
+	out := make([]byte, 0, len(events))
+	for _, event := range bytes.SplitAfter(events, []byte("\n\n")) {
+		i := bytes.IndexByte(event, '\n')
+		if !bytes.HasPrefix(event, []byte("id: ")) || i < 0 {
+			out = append(out, event...)
+			continue
+		}
+
+		c.ids.Set(label, string(event[len("id: "):i]))
+		out = append(out, "id: "...)
+		out = append(out, c.ids.Encode()...)
+		out = append(out, event[i:]...)
+	}
+	return c.writeLocked(out)
+}
+
+// entryWriter buffers the output of a reader until the end of an entry, so the entries of the readers are never
+// interleaved. The lines of text responses are prefixed with the label of the reader, SSE entries carry the
+// source in their fields.
+type entryWriter struct {
+	out   *combinedWriter
+	label string
+	sse   bool
+	buf   []byte
+}
+
+func (e *entryWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+
+	sep := []byte("\n")
+	if e.sse {
+		sep = []byte("\n\n")
+	}
+
+	i := bytes.LastIndex(e.buf, sep)
+	if i < 0 {
+		return len(p), nil
+	}
+	end := i + len(sep)
+
+	entries := e.buf[:end]
+	if e.sse {
+		err := e.out.writeEvents(e.label, entries)
+		e.buf = append(e.buf[:0], e.buf[end:]...)
+		return len(p), err
+	}
+
+	if e.label != "" {
+		prefix := []byte("[" + e.label + "] ")
+		lines := bytes.SplitAfter(entries, sep)
+		entries = make([]byte, 0, end+len(lines)*len(prefix))
+		for _, line := range lines {
+			if len(line) > 0 {
+				entries = append(append(entries, prefix...), line...)
+			}
+		}
+	}
+
+	err := e.out.write(entries)
+	e.buf = append(e.buf[:0], e.buf[end:]...)
+	return len(p), err
+}
+
+// readCombined copies the entries of the sources to a writer concurrently until every source is read, or until
+// the context is canceled for SSE streams. A failed source is logged and does not stop the other sources.
+// The SSE streams are polled with a backoff up to maxPoll, see pollBackoff.
+func readCombined(ctx context.Context, sources []combinedSource, out *combinedWriter, sse bool,
+	maxPoll time.Duration) {
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source combinedSource) {
+			defer wg.Done()
+
+			w := &entryWriter{out: out, label: source.label, sse: sse}
+			poll := newPollBackoff(followInterval, maxPoll)
+			for {
+				n, err := io.Copy(w, source.r)
+				if ctx.Err() != nil {
+					return
+				}
+
+				switch err {
+				case nil:
+					if !sse || source.r.RangeEnd() {
+						return
+					}
+				case reader.ErrNoData:
+					continue
+				default:
+					logrus.Errorf("unable to read %s: %s", source.label, err)
+					return
+				}
+
+				// a stream is polled for new entries.
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(poll.next(n > 0)):
+				}
+			}
+		}(source)
+	}
+	wg.Wait()
+}
+
+// combinedLastEventID returns the ids of the sources in the Last-Event-ID header of a client reconnecting to a
+// combined SSE stream, nil if the header is not an id of a combined stream.
+func combinedLastEventID(req *http.Request) (url.Values, error) {
+	id := req.Header.Get("Last-Event-ID")
+	if !strings.Contains(id, "=") {
+		return nil, nil
+	}
+
+	ids, err := url.ParseQuery(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Last-Event-ID header: %s", err)
+	}
+	return ids, nil
+}
+
+// combinedOpts returns a func of the reader options of a source of a combined stream by label and whether the
+// response is an SSE stream or a followed text response. A reconnecting client resumes every source at its id in
+// Last-Event-ID, the sources without an id are read from the beginning.
+func combinedOpts(req *http.Request) (opts func(label string) []reader.Option, sse, follow bool, err error) {
+	ids, err := combinedLastEventID(req)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	if ids != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("Last-Event-ID", "0")
+	}
+
+	common, err := buildOpts(req)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	resume := make(map[string]reader.Option, len(ids))
+	for label := range ids {
+		opt, ok, err := lastEventIDHeader(ids.Get(label))
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		if ok {
+			resume[label] = opt
+		}
+	}
+
+	sse = req.Header.Get("Accept") == eventStreamContentType
+	if sse {
+		common = append(common, reader.OptStream(true))
+	} else if boolParam(req, followParam, false) {
+		follow = true
+		common = append(common, reader.OptFollow(followInterval), reader.OptFollowBackoff(followMaxInterval(req)))
+	}
+
+	opts = func(label string) []reader.Option {
+		opt, ok := resume[label]
+		if !ok {
+			return common
+		}
+		return append(common[:len(common):len(common)], opt)
+	}
+	return opts, sse, follow, nil
+}
+
+// combinedSetupError responds with the error of setupFilesAPIReader.
+func combinedSetupError(w http.ResponseWriter, req *http.Request, err error) {
+	if e, ok := err.(errSetupFilesAPIReader); ok {
+		logError(w, req, e.msg, e.code)
+		return
+	}
+
+	middleware.UpstreamError(req, middleware.UpstreamAgent)
+	logError(w, req, "unable to initialize files API reader: "+err.Error(), agentErrorCode(err))
+}
+
+// serveCombined writes the combined stream of the sources to a response.
+func serveCombined(w http.ResponseWriter, req *http.Request, sources []combinedSource, sse, follow bool) {
+	out := &combinedWriter{w: w}
+	if f, ok := w.(http.Flusher); ok && (sse || follow) {
+		out.flusher = f
+	}
+
+	if sse {
+		w.Header().Set("Content-Type", eventStreamContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+	} else if follow {
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+
+	readCombined(req.Context(), sources, out, sse, followMaxInterval(req))
+}
+
+// allFilesHandler reads stdout and stderr of a sandbox concurrently as a single stream, like kubectl logs. The
+// lines of text responses are prefixed with the file name in brackets, SSE entries have FILE field. A missing
+// file is skipped.
+func allFilesHandler(w http.ResponseWriter, req *http.Request) {
+	opts, sse, follow, err := combinedOpts(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var sources []combinedSource
+	for _, file := range multiplexFiles {
+		r, err := setupFilesAPIReader(req, "/files/read", append([]reader.Option{reader.OptFile(file)}, opts(file)...)...)
+		if err == reader.ErrFileNotFound {
+			continue
+		}
+
+		if err != nil {
+			combinedSetupError(w, req, err)
+			return
+		}
+		sources = append(sources, combinedSource{label: file, r: r})
+	}
+
+	if len(sources) == 0 {
+		if serveGoneSandbox(w, req) {
+			return
+		}
+		logError(w, req, "stdout and stderr not found", http.StatusNotFound)
+		return
+	}
+
+	serveCombined(w, req, sources, sse, follow)
+}
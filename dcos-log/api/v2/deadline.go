@@ -0,0 +1,46 @@
+package v2
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+)
+
+// partialTrailer is a trailer of range responses set to true if the response was cut by -range-timeout.
+const partialTrailer = "X-Partial-Result"
+
+// withRangeDeadline returns the request with the deadline -range-timeout. It is applied to range requests only,
+// streams and followed task logs are not limited.
+func withRangeDeadline(req *http.Request) (*http.Request, context.CancelFunc) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return req, func() {}
+	}
+
+	// validated on startup.
+	timeout, _ := time.ParseDuration(cfg.FlagRangeTimeout)
+	if timeout <= 0 {
+		return req, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
+
+// deadlineExceeded returns true if the range request was cut by its deadline. The response is 504 if nothing
+// was sent, otherwise the partial result trailer is set.
+func deadlineExceeded(w http.ResponseWriter, req *http.Request, sent int64) bool {
+	if req.Context().Err() != context.DeadlineExceeded {
+		return false
+	}
+
+	if sent == 0 {
+		logError(w, req, "range request timed out", http.StatusGatewayTimeout)
+		return true
+	}
+
+	w.Header().Set(partialTrailer, "true")
+	return true
+}
@@ -0,0 +1,233 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	"github.com/dcos/dcos-log/dcos-log/docker"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const dockerPollInterval = 500 * time.Millisecond
+
+// writeDockerEntry writes a single docker log entry in the requested format.
+func writeDockerEntry(w http.ResponseWriter, e docker.Entry, contentType string) error {
+	if contentType == "text/plain" {
+		_, err := w.Write([]byte(e.Log))
+		return err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if contentType == eventStreamContentType {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", body)
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", body)
+	return err
+}
+
+// containerExecutor returns the framework and the executor of a container in the agent state.
+func containerExecutor(state *agent.State, containerID string) (authz.Task, bool) {
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
+			if executor.Container == containerID {
+				return authz.Task{FrameworkID: framework.ID, ExecutorID: executor.ID, ContainerID: containerID}, true
+			}
+		}
+	}
+	return authz.Task{}, false
+}
+
+// dockerAdmin returns true if the verified uid of the request is one of -admin-uids. The config requires
+// -jwt-verify with -admin-uids, the uid is set by the token verification.
+func dockerAdmin(req *http.Request) bool {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok || !cfg.FlagJWTVerify {
+		return false
+	}
+
+	uid, ok := middleware.FromContextUID(req.Context())
+	if !ok || uid == "" {
+		return false
+	}
+
+	for _, admin := range strings.Split(cfg.FlagAdminUIDs, ",") {
+		if strings.TrimSpace(admin) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeDockerContainer checks that the user may read the logs of a container, the docker daemon does not know
+// the users. The executor of the container of a Mesos task must be listed in the agent state read with the token
+// of the user, and allowed by the task policy. The containers not launched by Mesos, such as the system containers
+// of the node, have no task to authorize, their logs are read by the users of -admin-uids only.
+func authorizeDockerContainer(req *http.Request, container *docker.Container) (int, error) {
+	containerID, ok := container.MesosContainerID()
+	if !ok {
+		if dockerAdmin(req) {
+			return 0, nil
+		}
+		return http.StatusForbidden, fmt.Errorf("docker container %s was not launched by mesos, only the users of "+
+			"admin-uids may read its logs", container.ID)
+	}
+
+	state, err := userAgentState(req)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		return http.StatusInternalServerError, fmt.Errorf("unable to authorize docker container %s: %s", container.ID, err)
+	}
+
+	task, ok := containerExecutor(state, containerID)
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("docker container %s not found", containerID)
+	}
+
+	if uid := middleware.RequestUID(req); !authz.Default().Allowed(uid, task) {
+		return http.StatusForbidden, fmt.Errorf("user %q is not allowed to read the logs of framework %s", uid,
+			task.FrameworkID)
+	}
+	return 0, nil
+}
+
+// dockerLogsHandler returns a handler reading the json-file logs of containers launched by docker daemon directly.
+// The container is identified by docker ID, name or mesos container ID. Without ?limit= the log is streamed entry
+// by entry. The requests share the client, so the keep-alive connection to the daemon is reused.
+func dockerLogsHandler(client *docker.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		serveDockerLogs(w, req, client)
+	}
+}
+
+func serveDockerLogs(w http.ResponseWriter, req *http.Request, client *docker.Client) {
+	vars := mux.Vars(req)
+	id := vars["container"]
+	stream := vars["stream"]
+
+	limit, err := nonNegativeParam(req.URL.Query(), limitParam)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	container, err := client.Resolve(ctx, id)
+	cancel()
+
+	switch err {
+	case nil:
+	case docker.ErrContainerNotFound:
+		logError(w, req, fmt.Sprintf("docker container %s not found", id), http.StatusNotFound)
+		return
+	case docker.ErrUnsupportedLogDriver:
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		middleware.UpstreamError(req, middleware.UpstreamDocker)
+		logError(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if code, err := authorizeDockerContainer(req, container); err != nil {
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	f, err := os.Open(container.LogPath)
+	if err != nil {
+		logError(w, req, "unable to open container log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	contentType := "text/plain"
+	switch req.Header.Get("Accept") {
+	case "application/json", eventStreamContentType:
+		contentType = req.Header.Get("Accept")
+	}
+
+	var offset int64
+	if limit > 0 {
+		var entries []docker.Entry
+		entries, offset, err = docker.Tail(f, stream, limit)
+		if err != nil {
+			logError(w, req, "unable to read container log: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		for _, e := range entries {
+			if err := writeDockerEntry(w, e, contentType); err != nil {
+				return
+			}
+		}
+	} else {
+		// the whole log may not fit in memory, the entries are written while the file is read.
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		offset, err = docker.Scan(f, stream, func(e docker.Entry) error {
+			return writeDockerEntry(w, e, contentType)
+		})
+
+		if err != nil {
+			logrus.Errorf("unable to read container log %s: %s", container.LogPath, err)
+			return
+		}
+	}
+
+	if contentType != eventStreamContentType {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logError(w, req, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
+		return
+	}
+
+	follower, err := docker.NewFollower(container.LogPath, stream, offset)
+	if err != nil {
+		logrus.Errorf("unable to follow container log %s: %s", container.LogPath, err)
+		return
+	}
+	defer follower.Close()
+
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(dockerPollInterval):
+			entries, err := follower.Next()
+			for _, e := range entries {
+				if err := writeDockerEntry(w, e, contentType); err != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				logrus.Errorf("error following container log %s: %s", container.LogPath, err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
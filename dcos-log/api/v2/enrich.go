@@ -0,0 +1,216 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// fields added to the journal entries of the containers by the enrichment.
+const (
+	enrichAgentID       = "AGENT_ID"
+	enrichFrameworkName = "FRAMEWORK_NAME"
+	enrichTaskName      = "TASK_NAME"
+)
+
+// enrichStateTimeout is the timeout of the agent state request of the enrichment.
+const enrichStateTimeout = 5 * time.Second
+
+// errEnrichContext is returned if the request context has no http client or node info to read the agent state.
+var errEnrichContext = errors.New("invalid context, unable to retrieve an http client or the node info")
+
+var taskIndexLookups = metrics.NewCounterVec("dcos_log_task_index_lookups_total",
+	"Lookups of the agent task index of the journal entry enrichment by result (hit, miss).", "result")
+
+// taskMetadata is the task context of a container or a task on the agent.
+type taskMetadata struct {
+	agentID       string
+	frameworkName string
+	taskName      string
+}
+
+// taskIndex maps the container IDs of the executors and the task IDs on the agent to their task context.
+type taskIndex struct {
+	containers map[string]taskMetadata
+	tasks      map[string]taskMetadata
+	expires    time.Time
+}
+
+// newTaskIndex indexes the frameworks, executors and tasks of the agent state, the completed ones too. The task name
+// of a container is only known if its executor runs a single task, the executors of pods run several.
+func newTaskIndex(state *agent.State) *taskIndex {
+	index := &taskIndex{containers: make(map[string]taskMetadata), tasks: make(map[string]taskMetadata)}
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
+			tasks := append(executor.Tasks, executor.CompletedTasks...)
+
+			container := taskMetadata{agentID: state.ID, frameworkName: framework.Name}
+			if len(tasks) == 1 {
+				container.taskName = tasks[0].Name
+			}
+
+			if executor.Container != "" {
+				index.containers[executor.Container] = container
+			}
+
+			for _, task := range tasks {
+				index.tasks[task.ID] = taskMetadata{agentID: state.ID, frameworkName: framework.Name,
+					taskName: task.Name}
+			}
+		}
+	}
+	return index
+}
+
+// enrich adds the agent ID, the framework name and the task name of the entry container, or task, to the fields. The
+// fields of the entry are kept.
+func (index *taskIndex) enrich(fields map[string]string) {
+	meta, ok := index.containers[fields["CONTAINER_ID"]]
+	if !ok {
+		if meta, ok = index.tasks[fields["MESOS_TASK_ID"]]; !ok {
+			return
+		}
+	}
+
+	for field, value := range map[string]string{enrichAgentID: meta.agentID,
+		enrichFrameworkName: meta.frameworkName, enrichTaskName: meta.taskName} {
+		if _, ok := fields[field]; !ok && value != "" {
+			fields[field] = value
+		}
+	}
+}
+
+// taskIndexCache caches the task index of the agent by token, the agent state is filtered by the permissions of the
+// user. A failed state request is cached as an empty index, so the entries of a failing agent are not enriched for a
+// ttl instead of waiting for the agent on every request.
+type taskIndexCache struct {
+	mu      sync.Mutex
+	entries map[string]*taskIndex
+	now     func() time.Time
+}
+
+func newTaskIndexCache() *taskIndexCache {
+	return &taskIndexCache{entries: make(map[string]*taskIndex), now: time.Now}
+}
+
+// taskIndexes is the cache of the task indexes of the enrichment.
+var taskIndexes = newTaskIndexCache()
+
+// get returns the cached index of a key, false if it's not cached or expired. The expired indexes are removed.
+func (c *taskIndexCache) get(key string) (*taskIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, index := range c.entries {
+		if !now.Before(index.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	index, ok := c.entries[key]
+	if !ok {
+		taskIndexLookups.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	taskIndexLookups.WithLabelValues("hit").Inc()
+	return index, true
+}
+
+// add caches the index of a key for ttl.
+func (c *taskIndexCache) add(key string, index *taskIndex, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index.expires = c.now().Add(ttl)
+	c.entries[key] = index
+}
+
+// requestTaskIndex returns the task index of the agent with the permissions of the request user, an empty index if
+// the agent state cannot be read.
+func requestTaskIndex(req *http.Request, ttl time.Duration) *taskIndex {
+	token, _ := middleware.FromContextToken(req.Context())
+	key := taskCacheKey(token, "")
+	if index, ok := taskIndexes.get(key); ok {
+		return index
+	}
+
+	index, err := fetchTaskIndex(req, token)
+	if err != nil {
+		logrus.Errorf("Unable to enrich the journal entries with the agent state: %s", err)
+		index = &taskIndex{}
+	}
+	taskIndexes.add(key, index, ttl)
+	return index
+}
+
+func fetchTaskIndex(req *http.Request, token string) (*taskIndex, error) {
+	cfg, _ := middleware.FromContextConfig(req.Context())
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		return nil, errEnrichContext
+	}
+
+	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+	if !ok {
+		return nil, errEnrichContext
+	}
+
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), enrichStateTimeout)
+	defer cancel()
+
+	state, err := agent.GetState(ctx, client, *agentURL, header)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		return nil, err
+	}
+	return newTaskIndex(state), nil
+}
+
+// enrichment returns the function which adds the task context to the journal entries of the Mesos containers with
+// -enrich-tasks, nil otherwise. The agent state is only read once an entry of a container is formatted, and again
+// once its index expired, so a stream enriches the entries of the containers started after it.
+func enrichment(req *http.Request) func(map[string]string) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok || !cfg.FlagEnrichTasks || cfg.FlagRole == dcos.RoleMaster {
+		return nil
+	}
+
+	// validated on startup.
+	ttl, _ := time.ParseDuration(cfg.FlagEnrichTasksTTL)
+
+	var (
+		mu    sync.Mutex
+		index *taskIndex
+	)
+	return func(fields map[string]string) {
+		if fields["CONTAINER_ID"] == "" && fields["MESOS_TASK_ID"] == "" {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if index == nil || !time.Now().Before(index.expires) {
+			index = requestTaskIndex(req, ttl)
+		}
+		index.enrich(fields)
+	}
+}
@@ -0,0 +1,183 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// explainMaxEntries is the maximum number of journal entries counted by ?explain=true.
+const explainMaxEntries = 100000
+
+// journalExplanation is a response of ?explain=true for journal endpoints.
+type journalExplanation struct {
+	Source string `json:"source"`
+
+	// Matches of the same field are joined with OR and the fields with AND, ComponentMatches are joined with OR.
+	Matches          []string `json:"matches"`
+	ComponentMatches []string `json:"component_matches"`
+
+	// MatchTree is the expression of the matches evaluated by journald, also sent in X-Journal-Matches header.
+	MatchTree string `json:"match_tree"`
+
+	// Text are the words and phrases of ?q= the messages must contain. Since is ?q= since: term or ?since=,
+	// Until is ?until=.
+	Text  []string `json:"text"`
+	Since string   `json:"since,omitempty"`
+	Until string   `json:"until,omitempty"`
+
+	// Pattern is ?filter_pattern= the messages must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Boot is the offset of the boot set by ?boot=, a boot ID is one of Matches.
+	Boot *int `json:"boot,omitempty"`
+
+	// Start is head, tail, since, until or cursor. Direction is asc, or desc if the entries are read newest first.
+	Start     string `json:"start"`
+	Direction string `json:"direction"`
+	Cursor    string `json:"cursor,omitempty"`
+	Skip      int    `json:"skip"`
+	Limit     uint64 `json:"limit"`
+	Stream    bool   `json:"stream"`
+
+	// EstimatedEntries is the number of entries which would be sent, counted up to explainMaxEntries.
+	EstimatedEntries uint64 `json:"estimated_entries"`
+	Truncated        bool   `json:"estimate_truncated"`
+}
+
+// filesExplanation is a response of ?explain=true for task log endpoints.
+type filesExplanation struct {
+	Source string `json:"source"`
+	reader.Plan
+}
+
+func matchStrings(matches []jr.JournalEntryMatch) []string {
+	s := make([]string, 0, len(matches))
+	for _, m := range matches {
+		s = append(s, m.String())
+	}
+	return s
+}
+
+// explainQuery describes how the journal would be read, without opening the journal.
+func explainQuery(req *http.Request, q *journalQuery) *journalExplanation {
+	e := &journalExplanation{
+		Source:           "journal",
+		Matches:          matchStrings(q.matches),
+		ComponentMatches: matchStrings(q.componentMatches),
+		MatchTree:        jr.MatchTree(q.componentMatches, q.matches),
+		Text:             []string{},
+		Start:            "head",
+		Direction:        "asc",
+		Cursor:           q.cursor,
+		Skip:             q.skip,
+		Limit:            q.limit,
+		Pattern:          q.pattern,
+		Stream:           req.Header.Get("Accept") == eventStreamContentType,
+	}
+
+	if q.useBoot {
+		boot := q.boot
+		e.Boot = &boot
+	}
+
+	if q.query != nil {
+		e.Text = append(e.Text, q.query.Text...)
+		if q.query.Since > 0 {
+			e.Since = q.query.Since.String()
+			e.Start = "since"
+		}
+	}
+
+	if !q.since.IsZero() {
+		e.Since = q.since.Format(time.RFC3339)
+		e.Start = "since"
+	}
+
+	if !q.until.IsZero() {
+		e.Until = q.until.Format(time.RFC3339)
+	}
+
+	if q.reverse {
+		e.Direction, e.Start = "desc", "tail"
+		if !q.until.IsZero() {
+			e.Start = "until"
+		}
+	}
+
+	switch {
+	case q.cursor != "":
+		e.Start = "cursor"
+	case q.end || q.skip < 0:
+		e.Start = "tail"
+	}
+	return e
+}
+
+func writeExplanation(w http.ResponseWriter, req *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		logrus.Errorf("unable to encode explanation: %s. Request: %s", err, req.RequestURI)
+	}
+}
+
+// explainJournal responds with the effective matches, start position and limits of a journal request and
+// the number of matching entries. The entries are counted, but not read.
+func explainJournal(w http.ResponseWriter, req *http.Request, q *journalQuery) {
+	e := explainQuery(req, q)
+
+	j, err := jr.NewReader(nil, append([]jr.Option{optJournalDirs(req)}, q.options()...)...)
+	if err != nil {
+		journalOpenError(w, req, j, err)
+		return
+	}
+	defer j.Close()
+
+	if e.EstimatedEntries, err = j.Count(explainMaxEntries); err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		logError(w, req, "unable to count journal entries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	e.Truncated = e.EstimatedEntries == explainMaxEntries
+
+	writeExplanation(w, req, e)
+}
+
+// explainFiles responds with the sandbox path, offset, direction and limits of a task log request and
+// the number of bytes which would be read. Only the size of the file is requested from the agent.
+func explainFiles(w http.ResponseWriter, req *http.Request, opts []reader.Option) {
+	r, err := setupFilesAPIReader(req, "/files/read", append([]reader.Option{reader.OptDryRun()}, opts...)...)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		var plan reader.Plan
+		if plan, err = r.Plan(ctx); err == nil {
+			writeExplanation(w, req, filesExplanation{Source: "sandbox", Plan: plan})
+			return
+		}
+	}
+
+	switch err {
+	case reader.ErrFileNotFound:
+		logError(w, req, "File not found", http.StatusNotFound)
+	case reader.ErrCursorExpired:
+		logError(w, req, err.Error(), http.StatusGone)
+	default:
+		if e, ok := err.(errSetupFilesAPIReader); ok {
+			logError(w, req, e.msg, e.code)
+			return
+		}
+
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to explain the request: "+err.Error(), http.StatusInternalServerError)
+	}
+}
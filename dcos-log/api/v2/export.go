@@ -0,0 +1,236 @@
+package v2
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/archive"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// errRangeEnd is returned by rangeFormatter when an entry after the end of the range is read.
+var errRangeEnd = errors.New("end of time range")
+
+// rangeFormatter stops reading the journal after a given time and counts the formatted entries.
+type rangeFormatter struct {
+	jr.EntryFormatter
+	until   time.Time
+	entries int64
+}
+
+func (r *rangeFormatter) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	if !r.until.IsZero() && t.After(r.until) {
+		return nil, errRangeEnd
+	}
+
+	atomic.AddInt64(&r.entries, 1)
+	return r.EntryFormatter.FormatEntry(entry)
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+type exportResponse struct {
+	URL     string `json:"url"`
+	Key     string `json:"key"`
+	Entries int64  `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// parseTimeParam parses a time in RFC3339 format or a duration relative to now, 1h and -1h are an hour ago.
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// exportFormat returns the content type and the file extension of an export format, JSON for an unknown format.
+func exportFormat(format string) (jr.ContentType, string) {
+	switch format {
+	case "text":
+		return jr.ContentTypePlainText, ".log"
+	case "cef":
+		return jr.ContentTypeCEF, ".cef"
+	case "leef":
+		return jr.ContentTypeLEEF, ".leef"
+	case "elastic":
+		return jr.ContentTypeElasticBulk, ".ndjson"
+	case "logfmt":
+		return jr.ContentTypeLogfmt, ".logfmt"
+	case "gelf":
+		return jr.ContentTypeGELF, ".gelf"
+	case "ndjson":
+		return jr.ContentTypeNDJSON, ".ndjson"
+	case "csv":
+		return jr.ContentTypeCSV, ".csv"
+	}
+	return jr.ContentTypeApplicationJSON, ".json"
+}
+
+// exportHandler reads the journal entries matching the filters in a given time range and streams them
+// gzip compressed to the export bucket. The response contains the URL of the created object.
+func exportHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	if cfg.FlagExportURL == "" {
+		logError(w, req, "export is not configured, export-url must be set", http.StatusNotImplemented)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve an http client", http.StatusInternalServerError)
+		return
+	}
+
+	query := req.URL.Query()
+	since, err := parseTimeParam(query.Get("since"))
+	if err != nil {
+		logError(w, req, "unable to parse since parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	until, err := parseTimeParam(query.Get("until"))
+	if err != nil {
+		logError(w, req, "unable to parse until parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		logError(w, req, "since must be before until", http.StatusBadRequest)
+		return
+	}
+
+	opts := []jr.Option{optJournalDirs(req)}
+	if unit := query.Get("unit"); unit != "" {
+		opts = append(opts, jr.OptionMatchOR([]jr.JournalEntryMatch{
+			{
+				Field: "UNIT",
+				Value: unit,
+			},
+			{
+				Field: "_SYSTEMD_UNIT",
+				Value: unit,
+			},
+		}))
+	}
+
+	if filters := query[filterParam]; len(filters) > 0 {
+		var matches []jr.JournalEntryMatch
+		for _, filter := range filters {
+			filterArray := strings.Split(filter, ":")
+			if len(filterArray) != 2 {
+				logError(w, req, "incorrect filter parameter format, must be ?filer=key:value. Got "+filter, http.StatusBadRequest)
+				return
+			}
+
+			matches = append(matches, jr.JournalEntryMatch{
+				Field: strings.ToUpper(filterArray[0]),
+				Value: filterArray[1],
+			})
+		}
+		opts = append(opts, jr.OptionMatch(matches))
+	}
+
+	if !since.IsZero() {
+		opts = append(opts, jr.OptionSince(time.Since(since)))
+	}
+
+	contentType, ext := exportFormat(query.Get("format"))
+
+	formatter := &rangeFormatter{
+		EntryFormatter: newEntryFormatter(req, contentType.String(), false),
+		until:          until,
+	}
+
+	// the default client timeout is too short for big uploads, the request context is used instead.
+	uploader, err := archive.NewMultipartUploader(cfg.FlagExportURL, &http.Client{Transport: middleware.Undecorated(client).Transport})
+	if err != nil {
+		logError(w, req, "unable to initialize uploader: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	j, err := jr.NewReader(formatter, opts...)
+	if err != nil {
+		journalOpenError(w, req, j, err)
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	key := path.Join(hostname, time.Now().UTC().Format("20060102T150405.000000000Z")+ext+".gz")
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if err := j.Close(); err != nil {
+				logrus.Errorf("error closing journald: %s", err)
+			}
+		}()
+
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, j)
+		if err == nil || err == errRangeEnd {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	body := &countingReader{r: pr}
+	err = uploader.Upload(req.Context(), key, body)
+
+	// unblock the reader if upload has failed.
+	pr.CloseWithError(err)
+	<-done
+
+	if err != nil {
+		logError(w, req, fmt.Sprintf("unable to export %s: %s", key, err), http.StatusBadGateway)
+		return
+	}
+
+	logrus.Infof("exported %d journal entries to %s", atomic.LoadInt64(&formatter.entries), key)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(exportResponse{
+		URL:     uploader.ObjectURL(key),
+		Key:     key,
+		Entries: atomic.LoadInt64(&formatter.entries),
+		Bytes:   body.n,
+	})
+}
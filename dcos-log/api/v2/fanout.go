@@ -0,0 +1,445 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/merge"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/master"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// agentLogsPath is a path of dcos-log API behind agent admin router.
+	agentLogsPath = "/system/v1/logs/v2/component/"
+
+	// fanoutRetryInterval is a delay before a failed agent stream is reopened.
+	fanoutRetryInterval = 5 * time.Second
+
+	// fanoutMaxEntrySize is the maximum size of an entry read from an agent.
+	fanoutMaxEntrySize = 1 << 20
+
+	// agentParam selects an agent of a fanout by its ID or hostname, agentAttributeParam by an attribute key:value.
+	agentParam          = "agent"
+	agentAttributeParam = "agent_attribute"
+)
+
+// selectAgents returns the active agents selected by the agent and agent_attribute parameters of a query, all active
+// agents if there are none. An agent is selected if it is listed by an agent parameter, if any, and has every
+// attribute of the agent_attribute parameters.
+func selectAgents(agents []master.Agent, query url.Values) ([]master.Agent, error) {
+	attributes := make(map[string]string)
+	for _, attribute := range query[agentAttributeParam] {
+		kv := strings.SplitN(attribute, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid %s parameter %q, use key:value", agentAttributeParam, attribute)
+		}
+		attributes[kv[0]] = kv[1]
+	}
+
+	names := make(map[string]bool)
+	for _, name := range query[agentParam] {
+		names[name] = true
+	}
+
+	var selected []master.Agent
+	for _, agent := range agents {
+		if !agent.Active || (len(names) > 0 && !names[agent.ID] && !names[agent.Hostname]) {
+			continue
+		}
+
+		matches := true
+		for key, value := range attributes {
+			v, ok := agent.Attributes[key]
+			matches = matches && ok && fmt.Sprint(v) == value
+		}
+
+		if matches {
+			selected = append(selected, agent)
+		}
+	}
+	return selected, nil
+}
+
+// fanoutTarget is an agent and the URL of the unit logs on the agent.
+type fanoutTarget struct {
+	agent master.Agent
+	url   url.URL
+
+	// source identifies the target in the merged stream, the agent ID if empty. tags are added to the entries and
+	// errors of the target. text is set if the target sends plain text lines instead of JSON entries.
+	source string
+	tags   map[string]string
+	text   bool
+}
+
+// key returns the source of the target.
+func (t fanoutTarget) key() string {
+	if t.source != "" {
+		return t.source
+	}
+	return t.agent.ID
+}
+
+// fanoutWriter writes the entries of all agents to a single response.
+type fanoutWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+	sse     bool
+}
+
+// newFanoutWriter sets the content type of a fanout response and returns a writer of the entries.
+func newFanoutWriter(w http.ResponseWriter, sse bool) *fanoutWriter {
+	out := &fanoutWriter{w: w, sse: sse}
+	if f, ok := w.(http.Flusher); ok && sse {
+		out.flusher = f
+	}
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if sse {
+		w.Header().Set("Content-Type", eventStreamContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	return out
+}
+
+func (f *fanoutWriter) write(event string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.sse && event != "":
+		fmt.Fprintf(f.w, "event: %s\ndata: %s\n\n", event, data)
+	case f.sse:
+		fmt.Fprintf(f.w, "data: %s\n\n", data)
+	default:
+		fmt.Fprintf(f.w, "%s\n", data)
+	}
+
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+}
+
+// writeError reports a failed agent, the entries of the other agents are still sent.
+func (f *fanoutWriter) writeError(target fanoutTarget, err error) {
+	fields := map[string]string{"agent_id": target.agent.ID, "hostname": target.agent.Hostname, "error": err.Error()}
+	for k, v := range target.tags {
+		fields[k] = v
+	}
+
+	data, _ := json.Marshal(fields)
+	f.write("agent_error", data)
+}
+
+// tagEntry decodes a JSON entry, adds agent_id, hostname and the tags of the target and returns the entry, its
+// cursor and time. A plain text line is the MESSAGE field of an entry.
+func tagEntry(target fanoutTarget, data []byte) (map[string]interface{}, string, time.Time, error) {
+	entry := make(map[string]interface{})
+	if target.text {
+		entry["fields"] = map[string]interface{}{"MESSAGE": string(data)}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, "", time.Time{}, err
+		}
+	}
+
+	entry["agent_id"] = target.agent.ID
+	entry["hostname"] = target.agent.Hostname
+	for k, v := range target.tags {
+		entry[k] = v
+	}
+	cursor, _ := entry["cursor"].(string)
+
+	var t time.Time
+	if usec, ok := entry["realtime_timestamp"].(json.Number); ok {
+		if v, err := usec.Int64(); err == nil {
+			t = time.Unix(0, v*int64(time.Microsecond))
+		}
+	} else {
+		t = messageTime(entry)
+	}
+	return entry, cursor, t, nil
+}
+
+// messageTime returns the TIMESTAMP field of a task log entry read with ?timestamps=true, or the RFC3339 timestamp
+// at the beginning of its message, or zero time.
+func messageTime(entry map[string]interface{}) time.Time {
+	fields, _ := entry["fields"].(map[string]interface{})
+	if timestamp, ok := fields[reader.TimeField].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			return t
+		}
+	}
+
+	message, _ := fields["MESSAGE"].(string)
+	if i := strings.IndexByte(message, ' '); i > 0 {
+		message = message[:i]
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, message)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// readAgent writes the entries of a single agent and returns the last cursor. SSE streams are read until
+// the context is canceled or the agent closes the connection.
+func readAgent(ctx context.Context, client *http.Client, target fanoutTarget, header http.Header, sse bool,
+	cursor string, merger *merge.Merger) (string, error) {
+	req, err := http.NewRequest("GET", target.url.String(), nil)
+	if err != nil {
+		return cursor, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Accept", jr.ContentTypeApplicationJSON.String())
+	if sse {
+		req.Header.Set("Accept", eventStreamContentType)
+	}
+
+	if cursor != "" {
+		req.Header.Set("Last-Event-ID", cursor)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return cursor, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return cursor, nil
+	default:
+		return cursor, fmt.Errorf("agent responded with status %d", resp.StatusCode)
+	}
+
+	// the entries of task logs have no cursor field, the cursor is the id of the event.
+	var id string
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 4096), fanoutMaxEntrySize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if sse {
+			if bytes.HasPrefix(line, []byte("id: ")) {
+				id = string(line[len("id: "):])
+				continue
+			}
+
+			if !bytes.HasPrefix(line, []byte("data: ")) {
+				continue
+			}
+			line = line[len("data: "):]
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, entryCursor, t, err := tagEntry(target, line)
+		if err != nil {
+			return cursor, fmt.Errorf("invalid entry: %s", err)
+		}
+
+		// an entry without timestamp is ordered by the time it is read.
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		if entryCursor == "" {
+			entryCursor = id
+		}
+
+		if entryCursor != "" {
+			cursor = entryCursor
+		}
+		merger.Push(target.key(), t, entry)
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return cursor, err
+	}
+	return cursor, nil
+}
+
+// fanout reads the entries of all targets concurrently. The entries are ordered by time in a reorder buffer
+// with a given delay, entries older than an already sent entry are sent with "late": true. A failed agent is
+// reported with an agent_error event, SSE streams of failed agents are reopened from the last cursor until the
+// context is canceled.
+func fanout(ctx context.Context, client *http.Client, targets []fanoutTarget, header http.Header, sse bool,
+	delay time.Duration, out *fanoutWriter) {
+	merger := merge.NewMerger(delay, func(e merge.Entry) {
+		entry := e.Value.(map[string]interface{})
+		if e.Late {
+			entry["late"] = true
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			logrus.Errorf("unable to encode an entry: %s", err)
+			return
+		}
+		out.write("", data)
+	})
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		merger.Add(target.key())
+
+		wg.Add(1)
+		go func(target fanoutTarget) {
+			defer wg.Done()
+			defer merger.Done(target.key())
+
+			var (
+				cursor string
+				err    error
+			)
+			for {
+				cursor, err = readAgent(ctx, client, target, header, sse, cursor, merger)
+				if ctx.Err() != nil {
+					return
+				}
+
+				if err != nil {
+					logrus.Errorf("unable to read the logs of agent %s: %s", target.agent.ID, err)
+					out.writeError(target, err)
+				}
+
+				if !sse {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(fanoutRetryInterval):
+				}
+			}
+		}(target)
+	}
+
+	// release the entries of idle agents.
+	done := make(chan struct{})
+	if delay > 0 {
+		go func() {
+			ticker := time.NewTicker(delay / 4)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					merger.Tick()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	merger.Close()
+}
+
+// fanoutHandler streams the entries of a unit from every active agent, or the agents selected by the agent and
+// agent_attribute parameters, tagged with agent_id and hostname.
+// It is only available on master nodes.
+func fanoutHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve an http client", http.StatusInternalServerError)
+		return
+	}
+
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
+		return
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	agents, err := master.GetAgents(ctx, client, master.URL(cfg.FlagAuth), header)
+	cancel()
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		logError(w, req, "unable to list agents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if cfg.FlagAuth {
+		scheme = "https"
+	}
+
+	// the agent selection is not passed to the agents.
+	query := req.URL.Query()
+	agents, err = selectAgents(agents, query)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Del(agentParam)
+	query.Del(agentAttributeParam)
+
+	var targets []fanoutTarget
+	for _, agent := range agents {
+		targets = append(targets, fanoutTarget{
+			agent: agent,
+			url: url.URL{
+				Scheme:   scheme,
+				Host:     net.JoinHostPort(agent.Hostname, strconv.Itoa(cfg.FlagFanoutAgentPort)),
+				Path:     agentLogsPath + mux.Vars(req)["name"],
+				RawQuery: query.Encode(),
+			},
+		})
+	}
+
+	sse := req.Header.Get("Accept") == eventStreamContentType
+	out := newFanoutWriter(w, sse)
+
+	// validated on startup.
+	delay, _ := time.ParseDuration(cfg.FlagMergeDelay)
+
+	// the entries are streamed, the request timeout only applies to the requests to the master.
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	logrus.Debugf("reading %s from %d agents", mux.Vars(req)["name"], len(targets))
+	fanout(req.Context(), &streamClient, targets, header, sse, delay, out)
+}
@@ -0,0 +1,79 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// fieldNamePattern matches the names journald accepts for the fields of an entry.
+var fieldNamePattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]{0,63}$`)
+
+// fieldValues is the response of the fields endpoint.
+type fieldValues struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+
+	// Truncated is true if the field has more values than the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// fieldsHandler returns the distinct values of a journal field, sorted, for instance the units or the container IDs
+// in the journal, with sd_journal_query_unique. The values are read from the journal files, so the values of the
+// vacuumed entries may be listed. ?limit= caps the number of values, -max-limit by default.
+func fieldsHandler(w http.ResponseWriter, req *http.Request) {
+	field := mux.Vars(req)["field"]
+	if !fieldNamePattern.MatchString(field) {
+		logError(w, req, "invalid field name "+field, http.StatusBadRequest)
+		return
+	}
+
+	if middleware.RedactionRole(req).Hidden(field) {
+		logError(w, req, "field "+field+" is not visible", http.StatusForbidden)
+		return
+	}
+
+	limit := maxLimit(req)
+	if v := req.URL.Query().Get(limitParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			logError(w, req, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	j, err := jr.NewReader(nil, optJournalDirs(req))
+	if err != nil {
+		journalOpenError(w, req, j, err)
+		return
+	}
+	defer j.Close()
+
+	values, err := j.Journal.GetUniqueValues(field)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		logError(w, req, "unable to read the values of "+field+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	values = redact.Default().MaskValues(field, values)
+	sort.Strings(values)
+	resp := fieldValues{Field: field, Values: values}
+	if limit > 0 && len(values) > limit {
+		resp.Values, resp.Truncated = values[:limit], true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logrus.Errorf("Error writing to client: %s", err)
+	}
+}
@@ -0,0 +1,145 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// serveGoneSandbox checks if the requested sandbox was garbage collected by mesos agent and
+// responds with 410 Gone and the retention info. The function returns false if the sandbox still exists,
+// the agent state does not list its executor among the completed executors, for instance if an ID of the request
+// is wrong, or its state cannot be detected, in this case nothing is written to a client.
+func serveGoneSandbox(w http.ResponseWriter, req *http.Request) bool {
+	r, err := setupFilesAPIReader(req, "/files/browse")
+	if err != nil {
+		return false
+	}
+
+	// if the sandbox directory exists, the file is just missing.
+	if _, err := r.BrowseSandbox(); err != reader.ErrFileNotFound {
+		return false
+	}
+
+	state, err := userAgentState(req)
+	if err != nil {
+		logrus.Errorf("unable to get agent garbage collection info: %s", err)
+		return false
+	}
+
+	vars := mux.Vars(req)
+	msg, ok := gcMessage(state, vars["frameworkID"], vars["executorID"], vars["containerID"])
+	if !ok {
+		return false
+	}
+
+	logError(w, req, msg, http.StatusGone)
+	return true
+}
+
+// userAgentState reads the agent state with the token of the request, the agent filters the frameworks and the
+// executors by the permissions of the user.
+func userAgentState(req *http.Request) (*agent.State, error) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return nil, fmt.Errorf("invalid context, unable to retrieve %T object", cfg)
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		return nil, fmt.Errorf("invalid context, unable to retrieve %T object", client)
+	}
+
+	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+	if !ok {
+		return nil, fmt.Errorf("invalid context, unable to retrieve a %T object", nodeInfo)
+	}
+
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if token, ok := middleware.FromContextToken(req.Context()); ok {
+		header.Set("Authorization", token)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Second*5)
+	defer cancel()
+
+	return agent.GetState(ctx, client, *agentURL, header)
+}
+
+// gcMessage looks up the executor and agent gc_delay flag in the agent state to estimate when
+// the sandbox was garbage collected. It returns false if the agent state does not list the executor among the
+// completed executors, the sandbox of an unknown executor was not garbage collected.
+func gcMessage(state *agent.State, frameworkID, executorID, containerID string) (string, bool) {
+	executor, ok := completedExecutor(state, frameworkID, executorID, containerID)
+	if !ok {
+		return "", false
+	}
+
+	gcDelay, err := agent.ParseDuration(state.Flags["gc_delay"])
+	if err != nil {
+		logrus.Errorf("unable to parse gc_delay %q: %s", state.Flags["gc_delay"], err)
+		return "sandbox garbage collected", true
+	}
+
+	terminated, ok := executorTerminated(executor)
+	if !ok {
+		return fmt.Sprintf("sandbox garbage collected, agent keeps sandboxes for up to %s after the task terminates",
+			gcDelay), true
+	}
+
+	// the agent may remove sandboxes earlier than gc_delay if the disk usage is high.
+	collected := terminated.Add(gcDelay)
+	if now := time.Now(); collected.After(now) {
+		collected = now
+	}
+
+	return fmt.Sprintf("sandbox garbage collected at approximately %s, task terminated at %s, agent gc_delay %s",
+		collected.UTC().Format(time.RFC3339), terminated.UTC().Format(time.RFC3339), gcDelay), true
+}
+
+// completedExecutor returns the completed executor of a container listed by the agent state.
+func completedExecutor(state *agent.State, frameworkID, executorID, containerID string) (agent.Executor, bool) {
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		if framework.ID != frameworkID {
+			continue
+		}
+
+		for _, executor := range framework.CompletedExecutors {
+			if executor.ID == executorID && executor.Container == containerID {
+				return executor, true
+			}
+		}
+	}
+
+	return agent.Executor{}, false
+}
+
+// executorTerminated returns the time of the latest task status update of a completed executor.
+func executorTerminated(executor agent.Executor) (time.Time, bool) {
+	var latest float64
+	for _, task := range executor.CompletedTasks {
+		for _, status := range task.Statuses {
+			if status.Timestamp > latest {
+				latest = status.Timestamp
+			}
+		}
+	}
+
+	if latest == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(latest*float64(time.Second))), true
+}
@@ -0,0 +1,488 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// The Logs service of logs.proto, served with the HTTP/2 server of the standard library. A call is a request of
+// the journal or the task log handlers, the NDJSON lines of the response are sent as LogEntry messages.
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+const (
+	grpcPath = "/dcos.log.v1.Logs/{method}"
+
+	// grpcMaxRequestSize limits the request message, the requests are a few fields.
+	grpcMaxRequestSize = 1 << 20
+
+	// grpcMaxErrorSize limits the response of a failed request sent as the grpc-message.
+	grpcMaxErrorSize = 1024
+)
+
+// The gRPC status codes sent in the grpc-status trailer. https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcOK                 = 0
+	grpcUnknown            = 2
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// grpcHTTPCodes are the gRPC status codes of the error responses of the handlers, the other codes are UNKNOWN.
+var grpcHTTPCodes = map[int]int{
+	http.StatusBadRequest:            grpcInvalidArgument,
+	http.StatusUnauthorized:          grpcUnauthenticated,
+	http.StatusForbidden:             grpcPermissionDenied,
+	http.StatusNotFound:              grpcNotFound,
+	http.StatusGone:                  grpcNotFound,
+	http.StatusUnsupportedMediaType:  grpcFailedPrecondition,
+	http.StatusTooManyRequests:       grpcResourceExhausted,
+	http.StatusInternalServerError:   grpcInternal,
+	http.StatusNotImplemented:        grpcUnimplemented,
+	http.StatusBadGateway:            grpcUnavailable,
+	http.StatusServiceUnavailable:    grpcUnavailable,
+	http.StatusGatewayTimeout:        grpcUnavailable,
+	http.StatusRequestEntityTooLarge: grpcResourceExhausted,
+}
+
+var errInvalidProto = errors.New("invalid protobuf message")
+
+// InitGRPCRoutes inits the route of the gRPC Logs service on the root of the API, the calls are authorized like
+// the v2 endpoints they read.
+func InitGRPCRoutes(r *mux.Router, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) {
+	// the errors of the token verification are sent as the status of the call.
+	logs := limitCap(grpcLogsRouter())
+	if cfg.FlagJWTVerify {
+		logs = middleware.VerifyToken(logs, middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL))
+	}
+	r.Path(grpcPath).Handler(middleware.Wrapped(grpcLogsHandler(logs), cfg, client, nodeInfo)).Methods("POST")
+}
+
+// grpcLogsRouter routes the requests of the calls to the journal and the task log handlers. The task is found on
+// the master and its log is read from the agent through this node, like the discovery with ?proxy=true.
+func grpcLogsRouter() http.Handler {
+	r := mux.NewRouter()
+	r.Path(componentPath).HandlerFunc(journalHandler)
+	r.Path(path.Join(componentPath, "/{name}")).HandlerFunc(journalHandler)
+	r.Path(path.Join(discoverPath, "/file/{file}")).HandlerFunc(discoverHandler)
+	return r
+}
+
+// grpcLogsHandler serves a call of the Logs service with a GET request of logs, the stream methods follow the
+// journal or the file until the client cancels the call.
+func grpcLogsHandler(logs http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			logError(w, req, "content type must be application/grpc", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		msg, code, err := readGRPCRequest(req.Body)
+		if err != nil {
+			writeGRPCStatus(w, code, err.Error())
+			return
+		}
+
+		var target *url.URL
+		method := mux.Vars(req)["method"]
+		switch method {
+		case "RangeJournal", "StreamJournal":
+			target, err = journalTarget(msg)
+		case "RangeTaskFile", "StreamTaskFile":
+			target, err = taskFileTarget(msg)
+		default:
+			writeGRPCStatus(w, grpcUnimplemented, "unknown method "+method)
+			return
+		}
+
+		if err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+			return
+		}
+
+		if strings.HasPrefix(method, "Stream") {
+			query := target.Query()
+			query.Set(followParam, "true")
+			target.RawQuery = query.Encode()
+		}
+
+		// the request keeps the headers of the call, the token is read by the handlers.
+		logsReq := req.Clone(req.Context())
+		logsReq.Method = http.MethodGet
+		logsReq.URL = target
+		logsReq.RequestURI = target.RequestURI()
+		logsReq.Body = http.NoBody
+		logsReq.ContentLength = 0
+		logsReq.Header.Del("Content-Type")
+		logsReq.Header.Set("Accept", jr.ContentTypeNDJSON.String())
+
+		gw := &grpcResponseWriter{w: w, header: make(http.Header)}
+		logs.ServeHTTP(gw, logsReq)
+		gw.finish(req)
+	}
+}
+
+// journalTarget returns the component endpoint of a JournalRequest.
+func journalTarget(msg []byte) (*url.URL, error) {
+	target := &url.URL{Path: componentPath}
+	query := url.Values{}
+	err := decodeProto(msg, func(field int, v uint64, b []byte) {
+		switch field {
+		case 1:
+			target.Path = path.Join(componentPath, string(b))
+		case 2:
+			query.Add(filterParam, string(b))
+		case 3:
+			query.Set(queryParam, string(b))
+		case 4:
+			query.Set(levelParam, string(b))
+		case 5:
+			query.Set(cursorParam, string(b))
+		case 6:
+			query.Set(skipParam, strconv.FormatInt(int64(v), 10))
+		case 7:
+			query.Set(limitParam, strconv.FormatUint(v, 10))
+		case 8:
+			query.Set(sinceParam, string(b))
+		case 9:
+			query.Set(untilParam, string(b))
+		case 10:
+			query.Set(filterPatternParam, string(b))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	target.RawQuery = query.Encode()
+	return target, nil
+}
+
+// taskFileTarget returns the discovery endpoint of a TaskFileRequest, the task log is proxied from the agent.
+func taskFileTarget(msg []byte) (*url.URL, error) {
+	var taskID, file string
+	query := url.Values{}
+	query.Set(proxyParam, "true")
+	err := decodeProto(msg, func(field int, v uint64, b []byte) {
+		switch field {
+		case 1:
+			taskID = string(b)
+		case 2:
+			file = string(b)
+		case 3:
+			query.Set(cursorParam, string(b))
+		case 4:
+			query.Set(skipParam, strconv.FormatInt(int64(v), 10))
+		case 5:
+			query.Set(limitParam, strconv.FormatInt(int64(v), 10))
+		case 6:
+			query.Set(queryParam, string(b))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if taskID == "" {
+		return nil, errors.New("task_id is required")
+	}
+
+	if file == "" {
+		file = "stdout"
+	}
+
+	return &url.URL{Path: path.Join("/task", taskID, "file", file), RawQuery: query.Encode()}, nil
+}
+
+// readGRPCRequest reads the length-prefixed message of a call, the returned code is a gRPC status code to respond
+// with in case of an error.
+func readGRPCRequest(body io.Reader) ([]byte, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, grpcInternal, fmt.Errorf("unable to read the request message: %s", err)
+	}
+
+	if prefix[0] != 0 {
+		return nil, grpcUnimplemented, errors.New("compressed requests are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxRequestSize {
+		return nil, grpcResourceExhausted, fmt.Errorf("request message of %d bytes exceeds %d", size,
+			grpcMaxRequestSize)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, grpcInternal, fmt.Errorf("unable to read the request message: %s", err)
+	}
+	return msg, grpcOK, nil
+}
+
+// writeGRPCStatus ends a call without messages, the status is sent in the headers of the response.
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcLogLine is an NDJSON line of a journal entry or of a task log line.
+type grpcLogLine struct {
+	Fields             map[string]string `json:"fields"`
+	Cursor             string            `json:"cursor"`
+	MonotonicTimestamp uint64            `json:"monotonic_timestamp"`
+	RealtimeTimestamp  uint64            `json:"realtime_timestamp"`
+}
+
+// grpcResponseWriter sends the NDJSON lines written by a handler as LogEntry messages, every flush of the handler
+// flushes the messages. The body of an error response is kept and sent as the status of the call.
+type grpcResponseWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	code   int
+
+	// line is the start of a line not terminated yet, body is the body of an error response.
+	line []byte
+	body bytes.Buffer
+
+	// sent is set once the headers of the call are written, err is the error which ended the messages.
+	sent bool
+	err  error
+}
+
+func (g *grpcResponseWriter) Header() http.Header {
+	return g.header
+}
+
+func (g *grpcResponseWriter) WriteHeader(code int) {
+	if g.code == 0 {
+		g.code = code
+	}
+}
+
+func (g *grpcResponseWriter) Write(b []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	if g.code >= http.StatusMultipleChoices {
+		if room := grpcMaxErrorSize - g.body.Len(); room > 0 {
+			if room > len(b) {
+				room = len(b)
+			}
+			g.body.Write(b[:room])
+		}
+		return len(b), nil
+	}
+
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	g.line = append(g.line, b...)
+	for {
+		i := bytes.IndexByte(g.line, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := g.writeLine(g.line[:i]); err != nil {
+			g.err = err
+			return 0, err
+		}
+		g.line = g.line[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush sends the headers of the call and the messages, the headers of a stream are sent before its first entry.
+func (g *grpcResponseWriter) Flush() {
+	if g.code >= http.StatusMultipleChoices {
+		return
+	}
+
+	g.sendHeader()
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *grpcResponseWriter) sendHeader() {
+	if !g.sent {
+		g.w.Header().Set("Content-Type", "application/grpc")
+		g.w.WriteHeader(http.StatusOK)
+		g.sent = true
+	}
+}
+
+// writeLine sends an NDJSON line as a LogEntry message, the empty lines are skipped.
+func (g *grpcResponseWriter) writeLine(b []byte) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	var line grpcLogLine
+	if err := json.Unmarshal(b, &line); err != nil {
+		return fmt.Errorf("unable to decode a log line: %s", err)
+	}
+
+	g.sendHeader()
+	msg := encodeLogEntry(line)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := g.w.Write(append(frame, msg...))
+	return err
+}
+
+// finish sends the last line and the status of the call, in the trailers if messages were sent.
+func (g *grpcResponseWriter) finish(req *http.Request) {
+	if g.err == nil && g.code < http.StatusMultipleChoices && len(g.line) > 0 {
+		g.err = g.writeLine(g.line)
+	}
+
+	code, msg := grpcOK, ""
+	switch {
+	case g.code >= http.StatusMultipleChoices:
+		code, msg = grpcUnknown, strings.TrimSpace(g.body.String())
+		if c, ok := grpcHTTPCodes[g.code]; ok {
+			code = c
+		}
+	case req.Context().Err() != nil:
+		// the client went away, or the stream was closed by the shutdown of the server and the client reconnects
+		// to another instance.
+		code, msg = grpcUnavailable, "the call was closed by the server"
+	case g.err != nil:
+		code, msg = grpcInternal, g.err.Error()
+		logrus.Errorf("grpc call %s failed: %s", req.URL.Path, g.err)
+	}
+
+	if !g.sent {
+		writeGRPCStatus(g.w, code, msg)
+		return
+	}
+
+	g.w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		g.w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+// decodeProto calls fn with the fields of a protobuf message, v is the value of a varint or a fixed size field and
+// b the value of a length-delimited field. https://protobuf.dev/programming-guides/encoding/
+func decodeProto(msg []byte, fn func(field int, v uint64, b []byte)) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errInvalidProto
+		}
+		msg = msg[n:]
+
+		var (
+			v uint64
+			b []byte
+		)
+		switch key & 7 {
+		case 0:
+			v, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errInvalidProto
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return errInvalidProto
+			}
+			v, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errInvalidProto
+			}
+			b, msg = msg[n:n+int(size)], msg[n+int(size):]
+		case 5:
+			if len(msg) < 4 {
+				return errInvalidProto
+			}
+			v, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		default:
+			return errInvalidProto
+		}
+		fn(int(key>>3), v, b)
+	}
+	return nil
+}
+
+// protoBuffer writes the fields of a protobuf message.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	p.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (p *protoBuffer) uint64(field int, v uint64) {
+	if v != 0 {
+		p.varint(uint64(field << 3))
+		p.varint(v)
+	}
+}
+
+func (p *protoBuffer) bytes(field int, b []byte) {
+	p.varint(uint64(field<<3 | 2))
+	p.varint(uint64(len(b)))
+	p.Write(b)
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	p.varint(uint64(field<<3 | 2))
+	p.varint(uint64(len(s)))
+	p.WriteString(s)
+}
+
+// encodeLogEntry returns the protobuf encoding of the LogEntry of a line, the fields are sorted by name.
+func encodeLogEntry(line grpcLogLine) []byte {
+	names := make([]string, 0, len(line.Fields))
+	for name := range line.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &protoBuffer{}
+	for _, name := range names {
+		entry := &protoBuffer{}
+		entry.string(1, name)
+		entry.string(2, line.Fields[name])
+		p.bytes(1, entry.Bytes())
+	}
+
+	if line.Cursor != "" {
+		p.string(2, line.Cursor)
+	}
+	p.uint64(3, line.RealtimeTimestamp)
+	p.uint64(4, line.MonotonicTimestamp)
+	return p.Bytes()
+}
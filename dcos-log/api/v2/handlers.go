@@ -6,19 +6,28 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dcos/dcos-go/dcos"
+	"github.com/coreos/go-systemd/sdjournal"
 	"github.com/dcos/dcos-go/dcos/nodeutil"
 	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/authz"
 	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
 	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/query"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+	"github.com/dcos/dcos-log/dcos-log/transform"
+	"github.com/dcos/dcos-log/dcos-log/version"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
@@ -28,10 +37,39 @@ const (
 )
 
 const (
-	skipParam   = "skip"
-	cursorParam = "cursor"
-	limitParam  = "limit"
-	filterParam = "filter"
+	skipParam          = "skip"
+	cursorParam        = "cursor"
+	limitParam         = "limit"
+	filterParam        = "filter"
+	filterPatternParam = "filter_pattern"
+
+	stripANSIParam = "strip_ansi"
+	normalizeParam = "normalize"
+	coalesceParam  = "coalesce"
+	escapeParam    = "escape_control"
+	jsonFieldParam = "json_fields"
+	mlStartParam   = "multiline_start"
+	mlContParam    = "multiline_continuation"
+	timestampParam = "timestamps"
+	layoutParam    = "timestamp_layout"
+	namespaceParam = "namespace"
+	transcodeParam = "transcode"
+	explainParam   = "explain"
+	queryParam     = "q"
+	followParam    = "follow"
+	sinceParam     = "since"
+	untilParam     = "until"
+	fieldsParam    = "fields"
+	columnsParam   = "columns"
+	templateParam  = "template"
+	levelParam     = "level"
+	formatParam    = "format"
+	rawParam       = "raw"
+	delimiterParam = "delimiter"
+	bootParam      = "boot"
+	directionParam = "direction"
+	redirectParam  = "redirect"
+	integrityParam = "integrity"
 
 	cursorEndParam = "END"
 	cursorBegParam = "BEG"
@@ -41,6 +79,56 @@ const (
 	eventStreamContentType = "text/event-stream"
 )
 
+// cursorTrailer is a trailer of task log responses with the cursor of the position after the last sent line,
+// passed as ?cursor= it continues with the next line.
+const cursorTrailer = "X-Task-Log-Cursor"
+
+// formatContentType returns the content type of ?format= parameter of component endpoints, the parameter overrides
+// the request header Accept. The names are those of the registered journal formats, see jr.RegisterFormat, and
+// the plain text variants of newEntryFormatter.
+func formatContentType(name string) (jr.ContentType, bool) {
+	switch name {
+	case "template":
+		// the entries are formatted by the template of ?template= parameter.
+		return jr.ContentTypePlainText, true
+	case "color":
+		// the text lines are colored by the entry priority.
+		return jr.ContentTypePlainText, true
+	}
+
+	f, ok := jr.LookupFormat(name)
+	return f.ContentType, ok
+}
+
+// journalContentTypes returns the content types of the registered journal formats, the offers of component
+// endpoints negotiated by the request header Accept.
+func journalContentTypes() []string {
+	var contentTypes []string
+	for _, f := range jr.Formats() {
+		contentTypes = append(contentTypes, f.ContentType.String())
+	}
+	return contentTypes
+}
+
+// taskLogContentTypes are the offers of task log endpoints negotiated by the request header Accept.
+var taskLogContentTypes = []string{jr.ContentTypePlainText.String(), eventStreamContentType,
+	jr.ContentTypeNDJSON.String(), jr.ContentTypeGELF.String()}
+
+// followInterval is the interval a task log is polled for new lines with ?follow=true.
+const followInterval = time.Second
+
+// flushWriter flushes every write, so the lines of a followed file are sent as they are read.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
 type errSetupFilesAPIReader struct {
 	msg  string
 	code int
@@ -55,8 +143,41 @@ func logError(w http.ResponseWriter, req *http.Request, msg string, code int) {
 	logrus.Errorf("%s; http code: %d, request %s", msg, code, req.URL)
 }
 
+// authorizeTask checks the task authorization policy allows the user to read the sandbox of the request.
+func authorizeTask(req *http.Request) error {
+	return authorizeTaskPath(req, mux.Vars(req)["taskPath"])
+}
+
+// authorizeTaskPath checks the task authorization policy allows the user to read a task of the sandbox of the
+// request, taskPath is a task of a pod or empty.
+func authorizeTaskPath(req *http.Request, taskPath string) error {
+	vars := mux.Vars(req)
+	task := authz.Task{
+		FrameworkID: vars["frameworkID"],
+		ExecutorID:  vars["executorID"],
+		ContainerID: vars["containerID"],
+		TaskPath:    taskPath,
+	}
+
+	if uid := middleware.RequestUID(req); !authz.Default().Allowed(uid, task) {
+		return errSetupFilesAPIReader{
+			msg:  fmt.Sprintf("user %q is not allowed to read the logs of framework %s", uid, task.FrameworkID),
+			code: http.StatusForbidden,
+		}
+	}
+	return nil
+}
+
 func setupFilesAPIReader(req *http.Request, urlPath string, opts ...reader.Option) (r *reader.ReadManager, err error) {
+	if err := authorizeTask(req); err != nil {
+		return nil, err
+	}
+	return newFilesAPIReader(req, urlPath, opts...)
+}
 
+// newFilesAPIReader returns a reader of the sandbox of the request, the caller checks the task authorization
+// policy.
+func newFilesAPIReader(req *http.Request, urlPath string, opts ...reader.Option) (r *reader.ReadManager, err error) {
 	cfg, ok := middleware.FromContextConfig(req.Context())
 	if !ok {
 		return nil, errSetupFilesAPIReader{
@@ -81,11 +202,6 @@ func setupFilesAPIReader(req *http.Request, urlPath string, opts ...reader.Optio
 		}
 	}
 
-	scheme := "http"
-	if cfg.FlagAuth {
-		scheme = "https"
-	}
-
 	token, ok := middleware.FromContextToken(req.Context())
 	if !ok {
 		return nil, errSetupFilesAPIReader{
@@ -104,7 +220,27 @@ func setupFilesAPIReader(req *http.Request, urlPath string, opts ...reader.Optio
 	header := http.Header{}
 	header.Set("Authorization", token)
 
-	newOpts := []reader.Option{reader.OptHeaders(header)}
+	// the delays are validated on start.
+	retryDelay, _ := time.ParseDuration(cfg.FlagFilesAPIRetryDelay)
+	breakerCooldown, _ := time.ParseDuration(cfg.FlagFilesAPIBreakerCooldown)
+
+	newOpts := []reader.Option{reader.OptWorkDir(cfg.FlagMesosWorkDir), reader.OptHeaders(header),
+		reader.OptBinaryWindow(cfg.FlagBinaryWindow), reader.OptTranscode(boolParam(req, transcodeParam, cfg.FlagTranscode)), reader.OptStableCursors(cfg.FlagStableCursors),
+		reader.OptRetry(cfg.FlagFilesAPIRetries, retryDelay), reader.OptChunkSize(cfg.FlagFilesAPIChunkSize),
+		reader.OptReadAhead(cfg.FlagFilesAPIReadAhead), reader.OptMaxLineSize(cfg.FlagFilesAPIMaxLineSize),
+		reader.OptRotations(cfg.FlagFilesAPIRotations), reader.OptTruncateLines(cfg.FlagFilesAPITruncateLines),
+		reader.OptOperatorAPI(cfg.FlagFilesAPIOperator),
+		reader.OptCircuitBreaker(cfg.FlagFilesAPIBreakerFailures, breakerCooldown), reader.OptChunkCache(chunkCache),
+		reader.OptMaxScanBytes(cfg.FlagMaxScanBytes)}
+	if nestedContainerID := vars["nestedContainerID"]; nestedContainerID != "" {
+		newOpts = append(newOpts, reader.OptNestedContainer(nestedContainerID))
+	}
+
+	// the first reads are authorized with the token of the user, the service account only keeps reading the
+	// streams which outlive the token.
+	if serviceAccount != nil {
+		newOpts = append(newOpts, reader.OptRenewHeaderProvider(serviceAccount))
+	}
 	newOpts = append(newOpts, opts...)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -112,47 +248,80 @@ func setupFilesAPIReader(req *http.Request, urlPath string, opts ...reader.Optio
 
 	mesosID, err := nodeInfo.MesosID(nodeutil.NewContextWithHeaders(ctx, header))
 	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
 		return nil, errSetupFilesAPIReader{
 			msg:  "unable to get mesosID: " + err.Error(),
 			code: http.StatusInternalServerError,
 		}
 	}
 
-	ip, err := nodeInfo.DetectIP()
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
 	if err != nil {
 		return nil, errSetupFilesAPIReader{
 			msg:  "unable to run detect_ip: " + err.Error(),
 			code: http.StatusInternalServerError,
 		}
 	}
+	agentURL.Path = urlPath
 
-	masterURL := &url.URL{
-		Host:   net.JoinHostPort(ip.String(), strconv.Itoa(dcos.PortMesosAgent)),
-		Scheme: scheme,
-		Path:   urlPath,
-	}
-
-	formatter := reader.LineFormat
-	if req.Header.Get("Accept") == eventStreamContentType {
+	formatter, structured := reader.LineFormat, true
+	switch req.Header.Get("Accept") {
+	case eventStreamContentType:
 		formatter = reader.SSEFormat
+	case jr.ContentTypeNDJSON.String():
+		formatter = reader.NDJSONFormat
+	case jr.ContentTypeGELF.String():
+		// dcos-log runs on the agent the sandbox belongs to.
+		host, err := os.Hostname()
+		if err != nil {
+			host = mesosID
+		}
+		formatter = reader.GELFFormat(host)
+	default:
+		structured = false
 	}
 
-	return reader.NewLineReader(client, *masterURL, mesosID, frameworkID, executorID, containerID, taskPath, file, formatter,
-		newOpts...)
-}
+	if coalesce(req) {
+		formatter = reader.CoalesceFormat(formatter)
+	}
+	formatter = reader.TransformFormat(formatter, messageTransform(req))
+	formatter = reader.FieldsFormat(formatter, withRedaction(req, transform.Stages(transform.SourceSandbox)))
 
-func optLimit(limitStr string) ([]reader.Option, error) {
-	// return early on empty parameter
-	if limitStr == "" {
-		return nil, nil
+	// the fields of JSON lines are promoted before the stages and the redaction policy see the fields.
+	if structured && jsonFields(req) {
+		formatter = reader.JSONFieldsFormat(formatter)
 	}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse limit parameter. %s not an integer", limitStr)
+	// the requests to the agent are canceled once the client goes away.
+	r, err = reader.NewLineReaderContext(req.Context(), client, *agentURL, mesosID, frameworkID, executorID,
+		containerID, taskPath, file, formatter, newOpts...)
+	switch err {
+	case reader.ErrCircuitOpen:
+		return nil, errSetupFilesAPIReader{msg: err.Error(), code: http.StatusServiceUnavailable}
+	case reader.ErrScanLimit:
+		return nil, errSetupFilesAPIReader{msg: err.Error() + ", read the log in pages with cursor and skip " +
+			"parameters", code: http.StatusUnprocessableEntity}
 	}
+	return r, err
+}
 
-	return []reader.Option{reader.OptLines(limit)}, nil
+// agentErrorCode returns the status code of an error reading the files API of the agent: 404 if the file does not
+// exist, 403 if the agent rejected the credentials, 502 if the agent is unavailable, 503 if the circuit breaker of the
+// agent is open and 416 if the offset is out of range. Other errors are 500.
+func agentErrorCode(err error) int {
+	switch err {
+	case reader.ErrFileNotFound:
+		return http.StatusNotFound
+	case reader.ErrUnauthorized:
+		return http.StatusForbidden
+	case reader.ErrAgentUnavailable:
+		return http.StatusBadGateway
+	case reader.ErrCircuitOpen:
+		return http.StatusServiceUnavailable
+	case reader.ErrOffsetOutOfRange:
+		return http.StatusRequestedRangeNotSatisfiable
+	}
+	return http.StatusInternalServerError
 }
 
 func optCursor(cursorStr string) ([]reader.Option, error) {
@@ -169,34 +338,107 @@ func optCursor(cursorStr string) ([]reader.Option, error) {
 	default:
 	}
 
+	if strings.Contains(cursorStr, ".") {
+		cursor, err := reader.ParseCursor(cursorStr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse cursor parameter: %s", err)
+		}
+		return []reader.Option{reader.OptCursor(cursor)}, nil
+	}
+
 	cursor, err := strconv.Atoi(cursorStr)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse cursor parameter. %s not an integer", cursorStr)
+		return nil, paramError(cursorParam, cursorStr, "BEG, END, a cursor or an integer")
 	}
 
 	return []reader.Option{reader.OptOffset(cursor)}, nil
 }
 
-func optSkip(skipStr string) (opts []reader.Option, err error) {
-	// return early on empty parameter
-	if skipStr == "" {
+// delimiters are the values of ?delimiter= parameter of task log endpoints.
+var delimiters = map[string]string{
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"nul":  "\x00",
+}
+
+func optDelimiter(delimiterStr string) ([]reader.Option, error) {
+	if delimiterStr == "" {
+		return nil, nil
+	}
+
+	delimiter, ok := delimiters[delimiterStr]
+	if !ok {
+		return nil, fmt.Errorf("invalid delimiter parameter %q. Must be lf, crlf or nul", delimiterStr)
+	}
+	return []reader.Option{reader.OptDelimiter(delimiter)}, nil
+}
+
+// optMultiline returns the option merging the lines of multi-line records of ?multiline_start= or
+// ?multiline_continuation= pattern, the parameters override -multiline-start and -multiline-continuation flags.
+func optMultiline(req *http.Request) ([]reader.Option, error) {
+	var start, continuation string
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		start, continuation = cfg.FlagMultilineStart, cfg.FlagMultilineContinuation
+	}
+
+	query := req.URL.Query()
+	if _, ok := query[mlStartParam]; ok {
+		start, continuation = query.Get(mlStartParam), ""
+	}
+
+	if _, ok := query[mlContParam]; ok {
+		if _, ok := query[mlStartParam]; ok {
+			return nil, errors.New("multiline_start and multiline_continuation parameters cannot be used together")
+		}
+		start, continuation = "", query.Get(mlContParam)
+	}
+
+	var m reader.Multiline
+	switch {
+	case start != "":
+		re, err := regexp.Compile(start)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse multiline_start parameter: %s", err)
+		}
+		m.Start = re
+	case continuation != "":
+		re, err := regexp.Compile(continuation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse multiline_continuation parameter: %s", err)
+		}
+		m.Continuation = re
+	default:
 		return nil, nil
 	}
+	return []reader.Option{reader.OptMultiline(m)}, nil
+}
 
-	skip, err := strconv.Atoi(skipStr)
+// optTimestamps returns the options extracting the time of task log lines, enabled by ?timestamps=true, a
+// ?timestamp_layout= or ?since= and ?until= time range.
+func optTimestamps(req *http.Request) ([]reader.Option, error) {
+	query := req.URL.Query()
+	since, err := parseTimeParam(query.Get(sinceParam))
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse skip parameter. %s not an integer", skipStr)
+		return nil, errors.New("unable to parse since parameter: " + err.Error())
 	}
 
-	if skip != 0 {
-		opts = append(opts, reader.OptSkip(skip))
+	until, err := parseTimeParam(query.Get(untilParam))
+	if err != nil {
+		return nil, errors.New("unable to parse until parameter: " + err.Error())
 	}
 
-	if skip < 0 {
-		opts = append(opts, reader.OptReadDirection(reader.BottomToTop))
+	var opts []reader.Option
+	if layouts := query[layoutParam]; len(layouts) > 0 || boolParam(req, timestampParam, false) {
+		opts = append(opts, reader.OptTimestamps(layouts...))
 	}
 
-	return
+	if !since.IsZero() || !until.IsZero() {
+		if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+			return nil, errors.New("since must be before until")
+		}
+		opts = append(opts, reader.OptTimeRange(since, until))
+	}
+	return opts, nil
 }
 
 func lastEventIDHeader(lastEventID string) (reader.Option, bool, error) {
@@ -205,6 +447,14 @@ func lastEventIDHeader(lastEventID string) (reader.Option, bool, error) {
 		return nil, false, nil
 	}
 
+	if strings.Contains(lastEventID, ".") {
+		cursor, err := reader.ParseCursor(lastEventID)
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to parse Last-Event-ID header: %s", err)
+		}
+		return reader.OptCursor(cursor), true, nil
+	}
+
 	offset, err := strconv.Atoi(lastEventID)
 	if err != nil {
 		return nil, false, fmt.Errorf("unable to parse Last-Event-ID header. %s not an integer", lastEventID)
@@ -213,7 +463,58 @@ func lastEventIDHeader(lastEventID string) (reader.Option, bool, error) {
 	return reader.OptOffset(offset), true, nil
 }
 
+// optQuery returns a filter of the lines matching ?q= query. Sandbox lines have no priority and timestamp,
+// priority and since terms are rejected.
+func optQuery(queryStr string) ([]reader.Option, error) {
+	// return early on empty parameter
+	if queryStr == "" {
+		return nil, nil
+	}
+
+	q, err := query.Parse(queryStr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse q parameter: %s", err)
+	}
+
+	if q.Since != 0 || q.Priorities() != nil {
+		return nil, errors.New("unable to parse q parameter: since and priority terms are not supported by task logs")
+	}
+
+	return []reader.Option{reader.OptFilter(q.Match)}, nil
+}
+
 func buildOpts(req *http.Request) ([]reader.Option, error) {
+	queryOpts, err := optQuery(req.URL.Query().Get(queryParam))
+	if err != nil {
+		return nil, err
+	}
+
+	// the delimiter applies to resumed streams as well.
+	delimiterOpts, err := optDelimiter(req.URL.Query().Get(delimiterParam))
+	if err != nil {
+		return nil, err
+	}
+	queryOpts = append(queryOpts, delimiterOpts...)
+
+	multilineOpts, err := optMultiline(req)
+	if err != nil {
+		return nil, err
+	}
+	queryOpts = append(queryOpts, multilineOpts...)
+
+	// the time range applies to resumed streams as well.
+	timeOpts, err := optTimestamps(req)
+	if err != nil {
+		return nil, err
+	}
+	queryOpts = append(queryOpts, timeOpts...)
+
+	// the pagination parameters are validated even if they are ignored, the errors do not depend on the headers.
+	p, err := parsePagination(req.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
 	opt, ok, err := lastEventIDHeader(req.Header.Get("Last-Event-ID"))
 	if err != nil {
 		return nil, err
@@ -223,38 +524,70 @@ func buildOpts(req *http.Request) ([]reader.Option, error) {
 	// because it indicates the client has reconnected. The Last-Event-ID must have a higher
 	// precedence.
 	if ok {
-		return []reader.Option{opt}, nil
-	}
-
-	var collectedOpts []reader.Option
-	for _, paramFn := range []struct {
-		fn    func(string) ([]reader.Option, error)
-		param string
-	}{
-		{fn: optCursor, param: req.URL.Query().Get(cursorParam)},
-		{fn: optSkip, param: req.URL.Query().Get(skipParam)},
-		{fn: optLimit, param: req.URL.Query().Get(limitParam)},
-	} {
-		opts, err := paramFn.fn(paramFn.param)
-		if err != nil {
-			return nil, err
-		}
+		return append(queryOpts, opt), nil
+	}
+
+	// like the journal, skipping backwards without a cursor starts at the end: ?skip_prev=N reads the last N lines.
+	if p.cursor == "" && p.skip < 0 {
+		p.cursor = cursorEndParam
+	}
 
-		collectedOpts = append(collectedOpts, opts...)
+	cursorOpts, err := optCursor(p.cursor)
+	if err != nil {
+		return nil, err
 	}
 
-	return collectedOpts, nil
+	queryOpts = append(queryOpts, cursorOpts...)
+	return append(queryOpts, p.readerOptions()...), nil
 }
 
 func filesAPIHandler(w http.ResponseWriter, req *http.Request) {
+	negotiateAccept(req, taskLogContentTypes)
+
+	// byte reads bypass the line reader.
+	offset, length, byBytes, err := byteParams(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if byBytes {
+		serveFileBytes(w, req, offset, length)
+		return
+	}
+
 	opts, err := buildOpts(req)
 	if err != nil {
 		logError(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	follow := false
 	if req.Header.Get("Accept") == eventStreamContentType {
 		opts = append(opts, reader.OptStream(true))
+	} else if boolParam(req, followParam, false) {
+		follow = true
+		opts = append(opts, reader.OptFollow(followInterval), reader.OptFollowBackoff(followMaxInterval(req)))
+	}
+
+	raw := boolParam(req, rawParam, false)
+	if raw {
+		if req.Header.Get("Accept") == eventStreamContentType {
+			logError(w, req, "raw parameter cannot be used with "+eventStreamContentType, http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, reader.OptRaw())
+	}
+
+	if boolParam(req, explainParam, false) {
+		explainFiles(w, req, opts)
+		return
+	}
+
+	if req.Header.Get("Accept") != eventStreamContentType && !follow {
+		var cancel context.CancelFunc
+		req, cancel = withRangeDeadline(req)
+		defer cancel()
 	}
 
 	r, err := setupFilesAPIReader(req, "/files/read", opts...)
@@ -262,32 +595,74 @@ func filesAPIHandler(w http.ResponseWriter, req *http.Request) {
 	case nil:
 		break
 	case reader.ErrFileNotFound:
-		logError(w, req, "File not found", http.StatusNoContent)
+		if serveArchivedFile(w, req, false) || serveGoneSandbox(w, req) {
+			return
+		}
+		logError(w, req, "File not found", http.StatusNotFound)
+		return
+	case reader.ErrBinaryFile:
+		logError(w, req, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case reader.ErrCursorExpired:
+		logError(w, req, err.Error(), http.StatusGone)
 		return
 	default:
-		e, ok := err.(errSetupFilesAPIReader)
-		if !ok {
-			logError(w, req, "unable to initialize files API reader: "+err.Error(), http.StatusInternalServerError)
+		if deadlineExceeded(w, req, 0) {
 			return
 		}
 
-		logError(w, req, e.msg, e.code)
+		setupError(w, req, err)
 		return
 	}
 
 	if req.Header.Get("Accept") != eventStreamContentType {
+		out := io.Writer(w)
+		if f, ok := w.(http.Flusher); ok && follow {
+			w.Header().Set("X-Accel-Buffering", "no")
+			out = flushWriter{w: w, f: f}
+		}
+
+		switch accept := req.Header.Get("Accept"); {
+		case raw:
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case accept == jr.ContentTypeGELF.String(), accept == jr.ContentTypeNDJSON.String():
+			w.Header().Set("Content-Type", accept)
+		}
+
+		// the cursor of the next page is known after the lines are sent.
+		w.Header().Set("Trailer", cursorTrailer)
+		w.Header().Add("Trailer", partialTrailer)
+
+		var sent int64
 		for {
-			_, err := io.Copy(w, r)
+			n, err := io.Copy(out, r)
+			sent += n
+			if err != nil && deadlineExceeded(w, req, sent) {
+				// the client continues from the cursor of the partial result.
+				w.Header().Set(cursorTrailer, r.Cursor())
+				return
+			}
+
 			switch err {
 			case nil:
+				w.Header().Set(cursorTrailer, r.Cursor())
+				return
+			case context.Canceled:
 				return
 			case reader.ErrNoData:
 				continue
 			case reader.ErrFileNotFound:
+				if serveArchivedFile(w, req, false) || serveGoneSandbox(w, req) {
+					return
+				}
 				logError(w, req, "File not found", http.StatusNotFound)
 				return
+			case reader.ErrBinaryFile:
+				logError(w, req, err.Error(), http.StatusUnsupportedMediaType)
+				return
 			default:
-				logError(w, req, fmt.Sprintf("unexpected error while reading the logs: %s. Request: %s", err, req.RequestURI), http.StatusInternalServerError)
+				middleware.UpstreamError(req, middleware.UpstreamAgent)
+				logError(w, req, fmt.Sprintf("unexpected error while reading the logs: %s. Request: %s", err, req.RequestURI), agentErrorCode(err))
 				return
 			}
 		}
@@ -307,33 +682,55 @@ func filesAPIHandler(w http.ResponseWriter, req *http.Request) {
 		logError(w, req, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
 		return
 	}
-	notify := w.(http.CloseNotifier).CloseNotify()
+	hb := newHeartbeat(req)
 
 	f.Flush()
+
+	// the lines are sent by the queue, a slow client is handled by the backpressure policy.
+	queue, req := newStreamQueue(w, req)
+	defer queue.close()
+
+	poll := newPollBackoff(ssePollInterval, followMaxInterval(req))
+	delay := ssePollInterval
 	for {
 		select {
-		case <-notify:
+		case <-req.Context().Done():
 			{
 				logrus.Debugf("Closing a client connection. Request URI: %s", req.RequestURI)
 				return
 			}
-		case <-time.After(time.Microsecond * 100):
+		case <-time.After(delay):
 			{
-				_, err := io.Copy(w, r)
-				if err != nil && err != reader.ErrNoData {
+				n, err := io.Copy(queue, r)
+				delay = poll.next(n > 0)
+				if n > 0 {
+					hb.reset()
+				} else {
+					hb.beat(queue)
+				}
+				queue.checkpointDue()
+
+				if err == reader.ErrBinaryFile {
+					logrus.Errorf("%s. Request: %s", err, req.RequestURI)
+					return
+				}
+
+				// the stream is closed once the end of ?until= time range is read.
+				if r.RangeEnd() {
+					return
+				}
+
+				if err != nil && err != reader.ErrNoData && req.Context().Err() == nil {
+					middleware.UpstreamError(req, middleware.UpstreamAgent)
 					logrus.Errorf("error while reading the files API reader: %s. Request: %s", err, req.RequestURI)
 				}
-				f.Flush()
 			}
 		}
 	}
 }
 
-func redirectURL(id *nodeutil.CanonicalTaskID, file, RawQuery string, browse, download bool) (string, error) {
-	if browse && download {
-		return "", errors.New("browse and download are mutually excluded and cannot be used at the same time")
-	}
-
+// taskLogPath returns the path of the task log routes of a task, relative to the v2 API.
+func taskLogPath(id *nodeutil.CanonicalTaskID) string {
 	// find if the task is standalone of a pod.
 	isPod := id.ExecutorID != ""
 	executorID := id.ExecutorID
@@ -342,24 +739,33 @@ func redirectURL(id *nodeutil.CanonicalTaskID, file, RawQuery string, browse, do
 	}
 
 	// take the last element
-	taskID := id.ContainerIDs[len(id.ContainerIDs)-1]
-	taskLogURL := fmt.Sprintf("%s/%s/logs/v2/task/frameworks/%s/executors/%s/runs/%s", prefix, id.AgentID,
-		id.FrameworkID, executorID, taskID)
+	containerID := id.ContainerIDs[len(id.ContainerIDs)-1]
+	taskLogPath := fmt.Sprintf("/task/frameworks/%s/executors/%s/runs/%s", id.FrameworkID, executorID, containerID)
 
 	if isPod {
-		taskLogURL += path.Join("/tasks", id.ID)
+		taskLogPath += path.Join("/tasks", id.ID)
 	}
+	return taskLogPath
+}
 
+// taskEndpointPath returns the path of the endpoint the discovery resolves to, relative to the v2 API.
+func taskEndpointPath(id *nodeutil.CanonicalTaskID, file string, browse, download bool) string {
 	if browse {
-		taskLogURL = path.Join(taskLogURL, "/files/browse")
-	} else {
-		taskLogURL = path.Join(taskLogURL, file)
+		return path.Join(taskLogPath(id), "/files/browse")
+	}
 
-		if download {
-			taskLogURL = path.Join(taskLogURL, "/download")
-		}
+	if download {
+		return path.Join(taskLogPath(id), file, "/download")
+	}
+	return path.Join(taskLogPath(id), file)
+}
+
+func redirectURL(id *nodeutil.CanonicalTaskID, file, RawQuery string, browse, download bool) (string, error) {
+	if browse && download {
+		return "", errors.New("browse and download are mutually excluded and cannot be used at the same time")
 	}
 
+	taskLogURL := fmt.Sprintf("%s/%s/logs/v2%s", prefix, id.AgentID, taskEndpointPath(id, file, browse, download))
 	if RawQuery != "" {
 		taskLogURL += "?" + RawQuery
 	}
@@ -379,29 +785,38 @@ func downloadHandler(w http.ResponseWriter, req *http.Request) {
 	discover(w, req, false, true)
 }
 
-func discover(w http.ResponseWriter, req *http.Request, browse, download bool) {
-	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+// taskCacheTTL returns the duration of -task-cache-ttl, 0 if the cache is disabled.
+func taskCacheTTL(req *http.Request) time.Duration {
+	cfg, ok := middleware.FromContextConfig(req.Context())
 	if !ok {
-		logError(w, req, "invalid context, unable to retrieve a nodeInfo object", http.StatusInternalServerError)
-		return
+		return 0
 	}
 
-	vars := mux.Vars(req)
-	taskID := vars["taskID"]
-	file := vars["file"]
+	// validated on startup.
+	ttl, _ := time.ParseDuration(cfg.FlagTaskCacheTTL)
+	return ttl
+}
 
-	if file == "" {
-		file = "stdout"
+// taskCanonicalID finds a running or completed task by ID on behalf of the user who made the request, the tasks
+// and the unknown tasks are cached for -task-cache-ttl. The returned code is an http status code to respond with in
+// case of an error.
+func taskCanonicalID(req *http.Request, taskID string) (*nodeutil.CanonicalTaskID, int, error) {
+	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+	if !ok {
+		return nil, http.StatusInternalServerError, errors.New("invalid context, unable to retrieve a nodeInfo object")
 	}
 
 	if taskID == "" {
-		logError(w, req, "taskID is empty", http.StatusInternalServerError)
-		return
+		return nil, http.StatusInternalServerError, errors.New("taskID is empty")
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	_, span := tracing.Start(req.Context(), "discover task", tracing.KindInternal)
+	span.SetAttribute("task.id", taskID)
+	defer span.End()
+
 	// try to get the canonical ID for a running task first.
 	var (
 		canonicalTaskID *nodeutil.CanonicalTaskID
@@ -411,12 +826,24 @@ func discover(w http.ResponseWriter, req *http.Request, browse, download bool) {
 	// add headers to context
 	token, ok := middleware.FromContextToken(req.Context())
 	if !ok {
-		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
-		return
+		return nil, http.StatusUnauthorized, errors.New("unable to get authorization header from a request")
+	}
+
+	ttl := taskCacheTTL(req)
+	key := taskCacheKey(token, taskID)
+	if ttl > 0 {
+		if entry, ok := canonicalIDs.get(key); ok {
+			span.SetAttribute("task.cached", "true")
+			if entry.err != nil {
+				return nil, http.StatusInternalServerError, fmt.Errorf("unable to get canonical task ID: %s", entry.err)
+			}
+			return entry.id, http.StatusOK, nil
+		}
 	}
 
 	header := http.Header{}
 	header.Set("Authorization", token)
+	header.Set(tracing.TraceparentHeader, span.Context.Traceparent())
 	ctx = nodeutil.NewContextWithHeaders(ctx, header)
 
 	// TODO: expose this option to a user.
@@ -426,133 +853,693 @@ func discover(w http.ResponseWriter, req *http.Request, browse, download bool) {
 			break
 		}
 	}
+	span.SetError(err)
+
+	// the errors of the master are not cached, an unknown task is.
+	if ttl > 0 && (err == nil || err == nodeutil.ErrTaskNotFound) {
+		canonicalIDs.add(key, canonicalTaskID, err, ttl)
+	}
 
 	if err != nil {
-		errMsg := fmt.Sprintf("unable to get canonical task ID: %s", err)
-		logError(w, req, errMsg, http.StatusInternalServerError)
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		return nil, http.StatusInternalServerError, fmt.Errorf("unable to get canonical task ID: %s", err)
+	}
+
+	return canonicalTaskID, http.StatusOK, nil
+}
+
+func discover(w http.ResponseWriter, req *http.Request, browse, download bool) {
+	vars := mux.Vars(req)
+	taskID := vars["taskID"]
+	file := vars["file"]
+
+	if file == "" {
+		file = "stdout"
+	}
+
+	canonicalTaskID, code, err := taskCanonicalID(req, taskID)
+	if err != nil {
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	// ?redirect=, ?run= and ?proxy= are parameters of the discovery, they are not passed to the task log endpoint.
+	query := req.URL.Query()
+	redirect, run := boolParam(req, redirectParam, true), query.Get(runParam)
+	query.Del(redirectParam)
+	query.Del(runParam)
+	query.Del(proxyParam)
+
+	if run == "all" {
+		serveTaskRuns(w, req, canonicalTaskID, file, query.Encode(), browse, download)
+		return
+	}
+
+	canonicalTaskID, err = selectRun(canonicalTaskID, run)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	taskURL, err := redirectURL(canonicalTaskID, file, req.URL.RawQuery, browse, download)
+	taskURL, err := redirectURL(canonicalTaskID, file, query.Encode(), browse, download)
 	if err != nil {
 		errMsg := fmt.Sprintf("unable to build redirect URL: %s", err)
 		logError(w, req, errMsg, http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, req, taskURL, http.StatusSeeOther)
-}
+	if redirect && discoveryProxy(req) {
+		proxyTaskLog(w, req, canonicalTaskID, taskEndpointPath(canonicalTaskID, file, browse, download), query.Encode())
+		return
+	}
 
-func journalHandler(w http.ResponseWriter, req *http.Request) {
-	acceptHeader := req.Header.Get("Accept")
-	useSSE := acceptHeader == eventStreamContentType
+	if redirect {
+		http.Redirect(w, req, taskURL, http.StatusSeeOther)
+		return
+	}
 
-	// for streaming endpoints and SSE logs format we include id: CursorID before each log entry.
-	entryFormatter := jr.NewEntryFormatter(acceptHeader, useSSE)
-	var (
-		cursor string
-		err    error
-		opts   []jr.Option
-	)
+	// the header Accept selects the format of the task log, so the JSON response is requested with ?redirect=false.
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(newDiscoverResponse(canonicalTaskID, taskURL)); err != nil {
+		logrus.Errorf("unable to encode discovery response of %s: %s", taskID, err)
+	}
+}
 
-	if componentName := mux.Vars(req)["name"]; componentName != "" {
-		matches := []jr.JournalEntryMatch{
-			{
-				Field: "UNIT",
-				Value: componentName,
-			},
-			{
-				Field: "_SYSTEMD_UNIT",
-				Value: componentName,
-			},
-		}
+// discoverResponse is the response of the discovery endpoints with ?redirect=false, for the clients behind proxies
+// which do not follow redirects.
+type discoverResponse struct {
+	AgentID     string `json:"agent_id"`
+	FrameworkID string `json:"framework_id"`
+	ExecutorID  string `json:"executor_id"`
+	ContainerID string `json:"container_id"`
+	URL         string `json:"url"`
+}
 
-		opts = append(opts, jr.OptionMatchOR(matches))
+func newDiscoverResponse(id *nodeutil.CanonicalTaskID, taskURL string) discoverResponse {
+	// the executor of a standalone task has the task ID.
+	executorID := id.ExecutorID
+	if executorID == "" {
+		executorID = id.ID
 	}
 
-	// parse filters
-	if filters := req.URL.Query()[filterParam]; len(filters) > 0 {
-		var matches []jr.JournalEntryMatch
-		for _, filter := range filters {
-			filterArray := strings.Split(filter, ":")
-			if len(filterArray) != 2 {
-				logError(w, req, "incorrect filter parameter format, must be ?filer=key:value. Got "+filter, http.StatusBadRequest)
-				return
-			}
-
-			// all matches must uppercase
-			matches = append(matches, jr.JournalEntryMatch{
-				Field: strings.ToUpper(filterArray[0]),
-				Value: filterArray[1],
-			})
-		}
+	return discoverResponse{
+		AgentID:     id.AgentID,
+		FrameworkID: id.FrameworkID,
+		ExecutorID:  executorID,
+		ContainerID: id.ContainerIDs[len(id.ContainerIDs)-1],
+		URL:         taskURL,
+	}
+}
 
-		opts = append(opts, jr.OptionMatch(matches))
+// boolParam returns the value of a boolean query parameter or def if the parameter is not set or invalid.
+func boolParam(req *http.Request, name string, def bool) bool {
+	if v, err := strconv.ParseBool(req.URL.Query().Get(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// jsonContentType returns true if the messages are encoded as JSON strings in a given content type.
+func jsonContentType(contentType string) bool {
+	switch contentType {
+	case jr.ContentTypeApplicationJSON.String(), jr.ContentTypeEventStream.String(), jr.ContentTypeElasticBulk.String(),
+		jr.ContentTypeNDJSON.String():
+		return true
+	}
+	return false
+}
+
+// messageTransform returns the transformations of log messages requested by a client or enabled in config,
+// nil means the messages are sent as is. ?strip_ansi=true|false, ?normalize=true|false and
+// ?escape_control=true|false override -strip-ansi, -normalize and -escape-control flags.
+func messageTransform(req *http.Request) transform.Func {
+	var stripANSI, normalize, escape bool
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		stripANSI, normalize, escape = cfg.FlagStripANSI, cfg.FlagNormalize, cfg.FlagEscapeControl
+	}
+
+	var fns []transform.Func
+	if boolParam(req, stripANSIParam, stripANSI) {
+		fns = append(fns, transform.StripANSI)
+	}
+
+	if boolParam(req, normalizeParam, normalize) {
+		fns = append(fns, transform.NormalizeNewlines)
+
+		// JSON encoder escapes the control characters.
+		if !jsonContentType(req.Header.Get("Accept")) {
+			fns = append(fns, transform.StripControl)
+		}
+	}
+
+	// the sequences which were not stripped are shown escaped.
+	if boolParam(req, escapeParam, escape) {
+		fns = append(fns, transform.EscapeControl)
+	}
+	return transform.Chain(fns...)
+}
+
+// coalesce returns true if the runs of identical consecutive lines are collapsed, ?coalesce=true|false overrides
+// -coalesce flag.
+func coalesce(req *http.Request) bool {
+	var enabled bool
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		enabled = cfg.FlagCoalesce
+	}
+	return boolParam(req, coalesceParam, enabled)
+}
+
+// jsonFields returns true if the keys of JSON task log lines are promoted to fields, ?json_fields=true|false
+// overrides -json-fields flag.
+func jsonFields(req *http.Request) bool {
+	var enabled bool
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		enabled = cfg.FlagJSONFields
+	}
+	return boolParam(req, jsonFieldParam, enabled)
+}
+
+// transformFormatter wraps the formatter if the request needs the messages to be transformed or coalesced or there
+// are registered stages.
+func transformFormatter(req *http.Request, formatter jr.EntryFormatter) jr.EntryFormatter {
+	if coalesce(req) {
+		formatter = &jr.FormatCoalesce{EntryFormatter: formatter}
+	}
+
+	// the fields added by the enrichment are redacted like the journal fields.
+	pipeline := withRedaction(req, transform.Stages(transform.SourceJournal).Then(enrichment(req)))
+	fn := messageTransform(req)
+	if fn == nil && pipeline == nil {
+		return formatter
+	}
+	return jr.FormatTransform{EntryFormatter: formatter, Transform: fn, Pipeline: pipeline}
+}
+
+// fieldNames returns the journal fields selected by ?fields=MESSAGE,_PID parameter, nil if all fields are sent.
+func fieldNames(req *http.Request) []string {
+	var names []string
+	for _, value := range req.URL.Query()[fieldsParam] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, strings.ToUpper(name))
+			}
+		}
+	}
+	return names
+}
+
+// csvColumns returns the CSV columns selected by ?columns=timestamp,message,PRIORITY parameter, nil if the default
+// columns are sent.
+func csvColumns(req *http.Request) []string {
+	var columns []string
+	for _, value := range req.URL.Query()[columnsParam] {
+		for _, column := range strings.Split(value, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// newEntryFormatter returns a journal entry formatter for a given content type. CEF and LEEF formatters
+// use the field mapping from config, Elasticsearch bulk formatter uses the index from ?index= parameter,
+// JSON, NDJSON and SSE formatters send the fields selected by ?fields= parameter, CSV formatter the columns
+// selected by ?columns= parameter. Plain text with ?format=template uses the template of ?template= parameter,
+// ?format=color colors the lines by the entry priority.
+func newEntryFormatter(req *http.Request, contentType string, useCursorID bool) jr.EntryFormatter {
+	formatter := jr.NewEntryFormatter(contentType, useCursorID)
+	if contentType == jr.ContentTypePlainText.String() {
+		switch req.URL.Query().Get(formatParam) {
+		case "template":
+			// the template is validated by the handler.
+			if tpl, err := jr.ParseTemplate(req.URL.Query().Get(templateParam)); err == nil {
+				formatter = jr.FormatTemplate{Template: tpl}
+			}
+		case "color":
+			formatter = jr.FormatColor{}
+		}
+	}
+	switch f := formatter.(type) {
+	case *jr.FormatElasticBulk:
+		f.Index = req.URL.Query().Get("index")
+	case *jr.FormatJSON:
+		f.Fields = fieldNames(req)
+	case *jr.FormatSSE:
+		f.Fields = fieldNames(req)
+	case *jr.FormatNDJSON:
+		f.Fields = fieldNames(req)
+	case *jr.FormatCSV:
+		f.Columns = csvColumns(req)
+	}
+
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return transformFormatter(req, formatter)
+	}
+
+	// the mapping is validated on startup.
+	mapping, _ := jr.ParseFieldMapping(cfg.FlagSIEMFieldMapping)
+	switch f := formatter.(type) {
+	case *jr.FormatCEF:
+		f.Mapping = mapping
+		f.Version = version.Version
+	case *jr.FormatLEEF:
+		f.Mapping = mapping
+		f.Version = version.Version
+	}
+	return transformFormatter(req, formatter)
+}
+
+// withRedaction returns a pipeline which applies p, masks the values and removes the fields hidden from the request
+// user by the redaction policy, the fields added by the stages are redacted too.
+func withRedaction(req *http.Request, p transform.Pipeline) transform.Pipeline {
+	return p.Then(middleware.Redaction(req))
+}
+
+// optMaxEntrySize returns an option which truncates the journal entries larger than -max-entry-size.
+func optMaxEntrySize(req *http.Request) jr.Option {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return nil
+	}
+	return jr.OptionMaxEntrySize(cfg.FlagMaxEntrySize)
+}
+
+// optHeartbeat returns the journal reader option of -journal-heartbeat.
+func optHeartbeat(req *http.Request) jr.Option {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok || cfg.FlagJournalHeartbeat == "" {
+		return nil
+	}
+
+	// validated on startup.
+	d, _ := time.ParseDuration(cfg.FlagJournalHeartbeat)
+	return jr.OptionHeartbeat(d)
+}
+
+// optJournalDirs returns the option reading the journal directories of -journal-dirs instead of the local journal,
+// or the journal of the journald namespace of ?namespace=. It must be the first option of a reader.
+func optJournalDirs(req *http.Request) jr.Option {
+	if namespace := req.URL.Query().Get(namespaceParam); namespace != "" {
+		return jr.OptionNamespace(namespace)
+	}
+
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok || cfg.FlagJournalDirs == "" {
+		return nil
+	}
+	return jr.OptionDirectories(strings.Split(cfg.FlagJournalDirs, ",")...)
+}
+
+// journalQuery is a parsed request of journal entries.
+type journalQuery struct {
+	// componentMatches are joined with OR, matches are joined with AND.
+	componentMatches []jr.JournalEntryMatch
+	matches          []jr.JournalEntryMatch
+
+	cursor string
+	end    bool
+	limit  uint64
+	skip   int
+
+	// query is set by ?q= parameter, its field and priority terms are added to matches.
+	query *query.Query
+
+	// since and until are the time range set by ?since= and ?until=, zero if not set.
+	since, until time.Time
+
+	// pattern is a regular expression the messages must match, set by ?filter_pattern=.
+	pattern string
+
+	// boot is the offset of the boot set by ?boot=, 0 is the current boot. useBoot is false if ?boot= is not set
+	// or is a boot ID, which is added to matches.
+	boot    int
+	useBoot bool
+
+	// reverse reads the newest entries first, set by ?direction=desc.
+	reverse bool
+}
+
+// errReverseStream is returned for the streams with ?direction=desc, the new entries are always the newest.
+var errReverseStream = errors.New("direction=desc cannot be used with streams")
+
+// bootIDRegexp matches a boot ID, 128 bits in hex like /proc/sys/kernel/random/boot_id without dashes.
+var bootIDRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// matchesHeader is the response header of journal endpoints with the expression of the journald matches, so a
+// client sees how repeated filters were combined.
+const matchesHeader = "X-Journal-Matches"
+
+// earliestCursorHeader is the response header of a 410 response to a cursor which is no longer in the journal, with
+// the cursor of the earliest entry a client can continue from.
+const earliestCursorHeader = "X-Journal-Earliest-Cursor"
+
+// journalOpenError responds with the error of opening the journal reader j and closes it: 404 if the boot does not
+// exist, 410 Gone if the entry of the cursor is no longer in the journal and 500 otherwise. The 410 response has the
+// earliest cursor a client can continue from in the message and the X-Journal-Earliest-Cursor header.
+func journalOpenError(w http.ResponseWriter, req *http.Request, j *jr.Reader, err error) {
+	switch err {
+	case jr.ErrBootNotFound, jr.ErrNamespaceNotFound:
+		logError(w, req, err.Error(), http.StatusNotFound)
+	case jr.ErrInvalidNamespace:
+		logError(w, req, err.Error(), http.StatusBadRequest)
+	case jr.ErrCursorNotFound:
+		msg := err.Error()
+		if c, err := j.HeadCursor(); err == nil {
+			w.Header().Set(earliestCursorHeader, c)
+			msg += ", earliest available cursor: " + c
+		}
+		logError(w, req, msg, http.StatusGone)
+	default:
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		logError(w, req, "unable to open journald: "+err.Error(), http.StatusInternalServerError)
+	}
+
+	if j != nil && j.Journal != nil {
+		j.Close()
+	}
+}
+
+// parseJournalQuery parses the component name, filter, boot, level, since, until, direction, cursor, limit and skip
+// parameters and Last-Event-ID header.
+func parseJournalQuery(req *http.Request) (*journalQuery, error) {
+	q := &journalQuery{}
+	if componentName := mux.Vars(req)["name"]; componentName != "" {
+		q.componentMatches = []jr.JournalEntryMatch{
+			{
+				Field: "UNIT",
+				Value: componentName,
+			},
+			{
+				Field: "_SYSTEMD_UNIT",
+				Value: componentName,
+			},
+		}
+	}
+
+	// parse filters
+	for _, filter := range req.URL.Query()[filterParam] {
+		filterArray := strings.Split(filter, ":")
+		if len(filterArray) != 2 {
+			return nil, errors.New("incorrect filter parameter format, must be ?filer=key:value. Got " + filter)
+		}
+
+		// all matches must uppercase
+		q.matches = append(q.matches, jr.JournalEntryMatch{
+			Field: strings.ToUpper(filterArray[0]),
+			Value: filterArray[1],
+		})
+	}
+
+	// ?boot= selects a boot by its offset or ID, journalctl --list-boots shows both.
+	if boot := req.URL.Query().Get(bootParam); boot != "" {
+		if bootIDRegexp.MatchString(boot) {
+			q.matches = append(q.matches, jr.JournalEntryMatch{Field: "_BOOT_ID", Value: boot})
+		} else if offset, err := strconv.Atoi(boot); err == nil && offset <= 0 {
+			q.boot, q.useBoot = offset, true
+		} else {
+			return nil, paramError(bootParam, boot, "0, a negative integer or a boot ID")
+		}
+	}
+
+	// ?level= selects the priority and the more severe priorities, it narrows the priority terms of ?q=.
+	// 7 is debug, the lowest priority.
+	priorities := &query.Query{MaxPriority: 7}
+	if level := req.URL.Query().Get(levelParam); level != "" {
+		p, err := query.ParsePriority(level)
+		if err != nil {
+			return nil, errors.New("unable to parse level parameter: " + err.Error())
+		}
+		priorities.MaxPriority = p
+	}
+
+	if queryStr := req.URL.Query().Get(queryParam); queryStr != "" {
+		parsed, err := query.Parse(queryStr)
+		if err != nil {
+			return nil, errors.New("unable to parse q parameter: " + err.Error())
+		}
+
+		for _, m := range parsed.Matches {
+			q.matches = append(q.matches, jr.JournalEntryMatch{Field: m.Field, Value: m.Value})
+		}
+
+		if parsed.MaxPriority > priorities.MaxPriority {
+			parsed.MaxPriority = priorities.MaxPriority
+		}
+
+		if parsed.MinPriority > parsed.MaxPriority {
+			return nil, errors.New("level and priority terms of q parameter select no priority")
+		}
+		q.query, priorities = parsed, parsed
+	}
+
+	// the matches of the same field are joined with OR.
+	for _, p := range priorities.Priorities() {
+		q.matches = append(q.matches, jr.JournalEntryMatch{Field: "PRIORITY", Value: p})
+	}
+
+	if q.pattern = req.URL.Query().Get(filterPatternParam); q.pattern != "" {
+		if _, err := regexp.Compile(q.pattern); err != nil {
+			return nil, errors.New("unable to parse filter_pattern parameter: " + err.Error())
+		}
+	}
+
+	var err error
+	if q.since, err = parseTimeParam(req.URL.Query().Get(sinceParam)); err != nil {
+		return nil, errors.New("unable to parse since parameter: " + err.Error())
+	}
+
+	if q.until, err = parseTimeParam(req.URL.Query().Get(untilParam)); err != nil {
+		return nil, errors.New("unable to parse until parameter: " + err.Error())
+	}
+
+	if !q.since.IsZero() && !q.until.IsZero() && !q.since.Before(q.until) {
+		return nil, errors.New("since must be before until")
+	}
+
+	switch direction := req.URL.Query().Get(directionParam); direction {
+	case "", "asc":
+	case "desc":
+		q.reverse = true
+	default:
+		return nil, paramError(directionParam, direction, "asc or desc")
+	}
+
+	// the pagination parameters are validated even if they are ignored, the errors do not depend on the headers.
+	p, err := parsePagination(req.URL.Query())
+	if err != nil {
+		return nil, err
 	}
 
 	// we give priority to "Last-Event-ID" header over GET parameter.
 	lastEventID := req.Header.Get("Last-Event-ID")
 	if lastEventID != "" {
-		cursor = lastEventID
+		q.cursor = lastEventID
 	} else {
-		// get cursor parameter
-		cursor = req.URL.Query().Get(cursorParam)
+		q.cursor = p.cursor
 
 		// according to V2 API, BEG and END are valid cursors. And they are used in mesos files API reader.
 		// However journald API already implements the cursor movement with OptSkipPrev()
 		// ignore BEG and END options for now.
-		if cursor == cursorBegParam {
-			cursor = ""
-		} else if cursor == cursorEndParam {
-			opts = append(opts, jr.OptionSkipPrev(1))
-			cursor = ""
+		if q.cursor == cursorBegParam {
+			q.cursor = ""
+		} else if q.cursor == cursorEndParam {
+			q.end = true
+			q.cursor = ""
 		}
 
 		// parse the cursor parameter
-		if cursor != "" {
-			cursor, err = url.QueryUnescape(cursor)
+		if q.cursor != "" {
+			var err error
+			q.cursor, err = url.QueryUnescape(q.cursor)
 			if err != nil {
-				logError(w, req, "unable to un-escape cursor parameter: "+err.Error(), http.StatusBadRequest)
-				return
+				return nil, errors.New("unable to un-escape cursor parameter: " + err.Error())
 			}
 		}
 	}
 
-	if cursor != "" {
-		opts = append(opts, jr.OptionSeekCursor(cursor))
+	if q.cursor != "" {
+		if err := jr.ValidateCursor(q.cursor); err != nil {
+			return nil, errors.New("invalid cursor parameter: " + err.Error())
+		}
 	}
 
-	// parse the limit parameter
-	if limitStr := req.URL.Query().Get(limitParam); limitStr != "" {
-		limit, err := strconv.ParseUint(limitStr, 10, 64)
-		if err != nil {
-			logError(w, req, "unable to parse limit parameter: "+err.Error(), http.StatusBadRequest)
-			return
+	// a reconnected client continues right after the last entry it received, skip and limit of the initial
+	// request would send the entries around the cursor again.
+	if lastEventID != "" {
+		return q, nil
+	}
+
+	q.limit = uint64(p.limit)
+	q.skip = p.skip
+	return q, nil
+}
+
+// hiddenField returns a field of the filters hidden from a role, so the values of hidden fields cannot be probed.
+func (q *journalQuery) hiddenField(role *redact.Role) string {
+	for _, m := range q.matches {
+		if role.Hidden(m.Field) {
+			return m.Field
 		}
+	}
 
-		opts = append(opts, jr.OptionLimit(limit))
+	if q.query != nil && len(q.query.Text) > 0 && role.Hidden("MESSAGE") {
+		return "MESSAGE"
 	}
 
-	// parse skip parameter
-	if skipStr := req.URL.Query().Get(skipParam); skipStr != "" {
-		skip, err := strconv.Atoi(skipStr)
-		if err != nil {
-			logError(w, req, "unable to parse skip parameter: "+err.Error(), http.StatusBadRequest)
+	if q.pattern != "" && role.Hidden("MESSAGE") {
+		return "MESSAGE"
+	}
+	return ""
+}
+
+// options returns the journal reader options of the query.
+func (q *journalQuery) options() []jr.Option {
+	var opts []jr.Option
+	if len(q.componentMatches) > 0 {
+		opts = append(opts, jr.OptionMatchOR(q.componentMatches))
+	}
+
+	if len(q.matches) > 0 {
+		opts = append(opts, jr.OptionMatch(q.matches))
+	}
+
+	if q.useBoot {
+		opts = append(opts, jr.OptionBoot(q.boot))
+	}
+
+	if q.query != nil && len(q.query.Text) > 0 {
+		opts = append(opts, jr.OptionFilter(func(entry *sdjournal.JournalEntry) bool {
+			return q.query.Match(entry.Fields)
+		}))
+	}
+
+	if q.pattern != "" {
+		opts = append(opts, jr.OptionFilterPattern(q.pattern))
+	}
+
+	// the journal is read backwards from the end or from until, the matches reset the position so they come first.
+	if q.reverse {
+		opts = append(opts, jr.OptionReadReverse(true), jr.OptionSeekTail())
+	}
+
+	if q.query != nil && q.query.Since > 0 {
+		opts = append(opts, jr.OptionSince(q.query.Since))
+	}
+
+	if !q.since.IsZero() {
+		opts = append(opts, jr.OptionSinceTime(q.since))
+	}
+
+	if !q.until.IsZero() {
+		opts = append(opts, jr.OptionUntil(q.until))
+	}
+
+	if q.end {
+		opts = append(opts, jr.OptionSkipPrev(1))
+	}
+
+	if q.cursor != "" {
+		opts = append(opts, jr.OptionSeekCursor(q.cursor))
+	}
+
+	if q.limit > 0 {
+		opts = append(opts, jr.OptionLimit(q.limit))
+	}
+
+	if q.skip > 0 {
+		opts = append(opts, jr.OptionSkipNext(uint64(q.skip)))
+	} else if q.skip < 0 {
+		opts = append(opts, jr.OptionSkipPrev(uint64(-q.skip)))
+	}
+	return opts
+}
+
+// defaultFormat returns the format of a request without ?format= parameter which accepts any content type, set
+// by the option default-format.
+func defaultFormat(req *http.Request) string {
+	if accept := req.Header.Get("Accept"); accept != "" && accept != "*/*" {
+		return ""
+	}
+
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return ""
+	}
+	return cfg.FlagDefaultFormat
+}
+
+func journalHandler(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get(formatParam)
+	if format == "" {
+		format = defaultFormat(req)
+	}
+
+	if format != "" {
+		contentType, ok := formatContentType(format)
+		if !ok {
+			logError(w, req, "unknown format "+format, http.StatusBadRequest)
 			return
 		}
+		req.Header.Set("Accept", contentType.String())
+	} else {
+		negotiateAccept(req, journalContentTypes())
+	}
 
-		if skip > 0 {
-			opts = append(opts, jr.OptionSkipNext(uint64(skip)))
-		} else {
-			// make skip positive number
-			skip *= -1
-			opts = append(opts, jr.OptionSkipPrev(uint64(skip)))
+	if format == "template" {
+		if _, err := jr.ParseTemplate(req.URL.Query().Get(templateParam)); err != nil {
+			logError(w, req, "invalid template: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 
+	acceptHeader := req.Header.Get("Accept")
+	useSSE := acceptHeader == eventStreamContentType
+
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if field := q.hiddenField(middleware.RedactionRole(req)); field != "" {
+		logError(w, req, "field "+field+" is not visible", http.StatusForbidden)
+		return
+	}
+
+	if boolParam(req, explainParam, false) {
+		explainJournal(w, req, q)
+		return
+	}
+
+	// a followed response sends the entries of the request and then the new entries, like an SSE stream.
+	follow := !useSSE && boolParam(req, followParam, false)
+	if q.reverse && (useSSE || follow) {
+		logError(w, req, errReverseStream.Error(), http.StatusBadRequest)
+		return
+	}
+	if follow {
+		q.limit = 0
+	}
+
+	if !useSSE && !follow {
+		var cancel context.CancelFunc
+		req, cancel = withRangeDeadline(req)
+		defer cancel()
+	}
+
+	// for streaming endpoints and SSE logs format we include id: CursorID before each log entry.
+	entryFormatter := newEntryFormatter(req, acceptHeader, useSSE)
+	opts := append([]jr.Option{optJournalDirs(req)}, q.options()...)
+	opts = append(opts, jr.OptionContext(req.Context()), optMaxEntrySize(req), optHeartbeat(req))
+
+	_, openSpan := tracing.Start(req.Context(), "journal open", tracing.KindInternal)
 	j, err := jr.NewReader(entryFormatter, opts...)
+	openSpan.SetError(err)
+	openSpan.End()
 	if err != nil {
-		logError(w, req, "unable to open journald: "+err.Error(), http.StatusInternalServerError)
+		journalOpenError(w, req, j, err)
 		return
 	}
 	defer func() {
@@ -568,10 +1555,34 @@ func journalHandler(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Transfer-Encoding", "chunked")
+	if tree := jr.MatchTree(q.componentMatches, q.matches); tree != "" {
+		w.Header().Set(matchesHeader, tree)
+	}
+
+	serveJournal(w, req, j, useSSE, follow)
+}
+
+// serveJournal writes the entries of a journal reader: the entries of the request, then the new ones if follow is
+// set, or an event stream of the entries until the client goes away if useSSE is set.
+func serveJournal(w http.ResponseWriter, req *http.Request, j jr.EntryReader, useSSE, follow bool) {
+	if follow {
+		followJournal(w, req, j)
+		return
+	}
 
 	if !useSSE {
+		w.Header().Set("Trailer", partialTrailer)
+		_, readSpan := tracing.Start(req.Context(), "journal read", tracing.KindInternal)
 		b, err := io.Copy(w, j)
+		readSpan.SetAttribute("journal.bytes", strconv.FormatInt(b, 10))
+		readSpan.SetError(err)
+		readSpan.End()
+		if err != nil && deadlineExceeded(w, req, b) {
+			return
+		}
+
 		if err != nil {
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
 			logError(w, req, "unable to read the journal: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -584,26 +1595,71 @@ func journalHandler(w http.ResponseWriter, req *http.Request) {
 
 	w.Header().Set("X-Accel-Buffering", "no")
 	f := w.(http.Flusher)
-	notify := w.(http.CloseNotifier).CloseNotify()
 
 	f.Flush()
+
+	// the entries are sent by the queue, a slow client is handled by the backpressure policy.
+	queue, req := newStreamQueue(w, req)
+	defer queue.close()
+
 	for {
 		select {
-		case <-notify:
+		case <-req.Context().Done():
 			{
 				logrus.Debugf("closing a client connection.")
 				return
 			}
-		case <- time.After(time.Second):
-			err := j.Follow(time.Millisecond * 100, w)
+		case <-time.After(time.Second):
+			err := j.Follow(time.Millisecond*100, queue)
+			if err == jr.ErrRangeEnd {
+				return
+			}
+
+			// the entries written while the journal files were rotated may not have been read.
+			if j.Rotated() {
+				queue.gap(gapRotation)
+			}
+			queue.checkpointDue()
+
 			if err != nil {
+				if req.Context().Err() != nil {
+					logrus.Debugf("client went away. Request URI: %s", req.RequestURI)
+					return
+				}
+				middleware.UpstreamError(req, middleware.UpstreamJournald)
 				logrus.Errorf("error reading journal %s", err)
 				return
 			}
-			f.Flush()
 		}
 	}
+}
+
+// followJournal writes the entries of a journal reader and then the entries appended to the journal until the client
+// goes away. The replayed and the new entries are read by the same reader, so no entry is lost or sent twice between
+// them.
+func followJournal(w http.ResponseWriter, req *http.Request, j jr.EntryReader) {
+	var out io.Writer = w
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+		out = flushWriter{w: w, f: f}
+	}
+
+	for {
+		err := j.Follow(time.Millisecond*100, out)
+		if err == jr.ErrRangeEnd {
+			return
+		}
 
+		if err != nil {
+			if req.Context().Err() != nil {
+				logrus.Debugf("client went away. Request URI: %s", req.RequestURI)
+				return
+			}
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
+			logrus.Errorf("error reading journal %s", err)
+			return
+		}
+	}
 }
 
 func browseFiles(w http.ResponseWriter, req *http.Request) {
@@ -622,7 +1678,7 @@ func browseFiles(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		e, ok := err.(errSetupFilesAPIReader)
 		if !ok {
-			logError(w, req, err.Error(), http.StatusInternalServerError)
+			logError(w, req, err.Error(), agentErrorCode(err))
 			return
 		}
 
@@ -631,13 +1687,19 @@ func browseFiles(w http.ResponseWriter, req *http.Request) {
 	}
 
 	files, err := r.BrowseSandbox()
+	if err == reader.ErrFileNotFound && serveGoneSandbox(w, req) {
+		return
+	}
+
 	if err != nil {
-		logError(w, req, err.Error(), http.StatusInternalServerError)
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, err.Error(), agentErrorCode(err))
 		return
 	}
 
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
 	if err := json.NewEncoder(w).Encode(files); err != nil {
-		logError(w, req, fmt.Sprintf("unable to encode sandbox files: %s. Items: %s", err, files), http.StatusInternalServerError)
+		logError(w, req, fmt.Sprintf("unable to encode sandbox files: %s. Items: %v", err, files), http.StatusInternalServerError)
 		return
 	}
 }
@@ -654,11 +1716,16 @@ func downloadFile(w http.ResponseWriter, req *http.Request) {
 
 	opts := []reader.Option{reader.OptHeaders(header)}
 
+	// a range is read with the files API read endpoint, the download endpoint sends the entire file.
+	if req.Header.Get("Range") != "" && req.Header.Get("If-Range") == "" && serveFileRange(w, req, opts...) {
+		return
+	}
+
 	r, err := setupFilesAPIReader(req, "/files/download", opts...)
 	if err != nil {
 		e, ok := err.(errSetupFilesAPIReader)
 		if !ok {
-			logError(w, req, err.Error(), http.StatusInternalServerError)
+			logError(w, req, err.Error(), agentErrorCode(err))
 			return
 		}
 
@@ -668,19 +1735,167 @@ func downloadFile(w http.ResponseWriter, req *http.Request) {
 
 	downloadResp, err := r.Download()
 	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
 		logError(w, req, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer downloadResp.Body.Close()
 
-	for k, vs := range downloadResp.Header {
+	if downloadResp.StatusCode == http.StatusNotFound && (serveArchivedFile(w, req, true) || serveGoneSandbox(w, req)) {
+		return
+	}
+
+	if downloadResp.StatusCode == http.StatusOK {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	writeDownloadHeader(w, downloadResp, mux.Vars(req)["file"])
+
+	_, err = io.Copy(w, downloadResp.Body)
+	if err != nil {
+		logrus.Errorf("error raised while reading the download endpoint: %s", err)
+	}
+}
+
+// writeDownloadHeader writes the status and the headers of an agent download response. Content-Disposition and
+// Content-Length are set if the agent did not send them, so browsers save the file and clients can check its size.
+func writeDownloadHeader(w http.ResponseWriter, resp *http.Response, file string) {
+	for k, vs := range resp.Header {
 		for _, v := range vs {
 			w.Header().Add(k, v)
 		}
 	}
 
-	_, err = io.Copy(w, downloadResp.Body)
+	if resp.StatusCode == http.StatusOK {
+		if w.Header().Get("Content-Disposition") == "" && file != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file}))
+		}
+
+		if w.Header().Get("Content-Length") == "" && resp.ContentLength >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+}
+
+var (
+	// errInvalidByteRange is returned by parseByteRange if the Range header is not a single bytes range, such
+	// header is ignored and the entire file is sent.
+	errInvalidByteRange = errors.New("invalid Range header, must be bytes=first-last, bytes=first- or bytes=-suffix")
+
+	// errUnsatisfiableRange is returned by parseByteRange if the range starts after the end of the file.
+	errUnsatisfiableRange = errors.New("requested range not satisfiable")
+)
+
+// parseByteRange parses a Range: bytes=first-last header of a file with a given size and returns the offset
+// and the length of the range. Multiple ranges are not supported.
+func parseByteRange(header string, size int) (int, int, error) {
+	const unit = "bytes="
+	if !strings.HasPrefix(header, unit) || strings.Contains(header, ",") {
+		return 0, 0, errInvalidByteRange
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(header[len(unit):]), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errInvalidByteRange
+	}
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	// bytes=-suffix is the end of the file.
+	if first == "" {
+		suffix, err := strconv.Atoi(last)
+		if err != nil || suffix < 0 {
+			return 0, 0, errInvalidByteRange
+		}
+
+		if suffix == 0 || size == 0 {
+			return 0, 0, errUnsatisfiableRange
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, nil
+	}
+
+	offset, err := strconv.Atoi(first)
+	if err != nil || offset < 0 {
+		return 0, 0, errInvalidByteRange
+	}
+
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.Atoi(last); err != nil || end < offset {
+			return 0, 0, errInvalidByteRange
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if offset >= size {
+		return 0, 0, errUnsatisfiableRange
+	}
+	return offset, end - offset + 1, nil
+}
+
+// serveFileRange sends the range of a sandbox file requested with the Range header with 206 Partial Content. It
+// returns false if nothing was written, the entire file must be downloaded: the header is invalid or the file
+// was not found in the sandbox and may be archived.
+func serveFileRange(w http.ResponseWriter, req *http.Request, opts ...reader.Option) bool {
+	r, err := setupFilesAPIReader(req, "/files/read", opts...)
 	if err != nil {
-		logrus.Errorf("error raised while reading the download endpoint: %s", err)
+		e, ok := err.(errSetupFilesAPIReader)
+		if !ok {
+			logError(w, req, err.Error(), agentErrorCode(err))
+			return true
+		}
+
+		logError(w, req, e.msg, e.code)
+		return true
+	}
+
+	size, err := r.Size()
+	if err == reader.ErrFileNotFound {
+		return false
+	}
+
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, err.Error(), agentErrorCode(err))
+		return true
+	}
+
+	offset, length, err := parseByteRange(req.Header.Get("Range"), size)
+	if err == errInvalidByteRange {
+		return false
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if err == errUnsatisfiableRange {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	if max := maxRangeBytes(req); max > 0 && length > max {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, fmt.Sprintf("range of %d bytes exceeds the maximum of %d bytes, request smaller ranges", length,
+			max), http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	if file := mux.Vars(req)["file"]; file != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file}))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	w.Header().Set("Content-Length", strconv.Itoa(length))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if _, err := io.Copy(w, r.ReadRange(offset, length)); err != nil {
+		logrus.Errorf("error raised while reading range %d-%d of %s: %s", offset, offset+length-1, mux.Vars(req)["file"], err)
 	}
+	return true
 }
@@ -1,15 +1,49 @@
 package v2
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/archive"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/docker"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/merge"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
 	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/master"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/dcos/dcos-log/dcos-log/testutil"
+	"github.com/dcos/dcos-log/dcos-log/transform"
+	"github.com/dcos/dcos-log/dcos-log/version"
+	"github.com/dcos/dcos-log/dcos-log/websocket"
+	"github.com/gorilla/mux"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type filesAPIResponse struct {
@@ -22,19 +56,24 @@ func newFakeFilesAPIServer(t *testing.T) *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		data := serverResponse
+		offset := 0
 		offsetStr := r.URL.Query().Get("offset")
 		if offsetStr != "" {
-			offset, err := strconv.Atoi(offsetStr)
+			var err error
+			offset, err = strconv.Atoi(offsetStr)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			if offset > 0 {
+			// offset -1 is the size of the file.
+			if offset < 0 {
+				data, offset = "", len(serverResponse)
+			} else if offset > 0 {
 				data = data[offset:]
 			}
 		}
 		body, err := json.Marshal(&filesAPIResponse{
-			Offset: 0,
+			Offset: offset,
 			Data:   data,
 		})
 		if err != nil {
@@ -87,6 +126,29 @@ func TestBuildOpts(t *testing.T) {
 	}
 }
 
+func TestBuildOptsDelimiter(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?delimiter=nul", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file has no NUL, its content is a single line.
+	expectedResponse := "one\ntwo\nthree\nfour\nfive\n\n"
+	resp := makeRequest(req, t)
+	if resp != expectedResponse {
+		t.Fatalf("expect a single line. Got %q", resp)
+	}
+
+	req, err = http.NewRequest("GET", "/?delimiter=tab", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buildOpts(req); err == nil {
+		t.Fatal("expect an invalid delimiter error")
+	}
+}
+
 func TestBuildOptsWithLastEventID(t *testing.T) {
 	req, err := http.NewRequest("GET", "/?limit=2&skip=1&cursor=10", nil)
 	if err != nil {
@@ -103,6 +165,47 @@ func TestBuildOptsWithLastEventID(t *testing.T) {
 	}
 }
 
+func TestBuildOptsLastEventIDStream(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?skip=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a browser reconnects with the id of the last event it received, the id of "three" is 13.
+	req.Header.Set("Accept", eventStreamContentType)
+	req.Header.Set("Last-Event-ID", "13")
+
+	opts, err := buildOpts(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newFakeFilesAPIServer(t)
+	defer ts.Close()
+
+	testURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NewLineReader(&http.Client{}, *testURL, "a", "b", "c", "d", "f", "stdout", reader.SSEFormat,
+		append(opts, reader.OptStream(true))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if len(events) != 2 || !strings.HasPrefix(events[0], "id: 18\n") || !strings.Contains(events[0], `"MESSAGE":"four"`) ||
+		!strings.HasPrefix(events[1], "id: 23\n") {
+		t.Fatalf("expect the events after three. Got %s", body)
+	}
+}
+
 func TestBuildOptsCursor(t *testing.T) {
 	// cursor 18 stands for the last line "five\n"
 	req, err := http.NewRequest("GET", "/?cursor=18", nil)
@@ -142,3 +245,2362 @@ func TestBuildOptsSkip(t *testing.T) {
 		t.Fatalf("expect %s. Got %s", expectedResponse, resp)
 	}
 }
+
+func TestBuildOptsSkipNext(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?skip_next=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedResponse := "four\nfive\n"
+	resp := makeRequest(req, t)
+	if resp != expectedResponse {
+		t.Fatalf("expect %s. Got %s", expectedResponse, resp)
+	}
+}
+
+func TestBuildOptsSkipPrev(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?skip_prev=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a cursor the last lines are read.
+	expectedResponse := "four\nfive\n"
+	resp := makeRequest(req, t)
+	if resp != expectedResponse {
+		t.Fatalf("expect %s. Got %s", expectedResponse, resp)
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		expected pagination
+		err      string
+	}{
+		{query: "cursor=END&skip=-3&limit=2", expected: pagination{cursor: "END", skip: -3, limit: 2}},
+		{query: "skip_next=4", expected: pagination{skip: 4}},
+		{query: "skip_prev=4", expected: pagination{skip: -4}},
+		{query: "skip=one", err: `unable to parse skip parameter: must be an integer. Got "one"`},
+		{query: "limit=-1", err: `unable to parse limit parameter: must be a non-negative integer. Got "-1"`},
+		{query: "skip_prev=-1", err: `unable to parse skip_prev parameter: must be a non-negative integer. Got "-1"`},
+		{query: "skip=1&skip_prev=1", err: errSkipParams.Error()},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := parsePagination(query)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("%s: expect error %s. Got %v", tc.query, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil || p != tc.expected {
+			t.Fatalf("%s: expect %+v. Got %+v, %v", tc.query, tc.expected, p, err)
+		}
+	}
+}
+
+func TestWriteArchivedLines(t *testing.T) {
+	for _, tc := range []struct {
+		skip, limit int
+		expected    string
+	}{
+		{expected: "one\ntwo\nthree\nfour\nfive\n"},
+		{skip: 1, limit: 2, expected: "two\nthree\n"},
+		{skip: -2, expected: "four\nfive\n"},
+		{skip: -3, limit: 1, expected: "three\n"},
+	} {
+		buf := &bytes.Buffer{}
+		if err := writeArchivedLines(buf, strings.NewReader("one\ntwo\nthree\nfour\nfive\n"), tc.skip, tc.limit); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != tc.expected {
+			t.Fatalf("skip %d, limit %d: expect %q. Got %q", tc.skip, tc.limit, tc.expected, buf.String())
+		}
+	}
+}
+
+func TestExecutorTerminated(t *testing.T) {
+	state := &agent.State{
+		CompletedFrameworks: []agent.Framework{
+			{
+				ID: "framework",
+				CompletedExecutors: []agent.Executor{
+					{
+						ID:        "executor",
+						Container: "container",
+						CompletedTasks: []agent.Task{
+							{Statuses: []agent.Status{{Timestamp: 1500000000.5}, {Timestamp: 1500000010}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	executor, ok := completedExecutor(state, "framework", "executor", "container")
+	if !ok {
+		t.Fatal("expect executor to be found")
+	}
+
+	terminated, ok := executorTerminated(executor)
+	if !ok || terminated.Unix() != 1500000010 {
+		t.Fatalf("expect the latest status timestamp 1500000010. Got %d", terminated.Unix())
+	}
+
+	if _, ok := completedExecutor(state, "framework", "executor", "other"); ok {
+		t.Fatal("expect executor with different container not to be found")
+	}
+}
+
+func TestGCMessage(t *testing.T) {
+	state := &agent.State{
+		Flags: map[string]string{"gc_delay": "1weeks"},
+		Frameworks: []agent.Framework{
+			{
+				ID: "framework",
+				CompletedExecutors: []agent.Executor{
+					{ID: "executor", Container: "container"},
+				},
+				Executors: []agent.Executor{
+					{ID: "running", Container: "container"},
+				},
+			},
+		},
+	}
+
+	msg, ok := gcMessage(state, "framework", "executor", "container")
+	if !ok || !strings.Contains(msg, "agent keeps sandboxes for up to 168h0m0s") {
+		t.Fatalf("expect the garbage collection message of the completed executor. Got %q, %t", msg, ok)
+	}
+
+	// a wrong ID or a running executor is not a garbage collected sandbox, the response stays 404.
+	for _, ids := range [][3]string{
+		{"unknown", "executor", "container"},
+		{"framework", "typo", "container"},
+		{"framework", "executor", "typo"},
+		{"framework", "running", "container"},
+	} {
+		if msg, ok := gcMessage(state, ids[0], ids[1], ids[2]); ok {
+			t.Fatalf("expect %v not to be garbage collected. Got %q", ids, msg)
+		}
+	}
+}
+
+func TestContainerExecutor(t *testing.T) {
+	state := &agent.State{
+		Frameworks: []agent.Framework{
+			{ID: "framework", Executors: []agent.Executor{{ID: "executor", Container: "container"}}},
+		},
+	}
+
+	task, ok := containerExecutor(state, "container")
+	if !ok || task.FrameworkID != "framework" || task.ExecutorID != "executor" || task.ContainerID != "container" {
+		t.Fatalf("expect the executor of the container. Got %+v, %t", task, ok)
+	}
+
+	// a docker container which is not in the agent state of the user is not served.
+	if _, ok := containerExecutor(state, "other"); ok {
+		t.Fatal("expect an unknown container not to be found")
+	}
+}
+
+func TestAuthorizeDockerContainer(t *testing.T) {
+	// the system containers of the node are not launched by mesos, only the verified admins read their logs.
+	container := &docker.Container{ID: "abc", Name: "/dcos-system"}
+	for _, tc := range []struct {
+		cfg  *config.Config
+		uid  string
+		code int
+	}{
+		{&config.Config{FlagJWTVerify: true, FlagAdminUIDs: "bootstrapuser, ops"}, "ops", 0},
+		{&config.Config{FlagJWTVerify: true, FlagAdminUIDs: "bootstrapuser"}, "alice", http.StatusForbidden},
+		{&config.Config{FlagJWTVerify: true, FlagAdminUIDs: "bootstrapuser"}, "", http.StatusForbidden},
+		{&config.Config{FlagAdminUIDs: "bootstrapuser"}, "bootstrapuser", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/v2/docker/abc", nil)
+		ctx := middleware.WithConfigContext(req.Context(), tc.cfg)
+		if tc.uid != "" {
+			ctx = middleware.WithUIDContext(ctx, tc.uid)
+		}
+
+		if code, err := authorizeDockerContainer(req.WithContext(ctx), container); code != tc.code {
+			t.Fatalf("expect status %d for %q with %+v. Got %d, %v", tc.code, tc.uid, tc.cfg, code, err)
+		}
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	cfg := &config.Config{FlagArchiveURL: "file:///archive"}
+	req := httptest.NewRequest("GET", "/v2/version", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+
+	w := httptest.NewRecorder()
+	versionHandler(w, req)
+
+	var resp versionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Version != version.Version {
+		t.Fatalf("expect version %s. Got %s", version.Version, resp.Version)
+	}
+
+	var archive bool
+	for _, f := range resp.Features {
+		if f == "archiver" {
+			t.Fatal("archiver must not be enabled")
+		}
+		archive = archive || f == "archive-fallback"
+	}
+
+	if !archive {
+		t.Fatalf("expect archive-fallback feature. Got %v", resp.Features)
+	}
+}
+
+func TestParseK8sLogOptions(t *testing.T) {
+	now := time.Now()
+	query, _ := url.ParseQuery("follow=true&tailLines=10&sinceSeconds=60&timestamps=1&limitBytes=100")
+	opts, err := parseK8sLogOptions(query, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.container != "stdout" || !opts.follow || !opts.timestamps || opts.tailLines != 10 || opts.limitBytes != 100 {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+
+	if !opts.since.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("expect since %s. Got %s", now.Add(-time.Minute), opts.since)
+	}
+
+	for _, q := range []string{"previous=true", "tailLines=-1", "sinceSeconds=0", "sinceSeconds=1&sinceTime=2017-01-01T00:00:00Z", "follow=yes"} {
+		query, _ := url.ParseQuery(q)
+		if _, err := parseK8sLogOptions(query, now); err == nil {
+			t.Fatalf("expect error for %s", q)
+		}
+	}
+}
+
+func TestLimitWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &limitWriter{w: buf, n: 5}
+	if _, err := w.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("defg")); err != errLimitBytes {
+		t.Fatalf("expect errLimitBytes. Got %v", err)
+	}
+
+	if buf.String() != "abcde" {
+		t.Fatalf("expect abcde. Got %s", buf.String())
+	}
+}
+
+func TestParseTimeParam(t *testing.T) {
+	if tm, err := parseTimeParam(""); err != nil || !tm.IsZero() {
+		t.Fatalf("expect zero time. Got %s, %v", tm, err)
+	}
+
+	tm, err := parseTimeParam("1h")
+	if err != nil || time.Since(tm) < time.Hour || time.Since(tm) > time.Hour+time.Minute {
+		t.Fatalf("expect an hour ago. Got %s, %v", tm, err)
+	}
+
+	tm, err = parseTimeParam("-1h")
+	if err != nil || time.Since(tm) < time.Hour || time.Since(tm) > time.Hour+time.Minute {
+		t.Fatalf("expect an hour ago. Got %s, %v", tm, err)
+	}
+
+	tm, err = parseTimeParam("2017-01-02T03:04:05Z")
+	if err != nil || tm.Year() != 2017 {
+		t.Fatalf("expect 2017-01-02T03:04:05Z. Got %s, %v", tm, err)
+	}
+
+	if _, err := parseTimeParam("yesterday"); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestMessageTransform(t *testing.T) {
+	colored := "\x1b[31mred\x1b[0m"
+	for target, expected := range map[string]string{
+		"/v2/component":                  colored,
+		"/v2/component?strip_ansi=true":  "red",
+		"/v2/component?strip_ansi=false": colored,
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		output := colored
+		if fn := messageTransform(req); fn != nil {
+			output = fn(colored)
+		}
+
+		if output != expected {
+			t.Fatalf("%s: expect %q. Got %q", target, expected, output)
+		}
+	}
+
+	cfg := &config.Config{FlagStripANSI: true}
+	req := httptest.NewRequest("GET", "/v2/component", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+	if fn := messageTransform(req); fn == nil || fn(colored) != "red" {
+		t.Fatal("expect -strip-ansi to strip the escape sequences")
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?normalize=true", nil)
+	if output := messageTransform(req)("one\r\ntwo\x00\r"); output != "one\ntwo" {
+		t.Fatalf("expect normalized text. Got %q", output)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if output := messageTransform(req)("one\r\ntwo\x00\r"); output != "one\ntwo\x00" {
+		t.Fatalf("expect control characters to be kept for JSON. Got %q", output)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?filter=unit:dcos-marathon&filter=priority:3&skip=-10&limit=5", nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := explainQuery(req, q)
+	if strings.Join(e.Matches, ",") != "UNIT=dcos-marathon,PRIORITY=3" {
+		t.Fatalf("expect UNIT and PRIORITY matches. Got %v", e.Matches)
+	}
+
+	if e.MatchTree != "UNIT=dcos-marathon AND PRIORITY=3" {
+		t.Fatalf("expect UNIT and PRIORITY match tree. Got %s", e.MatchTree)
+	}
+
+	if e.Start != "tail" || e.Skip != -10 || e.Limit != 5 {
+		t.Fatalf("expect start tail, skip -10 and limit 5. Got %+v", e)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?filter=unit", nil)
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid filter error")
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?cursor=END", nil)
+	if q, err = parseJournalQuery(req); err != nil || !q.end || q.cursor != "" {
+		t.Fatalf("expect END cursor. Got %+v, %v", q, err)
+	}
+}
+
+func TestJournalQueryMultiUnit(t *testing.T) {
+	target := "/v2/component?filter=_SYSTEMD_UNIT:dcos-mesos-master.service" +
+		"&filter=_SYSTEMD_UNIT:dcos-adminrouter.service&filter=priority:3"
+	req := httptest.NewRequest("GET", target, nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "(_SYSTEMD_UNIT=dcos-mesos-master.service OR _SYSTEMD_UNIT=dcos-adminrouter.service) AND PRIORITY=3"
+	if e := explainQuery(req, q); e.MatchTree != expected {
+		t.Fatalf("expect %s. Got %s", expected, e.MatchTree)
+	}
+}
+
+func TestJournalQueryBoot(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?boot=-1", nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := explainQuery(req, q); e.Boot == nil || *e.Boot != -1 || len(e.Matches) != 0 {
+		t.Fatalf("expect the previous boot. Got %+v", e)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?boot=2c357020b6e54863a5ac9dee71d5872c", nil)
+	if q, err = parseJournalQuery(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := explainQuery(req, q); e.Boot != nil || e.MatchTree != "_BOOT_ID=2c357020b6e54863a5ac9dee71d5872c" {
+		t.Fatalf("expect a boot ID match. Got %+v", e)
+	}
+
+	for _, boot := range []string{"1", "previous", "2C357020"} {
+		req = httptest.NewRequest("GET", "/v2/component?boot="+boot, nil)
+		if _, err := parseJournalQuery(req); err == nil {
+			t.Fatalf("expect invalid boot %s error", boot)
+		}
+	}
+}
+
+func TestJournalQueryCursor(t *testing.T) {
+	cursor := "s=cea8150abb0543deaab113ed2f39b014;i=a;b=2c357020b6e54863a5ac9dee71d5872c;m=33ae9af;t=53e52ec99a8a6;x=b7899e663a8cd564"
+	req := httptest.NewRequest("GET", "/v2/component?cursor="+url.QueryEscape(cursor), nil)
+	q, err := parseJournalQuery(req)
+	if err != nil || q.cursor != cursor {
+		t.Fatalf("expect cursor %s. Got %+v, %v", cursor, q, err)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?cursor=s%3Dcea8150a%3Bi%3Da", nil)
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid cursor error")
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component", nil)
+	req.Header.Set("Last-Event-ID", "12")
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid Last-Event-ID error")
+	}
+}
+
+func TestJournalQueryDirection(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?direction=desc&until=2018-01-01T00:00:00Z", nil)
+	q, err := parseJournalQuery(req)
+	if err != nil || !q.reverse {
+		t.Fatalf("expect a reverse query. Got %+v, %v", q, err)
+	}
+
+	if e := explainQuery(req, q); e.Direction != "desc" || e.Start != "until" {
+		t.Fatalf("expect to read backwards from until. Got %+v", e)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?direction=asc", nil)
+	if q, err = parseJournalQuery(req); err != nil || q.reverse {
+		t.Fatalf("expect a forward query. Got %+v, %v", q, err)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?direction=up", nil)
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid direction error")
+	}
+
+	w := httptest.NewRecorder()
+	journalHandler(w, httptest.NewRequest("GET", "/v2/component?direction=desc&follow=true", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for a followed reverse read. Got %d", w.Code)
+	}
+}
+
+func TestJournalOpenError(t *testing.T) {
+	for err, code := range map[error]int{
+		jr.ErrBootNotFound:       http.StatusNotFound,
+		jr.ErrCursorNotFound:     http.StatusGone,
+		errors.New("no journal"): http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		journalOpenError(w, httptest.NewRequest("GET", "/v2/component", nil), &jr.Reader{}, err)
+		if w.Code != code {
+			t.Fatalf("expect %d for %s. Got %d", code, err, w.Code)
+		}
+	}
+}
+
+func TestJournalQuery(t *testing.T) {
+	target := `/v2/component?filter=container_id:c1&q=unit:dcos-marathon+priority<=err+"connection+refused"+since:1h`
+	req := httptest.NewRequest("GET", target, nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := explainQuery(req, q)
+	expected := "CONTAINER_ID=c1,_SYSTEMD_UNIT=dcos-marathon,PRIORITY=0,PRIORITY=1,PRIORITY=2,PRIORITY=3"
+	if matches := strings.Join(e.Matches, ","); matches != expected {
+		t.Fatalf("expect %s. Got %s", expected, matches)
+	}
+
+	if len(e.Text) != 1 || e.Text[0] != "connection refused" || e.Since != "1h0m0s" || e.Start != "since" {
+		t.Fatalf("expect text, since 1h and start since. Got %+v", e)
+	}
+
+	req = httptest.NewRequest("GET", `/v2/component?q=since:forever`, nil)
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid since error")
+	}
+}
+
+func TestOptQuery(t *testing.T) {
+	opts, err := optQuery(`"connection refused" file:stdout`)
+	if err != nil || len(opts) != 1 {
+		t.Fatalf("expect a filter option. Got %v, %v", opts, err)
+	}
+
+	for _, q := range []string{"since:1h", "priority<=err", `"unterminated`} {
+		if _, err := optQuery(q); err == nil {
+			t.Fatalf("expect error for %s", q)
+		}
+	}
+}
+
+func TestFanout(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token=abc" || r.URL.Query().Get("limit") != "2" {
+			t.Fatalf("expect Authorization header and query. Got %v %s", r.Header, r.URL)
+		}
+		w.Write([]byte(`{"fields":{"MESSAGE":"one"},"cursor":"c1","realtime_timestamp":1514764800000000}` + "\n"))
+		w.Write([]byte(`{"fields":{"MESSAGE":"two"},"cursor":"c2","realtime_timestamp":1514764800000001}` + "\n"))
+	}))
+	defer ok.Close()
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failed.Close()
+
+	var targets []fanoutTarget
+	for i, ts := range []*httptest.Server{ok, failed} {
+		u, err := url.Parse(ts.URL + "/system/v1/logs/v2/component/dcos-marathon?limit=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, fanoutTarget{agent: master.Agent{ID: fmt.Sprintf("S%d", i), Hostname: u.Host}, url: *u})
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "token=abc")
+	buf := &bytes.Buffer{}
+	fanout(context.Background(), &http.Client{}, targets, header, false, time.Second, &fanoutWriter{w: buf})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 2 entries and an error. Got %s", buf.String())
+	}
+
+	for _, expected := range []string{
+		`"agent_id":"S0"`, `"cursor":"c2"`, `"realtime_timestamp":1514764800000001`,
+		`"agent_id":"S1","error":"agent responded with status 502"`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("expect %s. Got %s", expected, buf.String())
+		}
+	}
+}
+
+func TestFanoutOrder(t *testing.T) {
+	var targets []fanoutTarget
+	for i, timestamps := range [][]int{{1, 4, 5}, {2, 3, 6}} {
+		entries := timestamps
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, usec := range entries {
+				fmt.Fprintf(w, `{"fields":{"MESSAGE":"%d"},"realtime_timestamp":%d}`+"\n", usec, usec)
+				w.(http.Flusher).Flush()
+				time.Sleep(10 * time.Millisecond)
+			}
+		}))
+		defer ts.Close()
+
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, fanoutTarget{agent: master.Agent{ID: fmt.Sprintf("S%d", i)}, url: *u})
+	}
+
+	buf := &bytes.Buffer{}
+	fanout(context.Background(), &http.Client{}, targets, nil, false, time.Minute, &fanoutWriter{w: buf})
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := struct {
+			Fields map[string]string `json:"fields"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, entry.Fields["MESSAGE"])
+	}
+
+	if strings.Join(messages, ",") != "1,2,3,4,5,6" {
+		t.Fatalf("expect entries ordered by time. Got %v", messages)
+	}
+}
+
+func TestMultiplex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "1" {
+			t.Fatalf("expect the query of the request. Got %s", r.URL)
+		}
+
+		if r.Header.Get("Accept") == eventStreamContentType {
+			fmt.Fprintf(w, "id: 4\ndata: {\"fields\":{\"MESSAGE\":\"%s\"}}\n\n", path.Base(r.URL.Path))
+			return
+		}
+		fmt.Fprintf(w, "%s\n", path.Base(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	a := master.Agent{ID: "S0", Hostname: host}
+	query := url.Values{"limit": {"1"}}
+
+	pod := &nodeutil.CanonicalTaskID{ID: "web", AgentID: "S0", FrameworkID: "f", ExecutorID: "e", ContainerIDs: []string{"c"}}
+	task := &nodeutil.CanonicalTaskID{ID: "db", AgentID: "S0", FrameworkID: "f", ContainerIDs: []string{"c2"}}
+
+	target := taskTarget(pod, "stdout", a, "http", port, query, false)
+	if expect := "/system/v1/logs/v2/task/frameworks/f/executors/e/runs/c/tasks/web/stdout"; target.url.Path != expect {
+		t.Fatalf("expect %s. Got %s", expect, target.url.Path)
+	}
+
+	targets := []fanoutTarget{target, taskTarget(task, "stderr", a, "http", port, query, false)}
+	buf := &bytes.Buffer{}
+	fanout(context.Background(), &http.Client{}, targets, http.Header{}, false, 0, &fanoutWriter{w: buf})
+
+	for _, expected := range []string{
+		`{"agent_id":"S0","fields":{"MESSAGE":"stdout"},"file":"stdout","hostname":"` + host + `","task_id":"web"}`,
+		`{"agent_id":"S0","fields":{"MESSAGE":"stderr"},"file":"stderr","hostname":"` + host + `","task_id":"db"}`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("expect %s. Got %s", expected, buf.String())
+		}
+	}
+
+	// the cursor of a task log stream is the id of the last event.
+	target = taskTarget(task, "stdout", a, "http", port, query, true)
+	merger := merge.NewMerger(0, func(merge.Entry) {})
+	cursor, err := readAgent(context.Background(), &http.Client{}, target, http.Header{}, true, "", merger)
+	if err != nil || cursor != "4" {
+		t.Fatalf("expect cursor 4. Got %s, %v", cursor, err)
+	}
+}
+
+func TestFrameworkLogs(t *testing.T) {
+	status := func(containerID string) []nodeutil.Status {
+		return []nodeutil.Status{{ContainerStatus: nodeutil.ContainerStatus{ContainerID: nodeutil.NestedValue{Value: containerID}}}}
+	}
+
+	ids := runningTasks([]nodeutil.Task{
+		{ID: "web.1", FrameworkID: "f", SlaveID: "S0", State: "TASK_RUNNING", Statuses: status("c1")},
+		{ID: "web.2", FrameworkID: "f", SlaveID: "S0", State: "TASK_FINISHED", Statuses: status("c2")},
+		{ID: "web.3", FrameworkID: "f", SlaveID: "S0", State: "TASK_RUNNING", Statuses: status("c3")},
+	})
+	if len(ids) != 2 || ids[0].ID != "web.1" || ids[1].ContainerIDs[0] != "c3" {
+		t.Fatalf("expect the running tasks web.1 and web.3. Got %+v", ids)
+	}
+
+	// the lines are ordered by the timestamps at the beginning of the lines.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/c1/") {
+			fmt.Fprint(w, "2018-01-01T00:00:01Z one\n2018-01-01T00:00:03Z three\n")
+			return
+		}
+		fmt.Fprint(w, "2018-01-01T00:00:02Z two\n2018-01-01T00:00:04.5Z four\n")
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	a := master.Agent{ID: "S0", Hostname: host}
+
+	var targets []fanoutTarget
+	for _, id := range ids {
+		targets = append(targets, taskTarget(id, "stdout", a, "http", port, url.Values{}, false))
+	}
+
+	buf := &bytes.Buffer{}
+	fanout(context.Background(), &http.Client{}, targets, http.Header{}, false, time.Second, &fanoutWriter{w: buf})
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Fields map[string]string `json:"fields"`
+			TaskID string            `json:"task_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, entry.TaskID+" "+strings.SplitN(entry.Fields["MESSAGE"], " ", 2)[1])
+	}
+
+	if expect := "web.1 one,web.3 two,web.1 three,web.3 four"; strings.Join(messages, ",") != expect {
+		t.Fatalf("expect %s. Got %s", expect, strings.Join(messages, ","))
+	}
+}
+
+func TestJournalQueryLastEventID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?skip=-10&limit=5&cursor=END", nil)
+	cursor := "s=cea8150abb0543deaab113ed2f39b014;i=1;b=2c357020b6e54863a5ac9dee71d5872c;m=33ae9af;t=53e52ec99a8a6;x=b7899e663a8cd564"
+	req.Header.Set("Last-Event-ID", cursor)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.cursor != cursor || q.skip != 0 || q.limit != 0 || q.end {
+		t.Fatalf("expect to continue after Last-Event-ID only. Got %+v", q)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	cfg := &config.Config{FlagSandboxHeartbeat: "1h", FlagSandboxHeartbeatPayload: `{"type":"heartbeat"}`}
+	req := httptest.NewRequest("GET", "/v2/task", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+
+	buf := &bytes.Buffer{}
+	hb := newHeartbeat(req)
+	if hb.beat(buf) || buf.Len() != 0 {
+		t.Fatalf("expect no heartbeat before the interval. Got %s", buf.String())
+	}
+
+	hb.last = time.Now().Add(-time.Hour)
+	if !hb.beat(buf) || buf.String() != "event: heartbeat\ndata: {\"type\":\"heartbeat\"}\n\n" {
+		t.Fatalf("expect heartbeat event. Got %s", buf.String())
+	}
+
+	hb = &heartbeat{interval: time.Second, last: time.Now().Add(-time.Minute)}
+	buf.Reset()
+	if !hb.beat(buf) || buf.String() != ": ping\n\n" {
+		t.Fatalf("expect ping comment. Got %s", buf.String())
+	}
+
+	if (&heartbeat{last: time.Now().Add(-time.Hour)}).beat(buf) {
+		t.Fatal("expect zero interval to disable heartbeats")
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	policy, err := redact.Parse([]byte(`{"roles": [
+	  {"name": "operators", "uids": ["bootstrapuser"], "hide": []},
+	  {"name": "default", "hide": ["_CMDLINE", "*_ADDR"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redact.SetDefault(policy)
+	defer redact.SetDefault(nil)
+
+	token := func(uid string) string {
+		return "token=e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"`+uid+`"}`)) + ".sig"
+	}
+
+	req := httptest.NewRequest("GET", "/v2/component?filter=_CMDLINE:app", nil)
+	req.Header.Set("Authorization", token("alice"))
+	w := httptest.NewRecorder()
+	journalHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expect status 403 filtering by a hidden field. Got %d", w.Code)
+	}
+
+	f := transformFormatter(req, jr.FormatJSON{})
+	b, err := f.FormatEntry(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "hello", "_CMDLINE": "app --secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), "_CMDLINE") || !strings.Contains(string(b), "hello") {
+		t.Fatalf("expect _CMDLINE to be hidden. Got %s", b)
+	}
+
+	req.Header.Set("Authorization", token("bootstrapuser"))
+	if q, _ := parseJournalQuery(req); q.hiddenField(middleware.RedactionRole(req)) != "" {
+		t.Fatal("expect all fields visible to operators")
+	}
+
+	if withRedaction(req, nil) != nil {
+		t.Fatal("expect no hook for operators")
+	}
+
+	transform.RegisterStage("drop-debug", func(source string, fields map[string]string) bool {
+		fields["_CMDLINE"] = "app --secret"
+		return fields["PRIORITY"] != "7"
+	})
+	defer transform.UnregisterHook("drop-debug")
+
+	req.Header.Set("Authorization", token("alice"))
+	f = transformFormatter(req, jr.FormatJSON{})
+	if b, err = f.FormatEntry(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "hi", "PRIORITY": "7"}}); err != nil || len(b) != 0 {
+		t.Fatalf("expect the entry to be dropped. Got %s", b)
+	}
+
+	if b, err = f.FormatEntry(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "hi"}}); err != nil || strings.Contains(string(b), "_CMDLINE") {
+		t.Fatalf("expect the field added by a stage to be redacted. Got %s", b)
+	}
+}
+
+func TestFlushWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := flushWriter{w: rec, f: rec}
+	if _, err := w.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.Flushed {
+		t.Fatal("expect the response to be flushed")
+	}
+
+	if rec.Body.String() != "one\n" {
+		t.Fatalf("expect one. Got %s", rec.Body.String())
+	}
+}
+
+func TestEntryWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out := &combinedWriter{w: buf}
+
+	one := &entryWriter{out: out, label: "one"}
+	two := &entryWriter{out: out, label: "two"}
+	one.Write([]byte("a\nb"))
+	two.Write([]byte("c\n"))
+	one.Write([]byte("\n"))
+
+	expect := "[one] a\n[two] c\n[one] b\n"
+	if buf.String() != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf.String())
+	}
+
+	buf.Reset()
+	sse := &entryWriter{out: out, label: "one", sse: true}
+	sse.Write([]byte("id: 1\ndata: {}\n"))
+	if buf.Len() != 0 {
+		t.Fatalf("expect an incomplete entry to be buffered. Got %q", buf.String())
+	}
+
+	sse.Write([]byte("\n"))
+	if buf.String() != "id: one=1\ndata: {}\n\n" {
+		t.Fatalf("expect an SSE entry with the id of its source. Got %q", buf.String())
+	}
+
+	buf.Reset()
+	other := &entryWriter{out: out, label: "two", sse: true}
+	other.Write([]byte(": heartbeat\n\nid: 7\ndata: {}\n\n"))
+	if buf.String() != ": heartbeat\n\nid: one=1&two=7\ndata: {}\n\n" {
+		t.Fatalf("expect an SSE entry with the ids of all sources. Got %q", buf.String())
+	}
+}
+
+func TestCombinedOpts(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?cursor=END&skip_prev=10", nil)
+	req.Header.Set("Accept", eventStreamContentType)
+	req.Header.Set("Last-Event-ID", "stderr=12&stdout=34")
+
+	opts, sse, _, err := combinedOpts(req)
+	if err != nil || !sse {
+		t.Fatalf("expect an SSE stream. Got %t, %v", sse, err)
+	}
+
+	// the common options are the query and stream options, a resumed source has the option of its id.
+	if n := len(opts("stderr")); n != len(opts("other"))+1 {
+		t.Fatalf("expect stderr to be resumed. Got %d options, %d without an id", n, len(opts("other")))
+	}
+
+	if req.Header.Get("Last-Event-ID") != "stderr=12&stdout=34" {
+		t.Fatalf("expect the request to be unchanged. Got %s", req.Header.Get("Last-Event-ID"))
+	}
+
+	req.Header.Set("Last-Event-ID", "stdout=abc")
+	if _, _, _, err := combinedOpts(req); err == nil {
+		t.Fatal("expect an invalid Last-Event-ID error")
+	}
+}
+
+func TestReadCombined(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]string{"stdout": "out one\nout two\n", "stderr": "err one\n"}[path.Base(r.URL.Query().Get("path"))]
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset > len(data) {
+			offset = len(data)
+		}
+		json.NewEncoder(w).Encode(&filesAPIResponse{Offset: offset, Data: data[offset:]})
+	}))
+	defer ts.Close()
+
+	testURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []combinedSource
+	for _, file := range multiplexFiles {
+		r, err := reader.NewLineReader(&http.Client{}, *testURL, "a", "b", "c", "d", "", "stdout", reader.LineFormat,
+			reader.OptFile(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, combinedSource{label: file, r: r})
+	}
+
+	buf := &bytes.Buffer{}
+	readCombined(context.Background(), sources, &combinedWriter{w: buf}, false, 0)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	expect := []string{"[stderr] err one", "[stdout] out one", "[stdout] out two"}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %s. Got %s", expect, lines)
+	}
+}
+
+func TestOptMultiline(t *testing.T) {
+	for query, n := range map[string]int{
+		"":                             0,
+		"?multiline_start=^\\d{4}":     1,
+		"?multiline_continuation=^\\s": 1,
+		"?multiline_start=":            0,
+		"?multiline_start=(":           -1,
+		"?multiline_start=a&multiline_continuation=b": -1,
+	} {
+		opts, err := optMultiline(httptest.NewRequest("GET", "/"+query, nil))
+		if n < 0 && err == nil {
+			t.Fatalf("expect an error of %s", query)
+		}
+
+		if n >= 0 && (err != nil || len(opts) != n) {
+			t.Fatalf("expect %d options of %s. Got %d, %v", n, query, len(opts), err)
+		}
+	}
+}
+
+func TestOptTimestamps(t *testing.T) {
+	for query, n := range map[string]int{
+		"":                                     0,
+		"?timestamps=true":                     1,
+		"?timestamp_layout=15:04:05":           1,
+		"?since=1h&until=2018-01-01T00:00:00Z": -1,
+		"?since=2h&until=1h&timestamps=true":   2,
+		"?until=yesterday":                     -1,
+	} {
+		opts, err := optTimestamps(httptest.NewRequest("GET", "/"+query, nil))
+		if n < 0 && err == nil {
+			t.Fatalf("expect an error of %s", query)
+		}
+
+		if n >= 0 && (err != nil || len(opts) != n) {
+			t.Fatalf("expect %d options of %s. Got %d, %v", n, query, len(opts), err)
+		}
+	}
+
+	entry := map[string]interface{}{"fields": map[string]interface{}{"TIMESTAMP": "2018-01-01T00:00:01Z",
+		"MESSAGE": "2017-01-01T00:00:00Z the message time"}}
+	if ts := messageTime(entry); !ts.Equal(time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC)) {
+		t.Fatalf("expect the TIMESTAMP field to be preferred. Got %s", ts)
+	}
+}
+
+func TestIntRangeParam(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?context=3&limit=0", nil)
+	if n, err := intRangeParam(req, contextParam, 0, 0, searchMaxContext); err != nil || n != 3 {
+		t.Fatalf("expect context 3. Got %d, %v", n, err)
+	}
+
+	if _, err := intRangeParam(req, limitParam, searchDefaultLimit, 1, searchMaxLimit); err == nil {
+		t.Fatal("expect an invalid limit error")
+	}
+
+	if n, err := intRangeParam(req, skipParam, 7, 0, 10); err != nil || n != 7 {
+		t.Fatalf("expect the default 7. Got %d, %v", n, err)
+	}
+}
+
+func TestWriteDownloadHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/octet-stream"}},
+		ContentLength: 42}
+	writeDownloadHeader(rec, resp, "core dump")
+
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="core dump"` {
+		t.Fatalf("expect attachment. Got %s", cd)
+	}
+
+	if cl := rec.Header().Get("Content-Length"); cl != "42" {
+		t.Fatalf("expect content length 42. Got %s", cl)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Fatalf("expect the agent content type. Got %s", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	writeDownloadHeader(rec, &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, ContentLength: -1}, "stdout")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("expect 404 without attachment. Got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	for _, tc := range []struct {
+		header         string
+		offset, length int
+		err            error
+	}{
+		{"bytes=0-9", 0, 10, nil},
+		{"bytes=10-", 10, 90, nil},
+		{"bytes=90-200", 90, 10, nil},
+		{"bytes=-20", 80, 20, nil},
+		{"bytes=-200", 0, 100, nil},
+		{"bytes=100-", 0, 0, errUnsatisfiableRange},
+		{"bytes=-0", 0, 0, errUnsatisfiableRange},
+		{"bytes=9-0", 0, 0, errInvalidByteRange},
+		{"bytes=0-1,5-6", 0, 0, errInvalidByteRange},
+		{"lines=0-1", 0, 0, errInvalidByteRange},
+		{"bytes=a-", 0, 0, errInvalidByteRange},
+	} {
+		offset, length, err := parseByteRange(tc.header, 100)
+		if err != tc.err || offset != tc.offset || length != tc.length {
+			t.Fatalf("%s: expect %d, %d, %v. Got %d, %d, %v", tc.header, tc.offset, tc.length, tc.err, offset, length, err)
+		}
+	}
+}
+
+func TestJournalQueryTimeRange(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?since=2017-01-02T03:04:05Z&until=-1h", nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.since.Year() != 2017 || time.Since(q.until) < time.Hour {
+		t.Fatalf("expect since 2017 and until an hour ago. Got %s, %s", q.since, q.until)
+	}
+
+	e := explainQuery(req, q)
+	if e.Start != "since" || e.Since != "2017-01-02T03:04:05Z" || e.Until == "" {
+		t.Fatalf("expect start since and until. Got %+v", e)
+	}
+
+	for _, target := range []string{"/v2/component?since=yesterday", "/v2/component?since=1h&until=2h"} {
+		if _, err := parseJournalQuery(httptest.NewRequest("GET", target, nil)); err == nil {
+			t.Fatalf("%s: expect an error", target)
+		}
+	}
+}
+
+func TestJournalQueryFilterPattern(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?filter_pattern="+url.QueryEscape(`timeout after \d+s`), nil)
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := explainQuery(req, q); e.Pattern != `timeout after \d+s` {
+		t.Fatalf("expect the pattern. Got %+v", e)
+	}
+
+	role := &redact.Role{Hide: []string{"MESSAGE"}}
+	if field := q.hiddenField(role); field != "MESSAGE" {
+		t.Fatalf("expect MESSAGE to be hidden. Got %q", field)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?filter_pattern=(", nil)
+	if _, err := parseJournalQuery(req); err == nil {
+		t.Fatal("expect invalid pattern error")
+	}
+}
+
+func TestFieldsParam(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?fields=message,+_PID&fields=_SYSTEMD_UNIT,", nil)
+	f, ok := newEntryFormatter(req, jr.ContentTypeApplicationJSON.String(), false).(*jr.FormatJSON)
+	if !ok {
+		t.Fatal("expect JSON formatter")
+	}
+
+	expect := []string{"MESSAGE", "_PID", "_SYSTEMD_UNIT"}
+	if !reflect.DeepEqual(f.Fields, expect) {
+		t.Fatalf("expect %v. Got %v", expect, f.Fields)
+	}
+
+	sse, ok := newEntryFormatter(req, eventStreamContentType, true).(*jr.FormatSSE)
+	if !ok || !reflect.DeepEqual(sse.Fields, expect) {
+		t.Fatalf("expect SSE formatter with fields %v. Got %+v", expect, sse)
+	}
+}
+
+func TestJournalQueryLevel(t *testing.T) {
+	for _, tc := range []struct {
+		query  string
+		expect []string
+	}{
+		{"level=warning", []string{"0", "1", "2", "3", "4"}},
+		{"level=2", []string{"0", "1", "2"}},
+		{"level=debug", nil},
+		{"level=err&q=" + url.QueryEscape("priority>=crit"), []string{"2", "3"}},
+		{"level=notice&q=" + url.QueryEscape("priority>=err"), []string{"3", "4", "5"}},
+	} {
+		q, err := parseJournalQuery(httptest.NewRequest("GET", "/v2/component?"+tc.query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var priorities []string
+		for _, m := range q.matches {
+			if m.Field != "PRIORITY" {
+				t.Fatalf("expect PRIORITY match. Got %s", m.Field)
+			}
+			priorities = append(priorities, m.Value)
+		}
+
+		if !reflect.DeepEqual(priorities, tc.expect) {
+			t.Fatalf("%s: expect %v. Got %v", tc.query, tc.expect, priorities)
+		}
+	}
+
+	for _, s := range []string{"level=loud", "level=err&q=" + url.QueryEscape("priority>warning")} {
+		if _, err := parseJournalQuery(httptest.NewRequest("GET", "/v2/component?"+s, nil)); err == nil {
+			t.Fatalf("expect error for %s", s)
+		}
+	}
+}
+
+func TestFormatParam(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component?format=xml", nil)
+	w := httptest.NewRecorder()
+	journalHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect status 400 for an unknown format. Got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?format=template&template="+url.QueryEscape("{{.Fields"), nil)
+	w = httptest.NewRecorder()
+	journalHandler(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid template") {
+		t.Fatalf("expect status 400 for an invalid template. Got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?format=template&template="+url.QueryEscape("{{.Cursor}}"), nil)
+	if _, ok := newEntryFormatter(req, jr.ContentTypePlainText.String(), false).(jr.FormatTemplate); !ok {
+		t.Fatal("expect a template formatter")
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?format=color", nil)
+	if _, ok := newEntryFormatter(req, jr.ContentTypePlainText.String(), false).(jr.FormatColor); !ok {
+		t.Fatal("expect a color formatter")
+	}
+
+	for _, format := range jr.Formats() {
+		contentType, ok := formatContentType(format.Name)
+		if format.Name != "" && (!ok || contentType != format.ContentType) {
+			t.Fatalf("expect %s for format %s. Got %s", format.ContentType, format.Name, contentType)
+		}
+
+		if f := jr.NewEntryFormatter(format.ContentType.String(), false); f.GetContentType() != format.ContentType {
+			t.Fatalf("expect %s formatter. Got %s", format.ContentType, f.GetContentType())
+		}
+	}
+
+	cfg := &config.Config{FlagDefaultFormat: "logfmt"}
+	req = httptest.NewRequest("GET", "/v2/component", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+	if format := defaultFormat(req); format != "logfmt" {
+		t.Fatalf("expect the default format logfmt. Got %q", format)
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	if format := defaultFormat(req); format != "" {
+		t.Fatalf("expect the Accept header to override the default format. Got %q", format)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component?format=csv&columns=timestamp,+message&columns=PRIORITY", nil)
+	if columns := csvColumns(req); !reflect.DeepEqual(columns, []string{"timestamp", "message", "PRIORITY"}) {
+		t.Fatalf("unexpected columns %v", columns)
+	}
+}
+
+func TestWSSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := websocket.Upgrade(w, req)
+		if err != nil {
+			return
+		}
+
+		s := newWSSession(context.Background(), conn)
+		defer s.close(nil)
+
+		// lines are split across writes.
+		s.Write([]byte("one\ntw"))
+		s.Write([]byte("o\n\xff\n"))
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: dcos-log\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect status 101. Got %d", resp.StatusCode)
+	}
+
+	for _, expect := range []struct {
+		opcode byte
+		data   string
+	}{
+		{websocket.TextMessage, "one"},
+		{websocket.TextMessage, "two"},
+		{websocket.BinaryMessage, "\xff"},
+		{websocket.CloseMessage, "\x03\xe8"},
+	} {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(br, header); err != nil {
+			t.Fatal(err)
+		}
+
+		data := make([]byte, header[1])
+		if _, err := io.ReadFull(br, data); err != nil {
+			t.Fatal(err)
+		}
+
+		if header[0]&0x0f != expect.opcode || string(data) != expect.data {
+			t.Fatalf("expect message %d %q. Got %d %q", expect.opcode, expect.data, header[0]&0x0f, data)
+		}
+	}
+}
+
+func TestWSFormat(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/component/dcos-marathon.service/stream?format=logfmt", nil)
+	if !wsFormat(req, jr.ContentTypeApplicationJSON, "json", "logfmt") || req.Header.Get("Accept") != jr.ContentTypeLogfmt.String() {
+		t.Fatalf("expect logfmt content type. Got %s", req.Header.Get("Accept"))
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component/dcos-marathon.service/stream", nil)
+	req.Header.Set("Accept", eventStreamContentType)
+	if !wsFormat(req, jr.ContentTypeApplicationJSON, "json") || req.Header.Get("Accept") != jr.ContentTypeApplicationJSON.String() {
+		t.Fatalf("expect default content type. Got %s", req.Header.Get("Accept"))
+	}
+
+	req = httptest.NewRequest("GET", "/v2/component/dcos-marathon.service/stream?format=elastic", nil)
+	w := httptest.NewRecorder()
+	wsJournalHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect status 400 for an unsupported format. Got %d", w.Code)
+	}
+}
+
+func TestAuthorizeTask(t *testing.T) {
+	policy, err := authz.ParseFrameworkPolicy([]byte(`{"rules": [{"uids": ["alice"], "frameworks": ["fw-a"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz.SetDefault(policy)
+	defer authz.SetDefault(nil)
+
+	router := mux.NewRouter()
+	router.Path(taskPath + "/{file}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := authorizeTask(req); err != nil {
+			e := err.(errSetupFilesAPIReader)
+			http.Error(w, e.msg, e.code)
+		}
+	})
+
+	token := "token=e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"alice"}`)) + ".sig"
+	for _, tc := range []struct {
+		framework string
+		code      int
+	}{
+		{"fw-a", http.StatusOK},
+		{"fw-b", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/task/frameworks/"+tc.framework+"/executors/e/runs/c/stdout", nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("expect status %d reading %s. Got %d", tc.code, tc.framework, w.Code)
+		}
+	}
+}
+
+func TestAuthorizeArchivedTask(t *testing.T) {
+	policy, err := authz.ParseFrameworkPolicy([]byte(`{"rules": [{"uids": ["alice"], "frameworks": ["fw-a"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz.SetDefault(policy)
+	defer authz.SetDefault(nil)
+
+	// the executor of an archived sandbox is authorized without the agent state.
+	req := httptest.NewRequest("GET", "/task/frameworks/fw-a/executors/e/runs/c/stdout", nil)
+	req = req.WithContext(middleware.WithUIDContext(req.Context(), "alice"))
+	for framework, allowed := range map[string]bool{"fw-a": true, "fw-b": false} {
+		metadata := &archive.Metadata{Sandbox: archive.Sandbox{AgentID: "agent", FrameworkID: framework, ExecutorID: "e",
+			ContainerID: "c"}}
+		if err := authorizeArchivedTask(req, metadata, ""); (err == nil) != allowed {
+			t.Fatalf("expect the archived task of %s allowed %t. Got %v", framework, allowed, err)
+		}
+	}
+}
+
+func TestAllowedPodTasks(t *testing.T) {
+	var asked []authz.Task
+	authz.SetDefault(authz.PolicyFunc(func(uid string, task authz.Task) bool {
+		asked = append(asked, task)
+		return uid == "alice" && task.TaskPath == "web"
+	}))
+	defer authz.SetDefault(nil)
+
+	// the route of the pod has no task, the policy is asked for every task of the pod.
+	router := mux.NewRouter()
+	router.Path(podLogsPath).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var tasks []string
+		if t := req.URL.Query().Get("tasks"); t != "" {
+			tasks = strings.Split(t, ",")
+		}
+
+		allowed, code, err := allowedPodTasks(req, tasks)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		json.NewEncoder(w).Encode(allowed)
+	})
+
+	token := "token=e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"alice"}`)) + ".sig"
+	for _, tc := range []struct {
+		tasks string
+		code  int
+		body  string
+	}{
+		{"web,sidecar", http.StatusOK, `["web"]`},
+		{"sidecar", http.StatusForbidden, `user "alice" is not allowed to read the logs of framework fw`},
+		{"", http.StatusOK, `null`},
+	} {
+		req := httptest.NewRequest("GET", "/pod/frameworks/fw/executors/e/runs/c?tasks="+tc.tasks, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code || strings.TrimSpace(w.Body.String()) != tc.body {
+			t.Fatalf("expect %d %s of the tasks %q. Got %d %s", tc.code, tc.body, tc.tasks, w.Code, w.Body.String())
+		}
+	}
+
+	expect := []authz.Task{
+		{FrameworkID: "fw", ExecutorID: "e", ContainerID: "c", TaskPath: "web"},
+		{FrameworkID: "fw", ExecutorID: "e", ContainerID: "c", TaskPath: "sidecar"},
+		{FrameworkID: "fw", ExecutorID: "e", ContainerID: "c", TaskPath: "sidecar"},
+	}
+	if !reflect.DeepEqual(asked, expect) {
+		t.Fatalf("expect the policy asked once per task %+v. Got %+v", expect, asked)
+	}
+}
+
+func TestRangeDeadline(t *testing.T) {
+	cfg := &config.Config{FlagRangeTimeout: "10ms"}
+	req := httptest.NewRequest("GET", "/v2/component", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+
+	req, cancel := withRangeDeadline(req)
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	if deadlineExceeded(w, req, 0) {
+		t.Fatal("expect the deadline not to be exceeded")
+	}
+
+	<-req.Context().Done()
+	if !deadlineExceeded(w, req, 0) || w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expect status 504 without a result. Got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	if !deadlineExceeded(w, req, 42) || w.Header().Get(partialTrailer) != "true" {
+		t.Fatalf("expect the partial result trailer. Got %v", w.Header())
+	}
+
+	cfg.FlagRangeTimeout = "0"
+	req, cancel = withRangeDeadline(httptest.NewRequest("GET", "/v2/component", nil).WithContext(
+		middleware.WithConfigContext(context.Background(), cfg)))
+	defer cancel()
+	if _, ok := req.Context().Deadline(); ok {
+		t.Fatal("expect no deadline")
+	}
+}
+
+func TestStreamQueue(t *testing.T) {
+	cfg := &config.Config{FlagStreamBackpressure: backpressureBlock, FlagStreamQueueSize: 1}
+	req := httptest.NewRequest("GET", "/v2/component", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+
+	w := httptest.NewRecorder()
+	queue, _ := newStreamQueue(w, req)
+	io.WriteString(queue, "data: one\n")
+	io.WriteString(queue, "\ndata: two\n\ndata: three\n\n")
+	queue.close()
+
+	if body := w.Body.String(); body != "data: one\n\ndata: two\n\ndata: three\n\n" || !w.Flushed {
+		t.Fatalf("expect all events with the block policy. Got %q", body)
+	}
+
+	for _, tc := range []struct {
+		policy string
+		expect string
+		err    error
+	}{
+		{backpressureDropOldest, "event: gap\ndata: {\"reason\":\"backpressure\",\"dropped\":1}\n\ndata: two\n\ndata: three\n\n", nil},
+		{backpressureDisconnect, "", errSlowConsumer},
+	} {
+		buf := &bytes.Buffer{}
+		canceled := false
+		q := &streamQueue{w: buf, policy: tc.policy, size: 2, cancel: func() { canceled = true }, done: make(chan struct{})}
+		q.cond = sync.NewCond(&q.mu)
+
+		// the events are queued before the sending goroutine starts, like for a client which does not read.
+		if _, err := io.WriteString(q, "data: one\n\ndata: two\n\ndata: three\n\n"); err != tc.err {
+			t.Fatalf("%s: expect error %v. Got %v", tc.policy, tc.err, err)
+		}
+
+		go q.run()
+		q.close()
+		if buf.String() != tc.expect || !canceled {
+			t.Fatalf("%s: expect %q. Got %q", tc.policy, tc.expect, buf.String())
+		}
+	}
+}
+
+func TestStreamQueueIntegrity(t *testing.T) {
+	buf := &bytes.Buffer{}
+	q := &streamQueue{w: buf, policy: backpressureDropOldest, size: 3, cancel: func() {}, integrity: true,
+		checkpoint: time.Millisecond, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+
+	io.WriteString(q, "id: a\ndata: one\n\n: ping\n\nid: b\ndata: two\n\nid: c\ndata: three\n\n")
+	q.gap(gapRotation)
+	time.Sleep(time.Millisecond)
+	q.checkpointDue()
+
+	go q.run()
+	q.close()
+
+	expect := "event: gap\ndata: {\"reason\":\"backpressure\",\"dropped\":3,\"from\":1,\"to\":2}\n\n" +
+		"seq: 3\nid: c\ndata: three\n\n" +
+		"event: gap\ndata: {\"reason\":\"rotation\",\"after\":3}\n\n" +
+		"event: checkpoint\ndata: {\"seq\":3,\"id\":\"c\"}\n\n"
+	if buf.String() != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf.String())
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"text/plain", "application/json", "text/event-stream"}
+	for accept, expected := range map[string]string{
+		"application/json":                                "application/json",
+		"*/*":                                             "text/plain",
+		"text/*;q=0.5, application/json;q=0.8":            "application/json",
+		"text/*, text/plain;q=0.2":                        "text/event-stream",
+		"text/event-stream; charset=utf-8":                "text/event-stream",
+		"application/json;q=0, */*;q=0.1":                 "text/plain",
+		"application/xml":                                 "",
+		"application/json;q=2, text/plain;q=bad":          "",
+		"Application/JSON;q=0.9, text/event-stream;q=0.9": "application/json",
+	} {
+		if offer := negotiate(accept, offers); offer != expected {
+			t.Fatalf("expect %q for %s. Got %q", expected, accept, offer)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v2/component", nil)
+	req.Header.Set("Accept", "application/x-ndjson;q=0.9, application/json;q=0.5")
+	negotiateAccept(req, journalContentTypes())
+	if accept := req.Header.Get("Accept"); accept != jr.ContentTypeNDJSON.String() {
+		t.Fatalf("expect %s. Got %s", jr.ContentTypeNDJSON, accept)
+	}
+
+	req.Header.Set("Accept", "application/xml, text/html;q=0.9")
+	negotiateAccept(req, taskLogContentTypes)
+	if accept := req.Header.Get("Accept"); accept != "application/xml, text/html;q=0.9" {
+		t.Fatalf("expect the header to be kept. Got %s", accept)
+	}
+}
+
+func TestDiscoverResponse(t *testing.T) {
+	id := &nodeutil.CanonicalTaskID{ID: "sleep.1", AgentID: "a1", FrameworkID: "f1", ContainerIDs: []string{"c1", "c2"}}
+	taskURL, err := redirectURL(id, "stdout", "limit=10", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := discoverResponse{AgentID: "a1", FrameworkID: "f1", ExecutorID: "sleep.1", ContainerID: "c2",
+		URL: "/system/v1/agent/a1/logs/v2/task/frameworks/f1/executors/sleep.1/runs/c2/stdout?limit=10"}
+	if resp := newDiscoverResponse(id, taskURL); resp != expected {
+		t.Fatalf("expect %+v. Got %+v", expected, resp)
+	}
+
+	id.ExecutorID = "pod-executor"
+	if resp := newDiscoverResponse(id, taskURL); resp.ExecutorID != "pod-executor" {
+		t.Fatalf("expect executor of a pod task. Got %s", resp.ExecutorID)
+	}
+}
+
+func TestSelectRun(t *testing.T) {
+	task := &nodeutil.CanonicalTaskID{ID: "sleep.1", AgentID: "a1", FrameworkID: "f1",
+		ContainerIDs: []string{"c1", "c1", "c2", "c3", "c3"}}
+	pod := &nodeutil.CanonicalTaskID{ID: "web", AgentID: "a1", FrameworkID: "f1", ExecutorID: "e1",
+		ContainerIDs: []string{"t1", "p1", "t2", "p2"}}
+
+	if runs := taskRuns(task); !reflect.DeepEqual(runs, []string{"c1", "c2", "c3"}) {
+		t.Fatalf("expect runs c1, c2, c3. Got %v", runs)
+	}
+
+	if runs := taskRuns(pod); !reflect.DeepEqual(runs, []string{"p1", "p2"}) {
+		t.Fatalf("expect runs p1, p2. Got %v", runs)
+	}
+
+	for run, expected := range map[string]string{"": "c3", "0": "c1", "-1": "c3", "1": "c2", "c2": "c2"} {
+		id, err := selectRun(task, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if containerID := id.ContainerIDs[len(id.ContainerIDs)-1]; containerID != expected {
+			t.Fatalf("expect container %s for run %q. Got %s", expected, run, containerID)
+		}
+	}
+
+	for _, run := range []string{"3", "-4", "c4"} {
+		if _, err := selectRun(task, run); err != errRunNotFound {
+			t.Fatalf("expect errRunNotFound for run %s. Got %v", run, err)
+		}
+	}
+
+	id, err := selectRun(pod, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if taskURL, _ := redirectURL(id, "stdout", "", false, false); taskURL != "/system/v1/agent/a1/logs/v2/task/frameworks/f1/executors/e1/runs/p1/tasks/web/stdout" {
+		t.Fatalf("unexpected URL of the first run %s", taskURL)
+	}
+
+	rec := httptest.NewRecorder()
+	serveTaskRuns(rec, httptest.NewRequest("GET", "/v2/task/sleep.1?run=all", nil), task, "stdout", "limit=1", false, false)
+	var runs []taskRun
+	if err := json.Unmarshal(rec.Body.Bytes(), &runs); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 3 || runs[1].ContainerID != "c2" || !strings.HasSuffix(runs[1].URL, "/runs/c2/stdout?limit=1") {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+}
+
+func TestTaskCache(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	c := newTaskCache(2)
+	c.now = func() time.Time { return now }
+
+	one := &nodeutil.CanonicalTaskID{ID: "one"}
+	c.add(taskCacheKey("alice", "one"), one, nil, time.Second)
+	c.add(taskCacheKey("alice", "unknown"), nil, nodeutil.ErrTaskNotFound, time.Second)
+
+	if entry, ok := c.get(taskCacheKey("alice", "one")); !ok || entry.err != nil || entry.id != one {
+		t.Fatalf("expect cached task. Got %v %v", entry, ok)
+	}
+
+	if entry, ok := c.get(taskCacheKey("alice", "unknown")); !ok || entry.err != nodeutil.ErrTaskNotFound {
+		t.Fatalf("expect cached unknown task. Got %v %v", entry, ok)
+	}
+
+	if _, ok := c.get(taskCacheKey("bob", "one")); ok {
+		t.Fatal("expect the tasks of a user not to be returned to another")
+	}
+
+	// one is used more recently than unknown.
+	c.get(taskCacheKey("alice", "one"))
+	c.add(taskCacheKey("alice", "two"), &nodeutil.CanonicalTaskID{ID: "two"}, nil, time.Second)
+	if _, ok := c.get(taskCacheKey("alice", "unknown")); ok {
+		t.Fatal("expect the least recently used task to be evicted")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := c.get(taskCacheKey("alice", "one")); ok {
+		t.Fatal("expect the task to expire")
+	}
+
+	if c.lru.Len() != 1 || len(c.entries) != 1 {
+		t.Fatalf("expect the expired task to be removed. Got %d entries", c.lru.Len())
+	}
+}
+
+func TestNewInventory(t *testing.T) {
+	state := &agent.State{
+		Frameworks: []agent.Framework{{
+			ID:   "f1",
+			Name: "marathon",
+			Executors: []agent.Executor{{ID: "e1", Name: "Command Executor", Container: "c2",
+				Tasks: []agent.Task{{ID: "e1", Name: "sleep", State: "TASK_RUNNING"}}}},
+			CompletedExecutors: []agent.Executor{{ID: "e1", Name: "Command Executor", Container: "c1",
+				CompletedTasks: []agent.Task{{ID: "e1", Name: "sleep", State: "TASK_FAILED"}}}},
+		}},
+	}
+
+	sandbox := func(frameworkID, executorID, containerID string) reader.Sandbox {
+		return reader.Sandbox{FrameworkID: frameworkID, ExecutorID: executorID, ContainerID: containerID}
+	}
+	sandboxes := []reader.Sandbox{sandbox("f1", "e1", "c1"), sandbox("f1", "e1", "c2"), sandbox("f1", "e0", "c0"),
+		sandbox("f2", "e2", "c3")}
+	inventory := newInventory("a1", sandboxes, state, func(task authz.Task) bool {
+		return task.FrameworkID != "f2"
+	})
+
+	if len(inventory) != 3 {
+		t.Fatalf("expect 3 sandboxes, the sandbox of f2 is not allowed. Got %+v", inventory)
+	}
+
+	if task := inventory[0].Tasks; len(task) != 1 || task[0].Name != "sleep" || task[0].State != "TASK_FAILED" {
+		t.Fatalf("expect the completed task of the first run. Got %+v", task)
+	}
+
+	if task := inventory[1].Tasks; len(task) != 1 || task[0].State != "TASK_RUNNING" {
+		t.Fatalf("expect the running task of the second run. Got %+v", task)
+	}
+
+	if inventory[1].FrameworkName != "marathon" || inventory[1].ExecutorName != "Command Executor" {
+		t.Fatalf("expect the framework and executor names. Got %+v", inventory[1])
+	}
+
+	// the agent state no longer has the executor of a sandbox waiting for garbage collection.
+	if inventory[2].FrameworkName != "" || len(inventory[2].Tasks) != 0 {
+		t.Fatalf("expect a sandbox without names. Got %+v", inventory[2])
+	}
+
+	expect := "/system/v1/agent/a1/logs/v2/task/frameworks/f1/executors/e1/runs/c2/files/browse"
+	if inventory[1].URL != expect {
+		t.Fatalf("expect URL %s. Got %s", expect, inventory[1].URL)
+	}
+
+	if len(newInventory("a1", sandboxes, nil, func(authz.Task) bool { return true })) != 4 {
+		t.Fatal("expect the sandboxes listed without the agent state")
+	}
+}
+
+func TestTaskEndpointPath(t *testing.T) {
+	id := &nodeutil.CanonicalTaskID{ID: "t1", AgentID: "a1", FrameworkID: "f1", ContainerIDs: []string{"c1"}}
+	for _, tc := range []struct {
+		browse, download bool
+		expect           string
+	}{
+		{expect: "/task/frameworks/f1/executors/t1/runs/c1/stderr"},
+		{browse: true, expect: "/task/frameworks/f1/executors/t1/runs/c1/files/browse"},
+		{download: true, expect: "/task/frameworks/f1/executors/t1/runs/c1/stderr/download"},
+	} {
+		if p := taskEndpointPath(id, "stderr", tc.browse, tc.download); p != tc.expect {
+			t.Fatalf("expect %s. Got %s", tc.expect, p)
+		}
+	}
+}
+
+func TestCopyResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", eventStreamContentType)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("data: one\n\n"))
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	w := httptest.NewRecorder()
+	if err := copyResponse(w, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expect the status of the agent. Got %d", w.Code)
+	}
+
+	if w.Header().Get("Content-Type") != eventStreamContentType || w.Header().Get("Trailer") != "" {
+		t.Fatalf("expect the headers of the agent without the hop-by-hop headers. Got %v", w.Header())
+	}
+
+	if !w.Flushed || w.Body.String() != "data: one\n\n" {
+		t.Fatalf("expect the flushed body of the agent. Got %q", w.Body.String())
+	}
+}
+
+func TestSelectAgents(t *testing.T) {
+	agents := []master.Agent{
+		{ID: "S1", Hostname: "10.0.0.1", Active: true, Attributes: map[string]interface{}{"rack": "r1", "cores": 4.0}},
+		{ID: "S2", Hostname: "10.0.0.2", Active: true, Attributes: map[string]interface{}{"rack": "r2"}},
+		{ID: "S3", Hostname: "10.0.0.3", Attributes: map[string]interface{}{"rack": "r1"}},
+	}
+
+	for _, tc := range []struct {
+		query  string
+		expect []string
+	}{
+		{query: "", expect: []string{"S1", "S2"}},
+		{query: "agent=S2", expect: []string{"S2"}},
+		{query: "agent=10.0.0.1&agent=S3", expect: []string{"S1"}},
+		{query: "agent_attribute=rack:r1", expect: []string{"S1"}},
+		{query: "agent_attribute=rack:r1&agent_attribute=cores:4", expect: []string{"S1"}},
+		{query: "agent_attribute=rack:r2&agent=S1", expect: nil},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		selected, err := selectAgents(agents, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, agent := range selected {
+			ids = append(ids, agent.ID)
+		}
+
+		if !reflect.DeepEqual(ids, tc.expect) {
+			t.Fatalf("%s: expect agents %v. Got %v", tc.query, tc.expect, ids)
+		}
+	}
+
+	if _, err := selectAgents(agents, url.Values{agentAttributeParam: {"rack"}}); err == nil {
+		t.Fatal("expect an invalid agent_attribute error")
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	poll := newPollBackoff(time.Second, 5*time.Second)
+	var delays []time.Duration
+	for _, grew := range []bool{false, false, false, false, true, false} {
+		delays = append(delays, poll.next(grew))
+	}
+
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, time.Second, time.Second}
+	if !reflect.DeepEqual(delays, expect) {
+		t.Fatalf("expect delays %v. Got %v", expect, delays)
+	}
+
+	// the backoff is disabled.
+	poll = newPollBackoff(time.Second, 0)
+	if poll.next(false) != time.Second || poll.next(false) != time.Second {
+		t.Fatal("expect a fixed delay without max")
+	}
+}
+
+func TestLimitCap(t *testing.T) {
+	cfg := &config.Config{FlagMaxLimit: 100}
+	handler := limitCap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	for limit, code := range map[string]int{"": http.StatusOK, "100": http.StatusOK, "abc": http.StatusOK,
+		"100000000": http.StatusUnprocessableEntity} {
+		req := httptest.NewRequest("GET", "/v2/component?limit="+limit, nil)
+		req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Fatalf("limit %q: expect status %d. Got %d", limit, code, w.Code)
+		}
+	}
+
+	// no maximum.
+	cfg.FlagMaxLimit = 0
+	req := httptest.NewRequest("GET", "/v2/component?limit=100000000", nil)
+	req = req.WithContext(middleware.WithConfigContext(req.Context(), cfg))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect status 200 without a maximum. Got %d", w.Code)
+	}
+}
+
+func TestStreamQueueGzip(t *testing.T) {
+	next := make(chan struct{})
+	ts := httptest.NewServer(middleware.Gzip(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", eventStreamContentType)
+		queue, _ := newStreamQueue(w, req)
+		defer queue.close()
+
+		queue.Write([]byte("data: one\n\n"))
+		<-next
+		queue.Write([]byte("data: two\n\n"))
+	})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expect a gzip compressed stream. Got %v", resp.Header)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue flushes the compressor, the first event is received before the second one is queued.
+	scanner := bufio.NewScanner(gz)
+	if !scanner.Scan() || scanner.Text() != "data: one" {
+		t.Fatalf("expect the first event. Got %q %v", scanner.Text(), scanner.Err())
+	}
+	close(next)
+
+	scanner.Scan()
+	if !scanner.Scan() || scanner.Text() != "data: two" {
+		t.Fatalf("expect the second event. Got %q %v", scanner.Text(), scanner.Err())
+	}
+}
+
+func TestAgentErrorCode(t *testing.T) {
+	for err, code := range map[error]int{
+		reader.ErrFileNotFound:     http.StatusNotFound,
+		reader.ErrUnauthorized:     http.StatusForbidden,
+		reader.ErrAgentUnavailable: http.StatusBadGateway,
+		reader.ErrCircuitOpen:      http.StatusServiceUnavailable,
+		reader.ErrOffsetOutOfRange: http.StatusRequestedRangeNotSatisfiable,
+		errors.New("unexpected"):   http.StatusInternalServerError,
+	} {
+		if c := agentErrorCode(err); c != code {
+			t.Fatalf("%s: expect %d. Got %d", err, code, c)
+		}
+	}
+}
+
+func TestByteParams(t *testing.T) {
+	for query, expect := range map[string]struct {
+		offset, length int
+		ok, err        bool
+	}{
+		"":                         {},
+		"?offset=10":               {offset: 10, length: defaultByteLength, ok: true},
+		"?offset=0&length=5":       {length: 5, ok: true},
+		"?length=5":                {err: true},
+		"?offset=-1":               {err: true},
+		"?offset=1&length=0":       {err: true},
+		"?offset=1&cursor=BEG":     {err: true},
+		"?offset=1&follow=true":    {err: true},
+		"?offset=1&limit=2&skip=1": {err: true},
+	} {
+		req := httptest.NewRequest("GET", "/"+query, nil)
+		offset, length, ok, err := byteParams(req)
+		if (err != nil) != expect.err || offset != expect.offset || length != expect.length || ok != expect.ok {
+			t.Fatalf("%s: expect %+v. Got %d %d %t %v", query, expect, offset, length, ok, err)
+		}
+	}
+}
+
+func TestWriteFileBytes(t *testing.T) {
+	ts := newFakeFilesAPIServer(t)
+	defer ts.Close()
+
+	testURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NewLineReader(&http.Client{}, *testURL, "a", "b", "c", "d", "", "stdout", reader.LineFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/?offset=4&length=6", nil)
+	for _, expect := range []struct {
+		offset int
+		body   string
+		next   string
+	}{
+		{4, "two\nth", "10"},
+		{19, "five\n", "24"},
+		{24, "", "24"},
+	} {
+		w := httptest.NewRecorder()
+		writeFileBytes(w, req, r, expect.offset, 6)
+		if w.Body.String() != expect.body || w.Header().Get(nextOffsetHeader) != expect.next {
+			t.Fatalf("offset %d: expect %q and next offset %s. Got %q and %s", expect.offset, expect.body, expect.next,
+				w.Body.String(), w.Header().Get(nextOffsetHeader))
+		}
+	}
+}
+
+func TestFieldsHandlerInvalid(t *testing.T) {
+	router := mux.NewRouter()
+	router.Path(fieldsPath).HandlerFunc(fieldsHandler)
+
+	for _, target := range []string{"/fields/_systemd_unit", "/fields/UNIT=a", "/fields/_SYSTEMD_UNIT?limit=0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expect status 400 for %s. Got %d", target, w.Code)
+		}
+	}
+}
+
+func TestJournalStats(t *testing.T) {
+	role := &redact.Role{Hide: []string{"_SYSTEMD_UNIT"}}
+	stats := newJournalStats(time.Time{}, time.Time{}, nil)
+	hidden := newJournalStats(time.Time{}, time.Time{}, role)
+	for _, fields := range []map[string]string{
+		{"_SYSTEMD_UNIT": "a.service", "SYSLOG_IDENTIFIER": "a", "PRIORITY": "3", "MESSAGE": "error"},
+		{"_SYSTEMD_UNIT": "a.service", "PRIORITY": "6", "MESSAGE": "info"},
+		{"_SYSTEMD_UNIT": "b.service", "PRIORITY": "3", "MESSAGE": "err"},
+		{"SYSLOG_IDENTIFIER": "kernel", "PRIORITY": "6", "MESSAGE": "x"},
+		{"_SYSTEMD_UNIT": "b.service", "PRIORITY": "6", "MESSAGE": "y"},
+		{"_SYSTEMD_UNIT": "a.service", "MESSAGE": "z"},
+	} {
+		stats.add(fields)
+		hidden.add(fields)
+	}
+	stats.sortUnits()
+
+	if stats.Entries != 6 || stats.Bytes != 15 {
+		t.Fatalf("expect 6 entries and 15 bytes. Got %d, %d", stats.Entries, stats.Bytes)
+	}
+
+	if p := stats.Priorities["3"]; p == nil || p.Entries != 2 || p.Bytes != 8 {
+		t.Fatalf("expect 2 entries of priority 3. Got %+v", p)
+	}
+
+	var units []string
+	for _, u := range stats.Units {
+		units = append(units, u.Unit)
+	}
+	if !reflect.DeepEqual(units, []string{"a.service", "b.service", "kernel"}) {
+		t.Fatalf("expect the units by entries. Got %v", units)
+	}
+
+	if a := stats.Units[0]; a.Entries != 3 || a.Priorities["6"].Entries != 1 || len(a.Priorities) != 2 {
+		t.Fatalf("expect the priorities of a.service. Got %+v", a)
+	}
+
+	// the hidden unit field is not used, the entries are counted by syslog identifier.
+	if len(hidden.Units) != 3 || hidden.units["a"] == nil || hidden.units[""].Entries != 4 {
+		t.Fatalf("expect the entries counted by syslog identifier. Got %+v", hidden.units)
+	}
+}
+
+func TestExportJobSpec(t *testing.T) {
+	for _, spec := range []exportJobSpec{
+		{Format: "xml"},
+		{Compression: "zip"},
+		{Since: "2018-01-02T00:00:00Z", Until: "2018-01-01T00:00:00Z"},
+		{Units: []string{"../etc"}},
+		{Tasks: []exportJobTask{{FrameworkID: "f", ExecutorID: "e", ContainerID: "c", Files: []string{"a/b"}}}},
+		{Tasks: []exportJobTask{{FrameworkID: "f", ExecutorID: "..", ContainerID: "c"}}},
+	} {
+		if err := spec.validate(); err == nil {
+			t.Fatalf("expect an error for %+v", spec)
+		}
+	}
+
+	spec := exportJobSpec{
+		Since: "2018-01-01T00:00:00Z",
+		Units: []string{"dcos-mesos-slave.service"},
+		Tasks: []exportJobTask{{FrameworkID: "f", ExecutorID: "e", ContainerID: "c"}},
+	}
+	if err := spec.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Format != "json" || spec.Compression != "gzip" {
+		t.Fatalf("expect json and gzip by default. Got %s, %s", spec.Format, spec.Compression)
+	}
+
+	var names, targets []string
+	for _, p := range spec.parts() {
+		names, targets = append(names, p.name), append(targets, p.target)
+	}
+
+	expectNames := []string{"units/dcos-mesos-slave.service.json", "tasks/c/stdout.ndjson", "tasks/c/stderr.ndjson"}
+	if !reflect.DeepEqual(names, expectNames) {
+		t.Fatalf("expect parts %v. Got %v", expectNames, names)
+	}
+
+	expectTargets := []string{
+		"/component/dcos-mesos-slave.service?format=json&since=2018-01-01T00%3A00%3A00Z",
+		"/task/frameworks/f/executors/e/runs/c/stdout",
+		"/task/frameworks/f/executors/e/runs/c/stderr",
+	}
+	if !reflect.DeepEqual(targets, expectTargets) {
+		t.Fatalf("expect targets %v. Got %v", expectTargets, targets)
+	}
+
+	whole := exportJobSpec{Format: "text"}
+	if err := whole.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if parts := whole.parts(); len(parts) != 1 || parts[0].name != "journal.log" {
+		t.Fatalf("expect the whole journal. Got %+v", parts)
+	}
+}
+
+func TestExportJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcos-log-exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		if strings.HasSuffix(req.URL.Path, "/stderr") {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, req.URL.Path)
+	})
+
+	q := newExportJobs(dir, 1, time.Hour, 0, handler)
+	spec := exportJobSpec{
+		Compression: "none",
+		Units:       []string{"a.service"},
+		Tasks:       []exportJobTask{{FrameworkID: "f", ExecutorID: "e", ContainerID: "c"}},
+	}
+	if err := spec.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := q.submit(context.Background(), "alice", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.submit(context.Background(), "alice", spec); err != errTooManyJobs {
+		t.Fatalf("expect too many jobs. Got %v", err)
+	}
+
+	if _, err := q.get("bob", job.ID); err != errJobNotFound {
+		t.Fatalf("expect the job of another user not found. Got %v", err)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the job done. Got %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if job, err = q.get("alice", job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(job.Parts) != 3 || job.Parts[2].Error != "404 File not found" {
+		t.Fatalf("expect the error of stderr. Got %+v", job.Parts)
+	}
+
+	f, err := os.Open(job.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	files := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(b)
+	}
+
+	expect := map[string]string{
+		"units/a.service.json":  "/component/a.service",
+		"tasks/c/stdout.ndjson": "/task/frameworks/f/executors/e/runs/c/stdout",
+	}
+	if !reflect.DeepEqual(files, expect) {
+		t.Fatalf("expect archive %v. Got %v", expect, files)
+	}
+
+	if err := q.remove("alice", job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(job.path); !os.IsNotExist(err) {
+		t.Fatalf("expect the archive removed. Got %v", err)
+	}
+}
+
+func TestTaskIndex(t *testing.T) {
+	state := &agent.State{
+		ID: "agent-1",
+		Frameworks: []agent.Framework{{
+			ID:   "marathon-id",
+			Name: "marathon",
+			Executors: []agent.Executor{
+				{ID: "web", Container: "c1", Tasks: []agent.Task{{ID: "web.1", Name: "web"}}},
+				{ID: "pod", Container: "c2", Tasks: []agent.Task{{ID: "pod.a", Name: "a"}, {ID: "pod.b", Name: "b"}}},
+			},
+		}},
+	}
+	index := newTaskIndex(state)
+
+	for _, tc := range []struct {
+		fields, expect map[string]string
+	}{
+		{
+			fields: map[string]string{"CONTAINER_ID": "c1"},
+			expect: map[string]string{"CONTAINER_ID": "c1", "AGENT_ID": "agent-1", "FRAMEWORK_NAME": "marathon",
+				"TASK_NAME": "web"},
+		},
+		{
+			// the task of a pod container is ambiguous.
+			fields: map[string]string{"CONTAINER_ID": "c2", "AGENT_ID": "kept"},
+			expect: map[string]string{"CONTAINER_ID": "c2", "AGENT_ID": "kept", "FRAMEWORK_NAME": "marathon"},
+		},
+		{
+			fields: map[string]string{"CONTAINER_ID": "nested", "MESOS_TASK_ID": "pod.b"},
+			expect: map[string]string{"CONTAINER_ID": "nested", "MESOS_TASK_ID": "pod.b", "AGENT_ID": "agent-1",
+				"FRAMEWORK_NAME": "marathon", "TASK_NAME": "b"},
+		},
+		{
+			fields: map[string]string{"CONTAINER_ID": "unknown"},
+			expect: map[string]string{"CONTAINER_ID": "unknown"},
+		},
+	} {
+		index.enrich(tc.fields)
+		if !reflect.DeepEqual(tc.fields, tc.expect) {
+			t.Fatalf("expect %v. Got %v", tc.expect, tc.fields)
+		}
+	}
+
+	now := time.Unix(0, 0)
+	cache := newTaskIndexCache()
+	cache.now = func() time.Time { return now }
+	cache.add("k", index, time.Second)
+	if cached, ok := cache.get("k"); !ok || cached != index {
+		t.Fatal("expect the cached index")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := cache.get("k"); ok || len(cache.entries) != 0 {
+		t.Fatal("expect the expired index removed")
+	}
+}
+
+// rangeJournal ends following a FakeJournal once there is no new entry, like a reader with an until time.
+type rangeJournal struct {
+	*testutil.FakeJournal
+}
+
+func (j rangeJournal) Follow(wait time.Duration, writer io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := j.FakeJournal.Follow(wait, buf); err != nil {
+		return err
+	}
+
+	if buf.Len() == 0 {
+		return jr.ErrRangeEnd
+	}
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+func TestServeJournal(t *testing.T) {
+	fixture := testutil.JournalFixture("dcos-mesos-slave.service", 3)
+	j := testutil.NewFakeJournal(jr.FormatText{}, fixture[:2]...)
+	req := httptest.NewRequest("GET", "/v2/component", nil)
+
+	w := httptest.NewRecorder()
+	serveJournal(w, req, j, false, false)
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 2 ||
+		!strings.Contains(w.Body.String(), "dcos-mesos-slave.service entry 1") {
+		t.Fatalf("expect 2 entries. Got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	serveJournal(w, req, j, false, false)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expect 204 once the entries were read. Got %d %q", w.Code, w.Body.String())
+	}
+
+	j.Append(fixture[2])
+	w = httptest.NewRecorder()
+	serveJournal(w, req, rangeJournal{j}, false, true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "dcos-mesos-slave.service entry 2") {
+		t.Fatalf("expect the appended entry. Got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// grpcCall calls a method of the Logs service with an HTTP/2 client without TLS, it returns the LogEntry messages
+// and the status of the call.
+func grpcCall(t *testing.T, serverURL, method string, msg []byte) ([]grpcLogLine, string, string) {
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	defer tr.CloseIdleConnections()
+
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	req, err := http.NewRequest("POST", serverURL+"/dcos.log.v1.Logs/"+method, bytes.NewReader(append(body, msg...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Authorization", "token=user")
+
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("expect an HTTP/2 gRPC response. Got %s %d %q", resp.Proto, resp.StatusCode,
+			resp.Header.Get("Content-Type"))
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []grpcLogLine
+	for len(b) > 0 {
+		if len(b) < 5 || int(binary.BigEndian.Uint32(b[1:5])) > len(b)-5 {
+			t.Fatalf("expect length-prefixed messages. Got %q", b)
+		}
+		size := int(binary.BigEndian.Uint32(b[1:5]))
+
+		line := grpcLogLine{Fields: map[string]string{}}
+		err := decodeProto(b[5:5+size], func(field int, v uint64, value []byte) {
+			switch field {
+			case 1:
+				var name, fieldValue string
+				decodeProto(value, func(field int, _ uint64, s []byte) {
+					if field == 1 {
+						name = string(s)
+					} else {
+						fieldValue = string(s)
+					}
+				})
+				line.Fields[name] = fieldValue
+			case 2:
+				line.Cursor = string(value)
+			case 3:
+				line.RealtimeTimestamp = v
+			case 4:
+				line.MonotonicTimestamp = v
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+		b = b[5+size:]
+	}
+
+	status := resp.Trailer
+	if status.Get("Grpc-Status") == "" {
+		status = resp.Header
+	}
+	message, _ := url.PathUnescape(status.Get("Grpc-Message"))
+	return lines, status.Get("Grpc-Status"), message
+}
+
+func TestGRPCLogs(t *testing.T) {
+	var requests []*http.Request
+	logs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.URL.Path == "/task/forbidden/file/stdout" {
+			http.Error(w, "user is not allowed to read the logs", http.StatusForbidden)
+			return
+		}
+
+		io.WriteString(w, `{"fields":{"MESSAGE":"one","_SYSTEMD_UNIT":"dcos-mesos-slave.service"},`+
+			`"cursor":"s=1","monotonic_timestamp":2,"realtime_timestamp":1}`+"\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, `{"fields":{"MESSAGE":"two"},"cursor":"s=2"}`)
+	})
+
+	r := mux.NewRouter()
+	r.Path(grpcPath).Handler(grpcLogsHandler(logs)).Methods("POST")
+	ts := httptest.NewUnstartedServer(r)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	journalReq := &protoBuffer{}
+	journalReq.string(1, "dcos-mesos-slave.service")
+	journalReq.string(2, "STREAM:stdout")
+	journalReq.string(2, "PRIORITY:6")
+	journalReq.uint64(7, 10)
+
+	lines, code, msg := grpcCall(t, ts.URL, "StreamJournal", journalReq.Bytes())
+	expect := []grpcLogLine{
+		{Fields: map[string]string{"MESSAGE": "one", "_SYSTEMD_UNIT": "dcos-mesos-slave.service"}, Cursor: "s=1",
+			RealtimeTimestamp: 1, MonotonicTimestamp: 2},
+		{Fields: map[string]string{"MESSAGE": "two"}, Cursor: "s=2"},
+	}
+	if code != "0" || !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %+v with status 0. Got %+v with status %s %q", expect, lines, code, msg)
+	}
+
+	req := requests[0]
+	if req.Method != "GET" || req.URL.Path != "/component/dcos-mesos-slave.service" ||
+		!reflect.DeepEqual(req.URL.Query()["filter"], []string{"STREAM:stdout", "PRIORITY:6"}) ||
+		req.URL.Query().Get("limit") != "10" || req.URL.Query().Get("follow") != "true" ||
+		req.Header.Get("Accept") != "application/x-ndjson" || req.Header.Get("Authorization") != "token=user" {
+		t.Fatalf("expect a followed NDJSON request of the unit. Got %s %s %v", req.Method, req.URL, req.Header)
+	}
+
+	// the task log is proxied from the agent, the errors are sent as the status of the call.
+	taskReq := &protoBuffer{}
+	taskReq.string(1, "forbidden")
+	lines, code, msg = grpcCall(t, ts.URL, "RangeTaskFile", taskReq.Bytes())
+	if len(lines) != 0 || code != "7" || msg != "user is not allowed to read the logs" {
+		t.Fatalf("expect PERMISSION_DENIED. Got %+v with status %s %q", lines, code, msg)
+	}
+
+	req = requests[1]
+	if req.URL.Query().Get("proxy") != "true" || req.URL.Query().Get("follow") != "" {
+		t.Fatalf("expect a proxied range of the task log. Got %s", req.URL)
+	}
+
+	for _, c := range []struct {
+		method string
+		code   string
+	}{
+		{"RangeTaskFile", "3"},
+		{"Unknown", "12"},
+	} {
+		if _, code, msg := grpcCall(t, ts.URL, c.method, nil); code != c.code {
+			t.Fatalf("expect status %s of %s. Got %s %q", c.code, c.method, code, msg)
+		}
+	}
+}
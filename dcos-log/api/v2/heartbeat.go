@@ -0,0 +1,51 @@
+package v2
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+)
+
+// heartbeat sends an SSE event on a stream which has been quiet for the interval, so that proxies do not
+// close the connection.
+type heartbeat struct {
+	interval time.Duration
+	payload  string
+	last     time.Time
+}
+
+// newHeartbeat returns a heartbeat of task log streams configured by -sandbox-heartbeat and
+// -sandbox-heartbeat-payload.
+func newHeartbeat(req *http.Request) *heartbeat {
+	h := &heartbeat{last: time.Now()}
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok {
+		// validated on startup.
+		h.interval, _ = time.ParseDuration(cfg.FlagSandboxHeartbeat)
+		h.payload = cfg.FlagSandboxHeartbeatPayload
+	}
+	return h
+}
+
+// reset restarts the interval after data was sent.
+func (h *heartbeat) reset() {
+	h.last = time.Now()
+}
+
+// beat writes a heartbeat if the interval has passed since the last write and returns true if it was written.
+// The event is a comment unless the payload is set.
+func (h *heartbeat) beat(w io.Writer) bool {
+	if h.interval <= 0 || time.Since(h.last) < h.interval {
+		return false
+	}
+
+	if h.payload == "" {
+		io.WriteString(w, ": ping\n\n")
+	} else {
+		fmt.Fprintf(w, "event: heartbeat\ndata: %s\n\n", h.payload)
+	}
+	h.reset()
+	return true
+}
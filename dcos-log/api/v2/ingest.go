@@ -0,0 +1,80 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/journal/writer"
+)
+
+// maxIngestBodySize limits the size of a single ingest request.
+const maxIngestBodySize = 1 << 20
+
+// decodeEvents decodes a single event object or an array of events.
+func decodeEvents(body []byte) ([]writer.Event, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var events []writer.Event
+		err := json.Unmarshal(body, &events)
+		return events, err
+	}
+
+	var event writer.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return []writer.Event{event}, nil
+}
+
+// ingestHandler writes structured events to journald. User fields are prefixed with DCOS_APP_.
+func ingestHandler(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxIngestBodySize))
+	if err != nil {
+		logError(w, req, "unable to read request body: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	events, err := decodeEvents(body)
+	if err != nil {
+		logError(w, req, "unable to decode events: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(events) == 0 {
+		logError(w, req, "no events in request", http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range events {
+		if err := writer.Validate(e); err != nil {
+			logError(w, req, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	jw, err := writer.NewWriter()
+	if err != nil {
+		logError(w, req, "unable to create journal writer: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	extra := map[string]string{
+		"DCOS_LOG_SOURCE":      "ingest",
+		"DCOS_LOG_REMOTE_ADDR": req.RemoteAddr,
+	}
+
+	if err := jw.Write(extra, events...); err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		code := http.StatusInternalServerError
+		if err == writer.ErrJournalDisabled {
+			code = http.StatusServiceUnavailable
+		}
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
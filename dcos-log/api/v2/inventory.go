@@ -0,0 +1,156 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// inventoryTask is a task of an executor run listed by the inventory.
+type inventoryTask struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// inventorySandbox is an executor run with a sandbox on the agent. The names and tasks are empty if the executor is
+// no longer in the agent state, the agent keeps a limited number of completed executors.
+type inventorySandbox struct {
+	FrameworkID   string          `json:"framework_id"`
+	FrameworkName string          `json:"framework_name,omitempty"`
+	ExecutorID    string          `json:"executor_id"`
+	ExecutorName  string          `json:"executor_name,omitempty"`
+	ContainerID   string          `json:"container_id"`
+	Tasks         []inventoryTask `json:"tasks"`
+	URL           string          `json:"url"`
+}
+
+// newInventory resolves the names and tasks of the sandboxes from the agent state, state may be nil. The sandboxes
+// of the tasks the user is not allowed to read are left out.
+func newInventory(agentID string, sandboxes []reader.Sandbox, state *agent.State,
+	allowed func(authz.Task) bool) []inventorySandbox {
+	type run struct {
+		framework agent.Framework
+		executor  agent.Executor
+	}
+
+	runs := make(map[reader.Sandbox]run)
+	if state != nil {
+		for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+			for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
+				key := reader.Sandbox{FrameworkID: framework.ID, ExecutorID: executor.ID, ContainerID: executor.Container}
+				runs[key] = run{framework: framework, executor: executor}
+			}
+		}
+	}
+
+	inventory := []inventorySandbox{}
+	for _, sandbox := range sandboxes {
+		if !allowed(authz.Task{FrameworkID: sandbox.FrameworkID, ExecutorID: sandbox.ExecutorID,
+			ContainerID: sandbox.ContainerID}) {
+			continue
+		}
+
+		entry := inventorySandbox{
+			FrameworkID: sandbox.FrameworkID,
+			ExecutorID:  sandbox.ExecutorID,
+			ContainerID: sandbox.ContainerID,
+			Tasks:       []inventoryTask{},
+			URL: fmt.Sprintf("%s/%s/logs/v2/task/frameworks/%s/executors/%s/runs/%s/files/browse", prefix, agentID,
+				sandbox.FrameworkID, sandbox.ExecutorID, sandbox.ContainerID),
+		}
+
+		if r, ok := runs[sandbox]; ok {
+			entry.FrameworkName = r.framework.Name
+			entry.ExecutorName = r.executor.Name
+			for _, task := range append(r.executor.Tasks, r.executor.CompletedTasks...) {
+				entry.Tasks = append(entry.Tasks, inventoryTask{ID: task.ID, Name: task.Name, State: task.State})
+			}
+		}
+		inventory = append(inventory, entry)
+	}
+	return inventory
+}
+
+// tasksHandler lists the sandboxes on the agent with the names of their frameworks, executors and tasks. The
+// sandboxes are found by browsing the agent work directory, so the tasks the agent state no longer knows about
+// are listed too, as long as their sandboxes are not garbage collected.
+func tasksHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, fmt.Sprintf("invalid context, unable to retrieve %T object", cfg), http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, fmt.Sprintf("invalid context, unable to retrieve %T object", client), http.StatusInternalServerError)
+		return
+	}
+
+	nodeInfo, ok := middleware.FromContextNodeInfo(req.Context())
+	if !ok {
+		logError(w, req, fmt.Sprintf("invalid context, unable to retrieve a %T object", nodeInfo),
+			http.StatusInternalServerError)
+		return
+	}
+
+	header := http.Header{}
+	if token, ok := middleware.FromContextToken(req.Context()); ok {
+		header.Set("Authorization", token)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Second*5)
+	defer cancel()
+
+	mesosID, err := nodeInfo.MesosID(nodeutil.NewContextWithHeaders(ctx, header))
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		logError(w, req, "unable to get mesosID: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	agentURL, err := agent.URL(nodeInfo, cfg.FlagAuth)
+	if err != nil {
+		logError(w, req, "unable to run detect_ip: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	browseURL := *agentURL
+	browseURL.Path = "/files/browse"
+	if cfg.FlagFilesAPIOperator {
+		browseURL = reader.OperatorURL(browseURL)
+	}
+	sandboxes, err := reader.AgentSandboxes(client, browseURL, header, cfg.FlagMesosWorkDir, mesosID)
+	if err != nil && err != reader.ErrFileNotFound {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to browse the agent sandboxes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the names are informational, the sandboxes are listed without them.
+	state, err := agent.GetState(ctx, client, *agentURL, header)
+	if err != nil {
+		logrus.Errorf("unable to get agent state: %s", err)
+	}
+
+	uid := middleware.RequestUID(req)
+	inventory := newInventory(mesosID, sandboxes, state, func(task authz.Task) bool {
+		return authz.Default().Allowed(uid, task)
+	})
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(inventory); err != nil {
+		logrus.Errorf("unable to encode the agent inventory: %s", err)
+	}
+}
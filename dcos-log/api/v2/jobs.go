@@ -0,0 +1,741 @@
+package v2
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// statuses of an export job.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+const (
+	// maxJobSpecSize is the maximum size of the JSON spec of an export job.
+	maxJobSpecSize = 1 << 20
+
+	// maxPartErrorSize is the size of the error responses kept in the status of a job.
+	maxPartErrorSize = 1 << 10
+)
+
+var (
+	// errTooManyJobs is returned when -export-jobs-max jobs are queued or running.
+	errTooManyJobs = errors.New("too many export jobs, retry later")
+
+	// errJobNotFound is returned for the unknown jobs and the jobs of other users.
+	errJobNotFound = errors.New("export job not found")
+)
+
+// jobNamePattern matches the units, the IDs and the file names of a job spec, they are parts of the archive paths.
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@:-]+$`)
+
+// exportJobTask is a task whose log files are exported, stdout and stderr by default.
+type exportJobTask struct {
+	FrameworkID string   `json:"framework_id"`
+	ExecutorID  string   `json:"executor_id"`
+	ContainerID string   `json:"container_id"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// exportJobSpec is the request of an export job. Since and until are RFC3339 times or durations relative to the
+// submission of the job. Without units and tasks the whole journal is exported.
+type exportJobSpec struct {
+	Since       string          `json:"since,omitempty"`
+	Until       string          `json:"until,omitempty"`
+	Units       []string        `json:"units,omitempty"`
+	Tasks       []exportJobTask `json:"tasks,omitempty"`
+	Format      string          `json:"format,omitempty"`
+	Compression string          `json:"compression,omitempty"`
+
+	since, until time.Time
+}
+
+// validName returns an error if s is not a valid component of an archive path.
+func validName(kind, s string) error {
+	if !jobNamePattern.MatchString(s) || s == "." || s == ".." {
+		return fmt.Errorf("invalid %s %q", kind, s)
+	}
+	return nil
+}
+
+// validate checks the spec and sets its defaults, the times are resolved against now.
+func (s *exportJobSpec) validate() error {
+	var err error
+	if s.since, err = parseTimeParam(s.Since); err != nil {
+		return fmt.Errorf("unable to parse since: %s", err)
+	}
+
+	if s.until, err = parseTimeParam(s.Until); err != nil {
+		return fmt.Errorf("unable to parse until: %s", err)
+	}
+
+	if !s.since.IsZero() && !s.until.IsZero() && !s.since.Before(s.until) {
+		return errors.New("since must be before until")
+	}
+
+	if s.Format == "" {
+		s.Format = "json"
+	}
+
+	if _, ok := formatContentType(s.Format); !ok {
+		return fmt.Errorf("unknown format %s", s.Format)
+	}
+
+	switch s.Compression {
+	case "":
+		s.Compression = "gzip"
+	case "gzip", "none":
+	default:
+		return fmt.Errorf("unknown compression %s, use gzip or none", s.Compression)
+	}
+
+	for _, unit := range s.Units {
+		if err := validName("unit", unit); err != nil {
+			return err
+		}
+	}
+
+	for i := range s.Tasks {
+		t := &s.Tasks[i]
+		for kind, id := range map[string]string{"framework_id": t.FrameworkID, "executor_id": t.ExecutorID,
+			"container_id": t.ContainerID} {
+			if err := validName(kind, id); err != nil {
+				return err
+			}
+		}
+
+		if len(t.Files) == 0 {
+			t.Files = []string{"stdout", "stderr"}
+		}
+
+		for _, file := range t.Files {
+			if err := validName("file", file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jobPartRequest is a file of the archive and the request of the v2 endpoint it is read from.
+type jobPartRequest struct {
+	name   string
+	target string
+	accept string
+}
+
+// parts returns the files of the archive: a file by unit, the whole journal without units and tasks, and a file by
+// task log.
+func (s *exportJobSpec) parts() []jobPartRequest {
+	_, ext := exportFormat(s.Format)
+
+	query := url.Values{formatParam: {s.Format}}
+	if !s.since.IsZero() {
+		query.Set(sinceParam, s.since.UTC().Format(time.RFC3339Nano))
+	}
+
+	if !s.until.IsZero() {
+		query.Set(untilParam, s.until.UTC().Format(time.RFC3339Nano))
+	}
+
+	var parts []jobPartRequest
+	for _, unit := range s.Units {
+		parts = append(parts, jobPartRequest{
+			name:   path.Join("units", unit+ext),
+			target: path.Join(componentPath, unit) + "?" + query.Encode(),
+		})
+	}
+
+	if len(s.Units) == 0 && len(s.Tasks) == 0 {
+		parts = append(parts, jobPartRequest{name: "journal" + ext, target: componentPath + "?" + query.Encode()})
+	}
+
+	// the task logs have no time range, their lines are not timestamped by the agent.
+	accept, taskExt := jr.ContentTypePlainText.String(), ".log"
+	switch s.Format {
+	case "json", "ndjson":
+		accept, taskExt = jr.ContentTypeNDJSON.String(), ".ndjson"
+	case "gelf":
+		accept, taskExt = jr.ContentTypeGELF.String(), ".gelf"
+	}
+
+	for _, t := range s.Tasks {
+		run := path.Join("/task/frameworks", t.FrameworkID, "executors", t.ExecutorID, "runs", t.ContainerID)
+		for _, file := range t.Files {
+			parts = append(parts, jobPartRequest{
+				name:   path.Join("tasks", t.ContainerID, file+taskExt),
+				target: path.Join(run, file),
+				accept: accept,
+			})
+		}
+	}
+	return parts
+}
+
+// exportJobPart is the status of a file of the archive, a part which failed is not in the archive.
+type exportJobPart struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// exportJob is an export run in the background, its archive is downloaded once the job is done.
+type exportJob struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	Spec     exportJobSpec   `json:"spec"`
+	Created  time.Time       `json:"created"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Parts    []exportJobPart `json:"parts"`
+	Bytes    int64           `json:"bytes"`
+	Error    string          `json:"error,omitempty"`
+
+	uid    string
+	path   string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// detachedContext keeps the values of the request context, such as the config and the token of the user, without
+// its cancellation, an export job outlives the request which submitted it.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// exportJobs runs the export jobs one at a time, a job reads the parts of its archive with the v2 endpoints of
+// handler. The jobs are kept in memory, the archives left by a previous process are removed.
+type exportJobs struct {
+	dir       string
+	max       int
+	retention time.Duration
+	rate      int
+	handler   http.Handler
+
+	mu    sync.Mutex
+	jobs  map[string]*exportJob
+	queue chan *exportJob
+}
+
+// newExportJobs starts the worker of the export jobs.
+func newExportJobs(dir string, max int, retention time.Duration, rate int, handler http.Handler) *exportJobs {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "dcos-log-exports")
+	}
+
+	if max < 1 {
+		max = 1
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tar*"))
+	for _, f := range leftovers {
+		os.Remove(f)
+	}
+
+	q := &exportJobs{
+		dir:       dir,
+		max:       max,
+		retention: retention,
+		rate:      rate,
+		handler:   handler,
+		jobs:      make(map[string]*exportJob),
+		queue:     make(chan *exportJob, max),
+	}
+	go q.work()
+	return q
+}
+
+// exportJobRouter routes the requests of the export jobs to the journal and task log handlers, without the
+// middlewares of the API: the context of a job already has the config, the client and the token of its user.
+func exportJobRouter() http.Handler {
+	r := mux.NewRouter()
+	r.Path(componentPath).HandlerFunc(journalHandler)
+	r.Path(path.Join(componentPath, "/{name}")).HandlerFunc(journalHandler)
+	r.Path(path.Join(taskPath, "/{file}")).HandlerFunc(filesAPIHandler)
+	return r
+}
+
+// submit queues a job of a user, ctx is the context of the request without its cancellation.
+func (q *exportJobs) submit(ctx context.Context, uid string, spec exportJobSpec) (exportJob, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return exportJob{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := 0
+	for _, job := range q.jobs {
+		if job.Status == jobQueued || job.Status == jobRunning {
+			pending++
+		}
+	}
+
+	if pending >= q.max {
+		return exportJob{}, errTooManyJobs
+	}
+
+	ext := ".tar"
+	if spec.Compression == "gzip" {
+		ext += ".gz"
+	}
+
+	job := &exportJob{
+		ID:      hex.EncodeToString(b),
+		Status:  jobQueued,
+		Spec:    spec,
+		Created: time.Now().UTC(),
+		Parts:   []exportJobPart{},
+		uid:     uid,
+	}
+	job.path = filepath.Join(q.dir, job.ID+ext)
+	job.ctx, job.cancel = context.WithCancel(detachedContext{ctx})
+
+	// the canceled jobs stay in the queue until the worker skips them.
+	select {
+	case q.queue <- job:
+	default:
+		return exportJob{}, errTooManyJobs
+	}
+
+	q.jobs[job.ID] = job
+	return *job, nil
+}
+
+// get returns a copy of a job of a user.
+func (q *exportJobs) get(uid, id string) (exportJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok || job.uid != uid {
+		return exportJob{}, errJobNotFound
+	}
+
+	c := *job
+	c.Parts = append([]exportJobPart{}, job.Parts...)
+	return c, nil
+}
+
+// list returns the jobs of a user, the oldest first.
+func (q *exportJobs) list(uid string) []exportJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := []exportJob{}
+	for _, job := range q.jobs {
+		if job.uid == uid {
+			c := *job
+			c.Parts = append([]exportJobPart{}, job.Parts...)
+			jobs = append(jobs, c)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// remove cancels a job of a user and removes it with its archive. uid is ignored if empty.
+func (q *exportJobs) remove(uid, id string) error {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok || (uid != "" && job.uid != uid) {
+		q.mu.Unlock()
+		return errJobNotFound
+	}
+
+	delete(q.jobs, id)
+	running := job.Status == jobRunning
+	if job.Status == jobQueued || running {
+		job.Status = jobCanceled
+	}
+	q.mu.Unlock()
+
+	job.cancel()
+
+	// the worker removes the archive of a running job once it has stopped writing it.
+	if !running {
+		os.Remove(job.path)
+	}
+	return nil
+}
+
+// work runs the queued jobs.
+func (q *exportJobs) work() {
+	for job := range q.queue {
+		q.run(job)
+	}
+}
+
+// setStatus sets the status of a job unless it was canceled.
+func (q *exportJobs) setStatus(job *exportJob, status string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job.Status == jobCanceled {
+		return false
+	}
+	job.Status = status
+	return true
+}
+
+// run writes the archive of a job and schedules its removal after the retention.
+func (q *exportJobs) run(job *exportJob) {
+	if !q.setStatus(job, jobRunning) {
+		return
+	}
+
+	size, err := q.writeArchive(job)
+
+	q.mu.Lock()
+	now := time.Now().UTC()
+	job.Finished = &now
+	job.Bytes = size
+	canceled := job.Status == jobCanceled
+	switch {
+	case canceled:
+	case err != nil:
+		job.Status, job.Error = jobFailed, err.Error()
+	default:
+		job.Status = jobDone
+	}
+	q.mu.Unlock()
+
+	if canceled || err != nil {
+		os.Remove(job.path)
+	}
+
+	if err != nil && !canceled {
+		logrus.Errorf("Export job %s failed: %s", job.ID, err)
+	}
+
+	if !canceled {
+		time.AfterFunc(q.retention, func() { q.remove("", job.ID) })
+	}
+}
+
+// writeArchive writes the parts of a job to its tar archive and returns the size of the archive.
+func (q *exportJobs) writeArchive(job *exportJob) (int64, error) {
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return 0, err
+	}
+
+	f, err := ioutil.TempFile(q.dir, job.ID+".tar.")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var (
+		out io.Writer = f
+		gz  *gzip.Writer
+	)
+	if job.Spec.Compression == "gzip" {
+		gz = gzip.NewWriter(f)
+		out = gz
+	}
+
+	tw := tar.NewWriter(out)
+	for _, p := range job.Spec.parts() {
+		part, err := q.writePart(job, tw, p)
+		if err != nil {
+			return 0, err
+		}
+
+		q.mu.Lock()
+		job.Parts = append(job.Parts, part)
+		q.mu.Unlock()
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(f.Name(), job.path)
+}
+
+// writePart reads a part of a job to a temp file, its size is only known at the end, and adds it to the archive.
+// A part the endpoint responds to with an error is recorded in the status of the job and skipped.
+func (q *exportJobs) writePart(job *exportJob, tw *tar.Writer, p jobPartRequest) (exportJobPart, error) {
+	part := exportJobPart{Name: p.name}
+
+	tmp, err := ioutil.TempFile(q.dir, job.ID+".part.")
+	if err != nil {
+		return part, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	req, err := http.NewRequest(http.MethodGet, p.target, nil)
+	if err != nil {
+		return part, err
+	}
+
+	if p.accept != "" {
+		req.Header.Set("Accept", p.accept)
+	}
+
+	w := &partResponseWriter{header: make(http.Header), w: &rateWriter{w: tmp, rate: q.rate, ctx: job.ctx}}
+	q.handler.ServeHTTP(w, req.WithContext(job.ctx))
+
+	if err := job.ctx.Err(); err != nil {
+		return part, err
+	}
+
+	if w.code >= http.StatusMultipleChoices {
+		part.Error = fmt.Sprintf("%d %s", w.code, strings.TrimSpace(w.body.String()))
+		return part, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return part, err
+	}
+
+	hdr := &tar.Header{Name: p.name, Mode: 0644, Size: w.n, ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return part, err
+	}
+
+	part.Bytes, err = io.Copy(tw, tmp)
+	return part, err
+}
+
+// partResponseWriter writes the response of a part to a file, the body of an error response is kept instead.
+type partResponseWriter struct {
+	header http.Header
+	code   int
+	w      io.Writer
+	n      int64
+	body   bytes.Buffer
+}
+
+func (p *partResponseWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *partResponseWriter) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+}
+
+func (p *partResponseWriter) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	if p.code >= http.StatusMultipleChoices {
+		if room := maxPartErrorSize - p.body.Len(); room > 0 {
+			if room > len(b) {
+				room = len(b)
+			}
+			p.body.Write(b[:room])
+		}
+		return len(b), nil
+	}
+
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	return n, err
+}
+
+func (p *partResponseWriter) Flush() {}
+
+// rateWriter limits the bytes written per second, the reads of the journal and the files API are slowed down by
+// the writes of their response. A rate of 0 is unlimited.
+type rateWriter struct {
+	w     io.Writer
+	rate  int
+	ctx   context.Context
+	start time.Time
+	n     int64
+}
+
+func (r *rateWriter) Write(b []byte) (int, error) {
+	if r.rate <= 0 {
+		return r.w.Write(b)
+	}
+
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	n, err := r.w.Write(b)
+	r.n += int64(n)
+
+	wait := time.Duration(r.n)*time.Second/time.Duration(r.rate) - time.Since(r.start)
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// exportJobQueue is the queue of the export jobs, initialized by InitRoutes.
+var exportJobQueue *exportJobs
+
+// initExportJobs starts the queue of the export jobs of the config.
+func initExportJobs(cfg *config.Config) {
+	retention, _ := time.ParseDuration(cfg.FlagExportJobsRetention)
+	exportJobQueue = newExportJobs(cfg.FlagExportJobsDir, cfg.FlagExportJobsMax, retention, cfg.FlagExportJobsRateLimit,
+		exportJobRouter())
+}
+
+func writeJob(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Error writing to client: %s", err)
+	}
+}
+
+// submitJobHandler queues an export job of the JSON spec of the request body, the response is the job with its
+// status URL in the header Location. The job reads the journal and the task logs with the permissions of the
+// user, without the deadline of the range requests.
+func submitJobHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	var spec exportJobSpec
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxJobSpecSize)).Decode(&spec); err != nil {
+		logError(w, req, "invalid export job spec: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := spec.validate(); err != nil {
+		logError(w, req, "invalid export job spec: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobCfg := *cfg
+	jobCfg.FlagRangeTimeout = "0"
+	ctx := middleware.WithConfigContext(req.Context(), &jobCfg)
+
+	job, err := exportJobQueue.submit(ctx, middleware.RequestUID(req), spec)
+	switch err {
+	case nil:
+	case errTooManyJobs:
+		logError(w, req, err.Error(), http.StatusTooManyRequests)
+		return
+	default:
+		logError(w, req, "unable to submit export job: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	location := *req.URL
+	location.Path = path.Join(req.URL.Path, job.ID)
+	location.RawQuery = ""
+	w.Header().Set("Location", location.String())
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// listJobsHandler returns the export jobs of the user.
+func listJobsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJob(w, http.StatusOK, exportJobQueue.list(middleware.RequestUID(req)))
+}
+
+// jobHandler returns the status of an export job of the user.
+func jobHandler(w http.ResponseWriter, req *http.Request) {
+	job, err := exportJobQueue.get(middleware.RequestUID(req), mux.Vars(req)["id"])
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+// jobArchiveHandler downloads the archive of a done export job of the user, the Range requests resume a download.
+func jobArchiveHandler(w http.ResponseWriter, req *http.Request) {
+	job, err := exportJobQueue.get(middleware.RequestUID(req), mux.Vars(req)["id"])
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if job.Status != jobDone {
+		logError(w, req, "export job is "+job.Status, http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(job.path)
+	if err != nil {
+		logError(w, req, "export job archive was removed", http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	contentType, name := "application/x-tar", filepath.Base(job.path)
+	if job.Spec.Compression == "gzip" {
+		contentType = "application/gzip"
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		name = hostname + "-" + name
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, req, name, *job.Finished, f)
+}
+
+// deleteJobHandler cancels an export job of the user and removes its archive.
+func deleteJobHandler(w http.ResponseWriter, req *http.Request) {
+	if err := exportJobQueue.remove(middleware.RequestUID(req), mux.Vars(req)["id"]); err != nil {
+		logError(w, req, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
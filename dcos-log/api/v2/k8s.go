@@ -0,0 +1,400 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// k8sSystemNamespace is a namespace of pods which are mapped to DC/OS components on the local node.
+const k8sSystemNamespace = "dcos-system"
+
+// errLimitBytes is returned by limitWriter when limitBytes parameter is reached.
+var errLimitBytes = errors.New("limitBytes reached")
+
+// k8sLogOptions are the query parameters of kubelet log API.
+// https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.10/#read-log
+type k8sLogOptions struct {
+	container  string
+	follow     bool
+	timestamps bool
+
+	// tailLines < 0 means all lines.
+	tailLines int
+	since     time.Time
+
+	// limitBytes 0 means no limit.
+	limitBytes int64
+}
+
+func parseK8sBool(query url.Values, name string) (bool, error) {
+	s := query.Get(name)
+	if s == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse %s parameter: %s", name, s)
+	}
+	return b, nil
+}
+
+// parseK8sLogOptions parses kubelet log API parameters. Container defaults to stdout, since both sandbox
+// files and components have a single output.
+func parseK8sLogOptions(query url.Values, now time.Time) (*k8sLogOptions, error) {
+	opts := &k8sLogOptions{
+		container: query.Get("container"),
+		tailLines: -1,
+	}
+
+	if opts.container == "" {
+		opts.container = "stdout"
+	}
+
+	var err error
+	if opts.follow, err = parseK8sBool(query, "follow"); err != nil {
+		return nil, err
+	}
+
+	if opts.timestamps, err = parseK8sBool(query, "timestamps"); err != nil {
+		return nil, err
+	}
+
+	previous, err := parseK8sBool(query, "previous")
+	if err != nil {
+		return nil, err
+	}
+
+	if previous {
+		return nil, errors.New("previous parameter is not supported, use the task ID of the previous run")
+	}
+
+	if s := query.Get("tailLines"); s != "" {
+		opts.tailLines, err = strconv.Atoi(s)
+		if err != nil || opts.tailLines < 0 {
+			return nil, fmt.Errorf("unable to parse tailLines parameter: %s", s)
+		}
+	}
+
+	sinceSeconds, sinceTime := query.Get("sinceSeconds"), query.Get("sinceTime")
+	if sinceSeconds != "" && sinceTime != "" {
+		return nil, errors.New("at most one of sinceSeconds or sinceTime may be specified")
+	}
+
+	if sinceSeconds != "" {
+		seconds, err := strconv.Atoi(sinceSeconds)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("unable to parse sinceSeconds parameter: %s", sinceSeconds)
+		}
+		opts.since = now.Add(-time.Duration(seconds) * time.Second)
+	}
+
+	if sinceTime != "" {
+		opts.since, err = time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse sinceTime parameter: %s", sinceTime)
+		}
+	}
+
+	if s := query.Get("limitBytes"); s != "" {
+		opts.limitBytes, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || opts.limitBytes <= 0 {
+			return nil, fmt.Errorf("unable to parse limitBytes parameter: %s", s)
+		}
+	}
+
+	return opts, nil
+}
+
+// limitWriter writes at most n bytes to w and returns errLimitBytes after that.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errLimitBytes
+	}
+
+	if int64(len(p)) <= l.n {
+		n, err := l.w.Write(p)
+		l.n -= int64(n)
+		return n, err
+	}
+
+	n, err := l.w.Write(p[:l.n])
+	l.n -= int64(n)
+	if err == nil {
+		err = errLimitBytes
+	}
+	return n, err
+}
+
+func k8sWriter(w io.Writer, opts *k8sLogOptions) io.Writer {
+	if opts.limitBytes > 0 {
+		return &limitWriter{w: w, n: opts.limitBytes}
+	}
+	return w
+}
+
+// k8sEntryFormatter formats journal entries the way kubelet does, a raw message per line optionally
+// prefixed with RFC3339 timestamp.
+type k8sEntryFormatter struct {
+	timestamps bool
+	since      time.Time
+}
+
+func (f k8sEntryFormatter) GetContentType() jr.ContentType {
+	return jr.ContentTypePlainText
+}
+
+func (f k8sEntryFormatter) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	message, ok := entry.Fields["MESSAGE"]
+	if !ok {
+		return nil, nil
+	}
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	if !f.since.IsZero() && t.Before(f.since) {
+		return nil, nil
+	}
+
+	if f.timestamps {
+		return []byte(t.UTC().Format(time.RFC3339Nano) + " " + message + "\n"), nil
+	}
+	return []byte(message + "\n"), nil
+}
+
+// k8sPodLogHandler implements kubelet pod log API. Pods in dcos-system namespace are DC/OS components
+// running on the local node, in any other namespace a pod is a task ID and the request is redirected
+// to the agent running the task.
+func k8sPodLogHandler(w http.ResponseWriter, req *http.Request) {
+	opts, err := parseK8sLogOptions(req.URL.Query(), time.Now())
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(req)
+	if vars["namespace"] == k8sSystemNamespace {
+		k8sComponentLogs(w, req, vars["pod"], opts)
+		return
+	}
+
+	canonicalTaskID, code, err := taskCanonicalID(req, vars["pod"])
+	if err != nil {
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	http.Redirect(w, req, k8sRedirectURL(canonicalTaskID, req.URL.RawQuery), http.StatusSeeOther)
+}
+
+func k8sRedirectURL(id *nodeutil.CanonicalTaskID, rawQuery string) string {
+	isPod := id.ExecutorID != ""
+	executorID := id.ExecutorID
+	if !isPod {
+		executorID = id.ID
+	}
+
+	taskLogURL := fmt.Sprintf("%s/%s/logs/v2/k8s/task/frameworks/%s/executors/%s/runs/%s", prefix, id.AgentID,
+		id.FrameworkID, executorID, id.ContainerIDs[len(id.ContainerIDs)-1])
+
+	if isPod {
+		taskLogURL += path.Join("/tasks", id.ID)
+	}
+
+	taskLogURL += "/log"
+	if rawQuery != "" {
+		taskLogURL += "?" + rawQuery
+	}
+	return taskLogURL
+}
+
+func k8sComponentLogs(w http.ResponseWriter, req *http.Request, name string, opts *k8sLogOptions) {
+	formatter := transformFormatter(req, k8sEntryFormatter{timestamps: opts.timestamps, since: opts.since})
+	journalOpts := []jr.Option{
+		optJournalDirs(req),
+		jr.OptionContext(req.Context()),
+		optMaxEntrySize(req),
+		jr.OptionMatchOR([]jr.JournalEntryMatch{
+			{
+				Field: "UNIT",
+				Value: name,
+			},
+			{
+				Field: "_SYSTEMD_UNIT",
+				Value: name,
+			},
+		}),
+	}
+
+	// the formatter drops the entries before since, so it's safe to move the cursor back by tailLines.
+	if opts.tailLines >= 0 {
+		journalOpts = append(journalOpts, jr.OptionSkipPrev(uint64(opts.tailLines)))
+	} else if !opts.since.IsZero() {
+		journalOpts = append(journalOpts, jr.OptionSince(time.Since(opts.since)))
+	}
+
+	j, err := jr.NewReader(formatter, journalOpts...)
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamJournald)
+		logError(w, req, "unable to open journald: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err := j.Close()
+		if err != nil {
+			logrus.Errorf("error closing journald: %s", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", formatter.GetContentType().String())
+	w.Header().Set("Cache-Control", "no-cache")
+
+	out := k8sWriter(w, opts)
+	if _, err := io.Copy(out, j); err != nil {
+		if err != errLimitBytes && req.Context().Err() == nil {
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
+			logrus.Errorf("unable to read the journal: %s. Request: %s", err, req.RequestURI)
+		}
+		return
+	}
+
+	if !opts.follow {
+		return
+	}
+
+	w.Header().Set("X-Accel-Buffering", "no")
+	f, ok := w.(http.Flusher)
+	if !ok {
+		logError(w, req, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
+		return
+	}
+
+	f.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			logrus.Debugf("closing a client connection.")
+			return
+		case <-time.After(time.Second):
+			if err := j.Follow(time.Millisecond*100, out); err != nil {
+				if err != errLimitBytes && req.Context().Err() == nil {
+					middleware.UpstreamError(req, middleware.UpstreamJournald)
+					logrus.Errorf("error reading journal %s", err)
+				}
+				return
+			}
+			f.Flush()
+		}
+	}
+}
+
+// k8sTaskLogHandler serves kubelet log API for a sandbox file on the local agent. The container parameter
+// is a sandbox file name. Sandbox files have no per line timestamps, sinceSeconds, sinceTime and timestamps
+// are ignored with a warning.
+func k8sTaskLogHandler(w http.ResponseWriter, req *http.Request) {
+	opts, err := parseK8sLogOptions(req.URL.Query(), time.Now())
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	readerOpts := []reader.Option{reader.OptFile(opts.container), reader.OptStream(opts.follow)}
+	if opts.tailLines >= 0 {
+		cursorOpts, err := optCursor(cursorEndParam)
+		if err != nil {
+			logError(w, req, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		readerOpts = append(readerOpts, cursorOpts...)
+		readerOpts = append(readerOpts, skipOptions(-opts.tailLines)...)
+	}
+
+	r, err := setupFilesAPIReader(req, "/files/read", readerOpts...)
+	switch err {
+	case nil:
+	case reader.ErrFileNotFound:
+		logError(w, req, "File not found", http.StatusNotFound)
+		return
+	default:
+		e, ok := err.(errSetupFilesAPIReader)
+		if !ok {
+			middleware.UpstreamError(req, middleware.UpstreamAgent)
+			logError(w, req, "unable to initialize files API reader: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logError(w, req, e.msg, e.code)
+		return
+	}
+
+	if opts.timestamps || !opts.since.IsZero() {
+		w.Header().Set("Warning", `299 - "timestamps, sinceSeconds and sinceTime are not supported for sandbox files"`)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		logError(w, req, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
+		return
+	}
+
+	if opts.follow {
+		w.Header().Set("X-Accel-Buffering", "no")
+		f.Flush()
+	}
+
+	out := k8sWriter(w, opts)
+	for {
+		_, err := io.Copy(out, r)
+		switch err {
+		case nil:
+			if !opts.follow {
+				return
+			}
+		case reader.ErrNoData:
+			if !opts.follow {
+				continue
+			}
+		case errLimitBytes:
+			return
+		case reader.ErrFileNotFound:
+			logError(w, req, "File not found", http.StatusNotFound)
+			return
+		default:
+			if req.Context().Err() == nil {
+				middleware.UpstreamError(req, middleware.UpstreamAgent)
+				logrus.Errorf("unexpected error while reading the logs: %s. Request: %s", err, req.RequestURI)
+			}
+			return
+		}
+
+		f.Flush()
+		select {
+		case <-req.Context().Done():
+			logrus.Debugf("Closing a client connection. Request URI: %s", req.RequestURI)
+			return
+		case <-time.After(time.Millisecond * 500):
+		}
+	}
+}
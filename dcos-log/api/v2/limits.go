@@ -0,0 +1,44 @@
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+)
+
+// limitCap rejects the requests with a limit parameter above -max-limit with 422 Unprocessable Entity, so a single
+// request cannot make the server read and send millions of entries at once. An invalid limit is passed on, the
+// handlers reject it with 400.
+func limitCap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if max := maxLimit(req); max > 0 {
+			limit, err := strconv.Atoi(req.URL.Query().Get(limitParam))
+			if err == nil && limit > max {
+				logError(w, req, fmt.Sprintf("limit %d exceeds the maximum of %d entries, read the log in pages "+
+					"with cursor and skip parameters", limit, max), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// maxLimit returns -max-limit, 0 if there is no maximum.
+func maxLimit(req *http.Request) int {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return 0
+	}
+	return cfg.FlagMaxLimit
+}
+
+// maxRangeBytes returns -max-range-bytes, 0 if there is no maximum.
+func maxRangeBytes(req *http.Request) int {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return 0
+	}
+	return cfg.FlagMaxRangeBytes
+}
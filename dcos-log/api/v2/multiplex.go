@@ -0,0 +1,290 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/authz"
+	"github.com/dcos/dcos-log/dcos-log/mesos/master"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// agentTaskLogsPath is a path of dcos-log v2 API behind agent admin router.
+	agentTaskLogsPath = "/system/v1/logs/v2"
+
+	// multiplexMaxTasks is the maximum number of tasks of a multiplexed stream.
+	multiplexMaxTasks = 50
+
+	taskParam = "task"
+	fileParam = "file"
+)
+
+// multiplexFiles are the files of a task read if the request has no file parameter.
+var multiplexFiles = []string{"stdout", "stderr"}
+
+// taskTarget returns the target of a file of a task, the entries are tagged with task_id and file.
+func taskTarget(id *nodeutil.CanonicalTaskID, file string, agent master.Agent, scheme string, port int,
+	query url.Values, sse bool) fanoutTarget {
+	return fanoutTarget{
+		agent: agent,
+		url: url.URL{
+			Scheme:   scheme,
+			Host:     net.JoinHostPort(agent.Hostname, strconv.Itoa(port)),
+			Path:     agentTaskLogsPath + path.Join(taskLogPath(id), file),
+			RawQuery: query.Encode(),
+		},
+		source: id.ID + "/" + file,
+		tags:   map[string]string{"task_id": id.ID, "file": file},
+		text:   !sse,
+	}
+}
+
+// authzTask returns the sandbox of a task checked by the task authorization policy.
+func authzTask(id *nodeutil.CanonicalTaskID) authz.Task {
+	task := authz.Task{
+		FrameworkID: id.FrameworkID,
+		ExecutorID:  id.ExecutorID,
+		ContainerID: id.ContainerIDs[len(id.ContainerIDs)-1],
+	}
+
+	if id.ExecutorID == "" {
+		task.ExecutorID = id.ID
+	} else {
+		task.TaskPath = id.ID
+	}
+	return task
+}
+
+// filesParam returns the file parameters of a request, stdout and stderr by default.
+func filesParam(query url.Values) ([]string, error) {
+	files := query[fileParam]
+	if len(files) == 0 {
+		return multiplexFiles, nil
+	}
+
+	for _, file := range files {
+		if file == "" || path.Base(file) != file {
+			return nil, fmt.Errorf("invalid file parameter: %s", file)
+		}
+	}
+	return files, nil
+}
+
+// streamTasks reads the files of the tasks from dcos-log of their agents as a single stream. The entries are
+// ordered by time with a given delay, see fanout. The query parameters are passed to the agents.
+func streamTasks(w http.ResponseWriter, req *http.Request, ids []*nodeutil.CanonicalTaskID, files []string,
+	query url.Values, delay time.Duration) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve an http client", http.StatusInternalServerError)
+		return
+	}
+
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
+		return
+	}
+
+	uid := middleware.RequestUID(req)
+	for _, id := range ids {
+		if !authz.Default().Allowed(uid, authzTask(id)) {
+			logError(w, req, fmt.Sprintf("user %q is not allowed to read the logs of framework %s", uid, id.FrameworkID),
+				http.StatusForbidden)
+			return
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	agents, err := master.GetAgents(ctx, client, master.URL(cfg.FlagAuth), header)
+	cancel()
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		logError(w, req, "unable to list agents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	agentsByID := make(map[string]master.Agent, len(agents))
+	for _, agent := range agents {
+		agentsByID[agent.ID] = agent
+	}
+
+	scheme := "http"
+	if cfg.FlagAuth {
+		scheme = "https"
+	}
+
+	sse := req.Header.Get("Accept") == eventStreamContentType
+
+	var targets []fanoutTarget
+	for _, id := range ids {
+		agent, ok := agentsByID[id.AgentID]
+		if !ok {
+			logError(w, req, fmt.Sprintf("agent %s of task %s not found", id.AgentID, id.ID), http.StatusNotFound)
+			return
+		}
+
+		for _, file := range files {
+			targets = append(targets, taskTarget(id, file, agent, scheme, cfg.FlagFanoutAgentPort, query, sse))
+		}
+	}
+
+	out := newFanoutWriter(w, sse)
+
+	// the entries are streamed, the request timeout only applies to the requests to the master.
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	logrus.Debugf("reading %d files of %d tasks", len(targets), len(ids))
+	fanout(req.Context(), &streamClient, targets, header, sse, delay, out)
+}
+
+// multiplexHandler streams the files of several tasks, given by task parameters, as a single stream. The files
+// are stdout and stderr unless file parameters are given. Sandbox lines have no timestamp, the entries are sent
+// in the order they are read, tagged with task_id and file. It is only available on master nodes.
+func multiplexHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	taskIDs := query[taskParam]
+	if len(taskIDs) == 0 || len(taskIDs) > multiplexMaxTasks {
+		logError(w, req, fmt.Sprintf("expect 1 to %d task parameters. Got %d", multiplexMaxTasks, len(taskIDs)),
+			http.StatusBadRequest)
+		return
+	}
+
+	files, err := filesParam(query)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ids []*nodeutil.CanonicalTaskID
+	for _, taskID := range taskIDs {
+		id, code, err := taskCanonicalID(req, taskID)
+		if err != nil {
+			logError(w, req, err.Error(), code)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	// the lines are ordered by time if the agents extract it.
+	var delay time.Duration
+	if cfg, ok := middleware.FromContextConfig(req.Context()); ok && boolParam(req, timestampParam, false) {
+		// validated on startup.
+		delay, _ = time.ParseDuration(cfg.FlagMergeDelay)
+	}
+
+	// the other parameters are passed to the agents.
+	query.Del(taskParam)
+	query.Del(fileParam)
+	streamTasks(w, req, ids, files, query, delay)
+}
+
+// frameworkLogsHandler streams the files of the running tasks of a framework as a single stream. The entries are
+// ordered by the timestamp at the beginning of the lines where possible, the lines without timestamp are ordered
+// by the time they are read. It is only available on master nodes.
+func frameworkLogsHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve an http client", http.StatusInternalServerError)
+		return
+	}
+
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
+		return
+	}
+
+	query := req.URL.Query()
+	files, err := filesParam(query)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	frameworkID := mux.Vars(req)["frameworkID"]
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	tasks, err := master.GetFrameworkTasks(ctx, client, master.URL(cfg.FlagAuth), header, frameworkID)
+	cancel()
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		logError(w, req, "unable to list tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := runningTasks(tasks)
+	switch {
+	case len(ids) == 0:
+		logError(w, req, fmt.Sprintf("framework %s has no running tasks", frameworkID), http.StatusNotFound)
+		return
+	case len(ids) > multiplexMaxTasks:
+		logError(w, req, fmt.Sprintf("framework %s has %d running tasks, at most %d can be aggregated. Use %s",
+			frameworkID, len(ids), multiplexMaxTasks, path.Join("/v2", multiplexPath)), http.StatusBadRequest)
+		return
+	}
+
+	// validated on startup.
+	delay, _ := time.ParseDuration(cfg.FlagMergeDelay)
+
+	// the agents extract the time of the lines, unless it's disabled.
+	if query.Get(timestampParam) == "" {
+		query.Set(timestampParam, "true")
+	}
+
+	query.Del(fileParam)
+	streamTasks(w, req, ids, files, query, delay)
+}
+
+// runningTasks returns the canonical IDs of the running tasks, the tasks without container are skipped.
+func runningTasks(tasks []nodeutil.Task) []*nodeutil.CanonicalTaskID {
+	var ids []*nodeutil.CanonicalTaskID
+	for _, t := range tasks {
+		if t.State != "TASK_RUNNING" {
+			continue
+		}
+
+		containerIDs, err := t.ContainerIDs()
+		if err != nil {
+			logrus.Debugf("skipping task %s: %s", t.ID, err)
+			continue
+		}
+
+		ids = append(ids, &nodeutil.CanonicalTaskID{
+			ID:           t.ID,
+			AgentID:      t.SlaveID,
+			FrameworkID:  t.FrameworkID,
+			ExecutorID:   t.ExecutorID,
+			ContainerIDs: containerIDs,
+		})
+	}
+	return ids
+}
@@ -0,0 +1,102 @@
+package v2
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a media range of the request header Accept.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// matches returns the specificity of the media range matching a media type, -1 if it does not match.
+func (m mediaRange) matches(mediaType string) int {
+	typ, subtype := mediaType, ""
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		typ, subtype = mediaType[:i], mediaType[i+1:]
+	}
+
+	switch {
+	case m.typ == "*" && m.subtype == "*":
+		return 0
+	case m.typ != typ:
+		return -1
+	case m.subtype == "*":
+		return 1
+	case m.subtype == subtype:
+		return 2
+	}
+	return -1
+}
+
+// parseAccept returns the media ranges of an Accept header, the ranges with invalid q-values are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range strings.Split(accept, ",") {
+		parts := strings.Split(value, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+
+		m := mediaRange{typ: name, q: 1}
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			m.typ, m.subtype = name[:i], name[i+1:]
+		}
+
+		valid := true
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				valid = err == nil && q >= 0 && q <= 1
+				m.q = q
+			}
+		}
+
+		if valid {
+			ranges = append(ranges, m)
+		}
+	}
+	return ranges
+}
+
+// negotiate returns the offered media type a client prefers by the request header Accept. The q-value of an offer
+// is taken from the most specific matching media range, ties are won by the order of the offers. An empty string is
+// returned if none of the offers is acceptable.
+func negotiate(accept string, offers []string) string {
+	ranges := parseAccept(accept)
+
+	var best string
+	bestQ := 0.0
+	for _, offer := range offers {
+		specificity, q := -1, 0.0
+		for _, m := range ranges {
+			if s := m.matches(offer); s > specificity {
+				specificity, q = s, m.q
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// negotiateAccept replaces the request header Accept listing several media ranges or q-values with the offered media
+// type the client prefers, so the handlers compare it with a single content type. The header is kept if none of the
+// offers is acceptable, the handlers send their default format.
+func negotiateAccept(req *http.Request, offers []string) {
+	accept := req.Header.Get("Accept")
+	if !strings.ContainsAny(accept, ",;*") {
+		return
+	}
+
+	if offer := negotiate(accept, offers); offer != "" {
+		req.Header.Set("Accept", offer)
+	}
+}
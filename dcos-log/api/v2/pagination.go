@@ -0,0 +1,115 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+)
+
+const (
+	skipNextParam = "skip_next"
+	skipPrevParam = "skip_prev"
+)
+
+// errSkipParams is returned if more than one of skip, skip_next and skip_prev parameters is set.
+var errSkipParams = errors.New("skip, skip_next and skip_prev parameters cannot be combined")
+
+// pagination is the position and the size of a page of entries. The journal and the task log endpoints accept the
+// same parameters: cursor is the position to start at, BEG and END are the beginning and the end of the log. skip
+// is the number of entries skipped forward from the cursor, negative skip moves backwards. skip_next=N and
+// skip_prev=N are the same as skip=N and skip=-N like in v1 API. limit is the maximum number of entries, 0 is no
+// limit.
+type pagination struct {
+	cursor string
+	skip   int
+	limit  int
+}
+
+// parsePagination parses cursor, skip, skip_next, skip_prev and limit parameters. The errors are the same for
+// every endpoint.
+func parsePagination(query url.Values) (pagination, error) {
+	p := pagination{cursor: query.Get(cursorParam)}
+
+	var err error
+	if p.limit, err = nonNegativeParam(query, limitParam); err != nil {
+		return pagination{}, err
+	}
+
+	skipNext, err := nonNegativeParam(query, skipNextParam)
+	if err != nil {
+		return pagination{}, err
+	}
+
+	skipPrev, err := nonNegativeParam(query, skipPrevParam)
+	if err != nil {
+		return pagination{}, err
+	}
+
+	set := 0
+	for _, name := range []string{skipParam, skipNextParam, skipPrevParam} {
+		if query.Get(name) != "" {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return pagination{}, errSkipParams
+	}
+
+	switch {
+	case query.Get(skipParam) != "":
+		s := query.Get(skipParam)
+		if p.skip, err = strconv.Atoi(s); err != nil {
+			return pagination{}, paramError(skipParam, s, "an integer")
+		}
+	case skipNext > 0:
+		p.skip = skipNext
+	case skipPrev > 0:
+		p.skip = -skipPrev
+	}
+	return p, nil
+}
+
+// nonNegativeParam returns a non-negative integer parameter, 0 if it is not set.
+func nonNegativeParam(query url.Values, name string) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, paramError(name, s, "a non-negative integer")
+	}
+	return v, nil
+}
+
+// paramError is the error of an invalid parameter value.
+func paramError(name, value, expect string) error {
+	return fmt.Errorf("unable to parse %s parameter: must be %s. Got %q", name, expect, value)
+}
+
+// readerOptions returns the files reader options of skip and limit, the cursor is converted by optCursor.
+func (p pagination) readerOptions() []reader.Option {
+	opts := skipOptions(p.skip)
+	if p.limit > 0 {
+		opts = append(opts, reader.OptLines(p.limit))
+	}
+	return opts
+}
+
+// skipOptions returns the files reader options of skip, negative skip reads from the bottom to the top.
+func skipOptions(skip int) []reader.Option {
+	var opts []reader.Option
+	if skip != 0 {
+		opts = append(opts, reader.OptSkip(skip))
+	}
+
+	if skip < 0 {
+		opts = append(opts, reader.OptReadDirection(reader.BottomToTop))
+	}
+	return opts
+}
@@ -0,0 +1,124 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// podTasks returns the tasks of the pod of a request the user may read, the policy is asked once per task. The
+// returned code is an http status code to respond with in case of an error.
+func podTasks(req *http.Request) ([]string, int, error) {
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		return nil, http.StatusUnauthorized, fmt.Errorf("unable to get authorization header from a request")
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	// the policy may allow some tasks of a pod only, the tasks are authorized one by one.
+	r, err := newFilesAPIReader(req, "/files/browse", reader.OptHeaders(header))
+	if err != nil {
+		if e, ok := err.(errSetupFilesAPIReader); ok {
+			return nil, e.code, e
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	tasks, err := r.PodTasks()
+	switch err {
+	case nil:
+		return allowedPodTasks(req, tasks)
+	case reader.ErrFileNotFound:
+		return nil, http.StatusNotFound, fmt.Errorf("pod %s not found", mux.Vars(req)["containerID"])
+	default:
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		return nil, http.StatusInternalServerError, err
+	}
+}
+
+// allowedPodTasks returns the tasks the task authorization policy allows the user to read, 403 if the pod has
+// tasks and none is allowed.
+func allowedPodTasks(req *http.Request, tasks []string) ([]string, int, error) {
+	var (
+		allowed []string
+		denied  error
+	)
+	for _, task := range tasks {
+		if err := authorizeTaskPath(req, task); err != nil {
+			denied = err
+			continue
+		}
+		allowed = append(allowed, task)
+	}
+
+	if len(allowed) == 0 && denied != nil {
+		return nil, http.StatusForbidden, denied
+	}
+	return allowed, http.StatusOK, nil
+}
+
+// podTasksHandler lists the tasks of a pod the user may read.
+func podTasksHandler(w http.ResponseWriter, req *http.Request) {
+	tasks, code, err := podTasks(req)
+	if err != nil {
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	if tasks == nil {
+		tasks = []string{}
+	}
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(map[string][]string{"tasks": tasks}); err != nil {
+		logrus.Errorf("unable to encode pod tasks: %s", err)
+	}
+}
+
+// podLogsHandler reads a file of every task of a pod as a single stream. The lines of text responses are
+// prefixed with the task name in brackets, SSE entries have TASK_PATH field. The tasks without the file are
+// skipped.
+func podLogsHandler(w http.ResponseWriter, req *http.Request) {
+	opts, sse, follow, err := combinedOpts(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, code, err := podTasks(req)
+	if err != nil {
+		logError(w, req, err.Error(), code)
+		return
+	}
+
+	// the tasks are authorized by podTasks.
+	var sources []combinedSource
+	for _, task := range tasks {
+		r, err := newFilesAPIReader(req, "/files/read", append([]reader.Option{reader.OptTaskPath(task)}, opts(task)...)...)
+		if err == reader.ErrFileNotFound {
+			logrus.Debugf("task %s of pod %s has no file %s", task, mux.Vars(req)["containerID"], mux.Vars(req)["file"])
+			continue
+		}
+
+		if err != nil {
+			combinedSetupError(w, req, err)
+			return
+		}
+		sources = append(sources, combinedSource{label: task, r: r})
+	}
+
+	if len(sources) == 0 {
+		logError(w, req, "no task of the pod has file "+mux.Vars(req)["file"], http.StatusNotFound)
+		return
+	}
+
+	serveCombined(w, req, sources, sse, follow)
+}
@@ -0,0 +1,52 @@
+package v2
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+)
+
+// ssePollInterval is the interval an SSE stream of a growing task log is polled for new lines.
+const ssePollInterval = 100 * time.Microsecond
+
+// pollBackoff spaces the polls of a followed task log. The file is polled every min while it grows, and the delay
+// doubles with every poll which finds no new lines, up to max, so thousands of idle streams do not load the files
+// API. The first new line resets the delay.
+type pollBackoff struct {
+	min, max time.Duration
+	delay    time.Duration
+}
+
+func newPollBackoff(min, max time.Duration) *pollBackoff {
+	if max < min {
+		max = min
+	}
+	return &pollBackoff{min: min, max: max, delay: min}
+}
+
+// next returns the delay before the next poll, grew is true if the last poll found new lines.
+func (p *pollBackoff) next(grew bool) time.Duration {
+	if grew {
+		p.delay = p.min
+		return p.delay
+	}
+
+	delay := p.delay
+	if p.delay *= 2; p.delay > p.max {
+		p.delay = p.max
+	}
+	return delay
+}
+
+// followMaxInterval returns -follow-max-interval, 0 if the backoff is disabled.
+func followMaxInterval(req *http.Request) time.Duration {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return 0
+	}
+
+	// validated on start.
+	max, _ := time.ParseDuration(cfg.FlagFollowMaxInterval)
+	return max
+}
@@ -0,0 +1,149 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/master"
+	"github.com/sirupsen/logrus"
+)
+
+// proxyParam overrides -discovery-proxy for a request.
+const proxyParam = "proxy"
+
+// proxyRequestHeaders are the request headers passed to the agent, they select the format and the range of a task
+// log. Accept-Encoding is not passed, the response is compressed by the gzip middleware of the master.
+var proxyRequestHeaders = []string{"Accept", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "Last-Event-ID"}
+
+// hopHeaders are the headers of a connection, they are not copied from the agent response.
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer",
+	"Transfer-Encoding", "Upgrade"}
+
+// discoveryProxy returns true if the discovery proxies the task log instead of redirecting to the agent.
+func discoveryProxy(req *http.Request) bool {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		return false
+	}
+	return boolParam(req, proxyParam, cfg.FlagDiscoveryProxy)
+}
+
+// copyResponse copies the agent response to the client, the body is flushed as it is read so the followed task
+// logs and event streams are not buffered.
+func copyResponse(w http.ResponseWriter, resp *http.Response) error {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	for _, name := range hopHeaders {
+		w.Header().Del(name)
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	_, err := io.Copy(flushWriter{w: w, f: f}, resp.Body)
+	return err
+}
+
+// proxyTaskLog reads an endpoint of a task log from dcos-log of the agent of the task and copies the response to
+// the client, for the clients which reach the masters but not the agents.
+func proxyTaskLog(w http.ResponseWriter, req *http.Request, id *nodeutil.CanonicalTaskID, endpoint, rawQuery string) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := middleware.FromContextHTTPClient(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve an http client", http.StatusInternalServerError)
+		return
+	}
+
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
+		return
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	agents, err := master.GetAgents(ctx, client, master.URL(cfg.FlagAuth), header)
+	cancel()
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamMaster)
+		logError(w, req, "unable to list agents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var hostname string
+	for _, agent := range agents {
+		if agent.ID == id.AgentID {
+			hostname = agent.Hostname
+		}
+	}
+
+	if hostname == "" {
+		logError(w, req, fmt.Sprintf("agent %s of task %s not found", id.AgentID, id.ID), http.StatusNotFound)
+		return
+	}
+
+	scheme := "http"
+	if cfg.FlagAuth {
+		scheme = "https"
+	}
+
+	agentURL := url.URL{
+		Scheme:   scheme,
+		Host:     net.JoinHostPort(hostname, strconv.Itoa(cfg.FlagFanoutAgentPort)),
+		Path:     agentTaskLogsPath + endpoint,
+		RawQuery: rawQuery,
+	}
+
+	agentReq, err := http.NewRequest("GET", agentURL.String(), nil)
+	if err != nil {
+		logError(w, req, "unable to create a request to the agent: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	agentReq.Header = header
+	for _, name := range proxyRequestHeaders {
+		if value := req.Header.Get(name); value != "" {
+			agentReq.Header.Set(name, value)
+		}
+	}
+
+	// the task logs are streamed, the request is canceled when the client goes away.
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(agentReq.WithContext(req.Context()))
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, fmt.Sprintf("unable to read the task log from agent %s: %s", id.AgentID, err),
+			http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	logrus.Debugf("proxying %s", agentURL.String())
+	if err := copyResponse(w, resp); err != nil && req.Context().Err() == nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logrus.Errorf("error while proxying %s: %s", agentURL.String(), err)
+	}
+}
@@ -4,37 +4,124 @@ import (
 	"net/http"
 	"path"
 
+	"github.com/dcos/dcos-go/dcos"
 	"github.com/dcos/dcos-go/dcos/nodeutil"
 	"github.com/dcos/dcos-log/dcos-log/api/middleware"
 	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/docker"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
 	"github.com/gorilla/mux"
 )
 
 const (
-	taskPath       = "/task/frameworks/{frameworkID}/executors/{executorID}/runs/{containerID}"
-	taskBrowsePath = taskPath + "/files/browse"
-	podPath        = taskPath + "/tasks/{taskPath}"
-	podBrowsePath  = podPath + "/files/browse"
-	discoverPath   = "/task/{taskID}"
-	componentPath  = "/component"
+	taskPath         = "/task/frameworks/{frameworkID}/executors/{executorID}/runs/{containerID}"
+	taskBrowsePath   = taskPath + "/files/browse"
+	podPath          = taskPath + "/tasks/{taskPath}"
+	podBrowsePath    = podPath + "/files/browse"
+	nestedPath       = taskPath + "/containers/{nestedContainerID}"
+	nestedBrowsePath = nestedPath + "/files/browse"
+	taskAllPath      = taskPath + "/files/all"
+	podAllPath       = podPath + "/files/all"
+	taskTarballPath  = taskPath + "/files/tarball"
+	podTarballPath   = podPath + "/files/tarball"
+	nestedTarball    = nestedPath + "/files/tarball"
+	discoverPath     = "/task/{taskID}"
+	componentPath    = "/component"
+	fieldsPath       = "/fields/{field}"
+	statsPath        = "/stats"
+	selfPath         = "/self"
+	versionPath      = "/version"
+	ingestPath       = "/ingest"
+	dockerPath       = "/docker/{container}"
+	k8sPath          = "/k8s"
+	exportPath       = "/export"
+	exportJobsPath   = exportPath + "/jobs"
+	exportJobPath    = exportJobsPath + "/{id}"
+	k8sPodLogPath    = k8sPath + "/api/v1/namespaces/{namespace}/pods/{pod}/log"
+	fanoutPath       = "/cluster/component/{name}"
+	multiplexPath    = "/cluster/tasks"
+	frameworkPath    = "/framework/{frameworkID}/logs"
+	podLogsPath      = "/pod/frameworks/{frameworkID}/executors/{executorID}/runs/{containerID}"
+	tasksPath        = "/tasks"
 )
 
+// chunkCache is the cache of the task log chunks shared by the files API readers, nil if -files-api-chunk-cache is 0.
+var chunkCache *reader.ChunkCache
+
+// serviceAccount authorizes the requests of the files API readers to the agent once a request with the token of the
+// user succeeded, nil unless -files-api-service-account is set.
+var serviceAccount reader.HeaderProvider
+
+// SetServiceAccount sets the provider of the Authorization header of the requests to the agent, the tokens of a
+// service account which are renewed before they expire. It must be called before InitRoutes.
+func SetServiceAccount(p reader.HeaderProvider) {
+	serviceAccount = p
+}
+
 // InitRoutes inits the v1 logging routes
 func InitRoutes(v2 *mux.Router, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) {
+	chunkCache = reader.NewChunkCache(cfg.FlagFilesAPIChunkCache)
+	initExportJobs(cfg)
+
+	// the limit parameter of every endpoint is capped by -max-limit. Every endpoint except the version requires a
+	// valid JWT if the verification is enabled.
+	wrapped := func(next http.Handler, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) http.Handler {
+		return middleware.Wrapped(limitCap(next), cfg, client, nodeInfo)
+	}
+	if cfg.FlagJWTVerify {
+		verifier := middleware.NewJWKSVerifier(client, cfg.FlagJWKSURL)
+		wrapped = func(next http.Handler, cfg *config.Config, client *http.Client, nodeInfo nodeutil.NodeInfo) http.Handler {
+			return middleware.Wrapped(middleware.VerifyToken(limitCap(next), verifier), cfg, client, nodeInfo)
+		}
+	}
+
 	// browse sandbox files
-	wrappedBrowseFiles := middleware.Wrapped(http.HandlerFunc(browseFiles), cfg, client, nodeInfo)
+	wrappedBrowseFiles := wrapped(http.HandlerFunc(browseFiles), cfg, client, nodeInfo)
 	v2.Path(taskBrowsePath).Handler(wrappedBrowseFiles).Methods("GET")
 	v2.Path(podBrowsePath).Handler(wrappedBrowseFiles).Methods("GET")
+	v2.Path(nestedBrowsePath).Handler(wrappedBrowseFiles).Methods("GET")
 
 	// task logs
-	wrappedTaskLogHandler := middleware.Wrapped(http.HandlerFunc(filesAPIHandler), cfg, client, nodeInfo)
+	wrappedTaskLogHandler := wrapped(http.HandlerFunc(filesAPIHandler), cfg, client, nodeInfo)
 	v2.Path(path.Join(taskPath, "/{file}")).Handler(wrappedTaskLogHandler).Methods("GET")
 	v2.Path(podPath + "/{file}").Handler(wrappedTaskLogHandler).Methods("GET")
+	v2.Path(nestedPath + "/{file}").Handler(wrappedTaskLogHandler).Methods("GET")
+
+	// size and mtime of task log files, for the clients polling for growth
+	wrappedHeadFileHandler := wrapped(http.HandlerFunc(headFileHandler), cfg, client, nodeInfo)
+	wrappedStatHandler := wrapped(http.HandlerFunc(statHandler), cfg, client, nodeInfo)
+	v2.Path(path.Join(taskPath, "/{file}")).Handler(wrappedHeadFileHandler).Methods("HEAD")
+	v2.Path(podPath + "/{file}").Handler(wrappedHeadFileHandler).Methods("HEAD")
+	v2.Path(nestedPath + "/{file}").Handler(wrappedHeadFileHandler).Methods("HEAD")
+	v2.Path(path.Join(taskPath, "/{file}/stat")).Handler(wrappedStatHandler).Methods("GET")
+	v2.Path(path.Join(podPath, "/{file}/stat")).Handler(wrappedStatHandler).Methods("GET")
+	v2.Path(path.Join(nestedPath, "/{file}/stat")).Handler(wrappedStatHandler).Methods("GET")
+
+	// search task logs
+	wrappedSearchHandler := wrapped(http.HandlerFunc(searchHandler), cfg, client, nodeInfo)
+	v2.Path(path.Join(taskPath, "/{file}/search")).Handler(wrappedSearchHandler).Methods("GET")
+	v2.Path(path.Join(podPath, "/{file}/search")).Handler(wrappedSearchHandler).Methods("GET")
+	v2.Path(path.Join(nestedPath, "/{file}/search")).Handler(wrappedSearchHandler).Methods("GET")
+
+	// stdout and stderr combined
+	wrappedAllFilesHandler := wrapped(http.HandlerFunc(allFilesHandler), cfg, client, nodeInfo)
+	v2.Path(taskAllPath).Handler(wrappedAllFilesHandler).Methods("GET")
+	v2.Path(podAllPath).Handler(wrappedAllFilesHandler).Methods("GET")
+
+	// the sandbox as a tar.gz archive
+	wrappedTarballHandler := wrapped(http.HandlerFunc(tarballHandler), cfg, client, nodeInfo)
+	v2.Path(taskTarballPath).Handler(wrappedTarballHandler).Methods("GET")
+	v2.Path(podTarballPath).Handler(wrappedTarballHandler).Methods("GET")
+	v2.Path(nestedTarball).Handler(wrappedTarballHandler).Methods("GET")
+
+	// pod tasks and their combined logs
+	v2.Path(podLogsPath).Handler(wrapped(http.HandlerFunc(podTasksHandler), cfg, client, nodeInfo)).Methods("GET")
+	v2.Path(podLogsPath + "/{file}").Handler(wrapped(http.HandlerFunc(podLogsHandler), cfg, client, nodeInfo)).Methods("GET")
 
 	// discover endpoints
-	wrappedDiscoverHandler := middleware.Wrapped(http.HandlerFunc(discoverHandler), cfg, client, nodeInfo)
-	wrappedDiscoverBrowseHandler := middleware.Wrapped(http.HandlerFunc(browseHandler), cfg, client, nodeInfo)
-	wrappedDiscoverDownloadHandler := middleware.Wrapped(http.HandlerFunc(downloadHandler), cfg, client, nodeInfo)
+	wrappedDiscoverHandler := wrapped(http.HandlerFunc(discoverHandler), cfg, client, nodeInfo)
+	wrappedDiscoverBrowseHandler := wrapped(http.HandlerFunc(browseHandler), cfg, client, nodeInfo)
+	wrappedDiscoverDownloadHandler := wrapped(http.HandlerFunc(downloadHandler), cfg, client, nodeInfo)
 
 	v2.Path(discoverPath).Handler(wrappedDiscoverHandler).Methods("GET")
 	v2.Path(path.Join(discoverPath, "/file/{file}")).Handler(wrappedDiscoverHandler).Methods("GET")
@@ -47,12 +134,103 @@ func InitRoutes(v2 *mux.Router, cfg *config.Config, client *http.Client, nodeInf
 	v2.Path(path.Join(discoverPath, "/file/{file}/download")).Handler(wrappedDiscoverDownloadHandler).Methods("GET")
 
 	// component logs
-	wrappedComponentHandler := middleware.Wrapped(http.HandlerFunc(journalHandler), cfg, client, nodeInfo)
+	wrappedComponentHandler := wrapped(http.HandlerFunc(journalHandler), cfg, client, nodeInfo)
 	v2.Path(componentPath).Handler(wrappedComponentHandler).Methods("GET")
 	v2.Path(path.Join(componentPath, "/{name}")).Handler(wrappedComponentHandler).Methods("GET")
 
+	// distinct values of a journal field
+	v2.Path(fieldsPath).Handler(wrapped(http.HandlerFunc(fieldsHandler), cfg, client, nodeInfo)).Methods("GET")
+
+	// entry counts of the units and priorities
+	v2.Path(statsPath).Handler(wrapped(http.HandlerFunc(statsHandler), cfg, client, nodeInfo)).Methods("GET")
+
+	// websocket streams of components and task logs.
+	wrappedWSJournalHandler := wrapped(http.HandlerFunc(wsJournalHandler), cfg, client, nodeInfo)
+	wrappedWSFilesHandler := wrapped(http.HandlerFunc(wsFilesHandler), cfg, client, nodeInfo)
+	v2.Path(path.Join(componentPath, "/{name}/stream")).Handler(wrappedWSJournalHandler).Methods("GET")
+	v2.Path(path.Join(taskPath, "/{file}/stream")).Handler(wrappedWSFilesHandler).Methods("GET")
+	v2.Path(path.Join(podPath, "/{file}/stream")).Handler(wrappedWSFilesHandler).Methods("GET")
+	v2.Path(path.Join(nestedPath, "/{file}/stream")).Handler(wrappedWSFilesHandler).Methods("GET")
+
 	// download path
-	wrappedDownloadHandler := middleware.Wrapped(http.HandlerFunc(downloadFile), cfg, client, nodeInfo)
+	wrappedDownloadHandler := wrapped(http.HandlerFunc(downloadFile), cfg, client, nodeInfo)
 	v2.Path(path.Join(taskPath, "/{file}/download")).Handler(wrappedDownloadHandler).Methods("GET")
 	v2.Path(path.Join(podPath, "/{file}/download")).Handler(wrappedDownloadHandler).Methods("GET")
+	v2.Path(path.Join(nestedPath, "/{file}/download")).Handler(wrappedDownloadHandler).Methods("GET")
+
+	// dcos-log own logs and diagnostics
+	wrappedSelfLogsHandler := wrapped(http.HandlerFunc(selfLogsHandler), cfg, client, nodeInfo)
+	wrappedDiagnosticsHandler := wrapped(http.HandlerFunc(diagnosticsHandler), cfg, client, nodeInfo)
+	v2.Path(path.Join(selfPath, "/logs")).Handler(wrappedSelfLogsHandler).Methods("GET")
+	v2.Path(path.Join(selfPath, "/diagnostics")).Handler(wrappedDiagnosticsHandler).Methods("GET")
+
+	// build information and capabilities
+	wrappedVersionHandler := middleware.Wrapped(http.HandlerFunc(versionHandler), cfg, client, nodeInfo)
+	v2.Path(versionPath).Handler(wrappedVersionHandler).Methods("GET")
+
+	// write application events to journald
+	var ingest http.Handler = http.HandlerFunc(ingestHandler)
+	if cfg.FlagAuth {
+		ingest = middleware.RequireToken(ingest)
+	}
+	v2.Path(ingestPath).Handler(wrapped(ingest, cfg, client, nodeInfo)).Methods("POST")
+
+	// logs of containers launched by docker daemon, bypassing mesos sandbox
+	var dockerLogs http.Handler = dockerLogsHandler(docker.NewClient(cfg.FlagDockerSocket))
+	if cfg.FlagAuth {
+		dockerLogs = middleware.RequireToken(dockerLogs)
+	}
+	wrappedDockerLogsHandler := wrapped(dockerLogs, cfg, client, nodeInfo)
+	v2.Path(dockerPath).Handler(wrappedDockerLogsHandler).Methods("GET")
+	v2.Path(path.Join(dockerPath, "/{stream:stdout|stderr}")).Handler(wrappedDockerLogsHandler).Methods("GET")
+
+	// kubelet log API compatibility
+	wrappedK8sPodLogHandler := wrapped(http.HandlerFunc(k8sPodLogHandler), cfg, client, nodeInfo)
+	wrappedK8sTaskLogHandler := wrapped(http.HandlerFunc(k8sTaskLogHandler), cfg, client, nodeInfo)
+	v2.Path(k8sPodLogPath).Handler(wrappedK8sPodLogHandler).Methods("GET")
+	v2.Path(k8sPath + taskPath + "/log").Handler(wrappedK8sTaskLogHandler).Methods("GET")
+	v2.Path(k8sPath + podPath + "/log").Handler(wrappedK8sTaskLogHandler).Methods("GET")
+
+	// export journal ranges to object storage
+	var export http.Handler = http.HandlerFunc(exportHandler)
+	if cfg.FlagAuth {
+		export = middleware.RequireToken(export)
+	}
+	v2.Path(exportPath).Handler(wrapped(export, cfg, client, nodeInfo)).Methods("POST")
+
+	// export jobs run in the background, their archives are downloaded once done. The jobs are those of the user.
+	exportJobHandlers := []struct {
+		path, method string
+		handler      http.HandlerFunc
+	}{
+		{exportJobsPath, "POST", submitJobHandler},
+		{exportJobsPath, "GET", listJobsHandler},
+		{exportJobPath, "GET", jobHandler},
+		{exportJobPath, "DELETE", deleteJobHandler},
+		{path.Join(exportJobPath, "/archive"), "GET", jobArchiveHandler},
+	}
+	for _, h := range exportJobHandlers {
+		var handler http.Handler = h.handler
+		if cfg.FlagAuth {
+			handler = middleware.RequireToken(handler)
+		}
+		v2.Path(h.path).Handler(wrapped(handler, cfg, client, nodeInfo)).Methods(h.method)
+	}
+
+	// the sandboxes on the agent, an index of the task log endpoints
+	if cfg.FlagRole != dcos.RoleMaster {
+		v2.Path(tasksPath).Handler(wrapped(http.HandlerFunc(tasksHandler), cfg, client, nodeInfo)).Methods("GET")
+	}
+
+	// a unit of every agent and the files of several tasks or a framework, read on masters
+	if cfg.FlagRole == dcos.RoleMaster {
+		wrappedFanoutHandler := wrapped(http.HandlerFunc(fanoutHandler), cfg, client, nodeInfo)
+		v2.Path(fanoutPath).Handler(wrappedFanoutHandler).Methods("GET")
+
+		wrappedMultiplexHandler := wrapped(http.HandlerFunc(multiplexHandler), cfg, client, nodeInfo)
+		v2.Path(multiplexPath).Handler(wrappedMultiplexHandler).Methods("GET")
+
+		wrappedFrameworkLogsHandler := wrapped(http.HandlerFunc(frameworkLogsHandler), cfg, client, nodeInfo)
+		v2.Path(frameworkPath).Handler(wrappedFrameworkLogsHandler).Methods("GET")
+	}
 }
@@ -0,0 +1,97 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// runParam selects a run of a restarted task: ?run=0 is the first run, ?run=-1 the last, a container ID selects
+// the run of the container and ?run=all lists all runs.
+const runParam = "run"
+
+var errRunNotFound = errors.New("run not found")
+
+// taskRun is a run of a task listed with ?run=all.
+type taskRun struct {
+	Index       int    `json:"index"`
+	ContainerID string `json:"container_id"`
+	URL         string `json:"url"`
+}
+
+// taskRuns returns the container IDs of the runs of a task, the oldest first. Every status of a task has the ID of
+// its container followed by the IDs of the parent containers. Pod tasks are nested in the executor container, which
+// is the container of a run.
+func taskRuns(id *nodeutil.CanonicalTaskID) []string {
+	first, step := 0, 1
+	if id.ExecutorID != "" && len(id.ContainerIDs)%2 == 0 {
+		first, step = 1, 2
+	}
+
+	var runs []string
+	seen := make(map[string]bool)
+	for i := first; i < len(id.ContainerIDs); i += step {
+		if containerID := id.ContainerIDs[i]; !seen[containerID] {
+			seen[containerID] = true
+			runs = append(runs, containerID)
+		}
+	}
+	return runs
+}
+
+// withRun returns a copy of the task ID of a single run, the container ID of a run is the last one.
+func withRun(id *nodeutil.CanonicalTaskID, containerID string) *nodeutil.CanonicalTaskID {
+	run := *id
+	run.ContainerIDs = []string{containerID}
+	return &run
+}
+
+// selectRun returns the task ID of the run selected by ?run= parameter, the last run is selected by default.
+func selectRun(id *nodeutil.CanonicalTaskID, run string) (*nodeutil.CanonicalTaskID, error) {
+	if run == "" {
+		return id, nil
+	}
+
+	runs := taskRuns(id)
+	if i, err := strconv.Atoi(run); err == nil {
+		if i < 0 {
+			i += len(runs)
+		}
+
+		if i < 0 || i >= len(runs) {
+			return nil, errRunNotFound
+		}
+		return withRun(id, runs[i]), nil
+	}
+
+	for _, containerID := range runs {
+		if containerID == run {
+			return withRun(id, containerID), nil
+		}
+	}
+	return nil, errRunNotFound
+}
+
+// serveTaskRuns lists the runs of a task with the URLs of their task logs.
+func serveTaskRuns(w http.ResponseWriter, req *http.Request, id *nodeutil.CanonicalTaskID, file, rawQuery string,
+	browse, download bool) {
+	var runs []taskRun
+	for i, containerID := range taskRuns(id) {
+		taskURL, err := redirectURL(withRun(id, containerID), file, rawQuery, browse, download)
+		if err != nil {
+			logError(w, req, "unable to build redirect URL: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		runs = append(runs, taskRun{Index: i, ContainerID: containerID, URL: taskURL})
+	}
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		logrus.Errorf("unable to encode the runs of %s: %s", id.ID, err)
+	}
+}
@@ -0,0 +1,116 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+)
+
+const (
+	contextParam = "context"
+
+	// searchMaxContext is the maximum number of lines around a match.
+	searchMaxContext = 100
+
+	// searchDefaultLimit and searchMaxLimit are the default and the maximum number of matches of a search.
+	searchDefaultLimit = 100
+	searchMaxLimit     = 1000
+)
+
+// errSearchLimit stops a search which found enough matches.
+var errSearchLimit = errors.New("search limit reached")
+
+// searchResponse is the response of the search endpoint. Truncated is set if the search stopped at the limit.
+type searchResponse struct {
+	Matches   []reader.Match `json:"matches"`
+	Truncated bool           `json:"truncated"`
+}
+
+// intRangeParam returns an integer parameter between min and max or the default value if it is not set.
+func intRangeParam(req *http.Request, name string, def, min, max int) (int, error) {
+	s := req.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid %s parameter %q. Must be an integer between %d and %d", name, s, min, max)
+	}
+	return v, nil
+}
+
+// searchHandler scans a sandbox file on the agent and returns the lines matching the regular expression of q
+// parameter with their offsets and context lines, so a client finds a message without downloading the file.
+func searchHandler(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get(queryParam)
+	if q == "" {
+		logError(w, req, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	re, err := regexp.Compile(q)
+	if err != nil {
+		logError(w, req, "invalid q parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := intRangeParam(req, contextParam, 0, 0, searchMaxContext)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intRangeParam(req, limitParam, searchDefaultLimit, 1, searchMaxLimit)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r, err := setupFilesAPIReader(req, "/files/read")
+	if err != nil {
+		if err == reader.ErrFileNotFound && serveGoneSandbox(w, req) {
+			return
+		}
+		combinedSetupError(w, req, err)
+		return
+	}
+
+	resp := searchResponse{Matches: []reader.Match{}}
+	err = r.Search(re, n, func(m reader.Match) error {
+		if len(resp.Matches) == limit {
+			resp.Truncated = true
+			return errSearchLimit
+		}
+		resp.Matches = append(resp.Matches, m)
+		return nil
+	})
+
+	switch err {
+	case nil, errSearchLimit:
+	case reader.ErrFileNotFound:
+		if !serveGoneSandbox(w, req) {
+			logError(w, req, "File not found", http.StatusNotFound)
+		}
+		return
+	case reader.ErrBinaryFile:
+		logError(w, req, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	default:
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to search the file: "+err.Error(), agentErrorCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logError(w, req, "unable to encode search results: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,132 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/diagnostics"
+	"github.com/dcos/dcos-log/dcos-log/selflog"
+	"github.com/dcos/dcos-log/dcos-log/transform"
+	"github.com/dcos/dcos-log/dcos-log/version"
+)
+
+// writeSelfLogEntry writes a single dcos-log entry in the requested format.
+func writeSelfLogEntry(w http.ResponseWriter, entry selflog.Entry, contentType string) error {
+	if contentType == "text/plain" {
+		_, err := w.Write([]byte(entry.Text()))
+		return err
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if contentType == eventStreamContentType {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.ID, body)
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", body)
+	return err
+}
+
+// selfLogsHandler returns the recent log entries of dcos-log itself. If the request header Accept
+// is text/event-stream, the new entries are streamed until the client disconnects.
+func selfLogsHandler(w http.ResponseWriter, req *http.Request) {
+	var (
+		limit   int
+		afterID uint64
+		err     error
+	)
+
+	if limit, err = nonNegativeParam(req.URL.Query(), limitParam); err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if lastEventID := req.Header.Get("Last-Event-ID"); lastEventID != "" {
+		afterID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			logError(w, req, "invalid Last-Event-ID header: "+lastEventID, http.StatusBadRequest)
+			return
+		}
+	}
+
+	contentType := "text/plain"
+	switch req.Header.Get("Accept") {
+	case "application/json", eventStreamContentType:
+		contentType = req.Header.Get("Accept")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if contentType != eventStreamContentType {
+		for _, entry := range selflog.Default.Entries(afterID, limit) {
+			if err := writeSelfLogEntry(w, entry, contentType); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		logError(w, req, "unable to type assert ResponseWriter to Flusher", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribe before reading the buffer, entries logged in between are filtered by ID.
+	entries, unsubscribe := selflog.Default.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("X-Accel-Buffering", "no")
+	for _, entry := range selflog.Default.Entries(afterID, limit) {
+		if err := writeSelfLogEntry(w, entry, contentType); err != nil {
+			return
+		}
+		afterID = entry.ID
+	}
+	f.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case entry := <-entries:
+			if entry.ID <= afterID {
+				continue
+			}
+
+			if err := writeSelfLogEntry(w, entry, contentType); err != nil {
+				return
+			}
+			f.Flush()
+		}
+	}
+}
+
+// diagnosticsHandler returns a snapshot of dcos-log internal state.
+func diagnosticsHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	snapshot := diagnostics.Snapshot()
+	snapshot["config"] = cfg.Redacted()
+	snapshot["version"] = version.Get()
+	snapshot["hooks"] = transform.HookNames()
+	snapshot["time"] = time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		logError(w, req, "unable to encode diagnostic snapshot: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+// fileStat is the response of the stat endpoint of a sandbox file.
+type fileStat struct {
+	reader.SandboxFile
+	ETag string `json:"etag"`
+}
+
+// fileETag returns a weak entity tag of a sandbox file. Log files are only appended to, so the size tells whether
+// a file has grown.
+func fileETag(size int) string {
+	return `W/"` + strconv.Itoa(size) + `"`
+}
+
+// setupError writes the error of setupFilesAPIReader.
+func setupError(w http.ResponseWriter, req *http.Request, err error) {
+	e, ok := err.(errSetupFilesAPIReader)
+	if !ok {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to initialize files API reader: "+err.Error(), agentErrorCode(err))
+		return
+	}
+	logError(w, req, e.msg, e.code)
+}
+
+// headFileHandler responds to HEAD requests of task log files with the headers of the raw file: Content-Length
+// is the size of the file read with the files API offset=-1 probe, ETag is derived from the size and Last-Modified
+// is the mtime of the file. Clients poll for growth with If-None-Match, 304 is returned if the size has not changed.
+func headFileHandler(w http.ResponseWriter, req *http.Request) {
+	r, err := setupFilesAPIReader(req, "/files/read")
+	if err != nil {
+		setupError(w, req, err)
+		return
+	}
+
+	size, err := r.Size()
+	if err == reader.ErrFileNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to get the file size: "+err.Error(), agentErrorCode(err))
+		return
+	}
+
+	etag := fileETag(size)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// the mtime is informational, the size is known without it.
+	if browser, err := setupFilesAPIReader(req, "/files/browse"); err == nil {
+		if f, err := browser.Stat(); err == nil {
+			w.Header().Set("Last-Modified", time.Unix(int64(f.MTime), 0).UTC().Format(http.TimeFormat))
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	w.WriteHeader(http.StatusOK)
+}
+
+// statHandler returns the sandbox entry of a task log file with its ETag as JSON.
+func statHandler(w http.ResponseWriter, req *http.Request) {
+	r, err := setupFilesAPIReader(req, "/files/browse")
+	if err != nil {
+		setupError(w, req, err)
+		return
+	}
+
+	f, err := r.Stat()
+	if err == reader.ErrFileNotFound {
+		logError(w, req, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, err.Error(), agentErrorCode(err))
+		return
+	}
+
+	etag := fileETag(int(f.Size))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(fileStat{SandboxFile: f, ETag: etag}); err != nil {
+		logrus.Errorf("unable to encode the stat of %s: %s", f.Path, err)
+	}
+}
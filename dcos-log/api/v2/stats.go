@@ -0,0 +1,200 @@
+package v2
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/redact"
+	"github.com/sirupsen/logrus"
+)
+
+// statsDefaultWindow is the time window of the stats requests without since parameter.
+const statsDefaultWindow = time.Hour
+
+// statsUnitFields are the fields an entry is counted by, the first one set is used. The kernel and the processes
+// outside of units have a syslog identifier only.
+var statsUnitFields = []string{"_SYSTEMD_UNIT", "SYSLOG_IDENTIFIER"}
+
+// statsCount is the number of entries and the bytes of their messages.
+type statsCount struct {
+	Entries int64 `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (c *statsCount) add(message string) {
+	c.Entries++
+	c.Bytes += int64(len(message))
+}
+
+// unitStats are the counts of a unit, by priority.
+type unitStats struct {
+	Unit string `json:"unit"`
+	statsCount
+	Priorities map[string]*statsCount `json:"priorities"`
+}
+
+// journalStats is the response of the stats endpoint. The priorities are the values of the PRIORITY field, 0 is
+// emerg and 7 is debug.
+type journalStats struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	statsCount
+	Priorities map[string]*statsCount `json:"priorities"`
+	Units      []*unitStats           `json:"units"`
+
+	// Partial is true if the journal was not read to the end of the window before -range-timeout.
+	Partial bool `json:"partial"`
+
+	unitFields []string
+	units      map[string]*unitStats
+
+	// hideBytes is true if the messages are hidden from the role, their size is not counted.
+	hideBytes bool
+}
+
+// newJournalStats returns the stats of a window, the units are counted by the fields visible to role.
+func newJournalStats(since, until time.Time, role *redact.Role) *journalStats {
+	s := &journalStats{
+		Since:      since,
+		Until:      until,
+		Priorities: make(map[string]*statsCount),
+		Units:      []*unitStats{},
+		units:      make(map[string]*unitStats),
+		hideBytes:  role.Hidden("MESSAGE"),
+	}
+
+	for _, field := range statsUnitFields {
+		if !role.Hidden(field) {
+			s.unitFields = append(s.unitFields, field)
+		}
+	}
+	return s
+}
+
+// add counts an entry.
+func (s *journalStats) add(fields map[string]string) {
+	var unit string
+	for _, field := range s.unitFields {
+		if unit = fields[field]; unit != "" {
+			break
+		}
+	}
+
+	u, ok := s.units[unit]
+	if !ok {
+		u = &unitStats{Unit: unit, Priorities: make(map[string]*statsCount)}
+		s.units[unit] = u
+		s.Units = append(s.Units, u)
+	}
+
+	message, priority := fields["MESSAGE"], fields["PRIORITY"]
+	if s.hideBytes {
+		message = ""
+	}
+	s.statsCount.add(message)
+	u.statsCount.add(message)
+	if priority != "" {
+		for _, priorities := range []map[string]*statsCount{s.Priorities, u.Priorities} {
+			if priorities[priority] == nil {
+				priorities[priority] = &statsCount{}
+			}
+			priorities[priority].add(message)
+		}
+	}
+}
+
+// sortUnits orders the units by their number of entries, the busiest first.
+func (s *journalStats) sortUnits() {
+	sort.Slice(s.Units, func(i, j int) bool {
+		if s.Units[i].Entries != s.Units[j].Entries {
+			return s.Units[i].Entries > s.Units[j].Entries
+		}
+		return s.Units[i].Unit < s.Units[j].Unit
+	})
+}
+
+// statsFormatter counts the entries read by the journal reader instead of formatting them.
+type statsFormatter struct {
+	stats *journalStats
+}
+
+func (f statsFormatter) GetContentType() jr.ContentType {
+	return jr.ContentTypeApplicationJSON
+}
+
+func (f statsFormatter) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	f.stats.add(entry.Fields)
+	return nil, nil
+}
+
+// statsHandler counts the journal entries and the bytes of their messages matching the filters of the component
+// endpoints, in total, by unit and by priority, so a dashboard can show the error rate of the units without
+// reading the entries. The window is ?since= to ?until=, the last hour by default, the pagination parameters and
+// the direction are ignored. A window not read before -range-timeout returns the counts so far with partial set.
+func statsHandler(w http.ResponseWriter, req *http.Request) {
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role := middleware.RedactionRole(req)
+	if field := q.hiddenField(role); field != "" {
+		logError(w, req, "field "+field+" is not visible", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	if q.since.IsZero() && (q.query == nil || q.query.Since == 0) {
+		q.since = now.Add(-statsDefaultWindow)
+	}
+
+	if q.until.IsZero() {
+		q.until = now
+	}
+	q.cursor, q.end, q.limit, q.skip, q.reverse = "", false, 0, 0, false
+
+	since := q.since
+	if q.query != nil && q.query.Since > 0 && (since.IsZero() || now.Add(-q.query.Since).After(since)) {
+		since = now.Add(-q.query.Since)
+	}
+	stats := newJournalStats(since.UTC(), q.until.UTC(), role)
+
+	req, cancel := withRangeDeadline(req)
+	defer cancel()
+
+	opts := append([]jr.Option{optJournalDirs(req)}, q.options()...)
+	j, err := jr.NewReader(statsFormatter{stats: stats}, append(opts, jr.OptionContext(req.Context()))...)
+	if err != nil {
+		journalOpenError(w, req, j, err)
+		return
+	}
+	defer j.Close()
+
+	if _, err := io.Copy(ioutil.Discard, j); err != nil {
+		if !deadlineExceeded(w, req, stats.Entries) {
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
+			logError(w, req, "unable to read journal entries: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the response was 504 if nothing was counted.
+		if stats.Entries == 0 {
+			return
+		}
+		stats.Partial = true
+	}
+	stats.sortUnits()
+
+	w.Header().Set("Content-Type", jr.ContentTypeApplicationJSON.String())
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logrus.Errorf("Error writing to client: %s", err)
+	}
+}
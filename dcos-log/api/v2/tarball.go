@@ -0,0 +1,66 @@
+package v2
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// globParam selects the sandbox files of a tarball, the parameter can be repeated.
+const globParam = "glob"
+
+// tarballHandler streams the sandbox of a task, a pod task or a nested container as a gzip compressed tar archive.
+// The sandbox is walked with /files/browse and the files are read with /files/read, ?glob= selects a subset of
+// the files, such as ?glob=*.log&glob=logs/*. The errors of the agent are returned before the archive is sent; an
+// error while the archive is written truncates it, so the gzip stream of the client fails.
+func tarballHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := middleware.FromContextToken(req.Context())
+	if !ok {
+		logError(w, req, "unable to get authorization header from a request", http.StatusUnauthorized)
+		return
+	}
+
+	patterns := req.URL.Query()[globParam]
+	if err := reader.ValidTarballPatterns(patterns); err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", token)
+
+	// the reader is not bound to a file, so there is no byte order mark to detect.
+	r, err := setupFilesAPIReader(req, "/files/read", reader.OptHeaders(header), reader.OptTranscode(false))
+	if err != nil {
+		setupError(w, req, err)
+		return
+	}
+
+	files, err := r.TarballFiles(patterns)
+	if err == reader.ErrFileNotFound && serveGoneSandbox(w, req) {
+		return
+	}
+
+	if err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, err.Error(), agentErrorCode(err))
+		return
+	}
+
+	vars := mux.Vars(req)
+	name := vars["containerID"]
+	if nested := vars["nestedContainerID"]; nested != "" {
+		name = nested
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-sandbox.tar.gz"`, name))
+	if err := r.WriteTarball(w, files); err != nil {
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logrus.Errorf("unable to write the sandbox tarball of %s: %s", req.URL.Path, err)
+	}
+}
@@ -0,0 +1,94 @@
+package v2
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+)
+
+// taskCacheSize is the maximum number of tasks in the cache, the least recently used task is evicted.
+const taskCacheSize = 1024
+
+var taskCacheLookups = metrics.NewCounterVec("dcos_log_task_cache_lookups_total",
+	"Lookups of canonical task IDs in the discovery cache by result (hit, miss).", "result")
+
+// canonicalIDs caches the canonical task IDs found by the discovery, so the dashboards polling the logs of a task
+// do not query the master state on every request.
+var canonicalIDs = newTaskCache(taskCacheSize)
+
+type taskCacheEntry struct {
+	key     string
+	id      *nodeutil.CanonicalTaskID
+	err     error
+	expires time.Time
+}
+
+// taskCache is an LRU cache of canonical task IDs with TTL. The unknown tasks are cached too, with their error.
+type taskCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+func newTaskCache(size int) *taskCache {
+	return &taskCache{size: size, entries: make(map[string]*list.Element), lru: list.New(), now: time.Now}
+}
+
+// taskCacheKey returns the cache key of a task looked up by a user. The master state is filtered by the
+// permissions of the user, so the tasks found by one user must not be returned to another.
+func taskCacheKey(token, taskID string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]) + "/" + taskID
+}
+
+// get returns the cached entry of a task with its ID or error, false if the task is not cached or expired. The ID
+// of an entry must not be modified.
+func (c *taskCache) get(key string) (*taskCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		taskCacheLookups.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	entry := el.Value.(*taskCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		taskCacheLookups.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	taskCacheLookups.WithLabelValues("hit").Inc()
+	return entry, true
+}
+
+// add caches the ID or error of a task for ttl.
+func (c *taskCache) add(key string, id *nodeutil.CanonicalTaskID, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &taskCacheEntry{key: key, id: id, err: err, expires: c.now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*taskCacheEntry).key)
+	}
+}
@@ -0,0 +1,101 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	"github.com/dcos/dcos-log/dcos-log/config"
+	"github.com/dcos/dcos-log/dcos-log/version"
+)
+
+// apiVersions is a list of API versions served by dcos-log.
+var apiVersions = []string{"v1", "v2"}
+
+type versionResponse struct {
+	version.Info
+	APIVersions []string `json:"api_versions"`
+	Features    []string `json:"features"`
+	Formatters  []string `json:"formatters"`
+}
+
+// features returns a list of optional features enabled on the node.
+func features(cfg *config.Config) []string {
+	enabled := []string{"metrics", "self-logs", "diagnostics", "ingest", "docker", "k8s-logs", "gatewayd", "explain", "query", "gzip", "websocket"}
+	if cfg.FlagAuth {
+		enabled = append(enabled, "auth")
+	}
+
+	if cfg.FlagArchiveURL != "" {
+		enabled = append(enabled, "archive-fallback")
+	}
+
+	if cfg.FlagArchive {
+		enabled = append(enabled, "archiver")
+	}
+
+	if cfg.FlagSyslogUDP != "" || cfg.FlagSyslogTCP != "" {
+		enabled = append(enabled, "syslog")
+	}
+
+	if cfg.FlagJournalRemote != "" {
+		enabled = append(enabled, "journal-remote")
+	}
+
+	if cfg.FlagLokiURL != "" {
+		enabled = append(enabled, "loki")
+	}
+
+	if cfg.FlagSplunkURL != "" {
+		enabled = append(enabled, "splunk")
+	}
+
+	if cfg.FlagKafkaBrokers != "" {
+		enabled = append(enabled, "kafka")
+	}
+
+	if cfg.FlagFluentdAddr != "" {
+		enabled = append(enabled, "fluentd")
+	}
+
+	if cfg.FlagElasticURL != "" {
+		enabled = append(enabled, "elasticsearch")
+	}
+
+	if cfg.FlagSyslogForwardAddr != "" {
+		enabled = append(enabled, "syslog-forward")
+	}
+
+	if cfg.FlagRole == dcos.RoleMaster {
+		enabled = append(enabled, "fanout")
+	}
+
+	if cfg.FlagExportURL != "" {
+		enabled = append(enabled, "export")
+	}
+
+	return enabled
+}
+
+// versionHandler returns the build information and capabilities of dcos-log, so the clients could adapt
+// to nodes running different versions during upgrades.
+func versionHandler(w http.ResponseWriter, req *http.Request) {
+	cfg, ok := middleware.FromContextConfig(req.Context())
+	if !ok {
+		logError(w, req, "invalid context, unable to retrieve a config object", http.StatusInternalServerError)
+		return
+	}
+
+	resp := versionResponse{
+		Info:        version.Get(),
+		APIVersions: apiVersions,
+		Features:    features(cfg),
+		Formatters:  journalContentTypes(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logError(w, req, "unable to encode version: "+err.Error(), http.StatusInternalServerError)
+	}
+}
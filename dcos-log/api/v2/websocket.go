@@ -0,0 +1,298 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dcos/dcos-log/dcos-log/api/middleware"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/dcos/dcos-log/dcos-log/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// wsPollInterval is the interval a task log is polled for new lines while a WebSocket client is connected.
+const wsPollInterval = 100 * time.Millisecond
+
+// wsSession sends the lines written to it as WebSocket messages, text messages for valid UTF-8 and binary
+// messages otherwise. The client can send "pause" and "resume" text messages, writes block while the session
+// is paused. The context of the session is canceled when the client goes away.
+type wsSession struct {
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+
+	// buf is an incomplete line.
+	buf []byte
+}
+
+func newWSSession(ctx context.Context, conn *websocket.Conn) *wsSession {
+	s := &wsSession{conn: conn, resumed: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	go s.readControl()
+	return s
+}
+
+// readControl reads the control messages of the client until the connection is closed.
+func (s *wsSession) readControl() {
+	defer s.cancel()
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		s.mu.Lock()
+		switch strings.TrimSpace(string(data)) {
+		case "pause":
+			s.paused = true
+		case "resume":
+			if s.paused {
+				s.paused = false
+				close(s.resumed)
+				s.resumed = make(chan struct{})
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// wait blocks while the session is paused, it returns false if the client went away.
+func (s *wsSession) wait() bool {
+	for {
+		s.mu.Lock()
+		paused, resumed := s.paused, s.resumed
+		s.mu.Unlock()
+
+		if !paused {
+			return s.ctx.Err() == nil
+		}
+
+		select {
+		case <-resumed:
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+}
+
+// Write sends every complete line as a message, without the new line.
+func (s *wsSession) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		if !s.wait() {
+			return 0, context.Canceled
+		}
+
+		line := s.buf[:i]
+		messageType := websocket.TextMessage
+		if !utf8.Valid(line) {
+			messageType = websocket.BinaryMessage
+		}
+
+		if err := s.conn.WriteMessage(messageType, line); err != nil {
+			s.cancel()
+			return 0, err
+		}
+		s.buf = s.buf[i+1:]
+	}
+}
+
+// close closes the connection with a normal status or an internal error, only the first call sends a close
+// message.
+func (s *wsSession) close(err error) {
+	s.cancel()
+	if err != nil {
+		s.conn.CloseWithReason(websocket.CloseInternalError, err.Error())
+		return
+	}
+	s.conn.Close()
+}
+
+// wsFormat sets the request header Accept to the content type of ?format= parameter, the formatted entries
+// are sent the same way as over HTTP. It returns false if the format is not one of the allowed formats.
+func wsFormat(req *http.Request, defaultContentType jr.ContentType, allowed ...string) bool {
+	contentType := defaultContentType
+	if format := req.URL.Query().Get(formatParam); format != "" {
+		ok := false
+		for _, name := range allowed {
+			ok = ok || name == format
+		}
+
+		if !ok {
+			return false
+		}
+		contentType, _ = formatContentType(format)
+	}
+
+	req.Header.Set("Accept", contentType.String())
+	return true
+}
+
+// wsJournalHandler streams the journal entries of a component over a WebSocket connection, a message per
+// entry. The parameters are the same as for the component endpoints.
+func wsJournalHandler(w http.ResponseWriter, req *http.Request) {
+	if !wsFormat(req, jr.ContentTypeApplicationJSON, "text", "json", "cef", "leef", "logfmt", "gelf") {
+		logError(w, req, "unsupported format "+req.URL.Query().Get(formatParam), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseJournalQuery(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if q.reverse {
+		logError(w, req, errReverseStream.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if field := q.hiddenField(middleware.RedactionRole(req)); field != "" {
+		logError(w, req, "field "+field+" is not visible", http.StatusForbidden)
+		return
+	}
+
+	// the request context is not canceled when a hijacked connection is closed.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	opts := append([]jr.Option{optJournalDirs(req)}, q.options()...)
+	opts = append(opts, jr.OptionContext(ctx), optMaxEntrySize(req))
+	j, err := jr.NewReader(newEntryFormatter(req, req.Header.Get("Accept"), false), opts...)
+	if err != nil {
+		journalOpenError(w, req, j, err)
+		return
+	}
+	defer j.Close()
+
+	conn, err := websocket.Upgrade(w, req)
+	if err != nil {
+		logrus.Errorf("unable to upgrade to websocket: %s. Request: %s", err, req.RequestURI)
+		return
+	}
+
+	s := newWSSession(ctx, conn)
+	defer s.close(nil)
+	go func() {
+		<-s.ctx.Done()
+		cancel()
+	}()
+
+	for s.wait() {
+		err := j.Follow(wsPollInterval, s)
+		if err == jr.ErrRangeEnd {
+			return
+		}
+
+		if err != nil {
+			if s.ctx.Err() != nil {
+				logrus.Debugf("websocket client went away. Request URI: %s", req.RequestURI)
+				return
+			}
+
+			middleware.UpstreamError(req, middleware.UpstreamJournald)
+			logrus.Errorf("error reading journal %s", err)
+			s.close(err)
+			return
+		}
+	}
+}
+
+// wsFilesHandler streams the lines of a task log over a WebSocket connection, a message per line. The
+// parameters are the same as for the task log endpoints.
+func wsFilesHandler(w http.ResponseWriter, req *http.Request) {
+	if !wsFormat(req, jr.ContentTypePlainText, "text", "gelf") {
+		logError(w, req, "unsupported format "+req.URL.Query().Get(formatParam), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := buildOpts(req)
+	if err != nil {
+		logError(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the request context is not canceled when a hijacked connection is closed.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	r, err := setupFilesAPIReader(req, "/files/read", append(opts, reader.OptStream(true))...)
+	switch err {
+	case nil:
+	case reader.ErrFileNotFound:
+		logError(w, req, "File not found", http.StatusNotFound)
+		return
+	case reader.ErrBinaryFile:
+		logError(w, req, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case reader.ErrCursorExpired:
+		logError(w, req, err.Error(), http.StatusGone)
+		return
+	default:
+		if e, ok := err.(errSetupFilesAPIReader); ok {
+			logError(w, req, e.msg, e.code)
+			return
+		}
+
+		middleware.UpstreamError(req, middleware.UpstreamAgent)
+		logError(w, req, "unable to initialize files API reader: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, req)
+	if err != nil {
+		logrus.Errorf("unable to upgrade to websocket: %s. Request: %s", err, req.RequestURI)
+		return
+	}
+
+	s := newWSSession(ctx, conn)
+	defer s.close(nil)
+	go func() {
+		<-s.ctx.Done()
+		cancel()
+	}()
+
+	poll := newPollBackoff(wsPollInterval, followMaxInterval(req))
+	for s.wait() {
+		n, err := io.Copy(s, r)
+		switch {
+		case err == nil || err == reader.ErrNoData:
+		case s.ctx.Err() != nil:
+			logrus.Debugf("websocket client went away. Request URI: %s", req.RequestURI)
+			return
+		default:
+			if err != reader.ErrBinaryFile {
+				middleware.UpstreamError(req, middleware.UpstreamAgent)
+			}
+			logrus.Errorf("error while reading the files API reader: %s. Request: %s", err, req.RequestURI)
+			s.close(err)
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(poll.next(n > 0)):
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+const (
+	// gzipSuffix is appended to object keys of compressed archived files.
+	gzipSuffix = ".gz"
+
+	// MetadataFile is the object written next to the archived files of an executor sandbox.
+	MetadataFile = "dcos-log-metadata.json"
+)
+
+var (
+	// ErrNotArchived is returned by Fetcher if the requested file is not found in the archive.
+	ErrNotArchived = errors.New("file not found in archive")
+
+	// ErrUnsupportedScheme is returned by NewFetcher if the archive URL scheme is unknown.
+	ErrUnsupportedScheme = errors.New("unsupported archive URL scheme")
+)
+
+// Sandbox identifies a task sandbox on a given agent.
+type Sandbox struct {
+	AgentID     string `json:"agent_id"`
+	FrameworkID string `json:"framework_id"`
+	ExecutorID  string `json:"executor_id"`
+	ContainerID string `json:"container_id"`
+	TaskPath    string `json:"task_path,omitempty"`
+}
+
+// Key returns an object key for a file in the sandbox. The key follows the same layout as the mesos
+// sandbox path: <agent_id>/frameworks/<framework_id>/executors/<executor_id>/runs/<container_id>/[tasks/<task>/]<file>
+func (s Sandbox) Key(file string) string {
+	key := path.Join(s.AgentID, "frameworks", s.FrameworkID, "executors", s.ExecutorID, "runs", s.ContainerID)
+	if s.TaskPath != "" {
+		key = path.Join(key, "tasks", s.TaskPath)
+	}
+	return path.Join(key, file)
+}
+
+// Metadata describes an archived executor sandbox. It is kept with the archived files, so the reads of the files
+// are authorized once the agent no longer lists the executor.
+type Metadata struct {
+	Sandbox       Sandbox `json:"sandbox"`
+	FrameworkName string  `json:"framework_name,omitempty"`
+	ExecutorName  string  `json:"executor_name,omitempty"`
+
+	// Tasks are the task paths of the pod tasks with a sandbox in the executor sandbox.
+	Tasks      []string  `json:"tasks,omitempty"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Contains returns true if s is the archived executor sandbox or the sandbox of one of its pod tasks.
+func (m *Metadata) Contains(s Sandbox) bool {
+	task := s.TaskPath
+	s.TaskPath = ""
+	if s != m.Sandbox {
+		return false
+	}
+
+	if task == "" {
+		return true
+	}
+
+	for _, t := range m.Tasks {
+		if t == task {
+			return true
+		}
+	}
+	return false
+}
+
+// Backend is an object storage which keeps archived sandbox files.
+type Backend interface {
+	// Get returns the object content by key. If the object does not exist, ErrNotArchived must be returned.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Store is a Backend which can also write and delete objects. It's used by Archiver.
+type Store interface {
+	Backend
+
+	// Put writes the object content by key, the existing object is overwritten.
+	Put(ctx context.Context, key string, body []byte) error
+
+	// Delete removes the object by key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Uploader is implemented by the stores which write an object of unknown size from a reader, without keeping
+// the whole object in memory. Archiver uploads the sandbox files with it if the store implements it.
+type Uploader interface {
+	// Upload reads r until EOF and writes the object content by key, the existing object is overwritten.
+	Upload(ctx context.Context, key string, r io.Reader) error
+}
+
+// Fetcher retrieves archived sandbox files for tasks which sandboxes have been garbage collected.
+type Fetcher struct {
+	backend Backend
+}
+
+// NewFetcher returns a new instance of Fetcher for a given archive URL. The following schemes are supported:
+//
+//	s3://bucket/prefix?region=us-east-1&endpoint=https://minio:9000 - S3 compatible storage.
+//	webhdfs://namenode:50070/prefix - HDFS via WebHDFS REST API.
+//	file:///mnt/archive - archive mounted to the local filesystem.
+//	http(s)://host/prefix - plain HTTP object storage gateway.
+func NewFetcher(rawURL string, client *http.Client) (*Fetcher, error) {
+	backend, err := NewBackend(rawURL, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fetcher{backend: backend}, nil
+}
+
+// NewBackend returns a Backend implementation for a given archive URL.
+func NewBackend(rawURL string, client *http.Client) (Backend, error) {
+	return NewStore(rawURL, client)
+}
+
+// NewStore returns a Store implementation for a given archive URL.
+func NewStore(rawURL string, client *http.Client) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL %s: %s", rawURL, err)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Backend(u, client)
+	case "webhdfs":
+		return newWebHDFSBackend(u, client), nil
+	case "file":
+		return newFileBackend(u), nil
+	case "http", "https":
+		return newHTTPBackend(u, client), nil
+	}
+
+	return nil, ErrUnsupportedScheme
+}
+
+// Fetch returns the content of an archived file. Compressed archived files (with .gz suffix) are
+// decompressed on the fly.
+func (f *Fetcher) Fetch(ctx context.Context, s Sandbox, file string) (io.ReadCloser, error) {
+	key := s.Key(file)
+
+	rc, err := f.backend.Get(ctx, key)
+	if err == nil {
+		return rc, nil
+	}
+
+	if err != ErrNotArchived {
+		return nil, err
+	}
+
+	rc, err = f.backend.Get(ctx, key+gzipSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("unable to decompress %s: %s", key+gzipSuffix, err)
+	}
+
+	return gzipReadCloser{Reader: gz, body: rc}, nil
+}
+
+// Metadata returns the metadata of the executor sandbox of s, ErrNotArchived if the sandbox was not archived.
+func (f *Fetcher) Metadata(ctx context.Context, s Sandbox) (*Metadata, error) {
+	s.TaskPath = ""
+	rc, err := f.backend.Get(ctx, s.Key(MetadataFile))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	m := &Metadata{}
+	if err := json.NewDecoder(rc).Decode(m); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %s", s.Key(MetadataFile), err)
+	}
+	return m, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
@@ -0,0 +1,280 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testSandbox = Sandbox{
+	AgentID:     "agent",
+	FrameworkID: "framework",
+	ExecutorID:  "executor",
+	ContainerID: "container",
+}
+
+func TestSandboxKey(t *testing.T) {
+	expected := "agent/frameworks/framework/executors/executor/runs/container/stdout"
+	if key := testSandbox.Key("stdout"); key != expected {
+		t.Fatalf("expect key %s. Got %s", expected, key)
+	}
+
+	pod := testSandbox
+	pod.TaskPath = "task"
+	expected = "agent/frameworks/framework/executors/executor/runs/container/tasks/task/stderr"
+	if key := pod.Key("stderr"); key != expected {
+		t.Fatalf("expect key %s. Got %s", expected, key)
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	objectPath := filepath.Join(dir, filepath.FromSlash(testSandbox.Key("stdout")))
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(objectPath, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// stderr is compressed
+	fd, err := os.Create(filepath.Join(dir, filepath.FromSlash(testSandbox.Key("stderr")+gzipSuffix)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(fd)
+	gz.Write([]byte("compressed\n"))
+	gz.Close()
+	fd.Close()
+
+	f, err := NewFetcher("file://"+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{"stdout": "hello\n", "stderr": "compressed\n"} {
+		rc, err := f.Fetch(context.Background(), testSandbox, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != expected {
+			t.Fatalf("expect %q. Got %q", expected, body)
+		}
+	}
+
+	if _, err := f.Fetch(context.Background(), testSandbox, "missing"); err != ErrNotArchived {
+		t.Fatalf("expect ErrNotArchived. Got %v", err)
+	}
+}
+
+func TestS3Fetcher(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			t.Fatalf("invalid authorization header %s", r.Header.Get("Authorization"))
+		}
+
+		if r.URL.Path != "/bucket/prefix/"+testSandbox.Key("stdout") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("s3 object"))
+	}))
+	defer ts.Close()
+
+	f, err := NewFetcher("s3://bucket/prefix?endpoint="+ts.URL, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := f.Fetch(context.Background(), testSandbox, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "s3 object" {
+		t.Fatalf("expect s3 object. Got %s", body)
+	}
+
+	if _, err := f.Fetch(context.Background(), testSandbox, "stderr"); err != ErrNotArchived {
+		t.Fatalf("expect ErrNotArchived. Got %v", err)
+	}
+}
+
+func TestWebHDFSObjectURL(t *testing.T) {
+	b, err := NewBackend("webhdfs://namenode:50070/logs?user=hdfs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := b.(*webHDFSBackend).objectURL("a/stdout", "OPEN")
+	expected := "http://namenode:50070/webhdfs/v1/logs/a/stdout?op=OPEN&user.name=hdfs"
+	if u.String() != expected {
+		t.Fatalf("expect %s. Got %s", expected, u.String())
+	}
+}
+
+func TestWebHDFSUpload(t *testing.T) {
+	var body string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the namenode redirects to the datanode, the data is only sent to the datanode.
+		if r.URL.Query().Get("op") == "CREATE" {
+			if data, _ := ioutil.ReadAll(r.Body); len(data) > 0 {
+				t.Errorf("expect no data sent to the namenode. Got %q", data)
+			}
+			w.Header().Set("Location", ts.URL+"/datanode")
+			w.WriteHeader(http.StatusTemporaryRedirect)
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	b, err := NewStore(strings.Replace(ts.URL, "http://", "webhdfs://", 1)+"/logs", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.(Uploader).Upload(context.Background(), "a/stdout", strings.NewReader("task output")); err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "task output" {
+		t.Fatalf("expect the data sent to the datanode. Got %q", body)
+	}
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	if _, err := NewFetcher("ftp://host/path", nil); err != ErrUnsupportedScheme {
+		t.Fatalf("expect ErrUnsupportedScheme. Got %v", err)
+	}
+}
+
+// fakeMultipartServer implements S3 multipart upload API for a single object.
+type fakeMultipartServer struct {
+	mu       sync.Mutex
+	parts    map[string]string
+	object   string
+	aborted  bool
+	complete completeMultipartUpload
+}
+
+func (f *fakeMultipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == "POST" && q.Get("uploads") == "" && len(q["uploads"]) == 1:
+		f.parts = make(map[string]string)
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>upload1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == "PUT" && q.Get("uploadId") == "upload1":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.parts[q.Get("partNumber")] = string(body)
+		w.Header().Set("ETag", `"etag`+q.Get("partNumber")+`"`)
+	case r.Method == "POST" && q.Get("uploadId") == "upload1":
+		if err := xml.NewDecoder(r.Body).Decode(&f.complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, part := range f.complete.Parts {
+			f.object += f.parts[fmt.Sprint(part.PartNumber)]
+		}
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == "DELETE" && q.Get("uploadId") == "upload1":
+		f.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	fake := &fakeMultipartServer{}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	m, err := NewMultipartUploader("s3://bucket/exports?endpoint="+ts.URL, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.partSize = 4
+
+	if err := m.Upload(context.Background(), "a.log.gz", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.object != "0123456789" || len(fake.complete.Parts) != 3 || fake.complete.Parts[2].ETag != `"etag3"` {
+		t.Fatalf("unexpected upload %q %+v", fake.object, fake.complete)
+	}
+
+	if u := m.ObjectURL("a.log.gz"); u != ts.URL+"/bucket/exports/a.log.gz" {
+		t.Fatalf("unexpected object URL %s", u)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestMultipartUploadAbort(t *testing.T) {
+	fake := &fakeMultipartServer{}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	m, err := NewMultipartUploader("s3://bucket?endpoint="+ts.URL, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Upload(context.Background(), "a.log.gz", errReader{}); err == nil {
+		t.Fatal("expect error")
+	}
+
+	if !fake.aborted {
+		t.Fatal("expect the upload to be aborted")
+	}
+
+	if _, err := NewMultipartUploader("file:///tmp", nil); err != ErrUnsupportedScheme {
+		t.Fatalf("expect ErrUnsupportedScheme. Got %v", err)
+	}
+}
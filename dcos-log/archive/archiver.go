@@ -0,0 +1,394 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	indexFile = "index.json"
+
+	defaultArchiveInterval  = 5 * time.Minute
+	defaultArchiveRetention = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidInterval is returned by OptionInterval if the interval is zero or negative.
+	ErrInvalidInterval = errors.New("archive interval must be positive")
+
+	// ErrInvalidRetention is returned by OptionRetention if the retention is negative.
+	ErrInvalidRetention = errors.New("archive retention cannot be negative")
+
+	// ErrNoFiles is returned by OptionFiles if the list of files is empty.
+	ErrNoFiles = errors.New("list of files to archive cannot be empty")
+
+	errNoSandboxFile = errors.New("sandbox file not found")
+)
+
+// IndexEntry describes a single archived sandbox.
+type IndexEntry struct {
+	Sandbox    Sandbox   `json:"sandbox"`
+	Files      []string  `json:"files"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Index is a list of sandboxes archived from a single agent. It's stored in the archive at <agent_id>/index.json
+// and keyed by the sandbox key prefix.
+type Index struct {
+	Entries map[string]IndexEntry `json:"entries"`
+}
+
+// ArchiverOption is a functional option that configures an Archiver.
+type ArchiverOption func(*Archiver) error
+
+// OptionFiles sets a list of sandbox files to archive. The default is stdout and stderr.
+func OptionFiles(files ...string) ArchiverOption {
+	return func(a *Archiver) error {
+		if len(files) == 0 {
+			return ErrNoFiles
+		}
+		a.files = files
+		return nil
+	}
+}
+
+// OptionInterval sets how often the agent state is checked for terminated executors.
+func OptionInterval(d time.Duration) ArchiverOption {
+	return func(a *Archiver) error {
+		if d <= 0 {
+			return ErrInvalidInterval
+		}
+		a.interval = d
+		return nil
+	}
+}
+
+// OptionRetention sets how long the archived files are kept. Zero value keeps the files forever.
+func OptionRetention(d time.Duration) ArchiverOption {
+	return func(a *Archiver) error {
+		if d < 0 {
+			return ErrInvalidRetention
+		}
+		a.retention = d
+		return nil
+	}
+}
+
+// OptionHeader sets the optional header used in requests to mesos agent.
+func OptionHeader(h http.Header) ArchiverOption {
+	return func(a *Archiver) error {
+		a.header = h
+		return nil
+	}
+}
+
+// Archiver periodically uploads the files of terminated executors to a Store, so they could be served
+// by Fetcher after the sandbox is garbage collected.
+type Archiver struct {
+	store    Store
+	client   *http.Client
+	agentURL url.URL
+	header   http.Header
+
+	files     []string
+	interval  time.Duration
+	retention time.Duration
+}
+
+// NewArchiver returns a new instance of Archiver. agentURL is a base URL of the local mesos agent.
+func NewArchiver(store Store, client *http.Client, agentURL url.URL, opts ...ArchiverOption) (*Archiver, error) {
+	a := &Archiver{
+		store:     store,
+		client:    client,
+		agentURL:  agentURL,
+		files:     []string{"stdout", "stderr"},
+		interval:  defaultArchiveInterval,
+		retention: defaultArchiveRetention,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(a); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// Run archives the sandboxes every interval until the context is canceled.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.ArchiveOnce(ctx); err != nil {
+			logrus.Errorf("error archiving sandboxes: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveOnce archives all terminated executors which are not in the index yet and removes
+// the expired entries.
+func (a *Archiver) ArchiveOnce(ctx context.Context) error {
+	state, err := agent.GetState(ctx, a.client, a.agentURL, a.header)
+	if err != nil {
+		return err
+	}
+
+	index, err := a.loadIndex(ctx, state.ID)
+	if err != nil {
+		return err
+	}
+
+	var archiveErr error
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, executor := range framework.CompletedExecutors {
+			sandbox := Sandbox{
+				AgentID:     state.ID,
+				FrameworkID: framework.ID,
+				ExecutorID:  executor.ID,
+				ContainerID: executor.Container,
+			}
+
+			if _, ok := index.Entries[sandbox.Key("")]; ok {
+				continue
+			}
+
+			files, err := a.archiveExecutor(ctx, sandbox, framework, executor)
+			if err != nil {
+				archiveErr = err
+				logrus.Errorf("unable to archive sandbox %s: %s", executor.Directory, err)
+				continue
+			}
+
+			index.Entries[sandbox.Key("")] = IndexEntry{
+				Sandbox:    sandbox,
+				Files:      files,
+				ArchivedAt: time.Now(),
+			}
+			logrus.Debugf("archived %d files from sandbox %s", len(files), executor.Directory)
+		}
+	}
+
+	a.expire(ctx, index)
+
+	if err := a.saveIndex(ctx, state.ID, index); err != nil {
+		return err
+	}
+
+	return archiveErr
+}
+
+// archiveExecutor uploads the files of an executor sandbox and the nested task sandboxes of pods, then the metadata
+// of the sandbox. The keys of the uploaded objects are returned.
+func (a *Archiver) archiveExecutor(ctx context.Context, sandbox Sandbox, framework agent.Framework,
+	executor agent.Executor) ([]string, error) {
+	var archived []string
+
+	metadata := Metadata{
+		Sandbox:       sandbox,
+		FrameworkName: framework.Name,
+		ExecutorName:  executor.Name,
+		ArchivedAt:    time.Now(),
+	}
+
+	sandboxes := []Sandbox{sandbox}
+	for _, task := range executor.CompletedTasks {
+		// pod tasks have their own sandbox in the tasks/ folder.
+		if task.ID != executor.ID {
+			podTask := sandbox
+			podTask.TaskPath = task.ID
+			sandboxes = append(sandboxes, podTask)
+			metadata.Tasks = append(metadata.Tasks, task.ID)
+		}
+	}
+
+	for _, s := range sandboxes {
+		dir := executor.Directory
+		if s.TaskPath != "" {
+			dir = path.Join(dir, "tasks", s.TaskPath)
+		}
+
+		for _, file := range a.files {
+			key := s.Key(file) + gzipSuffix
+			err := a.archiveFile(ctx, path.Join(dir, file), key)
+			if err == errNoSandboxFile {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+			archived = append(archived, key)
+		}
+	}
+
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sandbox.Key(MetadataFile)
+	if err := a.store.Put(ctx, key, body); err != nil {
+		return nil, fmt.Errorf("unable to save the sandbox metadata: %s", err)
+	}
+	return append(archived, key), nil
+}
+
+// archiveFile downloads the file via mesos agent files API and uploads it gzip compressed to key. The file is
+// compressed while it is uploaded, the size of the file does not change the memory used if the store is an
+// Uploader.
+func (a *Archiver) archiveFile(ctx context.Context, filePath, key string) error {
+	u := a.agentURL
+	u.Path = "/files/download"
+	u.RawQuery = url.Values{"path": []string{filePath}}.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if a.header != nil {
+		req.Header = a.header
+	}
+
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %s", filePath, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNoSandboxFile
+	default:
+		return fmt.Errorf("unable to download %s: bad status %d", filePath, resp.StatusCode)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, resp.Body)
+		if err != nil {
+			err = fmt.Errorf("unable to download %s: %s", filePath, err)
+		} else {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = a.upload(ctx, key, pr)
+
+	// stops the compression if the upload failed before reading the whole file.
+	pr.CloseWithError(err)
+	<-done
+
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %s", key, err)
+	}
+	return nil
+}
+
+// upload streams r to the store if it's an Uploader, the other stores get the object in memory.
+func (a *Archiver) upload(ctx context.Context, key string, r io.Reader) error {
+	if uploader, ok := a.store.(Uploader); ok {
+		return uploader.Upload(ctx, key, r)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return a.store.Put(ctx, key, body)
+}
+
+// expire removes the archived files and index entries older than retention.
+func (a *Archiver) expire(ctx context.Context, index *Index) {
+	if a.retention == 0 {
+		return
+	}
+
+	for key, entry := range index.Entries {
+		if time.Since(entry.ArchivedAt) < a.retention {
+			continue
+		}
+
+		expired := true
+		for _, file := range entry.Files {
+			if err := a.store.Delete(ctx, file); err != nil {
+				logrus.Errorf("unable to delete expired archive file %s: %s", file, err)
+				expired = false
+			}
+		}
+
+		// keep the entry to retry removal next time.
+		if expired {
+			delete(index.Entries, key)
+		}
+	}
+}
+
+func (a *Archiver) loadIndex(ctx context.Context, agentID string) (*Index, error) {
+	index := &Index{Entries: make(map[string]IndexEntry)}
+
+	rc, err := a.store.Get(ctx, path.Join(agentID, indexFile))
+	if err == ErrNotArchived {
+		return index, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load archive index: %s", err)
+	}
+	defer rc.Close()
+
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load archive index: %s", err)
+	}
+
+	if err := json.Unmarshal(body, index); err != nil {
+		return nil, fmt.Errorf("unable to decode archive index: %s", err)
+	}
+
+	if index.Entries == nil {
+		index.Entries = make(map[string]IndexEntry)
+	}
+
+	return index, nil
+}
+
+func (a *Archiver) saveIndex(ctx context.Context, agentID string, index *Index) error {
+	body, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	if err := a.store.Put(ctx, path.Join(agentID, indexFile), body); err != nil {
+		return fmt.Errorf("unable to save archive index: %s", err)
+	}
+	return nil
+}
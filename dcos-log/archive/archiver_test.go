@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+)
+
+func newFakeAgent(t *testing.T, downloads *int) *httptest.Server {
+	state := agent.State{
+		ID: "agent",
+		Frameworks: []agent.Framework{
+			{
+				ID: "framework",
+				CompletedExecutors: []agent.Executor{
+					{
+						ID:             "executor",
+						Container:      "container",
+						Directory:      "/sandbox",
+						CompletedTasks: []agent.Task{{ID: "executor"}},
+					},
+				},
+			},
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/state":
+			if err := json.NewEncoder(w).Encode(state); err != nil {
+				t.Fatal(err)
+			}
+		case "/files/download":
+			*downloads++
+			if r.URL.Query().Get("path") != "/sandbox/stdout" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("task output\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestArchiveOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var downloads int
+	ts := newFakeAgent(t, &downloads)
+	defer ts.Close()
+
+	agentURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore("file://"+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewArchiver(store, http.DefaultClient, *agentURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.ArchiveOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// stdout and stderr requested
+	if downloads != 2 {
+		t.Fatalf("expect 2 downloads. Got %d", downloads)
+	}
+
+	f, err := NewFetcher("file://"+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := Sandbox{AgentID: "agent", FrameworkID: "framework", ExecutorID: "executor", ContainerID: "container"}
+	rc, err := f.Fetch(context.Background(), sandbox, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "task output\n" {
+		t.Fatalf("expect archived stdout. Got %q", body)
+	}
+
+	// the metadata describes the sandbox once the agent no longer lists the executor.
+	metadata, err := f.Metadata(context.Background(), sandbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Sandbox != sandbox || !metadata.Contains(sandbox) || metadata.ArchivedAt.IsZero() {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+
+	podTask := sandbox
+	podTask.TaskPath = "other"
+	other := sandbox
+	other.ExecutorID = "other"
+	if metadata.Contains(podTask) || metadata.Contains(other) {
+		t.Fatalf("expect the metadata not to contain the other sandboxes. Got %+v", metadata)
+	}
+
+	if _, err := f.Metadata(context.Background(), other); err != ErrNotArchived {
+		t.Fatalf("expect the metadata of an executor which was not archived to be missing. Got %v", err)
+	}
+
+	// already archived sandboxes must be skipped
+	if err := a.ArchiveOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloads != 2 {
+		t.Fatalf("expect archived sandbox to be skipped. Got %d downloads", downloads)
+	}
+}
+
+func TestArchiverExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore("file://"+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(context.Background(), "old.gz", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewArchiver(store, http.DefaultClient, url.URL{}, OptionRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &Index{Entries: map[string]IndexEntry{
+		"old": {Files: []string{"old.gz"}, ArchivedAt: time.Now().Add(-2 * time.Hour)},
+		"new": {ArchivedAt: time.Now()},
+	}}
+
+	a.expire(context.Background(), index)
+	if _, ok := index.Entries["old"]; ok {
+		t.Fatal("expect old entry to be removed")
+	}
+
+	if _, ok := index.Entries["new"]; !ok {
+		t.Fatal("expect new entry to be kept")
+	}
+
+	if _, err := store.Get(context.Background(), "old.gz"); err != ErrNotArchived {
+		t.Fatalf("expect expired file to be removed. Got %v", err)
+	}
+}
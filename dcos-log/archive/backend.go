@@ -0,0 +1,283 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// getObject makes a GET request and maps the response status to archive errors.
+func getObject(ctx context.Context, client *http.Client, req *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to make a GET request to %s: %s", req.URL, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotArchived
+	}
+
+	resp.Body.Close()
+	return nil, fmt.Errorf("bad status %d from %s", resp.StatusCode, req.URL)
+}
+
+// doRequest makes a request which does not return a body, the accepted status codes are considered a success.
+func doRequest(ctx context.Context, client *http.Client, req *http.Request, accepted ...int) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to make a %s request to %s: %s", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	for _, code := range accepted {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("bad status %d from %s %s", resp.StatusCode, req.Method, req.URL)
+}
+
+// httpBackend reads objects from a plain HTTP gateway, the object key is appended to the base URL path.
+type httpBackend struct {
+	client  *http.Client
+	baseURL url.URL
+}
+
+func newHTTPBackend(u *url.URL, client *http.Client) *httpBackend {
+	return &httpBackend{client: client, baseURL: *u}
+}
+
+func (h *httpBackend) objectURL(key string) url.URL {
+	u := h.baseURL
+	u.Path = path.Join("/", u.Path, key)
+	return u
+}
+
+func (h *httpBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u := h.objectURL(key)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return getObject(ctx, h.client, req)
+}
+
+func (h *httpBackend) Put(ctx context.Context, key string, body []byte) error {
+	u := h.objectURL(key)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, h.client, req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+// Upload sends the object with a chunked request body.
+func (h *httpBackend) Upload(ctx context.Context, key string, r io.Reader) error {
+	u := h.objectURL(key)
+	req, err := http.NewRequest("PUT", u.String(), ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, h.client, req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+func (h *httpBackend) Delete(ctx context.Context, key string) error {
+	u := h.objectURL(key)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, h.client, req, http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound)
+}
+
+// webHDFSBackend reads objects from HDFS using WebHDFS REST API.
+// https://hadoop.apache.org/docs/stable/hadoop-project-dist/hadoop-hdfs/WebHDFS.html
+type webHDFSBackend struct {
+	client  *http.Client
+	baseURL url.URL
+	user    string
+}
+
+func newWebHDFSBackend(u *url.URL, client *http.Client) *webHDFSBackend {
+	baseURL := *u
+	baseURL.Scheme = "http"
+	if u.Query().Get("tls") == "true" {
+		baseURL.Scheme = "https"
+	}
+
+	return &webHDFSBackend{
+		client:  client,
+		baseURL: baseURL,
+		user:    u.Query().Get("user"),
+	}
+}
+
+func (w *webHDFSBackend) objectURL(key, op string) url.URL {
+	u := w.baseURL
+	u.Path = path.Join("/webhdfs/v1", u.Path, key)
+
+	v := url.Values{}
+	v.Set("op", op)
+	if w.user != "" {
+		v.Set("user.name", w.user)
+	}
+	u.RawQuery = v.Encode()
+	return u
+}
+
+func (w *webHDFSBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u := w.objectURL(key, "OPEN")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// namenode redirects the client to a datanode, http.Client follows the redirect.
+	return getObject(ctx, w.client, req)
+}
+
+func (w *webHDFSBackend) Put(ctx context.Context, key string, body []byte) error {
+	u := w.objectURL(key, "CREATE")
+	q := u.Query()
+	q.Set("overwrite", "true")
+	u.RawQuery = q.Encode()
+
+	// bytes.Reader allows the client to replay the body on 307 redirect to a datanode.
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, w.client, req, http.StatusCreated, http.StatusOK)
+}
+
+// Upload creates the file in two steps, as WebHDFS recommends for the clients which cannot replay the body: the
+// namenode is asked for the datanode without data, then the data is streamed to the datanode.
+func (w *webHDFSBackend) Upload(ctx context.Context, key string, r io.Reader) error {
+	u := w.objectURL(key, "CREATE")
+	q := u.Query()
+	q.Set("overwrite", "true")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("PUT", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	client := *w.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to make a PUT request to %s: %s", req.URL, err)
+	}
+	resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusTemporaryRedirect || location == "" {
+		return fmt.Errorf("bad status %d from PUT %s, expect a redirect to a datanode", resp.StatusCode, req.URL)
+	}
+
+	req, err = http.NewRequest("PUT", location, ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, w.client, req, http.StatusCreated, http.StatusOK)
+}
+
+func (w *webHDFSBackend) Delete(ctx context.Context, key string) error {
+	u := w.objectURL(key, "DELETE")
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, w.client, req, http.StatusOK, http.StatusNotFound)
+}
+
+// fileBackend reads objects from a directory, for instance NFS or HDFS fuse mount.
+type fileBackend struct {
+	dir string
+}
+
+func newFileBackend(u *url.URL) *fileBackend {
+	return &fileBackend{dir: u.Path}
+}
+
+func (f *fileBackend) objectPath(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (f *fileBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	fd, err := os.Open(f.objectPath(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotArchived
+	}
+	return fd, err
+}
+
+func (f *fileBackend) Put(ctx context.Context, key string, body []byte) error {
+	objectPath := f.objectPath(key)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so readers never see a partially written object.
+	tmp := objectPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, objectPath)
+}
+
+// Upload writes the object to a temporary file first, so readers never see a partially written object.
+func (f *fileBackend) Upload(ctx context.Context, key string, r io.Reader) error {
+	objectPath := f.objectPath(key)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+
+	tmp := objectPath + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fd, r)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, objectPath)
+}
+
+func (f *fileBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.objectPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// minPartSize is the minimum size of all but the last part of S3 multipart upload.
+const minPartSize = 5 * 1024 * 1024
+
+// defaultPartSize is a size of parts uploaded by MultipartUploader.
+const defaultPartSize = 8 * 1024 * 1024
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// MultipartUploader streams objects of unknown size to S3 compatible storage using multipart upload,
+// at most one part is kept in memory.
+type MultipartUploader struct {
+	s3       *s3Backend
+	partSize int
+}
+
+// NewMultipartUploader returns a new instance of MultipartUploader for s3:// URL, see NewFetcher for
+// the URL format. ErrUnsupportedScheme is returned for other schemes.
+func NewMultipartUploader(rawURL string, client *http.Client) (*MultipartUploader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid export URL %s: %s", rawURL, err)
+	}
+
+	if u.Scheme != "s3" {
+		return nil, ErrUnsupportedScheme
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	s3, err := newS3Backend(u, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultipartUploader{s3: s3, partSize: defaultPartSize}, nil
+}
+
+// ObjectURL returns the URL of the object with a given key.
+func (m *MultipartUploader) ObjectURL(key string) string {
+	u := m.s3.objectURL(key)
+	return u.String()
+}
+
+// Upload reads r until EOF and stores the content in the object with a given key. The incomplete upload
+// is aborted if r or the storage returns an error.
+func (m *MultipartUploader) Upload(ctx context.Context, key string, r io.Reader) (err error) {
+	uploadID, err := m.initiate(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			if abortErr := m.abort(key, uploadID); abortErr != nil {
+				err = fmt.Errorf("%s; unable to abort upload: %s", err, abortErr)
+			}
+		}
+	}()
+
+	var (
+		parts []completedPart
+		buf   = make([]byte, m.partSize)
+	)
+
+	for partNumber := 1; ; partNumber++ {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+
+		// an empty object is uploaded as a single empty part.
+		if n > 0 || partNumber == 1 {
+			etag, err := m.uploadPart(ctx, key, uploadID, partNumber, buf[:n])
+			if err != nil {
+				return err
+			}
+			parts = append(parts, completedPart{PartNumber: partNumber, ETag: etag})
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	return m.complete(ctx, key, uploadID, parts)
+}
+
+func (m *MultipartUploader) request(method, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := m.s3.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	m.s3.sign(req, hexSHA256(body), time.Now())
+	return req, nil
+}
+
+func (m *MultipartUploader) initiate(ctx context.Context, key string) (string, error) {
+	req, err := m.request("POST", key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := m.s3.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to initiate multipart upload %s: %s", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to initiate multipart upload %s: bad status %d", key, resp.StatusCode)
+	}
+
+	result := &initiateMultipartUploadResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", fmt.Errorf("unable to decode multipart upload %s: %s", key, err)
+	}
+
+	if result.UploadID == "" {
+		return "", fmt.Errorf("empty upload ID for multipart upload %s", key)
+	}
+
+	return result.UploadID, nil
+}
+
+func (m *MultipartUploader) uploadPart(ctx context.Context, key, uploadID string, partNumber int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	req, err := m.request("PUT", key, query, body)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := m.s3.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to upload part %d of %s: %s", partNumber, key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to upload part %d of %s: bad status %d", partNumber, key, resp.StatusCode)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func (m *MultipartUploader) complete(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	req, err := m.request("POST", key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.s3.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to complete multipart upload %s: %s", key, err)
+	}
+	defer resp.Body.Close()
+
+	// S3 may return an error in the body of 200 OK response.
+	var result struct {
+		XMLName xml.Name
+		Message string `xml:"Message"`
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to complete multipart upload %s: bad status %d", key, resp.StatusCode)
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("unable to complete multipart upload %s: %s", key, result.Message)
+	}
+
+	return nil
+}
+
+// abort removes the uploaded parts, it's called with a new context since the request context may be canceled.
+func (m *MultipartUploader) abort(key, uploadID string) error {
+	req, err := m.request("DELETE", key, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return doRequest(ctx, m.s3.client, req, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
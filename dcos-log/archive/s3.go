@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+
+	// emptyPayloadHash is sha256 of an empty string.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3Credentials are AWS compatible access keys used to sign requests.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// credentialsFromEnv reads the standard AWS environment variables.
+func credentialsFromEnv() s3Credentials {
+	return s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// s3Backend reads objects from S3 compatible storage using path-style requests signed with AWS signature v4.
+type s3Backend struct {
+	client   *http.Client
+	endpoint url.URL
+	bucket   string
+	prefix   string
+	region   string
+	creds    s3Credentials
+}
+
+func newS3Backend(u *url.URL, client *http.Client) (*s3Backend, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("bucket name is required in S3 URL %s", u)
+	}
+
+	region := u.Query().Get("region")
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	endpointStr := u.Query().Get("endpoint")
+	if endpointStr == "" {
+		endpointStr = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	endpoint, err := url.Parse(endpointStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %s", endpointStr, err)
+	}
+
+	return &s3Backend{
+		client:   client,
+		endpoint: *endpoint,
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		region:   region,
+		creds:    credentialsFromEnv(),
+	}, nil
+}
+
+func (s *s3Backend) objectURL(key string) url.URL {
+	u := s.endpoint
+	u.Path = path.Join("/", s.bucket, s.prefix, key)
+	return u
+}
+
+func (s *s3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(req, emptyPayloadHash, time.Now())
+	return getObject(ctx, s.client, req)
+}
+
+func (s *s3Backend) Put(ctx context.Context, key string, body []byte) error {
+	u := s.objectURL(key)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	s.sign(req, hexSHA256(body), time.Now())
+	return doRequest(ctx, s.client, req, http.StatusOK)
+}
+
+// Upload streams the object with a multipart upload, at most a part is kept in memory.
+func (s *s3Backend) Upload(ctx context.Context, key string, r io.Reader) error {
+	m := &MultipartUploader{s3: s, partSize: defaultPartSize}
+	return m.Upload(ctx, key, r)
+}
+
+func (s *s3Backend) Delete(ctx context.Context, key string) error {
+	u := s.objectURL(key)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	s.sign(req, emptyPayloadHash, time.Now())
+	return doRequest(ctx, s.client, req, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+// sign adds AWS signature v4 headers to the request. Anonymous requests are sent if no credentials are set.
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s *s3Backend) sign(req *http.Request, payloadHash string, now time.Time) {
+	if s.creds.accessKeyID == "" {
+		return
+	}
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.sessionToken)
+	}
+
+	var signedHeaders []string
+	for k := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(k))
+	}
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders string
+	for _, h := range signedHeaders {
+		canonicalHeaders += h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, s.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.creds.secretAccessKey), shortDate)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.accessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func canonicalQuery(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := v[k]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
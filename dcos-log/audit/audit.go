@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+// Journald is the target of New which writes the events to the journal.
+const Journald = "journald"
+
+// ErrJournalDisabled is returned by New if the journald socket is not available.
+var ErrJournalDisabled = errors.New("journald is not available")
+
+// Event is an access to the logs: who read which logs, from where and how much was served.
+type Event struct {
+	Time   time.Time `json:"time"`
+	UID    string    `json:"uid"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method"`
+	Route  string    `json:"route"`
+	Path   string    `json:"path"`
+
+	// Vars are the variables of the route, such as the frameworkID, executorID and containerID of a task or the
+	// name of a component. Filters are the filter parameters, the units or fields of the journal entries read.
+	Vars    map[string]string `json:"vars,omitempty"`
+	Filters []string          `json:"filters,omitempty"`
+
+	Status   int     `json:"status"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration"`
+}
+
+// Logger records the audit events.
+type Logger interface {
+	Log(e Event) error
+}
+
+// New returns a logger which writes the events to the journal with the syslog identifier if target is Journald,
+// otherwise it appends them as JSON lines to the file target.
+func New(target, identifier string) (Logger, error) {
+	if target == Journald {
+		if !journal.Enabled() {
+			return nil, ErrJournalDisabled
+		}
+		return NewJournalLogger(identifier), nil
+	}
+	return NewFileLogger(target)
+}
+
+// JournalLogger writes the events to the journal, the fields of an event are AUDIT_ prefixed journal fields.
+type JournalLogger struct {
+	identifier string
+	send       func(message string, priority journal.Priority, vars map[string]string) error
+}
+
+// NewJournalLogger returns a logger which writes the events to the journal with the syslog identifier, so they
+// are read apart from the log of dcos-log with journalctl -t identifier.
+func NewJournalLogger(identifier string) *JournalLogger {
+	return &JournalLogger{identifier: identifier, send: journal.Send}
+}
+
+// Log writes an event to the journal.
+func (l *JournalLogger) Log(e Event) error {
+	vars := map[string]string{
+		"SYSLOG_IDENTIFIER": l.identifier,
+		"AUDIT_UID":         e.UID,
+		"AUDIT_REMOTE":      e.Remote,
+		"AUDIT_METHOD":      e.Method,
+		"AUDIT_ROUTE":       e.Route,
+		"AUDIT_PATH":        e.Path,
+		"AUDIT_STATUS":      strconv.Itoa(e.Status),
+		"AUDIT_BYTES":       strconv.FormatInt(e.Bytes, 10),
+		"AUDIT_DURATION":    strconv.FormatFloat(e.Duration, 'f', -1, 64),
+	}
+
+	for k, v := range e.Vars {
+		vars["AUDIT_VAR_"+strings.ToUpper(k)] = v
+	}
+
+	if len(e.Filters) > 0 {
+		vars["AUDIT_FILTERS"] = strings.Join(e.Filters, ",")
+	}
+	return l.send(e.message(), journal.PriInfo, vars)
+}
+
+// FileLogger appends the events to a file as JSON lines.
+type FileLogger struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileLogger opens the file for the events, it's created readable by the owner only if it does not exist.
+func NewFileLogger(path string) (*FileLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogger{f: f}, nil
+}
+
+// Log appends an event to the file.
+func (l *FileLogger) Log(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (l *FileLogger) Close() error {
+	return l.f.Close()
+}
+
+// message returns the event as a text line, the message of the journal entry.
+func (e Event) message() string {
+	uid := e.UID
+	if uid == "" {
+		uid = "anonymous"
+	}
+
+	msg := fmt.Sprintf("%s from %s: %s %s status %d, %d bytes", uid, e.Remote, e.Method, e.Path, e.Status, e.Bytes)
+	if len(e.Filters) > 0 {
+		msg += ", filters " + strings.Join(e.Filters, ",")
+	}
+
+	keys := make([]string, 0, len(e.Vars))
+	for k := range e.Vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		msg += fmt.Sprintf(" %s=%s", k, e.Vars[k])
+	}
+	return msg
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+var testEvent = Event{
+	Time:    time.Unix(1500000000, 0),
+	UID:     "alice",
+	Remote:  "10.0.0.1:5000",
+	Method:  "GET",
+	Route:   "/v2/task/frameworks/{frameworkID}/executors/{executorID}/runs/{containerID}/{file}",
+	Path:    "/v2/task/frameworks/f1/executors/e1/runs/c1/stdout",
+	Vars:    map[string]string{"frameworkID": "f1", "executorID": "e1", "containerID": "c1", "file": "stdout"},
+	Filters: []string{"unit:dcos-marathon"},
+	Status:  200,
+	Bytes:   42,
+}
+
+func TestJournalLogger(t *testing.T) {
+	var (
+		message string
+		fields  map[string]string
+	)
+
+	l := NewJournalLogger("dcos-log-audit")
+	l.send = func(msg string, priority journal.Priority, vars map[string]string) error {
+		message, fields = msg, vars
+		return nil
+	}
+
+	if err := l.Log(testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"SYSLOG_IDENTIFIER":     "dcos-log-audit",
+		"AUDIT_UID":             "alice",
+		"AUDIT_REMOTE":          "10.0.0.1:5000",
+		"AUDIT_STATUS":          "200",
+		"AUDIT_BYTES":           "42",
+		"AUDIT_VAR_FRAMEWORKID": "f1",
+		"AUDIT_FILTERS":         "unit:dcos-marathon",
+	}
+
+	for k, v := range expect {
+		if fields[k] != v {
+			t.Fatalf("expect %s=%s. Got %s", k, v, fields[k])
+		}
+	}
+
+	if !strings.HasPrefix(message, "alice from 10.0.0.1:5000: GET /v2/task/") || !strings.Contains(message, "42 bytes") {
+		t.Fatalf("unexpected message %s", message)
+	}
+}
+
+func TestFileLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := New(path, "dcos-log-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := l.Log(testEvent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.(*FileLogger).Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expect the file readable by the owner only. Got %v, %v", info.Mode(), err)
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 || events[1].UID != "alice" || events[1].Bytes != 42 || events[1].Vars["file"] != "stdout" {
+		t.Fatalf("expect 2 events. Got %+v", events)
+	}
+}
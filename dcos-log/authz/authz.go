@@ -0,0 +1,148 @@
+// Package authz decides which users may read the logs of a task. A Policy is consulted by the task log
+// handlers before a sandbox is read, the default policy allows everything.
+//
+// FrameworkPolicy is a JSON file with a list of rules:
+//
+//	{"rules": [
+//	  {"uids": ["bootstrapuser"], "frameworks": ["*"]},
+//	  {"uids": ["alice", "bob"], "frameworks": ["b2ea6a49-*"]},
+//	  {"frameworks": ["marathon-framework-id"]}
+//	]}
+//
+// A user may read the tasks of the frameworks listed by the rules with the uid of the user and the rules
+// without uids. Framework patterns use path.Match syntax.
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync"
+)
+
+// ErrNoRules is returned by ParseFrameworkPolicy if a policy has no rules.
+var ErrNoRules = errors.New("task authorization policy must have at least one rule")
+
+// Task identifies the sandbox a user wants to read.
+type Task struct {
+	FrameworkID string
+	ExecutorID  string
+	ContainerID string
+
+	// TaskPath is a task of a pod, empty for other tasks.
+	TaskPath string
+}
+
+// Policy decides whether a user may read the logs of a task. The uid is empty if the request has no token.
+type Policy interface {
+	Allowed(uid string, task Task) bool
+}
+
+// PolicyFunc is an adapter to use a function as a Policy.
+type PolicyFunc func(uid string, task Task) bool
+
+// Allowed calls f(uid, task).
+func (f PolicyFunc) Allowed(uid string, task Task) bool {
+	return f(uid, task)
+}
+
+// AllowAll is a policy which allows every user to read every task.
+var AllowAll Policy = PolicyFunc(func(string, Task) bool { return true })
+
+// Rule lets the users with given uids, or all users if there are none, read the tasks of the frameworks.
+type Rule struct {
+	UIDs       []string `json:"uids,omitempty"`
+	Frameworks []string `json:"frameworks"`
+}
+
+// FrameworkPolicy is a list of rules.
+type FrameworkPolicy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ParseFrameworkPolicy parses a JSON policy.
+func ParseFrameworkPolicy(data []byte) (*FrameworkPolicy, error) {
+	p := &FrameworkPolicy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	if len(p.Rules) == 0 {
+		return nil, ErrNoRules
+	}
+
+	for i, rule := range p.Rules {
+		for _, pattern := range rule.Frameworks {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern %q: %s", i, pattern, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// LoadFrameworkPolicy reads a policy file.
+func LoadFrameworkPolicy(file string) (*FrameworkPolicy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFrameworkPolicy(data)
+}
+
+// applies returns true if a rule applies to a user.
+func (r Rule) applies(uid string) bool {
+	if len(r.UIDs) == 0 {
+		return true
+	}
+
+	for _, u := range r.UIDs {
+		if uid != "" && u == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if a rule of the user lists the framework of the task.
+func (p *FrameworkPolicy) Allowed(uid string, task Task) bool {
+	for _, rule := range p.Rules {
+		if !rule.applies(uid) {
+			continue
+		}
+
+		for _, pattern := range rule.Frameworks {
+			// patterns are validated by ParseFrameworkPolicy.
+			if ok, _ := path.Match(pattern, task.FrameworkID); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultPolicy = AllowAll
+)
+
+// SetDefault sets the policy used by the API handlers, nil restores AllowAll.
+func SetDefault(p Policy) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if p == nil {
+		p = AllowAll
+	}
+	defaultPolicy = p
+}
+
+// Default returns the policy used by the API handlers.
+func Default() Policy {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultPolicy
+}
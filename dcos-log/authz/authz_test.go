@@ -0,0 +1,57 @@
+package authz
+
+import "testing"
+
+const testPolicy = `{"rules": [
+  {"uids": ["bootstrapuser"], "frameworks": ["*"]},
+  {"uids": ["alice"], "frameworks": ["fw-a*"]},
+  {"frameworks": ["fw-public"]}
+]}`
+
+func TestFrameworkPolicy(t *testing.T) {
+	p, err := ParseFrameworkPolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		uid       string
+		framework string
+		allowed   bool
+	}{
+		{"bootstrapuser", "fw-b", true},
+		{"alice", "fw-a1", true},
+		{"alice", "fw-public", true},
+		{"alice", "fw-b", false},
+		{"", "fw-public", true},
+		{"", "fw-a1", false},
+	} {
+		if allowed := p.Allowed(tc.uid, Task{FrameworkID: tc.framework}); allowed != tc.allowed {
+			t.Fatalf("expect %s allowed to read %s: %t. Got %t", tc.uid, tc.framework, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestParseFrameworkPolicyErrors(t *testing.T) {
+	for _, data := range []string{`{"rules": []}`, `{"rules": [{"frameworks": ["["]}]}`, `{`} {
+		if _, err := ParseFrameworkPolicy([]byte(data)); err == nil {
+			t.Fatalf("expect error for %s", data)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if !Default().Allowed("", Task{FrameworkID: "fw"}) {
+		t.Fatal("expect the default policy to allow everything")
+	}
+
+	SetDefault(PolicyFunc(func(string, Task) bool { return false }))
+	if Default().Allowed("", Task{FrameworkID: "fw"}) {
+		t.Fatal("expect the policy set to be used")
+	}
+
+	SetDefault(nil)
+	if !Default().Allowed("", Task{FrameworkID: "fw"}) {
+		t.Fatal("expect nil to restore AllowAll")
+	}
+}
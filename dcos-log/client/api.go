@@ -0,0 +1,263 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// JournalEntry is a journal entry in the JSON format of dcos-log.
+type JournalEntry struct {
+	Fields             map[string]string `json:"fields"`
+	Cursor             string            `json:"cursor"`
+	MonotonicTimestamp uint64            `json:"monotonic_timestamp"`
+	RealtimeTimestamp  uint64            `json:"realtime_timestamp"`
+}
+
+// JournalQuery selects the journal entries of RangeJournal and StreamJournal.
+type JournalQuery struct {
+	// Unit is the systemd unit, such as dcos-marathon. The entries of all units are read if empty.
+	Unit string
+
+	// Agent is the ID of the agent the entries are read from, the entries of the master are read if empty.
+	Agent string
+
+	// Filters are FIELD:value matches, such as _SYSTEMD_UNIT:dcos-mesos-master.service.
+	Filters []string
+
+	// Cursor is the position of the first entry, the head of the journal if empty. LastEventID continues right
+	// after the entry of a cursor instead, the cursor of the last entry a stream received; Skip and Limit are
+	// ignored then.
+	Cursor      string
+	LastEventID string
+
+	// Skip moves the position by a number of entries, backwards if negative. Limit is the number of entries
+	// RangeJournal reads, 0 reads all.
+	Skip  int
+	Limit int
+}
+
+func (q JournalQuery) path() string {
+	base := logsPath
+	if q.Agent != "" {
+		base = fmt.Sprintf(agentLogsPath, q.Agent)
+	}
+	return path.Join(base, "v2/component", q.Unit)
+}
+
+func (q JournalQuery) query() url.Values {
+	query := url.Values{}
+	for _, f := range q.Filters {
+		query.Add("filter", f)
+	}
+
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+
+	if q.Skip != 0 {
+		query.Set("skip", strconv.Itoa(q.Skip))
+	}
+
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return query
+}
+
+func (q JournalQuery) header(accept string) http.Header {
+	header := http.Header{"Accept": {accept}}
+	if q.LastEventID != "" {
+		header.Set("Last-Event-ID", q.LastEventID)
+	}
+	return header
+}
+
+// RangeJournal returns the journal entries of the query.
+func (c *Client) RangeJournal(ctx context.Context, q JournalQuery) ([]JournalEntry, error) {
+	resp, err := c.getHeader(ctx, q.path(), q.query(), q.header("application/json"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var entries []JournalEntry
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var entry JournalEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, fmt.Errorf("unable to decode a journal entry: %s", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// StreamJournal calls fn with the journal entries of the query and the new entries as they are written, until ctx
+// is done, the stream is closed or fn returns an error. Cursor of the last entry is the LastEventID a closed
+// stream is continued with.
+func (c *Client) StreamJournal(ctx context.Context, q JournalQuery, fn func(JournalEntry) error) error {
+	resp, err := c.getHeader(ctx, q.path(), q.query(), q.header("text/event-stream"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readEvents(resp.Body, func(id, data string) error {
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return fmt.Errorf("unable to decode a journal entry: %s", err)
+		}
+
+		if entry.Cursor == "" {
+			entry.Cursor = id
+		}
+		return fn(entry)
+	})
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// TaskLine is a line of a task log, Cursor is the position right after the line.
+type TaskLine struct {
+	Fields map[string]string `json:"fields"`
+	Cursor string            `json:"cursor"`
+}
+
+// TaskQuery selects the lines of TaskLogs.
+type TaskQuery struct {
+	// File is the sandbox file, stdout if empty.
+	File string
+
+	// Cursor is the byte offset the lines start at, the cursor of a line continues right after it.
+	Cursor string
+
+	// Skip moves the position by a number of lines, backwards if negative. Limit is the number of lines read, 0
+	// reads all.
+	Skip  int
+	Limit int
+
+	// Follow keeps calling fn with the new lines as they are written.
+	Follow bool
+}
+
+// TaskLogs calls fn with the lines of the log of the task with taskID, found by the discovery of dcos-log, until
+// the end of the file, or with q.Follow until ctx is done or the connection is closed. It stops if fn returns an
+// error.
+func (c *Client) TaskLogs(ctx context.Context, taskID string, q TaskQuery, fn func(TaskLine) error) error {
+	file := q.File
+	if file == "" {
+		file = "stdout"
+	}
+
+	query := url.Values{}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+
+	if q.Skip != 0 {
+		query.Set("skip", strconv.Itoa(q.Skip))
+	}
+
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	if q.Follow {
+		query.Set("follow", "true")
+	}
+
+	resp, err := c.get(ctx, path.Join(logsPath, "v2/task", taskID, "file", file), query, "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line TaskLine
+		if err := decoder.Decode(&line); err == io.EOF || ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to decode a task log line: %s", err)
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// SandboxFile is a file of a task sandbox, Name is the name to read it with TaskQuery.File.
+type SandboxFile struct {
+	GID   string `json:"gid"`
+	Mode  string `json:"mode"`
+	MTime uint64 `json:"mtime"`
+	NLink uint   `json:"nlink"`
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	UID   string `json:"uid"`
+	Name  string `json:"name"`
+}
+
+// BrowseSandbox returns the files of the sandbox of the task with taskID.
+func (c *Client) BrowseSandbox(ctx context.Context, taskID string) ([]SandboxFile, error) {
+	resp, err := c.get(ctx, path.Join(logsPath, "v2/task", taskID, "browse"), url.Values{}, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var files []SandboxFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, fmt.Errorf("unable to decode the sandbox files: %s", err)
+	}
+	return files, nil
+}
+
+// readEvents calls fn with the id and data of the server sent events of r, the data lines of an event are joined
+// with new lines. The comments, such as the heartbeats, are skipped.
+func readEvents(r io.Reader, fn func(id, data string) error) error {
+	var (
+		id   string
+		data []string
+	)
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(id, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			id, data = "", nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimPrefix(strings.TrimPrefix(line, "id:"), " ")
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
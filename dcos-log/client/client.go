@@ -0,0 +1,226 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// logsPath is the path of dcos-log of the masters behind adminrouter, agentLogsPath of dcos-log of an agent.
+const (
+	logsPath      = "/system/v1/logs"
+	agentLogsPath = "/system/v1/agent/%s/logs"
+)
+
+// formats are the content types of the formats a log is read in.
+var formats = map[string]string{
+	"text":   "text/plain",
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+}
+
+// ErrUnknownFormat is returned if Options has a format which is not text, json or ndjson.
+var ErrUnknownFormat = errors.New("unknown format, must be text, json or ndjson")
+
+// Options select the part of a log to read and its format.
+type Options struct {
+	// Follow keeps the response open and writes the new lines as they are written, like tail -f.
+	Follow bool
+
+	// Lines is the number of last lines written before following, 0 writes the whole log.
+	Lines int
+
+	// Format is text, json or ndjson. Empty is text.
+	Format string
+
+	// File is the sandbox file of a task log, stdout if empty.
+	File string
+
+	// Agent is the ID of the agent the unit logs are read from, the logs of the master are read if empty.
+	Agent string
+}
+
+func (o Options) query() url.Values {
+	query := url.Values{}
+	if o.Lines > 0 {
+		query.Set("skip", strconv.Itoa(-o.Lines))
+	}
+
+	if o.Follow {
+		query.Set("follow", "true")
+	}
+	return query
+}
+
+func (o Options) accept() (string, error) {
+	if o.Format == "" {
+		return formats["text"], nil
+	}
+
+	accept, ok := formats[o.Format]
+	if !ok {
+		return "", ErrUnknownFormat
+	}
+	return accept, nil
+}
+
+// Task is a task found by the discovery of dcos-log, URL is the path of its task log.
+type Task struct {
+	AgentID     string `json:"agent_id"`
+	FrameworkID string `json:"framework_id"`
+	ExecutorID  string `json:"executor_id"`
+	ContainerID string `json:"container_id"`
+	URL         string `json:"url"`
+}
+
+// StatusError is returned if dcos-log responds with an error, the message is the body of the response.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("dcos-log responded with %d %s: %s", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// Client reads the logs of tasks and systemd units of a DC/OS cluster from dcos-log through adminrouter.
+type Client struct {
+	url        *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// New returns a client of the cluster at clusterURL, such as https://master.mesos. token is the authentication
+// token of the user sent in the Authorization header, empty for the clusters without authentication. If httpClient
+// is nil http.DefaultClient is used.
+func New(clusterURL, token string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(clusterURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid cluster URL %q, must be like https://master.mesos", clusterURL)
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{url: u, token: token, httpClient: httpClient}, nil
+}
+
+// get requests the path and query of the cluster with the Accept header, the body of a successful response must be
+// closed by the caller. The redirects of the discovery are followed.
+func (c *Client) get(ctx context.Context, p string, query url.Values, accept string) (*http.Response, error) {
+	return c.getHeader(ctx, p, query, http.Header{"Accept": {accept}})
+}
+
+// getHeader is get with the request headers.
+func (c *Client) getHeader(ctx context.Context, p string, query url.Values, header http.Header) (*http.Response, error) {
+	u := *c.url
+	u.Path = path.Join(c.url.Path, p)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header = header
+	if c.token != "" {
+		req.Header.Set("Authorization", "token="+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// DiscoverTask finds the agent and the last run of the task with taskID, the URL of the task has the query of opts.
+func (c *Client) DiscoverTask(ctx context.Context, taskID string, opts Options) (*Task, error) {
+	file := opts.File
+	if file == "" {
+		file = "stdout"
+	}
+
+	query := opts.query()
+	query.Set("redirect", "false")
+
+	resp, err := c.get(ctx, path.Join(logsPath, "v2/task", taskID, "file", file), query, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	task := &Task{}
+	if err := json.NewDecoder(resp.Body).Decode(task); err != nil {
+		return nil, fmt.Errorf("unable to decode the discovery response: %s", err)
+	}
+	return task, nil
+}
+
+// TailTask writes the log of the task with taskID to w. With opts.Follow it returns once ctx is done or the
+// connection is closed.
+func (c *Client) TailTask(ctx context.Context, taskID string, opts Options, w io.Writer) error {
+	accept, err := opts.accept()
+	if err != nil {
+		return err
+	}
+
+	task, err := c.DiscoverTask(ctx, taskID, opts)
+	if err != nil {
+		return err
+	}
+
+	taskURL, err := url.Parse(task.URL)
+	if err != nil {
+		return fmt.Errorf("invalid task log URL %q: %s", task.URL, err)
+	}
+	return c.copy(ctx, taskURL.Path, taskURL.Query(), accept, w)
+}
+
+// TailUnit writes the journal entries of the systemd unit to w, of the agent opts.Agent or of the master. With
+// opts.Follow it returns once ctx is done or the connection is closed.
+func (c *Client) TailUnit(ctx context.Context, unit string, opts Options, w io.Writer) error {
+	accept, err := opts.accept()
+	if err != nil {
+		return err
+	}
+
+	base := logsPath
+	if opts.Agent != "" {
+		base = fmt.Sprintf(agentLogsPath, opts.Agent)
+	}
+	return c.copy(ctx, path.Join(base, "v2/component", unit), opts.query(), accept, w)
+}
+
+func (c *Client) copy(ctx context.Context, p string, query url.Values, accept string, w io.Writer) error {
+	resp, err := c.get(ctx, p, query, accept)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newCluster(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/v1/logs/v2/task/sleep.1/file/stderr", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "token=secret" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+
+		if req.URL.Query().Get("redirect") != "false" {
+			t.Errorf("expect a discovery without redirect. Got %s", req.URL)
+		}
+
+		json.NewEncoder(w).Encode(Task{
+			AgentID: "a1-S1",
+			URL:     "/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/stderr?" + req.URL.RawQuery,
+		})
+	})
+
+	mux.HandleFunc("/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/stderr", func(w http.ResponseWriter, req *http.Request) {
+		if q := req.URL.Query(); q.Get("skip") != "-2" || q.Get("follow") != "true" {
+			t.Errorf("expect the last 2 lines followed. Got %s", req.URL)
+		}
+		w.Write([]byte("two\nthree\n"))
+	})
+
+	mux.HandleFunc("/system/v1/agent/a1-S1/logs/v2/component/dcos-mesos-slave", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != "application/x-ndjson" {
+			t.Errorf("expect ndjson. Got %s", req.Header.Get("Accept"))
+		}
+		w.Write([]byte(`{"message":"started"}` + "\n"))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestTailTask(t *testing.T) {
+	cluster := newCluster(t)
+	defer cluster.Close()
+
+	c, err := New(cluster.URL, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	opts := Options{Follow: true, Lines: 2, File: "stderr"}
+	if err := c.TailTask(context.Background(), "sleep.1", opts, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "two\nthree\n" {
+		t.Fatalf("expect the last 2 lines. Got %q", buf.String())
+	}
+
+	c, _ = New(cluster.URL, "", nil)
+	err = c.TailTask(context.Background(), "sleep.1", opts, buf)
+	if e, ok := err.(*StatusError); !ok || e.Code != http.StatusUnauthorized || e.Message != "missing token" {
+		t.Fatalf("expect 401. Got %v", err)
+	}
+}
+
+func TestTailUnit(t *testing.T) {
+	cluster := newCluster(t)
+	defer cluster.Close()
+
+	c, err := New(cluster.URL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := c.TailUnit(context.Background(), "dcos-mesos-slave", Options{Agent: "a1-S1", Format: "ndjson"}, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != `{"message":"started"}`+"\n" {
+		t.Fatalf("unexpected log %q", buf.String())
+	}
+
+	if err := c.TailUnit(context.Background(), "dcos-mesos-slave", Options{Format: "xml"}, buf); err != ErrUnknownFormat {
+		t.Fatalf("expect ErrUnknownFormat. Got %v", err)
+	}
+
+	if _, err := New("master.mesos", "", nil); err == nil {
+		t.Fatal("expect an invalid cluster URL error")
+	}
+}
+
+func TestRangeJournal(t *testing.T) {
+	cluster := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/system/v1/logs/v2/component/dcos-marathon" || req.URL.RawQuery != "filter=PRIORITY%3A3&limit=2&skip=-2" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		w.Write([]byte(`{"fields":{"MESSAGE":"one"},"cursor":"c1"}` + "\n" + `{"fields":{"MESSAGE":"two"},"cursor":"c2"}` + "\n"))
+	}))
+	defer cluster.Close()
+
+	c, _ := New(cluster.URL, "", nil)
+	entries, err := c.RangeJournal(context.Background(), JournalQuery{Unit: "dcos-marathon", Filters: []string{"PRIORITY:3"}, Skip: -2, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[1].Fields["MESSAGE"] != "two" || entries[1].Cursor != "c2" {
+		t.Fatalf("expect 2 entries. Got %+v", entries)
+	}
+}
+
+func TestStreamJournal(t *testing.T) {
+	cluster := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Last-Event-ID") != "c1" || req.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("expect an event stream after c1. Got %v", req.Header)
+		}
+		w.Write([]byte(": ping\n\nid: c2\ndata: {\"fields\":{\"MESSAGE\":\"two\"}}\n\nid: c3\ndata: {\"fields\":{\"MESSAGE\":\"three\"}}\n\n"))
+	}))
+	defer cluster.Close()
+
+	c, _ := New(cluster.URL, "", nil)
+	var cursors []string
+	err := c.StreamJournal(context.Background(), JournalQuery{LastEventID: "c1"}, func(e JournalEntry) error {
+		cursors = append(cursors, e.Cursor+"="+e.Fields["MESSAGE"])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cursors) != 2 || cursors[0] != "c2=two" || cursors[1] != "c3=three" {
+		t.Fatalf("expect 2 entries with the event ids as cursors. Got %v", cursors)
+	}
+}
+
+func TestTaskLogs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/v1/logs/v2/task/sleep.1/file/stdout", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/stdout?"+req.URL.RawQuery, http.StatusSeeOther)
+	})
+	mux.HandleFunc("/system/v1/logs/v2/task/sleep.1/browse", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/files/browse", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/stdout", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "token=secret" || req.URL.Query().Get("cursor") != "10" {
+			t.Errorf("expect the token and the cursor after the redirect. Got %v %s", req.Header, req.URL)
+		}
+		w.Write([]byte(`{"fields":{"MESSAGE":"one"},"cursor":"14"}` + "\n"))
+	})
+	mux.HandleFunc("/system/v1/agent/a1-S1/logs/v2/task/frameworks/f1/executors/e1/runs/c1/files/browse", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[{"path":"/var/lib/mesos/slave/stdout","name":"stdout","size":14,"mtime":1513020278}]`))
+	})
+	cluster := httptest.NewServer(mux)
+	defer cluster.Close()
+
+	c, _ := New(cluster.URL, "secret", nil)
+	var lines []TaskLine
+	err := c.TaskLogs(context.Background(), "sleep.1", TaskQuery{Cursor: "10"}, func(l TaskLine) error {
+		lines = append(lines, l)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) != 1 || lines[0].Fields["MESSAGE"] != "one" || lines[0].Cursor != "14" {
+		t.Fatalf("expect a line. Got %+v", lines)
+	}
+
+	files, err := c.BrowseSandbox(context.Background(), "sleep.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name != "stdout" || files[0].Size != 14 {
+		t.Fatalf("expect stdout. Got %+v", files)
+	}
+}
@@ -0,0 +1,70 @@
+// Command dcos-log-tail writes the logs of a task or a systemd unit of a DC/OS cluster to the terminal.
+//
+//	dcos-log-tail -url https://master.mesos -lines 20 -follow sleep.1b4c7e4a
+//	dcos-log-tail -url https://master.mesos -agent a1-S1 -unit dcos-mesos-slave
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dcos/dcos-log/dcos-log/client"
+)
+
+func main() {
+	var (
+		clusterURL = flag.String("url", os.Getenv("DCOS_URL"), "URL of the cluster, $DCOS_URL by default.")
+		token      = flag.String("token", os.Getenv("DCOS_AUTH_TOKEN"), "Authentication token, $DCOS_AUTH_TOKEN by default.")
+		insecure   = flag.Bool("insecure", false, "Do not verify the TLS certificate of the cluster.")
+		unit       = flag.Bool("unit", false, "Read the journal of the systemd unit instead of a task log.")
+		agent      = flag.String("agent", "", "ID of the agent the unit logs are read from, the master by default.")
+		file       = flag.String("file", "stdout", "Sandbox file of the task log.")
+		follow     = flag.Bool("follow", false, "Keep writing the new lines as they are written.")
+		lines      = flag.Int("lines", 0, "Number of last lines to write, 0 writes the whole log.")
+		format     = flag.String("format", "text", "Format of the log: text, json or ndjson.")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <task-id | unit>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	httpClient := http.DefaultClient
+	if *insecure {
+		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+
+	c, err := client.New(*clusterURL, *token, httpClient)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Ctrl-C stops following the log.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	opts := client.Options{Follow: *follow, Lines: *lines, Format: *format, File: *file, Agent: *agent}
+	if *unit {
+		err = c.TailUnit(ctx, flag.Arg(0), opts, os.Stdout)
+	} else {
+		err = c.TailTask(ctx, flag.Arg(0), opts, os.Stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
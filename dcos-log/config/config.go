@@ -4,16 +4,66 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/xeipuuv/gojsonschema"
 )
 
 const (
-	dcosLog                  = "dcos-log"
-	defaultHTTPPort          = 8080
-	defaultGETRequestTimeout = "5s"
+	dcosLog                   = "dcos-log"
+	defaultHTTPPort           = 8080
+	defaultGETRequestTimeout  = "5s"
+	defaultArchiveInterval    = "5m"
+	defaultArchiveRetention   = "720h"
+	defaultArchiveFiles       = "stdout,stderr"
+	defaultDockerSocket       = "/var/run/docker.sock"
+	defaultForwardStateDir    = "/var/lib/dcos/dcos-log"
+	defaultSplunkMaxRetries   = 5
+	defaultSplunkSourcetype   = "journald"
+	defaultBinaryWindow       = 1 << 16
+	defaultMaxEntrySize       = 1 << 20
+	defaultFanoutAgentPort    = 61001
+	defaultMergeDelay         = "2s"
+	defaultSandboxHeartbeat   = "15s"
+	defaultRateLimitBurst     = 20
+	defaultMaxStreamDuration  = "0"
+	defaultListenUnixMode     = "0660"
+	defaultJWKSURL            = "https://leader.mesos/acs/api/v1/auth/jwks"
+	defaultFilesAPIRetries    = 2
+	defaultFilesAPIRetryDelay = "100ms"
+	defaultFilesAPIChunkSize  = 1 << 16
+	defaultFilesAPIMaxLine    = 1 << 20
+	defaultKafkaTopic         = "dcos-logs"
+	defaultKafkaEncoding      = "json"
+	defaultFluentdTag         = "dcos"
+	defaultElasticIndex       = "dcos-logs"
+	defaultSyslogTransport    = "tcp"
+	defaultOTLPProtocol       = "http/json"
+	defaultTraceSampleRatio   = 1.0
+	defaultDrainTimeout       = "10s"
+	defaultRangeTimeout       = "60s"
+	defaultStreamBackpressure = "block"
+	defaultStreamQueueSize    = 1024
+	defaultStreamCheckpoint   = "30s"
+	defaultJournalHeartbeat   = "15s"
+	defaultTaskCacheTTL       = "10s"
+	defaultEnrichTasksTTL     = "30s"
+	defaultMesosWorkDir       = "/var/lib/mesos/slave"
+	defaultFollowMaxInterval  = "5s"
+	defaultMaxLimit           = 100000
+	defaultMaxRangeBytes      = 100 << 20
+	defaultBreakerFailures    = 5
+	defaultBreakerCooldown    = "30s"
+	defaultMaxIdleConns       = 64
+	defaultMaxScanBytes       = 100 << 20
+	defaultAuditIdentifier    = "dcos-log-audit"
+	defaultExportJobsMax      = 8
+	defaultExportJobsRetain   = "1h"
+	defaultExportJobsRate     = 8 << 20
 )
 
 var internalJSONValidationSchema = `
@@ -44,6 +94,386 @@ var internalJSONValidationSchema = `
 	    "role": {
 	      "type": "string",
 	      "enum": ["master", "agent", "agent_public"]
+	    },
+	    "archive-url": {
+	      "type": "string"
+	    },
+	    "archive": {
+	      "type": "boolean"
+	    },
+	    "archive-interval": {
+	      "type": "string"
+	    },
+	    "archive-retention": {
+	      "type": "string"
+	    },
+	    "archive-files": {
+	      "type": "string"
+	    },
+	    "iam-config": {
+	      "type": "string"
+	    },
+	    "syslog-udp": {
+	      "type": "string"
+	    },
+	    "syslog-tcp": {
+	      "type": "string"
+	    },
+	    "journal-remote": {
+	      "type": "string"
+	    },
+	    "journal-remote-cert": {
+	      "type": "string"
+	    },
+	    "journal-remote-key": {
+	      "type": "string"
+	    },
+	    "journal-remote-client-ca": {
+	      "type": "string"
+	    },
+	    "docker-socket": {
+	      "type": "string"
+	    },
+	    "loki-url": {
+	      "type": "string"
+	    },
+	    "loki-tenant": {
+	      "type": "string"
+	    },
+	    "loki-labels": {
+	      "type": "string"
+	    },
+	    "forward-state-dir": {
+	      "type": "string"
+	    },
+	    "splunk-url": {
+	      "type": "string"
+	    },
+	    "splunk-token": {
+	      "type": "string"
+	    },
+	    "splunk-index": {
+	      "type": "string"
+	    },
+	    "splunk-index-field": {
+	      "type": "string"
+	    },
+	    "splunk-sourcetype": {
+	      "type": "string"
+	    },
+	    "splunk-sourcetype-field": {
+	      "type": "string"
+	    },
+	    "splunk-max-retries": {
+	      "type": "integer"
+	    },
+	    "export-url": {
+	      "type": "string"
+	    },
+	    "export-jobs-dir": {
+	      "type": "string"
+	    },
+	    "export-jobs-max": {
+	      "type": "integer",
+	      "minimum": 1
+	    },
+	    "export-jobs-retention": {
+	      "type": "string"
+	    },
+	    "export-jobs-rate-limit": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "siem-field-mapping": {
+	      "type": "string"
+	    },
+	    "redaction-policy": {
+	      "type": "string"
+	    },
+	    "strip-ansi": {
+	      "type": "boolean"
+	    },
+	    "normalize": {
+	      "type": "boolean"
+	    },
+	    "coalesce": {
+	      "type": "boolean"
+	    },
+	    "escape-control": {
+	      "type": "boolean"
+	    },
+	    "json-fields": {
+	      "type": "boolean"
+	    },
+	    "binary-window": {
+	      "type": "integer"
+	    },
+	    "max-entry-size": {
+	      "type": "integer"
+	    },
+	    "transcode": {
+	      "type": "boolean"
+	    },
+	    "stable-cursors": {
+	      "type": "boolean"
+	    },
+	    "fanout-agent-port": {
+	      "type": "integer",
+	      "minimum": 1,
+	      "maximum": 65535
+	    },
+	    "merge-delay": {
+	      "type": "string"
+	    },
+	    "sandbox-heartbeat": {
+	      "type": "string"
+	    },
+	    "sandbox-heartbeat-payload": {
+	      "type": "string"
+	    },
+	    "access-log": {
+	      "type": "boolean"
+	    },
+	    "rate-limit": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "rate-limit-burst": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "max-streams": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "max-stream-duration": {
+	      "type": "string"
+	    },
+	    "max-bytes-per-hour": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "jwt-verify": {
+	      "type": "boolean"
+	    },
+	    "jwks-url": {
+	      "type": "string"
+	    },
+	    "task-policy": {
+	      "type": "string"
+	    },
+	    "client-cert": {
+	      "type": "string"
+	    },
+	    "client-key": {
+	      "type": "string"
+	    },
+	    "tls-server-name": {
+	      "type": "string"
+	    },
+	    "files-api-retries": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "files-api-retry-delay": {
+	      "type": "string"
+	    },
+	    "files-api-chunk-size": {
+	      "type": "integer",
+	      "minimum": 1
+	    },
+	    "files-api-read-ahead": {
+	      "type": "boolean"
+	    },
+	    "files-api-max-line-size": {
+	      "type": "integer",
+	      "minimum": 4
+	    },
+	    "files-api-rotations": {
+	      "type": "boolean"
+	    },
+	    "files-api-truncate-lines": {
+	      "type": "boolean"
+	    },
+	    "journal-dirs": {
+	      "type": "string"
+	    },
+	    "kafka-brokers": {
+	      "type": "string"
+	    },
+	    "kafka-topic": {
+	      "type": "string",
+	      "minLength": 1
+	    },
+	    "kafka-encoding": {
+	      "type": "string",
+	      "enum": ["json", "avro"]
+	    },
+	    "kafka-matches": {
+	      "type": "string"
+	    },
+	    "kafka-sandbox-files": {
+	      "type": "string"
+	    },
+	    "fluentd-addr": {
+	      "type": "string"
+	    },
+	    "fluentd-tag": {
+	      "type": "string",
+	      "minLength": 1
+	    },
+	    "fluentd-matches": {
+	      "type": "string"
+	    },
+	    "elastic-url": {
+	      "type": "string"
+	    },
+	    "elastic-index": {
+	      "type": "string",
+	      "minLength": 1
+	    },
+	    "elastic-matches": {
+	      "type": "string"
+	    },
+	    "otlp-url": {
+	      "type": "string"
+	    },
+	    "otlp-attributes": {
+	      "type": "string"
+	    },
+	    "otlp-headers": {
+	      "type": "string"
+	    },
+	    "otlp-protocol": {
+	      "type": "string",
+	      "enum": ["http/json", "grpc"]
+	    },
+	    "otlp-matches": {
+	      "type": "string"
+	    },
+	    "syslog-forward-addr": {
+	      "type": "string"
+	    },
+	    "syslog-forward-transport": {
+	      "type": "string",
+	      "enum": ["udp", "tcp", "tls"]
+	    },
+	    "syslog-forward-query": {
+	      "type": "string"
+	    },
+	    "trace-otlp-url": {
+	      "type": "string"
+	    },
+	    "trace-sample-ratio": {
+	      "type": "number",
+	      "minimum": 0,
+	      "maximum": 1
+	    },
+	    "listen": {
+	      "type": "string"
+	    },
+	    "listen-unix": {
+	      "type": "string"
+	    },
+	    "listen-unix-mode": {
+	      "type": "string"
+	    },
+	    "grpc": {
+	      "type": "boolean"
+	    },
+	    "default-format": {
+	      "type": "string",
+	      "enum": ["", "text", "json", "cef", "leef", "elastic", "logfmt", "gelf", "ndjson", "csv"]
+	    },
+	    "drain-timeout": {
+	      "type": "string"
+	    },
+	    "range-timeout": {
+	      "type": "string"
+	    },
+	    "stream-backpressure": {
+	      "type": "string",
+	      "enum": ["block", "drop-oldest", "disconnect"]
+	    },
+	    "stream-queue-size": {
+	      "type": "integer",
+	      "minimum": 1
+	    },
+	    "stream-checkpoint-interval": {
+	      "type": "string"
+	    },
+	    "journal-heartbeat": {
+	      "type": "string"
+	    },
+	    "enrich-tasks": {
+	      "type": "boolean"
+	    },
+	    "enrich-tasks-ttl": {
+	      "type": "string"
+	    },
+	    "task-cache-ttl": {
+	      "type": "string"
+	    },
+	    "discovery-proxy": {
+	      "type": "boolean"
+	    },
+	    "files-api-operator": {
+	      "type": "boolean"
+	    },
+	    "mesos-work-dir": {
+	      "type": "string"
+	    },
+	    "follow-max-interval": {
+	      "type": "string"
+	    },
+	    "max-limit": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "max-range-bytes": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "files-api-breaker-failures": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "files-api-breaker-cooldown": {
+	      "type": "string"
+	    },
+	    "files-api-max-idle-conns": {
+	      "type": "integer",
+	      "minimum": 1
+	    },
+	    "files-api-chunk-cache": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "max-scan-bytes": {
+	      "type": "integer",
+	      "minimum": 0
+	    },
+	    "audit-log": {
+	      "type": "string"
+	    },
+	    "audit-identifier": {
+	      "type": "string",
+	      "minLength": 1
+	    },
+	    "admin-uids": {
+	      "type": "string"
+	    },
+	    "debug-endpoints": {
+	      "type": "boolean"
+	    },
+	    "multiline-start": {
+	      "type": "string"
+	    },
+	    "multiline-continuation": {
+	      "type": "string"
+	    },
+	    "files-api-service-account": {
+	      "type": "boolean"
 	    }
 	  },
 	  "required": ["role"],
@@ -61,6 +491,9 @@ type Config struct {
 	// FlagConfig is a path to a config file.
 	FlagConfig string `json:"-"`
 
+	// FlagPrintConfig prints the effective config and exits.
+	FlagPrintConfig bool `json:"-"`
+
 	// FlagUseAuth enables authorization.
 	FlagAuth bool `json:"auth"`
 
@@ -72,21 +505,517 @@ type Config struct {
 
 	// FlagRole sets a node's role
 	FlagRole string `json:"role"`
+
+	// FlagArchiveURL is an object storage URL used to fetch archived logs of tasks with garbage collected sandboxes.
+	FlagArchiveURL string `json:"archive-url"`
+
+	// FlagArchive enables the archiver which uploads the files of terminated tasks to FlagArchiveURL.
+	FlagArchive bool `json:"archive"`
+
+	// FlagArchiveInterval sets how often the archiver checks for terminated tasks.
+	FlagArchiveInterval string `json:"archive-interval"`
+
+	// FlagArchiveRetention sets how long the archived files are kept, 0 keeps the files forever.
+	FlagArchiveRetention string `json:"archive-retention"`
+
+	// FlagArchiveFiles is a comma separated list of sandbox files to archive.
+	FlagArchiveFiles string `json:"archive-files"`
+
+	// FlagIAMConfig is a path to the service account IAM config used by background workers.
+	FlagIAMConfig string `json:"iam-config"`
+
+	// FlagSyslogUDP is an address to receive syslog messages over UDP, empty disables the listener.
+	FlagSyslogUDP string `json:"syslog-udp"`
+
+	// FlagSyslogTCP is an address to receive syslog messages over TCP, empty disables the listener.
+	FlagSyslogTCP string `json:"syslog-tcp"`
+
+	// FlagJournalRemote is an address to receive systemd-journal-upload entries, empty disables the listener.
+	FlagJournalRemote string `json:"journal-remote"`
+
+	// FlagJournalRemoteCertFile and FlagJournalRemoteKeyFile are a PEM certificate and key served by the journal
+	// remote listener.
+	FlagJournalRemoteCertFile string `json:"journal-remote-cert"`
+	FlagJournalRemoteKeyFile  string `json:"journal-remote-key"`
+
+	// FlagJournalRemoteClientCAFile is a PEM CA bundle, the journal remote listener only accepts uploads with a
+	// client certificate signed by it.
+	FlagJournalRemoteClientCAFile string `json:"journal-remote-client-ca"`
+
+	// FlagDockerSocket is a docker daemon unix socket used to locate json-file container logs.
+	FlagDockerSocket string `json:"docker-socket"`
+
+	// FlagLokiURL is a Loki push API URL, if set the journal entries are forwarded to Loki.
+	FlagLokiURL string `json:"loki-url"`
+
+	// FlagLokiTenant is a Loki tenant ID sent in X-Scope-OrgID header.
+	FlagLokiTenant string `json:"loki-tenant"`
+
+	// FlagLokiLabels is a comma separated list of key=value labels added to every Loki stream.
+	FlagLokiLabels string `json:"loki-labels"`
+
+	// FlagForwardStateDir is a directory to store the cursors of forwarded journal entries.
+	FlagForwardStateDir string `json:"forward-state-dir"`
+
+	// FlagSplunkURL is a Splunk HTTP Event Collector event endpoint, if set the journal entries are forwarded to Splunk.
+	FlagSplunkURL string `json:"splunk-url"`
+
+	// FlagSplunkToken is a HEC token.
+	FlagSplunkToken string `json:"splunk-token"`
+
+	// FlagSplunkIndex is a default Splunk index, FlagSplunkIndexField is a journal field which overrides it.
+	FlagSplunkIndex      string `json:"splunk-index"`
+	FlagSplunkIndexField string `json:"splunk-index-field"`
+
+	// FlagSplunkSourcetype is a default Splunk sourcetype, FlagSplunkSourcetypeField is a journal field which overrides it.
+	FlagSplunkSourcetype      string `json:"splunk-sourcetype"`
+	FlagSplunkSourcetypeField string `json:"splunk-sourcetype-field"`
+
+	// FlagSplunkMaxRetries is a number of retries before a batch is moved to the dead letter dir, 0 retries forever.
+	FlagSplunkMaxRetries int `json:"splunk-max-retries"`
+
+	// FlagExportURL is an S3 bucket URL used to export journal ranges, empty disables the export.
+	FlagExportURL string `json:"export-url"`
+
+	// FlagExportJobsDir is the directory of the export job archives, dcos-log-exports in the temp dir if empty.
+	FlagExportJobsDir string `json:"export-jobs-dir"`
+
+	// FlagExportJobsMax is the number of queued and running export jobs.
+	FlagExportJobsMax int `json:"export-jobs-max"`
+
+	// FlagExportJobsRetention is how long the finished export jobs and their archives are kept.
+	FlagExportJobsRetention string `json:"export-jobs-retention"`
+
+	// FlagExportJobsRateLimit is the bytes per second an export job reads from the journal and the files API, 0 is
+	// unlimited.
+	FlagExportJobsRateLimit int `json:"export-jobs-rate-limit"`
+
+	// FlagSIEMFieldMapping is a comma separated list of FIELD=key pairs mapping journal fields to CEF extension
+	// keys and LEEF attributes.
+	FlagSIEMFieldMapping string `json:"siem-field-mapping"`
+
+	// FlagRedactionPolicy is a path to a JSON file with the journal fields hidden per role.
+	FlagRedactionPolicy string `json:"redaction-policy"`
+
+	// FlagStripANSI removes ANSI escape sequences from journal and sandbox log messages.
+	FlagStripANSI bool `json:"strip-ansi"`
+
+	// FlagNormalize converts CRLF to LF and removes control characters from text log messages.
+	FlagNormalize bool `json:"normalize"`
+
+	// FlagEscapeControl replaces ANSI escape sequences and control characters of log messages with their escapes.
+	FlagEscapeControl bool `json:"escape-control"`
+
+	// FlagJSONFields promotes the keys of task log lines which are JSON objects to fields of JSON based formats.
+	FlagJSONFields bool `json:"json-fields"`
+
+	// FlagCoalesce collapses the runs of identical consecutive journal entries and sandbox lines.
+	FlagCoalesce bool `json:"coalesce"`
+
+	// FlagBinaryWindow is a number of bytes of a sandbox file which must contain a new line, otherwise the file is
+	// considered binary and cannot be read line by line. 0 disables the check.
+	FlagBinaryWindow int `json:"binary-window"`
+
+	// FlagMaxEntrySize is a maximum size of a journal entry sent to a client, the largest fields of bigger
+	// entries are truncated. 0 disables the truncation.
+	FlagMaxEntrySize int `json:"max-entry-size"`
+
+	// FlagTranscode detects Latin-1 and UTF-16 sandbox files and transcodes them to UTF-8.
+	FlagTranscode bool `json:"transcode"`
+
+	// FlagStableCursors makes task log endpoints return rotation stable cursors as SSE ids instead of file offsets.
+	FlagStableCursors bool `json:"stable-cursors"`
+
+	// FlagFanoutAgentPort is a port of agent admin router used by masters to read the logs of every agent.
+	FlagFanoutAgentPort int `json:"fanout-agent-port"`
+
+	// FlagMergeDelay is the longest time an entry of a merged stream waits for the entries of the other sources
+	// to be ordered by time, 0 sends the entries in the order they arrive.
+	FlagMergeDelay string `json:"merge-delay"`
+
+	// FlagSandboxHeartbeat is an interval of heartbeat events sent on quiet task log SSE streams, 0 disables them.
+	FlagSandboxHeartbeat string `json:"sandbox-heartbeat"`
+
+	// FlagSandboxHeartbeatPayload is sent as data of heartbeat events, if empty an SSE comment is sent instead.
+	FlagSandboxHeartbeatPayload string `json:"sandbox-heartbeat-payload"`
+
+	// FlagAccessLog prints a JSON access log entry per request to stdout.
+	FlagAccessLog bool `json:"access-log"`
+
+	// FlagRateLimit is a number of requests per second a client may send to range endpoints, 0 disables the limit.
+	// A client is the uid of the JWT or the remote IP address.
+	FlagRateLimit int `json:"rate-limit"`
+
+	// FlagRateLimitBurst is a number of requests a client may send at once above FlagRateLimit.
+	FlagRateLimitBurst int `json:"rate-limit-burst"`
+
+	// FlagMaxStreams is a number of streams a client may keep open, 0 disables the limit.
+	FlagMaxStreams int `json:"max-streams"`
+
+	// FlagMaxStreamDuration is the longest a stream of a client stays open, 0 disables the limit.
+	FlagMaxStreamDuration string `json:"max-stream-duration"`
+
+	// FlagMaxBytesPerHour is a number of response bytes a client may receive per hour, 0 disables the limit.
+	FlagMaxBytesPerHour int `json:"max-bytes-per-hour"`
+
+	// FlagJWTVerify makes v2 endpoints verify the signature, expiry and uid claim of the JWT in the Authorization
+	// header, instead of relying on adminrouter. Open clusters without IAM must leave it disabled.
+	FlagJWTVerify bool `json:"jwt-verify"`
+
+	// FlagJWKSURL is a URL of DC/OS IAM public keys used to verify JWTs.
+	FlagJWKSURL string `json:"jwks-url"`
+
+	// FlagTaskPolicy is a path to a JSON file with the frameworks each user may read the task logs of.
+	FlagTaskPolicy string `json:"task-policy"`
+
+	// FlagClientCertFile and FlagClientKeyFile are a PEM client certificate and key presented to Mesos masters and
+	// agents which require client certificates.
+	FlagClientCertFile string `json:"client-cert"`
+	FlagClientKeyFile  string `json:"client-key"`
+
+	// FlagTLSServerName is a name Mesos server certificates are verified against instead of the host of the URL.
+	FlagTLSServerName string `json:"tls-server-name"`
+
+	// FlagFilesAPIRetries is a number of times a files API read is retried after a connection error or 5xx response.
+	FlagFilesAPIRetries int `json:"files-api-retries"`
+
+	// FlagFilesAPIRetryDelay is a delay before the first retry, it doubles with every retry.
+	FlagFilesAPIRetryDelay string `json:"files-api-retry-delay"`
+
+	// FlagFilesAPIChunkSize is a number of bytes of a task log requested from the files API at once.
+	FlagFilesAPIChunkSize int `json:"files-api-chunk-size"`
+
+	// FlagFilesAPIReadAhead requests the next chunk of a task log while the current one is sent to a client.
+	FlagFilesAPIReadAhead bool `json:"files-api-read-ahead"`
+
+	// FlagFilesAPIMaxLineSize is the longest task log line in bytes kept in memory, longer lines are split.
+	FlagFilesAPIMaxLineSize int `json:"files-api-max-line-size"`
+
+	// FlagFilesAPIRotations includes the rotated task log files when the requested lines span the log rotation.
+	FlagFilesAPIRotations bool `json:"files-api-rotations"`
+
+	// FlagFilesAPITruncateLines truncates the task log lines longer than FlagFilesAPIMaxLineSize instead of
+	// splitting them.
+	FlagFilesAPITruncateLines bool `json:"files-api-truncate-lines"`
+
+	// FlagJournalDirs is a comma separated list of journal directories read instead of the local journal, the
+	// entries of several directories are merged.
+	FlagJournalDirs string `json:"journal-dirs"`
+
+	// FlagKafkaBrokers is a comma separated list of Kafka brokers, the journal entries are produced to Kafka if set.
+	FlagKafkaBrokers string `json:"kafka-brokers"`
+
+	// FlagKafkaTopic is the topic template, {unit}, {framework} and {host} are replaced with the entry fields.
+	FlagKafkaTopic string `json:"kafka-topic"`
+
+	// FlagKafkaEncoding is the encoding of Kafka records, json or avro.
+	FlagKafkaEncoding string `json:"kafka-encoding"`
+
+	// FlagKafkaMatches is a comma separated list of FIELD=value journal matches of the entries produced to Kafka.
+	FlagKafkaMatches string `json:"kafka-matches"`
+
+	// FlagKafkaSandboxFiles is a comma separated list of sandbox files of the running tasks produced to Kafka, such
+	// as stdout,stderr. Empty list disables the sandbox source.
+	FlagKafkaSandboxFiles string `json:"kafka-sandbox-files"`
+
+	// FlagFluentdAddr is host:port of a fluentd forward input, the journal entries are sent to fluentd if set.
+	FlagFluentdAddr string `json:"fluentd-addr"`
+
+	// FlagFluentdTag is the tag prefix of the events sent to fluentd.
+	FlagFluentdTag string `json:"fluentd-tag"`
+
+	// FlagFluentdMatches is a comma separated list of FIELD=value journal matches of the entries sent to fluentd.
+	FlagFluentdMatches string `json:"fluentd-matches"`
+
+	// FlagElasticURL is an Elasticsearch URL, if set the journal entries are indexed to Elasticsearch.
+	FlagElasticURL string `json:"elastic-url"`
+
+	// FlagElasticIndex is the prefix of the daily Elasticsearch indices.
+	FlagElasticIndex string `json:"elastic-index"`
+
+	// FlagElasticMatches is a comma separated list of FIELD=value journal matches of the entries indexed to
+	// Elasticsearch.
+	FlagElasticMatches string `json:"elastic-matches"`
+
+	// FlagOTLPURL is the OTLP/HTTP logs endpoint or the OTLP/gRPC endpoint of an OpenTelemetry collector, if set the
+	// journal entries are exported to the collector.
+	FlagOTLPURL string `json:"otlp-url"`
+
+	// FlagOTLPAttributes is a comma separated list of key=value resource attributes added to every log record.
+	FlagOTLPAttributes string `json:"otlp-attributes"`
+
+	// FlagOTLPHeaders is a comma separated list of key=value headers of the export requests.
+	FlagOTLPHeaders string `json:"otlp-headers"`
+
+	// FlagOTLPProtocol is the protocol of the export requests, http/json or grpc.
+	FlagOTLPProtocol string `json:"otlp-protocol"`
+
+	// FlagOTLPMatches is a comma separated list of FIELD=value journal matches of the entries exported to the
+	// collector.
+	FlagOTLPMatches string `json:"otlp-matches"`
+
+	// FlagSyslogForwardAddr is host:port of a remote syslog collector, the journal entries are sent to the
+	// collector if set.
+	FlagSyslogForwardAddr string `json:"syslog-forward-addr"`
+
+	// FlagSyslogForwardTransport is the transport of the syslog messages, udp, tcp or tls.
+	FlagSyslogForwardTransport string `json:"syslog-forward-transport"`
+
+	// FlagSyslogForwardQuery is a query in the ?q= language selecting the entries sent to the syslog collector.
+	FlagSyslogForwardQuery string `json:"syslog-forward-query"`
+
+	// FlagTraceOTLPURL is an OTLP/HTTP traces endpoint, if set the spans of sampled traces are exported to it.
+	FlagTraceOTLPURL string `json:"trace-otlp-url"`
+
+	// FlagTraceSampleRatio is the ratio of the traces started by dcos-log which are sampled.
+	FlagTraceSampleRatio float64 `json:"trace-sample-ratio"`
+
+	// FlagListen is the address the service listens on, it overrides port.
+	FlagListen string `json:"listen"`
+
+	// FlagListenUnix is the path of a unix socket the service also listens on.
+	FlagListenUnix string `json:"listen-unix"`
+
+	// FlagListenUnixMode is the octal file mode of the FlagListenUnix socket.
+	FlagListenUnixMode string `json:"listen-unix-mode"`
+
+	// FlagGRPC serves the gRPC Logs service on the listeners, with HTTP/2 without TLS next to HTTP/1.1.
+	FlagGRPC bool `json:"grpc"`
+
+	// FlagDefaultFormat is the format of the component endpoints if the request has no ?format= parameter and
+	// accepts any content type.
+	FlagDefaultFormat string `json:"default-format"`
+
+	// FlagDrainTimeout is the time the open streams, the forwarders and the exporters are given to finish on
+	// shutdown.
+	FlagDrainTimeout string `json:"drain-timeout"`
+
+	// FlagRangeTimeout is the deadline of range requests to the journal and the task logs, 0 disables it.
+	FlagRangeTimeout string `json:"range-timeout"`
+
+	// FlagStreamBackpressure is the policy of a stream whose queue is full: block, drop-oldest or disconnect.
+	FlagStreamBackpressure string `json:"stream-backpressure"`
+
+	// FlagStreamQueueSize is the number of events queued for a server sent events client.
+	FlagStreamQueueSize int `json:"stream-queue-size"`
+
+	// FlagStreamCheckpointInterval is the interval of the checkpoint events of the streams with ?integrity=true, 0
+	// disables them.
+	FlagStreamCheckpointInterval string `json:"stream-checkpoint-interval"`
+
+	// FlagJournalHeartbeat is the interval of the ping comments sent on idle journal streams, 0 disables them.
+	FlagJournalHeartbeat string `json:"journal-heartbeat"`
+
+	// FlagTaskCacheTTL is how long the canonical IDs of the tasks found by the discovery are cached, 0 disables
+	// the cache.
+	FlagTaskCacheTTL string `json:"task-cache-ttl"`
+
+	// FlagEnrichTasks adds the agent ID, the framework name and the task name to the journal entries of the Mesos
+	// containers on agents.
+	FlagEnrichTasks bool `json:"enrich-tasks"`
+
+	// FlagEnrichTasksTTL is how long the agent state read by the enrichment is cached.
+	FlagEnrichTasksTTL string `json:"enrich-tasks-ttl"`
+
+	// FlagDiscoveryProxy makes the discovery endpoints proxy the task logs from the agents instead of redirecting
+	// the clients, which may not reach the agents.
+	FlagDiscoveryProxy bool `json:"discovery-proxy"`
+
+	// FlagFilesAPIOperator reads the task logs with the mesos v1 operator API instead of the legacy files API.
+	FlagFilesAPIOperator bool `json:"files-api-operator"`
+
+	// FlagMesosWorkDir is mesos agent --work_dir, the sandboxes are in its slaves directory.
+	FlagMesosWorkDir string `json:"mesos-work-dir"`
+
+	// FlagFollowMaxInterval is the longest interval an idle followed task log is polled at, the interval doubles
+	// while the file does not grow. 0 disables the backoff.
+	FlagFollowMaxInterval string `json:"follow-max-interval"`
+
+	// FlagMaxLimit is the largest limit parameter of a request, 0 is no maximum.
+	FlagMaxLimit int `json:"max-limit"`
+
+	// FlagMaxRangeBytes is the largest byte range of a Range request, 0 is no maximum.
+	FlagMaxRangeBytes int `json:"max-range-bytes"`
+
+	// FlagFilesAPIBreakerFailures is the number of consecutive failed files API reads of an agent which make the
+	// reads of the agent fail fast for FlagFilesAPIBreakerCooldown. 0 disables the circuit breaker.
+	FlagFilesAPIBreakerFailures int    `json:"files-api-breaker-failures"`
+	FlagFilesAPIBreakerCooldown string `json:"files-api-breaker-cooldown"`
+
+	// FlagFilesAPIMaxIdleConns is the number of idle connections kept open to every master and agent.
+	FlagFilesAPIMaxIdleConns int `json:"files-api-max-idle-conns"`
+
+	// FlagFilesAPIChunkCache is the number of task log chunks kept in memory for the repeated reads of the same files.
+	// 0 disables the cache.
+	FlagFilesAPIChunkCache int `json:"files-api-chunk-cache"`
+
+	// FlagMaxScanBytes is the largest number of bytes read from the end of a task log to skip lines backwards, 0 is
+	// no maximum.
+	FlagMaxScanBytes int `json:"max-scan-bytes"`
+
+	// FlagAuditLog records an event per log access, with the uid, remote address, logs read and bytes served. It's
+	// "journald" to write the events to the journal with FlagAuditIdentifier or a path of a file to append them to,
+	// empty disables the audit log.
+	FlagAuditLog        string `json:"audit-log"`
+	FlagAuditIdentifier string `json:"audit-identifier"`
+
+	// FlagAdminUIDs is a comma separated list of uids of the users which may use the /admin endpoints, empty
+	// disables them.
+	FlagAdminUIDs string `json:"admin-uids"`
+
+	// FlagDebugEndpoints exposes the pprof profiles and expvar variables under /debug to the users of FlagAdminUIDs.
+	FlagDebugEndpoints bool `json:"debug-endpoints"`
+
+	// FlagMultilineStart and FlagMultilineContinuation are the default patterns of the first and the continuation
+	// lines of the records written over several lines to task logs, such as stack traces.
+	FlagMultilineStart        string `json:"multiline-start"`
+	FlagMultilineContinuation string `json:"multiline-continuation"`
+
+	// FlagFilesAPIServiceAccount authorizes the requests of the task log readers to the agent with the service
+	// account of FlagIAMConfig instead of the token of the user, the token is renewed before it expires.
+	FlagFilesAPIServiceAccount bool `json:"files-api-service-account"`
+
+	// args and lookupEnv are the sources of the config, used by Reload.
+	args      []string
+	lookupEnv func(string) (string, bool)
 }
 
 func (c *Config) setFlags(fs *flag.FlagSet) {
 	fs.IntVar(&c.FlagPort, "port", c.FlagPort, "Sets TCP port.")
 	fs.BoolVar(&c.FlagVerbose, "verbose", c.FlagVerbose, "Print out verbose output.")
 	fs.StringVar(&c.FlagConfig, "config", c.FlagConfig, "Use config file.")
+	fs.BoolVar(&c.FlagPrintConfig, "print-config", c.FlagPrintConfig, "Print the effective config and exit.")
 	fs.BoolVar(&c.FlagAuth, "auth", c.FlagAuth, "Enable authorization.")
 	fs.StringVar(&c.FlagCACertFile, "ca-cert", c.FlagCACertFile, "Use certificate authority.")
 	fs.StringVar(&c.FlagGetRequestTimeout, "timeout", c.FlagGetRequestTimeout, "GET request timeout.")
 	fs.StringVar(&c.FlagRole, "role", c.FlagRole, "Set node's role.")
+	fs.StringVar(&c.FlagArchiveURL, "archive-url", c.FlagArchiveURL, "Fetch logs of garbage collected sandboxes from archive.")
+	fs.BoolVar(&c.FlagArchive, "archive", c.FlagArchive, "Archive the files of terminated tasks to archive-url.")
+	fs.StringVar(&c.FlagArchiveInterval, "archive-interval", c.FlagArchiveInterval, "Check for terminated tasks interval.")
+	fs.StringVar(&c.FlagArchiveRetention, "archive-retention", c.FlagArchiveRetention, "Keep archived files for a given duration.")
+	fs.StringVar(&c.FlagArchiveFiles, "archive-files", c.FlagArchiveFiles, "Comma separated list of sandbox files to archive.")
+	fs.StringVar(&c.FlagIAMConfig, "iam-config", c.FlagIAMConfig, "Use IAM config for background requests.")
+	fs.StringVar(&c.FlagSyslogUDP, "syslog-udp", c.FlagSyslogUDP, "Receive syslog messages over UDP on a given address.")
+	fs.StringVar(&c.FlagSyslogTCP, "syslog-tcp", c.FlagSyslogTCP, "Receive syslog messages over TCP on a given address.")
+	fs.StringVar(&c.FlagJournalRemote, "journal-remote", c.FlagJournalRemote, "Receive systemd-journal-upload entries on a given address.")
+	fs.StringVar(&c.FlagJournalRemoteCertFile, "journal-remote-cert", c.FlagJournalRemoteCertFile, "Certificate served by the journal remote listener.")
+	fs.StringVar(&c.FlagJournalRemoteKeyFile, "journal-remote-key", c.FlagJournalRemoteKeyFile, "Key of the journal remote listener certificate.")
+	fs.StringVar(&c.FlagJournalRemoteClientCAFile, "journal-remote-client-ca", c.FlagJournalRemoteClientCAFile, "Accept journal uploads with a client certificate signed by a given CA.")
+	fs.StringVar(&c.FlagDockerSocket, "docker-socket", c.FlagDockerSocket, "Docker daemon unix socket.")
+	fs.StringVar(&c.FlagLokiURL, "loki-url", c.FlagLokiURL, "Forward journal entries to Loki push API URL.")
+	fs.StringVar(&c.FlagLokiTenant, "loki-tenant", c.FlagLokiTenant, "Loki tenant ID.")
+	fs.StringVar(&c.FlagLokiLabels, "loki-labels", c.FlagLokiLabels, "Comma separated key=value labels added to Loki streams.")
+	fs.StringVar(&c.FlagForwardStateDir, "forward-state-dir", c.FlagForwardStateDir, "Store forwarded journal cursors in a given directory.")
+	fs.StringVar(&c.FlagSplunkURL, "splunk-url", c.FlagSplunkURL, "Forward journal entries to Splunk HEC event endpoint.")
+	fs.StringVar(&c.FlagSplunkToken, "splunk-token", c.FlagSplunkToken, "Splunk HEC token.")
+	fs.StringVar(&c.FlagSplunkIndex, "splunk-index", c.FlagSplunkIndex, "Default Splunk index.")
+	fs.StringVar(&c.FlagSplunkIndexField, "splunk-index-field", c.FlagSplunkIndexField, "Journal field used as Splunk index.")
+	fs.StringVar(&c.FlagSplunkSourcetype, "splunk-sourcetype", c.FlagSplunkSourcetype, "Default Splunk sourcetype.")
+	fs.StringVar(&c.FlagSplunkSourcetypeField, "splunk-sourcetype-field", c.FlagSplunkSourcetypeField, "Journal field used as Splunk sourcetype.")
+	fs.IntVar(&c.FlagSplunkMaxRetries, "splunk-max-retries", c.FlagSplunkMaxRetries, "Retry a Splunk batch before moving it to the dead letter dir, 0 retries forever.")
+	fs.StringVar(&c.FlagExportURL, "export-url", c.FlagExportURL, "Export journal ranges to a given S3 bucket URL.")
+	fs.StringVar(&c.FlagExportJobsDir, "export-jobs-dir", c.FlagExportJobsDir, "Directory of the export job archives, dcos-log-exports in the temp dir if empty.")
+	fs.IntVar(&c.FlagExportJobsMax, "export-jobs-max", c.FlagExportJobsMax, "Reject the export jobs with 429 while a given number of jobs is queued or running.")
+	fs.StringVar(&c.FlagExportJobsRetention, "export-jobs-retention", c.FlagExportJobsRetention, "Remove the finished export jobs and their archives after a given duration.")
+	fs.IntVar(&c.FlagExportJobsRateLimit, "export-jobs-rate-limit", c.FlagExportJobsRateLimit, "Bytes per second an export job reads from the journal and the task logs. 0 is unlimited.")
+	fs.StringVar(&c.FlagSIEMFieldMapping, "siem-field-mapping", c.FlagSIEMFieldMapping, "Map journal fields to CEF/LEEF keys, FIELD=key,...")
+	fs.StringVar(&c.FlagRedactionPolicy, "redaction-policy", c.FlagRedactionPolicy, "Hide journal fields per role, a path to a JSON policy.")
+	fs.BoolVar(&c.FlagStripANSI, "strip-ansi", c.FlagStripANSI, "Remove ANSI escape sequences from log messages.")
+	fs.BoolVar(&c.FlagNormalize, "normalize", c.FlagNormalize, "Convert CRLF to LF and remove control characters from log messages.")
+	fs.BoolVar(&c.FlagEscapeControl, "escape-control", c.FlagEscapeControl, "Show ANSI escape sequences and control characters of log messages escaped, as \\x1b.")
+	fs.BoolVar(&c.FlagJSONFields, "json-fields", c.FlagJSONFields, "Promote the keys of task log lines which are JSON objects to fields of JSON based formats.")
+	fs.BoolVar(&c.FlagCoalesce, "coalesce", c.FlagCoalesce, "Collapse the runs of identical consecutive log lines into a line with a repeat count.")
+	fs.IntVar(&c.FlagBinaryWindow, "binary-window", c.FlagBinaryWindow, "Refuse to read sandbox files with no new line within a given number of bytes.")
+	fs.IntVar(&c.FlagMaxEntrySize, "max-entry-size", c.FlagMaxEntrySize, "Truncate the fields of journal entries larger than a given number of bytes.")
+	fs.BoolVar(&c.FlagTranscode, "transcode", c.FlagTranscode, "Transcode Latin-1 and UTF-16 sandbox files to UTF-8.")
+	fs.BoolVar(&c.FlagStableCursors, "stable-cursors", c.FlagStableCursors, "Return task log cursors which remain valid after log rotation.")
+	fs.StringVar(&c.FlagMergeDelay, "merge-delay", c.FlagMergeDelay, "Order merged streams by time, waiting for late entries up to a given duration.")
+	fs.StringVar(&c.FlagSandboxHeartbeat, "sandbox-heartbeat", c.FlagSandboxHeartbeat, "Send heartbeat events on quiet task log streams at a given interval.")
+	fs.StringVar(&c.FlagSandboxHeartbeatPayload, "sandbox-heartbeat-payload", c.FlagSandboxHeartbeatPayload, "Data of task log heartbeat events.")
+	fs.IntVar(&c.FlagFanoutAgentPort, "fanout-agent-port", c.FlagFanoutAgentPort, "Agent admin router port used to read the logs of all agents on masters.")
+	fs.BoolVar(&c.FlagAccessLog, "access-log", c.FlagAccessLog, "Print a JSON access log entry per request to stdout.")
+	fs.IntVar(&c.FlagRateLimit, "rate-limit", c.FlagRateLimit, "Limit the requests per second of a client to range endpoints, 0 disables the limit.")
+	fs.IntVar(&c.FlagRateLimitBurst, "rate-limit-burst", c.FlagRateLimitBurst, "Allow a client a burst of requests above the rate limit.")
+	fs.IntVar(&c.FlagMaxStreams, "max-streams", c.FlagMaxStreams, "Limit the open streams of a client, 0 disables the limit.")
+	fs.StringVar(&c.FlagMaxStreamDuration, "max-stream-duration", c.FlagMaxStreamDuration, "Close the streams of a client after this duration, 0 disables the limit.")
+	fs.IntVar(&c.FlagMaxBytesPerHour, "max-bytes-per-hour", c.FlagMaxBytesPerHour, "Limit the response bytes of a client per hour, 0 disables the limit.")
+	fs.BoolVar(&c.FlagJWTVerify, "jwt-verify", c.FlagJWTVerify, "Verify JWTs of v2 requests with IAM public keys.")
+	fs.StringVar(&c.FlagJWKSURL, "jwks-url", c.FlagJWKSURL, "IAM public keys URL used to verify JWTs.")
+	fs.StringVar(&c.FlagTaskPolicy, "task-policy", c.FlagTaskPolicy, "Restrict the task logs users may read, a path to a JSON policy.")
+	fs.StringVar(&c.FlagClientCertFile, "client-cert", c.FlagClientCertFile, "Present a client certificate to Mesos.")
+	fs.StringVar(&c.FlagClientKeyFile, "client-key", c.FlagClientKeyFile, "Key of the client certificate.")
+	fs.StringVar(&c.FlagTLSServerName, "tls-server-name", c.FlagTLSServerName, "Verify Mesos certificates against a given name.")
+	fs.IntVar(&c.FlagFilesAPIRetries, "files-api-retries", c.FlagFilesAPIRetries, "Retry failed files API reads a given number of times.")
+	fs.StringVar(&c.FlagFilesAPIRetryDelay, "files-api-retry-delay", c.FlagFilesAPIRetryDelay, "Delay before the first files API retry, doubled with every retry.")
+	fs.IntVar(&c.FlagFilesAPIChunkSize, "files-api-chunk-size", c.FlagFilesAPIChunkSize, "Read task logs from the files API in chunks of a given number of bytes.")
+	fs.BoolVar(&c.FlagFilesAPIReadAhead, "files-api-read-ahead", c.FlagFilesAPIReadAhead, "Read the next chunk of a task log ahead of time.")
+	fs.IntVar(&c.FlagFilesAPIMaxLineSize, "files-api-max-line-size", c.FlagFilesAPIMaxLineSize, "Split task log lines longer than a given number of bytes.")
+	fs.BoolVar(&c.FlagFilesAPIRotations, "files-api-rotations", c.FlagFilesAPIRotations, "Read the rotated task log files when the requested lines are before the beginning of a file.")
+	fs.BoolVar(&c.FlagFilesAPITruncateLines, "files-api-truncate-lines", c.FlagFilesAPITruncateLines, "Truncate task log lines longer than the max line size instead of splitting them.")
+	fs.StringVar(&c.FlagJournalDirs, "journal-dirs", c.FlagJournalDirs, "Comma separated list of journal directories read instead of the local journal.")
+	fs.StringVar(&c.FlagKafkaBrokers, "kafka-brokers", c.FlagKafkaBrokers, "Produce journal entries to a comma separated list of Kafka brokers.")
+	fs.StringVar(&c.FlagKafkaTopic, "kafka-topic", c.FlagKafkaTopic, "Kafka topic template, {unit}, {framework} and {host} are replaced with entry fields.")
+	fs.StringVar(&c.FlagKafkaEncoding, "kafka-encoding", c.FlagKafkaEncoding, "Encoding of Kafka records, json or avro.")
+	fs.StringVar(&c.FlagKafkaMatches, "kafka-matches", c.FlagKafkaMatches, "Comma separated FIELD=value journal matches of the entries produced to Kafka.")
+	fs.StringVar(&c.FlagKafkaSandboxFiles, "kafka-sandbox-files", c.FlagKafkaSandboxFiles, "Comma separated sandbox files of the running tasks produced to Kafka.")
+	fs.StringVar(&c.FlagFluentdAddr, "fluentd-addr", c.FlagFluentdAddr, "Send journal entries to a fluentd forward input on a given address.")
+	fs.StringVar(&c.FlagFluentdTag, "fluentd-tag", c.FlagFluentdTag, "Tag prefix of the events sent to fluentd.")
+	fs.StringVar(&c.FlagFluentdMatches, "fluentd-matches", c.FlagFluentdMatches, "Comma separated FIELD=value journal matches of the entries sent to fluentd.")
+	fs.StringVar(&c.FlagElasticURL, "elastic-url", c.FlagElasticURL, "Index journal entries to Elasticsearch URL.")
+	fs.StringVar(&c.FlagElasticIndex, "elastic-index", c.FlagElasticIndex, "Prefix of the daily Elasticsearch indices.")
+	fs.StringVar(&c.FlagElasticMatches, "elastic-matches", c.FlagElasticMatches, "Comma separated FIELD=value journal matches of the entries indexed to Elasticsearch.")
+	fs.StringVar(&c.FlagOTLPURL, "otlp-url", c.FlagOTLPURL, "Export journal entries to OpenTelemetry collector OTLP/HTTP logs URL or OTLP/gRPC URL.")
+	fs.StringVar(&c.FlagOTLPAttributes, "otlp-attributes", c.FlagOTLPAttributes, "Comma separated key=value resource attributes of the exported log records.")
+	fs.StringVar(&c.FlagOTLPHeaders, "otlp-headers", c.FlagOTLPHeaders, "Comma separated key=value headers of the OTLP export requests.")
+	fs.StringVar(&c.FlagOTLPProtocol, "otlp-protocol", c.FlagOTLPProtocol, "Protocol of the OTLP export requests, http/json or grpc.")
+	fs.StringVar(&c.FlagOTLPMatches, "otlp-matches", c.FlagOTLPMatches, "Comma separated FIELD=value journal matches of the entries exported to the OpenTelemetry collector.")
+	fs.StringVar(&c.FlagSyslogForwardAddr, "syslog-forward-addr", c.FlagSyslogForwardAddr, "Send journal entries to a remote syslog collector on a given address.")
+	fs.StringVar(&c.FlagSyslogForwardTransport, "syslog-forward-transport", c.FlagSyslogForwardTransport, "Transport of the syslog messages, udp, tcp or tls.")
+	fs.StringVar(&c.FlagSyslogForwardQuery, "syslog-forward-query", c.FlagSyslogForwardQuery, "Query selecting the journal entries sent to the syslog collector.")
+	fs.StringVar(&c.FlagTraceOTLPURL, "trace-otlp-url", c.FlagTraceOTLPURL, "Export trace spans to OTLP/HTTP traces URL.")
+	fs.Float64Var(&c.FlagTraceSampleRatio, "trace-sample-ratio", c.FlagTraceSampleRatio, "Ratio of the traces started by dcos-log which are sampled.")
+	fs.StringVar(&c.FlagListen, "listen", c.FlagListen, "Sets the listen address, for instance 127.0.0.1:8080. Overrides port.")
+	fs.StringVar(&c.FlagListenUnix, "listen-unix", c.FlagListenUnix, "Also listen on a unix socket at this path.")
+	fs.StringVar(&c.FlagListenUnixMode, "listen-unix-mode", c.FlagListenUnixMode, "Octal file mode of the listen-unix socket.")
+	fs.BoolVar(&c.FlagGRPC, "grpc", c.FlagGRPC, "Serve the gRPC Logs service on the listeners, with HTTP/2 without TLS (h2c).")
+	fs.StringVar(&c.FlagDefaultFormat, "default-format", c.FlagDefaultFormat, "Default format of the component endpoints: text, json, cef, leef, elastic, logfmt, gelf, ndjson or csv.")
+	fs.StringVar(&c.FlagDrainTimeout, "drain-timeout", c.FlagDrainTimeout, "Time to close the open streams and flush the forwarders on SIGTERM.")
+	fs.StringVar(&c.FlagRangeTimeout, "range-timeout", c.FlagRangeTimeout, "Deadline of range requests, streams are not limited. 0 disables it.")
+	fs.StringVar(&c.FlagStreamBackpressure, "stream-backpressure", c.FlagStreamBackpressure, "Policy of a stream whose client is too slow: block, drop-oldest or disconnect.")
+	fs.IntVar(&c.FlagStreamQueueSize, "stream-queue-size", c.FlagStreamQueueSize, "Number of events queued for a stream client.")
+	fs.StringVar(&c.FlagStreamCheckpointInterval, "stream-checkpoint-interval", c.FlagStreamCheckpointInterval, "Send checkpoint events on the streams with integrity markers at a given interval.")
+	fs.StringVar(&c.FlagJournalHeartbeat, "journal-heartbeat", c.FlagJournalHeartbeat, "Send a ping comment on idle journal event streams at this interval. 0 disables it.")
+	fs.BoolVar(&c.FlagEnrichTasks, "enrich-tasks", c.FlagEnrichTasks, "Add AGENT_ID, FRAMEWORK_NAME and TASK_NAME to the journal entries with CONTAINER_ID or MESOS_TASK_ID fields, read from the agent state.")
+	fs.StringVar(&c.FlagEnrichTasksTTL, "enrich-tasks-ttl", c.FlagEnrichTasksTTL, "Cache the agent state of enrich-tasks for this duration.")
+	fs.StringVar(&c.FlagTaskCacheTTL, "task-cache-ttl", c.FlagTaskCacheTTL, "Cache the tasks found by the discovery endpoints, and the unknown tasks, for this duration. 0 disables it.")
+	fs.BoolVar(&c.FlagDiscoveryProxy, "discovery-proxy", c.FlagDiscoveryProxy, "Proxy the task logs found by the discovery endpoints through this node instead of redirecting to the agent.")
+	fs.BoolVar(&c.FlagFilesAPIOperator, "files-api-operator", c.FlagFilesAPIOperator, "Read task logs with the Mesos v1 operator API READ_FILE and LIST_FILES calls instead of /files/read and /files/browse.")
+	fs.StringVar(&c.FlagMesosWorkDir, "mesos-work-dir", c.FlagMesosWorkDir, "Mesos agent --work_dir, the task sandboxes are in its slaves directory.")
+	fs.StringVar(&c.FlagFollowMaxInterval, "follow-max-interval", c.FlagFollowMaxInterval, "Longest interval an idle followed task log is polled at, the interval doubles while the file does not grow. 0 disables the backoff.")
+	fs.IntVar(&c.FlagMaxLimit, "max-limit", c.FlagMaxLimit, "Reject the requests with a larger limit parameter with 422. 0 is no maximum.")
+	fs.IntVar(&c.FlagMaxRangeBytes, "max-range-bytes", c.FlagMaxRangeBytes, "Reject the Range requests for more bytes with 416. 0 is no maximum.")
+	fs.IntVar(&c.FlagFilesAPIBreakerFailures, "files-api-breaker-failures", c.FlagFilesAPIBreakerFailures, "Fail the files API reads of an agent with 503 after a given number of consecutive failures. 0 disables it.")
+	fs.StringVar(&c.FlagFilesAPIBreakerCooldown, "files-api-breaker-cooldown", c.FlagFilesAPIBreakerCooldown, "Time the files API reads of a failing agent fail before a probe request.")
+	fs.IntVar(&c.FlagFilesAPIMaxIdleConns, "files-api-max-idle-conns", c.FlagFilesAPIMaxIdleConns, "Number of idle connections kept open to every master and agent.")
+	fs.IntVar(&c.FlagFilesAPIChunkCache, "files-api-chunk-cache", c.FlagFilesAPIChunkCache, "Keep a given number of task log chunks in memory for the repeated reads. 0 disables the cache.")
+	fs.IntVar(&c.FlagMaxScanBytes, "max-scan-bytes", c.FlagMaxScanBytes, "Reject the task log reads which skip lines backwards beyond a given number of bytes from the end with 422. 0 is no maximum.")
+	fs.StringVar(&c.FlagAuditLog, "audit-log", c.FlagAuditLog, "Record the log accesses to journald or to a given file.")
+	fs.StringVar(&c.FlagAuditIdentifier, "audit-identifier", c.FlagAuditIdentifier, "Syslog identifier of the audit events written to journald.")
+	fs.StringVar(&c.FlagAdminUIDs, "admin-uids", c.FlagAdminUIDs, "Comma separated list of uids which may use the admin API, empty disables it.")
+	fs.BoolVar(&c.FlagDebugEndpoints, "debug-endpoints", c.FlagDebugEndpoints, "Expose pprof and expvar under /debug to the users of admin-uids.")
+	fs.StringVar(&c.FlagMultilineStart, "multiline-start", c.FlagMultilineStart, "Merge the task log lines which do not match a given pattern into the previous line, like the stack traces of records starting with a date.")
+	fs.StringVar(&c.FlagMultilineContinuation, "multiline-continuation", c.FlagMultilineContinuation, "Merge the task log lines which match a given pattern into the previous line, like ^\\s for indented stack traces.")
+	fs.BoolVar(&c.FlagFilesAPIServiceAccount, "files-api-service-account", c.FlagFilesAPIServiceAccount, "Authorize the task log requests to the agent with the service account of iam-config.")
 }
 
-// NewConfig returns a new instance of Config with loaded fields.
+// NewConfig returns a new instance of Config with loaded fields. The values are taken from the command line
+// flags, DCOS_LOG_* environment variables, the config file and the defaults, in this order of precedence.
 func NewConfig(args []string) (*Config, error) {
-	config := &Config{}
+	return newConfig(args, os.LookupEnv)
+}
+
+func newConfig(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	config := &Config{args: args, lookupEnv: lookupEnv}
 	if len(args) == 0 {
 		return config, errors.New("arguments cannot be empty")
 	}
@@ -94,27 +1023,98 @@ func NewConfig(args []string) (*Config, error) {
 	// load default config values
 	config.FlagPort = defaultHTTPPort
 	config.FlagGetRequestTimeout = defaultGETRequestTimeout
+	config.FlagArchiveInterval = defaultArchiveInterval
+	config.FlagArchiveRetention = defaultArchiveRetention
+	config.FlagArchiveFiles = defaultArchiveFiles
+	config.FlagDockerSocket = defaultDockerSocket
+	config.FlagForwardStateDir = defaultForwardStateDir
+	config.FlagSplunkMaxRetries = defaultSplunkMaxRetries
+	config.FlagSplunkSourcetype = defaultSplunkSourcetype
+	config.FlagBinaryWindow = defaultBinaryWindow
+	config.FlagMaxEntrySize = defaultMaxEntrySize
+	config.FlagFanoutAgentPort = defaultFanoutAgentPort
+	config.FlagMergeDelay = defaultMergeDelay
+	config.FlagSandboxHeartbeat = defaultSandboxHeartbeat
+	config.FlagRateLimitBurst = defaultRateLimitBurst
+	config.FlagJWKSURL = defaultJWKSURL
+	config.FlagFilesAPIRetries = defaultFilesAPIRetries
+	config.FlagFilesAPIRetryDelay = defaultFilesAPIRetryDelay
+	config.FlagFilesAPIChunkSize = defaultFilesAPIChunkSize
+	config.FlagFilesAPIMaxLineSize = defaultFilesAPIMaxLine
+	config.FlagKafkaTopic = defaultKafkaTopic
+	config.FlagKafkaEncoding = defaultKafkaEncoding
+	config.FlagFluentdTag = defaultFluentdTag
+	config.FlagElasticIndex = defaultElasticIndex
+	config.FlagSyslogForwardTransport = defaultSyslogTransport
+	config.FlagOTLPProtocol = defaultOTLPProtocol
+	config.FlagTraceSampleRatio = defaultTraceSampleRatio
+	config.FlagDrainTimeout = defaultDrainTimeout
+	config.FlagRangeTimeout = defaultRangeTimeout
+	config.FlagExportJobsMax = defaultExportJobsMax
+	config.FlagExportJobsRetention = defaultExportJobsRetain
+	config.FlagExportJobsRateLimit = defaultExportJobsRate
+	config.FlagMaxStreamDuration = defaultMaxStreamDuration
+	config.FlagListenUnixMode = defaultListenUnixMode
+	config.FlagStreamBackpressure = defaultStreamBackpressure
+	config.FlagStreamQueueSize = defaultStreamQueueSize
+	config.FlagStreamCheckpointInterval = defaultStreamCheckpoint
+	config.FlagJournalHeartbeat = defaultJournalHeartbeat
+	config.FlagTaskCacheTTL = defaultTaskCacheTTL
+	config.FlagEnrichTasksTTL = defaultEnrichTasksTTL
+	config.FlagMesosWorkDir = defaultMesosWorkDir
+	config.FlagFollowMaxInterval = defaultFollowMaxInterval
+	config.FlagMaxLimit = defaultMaxLimit
+	config.FlagMaxRangeBytes = defaultMaxRangeBytes
+	config.FlagFilesAPIBreakerFailures = defaultBreakerFailures
+	config.FlagFilesAPIBreakerCooldown = defaultBreakerCooldown
+	config.FlagFilesAPIMaxIdleConns = defaultMaxIdleConns
+	config.FlagMaxScanBytes = defaultMaxScanBytes
+	config.FlagAuditIdentifier = defaultAuditIdentifier
 
 	flagSet := flag.NewFlagSet(dcosLog, flag.ContinueOnError)
 	config.setFlags(flagSet)
 
-	// override with user provided arguments
 	if err := flagSet.Parse(args[1:]); err != nil {
 		return config, err
 	}
 
+	// the flags set on the command line are applied again after the config file and environment.
+	explicit := make(map[string]string)
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if _, ok := explicit["config"]; !ok {
+		if path, ok := lookupEnv(envName("config")); ok {
+			config.FlagConfig = path
+		}
+	}
+
 	// read config file if exists.
 	if err := readAndUpdateConfigFile(config); err != nil {
 		return nil, err
 	}
 
+	if err := applyEnv(flagSet, explicit, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	for name, value := range explicit {
+		if err := flagSet.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+
 	// set debug level
 	if config.FlagVerbose {
 		logrus.SetLevel(logrus.DebugLevel)
 		logrus.Debug("Using debug level")
 	}
 
-	return config, validateConfigStruct(config)
+	if err := validateConfigStruct(config); err != nil {
+		return nil, err
+	}
+	return config, validateValues(config)
 }
 
 func readAndUpdateConfigFile(defaultConfig *Config) error {
@@ -127,8 +1127,13 @@ func readAndUpdateConfigFile(defaultConfig *Config) error {
 		return err
 	}
 
+	configContent, err = decodeConfigFile(defaultConfig.FlagConfig, configContent)
+	if err != nil {
+		return fmt.Errorf("config file %s: %s", defaultConfig.FlagConfig, err)
+	}
+
 	if err := validateConfigFile(configContent); err != nil {
-		return err
+		return fmt.Errorf("config file %s: %s", defaultConfig.FlagConfig, err)
 	}
 
 	// override default values
@@ -163,8 +1168,9 @@ func validate(documentLoader gojsonschema.JSONLoader) error {
 }
 
 func printErrorsAndFail(resultErrors []gojsonschema.ResultError) error {
+	msgs := make([]string, 0, len(resultErrors))
 	for _, resultError := range resultErrors {
-		logrus.Error(resultError)
+		msgs = append(msgs, fmt.Sprintf("%s: %s", resultError.Field(), resultError.Description()))
 	}
-	return errors.New("Validation failed")
+	return fmt.Errorf("Validation failed: %s", strings.Join(msgs, "; "))
 }
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// decodeConfigFile converts the content of a YAML (.yaml, .yml) or TOML (.toml) config file to JSON, the other
+// files are JSON. All options are top level scalars, so only flat files are supported:
+//
+//	# YAML
+//	port: 8080
+//	rate-limit: 10
+//	loki-url: "http://loki:3100/loki/api/v1/push"
+//
+//	# TOML
+//	port = 8080
+//	strip-ansi = true
+func decodeConfigFile(path string, content []byte) ([]byte, error) {
+	var separator byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		separator = ':'
+	case ".toml":
+		separator = '='
+	default:
+		return content, nil
+	}
+
+	values := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || (separator == ':' && line == "---") {
+			continue
+		}
+
+		i := strings.IndexByte(line, separator)
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expect key%c value", n, separator)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", n, key)
+		}
+
+		value, err := parseScalar(strings.TrimSpace(line[i+1:]), separator == ':')
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(values)
+}
+
+// stripComment removes a # comment which is not in a quoted string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseScalar parses a quoted string, a boolean or a number. Unquoted strings are allowed in YAML only, nested
+// values are not supported.
+func parseScalar(s string, yaml bool) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("nested values are not supported")
+	case s[0] == '"':
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		// a quote is escaped by doubling it in YAML, TOML literal strings cannot contain quotes.
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	case strings.ContainsAny(s[:1], "[{|>"):
+		return nil, fmt.Errorf("nested values are not supported")
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+
+	if !yaml {
+		return nil, fmt.Errorf("invalid value %s, strings must be quoted", s)
+	}
+	return s, nil
+}
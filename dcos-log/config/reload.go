@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ErrNotReloadable is returned by Reload if the config was not created by NewConfig.
+var ErrNotReloadable = errors.New("config was not loaded from command line arguments")
+
+// reloadableFlags are the options applied to the running service by Merge. They are read by every request, so
+// the new values are used by new requests while the open streams keep the values they started with. The other
+// options require a restart.
+var reloadableFlags = map[string]bool{
+	"verbose":                    true,
+	"strip-ansi":                 true,
+	"normalize":                  true,
+	"coalesce":                   true,
+	"escape-control":             true,
+	"json-fields":                true,
+	"binary-window":              true,
+	"max-entry-size":             true,
+	"transcode":                  true,
+	"stable-cursors":             true,
+	"merge-delay":                true,
+	"sandbox-heartbeat":          true,
+	"sandbox-heartbeat-payload":  true,
+	"rate-limit":                 true,
+	"rate-limit-burst":           true,
+	"max-streams":                true,
+	"max-stream-duration":        true,
+	"max-bytes-per-hour":         true,
+	"siem-field-mapping":         true,
+	"redaction-policy":           true,
+	"task-policy":                true,
+	"files-api-retries":          true,
+	"files-api-retry-delay":      true,
+	"files-api-chunk-size":       true,
+	"files-api-read-ahead":       true,
+	"files-api-max-line-size":    true,
+	"files-api-rotations":        true,
+	"files-api-truncate-lines":   true,
+	"default-format":             true,
+	"range-timeout":              true,
+	"multiline-start":            true,
+	"multiline-continuation":     true,
+	"stream-backpressure":        true,
+	"stream-queue-size":          true,
+	"journal-heartbeat":          true,
+	"task-cache-ttl":             true,
+	"discovery-proxy":            true,
+	"files-api-operator":         true,
+	"mesos-work-dir":             true,
+	"follow-max-interval":        true,
+	"max-limit":                  true,
+	"max-range-bytes":            true,
+	"files-api-breaker-failures": true,
+	"files-api-breaker-cooldown": true,
+	"max-scan-bytes":             true,
+}
+
+// Reload loads the config again from the same command line arguments, environment and config file.
+func (c *Config) Reload() (*Config, error) {
+	if len(c.args) == 0 {
+		return nil, ErrNotReloadable
+	}
+	return newConfig(c.args, c.lookupEnv)
+}
+
+// Merge returns a copy of the config with the reloadable options of a reloaded config, and the sorted names of
+// the other options which changed and are ignored until a restart.
+func (c *Config) Merge(reloaded *Config) (*Config, []string, error) {
+	current, err := flagValues(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next, err := flagValues(reloaded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var restart []string
+	for name, value := range next {
+		if string(current[name]) == string(value) {
+			continue
+		}
+
+		if reloadableFlags[name] {
+			current[name] = value
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(restart)
+
+	body, err := json.Marshal(current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := &Config{}
+	if err := json.Unmarshal(body, merged); err != nil {
+		return nil, nil, err
+	}
+
+	merged.FlagConfig, merged.FlagPrintConfig = c.FlagConfig, c.FlagPrintConfig
+	merged.args, merged.lookupEnv = c.args, c.lookupEnv
+	return merged, restart, nil
+}
+
+// flagValues returns the JSON values of the options by name.
+func flagValues(c *Config) (map[string]json.RawMessage, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage)
+	return values, json.Unmarshal(body, &values)
+}
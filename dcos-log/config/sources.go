@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is a prefix of environment variables, a flag archive-url is set by DCOS_LOG_ARCHIVE_URL.
+const envPrefix = "DCOS_LOG_"
+
+// redacted replaces the secrets of a redacted config.
+const redacted = "REDACTED"
+
+// envName returns the environment variable of a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// applyEnv sets the flags which were not set on the command line from the environment.
+func applyEnv(fs *flag.FlagSet, explicit map[string]string, lookupEnv func(string) (string, bool)) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := explicit[f.Name]; ok || err != nil || f.Name == "config" {
+			return
+		}
+
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q of %s: %s", value, envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// validateValues checks the values the JSON schema cannot check.
+func validateValues(c *Config) error {
+	var errs []string
+	durations := []struct {
+		name, value string
+	}{
+		{"timeout", c.FlagGetRequestTimeout},
+		{"archive-interval", c.FlagArchiveInterval},
+		{"archive-retention", c.FlagArchiveRetention},
+		{"merge-delay", c.FlagMergeDelay},
+		{"sandbox-heartbeat", c.FlagSandboxHeartbeat},
+		{"files-api-retry-delay", c.FlagFilesAPIRetryDelay},
+		{"drain-timeout", c.FlagDrainTimeout},
+		{"range-timeout", c.FlagRangeTimeout},
+		{"max-stream-duration", c.FlagMaxStreamDuration},
+		{"journal-heartbeat", c.FlagJournalHeartbeat},
+		{"task-cache-ttl", c.FlagTaskCacheTTL},
+		{"enrich-tasks-ttl", c.FlagEnrichTasksTTL},
+		{"follow-max-interval", c.FlagFollowMaxInterval},
+		{"files-api-breaker-cooldown", c.FlagFilesAPIBreakerCooldown},
+		{"export-jobs-retention", c.FlagExportJobsRetention},
+		{"stream-checkpoint-interval", c.FlagStreamCheckpointInterval},
+	}
+
+	for _, d := range durations {
+		if _, err := time.ParseDuration(d.value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: invalid duration %q, use a value like 5s or 10m", d.name, d.value))
+		}
+	}
+
+	if strings.ContainsAny(c.FlagSandboxHeartbeatPayload, "\r\n") {
+		errs = append(errs, "sandbox-heartbeat-payload: must be a single line")
+	}
+
+	if c.FlagMaxEntrySize < 0 {
+		errs = append(errs, "max-entry-size: must be 0 or greater")
+	}
+
+	if mode, err := strconv.ParseUint(c.FlagListenUnixMode, 8, 32); err != nil || mode > 0777 {
+		errs = append(errs, fmt.Sprintf("listen-unix-mode: invalid file mode %q, use an octal mode like 0660",
+			c.FlagListenUnixMode))
+	}
+
+	if !path.IsAbs(c.FlagMesosWorkDir) {
+		errs = append(errs, "mesos-work-dir: must be an absolute path")
+	}
+
+	if c.FlagBinaryWindow < 0 {
+		errs = append(errs, "binary-window: must be 0 or greater")
+	}
+
+	if (c.FlagClientCertFile == "") != (c.FlagClientKeyFile == "") {
+		errs = append(errs, "client-cert: requires client-key")
+	}
+
+	if c.FlagJournalRemote != "" && (c.FlagJournalRemoteCertFile == "" || c.FlagJournalRemoteKeyFile == "" ||
+		c.FlagJournalRemoteClientCAFile == "") {
+		errs = append(errs, "journal-remote: requires journal-remote-cert, journal-remote-key and journal-remote-client-ca")
+	}
+
+	if c.FlagArchive && c.FlagArchiveURL == "" {
+		errs = append(errs, "archive: requires archive-url")
+	}
+
+	if c.FlagSplunkURL != "" && c.FlagSplunkToken == "" {
+		errs = append(errs, "splunk-url: requires splunk-token")
+	}
+
+	if c.FlagKafkaSandboxFiles != "" && c.FlagKafkaBrokers == "" {
+		errs = append(errs, "kafka-sandbox-files: requires kafka-brokers")
+	}
+
+	// the admin endpoints trust the uid of the token, it must be verified.
+	if c.FlagAdminUIDs != "" && !c.FlagJWTVerify {
+		errs = append(errs, "admin-uids: requires jwt-verify")
+	}
+
+	if c.FlagDebugEndpoints && c.FlagAdminUIDs == "" {
+		errs = append(errs, "debug-endpoints: requires admin-uids")
+	}
+
+	if c.FlagFilesAPIServiceAccount && c.FlagIAMConfig == "" {
+		errs = append(errs, "files-api-service-account: requires iam-config")
+	}
+
+	if ttl, err := time.ParseDuration(c.FlagEnrichTasksTTL); c.FlagEnrichTasks && err == nil && ttl <= 0 {
+		errs = append(errs, "enrich-tasks-ttl: must be greater than 0")
+	}
+
+	if c.FlagMultilineStart != "" && c.FlagMultilineContinuation != "" {
+		errs = append(errs, "multiline-start: cannot be used with multiline-continuation")
+	}
+
+	for _, p := range []struct{ name, value string }{
+		{"multiline-start", c.FlagMultilineStart},
+		{"multiline-continuation", c.FlagMultilineContinuation},
+	} {
+		if _, err := regexp.Compile(p.value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", p.name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("Validation failed: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config without the secrets, the tokens, the header values and the passwords of the
+// URLs, for the printed config and the diagnostics.
+func (c *Config) Redacted() *Config {
+	cfg := *c
+	if cfg.FlagSplunkToken != "" {
+		cfg.FlagSplunkToken = redacted
+	}
+	cfg.FlagOTLPHeaders = redactValues(cfg.FlagOTLPHeaders)
+
+	for _, u := range []*string{&cfg.FlagArchiveURL, &cfg.FlagLokiURL, &cfg.FlagSplunkURL, &cfg.FlagExportURL,
+		&cfg.FlagJWKSURL, &cfg.FlagElasticURL, &cfg.FlagOTLPURL, &cfg.FlagTraceOTLPURL} {
+		*u = redactURL(*u)
+	}
+	return &cfg
+}
+
+// redactURL replaces the password of a URL.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// redactValues replaces the values of a comma separated list of key=value pairs, the keys are kept.
+func redactValues(s string) string {
+	pairs := strings.Split(s, ",")
+	for i, pair := range pairs {
+		if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 && kv[1] != "" {
+			pairs[i] = kv[0] + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Print writes the effective config as JSON, the secrets are redacted.
+func (c *Config) Print(w io.Writer) error {
+	body, err := json.MarshalIndent(c.Redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", body)
+	return err
+}
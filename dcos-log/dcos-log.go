@@ -14,5 +14,14 @@ func main() {
 		logrus.Fatalf("Could not load config: %s", err)
 	}
 
-	logrus.Fatal(api.StartServer(cfg))
+	if cfg.FlagPrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			logrus.Fatalf("Could not print config: %s", err)
+		}
+		return
+	}
+
+	if err := api.StartServer(cfg); err != nil {
+		logrus.Fatal(err)
+	}
 }
@@ -0,0 +1,37 @@
+package diagnostics
+
+import (
+	"sync"
+)
+
+// Provider returns the current state of a component, the returned value must be json serializable.
+type Provider func() interface{}
+
+var (
+	mu        sync.Mutex
+	providers = make(map[string]Provider)
+)
+
+// Register adds a named section to the diagnostic snapshot. Registering the same name twice replaces
+// the previous provider.
+func Register(name string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[name] = p
+}
+
+// Snapshot calls all registered providers and returns their state keyed by section name.
+func Snapshot() map[string]interface{} {
+	mu.Lock()
+	current := make(map[string]Provider, len(providers))
+	for name, p := range providers {
+		current[name] = p
+	}
+	mu.Unlock()
+
+	snapshot := make(map[string]interface{}, len(current))
+	for name, p := range current {
+		snapshot[name] = p()
+	}
+	return snapshot
+}
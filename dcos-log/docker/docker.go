@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// JSONFileDriver is the docker log driver this package can read.
+const JSONFileDriver = "json-file"
+
+// mesosContainerPrefix is a prefix of container names created by the mesos docker containerizer.
+const mesosContainerPrefix = "mesos-"
+
+var (
+	// ErrContainerNotFound is returned by Inspect if docker daemon does not know the container.
+	ErrContainerNotFound = errors.New("docker container not found")
+
+	// ErrUnsupportedLogDriver is returned by Resolve if a container does not use json-file log driver.
+	ErrUnsupportedLogDriver = errors.New("docker container does not use json-file log driver")
+)
+
+// LogConfig is a container log driver config.
+type LogConfig struct {
+	Type string `json:"Type"`
+}
+
+// HostConfig is a subset of the container host config.
+type HostConfig struct {
+	LogConfig LogConfig `json:"LogConfig"`
+}
+
+// Container is a subset of the docker inspect response.
+type Container struct {
+	ID         string     `json:"Id"`
+	Name       string     `json:"Name"`
+	LogPath    string     `json:"LogPath"`
+	HostConfig HostConfig `json:"HostConfig"`
+}
+
+// MesosContainerID returns the mesos container ID of a container created by the mesos docker containerizer,
+// false for the other containers. The containerizer names the containers mesos-<container_id>, older agents
+// mesos-<agent_id>.<container_id>.
+func (c *Container) MesosContainerID() (string, bool) {
+	name := strings.TrimPrefix(c.Name, "/")
+	if !strings.HasPrefix(name, mesosContainerPrefix) {
+		return "", false
+	}
+
+	id := strings.TrimPrefix(name, mesosContainerPrefix)
+	if i := strings.LastIndex(id, "."); i >= 0 {
+		id = id[i+1:]
+	}
+	return id, id != ""
+}
+
+// Client is a minimal docker engine API client.
+type Client struct {
+	client *http.Client
+	base   url.URL
+}
+
+// NewClient returns a client talking to the docker daemon over a unix socket.
+func NewClient(socket string) *Client {
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &Client{
+		client: &http.Client{Transport: tr, Timeout: 10 * time.Second},
+		base:   url.URL{Scheme: "http", Host: "docker"},
+	}
+}
+
+// NewClientWithURL returns a client talking to the docker daemon over TCP, used in tests.
+func NewClientWithURL(client *http.Client, base url.URL) *Client {
+	return &Client{client: client, base: base}
+}
+
+// Inspect returns the container by ID or name.
+func (c *Client) Inspect(ctx context.Context, id string) (*Container, error) {
+	u := c.base
+	u.Path = "/containers/" + url.PathEscape(id) + "/json"
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to inspect docker container %s: %s", id, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrContainerNotFound
+	default:
+		return nil, fmt.Errorf("unable to inspect docker container %s: bad status %d", id, resp.StatusCode)
+	}
+
+	container := &Container{}
+	if err := json.NewDecoder(resp.Body).Decode(container); err != nil {
+		return nil, fmt.Errorf("unable to decode docker container %s: %s", id, err)
+	}
+
+	return container, nil
+}
+
+// Resolve finds a container by docker ID, name or mesos container ID and checks its logs
+// can be read from a json file.
+func (c *Client) Resolve(ctx context.Context, id string) (*Container, error) {
+	container, err := c.Inspect(ctx, id)
+	if err == ErrContainerNotFound && !strings.HasPrefix(id, mesosContainerPrefix) {
+		container, err = c.Inspect(ctx, mesosContainerPrefix+id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if container.HostConfig.LogConfig.Type != JSONFileDriver || container.LogPath == "" {
+		return nil, ErrUnsupportedLogDriver
+	}
+
+	return container, nil
+}
@@ -0,0 +1,153 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const logLines = `{"log":"one\n","stream":"stdout","time":"2018-01-01T00:00:00Z"}
+{"log":"two\n","stream":"stderr","time":"2018-01-01T00:00:01Z"}
+{"log":"three\n","stream":"stdout","time":"2018-01-01T00:00:02Z"}
+`
+
+func TestResolve(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var c Container
+		switch r.URL.Path {
+		case "/containers/mesos-abc/json":
+			c = Container{ID: "123", LogPath: "/var/lib/docker/123-json.log"}
+			c.HostConfig.LogConfig.Type = JSONFileDriver
+		case "/containers/journald/json":
+			c = Container{ID: "456"}
+			c.HostConfig.LogConfig.Type = "journald"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(c)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithURL(http.DefaultClient, *u)
+
+	// mesos container ID is resolved via mesos- name prefix.
+	c, err := client.Resolve(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ID != "123" || c.LogPath != "/var/lib/docker/123-json.log" {
+		t.Fatalf("unexpected container %+v", c)
+	}
+
+	if _, err := client.Resolve(context.Background(), "journald"); err != ErrUnsupportedLogDriver {
+		t.Fatalf("expect ErrUnsupportedLogDriver. Got %v", err)
+	}
+
+	if _, err := client.Resolve(context.Background(), "missing"); err != ErrContainerNotFound {
+		t.Fatalf("expect ErrContainerNotFound. Got %v", err)
+	}
+}
+
+func TestMesosContainerID(t *testing.T) {
+	for name, expect := range map[string]string{
+		"/mesos-abc":       "abc",
+		"/mesos-agent.abc": "abc",
+		"/nginx":           "",
+		"/mesos-":          "",
+	} {
+		c := &Container{Name: name}
+		if id, ok := c.MesosContainerID(); id != expect || ok != (expect != "") {
+			t.Fatalf("%s: expect %q. Got %q, %t", name, expect, id, ok)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	entries, offset, err := Tail(strings.NewReader(logLines+`{"log":"partial`), "stdout", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Log != "three\n" {
+		t.Fatalf("expect last stdout entry. Got %v", entries)
+	}
+
+	if offset != int64(len(logLines)) {
+		t.Fatalf("expect offset %d. Got %d", len(logLines), offset)
+	}
+
+	entries, _, err = Tail(strings.NewReader(logLines), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries. Got %d", len(entries))
+	}
+}
+
+func TestFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "container-json.log")
+	if err := ioutil.WriteFile(logPath, []byte(logLines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFollower(logPath, "", int64(len(logLines)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(`{"log":"four\n","stream":"stdout"}` + "\n" + `{"log":"fi`)
+	fd.Close()
+
+	entries, err := f.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Log != "four\n" {
+		t.Fatalf("expect a new entry. Got %v", entries)
+	}
+
+	// rotate the log the way docker does.
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(logPath, []byte(`{"log":"six\n","stream":"stdout"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = f.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Log != "six\n" {
+		t.Fatalf("expect an entry from the rotated log. Got %v", entries)
+	}
+}
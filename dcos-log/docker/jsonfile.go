@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// Entry is a single line of docker json-file log.
+type Entry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// decodeLine decodes a json-file line and reports whether it matches the stream filter.
+func decodeLine(line []byte, stream string) (Entry, bool) {
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return e, false
+	}
+	return e, stream == "" || e.Stream == stream
+}
+
+// Scan reads all entries from r and calls fn with the entries of the stream, one at a time, so the entries are
+// not kept in memory. Empty stream matches stdout and stderr. The number of bytes read is returned to continue
+// reading with a Follower, an error of fn stops the scan.
+func Scan(r io.Reader, stream string, fn func(Entry) error) (int64, error) {
+	var read int64
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// partial line is left for the follower.
+			return read, nil
+		}
+
+		if err != nil {
+			return read, err
+		}
+		read += int64(len(line))
+
+		e, ok := decodeLine(line, stream)
+		if !ok {
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			return read, err
+		}
+	}
+}
+
+// Tail reads all entries from r and returns the last n entries of the stream, see Scan. n <= 0 returns all
+// entries, use Scan to read a whole file of unknown size.
+func Tail(r io.Reader, stream string, n int) ([]Entry, int64, error) {
+	var entries []Entry
+	read, err := Scan(r, stream, func(e Entry) error {
+		entries = append(entries, e)
+		if n > 0 && len(entries) > n {
+			entries = entries[1:]
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, read, err
+	}
+	return entries, read, nil
+}
+
+// Follower reads the entries appended to a json-file log. It detects the file rotation by docker
+// and continues with the new file.
+type Follower struct {
+	path   string
+	stream string
+
+	f       *os.File
+	info    os.FileInfo
+	partial []byte
+}
+
+// NewFollower opens the log file at path and seeks to offset.
+func NewFollower(path, stream string, offset int64) (*Follower, error) {
+	f := &Follower{path: path, stream: stream}
+	if err := f.open(offset); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Follower) open(offset int64) error {
+	fd, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		fd.Close()
+		return err
+	}
+
+	if f.f != nil {
+		f.f.Close()
+	}
+
+	f.f = fd
+	f.info = info
+	f.partial = nil
+	return nil
+}
+
+// Next returns the complete entries appended since the last call.
+func (f *Follower) Next() ([]Entry, error) {
+	entries, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	// the file was rotated, read the rest of the old file above and continue with the new one.
+	if info, err := os.Stat(f.path); err == nil && !os.SameFile(info, f.info) {
+		if err := f.open(0); err != nil {
+			return entries, err
+		}
+
+		more, err := f.read()
+		return append(entries, more...), err
+	}
+
+	return entries, nil
+}
+
+func (f *Follower) read() ([]Entry, error) {
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, f.f); err != nil {
+		return nil, err
+	}
+
+	data := append(f.partial, buf.Bytes()...)
+
+	var entries []Entry
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		if e, ok := decodeLine(data[:i], f.stream); ok {
+			entries = append(entries, e)
+		}
+		data = data[i+1:]
+	}
+
+	f.partial = append([]byte(nil), data...)
+	return entries, nil
+}
+
+// Close closes the log file.
+func (f *Follower) Close() error {
+	return f.f.Close()
+}
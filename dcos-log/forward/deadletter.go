@@ -0,0 +1,103 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const deadLetterSuffix = ".json"
+
+// deadLetter writes the batch to the dead letter dir and returns the metric status of the entries.
+func (f *Forwarder) deadLetter(batch []Entry) string {
+	if f.deadLetterDir == "" {
+		return "dropped"
+	}
+
+	if err := writeDeadLetter(f.deadLetterDir, batch, time.Now()); err != nil {
+		logrus.Errorf("%s forwarder: unable to write %d entries to dead letter dir: %s", f.sink.Name(), len(batch), err)
+		return "dropped"
+	}
+
+	f.mu.Lock()
+	f.stats.DeadLetter += uint64(len(batch))
+	f.mu.Unlock()
+	return "dead_letter"
+}
+
+func writeDeadLetter(dir string, batch []Entry, now time.Time) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	// file names sort in the order the batches were written.
+	name := filepath.Join(dir, fmt.Sprintf("%020d%s", now.UnixNano(), deadLetterSuffix))
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// replayDeadLetters sends the stored batches once, the files are removed after the batch is sent. The
+// replay stops at the first error, the remaining batches are sent on the next start.
+func (f *Forwarder) replayDeadLetters(ctx context.Context) {
+	if f.deadLetterDir == "" {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(f.deadLetterDir, "*"+deadLetterSuffix))
+	if err != nil {
+		logrus.Errorf("%s forwarder: unable to list dead letter dir: %s", f.sink.Name(), err)
+		return
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			logrus.Errorf("%s forwarder: unable to read dead letter %s: %s", f.sink.Name(), file, err)
+			return
+		}
+
+		var batch []Entry
+		if err := json.Unmarshal(body, &batch); err != nil {
+			logrus.Errorf("%s forwarder: removing invalid dead letter %s: %s", f.sink.Name(), file, err)
+			os.Remove(file)
+			continue
+		}
+
+		if err := f.sink.Send(ctx, batch); err != nil {
+			if _, ok := err.(permanentError); !ok {
+				logrus.Errorf("%s forwarder: unable to replay dead letter %s: %s", f.sink.Name(), file, err)
+				return
+			}
+
+			logrus.Errorf("%s forwarder: removing rejected dead letter %s: %s", f.sink.Name(), file, err)
+			os.Remove(file)
+			continue
+		}
+
+		entriesTotal.WithLabelValues(f.sink.Name(), "sent").Add(float64(len(batch)))
+		f.mu.Lock()
+		f.stats.Sent += uint64(len(batch))
+		f.mu.Unlock()
+
+		if err := os.Remove(file); err != nil {
+			logrus.Errorf("%s forwarder: unable to remove dead letter %s: %s", f.sink.Name(), file, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultElasticIndex = "dcos-logs"
+
+// ElasticOption is a functional option that configures an ElasticSink.
+type ElasticOption func(*ElasticSink) error
+
+// OptionElasticIndex sets the index prefix, the entries are indexed to daily indices <prefix>-YYYY.MM.DD.
+func OptionElasticIndex(prefix string) ElasticOption {
+	return func(s *ElasticSink) error {
+		if prefix != strings.ToLower(prefix) || strings.ContainsAny(prefix, `\/*?"<>| ,#`) {
+			return fmt.Errorf("invalid elasticsearch index prefix %q", prefix)
+		}
+
+		if prefix != "" {
+			s.index = prefix
+		}
+		return nil
+	}
+}
+
+// OptionElasticRejectedFile sets a file the documents rejected by Elasticsearch are appended to, one JSON object
+// with the entry and the error per line. The rejected documents are logged if the file is not set.
+func OptionElasticRejectedFile(path string) ElasticOption {
+	return func(s *ElasticSink) error {
+		s.rejectedFile = path
+		return nil
+	}
+}
+
+// ElasticSink indexes entries to Elasticsearch with the bulk API. The entries are converted to ECS documents the
+// same way as the elastic bulk export, the journal cursor is the document ID, so a batch sent twice does not create
+// duplicates. An index template mapping the journal fields is installed before the first batch.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+type ElasticSink struct {
+	client       *http.Client
+	url          string
+	index        string
+	rejectedFile string
+
+	mu       sync.Mutex
+	template bool
+}
+
+// NewElasticSink returns a new instance of ElasticSink. elasticURL is the URL of the cluster, for instance
+// http://elasticsearch:9200, basic auth credentials may be set in the URL.
+func NewElasticSink(client *http.Client, elasticURL string, opts ...ElasticOption) (*ElasticSink, error) {
+	s := &ElasticSink{
+		client: client,
+		url:    strings.TrimSuffix(elasticURL, "/"),
+		index:  defaultElasticIndex,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Name returns "elasticsearch".
+func (s *ElasticSink) Name() string {
+	return "elasticsearch"
+}
+
+// Index returns the daily index of the entry, by the UTC date of the entry.
+func (s *ElasticSink) Index(e Entry) string {
+	return s.index + "-" + e.Time.UTC().Format("2006.01.02")
+}
+
+// elasticTemplate is the index template of the daily indices. The ECS fields have explicit types, the other
+// strings are keywords so the journal metadata can be filtered and aggregated.
+func (s *ElasticSink) elasticTemplate() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+	return map[string]interface{}{
+		"index_patterns": []string{s.index + "-*"},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic_templates": []interface{}{
+					map[string]interface{}{
+						"strings": map[string]interface{}{
+							"match_mapping_type": "string",
+							"mapping":            map[string]interface{}{"type": "keyword", "ignore_above": 1024},
+						},
+					},
+				},
+				"properties": map[string]interface{}{
+					"@timestamp": map[string]interface{}{"type": "date_nanos"},
+					"message":    map[string]interface{}{"type": "text"},
+					"host":       map[string]interface{}{"properties": map[string]interface{}{"name": keyword}},
+					"log": map[string]interface{}{"properties": map[string]interface{}{
+						"level": keyword,
+						"syslog": map[string]interface{}{"properties": map[string]interface{}{
+							"priority": map[string]interface{}{"type": "integer"},
+							"appname":  keyword,
+						}},
+					}},
+					"process": map[string]interface{}{"properties": map[string]interface{}{
+						"pid":  map[string]interface{}{"type": "integer"},
+						"name": keyword,
+					}},
+					"systemd": map[string]interface{}{"properties": map[string]interface{}{"unit": keyword}},
+				},
+			},
+		},
+	}
+}
+
+// installTemplate puts the index template, once. A template rejected by the cluster, for instance by a version
+// older than 7.8, is logged and the indices are created with dynamic mappings.
+func (s *ElasticSink) installTemplate(ctx context.Context) error {
+	if s.template {
+		return nil
+	}
+
+	body, err := json.Marshal(s.elasticTemplate())
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, "PUT", "/_index_template/"+s.index, "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		err := responseError("unable to put elasticsearch index template", resp)
+		if retryableStatus(resp.StatusCode) {
+			return err
+		}
+		logrus.Errorf("%s forwarder: %s", s.Name(), err)
+	}
+
+	s.template = true
+	return nil
+}
+
+func (s *ElasticSink) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	return s.client.Do(req.WithContext(ctx))
+}
+
+// retryableStatus returns true if a request or a document rejected with the status may succeed later.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+func responseError(msg string, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s, status %d: %s", msg, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// elasticBulkResponse is the part of the bulk API response with the result of each action.
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// elasticRejected is a line of the rejected documents file.
+type elasticRejected struct {
+	Time   time.Time       `json:"time"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+	Entry  Entry           `json:"entry"`
+}
+
+// Send indexes the entries. The batch is retried if the cluster or any document is rejected with 429 or 5xx, the
+// documents rejected with other errors, for instance mapping conflicts, are written to the rejected file.
+func (s *ElasticSink) Send(ctx context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.installTemplate(ctx); err != nil {
+		return err
+	}
+
+	body := &bytes.Buffer{}
+	for _, e := range entries {
+		formatter := jr.FormatElasticBulk{Index: s.Index(e)}
+		line, err := formatter.FormatEntry(&sdjournal.JournalEntry{
+			Fields:            e.Fields,
+			Cursor:            e.Cursor,
+			RealtimeTimestamp: uint64(e.Time.UnixNano() / int64(time.Microsecond)),
+		})
+		if err != nil {
+			return Permanent(err)
+		}
+		body.Write(line)
+	}
+
+	resp, err := s.do(ctx, "POST", "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := responseError("elasticsearch bulk request failed", resp)
+		if retryableStatus(resp.StatusCode) {
+			return err
+		}
+		return Permanent(err)
+	}
+
+	var result elasticBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unable to decode elasticsearch bulk response: %s", err)
+	}
+
+	if !result.Errors {
+		return nil
+	}
+
+	if len(result.Items) != len(entries) {
+		return fmt.Errorf("elasticsearch bulk response has %d items, expected %d", len(result.Items), len(entries))
+	}
+
+	var (
+		retry    int
+		rejected []elasticRejected
+	)
+	for i, item := range result.Items {
+		for _, action := range item {
+			switch {
+			case retryableStatus(action.Status):
+				retry++
+			case action.Status >= http.StatusBadRequest:
+				rejected = append(rejected, elasticRejected{
+					Time:   time.Now(),
+					Status: action.Status,
+					Error:  action.Error,
+					Entry:  entries[i],
+				})
+			}
+		}
+	}
+
+	// the whole batch is sent again, the indexed documents are overwritten by their IDs.
+	if retry > 0 {
+		return fmt.Errorf("elasticsearch rejected %d documents, retrying", retry)
+	}
+
+	return s.reject(rejected)
+}
+
+// reject appends the rejected documents to the rejected file.
+func (s *ElasticSink) reject(rejected []elasticRejected) error {
+	if s.rejectedFile == "" {
+		for _, r := range rejected {
+			logrus.Errorf("%s forwarder: document %s rejected with status %d: %s", s.Name(), r.Entry.Cursor, r.Status, r.Error)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.rejectedFile), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.rejectedFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	for _, r := range rejected {
+		if err := encoder.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
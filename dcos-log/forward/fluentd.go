@@ -0,0 +1,179 @@
+package forward
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFluentdTag = "dcos"
+
+	// fluentdTimeout is the timeout of a message and its ack if the context has no deadline.
+	fluentdTimeout = 30 * time.Second
+)
+
+// fluentdTagInvalid matches the characters replaced in the tag parts taken from the entries.
+var fluentdTagInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// fluentdTagFields are the journal fields of the last tag part, the first field found in an entry is used.
+var fluentdTagFields = []string{"_SYSTEMD_UNIT", "UNIT", "SYSLOG_IDENTIFIER"}
+
+// FluentdOption is a functional option that configures a FluentdSink.
+type FluentdOption func(*FluentdSink) error
+
+// OptionFluentdTag sets the tag prefix, the events are tagged <prefix>.<unit> or <prefix>.task for the entries of
+// tasks.
+func OptionFluentdTag(prefix string) FluentdOption {
+	return func(f *FluentdSink) error {
+		if prefix != "" {
+			f.tag = prefix
+		}
+		return nil
+	}
+}
+
+// FluentdSink sends entries to a fluentd or fluent-bit aggregator with the forward protocol. The entries of a batch
+// are sent in Forward mode messages, one per tag, and every message must be acknowledged by the aggregator. The
+// connection is kept open and reconnected after an error.
+// https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+type FluentdSink struct {
+	addr string
+	tag  string
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewFluentdSink returns a new instance of FluentdSink. addr is host:port of the forward input.
+func NewFluentdSink(addr string, opts ...FluentdOption) (*FluentdSink, error) {
+	var dialer net.Dialer
+	f := &FluentdSink{
+		addr: addr,
+		tag:  defaultFluentdTag,
+		dial: dialer.DialContext,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Name returns "fluentd".
+func (f *FluentdSink) Name() string {
+	return "fluentd"
+}
+
+// Tag returns the tag of the entry.
+func (f *FluentdSink) Tag(e Entry) string {
+	if e.Fields["CONTAINER_ID"] != "" {
+		return f.tag + ".task"
+	}
+
+	unit := firstField(e, fluentdTagFields, "unknown")
+	return f.tag + "." + fluentdTagInvalid.ReplaceAllString(unit, "_")
+}
+
+// message encodes the entries as a Forward mode message with the chunk option requesting an ack.
+func (f *FluentdSink) message(tag, chunk string, entries []Entry) []byte {
+	enc := &msgpackEncoder{}
+	enc.arrayHeader(3)
+	enc.string(tag)
+
+	enc.arrayHeader(len(entries))
+	for _, e := range entries {
+		enc.arrayHeader(2)
+		enc.eventTime(e.Time)
+		enc.stringMap(e.Fields)
+	}
+
+	enc.mapHeader(1)
+	enc.string("chunk")
+	enc.string(chunk)
+	return enc.Bytes()
+}
+
+// Send sends the entries and waits for the acks.
+func (f *FluentdSink) Send(ctx context.Context, entries []Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var tags []string
+	byTag := make(map[string][]Entry)
+	for _, e := range entries {
+		tag := f.Tag(e)
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], e)
+	}
+
+	for _, tag := range tags {
+		if err := f.send(ctx, tag, byTag[tag]); err != nil {
+			// the state of the connection is unknown, a new connection is opened for the next message.
+			f.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FluentdSink) send(ctx context.Context, tag string, entries []Entry) error {
+	if f.conn == nil {
+		conn, err := f.dial(ctx, "tcp", f.addr)
+		if err != nil {
+			return err
+		}
+		f.conn, f.reader = conn, bufio.NewReader(conn)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(fluentdTimeout)
+	}
+
+	if err := f.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	chunk := base64.StdEncoding.EncodeToString(id)
+
+	if _, err := f.conn.Write(f.message(tag, chunk, entries)); err != nil {
+		return err
+	}
+
+	resp, err := decodeMsgpack(f.reader)
+	if err != nil {
+		return fmt.Errorf("unable to read fluentd ack: %s", err)
+	}
+
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("unexpected fluentd ack %v", resp)
+	}
+	return nil
+}
+
+func (f *FluentdSink) close() {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn, f.reader = nil, nil
+	}
+}
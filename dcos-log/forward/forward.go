@@ -0,0 +1,420 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/dcos/dcos-log/dcos-log/query"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+
+	// drainTimeout bounds the last flush of a stopped forwarder, the entries which are not sent are read again
+	// from the stored cursor on the next start.
+	drainTimeout = 5 * time.Second
+)
+
+var (
+	// ErrInvalidBatchSize is returned by OptionBatchSize if the size is zero or negative.
+	ErrInvalidBatchSize = errors.New("batch size must be positive")
+
+	// ErrInvalidFlushInterval is returned by OptionFlushInterval if the interval is zero or negative.
+	ErrInvalidFlushInterval = errors.New("flush interval must be positive")
+
+	// ErrInvalidMaxRetries is returned by OptionMaxRetries if the number is negative.
+	ErrInvalidMaxRetries = errors.New("max retries cannot be negative")
+
+	// errBatchFull is returned by the collector to stop reading the journal when a batch is full.
+	errBatchFull = errors.New("batch is full")
+)
+
+var entriesTotal = metrics.NewCounterVec("dcos_log_forward_entries_total",
+	"Journal entries forwarded to remote sinks by sink and status.", "sink", "status")
+
+// Entry is a journal entry passed to a sink.
+type Entry struct {
+	Time   time.Time         `json:"time"`
+	Cursor string            `json:"cursor"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Message returns the MESSAGE field of the entry.
+func (e Entry) Message() string {
+	return e.Fields["MESSAGE"]
+}
+
+// NewEntry converts a journal entry.
+func NewEntry(entry *sdjournal.JournalEntry) Entry {
+	return Entry{
+		// entry.RealtimeTimestamp returns a unix time in microseconds
+		Time:   time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond)),
+		Cursor: entry.Cursor,
+		Fields: entry.Fields,
+	}
+}
+
+// Sink sends batches of entries to a remote system. Send must be safe to retry with the same batch.
+type Sink interface {
+	// Name is a short name of the sink used in metrics, logs and state file names.
+	Name() string
+
+	// Send delivers the entries, the entries are ordered by time.
+	Send(ctx context.Context, entries []Entry) error
+}
+
+// permanentError is returned by a sink if the batch cannot be delivered with retries.
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Permanent wraps an error returned by Sink.Send if retrying the same batch will never succeed, for
+// instance the remote system rejected the data. Such batches are not retried.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Stats is the state of a forwarder exposed in diagnostics.
+type Stats struct {
+	Sink       string    `json:"sink"`
+	Sent       uint64    `json:"sent"`
+	Failed     uint64    `json:"failed"`
+	DeadLetter uint64    `json:"dead_letter"`
+	Cursor     string    `json:"cursor,omitempty"`
+	LastSent   time.Time `json:"last_sent,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Option is a functional option that configures a Forwarder.
+type Option func(*Forwarder) error
+
+// OptionMatches sets journal matches, only the matching entries are forwarded.
+func OptionMatches(matches []jr.JournalEntryMatch) Option {
+	return func(f *Forwarder) error {
+		f.matches = matches
+		return nil
+	}
+}
+
+// OptionQuery sets a query, only the entries matching the query are forwarded. The since: term of the query
+// is ignored.
+func OptionQuery(q *query.Query) Option {
+	return func(f *Forwarder) error {
+		f.query = q
+		return nil
+	}
+}
+
+// OptionBatchSize sets the maximum number of entries sent in a single batch.
+func OptionBatchSize(n int) Option {
+	return func(f *Forwarder) error {
+		if n <= 0 {
+			return ErrInvalidBatchSize
+		}
+		f.batchSize = n
+		return nil
+	}
+}
+
+// OptionFlushInterval sets the maximum time an entry waits in a batch before it's sent.
+func OptionFlushInterval(d time.Duration) Option {
+	return func(f *Forwarder) error {
+		if d <= 0 {
+			return ErrInvalidFlushInterval
+		}
+		f.flushInterval = d
+		return nil
+	}
+}
+
+// OptionMaxRetries sets how many times a batch is retried before it's written to the dead letter dir.
+// Zero value retries forever.
+func OptionMaxRetries(n int) Option {
+	return func(f *Forwarder) error {
+		if n < 0 {
+			return ErrInvalidMaxRetries
+		}
+		f.maxRetries = n
+		return nil
+	}
+}
+
+// OptionDeadLetterDir sets a directory to store the batches which failed to send after max retries.
+// The stored batches are sent again when the forwarder starts. If the dir is not set, such batches
+// are dropped.
+func OptionDeadLetterDir(dir string) Option {
+	return func(f *Forwarder) error {
+		f.deadLetterDir = dir
+		return nil
+	}
+}
+
+// OptionStateFile sets a file to store the cursor of the last forwarded entry. The forwarder resumes
+// from the cursor after restart, otherwise it starts at the end of the journal.
+func OptionStateFile(path string) Option {
+	return func(f *Forwarder) error {
+		f.stateFile = path
+		return nil
+	}
+}
+
+// Forwarder follows the journal and sends the entries to a Sink in batches. A batch which failed to
+// send is retried with exponential backoff until it succeeds, so no entries are lost while the remote
+// system is unavailable.
+type Forwarder struct {
+	sink Sink
+
+	matches       []jr.JournalEntryMatch
+	query         *query.Query
+	batchSize     int
+	flushInterval time.Duration
+	stateFile     string
+	maxRetries    int
+	deadLetterDir string
+
+	batch     []Entry
+	lastFlush time.Time
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewForwarder returns a new instance of Forwarder.
+func NewForwarder(sink Sink, opts ...Option) (*Forwarder, error) {
+	f := &Forwarder{
+		sink:          sink,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		stats:         Stats{Sink: sink.Name()},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Stats returns the forwarder state.
+func (f *Forwarder) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// collector implements journal reader EntryFormatter and collects the entries into a batch instead
+// of formatting them.
+type collector struct {
+	f *Forwarder
+}
+
+func (c collector) GetContentType() jr.ContentType {
+	return jr.ContentTypeApplicationJSON
+}
+
+func (c collector) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	if c.f.query != nil && !c.f.query.Match(entry.Fields) {
+		return nil, nil
+	}
+
+	c.f.batch = append(c.f.batch, NewEntry(entry))
+	if len(c.f.batch) >= c.f.batchSize {
+		return nil, errBatchFull
+	}
+	return nil, nil
+}
+
+func (f *Forwarder) openJournal() (*jr.Reader, error) {
+	var opts []jr.Option
+	if len(f.matches) > 0 {
+		opts = append(opts, jr.OptionMatch(f.matches))
+	}
+
+	cursor := f.readCursor()
+	if cursor != "" {
+		opts = append(opts, jr.OptionSeekCursor(cursor))
+	} else {
+		// start at the last entry, same as cursor=END in the API.
+		opts = append(opts, jr.OptionSkipPrev(1))
+	}
+
+	j, err := jr.NewReader(collector{f: f}, opts...)
+	if err != nil && cursor != "" {
+		// the cursor was rotated away, start from the end of the journal.
+		logrus.Warnf("%s forwarder: unable to seek cursor %s: %s", f.sink.Name(), cursor, err)
+		if j != nil && j.Journal != nil {
+			j.Close()
+		}
+		f.cursor("")
+		return f.openJournal()
+	}
+	return j, err
+}
+
+// Run follows the journal until the context is canceled. A failed forwarder may be run again, the journal is
+// read again from the cursor of the last sent entry.
+func (f *Forwarder) Run(ctx context.Context) error {
+	j, err := f.openJournal()
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	// the entries of the batch of a failed run are read again from the cursor, they would be sent twice.
+	f.batch = f.batch[:0]
+
+	f.replayDeadLetters(ctx)
+
+	f.lastFlush = time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			f.drain()
+			return ctx.Err()
+		default:
+		}
+
+		err := j.Follow(f.flushInterval, ioutil.Discard)
+		if err != nil && err != errBatchFull {
+			return err
+		}
+
+		if len(f.batch) >= f.batchSize || time.Since(f.lastFlush) >= f.flushInterval {
+			if err := f.flush(ctx); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
+}
+
+// drain sends the current batch of a stopped forwarder.
+func (f *Forwarder) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := f.flush(ctx); err != nil {
+		logrus.Errorf("%s forwarder: unable to send %d entries on shutdown: %s", f.sink.Name(), len(f.batch), err)
+	}
+}
+
+// flush sends the current batch, retrying until it succeeds or the context is canceled. If the max
+// retries are set, the batch is written to the dead letter dir after the last retry.
+func (f *Forwarder) flush(ctx context.Context) error {
+	f.lastFlush = time.Now()
+	if len(f.batch) == 0 {
+		return nil
+	}
+
+	status := "sent"
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := f.sink.Send(ctx, f.batch)
+		if err == nil {
+			break
+		}
+
+		entriesTotal.WithLabelValues(f.sink.Name(), "failed").Add(float64(len(f.batch)))
+		f.mu.Lock()
+		f.stats.Failed += uint64(len(f.batch))
+		f.stats.LastError = err.Error()
+		f.mu.Unlock()
+
+		_, permanent := err.(permanentError)
+		if permanent || (f.maxRetries > 0 && attempt > f.maxRetries) {
+			logrus.Errorf("%s forwarder: giving up sending %d entries: %s", f.sink.Name(), len(f.batch), err)
+			status = f.deadLetter(f.batch)
+			break
+		}
+
+		logrus.Errorf("%s forwarder: unable to send %d entries, retry in %s: %s", f.sink.Name(), len(f.batch), delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+
+	last := f.batch[len(f.batch)-1]
+	entriesTotal.WithLabelValues(f.sink.Name(), status).Add(float64(len(f.batch)))
+	if status == "sent" {
+		f.mu.Lock()
+		f.stats.Sent += uint64(len(f.batch))
+		f.stats.LastSent = time.Now()
+		f.mu.Unlock()
+	}
+
+	f.cursor(last.Cursor)
+	f.batch = f.batch[:0]
+	return nil
+}
+
+// readCursor returns the cursor of the last forwarded entry, from the state file if it is set.
+func (f *Forwarder) readCursor() string {
+	if f.stateFile == "" {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.stats.Cursor
+	}
+
+	b, err := ioutil.ReadFile(f.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Errorf("%s forwarder: unable to read state file: %s", f.sink.Name(), err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// cursor updates the last forwarded cursor and stores it in the state file.
+func (f *Forwarder) cursor(c string) {
+	f.mu.Lock()
+	f.stats.Cursor = c
+	f.mu.Unlock()
+
+	if f.stateFile == "" {
+		return
+	}
+
+	// write to a temporary file first, so a crash never leaves a truncated cursor.
+	tmp := f.stateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(f.stateFile), 0755); err != nil {
+		logrus.Errorf("%s forwarder: unable to create state dir: %s", f.sink.Name(), err)
+		return
+	}
+
+	if err := ioutil.WriteFile(tmp, []byte(c), 0644); err != nil {
+		logrus.Errorf("%s forwarder: unable to write state file: %s", f.sink.Name(), err)
+		return
+	}
+
+	if err := os.Rename(tmp, f.stateFile); err != nil {
+		logrus.Errorf("%s forwarder: unable to write state file: %s", f.sink.Name(), err)
+	}
+}
@@ -0,0 +1,1372 @@
+package forward
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/query"
+	"github.com/dcos/dcos-log/dcos-log/syslog"
+	"github.com/dcos/dcos-log/dcos-log/testutil"
+)
+
+type fakeSink struct {
+	fail      int
+	permanent bool
+	batches   [][]Entry
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Send(ctx context.Context, entries []Entry) error {
+	if s.fail > 0 {
+		s.fail--
+		if s.permanent {
+			return Permanent(errors.New("rejected"))
+		}
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, append([]Entry(nil), entries...))
+	return nil
+}
+
+func TestFlushRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state", "fake.cursor")
+	sink := &fakeSink{fail: 1}
+	f, err := NewForwarder(sink, OptionStateFile(stateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.batch = []Entry{{Cursor: "c1"}, {Cursor: "c2"}}
+	if err := f.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 2 || len(f.batch) != 0 {
+		t.Fatalf("expect a single batch of 2 entries. Got %v", sink.batches)
+	}
+
+	stats := f.Stats()
+	if stats.Sent != 2 || stats.Failed != 2 || stats.Cursor != "c2" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if cursor := f.readCursor(); cursor != "c2" {
+		t.Fatalf("expect cursor c2 in state file. Got %s", cursor)
+	}
+}
+
+func TestReadCursorWithoutStateFile(t *testing.T) {
+	f, err := NewForwarder(&fakeSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted run resumes after the last sent entry instead of the end of the journal.
+	f.batch = []Entry{{Cursor: "c1"}}
+	if err := f.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if cursor := f.readCursor(); cursor != "c1" {
+		t.Fatalf("expect cursor c1. Got %q", cursor)
+	}
+}
+
+func TestFlushCanceled(t *testing.T) {
+	f, err := NewForwarder(&fakeSink{fail: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f.batch = []Entry{{Cursor: "c1"}}
+	if err := f.flush(ctx); err != context.Canceled {
+		t.Fatalf("expect context.Canceled. Got %v", err)
+	}
+
+	if len(f.batch) != 1 {
+		t.Fatal("expect the batch to be kept")
+	}
+
+	f.sink = &fakeSink{}
+	f.drain()
+	if len(f.batch) != 0 || f.Stats().Cursor != "c1" {
+		t.Fatalf("expect the batch to be sent on drain. Got %+v", f.Stats())
+	}
+}
+
+func TestNewForwarderOptions(t *testing.T) {
+	if _, err := NewForwarder(&fakeSink{}, OptionBatchSize(0)); err != ErrInvalidBatchSize {
+		t.Fatalf("expect ErrInvalidBatchSize. Got %v", err)
+	}
+
+	if _, err := NewForwarder(&fakeSink{}, OptionFlushInterval(0)); err != ErrInvalidFlushInterval {
+		t.Fatalf("expect ErrInvalidFlushInterval. Got %v", err)
+	}
+
+	if _, err := NewForwarder(&fakeSink{}, OptionMaxRetries(-1)); err != ErrInvalidMaxRetries {
+		t.Fatalf("expect ErrInvalidMaxRetries. Got %v", err)
+	}
+}
+
+func TestFlushDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &fakeSink{fail: 1, permanent: true}
+	f, err := NewForwarder(sink, OptionMaxRetries(5), OptionDeadLetterDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.batch = []Entry{{Cursor: "c1", Fields: map[string]string{"MESSAGE": "one"}}}
+	if err := f.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := f.Stats()
+	if len(sink.batches) != 0 || stats.DeadLetter != 1 || stats.Cursor != "c1" {
+		t.Fatalf("expect the batch in dead letter dir. Got %+v", stats)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+deadLetterSuffix))
+	if len(files) != 1 {
+		t.Fatalf("expect a dead letter file. Got %v", files)
+	}
+
+	f.replayDeadLetters(context.Background())
+	if len(sink.batches) != 1 || sink.batches[0][0].Message() != "one" {
+		t.Fatalf("expect the dead letter to be replayed. Got %v", sink.batches)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Fatalf("expect dead letter dir to be empty. Got %v", files)
+	}
+}
+
+func TestFlushDropped(t *testing.T) {
+	sink := &fakeSink{fail: 1, permanent: true}
+	f, err := NewForwarder(sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.batch = []Entry{{Cursor: "c1"}}
+	if err := f.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := f.Stats(); stats.DeadLetter != 0 || stats.Cursor != "c1" || len(f.batch) != 0 {
+		t.Fatalf("expect the batch to be dropped. Got %+v", stats)
+	}
+}
+
+func TestLokiSink(t *testing.T) {
+	var push lokiPushRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Errorf("expect tenant header. Got %v", r.Header)
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := json.NewDecoder(gz).Decode(&push); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	sink, err := NewLokiSink(http.DefaultClient, ts.URL, OptionLokiTenant("tenant"),
+		OptionLokiLabels(map[string]string{"cluster": "prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 1500000000000000000)
+	entries := []Entry{
+		{Time: now, Fields: map[string]string{"MESSAGE": "one", "_SYSTEMD_UNIT": "dcos-mesos-slave.service", "_HOSTNAME": "agent1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "two", "FRAMEWORK_ID": "fw", "EXECUTOR_ID": "task1", "_HOSTNAME": "agent1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "three", "UNIT": "dcos-mesos-slave.service", "_HOSTNAME": "agent1"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(push.Streams) != 2 {
+		t.Fatalf("expect 2 streams. Got %+v", push.Streams)
+	}
+
+	unit := push.Streams[0]
+	if unit.Stream["unit"] != "dcos-mesos-slave.service" || unit.Stream["host"] != "agent1" || unit.Stream["cluster"] != "prod" {
+		t.Fatalf("unexpected labels %v", unit.Stream)
+	}
+
+	if len(unit.Values) != 2 || unit.Values[0][0] != "1500000000000000000" || unit.Values[1][1] != "three" {
+		t.Fatalf("unexpected values %v", unit.Values)
+	}
+
+	task := push.Streams[1]
+	if task.Stream["framework"] != "fw" || task.Stream["task"] != "task1" {
+		t.Fatalf("unexpected labels %v", task.Stream)
+	}
+}
+
+func TestLokiSinkOrder(t *testing.T) {
+	var push lokiPushRequest
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		push = lokiPushRequest{}
+		if err := json.NewDecoder(gz).Decode(&push); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	sink, err := NewLokiSink(http.DefaultClient, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[string]string{"_SYSTEMD_UNIT": "dcos-mesos-slave.service"}
+	entries := []Entry{{Time: time.Unix(0, 300), Fields: fields}, {Time: time.Unix(0, 100), Fields: fields}}
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if values := push.Streams[0].Values; values[0][0] != "100" || values[1][0] != "300" {
+		t.Fatalf("expect the values ordered by time. Got %v", values)
+	}
+
+	// an entry older than the last sent one is sent with its timestamp.
+	if err := sink.Send(context.Background(), []Entry{{Time: time.Unix(0, 200), Fields: fields}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if values := push.Streams[0].Values; values[0][0] != "300" {
+		t.Fatalf("expect the timestamp of the last entry. Got %v", values)
+	}
+
+	status = http.StatusBadRequest
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); !ok {
+		t.Fatalf("expect a permanent error. Got %v", err)
+	}
+}
+
+func TestLokiSinkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	sink, err := NewLokiSink(http.DefaultClient, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Send(context.Background(), []Entry{{Time: time.Now()}}); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestSplunkSink(t *testing.T) {
+	var events []splunkEvent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Splunk token" {
+			t.Errorf("expect token header. Got %v", r.Header)
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		for decoder.More() {
+			var e splunkEvent
+			if err := decoder.Decode(&e); err != nil {
+				t.Error(err)
+				return
+			}
+			events = append(events, e)
+		}
+	}))
+	defer ts.Close()
+
+	sink, err := NewSplunkSink(http.DefaultClient, ts.URL, "token", OptionSplunkIndex("main", "SPLUNK_INDEX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 500000000)
+	entries := []Entry{
+		{Time: now, Fields: map[string]string{"MESSAGE": "one", "_SYSTEMD_UNIT": "dcos-mesos-slave.service", "_HOSTNAME": "agent1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "two", "SYSLOG_IDENTIFIER": "app", "SPLUNK_INDEX": "apps", "FRAMEWORK_ID": "fw"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expect 2 events. Got %+v", events)
+	}
+
+	unit := events[0]
+	if unit.Time != 1500000000.5 || unit.Host != "agent1" || unit.Source != "dcos-mesos-slave.service" ||
+		unit.Index != "main" || unit.Sourcetype != "journald" || unit.Event != "one" || unit.Fields["unit"] != "dcos-mesos-slave.service" {
+		t.Fatalf("unexpected event %+v", unit)
+	}
+
+	app := events[1]
+	if app.Source != "app" || app.Index != "apps" || app.Fields["framework_id"] != "fw" {
+		t.Fatalf("unexpected event %+v", app)
+	}
+}
+
+func TestSplunkSinkError(t *testing.T) {
+	status := http.StatusBadRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"text":"Incorrect index","code":7}`, status)
+	}))
+	defer ts.Close()
+
+	sink, err := NewSplunkSink(http.DefaultClient, ts.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sink.Send(context.Background(), []Entry{{Time: time.Now()}})
+	if _, ok := err.(permanentError); !ok {
+		t.Fatalf("expect permanent error. Got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	err = sink.Send(context.Background(), []Entry{{Time: time.Now()}})
+	if _, ok := err.(permanentError); ok || err == nil {
+		t.Fatalf("expect retryable error. Got %v", err)
+	}
+}
+
+// fakeKafka is a broker answering metadata requests with 2 partitions per topic led by itself and recording the
+// values of produced records by topic.
+type fakeKafka struct {
+	ln        net.Listener
+	errorCode int16
+
+	mu     sync.Mutex
+	values map[string][]string
+	keys   map[string]map[int32]string
+}
+
+func newFakeKafka(t *testing.T) *fakeKafka {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &fakeKafka{ln: ln, values: make(map[string][]string), keys: make(map[string]map[int32]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go k.serve(t, conn)
+		}
+	}()
+	return k
+}
+
+func (k *fakeKafka) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		d := &kafkaDecoder{b: req}
+		apiKey, _, correlationID := d.int16(), d.int16(), d.int32()
+		d.string() // client_id
+
+		resp := &kafkaEncoder{}
+		resp.int32(correlationID)
+		switch apiKey {
+		case kafkaAPIMetadata:
+			k.metadata(d, resp)
+		case kafkaAPIProduce:
+			k.produce(t, d, resp)
+		}
+
+		msg := &kafkaEncoder{}
+		msg.int32(int32(resp.Len()))
+		msg.Write(resp.Bytes())
+		if _, err := conn.Write(msg.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func (k *fakeKafka) metadata(d *kafkaDecoder, resp *kafkaEncoder) {
+	host, port, _ := net.SplitHostPort(k.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	resp.int32(0) // throttle_time_ms
+	resp.int32(1)
+	resp.int32(1)
+	resp.string(host)
+	resp.int32(int32(p))
+	resp.int16(-1) // rack
+	resp.int16(-1) // cluster_id
+	resp.int32(1)  // controller_id
+
+	n := d.int32()
+	resp.int32(n)
+	for ; n > 0; n-- {
+		resp.int16(0)
+		resp.string(d.string())
+		resp.int8(0)
+		resp.int32(2)
+		for id := int32(0); id < 2; id++ {
+			resp.int16(0)
+			resp.int32(id)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int32(0)
+		}
+	}
+}
+
+func (k *fakeKafka) produce(t *testing.T, d *kafkaDecoder, resp *kafkaEncoder) {
+	d.string() // transactional_id
+	d.int16()  // acks
+	d.int32()  // timeout_ms
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	n := d.int32()
+	resp.int32(n)
+	for ; n > 0; n-- {
+		topic := d.string()
+		resp.string(topic)
+
+		p := d.int32()
+		resp.int32(p)
+		for ; p > 0; p-- {
+			partition := d.int32()
+			batch := &kafkaDecoder{b: d.next(int(d.int32()))}
+			batch.int64() // base_offset
+			batch.int32() // batch_length
+			batch.int32() // partition_leader_epoch
+			if magic := batch.int8(); magic != 2 {
+				t.Errorf("expect magic 2. Got %d", magic)
+			}
+
+			if crc := uint32(batch.int32()); crc != crc32.Checksum(batch.b, castagnoli) {
+				t.Errorf("invalid record batch checksum %d", crc)
+			}
+
+			batch.next(2 + 4 + 8 + 8 + 8 + 2 + 4) // attributes to base_sequence
+			for records := batch.int32(); records > 0; records-- {
+				varint := func() int64 {
+					v, size := binary.Varint(batch.b)
+					batch.next(size)
+					return v
+				}
+
+				varint() // length
+				batch.int8()
+				varint() // timestamp_delta
+				varint() // offset_delta
+				if key := varint(); key >= 0 {
+					if k.keys[topic] == nil {
+						k.keys[topic] = make(map[int32]string)
+					}
+					k.keys[topic][partition] = string(batch.next(int(key)))
+				}
+				k.values[topic] = append(k.values[topic], string(batch.next(int(varint()))))
+				varint() // headers
+			}
+
+			resp.int32(partition)
+			resp.int16(k.errorCode)
+			resp.int64(0)
+			resp.int64(-1)
+		}
+	}
+	resp.int32(0) // throttle_time_ms
+}
+
+func TestKafkaSink(t *testing.T) {
+	broker := newFakeKafka(t)
+	defer broker.ln.Close()
+
+	sink, err := NewKafkaSink([]string{"127.0.0.1:1", broker.ln.Addr().String()}, OptionKafkaTopic("dcos-{unit}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	entries := []Entry{
+		{Time: now, Cursor: "c1", Fields: map[string]string{"MESSAGE": "one", "_SYSTEMD_UNIT": "dcos-mesos-slave.service"}},
+		{Time: now, Cursor: "c2", Fields: map[string]string{"MESSAGE": "two", "_SYSTEMD_UNIT": "dcos-mesos-slave.service"}},
+		{Time: now, Cursor: "c3", Fields: map[string]string{"MESSAGE": "three", "SYSLOG_IDENTIFIER": "a b"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	values := broker.values["dcos-dcos-mesos-slave.service"]
+	if len(values) != 2 {
+		t.Fatalf("expect 2 records in the unit topic. Got %v", broker.values)
+	}
+
+	var e Entry
+	if err := json.Unmarshal([]byte(values[1]), &e); err != nil || e.Cursor != "c2" || e.Message() != "two" {
+		t.Fatalf("expect the second entry. Got %s, %v", values[1], err)
+	}
+
+	if len(broker.values["dcos-a_b"]) != 1 || len(broker.keys["dcos-a_b"]) != 1 {
+		t.Fatalf("expect a keyed record in the identifier topic. Got %v", broker.values)
+	}
+
+	broker.errorCode = 10
+	broker.mu.Unlock()
+	err = sink.Send(context.Background(), entries[:1])
+	broker.mu.Lock()
+	if _, ok := err.(permanentError); !ok {
+		t.Fatalf("expect a permanent error. Got %v", err)
+	}
+}
+
+func TestKafkaOptions(t *testing.T) {
+	if _, err := NewKafkaSink(nil); err != ErrNoKafkaBrokers {
+		t.Fatalf("expect no brokers error. Got %v", err)
+	}
+
+	if _, err := NewKafkaSink([]string{"kafka:9092"}, OptionKafkaTopic("{task}")); err == nil {
+		t.Fatal("expect unknown placeholder error")
+	}
+
+	if _, err := NewKafkaSink([]string{"kafka:9092"}, OptionKafkaEncoding("xml")); err == nil {
+		t.Fatal("expect unknown encoding error")
+	}
+
+	sink, err := NewKafkaSink([]string{"kafka:9092"}, OptionKafkaTopic("logs-{framework}-{host}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topic := sink.Topic(Entry{Fields: map[string]string{"FRAMEWORK_ID": "fw/1"}}); topic != "logs-fw_1-unknown" {
+		t.Fatalf("expect logs-fw_1-unknown. Got %s", topic)
+	}
+}
+
+func TestAvroEntry(t *testing.T) {
+	e := Entry{Time: time.Unix(0, 1000), Cursor: "c", Fields: map[string]string{"A": "b"}}
+	expected := []byte{2, 2, 'c', 2, 2, 'A', 2, 'b', 0}
+	if b := avroEntry(e); string(b) != string(expected) {
+		t.Fatalf("expect %v. Got %v", expected, b)
+	}
+}
+
+// fakeFluentd is a forward input acknowledging the messages and recording their tags and records. The first
+// connection is closed after two messages to test reconnects.
+func TestSandboxForwarder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu    sync.Mutex
+		state = agent.State{ID: "agent", Hostname: "agent-1", Frameworks: []agent.Framework{{
+			ID:        "framework",
+			Executors: []agent.Executor{{ID: "executor", Container: "container", Tasks: []agent.Task{{ID: "executor"}}}},
+		}}}
+	)
+
+	files := testutil.NewFakeFiles()
+	stdout := testutil.SandboxPath("agent", "framework", "executor", "container", "") + "/stdout"
+	files.Write(stdout, []byte("before start\n"))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/state" {
+			mu.Lock()
+			defer mu.Unlock()
+			json.NewEncoder(w).Encode(state)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	agentURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateFile := filepath.Join(dir, "fake-sandbox.cursors")
+	newForwarder := func(sink Sink) *SandboxForwarder {
+		s, err := NewSandboxForwarder(sink, http.DefaultClient, *agentURL, OptionSandboxFiles("stdout"),
+			OptionSandboxStateFile(stateFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.followed = make(map[string]*sandboxFile)
+		s.cursors = s.readCursors()
+		return s
+	}
+
+	ctx := context.Background()
+	sink := &fakeSink{}
+	s := newForwarder(sink)
+	if err := s.updateFiles(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	files.Append(stdout, []byte("first\nsecond\npart"))
+	for _, f := range s.followed {
+		if err := s.forwardFile(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 2 {
+		t.Fatalf("expect a batch of the 2 new lines. Got %v", sink.batches)
+	}
+
+	first := sink.batches[0][0]
+	if first.Message() != "first" || first.Fields["FRAMEWORK_ID"] != "framework" || first.Fields["CONTAINER_ID"] != "container" ||
+		first.Fields["AGENT_ID"] != "agent" || first.Fields["_HOSTNAME"] != "agent-1" || first.Fields["FILE"] != "stdout" {
+		t.Fatalf("unexpected entry %v", first)
+	}
+
+	if sink.batches[0][1].Message() != "second" || first.Cursor == "" {
+		t.Fatalf("unexpected entries %v", sink.batches[0])
+	}
+
+	// a new forwarder resumes from the stored cursor.
+	files.Append(stdout, []byte("ial\n"))
+	sink = &fakeSink{}
+	s = newForwarder(sink)
+	if err := s.updateFiles(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range s.followed {
+		if err := s.forwardFile(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 1 || sink.batches[0][0].Message() != "partial" {
+		t.Fatalf("expect the line after the stored cursor. Got %v", sink.batches)
+	}
+
+	mu.Lock()
+	state.Frameworks[0].Executors = nil
+	mu.Unlock()
+
+	if err := s.updateFiles(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range s.followed {
+		if !f.done {
+			t.Fatalf("expect the file of a terminated executor to be done")
+		}
+	}
+}
+
+type fakeFluentd struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    int
+	tags     []string
+	messages [][]interface{}
+}
+
+func newFakeFluentd(t *testing.T) *fakeFluentd {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeFluentd{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			f.mu.Lock()
+			f.conns++
+			limit := 0
+			if f.conns == 1 {
+				limit = 2
+			}
+			f.mu.Unlock()
+			go f.serve(t, conn, limit)
+		}
+	}()
+	return f
+}
+
+func (f *fakeFluentd) serve(t *testing.T, conn net.Conn, limit int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for n := 1; ; n++ {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			return
+		}
+
+		msg, ok := v.([]interface{})
+		if !ok || len(msg) != 3 {
+			t.Errorf("expect a forward mode message. Got %v", v)
+			return
+		}
+
+		f.mu.Lock()
+		f.tags = append(f.tags, msg[0].(string))
+		f.messages = append(f.messages, msg[1].([]interface{}))
+		f.mu.Unlock()
+
+		ack := &msgpackEncoder{}
+		ack.stringMap(map[string]string{"ack": msg[2].(map[string]interface{})["chunk"].(string)})
+		conn.Write(ack.Bytes())
+		if n == limit {
+			return
+		}
+	}
+}
+
+func TestFluentdSink(t *testing.T) {
+	aggregator := newFakeFluentd(t)
+	defer aggregator.ln.Close()
+
+	sink, err := NewFluentdSink(aggregator.ln.Addr().String(), OptionFluentdTag("dcos.node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 5)
+	entries := []Entry{
+		{Time: now, Fields: map[string]string{"MESSAGE": "one", "_SYSTEMD_UNIT": "dcos-mesos-slave.service"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "two", "CONTAINER_ID": "c1"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first connection is closed, the next batch fails and the one after it is sent on a new connection.
+	for i := 0; i < 2; i++ {
+		if err = sink.Send(context.Background(), entries[:1]); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator.mu.Lock()
+	defer aggregator.mu.Unlock()
+
+	if len(aggregator.tags) < 3 || aggregator.tags[0] != "dcos.node.dcos-mesos-slave_service" ||
+		aggregator.tags[1] != "dcos.node.task" {
+		t.Fatalf("expect unit and task tags. Got %v", aggregator.tags)
+	}
+
+	event := aggregator.messages[0][0].([]interface{})
+	expected := msgpackExt{Type: 0, Data: []byte{0x59, 0x68, 0x2f, 0x00, 0, 0, 0, 5}}
+	if !reflect.DeepEqual(event[0], expected) || event[1].(map[string]interface{})["MESSAGE"] != "one" {
+		t.Fatalf("expect the event time and the record. Got %v", event)
+	}
+
+	if aggregator.conns != 2 {
+		t.Fatalf("expect a reconnect. Got %d connections", aggregator.conns)
+	}
+}
+
+func TestElasticSink(t *testing.T) {
+	var (
+		templates  []string
+		indices    []string
+		itemStatus = []int{http.StatusTooManyRequests, http.StatusCreated}
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/_index_template/logs":
+			templates = append(templates, r.URL.Path)
+		case r.Method == "POST" && r.URL.Path == "/_bulk":
+			indices = indices[:0]
+			scanner := bufio.NewScanner(r.Body)
+			for i := 0; scanner.Scan(); i++ {
+				var action map[string]struct {
+					Index string `json:"_index"`
+					ID    string `json:"_id"`
+				}
+				if i%2 == 0 {
+					if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+						t.Error(err)
+					}
+					indices = append(indices, action["index"].Index+"/"+action["index"].ID)
+				}
+			}
+
+			var items []interface{}
+			for _, status := range itemStatus {
+				item := map[string]interface{}{"status": status}
+				if status >= http.StatusBadRequest {
+					item["error"] = map[string]string{"type": "mapper_parsing_exception"}
+				}
+				items = append(items, map[string]interface{}{"index": item})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": true, "items": items})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "elastic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rejectedFile := filepath.Join(dir, "rejected.jsonl")
+	sink, err := NewElasticSink(http.DefaultClient, ts.URL+"/", OptionElasticIndex("logs"), OptionElasticRejectedFile(rejectedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{
+		{Time: time.Date(2017, 7, 14, 23, 59, 0, 0, time.UTC), Cursor: "c1", Fields: map[string]string{"MESSAGE": "one"}},
+		{Time: time.Date(2017, 7, 15, 0, 1, 0, 0, time.UTC), Cursor: "c2", Fields: map[string]string{"MESSAGE": "two"}},
+	}
+
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); ok || err == nil {
+		t.Fatalf("expect retryable error. Got %v", err)
+	}
+
+	if _, err := os.Stat(rejectedFile); !os.IsNotExist(err) {
+		t.Fatalf("expect no rejected file before the retry. Got %v", err)
+	}
+
+	itemStatus = []int{http.StatusBadRequest, http.StatusCreated}
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templates) != 1 {
+		t.Fatalf("expect the template to be installed once. Got %v", templates)
+	}
+
+	expect := []string{"logs-2017.07.14/c1", "logs-2017.07.15/c2"}
+	if !reflect.DeepEqual(indices, expect) {
+		t.Fatalf("expect %v. Got %v", expect, indices)
+	}
+
+	body, err := ioutil.ReadFile(rejectedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejected elasticRejected
+	if err := json.Unmarshal(body, &rejected); err != nil {
+		t.Fatal(err)
+	}
+
+	if rejected.Status != http.StatusBadRequest || rejected.Entry.Cursor != "c1" {
+		t.Fatalf("unexpected rejected document %s", body)
+	}
+}
+
+func TestElasticSinkError(t *testing.T) {
+	status := http.StatusBadRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_bulk" {
+			http.Error(w, `{"error":"invalid"}`, status)
+		}
+	}))
+	defer ts.Close()
+
+	sink, err := NewElasticSink(http.DefaultClient, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sink.Send(context.Background(), []Entry{{Time: time.Now()}})
+	if _, ok := err.(permanentError); !ok {
+		t.Fatalf("expect permanent error. Got %v", err)
+	}
+
+	status = http.StatusTooManyRequests
+	err = sink.Send(context.Background(), []Entry{{Time: time.Now()}})
+	if _, ok := err.(permanentError); ok || err == nil {
+		t.Fatalf("expect retryable error. Got %v", err)
+	}
+
+	if _, err := NewElasticSink(http.DefaultClient, ts.URL, OptionElasticIndex("Logs")); err == nil {
+		t.Fatal("expect an error for an upper case index prefix")
+	}
+}
+
+func TestCollectorQuery(t *testing.T) {
+	q, err := query.Parse("unit:dcos-marathon.service priority<=warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewForwarder(&fakeSink{}, OptionQuery(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fields := range []map[string]string{
+		{"_SYSTEMD_UNIT": "dcos-marathon.service", "PRIORITY": "3", "MESSAGE": "error"},
+		{"_SYSTEMD_UNIT": "dcos-marathon.service", "PRIORITY": "6", "MESSAGE": "info"},
+		{"_SYSTEMD_UNIT": "dcos-mesos-master.service", "PRIORITY": "3", "MESSAGE": "other"},
+	} {
+		if _, err := (collector{f: f}).FormatEntry(&sdjournal.JournalEntry{Fields: fields}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(f.batch) != 1 || f.batch[0].Message() != "error" {
+		t.Fatalf("expect only the matching entry. Got %+v", f.batch)
+	}
+}
+
+func TestSyslogMessage(t *testing.T) {
+	sink, err := NewSyslogSink(SyslogUDP, "127.0.0.1:514")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Entry{
+		Time: time.Date(2017, 7, 14, 2, 40, 0, 500000000, time.UTC),
+		Fields: map[string]string{
+			"MESSAGE":           "connection refused",
+			"PRIORITY":          "3",
+			"SYSLOG_FACILITY":   "3",
+			"SYSLOG_IDENTIFIER": "marathon",
+			"_HOSTNAME":         "master 1",
+			"_PID":              "42",
+			"_SYSTEMD_UNIT":     "dcos-marathon.service",
+			"FRAMEWORK_ID":      `fw"1]`,
+		},
+	}
+
+	expect := `<27>1 2017-07-14T02:40:00.500000Z master_1 marathon 42 - ` +
+		`[dcos@32473 framework_id="fw\"1\]" unit="dcos-marathon.service"] connection refused`
+	if msg := string(sink.Message(e)); msg != expect {
+		t.Fatalf("expect %s. Got %s", expect, msg)
+	}
+
+	m, err := syslog.Parse(sink.Message(e), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Format != syslog.FormatRFC5424 || m.AppName != "marathon" || m.StructuredData["dcos@32473.framework_id"] != `fw"1]` ||
+		m.Message != "connection refused" {
+		t.Fatalf("unexpected parsed message %+v", m)
+	}
+
+	if _, err := NewSyslogSink("sctp", "127.0.0.1:514"); err == nil {
+		t.Fatal("expect an error for an unknown transport")
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	frames := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+
+			n, err := strconv.Atoi(size[:len(size)-1])
+			if err != nil {
+				t.Errorf("invalid frame size %q", size)
+				return
+			}
+
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			frames <- string(b)
+		}
+	}()
+
+	sink, err := NewSyslogSink(SyslogTCP, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{
+		{Time: time.Now(), Fields: map[string]string{"MESSAGE": "one\ntwo"}},
+		{Time: time.Now(), Fields: map[string]string{"MESSAGE": "three"}},
+	}
+
+	go func() {
+		if err := sink.Send(context.Background(), entries); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for _, expect := range []string{"one\ntwo", "three"} {
+		m, err := syslog.Parse([]byte(<-frames), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Message != expect || m.Severity != 6 || m.Facility != 1 {
+			t.Fatalf("expect %s. Got %+v", expect, m)
+		}
+	}
+}
+
+func TestOTLPSink(t *testing.T) {
+	var export otlpExportRequest
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expect the authorization header. Got %v", r.Header)
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		export = otlpExportRequest{}
+		if err := json.NewDecoder(gz).Decode(&export); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	sink, err := NewOTLPSink(http.DefaultClient, ts.URL, OptionOTLPAttributes(map[string]string{"dcos.cluster": "prod"}),
+		OptionOTLPHeaders(map[string]string{"Authorization": "Bearer secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 1500000000000000000)
+	entries := []Entry{
+		{Time: now, Fields: map[string]string{"MESSAGE": "one", "PRIORITY": "3", "_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME": "agent1", "__CURSOR": "s=1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "two", "FRAMEWORK_ID": "fw", "EXECUTOR_ID": "task1", "_HOSTNAME": "agent1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "three", "PRIORITY": "6", "UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME": "agent1"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(export.ResourceLogs) != 2 {
+		t.Fatalf("expect 2 resources. Got %+v", export.ResourceLogs)
+	}
+
+	unit := export.ResourceLogs[0]
+	expect := []otlpKeyValue{
+		{Key: "dcos.cluster", Value: otlpValue{StringValue: "prod"}},
+		{Key: "host.name", Value: otlpValue{StringValue: "agent1"}},
+		{Key: "service.name", Value: otlpValue{StringValue: "dcos-mesos-slave.service"}},
+	}
+	if !reflect.DeepEqual(unit.Resource.Attributes, expect) {
+		t.Fatalf("expect resource %v. Got %v", expect, unit.Resource.Attributes)
+	}
+
+	records := unit.ScopeLogs[0].LogRecords
+	if len(records) != 2 || records[0].Body.StringValue != "one" || records[0].TimeUnixNano != "1500000000000000000" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	if records[0].SeverityNumber != 17 || records[0].SeverityText != "ERR" || records[1].SeverityNumber != 9 {
+		t.Fatalf("unexpected severities %+v", records)
+	}
+
+	if attributes := records[0].Attributes; len(attributes) != 2 || attributes[0].Key != "_HOSTNAME" ||
+		attributes[1].Key != "_SYSTEMD_UNIT" {
+		t.Fatalf("expect the fields except MESSAGE, PRIORITY and __CURSOR. Got %v", attributes)
+	}
+
+	task := map[string]string{}
+	for _, kv := range export.ResourceLogs[1].Resource.Attributes {
+		task[kv.Key] = kv.Value.StringValue
+	}
+	if task["dcos.framework.id"] != "fw" || task["dcos.executor.id"] != "task1" || task["service.name"] != "dcos-log" {
+		t.Fatalf("unexpected task resource %v", task)
+	}
+
+	status = http.StatusBadRequest
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); !ok {
+		t.Fatalf("expect a permanent error. Got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); ok || err == nil {
+		t.Fatalf("expect a retryable error. Got %v", err)
+	}
+}
+
+// protoField is a field of a protobuf message, the length-delimited fields have bytes and the others a value.
+type protoField struct {
+	num   uint64
+	value uint64
+	bytes []byte
+}
+
+func protoFields(t *testing.T, b []byte) []protoField {
+	var fields []protoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid tag %v", b)
+		}
+		b = b[n:]
+
+		f := protoField{num: tag >> 3}
+		switch tag & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// decodeOTLPRequest decodes the fields of an ExportLogsServiceRequest written by encodeOTLPRequest.
+func decodeOTLPRequest(t *testing.T, b []byte) *otlpExportRequest {
+	keyValue := func(b []byte) otlpKeyValue {
+		var kv otlpKeyValue
+		for _, f := range protoFields(t, b) {
+			switch f.num {
+			case 1:
+				kv.Key = string(f.bytes)
+			case 2:
+				kv.Value.StringValue = string(protoFields(t, f.bytes)[0].bytes)
+			}
+		}
+		return kv
+	}
+
+	req := &otlpExportRequest{}
+	for _, rl := range protoFields(t, b) {
+		logs := &otlpResourceLogs{}
+		for _, f := range protoFields(t, rl.bytes) {
+			if f.num == 1 {
+				for _, attr := range protoFields(t, f.bytes) {
+					logs.Resource.Attributes = append(logs.Resource.Attributes, keyValue(attr.bytes))
+				}
+				continue
+			}
+
+			var scopeLogs otlpScopeLogs
+			for _, sf := range protoFields(t, f.bytes) {
+				if sf.num == 1 {
+					scopeLogs.Scope.Name = string(protoFields(t, sf.bytes)[0].bytes)
+					continue
+				}
+
+				var r otlpLogRecord
+				for _, rf := range protoFields(t, sf.bytes) {
+					switch rf.num {
+					case 1:
+						r.TimeUnixNano = strconv.FormatUint(rf.value, 10)
+					case 2:
+						r.SeverityNumber = int(rf.value)
+					case 3:
+						r.SeverityText = string(rf.bytes)
+					case 5:
+						r.Body.StringValue = string(protoFields(t, rf.bytes)[0].bytes)
+					case 6:
+						r.Attributes = append(r.Attributes, keyValue(rf.bytes))
+					case 11:
+						r.ObservedTimeUnixNano = strconv.FormatUint(rf.value, 10)
+					}
+				}
+				scopeLogs.LogRecords = append(scopeLogs.LogRecords, r)
+			}
+			logs.ScopeLogs = append(logs.ScopeLogs, scopeLogs)
+		}
+		req.ResourceLogs = append(req.ResourceLogs, logs)
+	}
+	return req
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	var export *otlpExportRequest
+	code := "0"
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != otlpGRPCMethod || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("expect a gRPC call of %s. Got %s %s %v", otlpGRPCMethod, r.Proto, r.URL.Path, r.Header)
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expect the authorization header. Got %v", r.Header)
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("expect a length-prefixed message. Got %v, %v", body, err)
+			return
+		}
+		export = decodeOTLPRequest(t, body[5:])
+
+		w.Header().Set("Content-Type", "application/grpc")
+		if code != "0" {
+			// a trailers-only response of a failed call.
+			w.Header().Set("Grpc-Status", code)
+			w.Header().Set("Grpc-Message", "invalid%20request")
+			return
+		}
+
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", code)
+	}))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	sink, err := NewOTLPSink(&http.Client{}, ts.URL+"/", OptionOTLPAttributes(map[string]string{"dcos.cluster": "prod"}),
+		OptionOTLPHeaders(map[string]string{"Authorization": "Bearer secret"}), OptionOTLPProtocol(OTLPProtocolGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 1500000000000000000)
+	entries := []Entry{
+		{Time: now, Fields: map[string]string{"MESSAGE": "one", "PRIORITY": "3", "_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME": "agent1", "__CURSOR": "s=1"}},
+		{Time: now, Fields: map[string]string{"MESSAGE": "", "FRAMEWORK_ID": "fw", "EXECUTOR_ID": "task1", "_HOSTNAME": "agent1"}},
+	}
+
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if export == nil || len(export.ResourceLogs) != 2 {
+		t.Fatalf("expect 2 resources. Got %+v", export)
+	}
+
+	observed, err := strconv.ParseInt(export.ResourceLogs[0].ScopeLogs[0].LogRecords[0].ObservedTimeUnixNano, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := sink.exportRequest(entries, time.Unix(0, observed)); !reflect.DeepEqual(export, expect) {
+		t.Fatalf("expect the export request %+v. Got %+v", expect, export)
+	}
+
+	code = "3"
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); !ok || err.Error() != "otlp export failed with grpc status 3: invalid request" {
+		t.Fatalf("expect a permanent error. Got %v", err)
+	}
+
+	code = "14"
+	err = sink.Send(context.Background(), entries)
+	if _, ok := err.(permanentError); ok || err == nil {
+		t.Fatalf("expect a retryable error. Got %v", err)
+	}
+
+	if _, err := NewOTLPSink(http.DefaultClient, ts.URL, OptionOTLPProtocol("http/protobuf")); err == nil {
+		t.Fatal("expect an unknown protocol error")
+	}
+}
@@ -0,0 +1,297 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// KafkaEncodingJSON encodes the entries as JSON objects with time, cursor and fields.
+	KafkaEncodingJSON = "json"
+
+	// KafkaEncodingAvro encodes the entries as Avro binary data of KafkaAvroSchema.
+	KafkaEncodingAvro = "avro"
+
+	defaultKafkaTopic = "dcos-logs"
+
+	// kafkaMaxBatchBytes is the size of the records sent in one produce request, below the 1MB default
+	// message.max.bytes of the brokers.
+	kafkaMaxBatchBytes = 512 << 10
+)
+
+// KafkaAvroSchema is the Avro schema of the entries encoded with KafkaEncodingAvro.
+const KafkaAvroSchema = `{
+  "type": "record",
+  "name": "JournalEntry",
+  "namespace": "com.mesosphere.dcos.log",
+  "fields": [
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "cursor", "type": "string"},
+    {"name": "fields", "type": {"type": "map", "values": "string"}}
+  ]
+}`
+
+var (
+	// ErrNoKafkaBrokers is returned by NewKafkaSink if no broker is given.
+	ErrNoKafkaBrokers = errors.New("at least one kafka broker is required")
+
+	// kafkaTopicPlaceholder matches the placeholders of a topic template.
+	kafkaTopicPlaceholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+	// kafkaTopicInvalid matches the characters not allowed in Kafka topic names.
+	kafkaTopicInvalid = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+)
+
+// kafkaTopicFields maps the placeholders of a topic template to the journal fields they are replaced with, the
+// first field found in an entry is used.
+var kafkaTopicFields = map[string][]string{
+	"{unit}":      {"_SYSTEMD_UNIT", "UNIT", "SYSLOG_IDENTIFIER"},
+	"{framework}": {"FRAMEWORK_ID"},
+	"{host}":      {"_HOSTNAME"},
+}
+
+// kafkaKeyFields are the fields of the record key, the entries of a task or a unit go to the same partition and
+// stay in order.
+var kafkaKeyFields = []string{"CONTAINER_ID", "_SYSTEMD_UNIT", "SYSLOG_IDENTIFIER"}
+
+// KafkaOption is a functional option that configures a KafkaSink.
+type KafkaOption func(*KafkaSink) error
+
+// OptionKafkaTopic sets the topic template. {unit}, {framework} and {host} placeholders are replaced with the
+// fields of an entry, unknown if an entry has no such field. The characters not allowed in topic names are
+// replaced with _.
+func OptionKafkaTopic(template string) KafkaOption {
+	return func(k *KafkaSink) error {
+		for _, placeholder := range kafkaTopicPlaceholder.FindAllString(template, -1) {
+			if _, ok := kafkaTopicFields[placeholder]; !ok {
+				return fmt.Errorf("unknown placeholder %s in kafka topic %s", placeholder, template)
+			}
+		}
+
+		if template != "" {
+			k.topic = template
+		}
+		return nil
+	}
+}
+
+// OptionKafkaEncoding sets the encoding of the records, KafkaEncodingJSON or KafkaEncodingAvro.
+func OptionKafkaEncoding(encoding string) KafkaOption {
+	return func(k *KafkaSink) error {
+		switch encoding {
+		case "":
+		case KafkaEncodingJSON, KafkaEncodingAvro:
+			k.encoding = encoding
+		default:
+			return fmt.Errorf("unknown kafka encoding %s", encoding)
+		}
+		return nil
+	}
+}
+
+// KafkaSink produces entries to Kafka topics. The partitions of the topics are requested from the brokers for
+// every batch, the records are sent to the leaders of the partitions and acknowledged by the leaders.
+type KafkaSink struct {
+	brokers  []string
+	topic    string
+	encoding string
+}
+
+// NewKafkaSink returns a new instance of KafkaSink. brokers are host:port addresses of the bootstrap brokers.
+func NewKafkaSink(brokers []string, opts ...KafkaOption) (*KafkaSink, error) {
+	if len(brokers) == 0 {
+		return nil, ErrNoKafkaBrokers
+	}
+
+	k := &KafkaSink{
+		brokers:  brokers,
+		topic:    defaultKafkaTopic,
+		encoding: KafkaEncodingJSON,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(k); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return k, nil
+}
+
+// Name returns "kafka".
+func (k *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Topic returns the topic of the entry.
+func (k *KafkaSink) Topic(e Entry) string {
+	topic := kafkaTopicPlaceholder.ReplaceAllStringFunc(k.topic, func(placeholder string) string {
+		return firstField(e, kafkaTopicFields[placeholder], "unknown")
+	})
+
+	// 249 is the longest topic name.
+	if topic = kafkaTopicInvalid.ReplaceAllString(topic, "_"); len(topic) > 249 {
+		topic = topic[:249]
+	}
+	return topic
+}
+
+func firstField(e Entry, fields []string, value string) string {
+	for _, field := range fields {
+		if v := e.Fields[field]; v != "" {
+			return v
+		}
+	}
+	return value
+}
+
+// encode returns the record value of the entry.
+func (k *KafkaSink) encode(e Entry) ([]byte, error) {
+	if k.encoding == KafkaEncodingAvro {
+		return avroEntry(e), nil
+	}
+	return json.Marshal(e)
+}
+
+// avroEntry encodes the entry as Avro binary data of KafkaAvroSchema.
+func avroEntry(e Entry) []byte {
+	// Avro long is the zigzag variable length integer of the Kafka record format.
+	enc := &kafkaEncoder{}
+	long := enc.varint
+	str := func(s string) {
+		long(int64(len(s)))
+		enc.WriteString(s)
+	}
+
+	long(e.Time.UnixNano() / int64(time.Microsecond))
+	str(e.Cursor)
+
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// a map is a block of the pairs followed by an empty block.
+	if len(keys) > 0 {
+		long(int64(len(keys)))
+		for _, key := range keys {
+			str(key)
+			str(e.Fields[key])
+		}
+	}
+	long(0)
+	return enc.Bytes()
+}
+
+// Send produces the entries. The entries with the same key go to the same partition of a topic.
+func (k *KafkaSink) Send(ctx context.Context, entries []Entry) error {
+	records := make(map[string][]kafkaRecord)
+	var topics []string
+	for _, e := range entries {
+		value, err := k.encode(e)
+		if err != nil {
+			return Permanent(err)
+		}
+
+		topic := k.Topic(e)
+		if _, ok := records[topic]; !ok {
+			topics = append(topics, topic)
+		}
+
+		var key []byte
+		if id := firstField(e, kafkaKeyFields, ""); id != "" {
+			key = []byte(id)
+		}
+		records[topic] = append(records[topic], kafkaRecord{key: key, value: value, time: e.Time})
+	}
+
+	partitions, err := k.metadata(ctx, topics)
+	if err != nil {
+		return err
+	}
+
+	// the records are grouped by the leaders of their partitions and split into requests of kafkaMaxBatchBytes.
+	requests := make(map[string][]kafkaProduceRequest)
+	sizes := make(map[string]int)
+	for _, topic := range topics {
+		if len(partitions[topic]) == 0 {
+			return fmt.Errorf("kafka topic %s has no partitions", topic)
+		}
+
+		for _, r := range records[topic] {
+			h := fnv.New32a()
+			h.Write(r.key)
+			p := partitions[topic][h.Sum32()%uint32(len(partitions[topic]))]
+			if p.leader == "" {
+				return fmt.Errorf("kafka partition %s/%d has no leader", topic, p.id)
+			}
+
+			size := len(r.key) + len(r.value)
+			if len(requests[p.leader]) == 0 || sizes[p.leader]+size > kafkaMaxBatchBytes {
+				requests[p.leader] = append(requests[p.leader], make(kafkaProduceRequest))
+				sizes[p.leader] = 0
+			}
+			sizes[p.leader] += size
+
+			req := requests[p.leader][len(requests[p.leader])-1]
+			if req[topic] == nil {
+				req[topic] = make(map[int32][]kafkaRecord)
+			}
+			req[topic][p.id] = append(req[topic][p.id], r)
+		}
+	}
+
+	for leader, reqs := range requests {
+		if err := k.produce(ctx, leader, reqs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metadata returns the partitions of the topics from the first broker which responds.
+func (k *KafkaSink) metadata(ctx context.Context, topics []string) (map[string][]kafkaPartition, error) {
+	var errs []string
+	for _, broker := range k.brokers {
+		conn, err := dialKafka(ctx, broker)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		partitions, err := conn.metadata(topics)
+		conn.Close()
+		if err != nil {
+			errs = append(errs, broker+": "+err.Error())
+			continue
+		}
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("unable to get kafka metadata: %s", strings.Join(errs, "; "))
+}
+
+// produce sends the requests to the leader.
+func (k *KafkaSink) produce(ctx context.Context, leader string, reqs []kafkaProduceRequest) error {
+	conn, err := dialKafka(ctx, leader)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, req := range reqs {
+		if err := conn.produce(req, kafkaTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
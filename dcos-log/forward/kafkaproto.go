@@ -0,0 +1,412 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The subset of the Kafka protocol used by KafkaSink, Metadata v4 and Produce v3 with v2 record batches, which
+// are supported by Kafka 1.0 and newer. https://kafka.apache.org/protocol
+const (
+	kafkaAPIProduce  = 0
+	kafkaAPIMetadata = 3
+
+	kafkaMetadataVersion = 4
+	kafkaProduceVersion  = 3
+
+	kafkaClientID = "dcos-log"
+
+	// kafkaTimeout is the timeout of a request if the context has no deadline.
+	kafkaTimeout = 30 * time.Second
+
+	// kafkaMaxResponseSize protects from reading garbage as a response size.
+	kafkaMaxResponseSize = 64 << 20
+)
+
+// errKafkaShortBuffer is returned when a response ends before a field.
+var errKafkaShortBuffer = errors.New("kafka response is truncated")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaError is a non-zero error code of a Kafka response.
+type kafkaError int16
+
+// kafkaErrorNames are the error codes of the Kafka responses a client is likely to see.
+var kafkaErrorNames = map[kafkaError]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_FOR_PARTITION",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	87: "INVALID_RECORD",
+}
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrorNames[e]; ok {
+		return "kafka error " + name
+	}
+	return "kafka error " + strconv.Itoa(int(e))
+}
+
+// permanent returns true if sending the same records again fails with the same error.
+func (e kafkaError) permanent() bool {
+	switch e {
+	case 2, 10, 17, 87:
+		return true
+	}
+	return false
+}
+
+// kafkaEncoder writes the primitive types of the Kafka protocol.
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	e.Write(b[:])
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.Write(b[:])
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.Write(b[:])
+}
+
+// varint writes a zigzag encoded variable length integer of the record format.
+func (e *kafkaEncoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+// varbytes writes a record key or value, nil is null.
+func (e *kafkaEncoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.Write(b)
+}
+
+// kafkaDecoder reads the primitive types of the Kafka protocol. The first error is kept and returned by err,
+// the following reads return zero values.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(d.b) < n {
+		d.err = errKafkaShortBuffer
+		return nil
+	}
+
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string, a null string is empty.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// int32s reads an array of int32.
+func (d *kafkaDecoder) int32s() []int32 {
+	var v []int32
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		v = append(v, d.int32())
+	}
+	return v
+}
+
+// kafkaConn is a connection to a Kafka broker. Requests are sent one at a time.
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+// dialKafka connects to a broker, the deadline of the connection is the deadline of the context.
+func dialKafka(ctx context.Context, addr string) (*kafkaConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(kafkaTimeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &kafkaConn{conn: conn}, nil
+}
+
+func (c *kafkaConn) Close() error {
+	return c.conn.Close()
+}
+
+// roundTrip sends a request and returns a decoder of the response body following the correlation ID.
+func (c *kafkaConn) roundTrip(apiKey, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	c.correlationID++
+
+	header := &kafkaEncoder{}
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(c.correlationID)
+	header.string(kafkaClientID)
+
+	req := &kafkaEncoder{}
+	req.int32(int32(header.Len() + len(body)))
+	req.Write(header.Bytes())
+	req.Write(body)
+	if _, err := c.conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("invalid kafka response size %d", n)
+	}
+
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+
+	d := &kafkaDecoder{b: resp}
+	if id := d.int32(); id != c.correlationID {
+		return nil, fmt.Errorf("unexpected kafka correlation ID %d, expected %d", id, c.correlationID)
+	}
+	return d, nil
+}
+
+// kafkaPartition is a partition of a topic and the address of its leader.
+type kafkaPartition struct {
+	id     int32
+	leader string
+}
+
+// metadata returns the partitions of the topics. The topics are created if the brokers allow it.
+func (c *kafkaConn) metadata(topics []string) (map[string][]kafkaPartition, error) {
+	req := &kafkaEncoder{}
+	req.int32(int32(len(topics)))
+	for _, topic := range topics {
+		req.string(topic)
+	}
+	req.int8(1)
+
+	d, err := c.roundTrip(kafkaAPIMetadata, kafkaMetadataVersion, req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	d.int32() // throttle_time_ms
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+
+	partitions := make(map[string][]kafkaPartition)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := kafkaError(d.int16())
+		topic := d.string()
+		d.int8() // is_internal
+
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			d.int16() // error_code of the partition, a partition without a leader fails the produce request.
+			partition := kafkaPartition{id: d.int32()}
+			partition.leader = brokers[d.int32()]
+			d.int32s() // replica_nodes
+			d.int32s() // isr_nodes
+			partitions[topic] = append(partitions[topic], partition)
+		}
+
+		if code != 0 {
+			return nil, fmt.Errorf("unable to get metadata of topic %s: %s", topic, code)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return partitions, nil
+}
+
+// kafkaRecord is a message of a record batch.
+type kafkaRecord struct {
+	key, value []byte
+	time       time.Time
+}
+
+// recordBatch encodes the records in the v2 record batch format.
+func recordBatch(records []kafkaRecord) []byte {
+	first := records[0].time.UnixNano() / int64(time.Millisecond)
+	max := first
+
+	body := &kafkaEncoder{}
+	body.int16(0) // attributes, no compression
+	body.int32(int32(len(records) - 1))
+
+	recs := &kafkaEncoder{}
+	for i, r := range records {
+		ts := r.time.UnixNano() / int64(time.Millisecond)
+		if ts > max {
+			max = ts
+		}
+
+		rec := &kafkaEncoder{}
+		rec.int8(0) // attributes
+		rec.varint(ts - first)
+		rec.varint(int64(i))
+		rec.varbytes(r.key)
+		rec.varbytes(r.value)
+		rec.varint(0) // headers
+
+		recs.varint(int64(rec.Len()))
+		recs.Write(rec.Bytes())
+	}
+
+	body.int64(first)
+	body.int64(max)
+	body.int64(-1) // producer_id
+	body.int16(-1) // producer_epoch
+	body.int32(-1) // base_sequence
+	body.int32(int32(len(records)))
+	body.Write(recs.Bytes())
+
+	batch := &kafkaEncoder{}
+	batch.int64(0)                             // base_offset
+	batch.int32(int32(4 + 1 + 4 + body.Len())) // batch_length
+	batch.int32(-1)                            // partition_leader_epoch
+	batch.int8(2)                              // magic
+	batch.int32(int32(crc32.Checksum(body.Bytes(), castagnoli)))
+	batch.Write(body.Bytes())
+	return batch.Bytes()
+}
+
+// kafkaProduceRequest is a batch of records per topic and partition sent to the leader of the partitions.
+type kafkaProduceRequest map[string]map[int32][]kafkaRecord
+
+// produce sends the records and waits for the leaders to write them. The first error of a partition is returned.
+func (c *kafkaConn) produce(records kafkaProduceRequest, timeout time.Duration) error {
+	req := &kafkaEncoder{}
+	req.int16(-1) // transactional_id
+	req.int16(1)  // acks, the leader wrote the records
+	req.int32(int32(timeout / time.Millisecond))
+	req.int32(int32(len(records)))
+	for topic, partitions := range records {
+		req.string(topic)
+		req.int32(int32(len(partitions)))
+		for id, recs := range partitions {
+			batch := recordBatch(recs)
+			req.int32(id)
+			req.int32(int32(len(batch)))
+			req.Write(batch)
+		}
+	}
+
+	d, err := c.roundTrip(kafkaAPIProduce, kafkaProduceVersion, req.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		topic := d.string()
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			partition := d.int32()
+			code := kafkaError(d.int16())
+			d.int64() // base_offset
+			d.int64() // log_append_time
+
+			if code != 0 && d.err == nil {
+				err := fmt.Errorf("unable to produce to %s/%d: %s", topic, partition, code)
+				if code.permanent() {
+					return Permanent(err)
+				}
+				return err
+			}
+		}
+	}
+	return d.err
+}
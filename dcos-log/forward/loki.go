@@ -0,0 +1,232 @@
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lokiLabelFields maps Loki labels to the journal fields they are extracted from, the first field
+// found in an entry is used.
+var lokiLabelFields = []struct {
+	label  string
+	fields []string
+}{
+	{label: "unit", fields: []string{"_SYSTEMD_UNIT", "UNIT"}},
+	{label: "host", fields: []string{"_HOSTNAME"}},
+	{label: "framework", fields: []string{"FRAMEWORK_ID"}},
+	{label: "task", fields: []string{"TASK_ID", "EXECUTOR_ID"}},
+}
+
+// LokiOption is a functional option that configures a LokiSink.
+type LokiOption func(*LokiSink) error
+
+// OptionLokiTenant sets the X-Scope-OrgID header used by multi tenant Loki deployments.
+func OptionLokiTenant(tenant string) LokiOption {
+	return func(l *LokiSink) error {
+		l.tenant = tenant
+		return nil
+	}
+}
+
+// OptionLokiLabels sets static labels added to every stream, for instance a cluster name.
+func OptionLokiLabels(labels map[string]string) LokiOption {
+	return func(l *LokiSink) error {
+		l.labels = labels
+		return nil
+	}
+}
+
+// LokiSink sends entries to the Loki push API. Entries are grouped into streams by labels extracted
+// from unit, host, framework and task fields. Loki rejects the entries older than the last entry of a stream, so
+// the entries of a stream are sent in order and an entry older than the last sent one gets its timestamp.
+type LokiSink struct {
+	client  *http.Client
+	pushURL string
+	tenant  string
+	labels  map[string]string
+
+	// last are the timestamps of the last entries sent per stream, by labelsKey.
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// NewLokiSink returns a new instance of LokiSink. pushURL is a full URL of the push endpoint,
+// for instance http://loki:3100/loki/api/v1/push.
+func NewLokiSink(client *http.Client, pushURL string, opts ...LokiOption) (*LokiSink, error) {
+	l := &LokiSink{
+		client:  client,
+		pushURL: pushURL,
+		last:    make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(l); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// Name returns "loki".
+func (l *LokiSink) Name() string {
+	return "loki"
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// Labels returns the stream labels of the entry.
+func (l *LokiSink) Labels(e Entry) map[string]string {
+	labels := map[string]string{"job": "dcos-log"}
+	for k, v := range l.labels {
+		labels[k] = v
+	}
+
+	for _, lf := range lokiLabelFields {
+		for _, field := range lf.fields {
+			if value := e.Fields[field]; value != "" {
+				labels[lf.label] = value
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// labelsKey returns a string uniquely identifying a label set.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
+
+// pushRequest groups the entries into streams ordered by time. It returns the last timestamps of the streams, which
+// are kept once the request is accepted.
+func (l *LokiSink) pushRequest(entries []Entry) (*lokiPushRequest, map[string]time.Time) {
+	req := &lokiPushRequest{}
+	streams := make(map[string]*lokiStream)
+	times := make(map[string][]time.Time)
+	var keys []string
+	for _, e := range entries {
+		labels := l.Labels(e)
+		key := labelsKey(labels)
+
+		if _, ok := streams[key]; !ok {
+			streams[key] = &lokiStream{Stream: labels}
+			keys = append(keys, key)
+			req.Streams = append(req.Streams, streams[key])
+		}
+
+		stream := streams[key]
+		stream.Values = append(stream.Values, [2]string{"", e.Message()})
+		times[key] = append(times[key], e.Time)
+	}
+
+	last := make(map[string]time.Time)
+	for _, key := range keys {
+		stream, ts := streams[key], times[key]
+		sort.Stable(lokiValues{values: stream.Values, times: ts})
+
+		prev := l.last[key]
+		for i, t := range ts {
+			if t.Before(prev) {
+				t = prev
+			}
+			stream.Values[i][0] = strconv.FormatInt(t.UnixNano(), 10)
+			prev = t
+		}
+		last[key] = prev
+	}
+	return req, last
+}
+
+// lokiValues sorts the values of a stream by their times.
+type lokiValues struct {
+	values [][2]string
+	times  []time.Time
+}
+
+func (v lokiValues) Len() int           { return len(v.values) }
+func (v lokiValues) Less(i, j int) bool { return v.times[i].Before(v.times[j]) }
+func (v lokiValues) Swap(i, j int) {
+	v.values[i], v.values[j] = v.values[j], v.values[i]
+	v.times[i], v.times[j] = v.times[j], v.times[i]
+}
+
+// Send pushes the entries to Loki.
+func (l *LokiSink) Send(ctx context.Context, entries []Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	push, last := l.pushRequest(entries)
+	body := &bytes.Buffer{}
+	gz := gzip.NewWriter(body)
+	if err := json.NewEncoder(gz).Encode(push); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", l.pushURL, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if l.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenant)
+	}
+
+	resp, err := l.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("loki push failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+
+		// invalid labels or entries too old, the same batch will be rejected again. Rate limited batches are retried.
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	for key, t := range last {
+		l.last[key] = t
+	}
+	return nil
+}
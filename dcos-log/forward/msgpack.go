@@ -0,0 +1,205 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The subset of MessagePack used by the Fluentd forward protocol. https://github.com/msgpack/msgpack/blob/master/spec.md
+
+// errMsgpackType is returned when a MessagePack value has an unsupported type.
+var errMsgpackType = errors.New("unsupported msgpack type")
+
+// msgpackEncoder writes MessagePack values.
+type msgpackEncoder struct {
+	bytes.Buffer
+}
+
+func (e *msgpackEncoder) header(fix, max byte, n int, codes [3]byte) {
+	switch {
+	case n <= int(max):
+		e.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16 && codes[1] != 0:
+		e.WriteByte(codes[1])
+		e.uint16(uint16(n))
+	default:
+		e.WriteByte(codes[2])
+		e.uint32(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) uint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	e.Write(b[:])
+}
+
+func (e *msgpackEncoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.Write(b[:])
+}
+
+func (e *msgpackEncoder) string(s string) {
+	if len(s) > 31 && len(s) <= math.MaxUint8 {
+		e.WriteByte(0xd9)
+		e.WriteByte(byte(len(s)))
+	} else {
+		e.header(0xa0, 31, len(s), [3]byte{0, 0xda, 0xdb})
+	}
+	e.WriteString(s)
+}
+
+func (e *msgpackEncoder) arrayHeader(n int) {
+	e.header(0x90, 15, n, [3]byte{0, 0xdc, 0xdd})
+}
+
+func (e *msgpackEncoder) mapHeader(n int) {
+	e.header(0x80, 15, n, [3]byte{0, 0xde, 0xdf})
+}
+
+// stringMap writes a map of strings.
+func (e *msgpackEncoder) stringMap(m map[string]string) {
+	e.mapHeader(len(m))
+	for k, v := range m {
+		e.string(k)
+		e.string(v)
+	}
+}
+
+// eventTime writes the EventTime extension of the Fluentd forward protocol, the time with nanoseconds.
+func (e *msgpackEncoder) eventTime(t time.Time) {
+	e.WriteByte(0xd7)
+	e.WriteByte(0)
+	e.uint32(uint32(t.Unix()))
+	e.uint32(uint32(t.Nanosecond()))
+}
+
+// msgpackExt is an extension value.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// decodeMsgpack reads a MessagePack value. Maps are map[string]interface{}, arrays are []interface{}, integers
+// are int64, strings and binary data are string.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length := func(size int) (int, error) {
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return int(n), nil
+	}
+
+	raw := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code >= 0xa0 && code <= 0xbf:
+		b, err := raw(int(code & 0x1f))
+		return string(b), err
+	case code >= 0x90 && code <= 0x9f:
+		return decodeMsgpackArray(r, int(code&0x0f))
+	case code >= 0x80 && code <= 0x8f:
+		return decodeMsgpackMap(r, int(code&0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return code == 0xc3, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := length(1 << (code - 0xcc))
+		return int64(n), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		n, err := length(size)
+		shift := uint(64 - 8*size)
+		return int64(n) << shift >> shift, err
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := map[byte]int{0xc4: 1, 0xc5: 2, 0xc6: 4, 0xd9: 1, 0xda: 2, 0xdb: 4}[code]
+		n, err := length(size)
+		if err != nil {
+			return nil, err
+		}
+		b, err := raw(n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		t, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		b, err := raw(1 << (code - 0xd4))
+		return msgpackExt{Type: int8(t), Data: b}, err
+	}
+	return nil, fmt.Errorf("%s 0x%x", errMsgpackType, code)
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n int) (interface{}, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, errMsgpackType
+		}
+
+		if m[key], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,291 @@
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpResourceFields maps the OpenTelemetry resource attributes to the fields they are taken from, the first field
+// found in an entry is used. The entries of the tasks logged to the journal and the lines of the task logs have the
+// Mesos IDs, the entries of the units have the unit.
+var otlpResourceFields = []struct {
+	attribute string
+	fields    []string
+}{
+	{attribute: "host.name", fields: []string{"_HOSTNAME"}},
+	{attribute: "service.name", fields: []string{"_SYSTEMD_UNIT", "UNIT", "SYSLOG_IDENTIFIER"}},
+	{attribute: "dcos.agent.id", fields: []string{"AGENT_ID"}},
+	{attribute: "dcos.framework.id", fields: []string{"FRAMEWORK_ID"}},
+	{attribute: "dcos.executor.id", fields: []string{"EXECUTOR_ID"}},
+	{attribute: "dcos.container.id", fields: []string{"CONTAINER_ID"}},
+	{attribute: "dcos.task.id", fields: []string{"TASK_ID"}},
+}
+
+// otlpSeverities are the OpenTelemetry severity numbers and texts of the syslog priorities of the PRIORITY field.
+var otlpSeverities = []struct {
+	number int
+	text   string
+}{
+	{21, "EMERG"}, {19, "ALERT"}, {18, "CRIT"}, {17, "ERR"}, {13, "WARNING"}, {10, "NOTICE"}, {9, "INFO"}, {5, "DEBUG"},
+}
+
+// The protocols of OptionOTLPProtocol.
+const (
+	OTLPProtocolHTTPJSON = "http/json"
+	OTLPProtocolGRPC     = "grpc"
+)
+
+// OTLPOption is a functional option that configures an OTLPSink.
+type OTLPOption func(*OTLPSink) error
+
+// OptionOTLPAttributes sets static resource attributes added to every entry, for instance the cluster name.
+func OptionOTLPAttributes(attributes map[string]string) OTLPOption {
+	return func(o *OTLPSink) error {
+		o.attributes = attributes
+		return nil
+	}
+}
+
+// OptionOTLPHeaders sets the headers of the export requests, for instance the credentials of a hosted collector.
+func OptionOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(o *OTLPSink) error {
+		o.headers = headers
+		return nil
+	}
+}
+
+// OptionOTLPProtocol sets the protocol of the export requests, OTLPProtocolHTTPJSON (the default) or
+// OTLPProtocolGRPC.
+func OptionOTLPProtocol(protocol string) OTLPOption {
+	return func(o *OTLPSink) error {
+		switch protocol {
+		case "", OTLPProtocolHTTPJSON:
+			o.grpc = false
+		case OTLPProtocolGRPC:
+			o.grpc = true
+		default:
+			return fmt.Errorf("unknown otlp protocol %q, must be %s or %s", protocol, OTLPProtocolHTTPJSON, OTLPProtocolGRPC)
+		}
+		return nil
+	}
+}
+
+// OTLPSink exports the entries as OpenTelemetry log records to a collector with OTLP/HTTP in JSON encoding, like
+// the span exporter of the tracing package. The records are grouped by resource, the host, the unit and the Mesos
+// IDs of a task, the severity is derived from PRIORITY and the other fields are attributes of the records. With
+// OptionOTLPProtocol(OTLPProtocolGRPC) the records are exported with OTLP/gRPC instead.
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type OTLPSink struct {
+	client     *http.Client
+	logsURL    string
+	attributes map[string]string
+	headers    map[string]string
+	grpc       bool
+}
+
+// NewOTLPSink returns a new instance of OTLPSink. logsURL is the logs endpoint of the collector, for instance
+// http://localhost:4318/v1/logs, or the URL of the gRPC server with OTLPProtocolGRPC, for instance
+// http://localhost:4317.
+func NewOTLPSink(client *http.Client, logsURL string, opts ...OTLPOption) (*OTLPSink, error) {
+	o := &OTLPSink{
+		client:  client,
+		logsURL: logsURL,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(o); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.grpc {
+		c, err := otlpGRPCClient(client)
+		if err != nil {
+			return nil, err
+		}
+		o.client = c
+		o.logsURL = strings.TrimSuffix(logsURL, "/") + otlpGRPCMethod
+	}
+	return o, nil
+}
+
+// Name returns "otlp".
+func (o *OTLPSink) Name() string {
+	return "otlp"
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber,omitempty"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 otlpValue      `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpExportRequest struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+// otlpKeyValues returns the attributes sorted by key.
+func otlpKeyValues(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i] = otlpKeyValue{Key: k, Value: otlpValue{StringValue: attributes[k]}}
+	}
+	return kvs
+}
+
+// Resource returns the resource attributes of the entry.
+func (o *OTLPSink) Resource(e Entry) map[string]string {
+	resource := map[string]string{}
+	for k, v := range o.attributes {
+		resource[k] = v
+	}
+
+	for _, rf := range otlpResourceFields {
+		for _, field := range rf.fields {
+			if value := e.Fields[field]; value != "" {
+				resource[rf.attribute] = value
+				break
+			}
+		}
+	}
+
+	if resource["service.name"] == "" {
+		resource["service.name"] = "dcos-log"
+	}
+	return resource
+}
+
+// otlpRecord returns the log record of the entry. The fields other than the message and the priority are
+// attributes, except the addresses of the entry in the journal files such as __CURSOR.
+func otlpRecord(e Entry, observed time.Time) otlpLogRecord {
+	r := otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(e.Time.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(observed.UnixNano(), 10),
+		Body:                 otlpValue{StringValue: e.Message()},
+	}
+
+	if p, err := strconv.Atoi(e.Fields["PRIORITY"]); err == nil && p >= 0 && p < len(otlpSeverities) {
+		r.SeverityNumber, r.SeverityText = otlpSeverities[p].number, otlpSeverities[p].text
+	}
+
+	attributes := make(map[string]string, len(e.Fields))
+	for k, v := range e.Fields {
+		if k == "MESSAGE" || k == "PRIORITY" || strings.HasPrefix(k, "__") {
+			continue
+		}
+		attributes[k] = v
+	}
+	r.Attributes = otlpKeyValues(attributes)
+	return r
+}
+
+// exportRequest groups the log records of the entries by resource, in the order the resources are first seen.
+func (o *OTLPSink) exportRequest(entries []Entry, observed time.Time) *otlpExportRequest {
+	req := &otlpExportRequest{}
+	resources := make(map[string]*otlpResourceLogs)
+	for _, e := range entries {
+		resource := o.Resource(e)
+		key := labelsKey(resource)
+
+		logs, ok := resources[key]
+		if !ok {
+			logs = &otlpResourceLogs{ScopeLogs: []otlpScopeLogs{{}}}
+			logs.Resource.Attributes = otlpKeyValues(resource)
+			logs.ScopeLogs[0].Scope.Name = "github.com/dcos/dcos-log/dcos-log/forward"
+			resources[key] = logs
+			req.ResourceLogs = append(req.ResourceLogs, logs)
+		}
+		logs.ScopeLogs[0].LogRecords = append(logs.ScopeLogs[0].LogRecords, otlpRecord(e, observed))
+	}
+	return req
+}
+
+// Send exports the entries to the collector.
+func (o *OTLPSink) Send(ctx context.Context, entries []Entry) error {
+	if o.grpc {
+		return o.sendGRPC(ctx, entries)
+	}
+
+	body := &bytes.Buffer{}
+	gz := gzip.NewWriter(body)
+	if err := json.NewEncoder(gz).Encode(o.exportRequest(entries, time.Now())); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.logsURL, body)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := o.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("otlp export failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+
+		// the collector rejects a malformed request again, the throttled and unavailable collectors are retried.
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The OTLP/gRPC export of the log records, a unary call of the LogsService with the protobuf encoding of the
+// export request. The call is sent with the HTTP/2 client of the standard library, over TLS for https URLs and
+// without TLS (h2c) for http URLs. https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+const (
+	otlpGRPCMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+	// otlpMaxResponseSize limits the response read before the trailers, the export response is a few bytes.
+	otlpMaxResponseSize = 1 << 20
+)
+
+// otlpRetryableCodes are the gRPC status codes of the failed exports which are retried, the others are
+// permanent. https://opentelemetry.io/docs/specs/otlp/#failures
+var otlpRetryableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// otlpGRPCClient returns a copy of the client which sends the requests with HTTP/2 only. gRPC requires HTTP/2,
+// the transport of the client must be an *http.Transport to be configured.
+func otlpGRPCClient(client *http.Client) (*http.Client, error) {
+	var tr *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		tr = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		tr = t.Clone()
+	default:
+		return nil, fmt.Errorf("otlp grpc requires an *http.Transport, got %T", t)
+	}
+
+	tr.ForceAttemptHTTP2 = true
+	tr.Protocols = new(http.Protocols)
+	tr.Protocols.SetHTTP2(true)
+	tr.Protocols.SetUnencryptedHTTP2(true)
+
+	c := *client
+	c.Transport = tr
+	return &c, nil
+}
+
+// protoEncoder writes the fields of the protobuf messages of the export request.
+// https://protobuf.dev/programming-guides/encoding/
+type protoEncoder struct {
+	bytes.Buffer
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *protoEncoder) uint64(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, 0)
+		e.varint(v)
+	}
+}
+
+func (e *protoEncoder) fixed64(field int, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.tag(field, 1)
+	e.Write(b[:])
+}
+
+func (e *protoEncoder) string(field int, s string) {
+	e.tag(field, 2)
+	e.varint(uint64(len(s)))
+	e.WriteString(s)
+}
+
+// message writes the embedded message written by encode.
+func (e *protoEncoder) message(field int, encode func(*protoEncoder)) {
+	m := &protoEncoder{}
+	encode(m)
+	e.tag(field, 2)
+	e.varint(uint64(m.Len()))
+	e.Write(m.Bytes())
+}
+
+// anyValue writes an AnyValue with a string_value, which is written even if empty to set the value.
+func (e *protoEncoder) anyValue(field int, v otlpValue) {
+	e.message(field, func(m *protoEncoder) {
+		m.string(1, v.StringValue)
+	})
+}
+
+func (e *protoEncoder) keyValues(field int, kvs []otlpKeyValue) {
+	for _, kv := range kvs {
+		e.message(field, func(m *protoEncoder) {
+			m.string(1, kv.Key)
+			m.anyValue(2, kv.Value)
+		})
+	}
+}
+
+func (e *protoEncoder) logRecord(field int, r otlpLogRecord) {
+	e.message(field, func(m *protoEncoder) {
+		t, _ := strconv.ParseUint(r.TimeUnixNano, 10, 64)
+		m.fixed64(1, t)
+		m.uint64(2, uint64(r.SeverityNumber))
+		if r.SeverityText != "" {
+			m.string(3, r.SeverityText)
+		}
+		m.anyValue(5, r.Body)
+		m.keyValues(6, r.Attributes)
+		observed, _ := strconv.ParseUint(r.ObservedTimeUnixNano, 10, 64)
+		m.fixed64(11, observed)
+	})
+}
+
+// encodeOTLPRequest returns the protobuf encoding of the ExportLogsServiceRequest.
+func encodeOTLPRequest(req *otlpExportRequest) []byte {
+	e := &protoEncoder{}
+	for _, logs := range req.ResourceLogs {
+		e.message(1, func(resourceLogs *protoEncoder) {
+			resourceLogs.message(1, func(resource *protoEncoder) {
+				resource.keyValues(1, logs.Resource.Attributes)
+			})
+
+			for _, scopeLogs := range logs.ScopeLogs {
+				resourceLogs.message(2, func(m *protoEncoder) {
+					m.message(1, func(scope *protoEncoder) {
+						scope.string(1, scopeLogs.Scope.Name)
+					})
+					for _, r := range scopeLogs.LogRecords {
+						m.logRecord(2, r)
+					}
+				})
+			}
+		})
+	}
+	return e.Bytes()
+}
+
+// sendGRPC exports the entries with a gRPC call, the request is a single uncompressed length-prefixed message.
+func (o *OTLPSink) sendGRPC(ctx context.Context, entries []Entry) error {
+	msg := encodeOTLPRequest(o.exportRequest(entries, time.Now()))
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	req, err := http.NewRequest("POST", o.logsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := o.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("otlp export failed with status %d", resp.StatusCode)
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	// the status is in the trailers, which are set once the body is read, or in the headers of a response
+	// without a message.
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, otlpMaxResponseSize)); err != nil {
+		return err
+	}
+
+	trailer := resp.Trailer
+	if trailer.Get("Grpc-Status") == "" {
+		trailer = resp.Header
+	}
+
+	code, err := strconv.Atoi(trailer.Get("Grpc-Status"))
+	if err != nil {
+		return fmt.Errorf("otlp export failed without a grpc-status: %q", trailer.Get("Grpc-Status"))
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	msgText, _ := url.PathUnescape(trailer.Get("Grpc-Message"))
+	err = fmt.Errorf("otlp export failed with grpc status %d: %s", code, strings.TrimSpace(msgText))
+	if !otlpRetryableCodes[code] {
+		return Permanent(err)
+	}
+	return err
+}
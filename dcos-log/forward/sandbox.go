@@ -0,0 +1,459 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/mesos/agent"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSandboxPollInterval  = time.Second
+	defaultSandboxStateInterval = 10 * time.Second
+)
+
+var (
+	// ErrNoSandboxFiles is returned by OptionSandboxFiles if the list of files is empty.
+	ErrNoSandboxFiles = errors.New("list of sandbox files cannot be empty")
+
+	// ErrInvalidPollInterval is returned by OptionSandboxPollInterval if the interval is zero or negative.
+	ErrInvalidPollInterval = errors.New("poll interval must be positive")
+)
+
+// SandboxOption is a functional option that configures a SandboxForwarder.
+type SandboxOption func(*SandboxForwarder) error
+
+// OptionSandboxFiles sets the sandbox files which are followed. The default is stdout and stderr.
+func OptionSandboxFiles(files ...string) SandboxOption {
+	return func(s *SandboxForwarder) error {
+		if len(files) == 0 {
+			return ErrNoSandboxFiles
+		}
+		s.files = files
+		return nil
+	}
+}
+
+// OptionSandboxPollInterval sets how often the followed files are read, the agent state is read every 10
+// intervals for new and terminated executors.
+func OptionSandboxPollInterval(d time.Duration) SandboxOption {
+	return func(s *SandboxForwarder) error {
+		if d <= 0 {
+			return ErrInvalidPollInterval
+		}
+		s.pollInterval = d
+		s.stateInterval = 10 * d
+		return nil
+	}
+}
+
+// OptionSandboxBatchSize sets the maximum number of lines sent in a single batch.
+func OptionSandboxBatchSize(n int) SandboxOption {
+	return func(s *SandboxForwarder) error {
+		if n <= 0 {
+			return ErrInvalidBatchSize
+		}
+		s.batchSize = n
+		return nil
+	}
+}
+
+// OptionSandboxStateFile sets a file to store the cursors of the followed files. The forwarder resumes from
+// the cursors after restart, otherwise the files of the running executors are followed from their end.
+func OptionSandboxStateFile(path string) SandboxOption {
+	return func(s *SandboxForwarder) error {
+		s.stateFile = path
+		return nil
+	}
+}
+
+// OptionSandboxReaderOptions sets the options of the files API readers, such as reader.OptWorkDir.
+func OptionSandboxReaderOptions(opts ...reader.Option) SandboxOption {
+	return func(s *SandboxForwarder) error {
+		s.readerOpts = opts
+		return nil
+	}
+}
+
+// sandboxFile is a followed file of a sandbox.
+type sandboxFile struct {
+	frameworkID string
+	executorID  string
+	containerID string
+	taskPath    string
+	file        string
+
+	// done is set once the executor terminated, the file is read to the end and no longer followed.
+	done bool
+	rm   *reader.ReadManager
+}
+
+// key identifies the file in the state file.
+func (f *sandboxFile) key() string {
+	return path.Join(f.frameworkID, f.executorID, f.containerID, f.taskPath, f.file)
+}
+
+// SandboxForwarder follows the sandbox files of the executors running on the local agent via the files API and
+// sends their lines to a Sink in batches. Like Forwarder, a failed batch is retried with exponential backoff and
+// the cursors of the files are only stored once the lines are sent.
+type SandboxForwarder struct {
+	sink     Sink
+	client   *http.Client
+	agentURL url.URL
+
+	files         []string
+	pollInterval  time.Duration
+	stateInterval time.Duration
+	batchSize     int
+	stateFile     string
+	readerOpts    []reader.Option
+
+	agentID  string
+	hostname string
+	followed map[string]*sandboxFile
+	cursors  map[string]string
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewSandboxForwarder returns a new instance of SandboxForwarder. agentURL is a base URL of the local mesos
+// agent.
+func NewSandboxForwarder(sink Sink, client *http.Client, agentURL url.URL, opts ...SandboxOption) (*SandboxForwarder, error) {
+	s := &SandboxForwarder{
+		sink:          sink,
+		client:        client,
+		agentURL:      agentURL,
+		files:         []string{"stdout", "stderr"},
+		pollInterval:  defaultSandboxPollInterval,
+		stateInterval: defaultSandboxStateInterval,
+		batchSize:     defaultBatchSize,
+		stats:         Stats{Sink: sink.Name()},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Stats returns the forwarder state, the cursor is not set.
+func (s *SandboxForwarder) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Run follows the sandbox files until the context is canceled. A failed forwarder may be run again, the files
+// are read again from the stored cursors.
+func (s *SandboxForwarder) Run(ctx context.Context) error {
+	// the readers of a failed run are ahead of the stored cursors.
+	s.followed = make(map[string]*sandboxFile)
+	s.cursors = s.readCursors()
+
+	// like Forwarder without a cursor, the files of the executors running on the first start are followed from
+	// their end. The files of the executors started later are read from the beginning.
+	fromEnd := len(s.cursors) == 0
+
+	var lastState time.Time
+	for {
+		if time.Since(lastState) >= s.stateInterval {
+			if err := s.updateFiles(ctx, fromEnd); err != nil {
+				s.setError(err)
+				logrus.Errorf("%s sandbox forwarder: unable to read agent state: %s", s.sink.Name(), err)
+			} else {
+				fromEnd = false
+			}
+			lastState = time.Now()
+		}
+
+		for key, f := range s.followed {
+			if err := s.forwardFile(ctx, f); err != nil {
+				return err
+			}
+
+			if f.done {
+				delete(s.followed, key)
+				delete(s.cursors, key)
+				s.writeCursors()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// updateFiles starts following the files of new executors and marks the files of terminated executors done. If
+// fromEnd is set, the files without a stored cursor are followed from their end, otherwise from the beginning.
+func (s *SandboxForwarder) updateFiles(ctx context.Context, fromEnd bool) error {
+	state, err := agent.GetState(ctx, s.client, s.agentURL, nil)
+	if err != nil {
+		return err
+	}
+	s.agentID, s.hostname = state.ID, state.Hostname
+
+	running := make(map[string]bool)
+	for _, framework := range state.Frameworks {
+		for _, executor := range framework.Executors {
+			for _, f := range s.executorFiles(framework.ID, executor) {
+				running[f.key()] = true
+				if _, ok := s.followed[f.key()]; ok {
+					continue
+				}
+
+				if err := s.open(ctx, f, fromEnd); err != nil {
+					// the file may not be created yet, it's opened again with the next state.
+					logrus.Debugf("%s sandbox forwarder: unable to open %s: %s", s.sink.Name(), f.key(), err)
+					continue
+				}
+				s.followed[f.key()] = f
+			}
+		}
+	}
+
+	for key, f := range s.followed {
+		if !running[key] {
+			f.done = true
+		}
+	}
+	return nil
+}
+
+// executorFiles returns the files of an executor sandbox and the nested task sandboxes of pods.
+func (s *SandboxForwarder) executorFiles(frameworkID string, executor agent.Executor) []*sandboxFile {
+	taskPaths := []string{""}
+	for _, task := range executor.Tasks {
+		// pod tasks have their own sandbox in the tasks/ folder.
+		if task.ID != executor.ID {
+			taskPaths = append(taskPaths, task.ID)
+		}
+	}
+
+	var files []*sandboxFile
+	for _, taskPath := range taskPaths {
+		for _, file := range s.files {
+			files = append(files, &sandboxFile{
+				frameworkID: frameworkID,
+				executorID:  executor.ID,
+				containerID: executor.Container,
+				taskPath:    taskPath,
+				file:        file,
+			})
+		}
+	}
+	return files
+}
+
+// open creates the reader of a file at the stored cursor, or at the beginning or the end of the file.
+func (s *SandboxForwarder) open(ctx context.Context, f *sandboxFile, fromEnd bool) error {
+	opts := append([]reader.Option{reader.OptStream(true), reader.OptStableCursors(true)}, s.readerOpts...)
+	if c, ok := s.cursors[f.key()]; ok {
+		cursor, err := reader.ParseCursor(c)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, reader.OptCursor(cursor))
+	} else if fromEnd {
+		opts = append(opts, reader.OptReadFromEnd())
+	}
+
+	agentURL := s.agentURL
+	agentURL.Path = "/files/read"
+	rm, err := reader.NewLineReaderContext(ctx, s.client, agentURL, s.agentID, f.frameworkID, f.executorID,
+		f.containerID, f.taskPath, f.file, reader.LineFormat, opts...)
+	if err == reader.ErrCursorExpired {
+		// the file was rotated away, the rest of it is lost.
+		logrus.Warnf("%s sandbox forwarder: cursor of %s expired, reading from the beginning", s.sink.Name(), f.key())
+		delete(s.cursors, f.key())
+		return s.open(ctx, f, false)
+	}
+
+	if err != nil {
+		return err
+	}
+	f.rm = rm
+	return nil
+}
+
+// forwardFile sends the new lines of a file in batches and stores the cursor of the file after every batch.
+func (s *SandboxForwarder) forwardFile(ctx context.Context, f *sandboxFile) error {
+	for {
+		var batch []Entry
+		for len(batch) < s.batchSize {
+			line, err := f.rm.NextLine(ctx)
+			if err == io.EOF {
+				break
+			}
+
+			// the sandbox was garbage collected.
+			if err == reader.ErrFileNotFound {
+				f.done = true
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+
+			batch = append(batch, s.newEntry(f, strings.TrimSuffix(line, "\n")))
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := s.send(ctx, batch); err != nil {
+			return err
+		}
+
+		s.cursors[f.key()] = f.rm.Cursor()
+		s.writeCursors()
+
+		if len(batch) < s.batchSize || f.done {
+			return nil
+		}
+	}
+}
+
+// newEntry returns an entry of a sandbox line with the fields of the task log endpoints, the cursor is the
+// rotation stable cursor of the line.
+func (s *SandboxForwarder) newEntry(f *sandboxFile, message string) Entry {
+	fields := map[string]string{
+		"MESSAGE":      message,
+		"AGENT_ID":     s.agentID,
+		"FRAMEWORK_ID": f.frameworkID,
+		"EXECUTOR_ID":  f.executorID,
+		"CONTAINER_ID": f.containerID,
+		"FILE":         f.file,
+		"_HOSTNAME":    s.hostname,
+	}
+
+	if f.taskPath != "" {
+		fields["TASK_PATH"] = f.taskPath
+	}
+
+	return Entry{Time: time.Now(), Cursor: f.rm.Cursor(), Fields: fields}
+}
+
+// send sends a batch, retrying with exponential backoff until it succeeds or the context is canceled. A batch
+// rejected by the sink is dropped.
+func (s *SandboxForwarder) send(ctx context.Context, batch []Entry) error {
+	delay := minRetryDelay
+	for {
+		err := s.sink.Send(ctx, batch)
+		if err == nil {
+			break
+		}
+
+		entriesTotal.WithLabelValues(s.sink.Name(), "failed").Add(float64(len(batch)))
+		s.mu.Lock()
+		s.stats.Failed += uint64(len(batch))
+		s.mu.Unlock()
+		s.setError(err)
+
+		if _, permanent := err.(permanentError); permanent {
+			logrus.Errorf("%s sandbox forwarder: giving up sending %d lines: %s", s.sink.Name(), len(batch), err)
+			return nil
+		}
+
+		logrus.Errorf("%s sandbox forwarder: unable to send %d lines, retry in %s: %s", s.sink.Name(), len(batch), delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+
+	entriesTotal.WithLabelValues(s.sink.Name(), "sent").Add(float64(len(batch)))
+	s.mu.Lock()
+	s.stats.Sent += uint64(len(batch))
+	s.stats.LastSent = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SandboxForwarder) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.LastError = err.Error()
+}
+
+// readCursors returns the stored cursors of the files, the cursors of the previous run if the state file is
+// not set.
+func (s *SandboxForwarder) readCursors() map[string]string {
+	cursors := make(map[string]string)
+	if s.stateFile == "" {
+		for key, c := range s.cursors {
+			cursors[key] = c
+		}
+		return cursors
+	}
+
+	b, err := ioutil.ReadFile(s.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Errorf("%s sandbox forwarder: unable to read state file: %s", s.sink.Name(), err)
+		}
+		return cursors
+	}
+
+	if err := json.Unmarshal(b, &cursors); err != nil {
+		logrus.Errorf("%s sandbox forwarder: invalid state file %s: %s", s.sink.Name(), s.stateFile, err)
+	}
+	return cursors
+}
+
+// writeCursors stores the cursors in the state file.
+func (s *SandboxForwarder) writeCursors() {
+	if s.stateFile == "" {
+		return
+	}
+
+	b, err := json.Marshal(s.cursors)
+	if err != nil {
+		logrus.Errorf("%s sandbox forwarder: unable to encode cursors: %s", s.sink.Name(), err)
+		return
+	}
+
+	// write to a temporary file first, so a crash never leaves truncated cursors.
+	tmp := s.stateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(s.stateFile), 0755); err != nil {
+		logrus.Errorf("%s sandbox forwarder: unable to create state dir: %s", s.sink.Name(), err)
+		return
+	}
+
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		logrus.Errorf("%s sandbox forwarder: unable to write state file: %s", s.sink.Name(), err)
+		return
+	}
+
+	if err := os.Rename(tmp, s.stateFile); err != nil {
+		logrus.Errorf("%s sandbox forwarder: unable to write state file: %s", s.sink.Name(), err)
+	}
+}
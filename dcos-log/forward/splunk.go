@@ -0,0 +1,163 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// splunkIndexedFields are the journal fields sent as Splunk indexed fields.
+var splunkIndexedFields = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"SYSLOG_IDENTIFIER": "identifier",
+	"PRIORITY":          "priority",
+	"FRAMEWORK_ID":      "framework_id",
+	"EXECUTOR_ID":       "executor_id",
+	"CONTAINER_ID":      "container_id",
+	"AGENT_ID":          "agent_id",
+}
+
+// SplunkOption is a functional option that configures a SplunkSink.
+type SplunkOption func(*SplunkSink) error
+
+// OptionSplunkIndex sets the index of events. If field is set and an entry has the field, the field
+// value is used as the index, otherwise the default index of the HEC token is used.
+func OptionSplunkIndex(index, field string) SplunkOption {
+	return func(s *SplunkSink) error {
+		s.index = index
+		s.indexField = field
+		return nil
+	}
+}
+
+// OptionSplunkSourcetype sets the sourcetype of events, the same way as OptionSplunkIndex.
+func OptionSplunkSourcetype(sourcetype, field string) SplunkOption {
+	return func(s *SplunkSink) error {
+		s.sourcetype = sourcetype
+		s.sourcetypeField = field
+		return nil
+	}
+}
+
+// SplunkSink sends entries to Splunk HTTP Event Collector.
+// https://docs.splunk.com/Documentation/Splunk/latest/Data/UsetheHTTPEventCollector
+type SplunkSink struct {
+	client *http.Client
+	url    string
+	token  string
+
+	index, indexField           string
+	sourcetype, sourcetypeField string
+}
+
+// NewSplunkSink returns a new instance of SplunkSink. collectorURL is a full URL of the event endpoint,
+// for instance https://splunk:8088/services/collector/event.
+func NewSplunkSink(client *http.Client, collectorURL, token string, opts ...SplunkOption) (*SplunkSink, error) {
+	s := &SplunkSink{
+		client:     client,
+		url:        collectorURL,
+		token:      token,
+		sourcetype: "journald",
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Name returns "splunk".
+func (s *SplunkSink) Name() string {
+	return "splunk"
+}
+
+type splunkEvent struct {
+	Time       float64           `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      string            `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+func fieldOrDefault(e Entry, field, value string) string {
+	if field != "" && e.Fields[field] != "" {
+		return e.Fields[field]
+	}
+	return value
+}
+
+// event converts an entry to HEC event.
+func (s *SplunkSink) event(e Entry) splunkEvent {
+	event := splunkEvent{
+		Time:       float64(e.Time.UnixNano()/int64(1000)) / 1e6,
+		Host:       e.Fields["_HOSTNAME"],
+		Source:     e.Fields["_SYSTEMD_UNIT"],
+		Sourcetype: fieldOrDefault(e, s.sourcetypeField, s.sourcetype),
+		Index:      fieldOrDefault(e, s.indexField, s.index),
+		Event:      e.Message(),
+	}
+
+	if event.Source == "" {
+		event.Source = e.Fields["SYSLOG_IDENTIFIER"]
+	}
+
+	for field, name := range splunkIndexedFields {
+		if v := e.Fields[field]; v != "" {
+			if event.Fields == nil {
+				event.Fields = make(map[string]string)
+			}
+			event.Fields[name] = v
+		}
+	}
+	return event
+}
+
+// Send posts the entries to HEC as a single batch. Requests rejected with 400 are not retried.
+func (s *SplunkSink) Send(ctx context.Context, entries []Entry) error {
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, e := range entries {
+		if err := encoder.Encode(s.event(e)); err != nil {
+			return Permanent(err)
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.url, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("splunk HEC failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+
+	// invalid data or index, the same batch will be rejected again.
+	if resp.StatusCode == http.StatusBadRequest {
+		return Permanent(err)
+	}
+	return err
+}
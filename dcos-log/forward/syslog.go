@@ -0,0 +1,257 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog transports
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+const (
+	// syslogTimeout is the timeout of a batch if the context has no deadline.
+	syslogTimeout = 30 * time.Second
+
+	// syslogMaxUDPSize is the size of a message every receiver accepts over UDP, longer messages are truncated.
+	// https://tools.ietf.org/html/rfc5426#section-3.2
+	syslogMaxUDPSize = 2048
+
+	// syslogSDID is the structured data element with the DC/OS metadata of an entry, 32473 is the private
+	// enterprise number reserved for documentation.
+	syslogSDID = "dcos@32473"
+
+	syslogNilValue = "-"
+)
+
+// syslogSDParams maps the journal fields to the params of the structured data element.
+var syslogSDParams = map[string]string{
+	"_SYSTEMD_UNIT": "unit",
+	"FRAMEWORK_ID":  "framework_id",
+	"EXECUTOR_ID":   "executor_id",
+	"CONTAINER_ID":  "container_id",
+	"AGENT_ID":      "agent_id",
+}
+
+// syslogAppNameFields are the journal fields of APP-NAME, the first field found in an entry is used.
+var syslogAppNameFields = []string{"SYSLOG_IDENTIFIER", "_SYSTEMD_UNIT", "_COMM"}
+
+// SyslogOption is a functional option that configures a SyslogSink.
+type SyslogOption func(*SyslogSink) error
+
+// OptionSyslogTLS sets the TLS config of the SyslogTLS transport.
+func OptionSyslogTLS(c *tls.Config) SyslogOption {
+	return func(s *SyslogSink) error {
+		s.tlsConfig = c
+		return nil
+	}
+}
+
+// SyslogSink sends entries to a remote syslog collector as RFC 5424 messages. Over TCP and TLS the messages are
+// framed with octet counting and the connection is kept open and reconnected after an error. A batch sent again
+// after a failed write may deliver some messages twice.
+// https://tools.ietf.org/html/rfc5424 https://tools.ietf.org/html/rfc6587
+type SyslogSink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink returns a new instance of SyslogSink. network is SyslogUDP, SyslogTCP or SyslogTLS, addr is
+// host:port of the collector.
+func NewSyslogSink(network, addr string, opts ...SyslogOption) (*SyslogSink, error) {
+	switch network {
+	case SyslogUDP, SyslogTCP, SyslogTLS:
+	default:
+		return nil, fmt.Errorf("unknown syslog transport %s", network)
+	}
+
+	s := &SyslogSink{
+		network:   network,
+		addr:      addr,
+		tlsConfig: &tls.Config{},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Name returns "syslog".
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// syslogHeaderField returns a header field of printable ASCII characters of max length, "-" if it is empty.
+func syslogHeaderField(v string, max int) string {
+	b := []byte(v)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+
+	if len(b) > max {
+		b = b[:max]
+	}
+
+	if len(b) == 0 {
+		return syslogNilValue
+	}
+	return string(b)
+}
+
+// syslogParamEscaper escapes the characters of a structured data param value.
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// Message formats the entry as an RFC 5424 message. The priority is taken from SYSLOG_FACILITY and PRIORITY
+// fields, user.info if they are not set.
+func (s *SyslogSink) Message(e Entry) []byte {
+	facility, err := strconv.Atoi(e.Fields["SYSLOG_FACILITY"])
+	if err != nil || facility < 0 || facility > 23 {
+		facility = 1
+	}
+
+	severity, err := strconv.Atoi(e.Fields["PRIORITY"])
+	if err != nil || severity < 0 || severity > 7 {
+		severity = 6
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "<%d>1 %s %s %s %s %s ", facility*8+severity,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeaderField(e.Fields["_HOSTNAME"], 255),
+		syslogHeaderField(firstField(e, syslogAppNameFields, ""), 48),
+		syslogHeaderField(e.Fields["_PID"], 128),
+		syslogNilValue)
+
+	var params []string
+	for field, name := range syslogSDParams {
+		if v := e.Fields[field]; v != "" {
+			params = append(params, name+`="`+syslogParamEscaper.Replace(v)+`"`)
+		}
+	}
+	sort.Strings(params)
+
+	if len(params) == 0 {
+		msg.WriteString(syslogNilValue)
+	} else {
+		msg.WriteString("[" + syslogSDID + " " + strings.Join(params, " ") + "]")
+	}
+
+	if m := e.Message(); m != "" {
+		msg.WriteString(" " + m)
+	}
+	return msg.Bytes()
+}
+
+// Send writes the messages of the entries.
+func (s *SyslogSink) Send(ctx context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.send(ctx, entries); err != nil {
+		// the state of the connection is unknown, a new connection is opened for the next batch.
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *SyslogSink) send(ctx context.Context, entries []Entry) error {
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(syslogTimeout)
+	}
+
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		msg := s.Message(e)
+		if s.network == SyslogUDP {
+			if len(msg) > syslogMaxUDPSize {
+				msg = msg[:syslogMaxUDPSize]
+			}
+		} else {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		if _, err := s.conn.Write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	if s.network != SyslogTLS {
+		return dialer.DialContext(ctx, s.network, s.addr)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.tlsConfig.Clone()
+	if c.ServerName == "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.ServerName = host
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(syslogTimeout)
+	}
+
+	tlsConn := tls.Client(conn, c)
+	tlsConn.SetDeadline(deadline)
+
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (s *SyslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,177 @@
+// Package health runs the probes of the dependencies of dcos-log and reports their results, for the health and
+// readiness endpoints and the systemd watchdog.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/daemon"
+	"github.com/sirupsen/logrus"
+)
+
+// check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check is a named probe of a dependency.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the result of a check.
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the result of all checks, the status is StatusOK if every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Run runs the checks in parallel, each with a given timeout.
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			result := Result{Status: StatusOK}
+			if err := run(checkCtx, check); err != nil {
+				result = Result{Status: StatusFail, Error: err.Error()}
+			}
+			result.Duration = time.Since(start).String()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+// run returns the error of the check or the context error if the check does not return before the timeout, a
+// blocked journal call cannot be canceled.
+func run(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler responds with the report of the checks, 200 if all checks passed, 503 otherwise.
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := Run(req.Context(), timeout, checks)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logrus.Errorf("unable to encode health report: %s", err)
+		}
+	})
+}
+
+// HTTPCheck returns a probe of a service which is reachable if a GET request to the URL returns a status below
+// 500. Authentication errors still prove the service is up.
+func HTTPCheck(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// watchdogInterval returns the systemd watchdog timeout set by WatchdogSec= of the unit, zero if the watchdog is
+// not enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog notifies the systemd watchdog at half of its timeout while the checks pass, so systemd restarts the
+// service when a dependency check keeps failing. It returns at once if the watchdog is not enabled.
+func Watchdog(ctx context.Context, checks ...Check) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		report := Run(ctx, interval/4, checks)
+		if report.Status == StatusOK {
+			if _, err := daemon.SdNotify("WATCHDOG=1"); err != nil {
+				logrus.Errorf("unable to notify systemd watchdog: %s", err)
+			}
+		} else {
+			logrus.Errorf("health check failed, not notifying systemd watchdog: %+v", report.Checks)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
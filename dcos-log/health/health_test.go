@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	ok := Check{Name: "journald", Run: func(context.Context) error { return nil }}
+	fail := Check{Name: "agent", Run: func(context.Context) error { return errors.New("connection refused") }}
+	slow := Check{Name: "auth", Run: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	w := httptest.NewRecorder()
+	Handler(time.Second, ok).ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect status 200. Got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	Handler(50*time.Millisecond, ok, fail, slow).ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expect status 503. Got %d", w.Code)
+	}
+
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Status != StatusFail || report.Checks["journald"].Status != StatusOK ||
+		report.Checks["agent"].Error != "connection refused" || report.Checks["auth"].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusUnauthorized
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	check := HTTPCheck(http.DefaultClient, ts.URL)
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("expect an unauthorized service to be reachable. Got %s", err)
+	}
+
+	status = http.StatusBadGateway
+	if err := check(context.Background()); err == nil {
+		t.Fatal("expect an error for status 502")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	if d := watchdogInterval(); d != 30*time.Second {
+		t.Fatalf("expect 30s. Got %s", d)
+	}
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d := watchdogInterval(); d != 0 {
+		t.Fatalf("expect the watchdog of another process to be ignored. Got %s", d)
+	}
+}
@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ErrBootNotFound is the error returned by OptionBoot if the journal has no boot at the offset.
+var ErrBootNotFound = errors.New("boot not found")
+
+// Boot is a boot of the machine recorded in the journal.
+type Boot struct {
+	ID string
+
+	// First is the time of the first entry of the boot.
+	First time.Time
+}
+
+// Boots returns the boots recorded in the journal, ordered by their first entry, the current boot last.
+// The matches of the journal are flushed.
+func Boots(journal *sdjournal.Journal) ([]Boot, error) {
+	ids, err := journal.GetUniqueValues(sdjournal.SD_JOURNAL_FIELD_BOOT_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	boots := make([]Boot, 0, len(ids))
+	for _, id := range ids {
+		journal.FlushMatches()
+		if err := journal.AddMatch(sdjournal.SD_JOURNAL_FIELD_BOOT_ID + "=" + id); err != nil {
+			return nil, err
+		}
+
+		if err := journal.SeekHead(); err != nil {
+			return nil, err
+		}
+
+		n, err := journal.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// the entries of the boot were vacuumed.
+		if n == 0 {
+			continue
+		}
+
+		usec, err := journal.GetRealtimeUsec()
+		if err != nil {
+			return nil, err
+		}
+		boots = append(boots, Boot{ID: id, First: time.Unix(0, int64(usec)*int64(time.Microsecond))})
+	}
+	journal.FlushMatches()
+
+	sort.Slice(boots, func(i, j int) bool { return boots[i].First.Before(boots[j].First) })
+	return boots, nil
+}
+
+// OptionBoot is a functional option that selects the entries of a boot, 0 is the current boot, -1 is the previous
+// boot and so on. The boots are listed with another instance of the journal, so the option can be combined with
+// other matches in any order. ErrBootNotFound is returned if the journal has no such boot.
+func OptionBoot(offset int) Option {
+	return func(r *Reader) error {
+		if r.Journal == nil {
+			return ErrUninitializedReader
+		}
+
+		if offset > 0 {
+			return ErrBootNotFound
+		}
+
+		journal, err := openJournal(r.dirs)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+
+		boots, err := Boots(journal)
+		if err != nil {
+			return err
+		}
+
+		i := len(boots) - 1 + offset
+		if i < 0 {
+			return ErrBootNotFound
+		}
+
+		return OptionMatch([]JournalEntryMatch{{Field: sdjournal.SD_JOURNAL_FIELD_BOOT_ID, Value: boots[i].ID}})(r)
+	}
+}
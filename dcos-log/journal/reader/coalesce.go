@@ -0,0 +1,72 @@
+package reader
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/transform"
+)
+
+// coalesceFields are the fields of the entries which must be equal for the entries to be repeats of each other.
+var coalesceFields = []string{"MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER", "_SYSTEMD_UNIT"}
+
+// FormatCoalesce wraps an EntryFormatter and collapses the runs of consecutive entries with the same message of the
+// same unit. The first entry of a run is formatted, the repeats are held back. Once the run ends, the last repeat is
+// formatted before the next entry with the message of transform.Repeated and transform.RepeatCountField set to the
+// number of repeats, so its cursor is the position right after the run. A run still going on at the end of a read
+// is sent as its first entry only. It keeps the run of a single reader and must not be shared.
+type FormatCoalesce struct {
+	EntryFormatter
+
+	key     string
+	repeats int
+	last    *sdjournal.JournalEntry
+}
+
+// FormatEntry formats the entry unless it's a repeat of the previous one, the output is empty then.
+func (j *FormatCoalesce) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	key := coalesceKey(entry.Fields)
+	if j.last != nil && key == j.key {
+		j.repeats++
+		j.last = entry
+		return nil, nil
+	}
+
+	var dst []byte
+	if j.repeats > 0 {
+		b, err := j.EntryFormatter.FormatEntry(j.repeated())
+		if err != nil {
+			return nil, err
+		}
+		dst = b
+	}
+
+	j.key, j.repeats, j.last = key, 0, entry
+	b, err := j.EntryFormatter.FormatEntry(entry)
+	return append(dst, b...), err
+}
+
+// repeated returns the entry which ends the run, a single repeat is sent as is.
+func (j *FormatCoalesce) repeated() *sdjournal.JournalEntry {
+	if j.repeats == 1 {
+		return j.last
+	}
+
+	entry := *j.last
+	entry.Fields = make(map[string]string, len(j.last.Fields)+1)
+	for k, v := range j.last.Fields {
+		entry.Fields[k] = v
+	}
+	entry.Fields["MESSAGE"] = transform.Repeated(j.last.Fields["MESSAGE"], j.repeats)
+	entry.Fields[transform.RepeatCountField] = strconv.Itoa(j.repeats)
+	return &entry
+}
+
+func coalesceKey(fields map[string]string) string {
+	values := make([]string, len(coalesceFields))
+	for i, name := range coalesceFields {
+		values[i] = fields[name]
+	}
+	return strings.Join(values, "\x00")
+}
@@ -0,0 +1,51 @@
+package reader
+
+import (
+	"strconv"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+const colorReset = "\x1b[0m"
+
+// priorityColors are the ANSI SGR sequences of the syslog priorities 0-7, notice and info lines are not colored.
+var priorityColors = []string{
+	"\x1b[1;35m", // emerg
+	"\x1b[1;35m", // alert
+	"\x1b[1;31m", // crit
+	"\x1b[31m",   // err
+	"\x1b[33m",   // warning
+	"",           // notice
+	"",           // info
+	"\x1b[2m",    // debug
+}
+
+// FormatColor implements EntryFormatter for text logs colored by the entry PRIORITY, for terminals.
+type FormatColor struct {
+	FormatText
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a colored text log line.
+func (j FormatColor) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a text log line to dst, the line is wrapped with the color of the entry priority.
+func (j FormatColor) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	priority, err := strconv.Atoi(entry.Fields["PRIORITY"])
+	if err != nil || priority < 0 || priority >= len(priorityColors) || priorityColors[priority] == "" {
+		return j.FormatText.AppendEntry(dst, entry)
+	}
+
+	start := len(dst)
+	dst = append(dst, priorityColors[priority]...)
+	dst, err = j.FormatText.AppendEntry(dst, entry)
+	if err != nil || len(dst) == start+len(priorityColors[priority]) {
+		// the entry has no message.
+		return dst[:start], err
+	}
+
+	// the reset goes before the newline, so a terminal does not color the next line.
+	dst = append(dst[:len(dst)-1], colorReset...)
+	return append(dst, '\n'), nil
+}
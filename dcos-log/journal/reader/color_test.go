@@ -0,0 +1,50 @@
+package reader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatColor(t *testing.T) {
+	ts := time.Unix(1500000000, 0).Format("2006-01-02 15:04:05")
+	for _, tc := range []struct {
+		fields   map[string]string
+		expected string
+	}{
+		{
+			fields:   map[string]string{"MESSAGE": "refused", "PRIORITY": "3"},
+			expected: "\x1b[31m" + ts + ": refused\x1b[0m\n",
+		},
+		{
+			fields:   map[string]string{"MESSAGE": "retrying", "PRIORITY": "4"},
+			expected: "\x1b[33m" + ts + ": retrying\x1b[0m\n",
+		},
+		{
+			fields:   map[string]string{"MESSAGE": "started", "PRIORITY": "6"},
+			expected: ts + ": started\n",
+		},
+		{
+			fields:   map[string]string{"MESSAGE": "started"},
+			expected: ts + ": started\n",
+		},
+		{
+			fields: map[string]string{"PRIORITY": "3"},
+		},
+	} {
+		entry := &sdjournal.JournalEntry{RealtimeTimestamp: 1500000000123456, Fields: tc.fields}
+		b, err := FormatColor{}.FormatEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tc.expected {
+			t.Fatalf("expect %q. Got %q", tc.expected, b)
+		}
+	}
+
+	if ct := (FormatColor{}).GetContentType(); ct != ContentTypePlainText {
+		t.Fatalf("expect %s. Got %s", ContentTypePlainText, ct)
+	}
+}
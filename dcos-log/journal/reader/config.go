@@ -1,7 +1,10 @@
 package reader
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,7 +14,7 @@ import (
 )
 
 var (
-	// ErrCursorFormat is the error thrown by OptionSeekCursor if cursor string is invalid.
+	// ErrCursorFormat is the error thrown by OptionSeekCursor and ValidateCursor if cursor string is invalid.
 	ErrCursorFormat = errors.New("Incorrect cursor string")
 
 	// ErrInvalidDuration is the error thrown by OptionSince if negative or zero duration used.
@@ -23,7 +26,8 @@ type Option func(*Reader) error
 
 // OptionReadReverse is a functional option sets a reverse direction to read the journal.
 // By default we always read the journal up to down. If we use this option, we'll be reading the journal
-// in reverse.
+// in reverse. It must precede OptionSince, OptionSinceTime and OptionUntil, which bound the range instead of
+// seeking in reverse.
 func OptionReadReverse(reverse bool) Option {
 	return func(r *Reader) error {
 		r.ReadReverse = reverse
@@ -31,6 +35,14 @@ func OptionReadReverse(reverse bool) Option {
 	}
 }
 
+// OptionSeekTail is a functional option that moves the reader after the last entry, reading in reverse returns the
+// newest entry first.
+func OptionSeekTail() Option {
+	return func(r *Reader) error {
+		return seekError(seekTail, r.Journal.SeekTail())
+	}
+}
+
 // OptionLimit is a functional option sets a limit of entries to read from a journal.
 func OptionLimit(n uint64) Option {
 	return func(r *Reader) error {
@@ -64,7 +76,7 @@ func OptionMatch(m []JournalEntryMatch) Option {
 }
 
 // OptionMatchOR is a functional option that filters entries and applies logical OR to user
-// arguments []JournalEntryMatch.
+// arguments []JournalEntryMatch. The matches added after it are joined with AND to the whole group.
 func OptionMatchOR(m []JournalEntryMatch) Option {
 	return func(r *Reader) error {
 		if r.Journal == nil {
@@ -77,6 +89,9 @@ func OptionMatchOR(m []JournalEntryMatch) Option {
 				journal.AddDisjunction()
 				logrus.Infof("adding OR match %s", match)
 			}
+
+			// without a conjunction the next matches would be another term of the disjunction.
+			journal.AddConjunction()
 		}
 
 		// apply matches for current optional parameter
@@ -96,7 +111,7 @@ func OptionSeekCursor(c string) Option {
 			return nil
 		}
 
-		if err := validateCursor(c); err != nil {
+		if err := ValidateCursor(c); err != nil {
 			return err
 		}
 
@@ -116,6 +131,7 @@ func OptionSkipNext(n uint64) Option {
 }
 
 // OptionSkipPrev is a functional option that skips backward N journal entries from the current cursor position.
+// Only the entries passing the filters are counted if it is set after OptionFilter.
 func OptionSkipPrev(n uint64) Option {
 	return func(r *Reader) error {
 		if n > 0 {
@@ -131,8 +147,98 @@ func OptionSince(d time.Duration) Option {
 		if d <= 0 {
 			return ErrInvalidDuration
 		}
-		start := time.Now().Add(-d)
-		return r.Journal.SeekRealtimeUsec(uint64(start.UnixNano() / 1000))
+		return OptionSinceTime(time.Now().Add(-d))(r)
+	}
+}
+
+// OptionSinceTime is a functional option that moves the reader to the first entry at or after t. Reading in
+// reverse stops at the first entry before t instead, Read returns io.EOF.
+func OptionSinceTime(t time.Time) Option {
+	return func(r *Reader) error {
+		if t.IsZero() {
+			return nil
+		}
+
+		if r.ReadReverse {
+			r.since = t
+			return nil
+		}
+		return seekError(seekRealtime, r.Journal.SeekRealtimeUsec(uint64(t.UnixNano()/1000)))
+	}
+}
+
+// OptionUntil is a functional option that stops the reader at the first entry after t, the same as
+// journalctl --until. Read returns io.EOF and Follow returns ErrRangeEnd once the entry is read. Reading in
+// reverse moves the reader to the last entry at or before t instead.
+func OptionUntil(t time.Time) Option {
+	return func(r *Reader) error {
+		r.until = t
+		if r.ReadReverse && !t.IsZero() {
+			// the entries at t are before the position, the realtime is in microseconds.
+			return seekError(seekRealtime, r.Journal.SeekRealtimeUsec(uint64(t.UnixNano()/1000)+1))
+		}
+		return nil
+	}
+}
+
+// OptionFilter is a functional option that skips the entries for which fn returns false. Unlike the matches,
+// the filter is applied after the entry is read. Several filters must all match.
+func OptionFilter(fn func(*sdjournal.JournalEntry) bool) Option {
+	return func(r *Reader) error {
+		if prev := r.filter; prev != nil {
+			r.filter = func(entry *sdjournal.JournalEntry) bool { return prev(entry) && fn(entry) }
+			return nil
+		}
+		r.filter = fn
+		return nil
+	}
+}
+
+// OptionFilterPattern is a functional option that skips the entries whose MESSAGE does not match an RE2
+// regular expression, see OptionFilter.
+func OptionFilterPattern(pattern string) Option {
+	return func(r *Reader) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid filter pattern: %s", err)
+		}
+
+		return OptionFilter(func(entry *sdjournal.JournalEntry) bool {
+			return re.MatchString(entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE])
+		})(r)
+	}
+}
+
+// OptionMaxEntrySize is a functional option that truncates the largest fields of the entries which are larger
+// than n bytes, see TruncatedSizeField. Zero disables the truncation.
+func OptionMaxEntrySize(n int) Option {
+	return func(r *Reader) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max entry size %d. Must be zero or positive integer", n)
+		}
+		r.maxEntrySize = n
+		return nil
+	}
+}
+
+// OptionHeartbeat is a functional option that sets the interval of the ping comments sent on an idle event
+// stream, 15 seconds by default. Zero disables the comments.
+func OptionHeartbeat(d time.Duration) Option {
+	return func(r *Reader) error {
+		if d < 0 {
+			return fmt.Errorf("invalid heartbeat %s. Must be zero or positive duration", d)
+		}
+		r.heartbeat = d
+		return nil
+	}
+}
+
+// OptionContext is a functional option that stops the reader when the context is done, Read returns
+// the error of the context.
+func OptionContext(ctx context.Context) Option {
+	return func(r *Reader) error {
+		r.ctx = ctx
+		return nil
 	}
 }
 
@@ -146,7 +252,48 @@ func (m *JournalEntryMatch) String() string {
 	return m.Field + "=" + m.Value
 }
 
-func validateCursor(c string) error {
+// MatchTree returns the expression journald evaluates for the matches of OptionMatchOR with or followed by
+// OptionMatch with and. The matches of the same field are joined with OR, the fields with AND, e.g.
+// (UNIT=a OR _SYSTEMD_UNIT=a) AND (_SYSTEMD_UNIT=b OR _SYSTEMD_UNIT=c) AND PRIORITY=3.
+func MatchTree(or, and []JournalEntryMatch) string {
+	var terms [][]JournalEntryMatch
+	if len(or) > 0 {
+		terms = append(terms, or)
+	}
+
+	var fields []string
+	byField := make(map[string][]JournalEntryMatch)
+	for _, m := range and {
+		if _, ok := byField[m.Field]; !ok {
+			fields = append(fields, m.Field)
+		}
+		byField[m.Field] = append(byField[m.Field], m)
+	}
+
+	for _, field := range fields {
+		terms = append(terms, byField[field])
+	}
+
+	s := make([]string, 0, len(terms))
+	for _, term := range terms {
+		matches := make([]string, 0, len(term))
+		for _, m := range term {
+			matches = append(matches, m.String())
+		}
+
+		disjunction := strings.Join(matches, " OR ")
+		if len(matches) > 1 && len(terms) > 1 {
+			disjunction = "(" + disjunction + ")"
+		}
+		s = append(s, disjunction)
+	}
+	return strings.Join(s, " AND ")
+}
+
+// ValidateCursor returns ErrCursorFormat if c is not a journald cursor: s=, i=, b=, m=, t= and x= fields separated by
+// semicolons, the ids at most 33 characters long and the others hexadecimal numbers. Whether the journal still has
+// the entry is checked by OptionSeekCursor.
+func ValidateCursor(c string) error {
 	parseKeyValueStr := func(s string) (string, string, error) {
 		sArray := strings.Split(s, "=")
 		if len(sArray) != 2 {
@@ -1,6 +1,11 @@
 package reader
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
 
 func TestValidateCursor(t *testing.T) {
 	validCursors := []string{
@@ -23,14 +28,113 @@ func TestValidateCursor(t *testing.T) {
 	}
 
 	for _, validCursor := range validCursors {
-		if err := validateCursor(validCursor); err != nil {
+		if err := ValidateCursor(validCursor); err != nil {
 			t.Fatalf("Cursor %s is valid, but did not pass validation", validCursor)
 		}
 	}
 
 	for _, invalidCursor := range invalidCursors {
-		if err := validateCursor(invalidCursor); err == nil {
+		if err := ValidateCursor(invalidCursor); err == nil {
 			t.Fatalf("Cursor %s must be invalid, but it was validated", invalidCursor)
 		}
 	}
 }
+
+func TestOptionUntil(t *testing.T) {
+	until := time.Unix(1500000000, 0)
+	r := &Reader{}
+	if err := OptionUntil(until)(r); err != nil {
+		t.Fatal(err)
+	}
+
+	before := &sdjournal.JournalEntry{RealtimeTimestamp: uint64(until.UnixNano() / 1000)}
+	if r.afterUntil(before) {
+		t.Fatal("expect an entry at until to be in the range")
+	}
+
+	after := &sdjournal.JournalEntry{RealtimeTimestamp: before.RealtimeTimestamp + 1}
+	if !r.afterUntil(after) {
+		t.Fatal("expect an entry after until to be out of the range")
+	}
+
+	if (&Reader{}).afterUntil(after) {
+		t.Fatal("expect no time range without OptionUntil")
+	}
+}
+
+func TestOptionHeartbeat(t *testing.T) {
+	r := &Reader{heartbeat: defaultHeartbeat}
+	if err := OptionHeartbeat(0)(r); err != nil || r.heartbeat != 0 {
+		t.Fatalf("expect the heartbeat to be disabled. Got %s, %v", r.heartbeat, err)
+	}
+
+	if err := OptionHeartbeat(-time.Second)(r); err == nil {
+		t.Fatal("expect an error for a negative heartbeat")
+	}
+}
+
+func TestOptionFilterPattern(t *testing.T) {
+	r := &Reader{}
+	if err := OptionFilterPattern(`^conn.*refused$`)(r); err != nil {
+		t.Fatal(err)
+	}
+
+	// filters are joined with AND.
+	if err := OptionFilter(func(entry *sdjournal.JournalEntry) bool { return entry.Fields["_PID"] == "1" })(r); err != nil {
+		t.Fatal(err)
+	}
+
+	for message, expect := range map[string]bool{"connection refused": true, "refused connection": false} {
+		if r.filter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": message, "_PID": "1"}}) != expect {
+			t.Fatalf("%s: expect %t", message, expect)
+		}
+	}
+
+	if r.filter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "connection refused", "_PID": "2"}}) {
+		t.Fatal("expect the second filter to apply")
+	}
+
+	if err := OptionFilterPattern(`(`)(&Reader{}); err == nil {
+		t.Fatal("expect an error on invalid pattern")
+	}
+}
+
+func TestSeekError(t *testing.T) {
+	before := seekErrors.WithLabelValues(seekCursor).Value()
+	if err := seekError(seekCursor, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seekError(seekCursor, ErrInvalidDuration); err != ErrInvalidDuration {
+		t.Fatalf("expect %s. Got %v", ErrInvalidDuration, err)
+	}
+
+	if v := seekErrors.WithLabelValues(seekCursor).Value(); v != before+1 {
+		t.Fatalf("expect 1 seek error. Got %v", v-before)
+	}
+}
+
+func TestMatchTree(t *testing.T) {
+	component := []JournalEntryMatch{{Field: "UNIT", Value: "a"}, {Field: "_SYSTEMD_UNIT", Value: "a"}}
+	filters := []JournalEntryMatch{
+		{Field: "_SYSTEMD_UNIT", Value: "b"},
+		{Field: "PRIORITY", Value: "3"},
+		{Field: "_SYSTEMD_UNIT", Value: "c"},
+	}
+
+	for _, tc := range []struct {
+		or, and  []JournalEntryMatch
+		expected string
+	}{
+		{expected: ""},
+		{or: component, expected: "UNIT=a OR _SYSTEMD_UNIT=a"},
+		{and: filters[:1], expected: "_SYSTEMD_UNIT=b"},
+		{and: filters, expected: "(_SYSTEMD_UNIT=b OR _SYSTEMD_UNIT=c) AND PRIORITY=3"},
+		{or: component, and: filters,
+			expected: "(UNIT=a OR _SYSTEMD_UNIT=a) AND (_SYSTEMD_UNIT=b OR _SYSTEMD_UNIT=c) AND PRIORITY=3"},
+	} {
+		if tree := MatchTree(tc.or, tc.and); tree != tc.expected {
+			t.Fatalf("expect %s. Got %s", tc.expected, tree)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ContentTypeCSV is a ContentType header for CSV logs.
+var ContentTypeCSV ContentType = "text/csv"
+
+// DefaultCSVColumns are the columns of FormatCSV if no columns are set.
+var DefaultCSVColumns = []string{"timestamp", "host", "unit", "pid", "message"}
+
+// csvColumns are the named columns, the other columns are journal field names.
+var csvColumns = map[string]func(entry *sdjournal.JournalEntry) string{
+	"timestamp": func(entry *sdjournal.JournalEntry) string {
+		// entry.RealtimeTimestamp returns a unix time in microseconds
+		t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+		return t.UTC().Format(time.RFC3339Nano)
+	},
+	"host": func(entry *sdjournal.JournalEntry) string { return entry.Fields["_HOSTNAME"] },
+	"unit": func(entry *sdjournal.JournalEntry) string {
+		if unit := entry.Fields["_SYSTEMD_UNIT"]; unit != "" {
+			return unit
+		}
+		return entry.Fields["UNIT"]
+	},
+	"pid":     func(entry *sdjournal.JournalEntry) string { return entry.Fields["_PID"] },
+	"message": func(entry *sdjournal.JournalEntry) string { return entry.Fields["MESSAGE"] },
+	"cursor":  func(entry *sdjournal.JournalEntry) string { return entry.Cursor },
+}
+
+// FormatCSV implements EntryFormatter for CSV logs, a record per entry with RFC 4180 quoting. The first entry is
+// preceded by a header record with the column names.
+type FormatCSV struct {
+	// Columns are timestamp, host, unit, pid, message, cursor or a journal field name. DefaultCSVColumns are used
+	// if empty.
+	Columns []string
+
+	wroteHeader bool
+}
+
+// GetContentType returns "text/csv"
+func (j *FormatCSV) GetContentType() ContentType {
+	return ContentTypeCSV
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a CSV record.
+func (j *FormatCSV) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a CSV record to dst, the header record is appended before the first one.
+func (j *FormatCSV) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	columns := j.Columns
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+
+	buf := bytes.NewBuffer(dst)
+	w := csv.NewWriter(buf)
+	if !j.wroteHeader {
+		j.wroteHeader = true
+		if err := w.Write(columns); err != nil {
+			return dst, err
+		}
+	}
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		if value, ok := csvColumns[column]; ok {
+			record[i] = value(entry)
+		} else {
+			record[i] = entry.Fields[strings.ToUpper(column)]
+		}
+	}
+
+	if err := w.Write(record); err != nil {
+		return dst, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
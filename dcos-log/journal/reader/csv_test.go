@@ -0,0 +1,51 @@
+package reader
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatCSV(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1",
+		RealtimeTimestamp: 1500000000012345,
+		Fields: map[string]string{
+			"MESSAGE":       "connection \"refused\", retrying\nin 5s",
+			"_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME":     "agent1",
+			"_PID":          "42",
+			"PRIORITY":      "3",
+		},
+	}
+
+	formatter := NewEntryFormatter(ContentTypeCSV.String(), false)
+	first, err := formatter.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "timestamp,host,unit,pid,message\n" +
+		"2017-07-14T02:40:00.012345Z,agent1,dcos-mesos-slave.service,42,\"connection \"\"refused\"\", retrying\nin 5s\"\n"
+	if string(first) != expect {
+		t.Fatalf("expect %q. Got %q", expect, first)
+	}
+
+	second, err := formatter.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(second) != expect[len("timestamp,host,unit,pid,message\n"):] {
+		t.Fatalf("expect the header once. Got %q", second)
+	}
+
+	b, err := (&FormatCSV{Columns: []string{"priority", "cursor"}}).AppendEntry([]byte("prefix\n"), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "prefix\npriority,cursor\n3,s=1\n" {
+		t.Fatalf("unexpected record %q", b)
+	}
+}
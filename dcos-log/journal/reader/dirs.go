@@ -0,0 +1,77 @@
+package reader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ErrMatchesBeforeDirectories is the error returned by OptionDirectories if it follows a match option.
+var ErrMatchesBeforeDirectories = errors.New("OptionDirectories must precede the matches")
+
+// OptionDirectories is a functional option that reads the journal files of the directories instead of the local
+// journal, such as /var/log/journal/remote or a journal directory copied from another host. The entries of several
+// directories are merged. The matches are applied to the opened journal, so it must precede the match options.
+func OptionDirectories(dirs ...string) Option {
+	return func(r *Reader) error {
+		if len(dirs) == 0 {
+			return nil
+		}
+
+		if len(r.matchFns) > 0 {
+			return ErrMatchesBeforeDirectories
+		}
+
+		journal, err := openJournal(dirs)
+		if err != nil {
+			return err
+		}
+
+		if r.Journal != nil {
+			r.Journal.Close()
+		}
+		r.Journal, r.dirs = journal, dirs
+		return nil
+	}
+}
+
+// openJournal opens the local journal or the journal files of the directories. sd_journal_open_directory opens
+// a single directory and its subdirectories named by machine IDs, so several directories are merged by linking
+// them under random machine IDs in a temporary directory. The journal files are opened right away, the temporary
+// directory is removed once the journal is open.
+func openJournal(dirs []string) (*sdjournal.Journal, error) {
+	switch len(dirs) {
+	case 0:
+		return sdjournal.NewJournal()
+	case 1:
+		return sdjournal.NewJournalFromDir(dirs[0])
+	}
+
+	root, err := ioutil.TempDir("", "dcos-log-journal")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+
+		if err := os.Symlink(abs, filepath.Join(root, hex.EncodeToString(id))); err != nil {
+			return nil, err
+		}
+	}
+	return sdjournal.NewJournalFromDir(root)
+}
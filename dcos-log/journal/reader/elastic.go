@@ -0,0 +1,199 @@
+package reader
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ContentTypeElasticBulk is a ContentType header for Elasticsearch bulk API logs.
+var ContentTypeElasticBulk ContentType = "application/x-elasticsearch-bulk"
+
+// syslogLevels are the syslog priority names used as ECS log.level.
+var syslogLevels = []string{"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug"}
+
+// ecsFields are the journal fields mapped to ECS fields, the other fields are stored as labels.
+var ecsFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_FACILITY":   true,
+	"SYSLOG_IDENTIFIER": true,
+	"_HOSTNAME":         true,
+	"_PID":              true,
+	"_COMM":             true,
+	"_EXE":              true,
+	"_CMDLINE":          true,
+	"_UID":              true,
+	"_SYSTEMD_UNIT":     true,
+	"UNIT":              true,
+	"_TRANSPORT":        true,
+}
+
+type ecsDocument struct {
+	Timestamp string            `json:"@timestamp"`
+	Message   string            `json:"message"`
+	Host      *ecsHost          `json:"host,omitempty"`
+	Log       *ecsLog           `json:"log,omitempty"`
+	Event     ecsEvent          `json:"event"`
+	Process   *ecsProcess       `json:"process,omitempty"`
+	User      *ecsUser          `json:"user,omitempty"`
+	Systemd   *ecsSystemd       `json:"systemd,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type ecsHost struct {
+	Name string `json:"name"`
+}
+
+type ecsLog struct {
+	Level  string     `json:"level,omitempty"`
+	Syslog *ecsSyslog `json:"syslog,omitempty"`
+}
+
+type ecsSyslog struct {
+	Priority *int            `json:"priority,omitempty"`
+	Facility *ecsFacility    `json:"facility,omitempty"`
+	Appname  string          `json:"appname,omitempty"`
+	Severity *ecsSyslogLevel `json:"severity,omitempty"`
+}
+
+type ecsFacility struct {
+	Code int `json:"code"`
+}
+
+type ecsSyslogLevel struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+type ecsEvent struct {
+	Dataset string `json:"dataset"`
+}
+
+type ecsProcess struct {
+	PID         int    `json:"pid,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Executable  string `json:"executable,omitempty"`
+	CommandLine string `json:"command_line,omitempty"`
+}
+
+type ecsUser struct {
+	ID string `json:"id"`
+}
+
+type ecsSystemd struct {
+	Unit      string `json:"unit,omitempty"`
+	Transport string `json:"transport,omitempty"`
+}
+
+// newECSDocument converts a journal entry to an ECS document.
+func newECSDocument(entry *sdjournal.JournalEntry) ecsDocument {
+	f := entry.Fields
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	doc := ecsDocument{
+		Timestamp: t.UTC().Format(time.RFC3339Nano),
+		Message:   f["MESSAGE"],
+		Event:     ecsEvent{Dataset: "journald"},
+	}
+
+	if f["_HOSTNAME"] != "" {
+		doc.Host = &ecsHost{Name: f["_HOSTNAME"]}
+	}
+
+	syslog := &ecsSyslog{Appname: f["SYSLOG_IDENTIFIER"]}
+	if priority, err := strconv.Atoi(f["PRIORITY"]); err == nil && priority >= 0 && priority < len(syslogLevels) {
+		syslog.Severity = &ecsSyslogLevel{Code: priority, Name: syslogLevels[priority]}
+		doc.Log = &ecsLog{Level: syslogLevels[priority]}
+	}
+
+	if facility, err := strconv.Atoi(f["SYSLOG_FACILITY"]); err == nil {
+		syslog.Facility = &ecsFacility{Code: facility}
+		if syslog.Severity != nil {
+			priority := facility*8 + syslog.Severity.Code
+			syslog.Priority = &priority
+		}
+	}
+
+	if syslog.Appname != "" || syslog.Severity != nil || syslog.Facility != nil {
+		if doc.Log == nil {
+			doc.Log = &ecsLog{}
+		}
+		doc.Log.Syslog = syslog
+	}
+
+	process := &ecsProcess{Name: f["_COMM"], Executable: f["_EXE"], CommandLine: f["_CMDLINE"]}
+	process.PID, _ = strconv.Atoi(f["_PID"])
+	if *process != (ecsProcess{}) {
+		doc.Process = process
+	}
+
+	if f["_UID"] != "" {
+		doc.User = &ecsUser{ID: f["_UID"]}
+	}
+
+	unit := f["_SYSTEMD_UNIT"]
+	if unit == "" {
+		unit = f["UNIT"]
+	}
+
+	if unit != "" || f["_TRANSPORT"] != "" {
+		doc.Systemd = &ecsSystemd{Unit: unit, Transport: f["_TRANSPORT"]}
+	}
+
+	if unit != "" {
+		doc.Event.Dataset = strings.TrimSuffix(unit, ".service")
+	}
+
+	for k, v := range f {
+		if ecsFields[k] {
+			continue
+		}
+
+		if doc.Labels == nil {
+			doc.Labels = make(map[string]string)
+		}
+		doc.Labels[strings.ToLower(strings.TrimLeft(k, "_"))] = v
+	}
+
+	return doc
+}
+
+// FormatElasticBulk implements EntryFormatter for Elasticsearch bulk API. Each entry is an index action
+// followed by an ECS document. The journal cursor is used as a document ID, so indexing the same range
+// twice does not create duplicates.
+type FormatElasticBulk struct {
+	// Index is the target index, if empty the index must be set in the bulk request URL.
+	Index string
+}
+
+// GetContentType returns "application/x-elasticsearch-bulk"
+func (j FormatElasticBulk) GetContentType() ContentType {
+	return ContentTypeElasticBulk
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a bulk API action and document pair.
+func (j FormatElasticBulk) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	type indexAction struct {
+		Index string `json:"_index,omitempty"`
+		ID    string `json:"_id,omitempty"`
+	}
+
+	action, err := json.Marshal(map[string]indexAction{"index": {Index: j.Index, ID: entry.Cursor}})
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := json.Marshal(newECSDocument(entry))
+	if err != nil {
+		return nil, err
+	}
+
+	line := append(action, '\n')
+	line = append(line, doc...)
+	return append(line, '\n'), nil
+}
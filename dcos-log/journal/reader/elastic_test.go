@@ -0,0 +1,67 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatElasticBulk(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1;i=2",
+		RealtimeTimestamp: 1500000000123456,
+		Fields: map[string]string{
+			"MESSAGE":           "connection refused",
+			"PRIORITY":          "3",
+			"SYSLOG_FACILITY":   "3",
+			"SYSLOG_IDENTIFIER": "mesos-agent",
+			"_SYSTEMD_UNIT":     "dcos-mesos-slave.service",
+			"_HOSTNAME":         "agent1",
+			"_PID":              "42",
+			"FRAMEWORK_ID":      "fw",
+		},
+	}
+
+	b, err := FormatElasticBulk{Index: "dcos-logs"}.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expect action and document lines. Got %s", b)
+	}
+
+	expectedAction := `{"index":{"_index":"dcos-logs","_id":"s=1;i=2"}}`
+	if string(lines[0]) != expectedAction {
+		t.Fatalf("expect %s. Got %s", expectedAction, lines[0])
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(lines[1], &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["@timestamp"] != "2017-07-14T02:40:00.123456Z" || doc["message"] != "connection refused" {
+		t.Fatalf("unexpected document %s", lines[1])
+	}
+
+	if doc["host"].(map[string]interface{})["name"] != "agent1" {
+		t.Fatalf("expect host.name agent1. Got %s", lines[1])
+	}
+
+	log := doc["log"].(map[string]interface{})
+	if log["level"] != "error" || log["syslog"].(map[string]interface{})["priority"] != float64(27) {
+		t.Fatalf("unexpected log fields %v", log)
+	}
+
+	if doc["event"].(map[string]interface{})["dataset"] != "dcos-mesos-slave" {
+		t.Fatalf("expect event.dataset dcos-mesos-slave. Got %s", lines[1])
+	}
+
+	if doc["labels"].(map[string]interface{})["framework_id"] != "fw" {
+		t.Fatalf("expect labels.framework_id. Got %s", lines[1])
+	}
+}
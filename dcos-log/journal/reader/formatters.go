@@ -1,8 +1,9 @@
 package reader
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-systemd/sdjournal"
@@ -22,18 +23,12 @@ var (
 	ContentTypeEventStream ContentType = "text/event-stream"
 )
 
-// NewEntryFormatter returns a new implementation of EntryFormatter corresponding to a given content type.
+// NewEntryFormatter returns a new implementation of EntryFormatter corresponding to a given content type, see
+// RegisterFormat. Text formatter is returned for the unknown content types.
 func NewEntryFormatter(s string, useCursorID bool) EntryFormatter {
-	if s == ContentTypeApplicationJSON.String() {
-		return &FormatJSON{}
+	if f, ok := formatByContentType(s); ok {
+		return f.New(useCursorID)
 	}
-
-	if s == ContentTypeEventStream.String() {
-		return &FormatSSE{
-			UseCursorID: useCursorID,
-		}
-	}
-
 	return &FormatText{}
 }
 
@@ -51,6 +46,21 @@ type EntryFormatter interface {
 	FormatEntry(*sdjournal.JournalEntry) ([]byte, error)
 }
 
+// EntryAppender is implemented by the formatters which can append an entry to a buffer. Reader reuses a single
+// buffer for all entries of such formatters instead of allocating a new slice per entry.
+type EntryAppender interface {
+	// AppendEntry appends the formatted entry to dst and returns the extended buffer.
+	AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error)
+}
+
+// maxPooledBufferSize is the maximum capacity of a buffer kept for reuse, so a single huge entry does not
+// pin the memory.
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
 // FormatText implements EntryFormatter for text logs.
 type FormatText struct{}
 
@@ -61,22 +71,31 @@ func (j FormatText) GetContentType() ContentType {
 
 // FormatEntry formats sdjournal.JournalEntry to a text log line.
 func (j FormatText) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a text log line to dst.
+func (j FormatText) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
 	// return empty if field MESSAGE not found
 	message, ok := entry.Fields["MESSAGE"]
 	if !ok {
-		return nil, nil
+		return dst, nil
 	}
 
 	// entry.RealtimeTimestamp returns a unix time in microseconds
 	// https://www.freedesktop.org/software/systemd/man/sd_journal_get_realtime_usec.html
 	t := time.Unix(int64(entry.RealtimeTimestamp)/1000000, 0)
-	line := []byte(fmt.Sprintf("%s: %s\n", t.Format("2006-01-02 15:04:05"), message))
-
-	return line, nil
+	dst = t.AppendFormat(dst, "2006-01-02 15:04:05")
+	dst = append(dst, ": "...)
+	dst = append(dst, message...)
+	return append(dst, '\n'), nil
 }
 
 // FormatJSON implements EntryFormatter for json logs.
-type FormatJSON struct{}
+type FormatJSON struct {
+	// Fields are the entry fields included in the output, all fields are included if empty.
+	Fields []string
+}
 
 // GetContentType returns "application/json"
 func (j FormatJSON) GetContentType() ContentType {
@@ -85,19 +104,21 @@ func (j FormatJSON) GetContentType() ContentType {
 
 // FormatEntry formats sdjournal.JournalEntry to a json log entry.
 func (j FormatJSON) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
-	entryBytes, err := marshalJournalEntry(entry)
-	if err != nil {
-		return entryBytes, err
-	}
+	return j.AppendEntry(nil, entry)
+}
 
-	entryPostfix := []byte("\n")
-	return append(entryBytes, entryPostfix...), nil
+// AppendEntry appends a json log entry to dst.
+func (j FormatJSON) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	return appendJournalEntry(dst, entry, j.Fields)
 }
 
 // FormatSSE implements EntryFormatter for server sent event logs.
 // Must be in the following format: data: {...}\n\n
 type FormatSSE struct {
 	UseCursorID bool
+
+	// Fields are the entry fields included in the output, all fields are included if empty.
+	Fields []string
 }
 
 // GetContentType returns "text/event-stream"
@@ -107,37 +128,130 @@ func (j FormatSSE) GetContentType() ContentType {
 
 // FormatEntry formats sdjournal.JournalEntry to a server sent event log entry.
 func (j FormatSSE) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
-	// Server sent events require \n\n at the end of the entry.
-	entryBytes, err := marshalJournalEntry(entry)
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a server sent event log entry to dst.
+func (j FormatSSE) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	// if FormatSSE was initiated with useCursorID flag, then add id: cursor before the data.
+	if j.UseCursorID {
+		dst = append(dst, "id: "...)
+		dst = append(dst, entry.Cursor...)
+		dst = append(dst, '\n')
+	}
+
+	// Server sent events require \n\n at the end of the entry, the json entry ends with the first one.
+	dst = append(dst, "data: "...)
+	dst, err := appendJournalEntry(dst, entry, j.Fields)
 	if err != nil {
-		return entryBytes, err
+		return dst, err
 	}
+	return append(dst, '\n'), nil
+}
 
-	entryPrefix := []byte("data: ")
-	entryPostfix := []byte("\n\n")
-	entryWithPostfix := append(entryBytes, entryPostfix...)
-	entrySSE := append(entryPrefix, entryWithPostfix...)
+// projectFields returns the given fields of an entry, the fields an entry does not have are omitted.
+func projectFields(fields map[string]string, names []string) map[string]string {
+	if len(names) == 0 {
+		return fields
+	}
 
-	// if FormatSSE was initiated with useCursorID flag, then add id: cursor before the data.
-	if j.UseCursorID {
-		id := []byte(fmt.Sprintf("id: %s\n", entry.Cursor))
-		entrySSE = append(id, entrySSE...)
+	projected := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, ok := fields[name]; ok {
+			projected[name] = value
+		}
 	}
-	return entrySSE, nil
+	return projected
 }
 
-func marshalJournalEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+// appendJournalEntry appends the json encoded entry followed by a new line to dst. Only the given fields
+// are encoded if names is not empty.
+func appendJournalEntry(dst []byte, entry *sdjournal.JournalEntry, names []string) ([]byte, error) {
 	formattedEntry := struct {
 		Fields             map[string]string `json:"fields"`
 		Cursor             string            `json:"cursor"`
 		MonotonicTimestamp uint64            `json:"monotonic_timestamp"`
 		RealtimeTimestamp  uint64            `json:"realtime_timestamp"`
 	}{
-		Fields:             entry.Fields,
+		Fields:             projectFields(entry.Fields, names),
 		Cursor:             entry.Cursor,
 		MonotonicTimestamp: entry.MonotonicTimestamp,
 		RealtimeTimestamp:  entry.RealtimeTimestamp,
 	}
 
-	return json.Marshal(formattedEntry)
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	// Encode writes the same bytes as json.Marshal and a new line, without allocating the result.
+	if err := json.NewEncoder(buf).Encode(formattedEntry); err != nil {
+		return dst, err
+	}
+	return append(dst, buf.Bytes()...), nil
+}
+
+// FormatTransform wraps an EntryFormatter, it calls Pipeline and Fields with a copy of the entry fields and
+// applies Transform to the MESSAGE field before the entry is formatted. The entries Pipeline drops are not
+// formatted, the output is empty.
+type FormatTransform struct {
+	EntryFormatter
+	Transform func(string) string
+	Fields    func(map[string]string)
+	Pipeline  func(map[string]string) bool
+}
+
+// FormatEntry transforms the entry and formats it with the wrapped formatter.
+func (j FormatTransform) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	transformed, ok := j.transform(entry)
+	if !ok {
+		return nil, nil
+	}
+	return j.EntryFormatter.FormatEntry(transformed)
+}
+
+// AppendEntry transforms the entry and appends it to dst, the wrapped formatter is used to append the entry
+// if it implements EntryAppender.
+func (j FormatTransform) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	transformed, ok := j.transform(entry)
+	if !ok {
+		return dst, nil
+	}
+
+	if appender, ok := j.EntryFormatter.(EntryAppender); ok {
+		return appender.AppendEntry(dst, transformed)
+	}
+
+	b, err := j.EntryFormatter.FormatEntry(transformed)
+	return append(dst, b...), err
+}
+
+// transform returns the transformed copy of an entry, false if the entry is dropped.
+func (j FormatTransform) transform(entry *sdjournal.JournalEntry) (*sdjournal.JournalEntry, bool) {
+	if j.Transform == nil && j.Fields == nil && j.Pipeline == nil {
+		return entry, true
+	}
+
+	// the fields map is owned by the caller.
+	transformed := *entry
+	transformed.Fields = make(map[string]string, len(entry.Fields))
+	for k, v := range entry.Fields {
+		transformed.Fields[k] = v
+	}
+
+	if j.Pipeline != nil && !j.Pipeline(transformed.Fields) {
+		return nil, false
+	}
+
+	if j.Fields != nil {
+		j.Fields(transformed.Fields)
+	}
+
+	if message, ok := transformed.Fields["MESSAGE"]; ok && j.Transform != nil {
+		transformed.Fields["MESSAGE"] = j.Transform(message)
+	}
+	return &transformed, true
 }
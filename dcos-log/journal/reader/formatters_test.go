@@ -0,0 +1,179 @@
+package reader
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatTransform(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		RealtimeTimestamp: 1500000000123456,
+		Fields:            map[string]string{"MESSAGE": "hello"},
+	}
+
+	f := FormatTransform{EntryFormatter: FormatText{}, Transform: strings.ToUpper}
+	b, err := f.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(string(b), ": HELLO\n") {
+		t.Fatalf("expect transformed message. Got %s", b)
+	}
+
+	if entry.Fields["MESSAGE"] != "hello" {
+		t.Fatalf("expect the original entry to be unchanged. Got %s", entry.Fields["MESSAGE"])
+	}
+
+	f = FormatTransform{EntryFormatter: FormatJSON{}, Transform: strings.ToUpper, Fields: func(fields map[string]string) {
+		fields["DATACENTER"] = "east"
+		fields["MESSAGE"] += " world"
+	}}
+	if b, err = f.FormatEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `"DATACENTER":"east","MESSAGE":"HELLO WORLD"`) {
+		t.Fatalf("expect annotated entry. Got %s", b)
+	}
+
+	if f.GetContentType() != ContentTypeApplicationJSON {
+		t.Fatalf("expect %s. Got %s", ContentTypeApplicationJSON, f.GetContentType())
+	}
+
+	f = FormatTransform{EntryFormatter: FormatText{}}
+	if f.GetContentType() != ContentTypePlainText {
+		t.Fatalf("expect %s. Got %s", ContentTypePlainText, f.GetContentType())
+	}
+
+	f = FormatTransform{EntryFormatter: FormatText{}, Pipeline: func(fields map[string]string) bool {
+		return fields["MESSAGE"] != "hello"
+	}}
+	if b, err = f.FormatEntry(entry); err != nil || len(b) != 0 {
+		t.Fatalf("expect the entry to be dropped. Got %s", b)
+	}
+
+	if b, err = f.AppendEntry([]byte("previous\n"), entry); err != nil || string(b) != "previous\n" {
+		t.Fatalf("expect the entry to be dropped. Got %s", b)
+	}
+}
+
+func TestFormatCoalesce(t *testing.T) {
+	f := &FormatCoalesce{EntryFormatter: FormatJSON{Fields: []string{"MESSAGE", "REPEAT_COUNT"}}}
+
+	var output []string
+	for i, message := range []string{"one", "spam", "spam", "spam", "two"} {
+		b, err := f.FormatEntry(&sdjournal.JournalEntry{
+			Cursor: strconv.Itoa(i),
+			Fields: map[string]string{"MESSAGE": message, "_SYSTEMD_UNIT": "a.service"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output = append(output, string(b))
+	}
+
+	expected := []string{
+		`{"fields":{"MESSAGE":"one"},"cursor":"0","monotonic_timestamp":0,"realtime_timestamp":0}` + "\n",
+		`{"fields":{"MESSAGE":"spam"},"cursor":"1","monotonic_timestamp":0,"realtime_timestamp":0}` + "\n",
+		"",
+		"",
+		`{"fields":{"MESSAGE":"message repeated 2 times: [spam]","REPEAT_COUNT":"2"},"cursor":"3","monotonic_timestamp":0,"realtime_timestamp":0}` + "\n" +
+			`{"fields":{"MESSAGE":"two"},"cursor":"4","monotonic_timestamp":0,"realtime_timestamp":0}` + "\n",
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("expect %q. Got %q", expected, output)
+	}
+
+	// the same message of another unit is not a repeat.
+	b, _ := f.FormatEntry(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "two", "_SYSTEMD_UNIT": "b.service"}})
+	if len(b) == 0 {
+		t.Fatal("expect an entry of another unit to be formatted")
+	}
+}
+
+func TestAppendEntry(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1",
+		RealtimeTimestamp: 1500000000123456,
+		Fields:            map[string]string{"MESSAGE": "<hello>"},
+	}
+
+	// same as json.Marshal, HTML characters are escaped.
+	expectJSON := `{"fields":{"MESSAGE":"\u003chello\u003e"},"cursor":"s=1","monotonic_timestamp":0,"realtime_timestamp":1500000000123456}`
+	for _, tc := range []struct {
+		formatter EntryFormatter
+		expect    string
+	}{
+		{FormatJSON{}, expectJSON + "\n"},
+		{FormatSSE{}, "data: " + expectJSON + "\n\n"},
+		{FormatSSE{UseCursorID: true}, "id: s=1\ndata: " + expectJSON + "\n\n"},
+		{FormatTransform{EntryFormatter: FormatJSON{}, Transform: strings.ToUpper}, strings.Replace(expectJSON, "hello", "HELLO", 1) + "\n"},
+		{FormatJSON{Fields: []string{"MESSAGE", "_PID"}}, expectJSON + "\n"},
+		{FormatSSE{Fields: []string{"_PID"}}, "data: " + strings.Replace(expectJSON, `"MESSAGE":"\u003chello\u003e"`, "", 1) + "\n\n"},
+	} {
+		b, err := tc.formatter.FormatEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tc.expect {
+			t.Fatalf("expect %s. Got %s", tc.expect, b)
+		}
+
+		// the buffer is reused if it has enough capacity.
+		buf := make([]byte, 3, 1024)
+		appended, err := tc.formatter.(EntryAppender).AppendEntry(buf[:0], entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(appended) != tc.expect || &appended[0] != &buf[:1][0] {
+			t.Fatalf("expect %s appended to the buffer. Got %s", tc.expect, appended)
+		}
+	}
+
+	b, err := FormatText{}.AppendEntry([]byte("prefix "), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(b), "prefix ") || !strings.HasSuffix(string(b), ": <hello>\n") {
+		t.Fatalf("expect text line appended. Got %s", b)
+	}
+
+	if b, _ := (FormatText{}).AppendEntry(nil, &sdjournal.JournalEntry{}); b != nil {
+		t.Fatalf("expect no line without a message. Got %s", b)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	if f, ok := LookupFormat("logfmt"); !ok || f.ContentType != ContentTypeLogfmt {
+		t.Fatalf("expect logfmt format. Got %v", f)
+	}
+
+	if _, ok := LookupFormat(""); ok {
+		t.Fatal("expect the formats without a name not to be found")
+	}
+
+	RegisterFormat(Format{Name: "upper", ContentType: "text/x-upper", New: func(bool) EntryFormatter {
+		return FormatTransform{EntryFormatter: FormatText{}, Transform: strings.ToUpper}
+	}})
+
+	formats := Formats()
+	if last := formats[len(formats)-1]; last.Name != "upper" {
+		t.Fatalf("expect upper format to be registered last. Got %s", last.Name)
+	}
+
+	if _, ok := NewEntryFormatter("text/x-upper", false).(FormatTransform); !ok {
+		t.Fatal("expect the registered formatter")
+	}
+
+	if _, ok := NewEntryFormatter("application/xml", false).(*FormatText); !ok {
+		t.Fatal("expect text formatter for an unknown content type")
+	}
+}
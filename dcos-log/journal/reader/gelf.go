@@ -0,0 +1,80 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ContentTypeGELF is a ContentType header for Graylog Extended Log Format logs.
+var ContentTypeGELF ContentType = "application/x-gelf"
+
+// gelfFieldName is the format of GELF additional field names without the leading underscore.
+var gelfFieldName = regexp.MustCompile(`^[\w.\-]+$`)
+
+// gelfAdditionalField returns the name of a GELF additional field for a journal or task field, the name is
+// lowercase with a single leading underscore. It returns false if the field cannot be sent, GELF reserves _id.
+func gelfAdditionalField(field string) (string, bool) {
+	name := strings.ToLower(strings.TrimLeft(field, "_"))
+	if name == "id" || !gelfFieldName.MatchString(name) {
+		return "", false
+	}
+	return "_" + name, true
+}
+
+// gelfTimestamp returns a GELF timestamp, seconds since the epoch with microsecond precision, of a unix time
+// in microseconds.
+func gelfTimestamp(usec uint64) json.Number {
+	return json.Number(fmt.Sprintf("%d.%06d", usec/1000000, usec%1000000))
+}
+
+// FormatGELF implements EntryFormatter for GELF 1.1 messages, one JSON message per line. The journal fields
+// MESSAGE, _HOSTNAME and PRIORITY are mapped to short_message, host and level, the other fields and the
+// cursor are sent as additional fields.
+type FormatGELF struct{}
+
+// GetContentType returns "application/x-gelf"
+func (j FormatGELF) GetContentType() ContentType {
+	return ContentTypeGELF
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a GELF message.
+func (j FormatGELF) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	f := entry.Fields
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          f["_HOSTNAME"],
+		"short_message": f["MESSAGE"],
+		"timestamp":     gelfTimestamp(entry.RealtimeTimestamp),
+		"_cursor":       entry.Cursor,
+	}
+
+	// host and short_message are required.
+	if msg["host"] == "" {
+		msg["host"] = "unknown"
+	}
+
+	if priority, err := strconv.Atoi(f["PRIORITY"]); err == nil && priority >= 0 && priority < len(syslogLevels) {
+		msg["level"] = priority
+	}
+
+	for k, v := range f {
+		if k == "MESSAGE" || k == "_HOSTNAME" || k == "PRIORITY" {
+			continue
+		}
+
+		if name, ok := gelfAdditionalField(k); ok {
+			msg[name] = v
+		}
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,62 @@
+package reader
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatGELF(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1",
+		RealtimeTimestamp: 1500000000012345,
+		Fields: map[string]string{
+			"MESSAGE":       "connection refused",
+			"PRIORITY":      "3",
+			"_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME":     "agent1",
+			"__ID":          "reserved",
+			"FRAMEWORK_ID":  "fw",
+		},
+	}
+
+	b, err := FormatGELF{}.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `"timestamp":1500000000.012345`) {
+		t.Fatalf("expect timestamp with microseconds. Got %s", b)
+	}
+
+	msg := make(map[string]interface{})
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "agent1",
+		"short_message": "connection refused",
+		"level":         3.0,
+		"_cursor":       "s=1",
+		"_systemd_unit": "dcos-mesos-slave.service",
+		"_framework_id": "fw",
+		"timestamp":     1500000000.012345,
+	}
+	if len(msg) != len(expected) {
+		t.Fatalf("expect %d fields. Got %s", len(expected), b)
+	}
+
+	for k, v := range expected {
+		if msg[k] != v {
+			t.Fatalf("expect %s=%v. Got %v", k, v, msg[k])
+		}
+	}
+
+	if b, err = (FormatGELF{}).FormatEntry(&sdjournal.JournalEntry{}); err != nil || !strings.Contains(string(b), `"host":"unknown"`) {
+		t.Fatalf("expect unknown host. Got %s", b)
+	}
+}
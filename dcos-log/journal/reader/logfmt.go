@@ -0,0 +1,72 @@
+package reader
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ContentTypeLogfmt is a ContentType header for logfmt logs.
+var ContentTypeLogfmt ContentType = "text/x-logfmt"
+
+// FormatLogfmt implements EntryFormatter for logfmt logs. Each entry is a line of ts, host, unit, level, pid and
+// msg key/value pairs, the keys of empty fields are omitted.
+type FormatLogfmt struct{}
+
+// GetContentType returns "text/x-logfmt"
+func (j FormatLogfmt) GetContentType() ContentType {
+	return ContentTypeLogfmt
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a logfmt line.
+func (j FormatLogfmt) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a logfmt line to dst.
+func (j FormatLogfmt) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	f := entry.Fields
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	dst = append(dst, "ts="...)
+	dst = t.UTC().AppendFormat(dst, time.RFC3339Nano)
+
+	unit := f["_SYSTEMD_UNIT"]
+	if unit == "" {
+		unit = f["UNIT"]
+	}
+
+	var level string
+	if priority, err := strconv.Atoi(f["PRIORITY"]); err == nil && priority >= 0 && priority < len(syslogLevels) {
+		level = syslogLevels[priority]
+	}
+
+	for _, kv := range [][2]string{{"host", f["_HOSTNAME"]}, {"unit", unit}, {"level", level}, {"pid", f["_PID"]}} {
+		if kv[1] != "" {
+			dst = appendLogfmtPair(dst, kv[0], kv[1])
+		}
+	}
+
+	dst = appendLogfmtPair(dst, "msg", f["MESSAGE"])
+	return append(dst, '\n'), nil
+}
+
+// appendLogfmtPair appends a space and key=value to dst. The value is quoted if it is empty or contains spaces,
+// quotes, equal signs, control characters or invalid UTF-8.
+func appendLogfmtPair(dst []byte, key, value string) []byte {
+	dst = append(dst, ' ')
+	dst = append(dst, key...)
+	dst = append(dst, '=')
+
+	needsQuote := value == "" || !utf8.ValidString(value) || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f
+	}) >= 0
+	if !needsQuote {
+		return append(dst, value...)
+	}
+	return strconv.AppendQuote(dst, value)
+}
@@ -0,0 +1,57 @@
+package reader
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatLogfmt(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		RealtimeTimestamp: 1500000000123456,
+		Fields: map[string]string{
+			"MESSAGE":       `connection to "db" refused`,
+			"PRIORITY":      "3",
+			"_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+			"_HOSTNAME":     "agent1",
+			"_PID":          "42",
+		},
+	}
+
+	b, err := FormatLogfmt{}.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `ts=2017-07-14T02:40:00.123456Z host=agent1 unit=dcos-mesos-slave.service level=error pid=42 msg="connection to \"db\" refused"` + "\n"
+	if string(b) != expected {
+		t.Fatalf("expect %s. Got %s", expected, b)
+	}
+
+	b, err = FormatLogfmt{}.FormatEntry(&sdjournal.JournalEntry{Fields: map[string]string{"UNIT": "a=b", "MESSAGE": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `ts=1970-01-01T00:00:00Z unit="a=b" msg=""` + "\n"
+	if string(b) != expected {
+		t.Fatalf("expect %s. Got %s", expected, b)
+	}
+
+	for value, expect := range map[string]string{
+		"plain":          " k=plain",
+		"two\nlines":     ` k="two\nlines"`,
+		`back\slash`:     ` k="back\\slash"`,
+		"caf\xc3\xa9":    " k=caf\xc3\xa9",
+		"invalid\xff":    ` k="invalid\xff"`,
+		"tab\tseparated": ` k="tab\tseparated"`,
+	} {
+		if b := appendLogfmtPair(nil, "k", value); string(b) != expect {
+			t.Fatalf("expect %s. Got %s", expect, b)
+		}
+	}
+
+	if ct := NewEntryFormatter(ContentTypeLogfmt.String(), false).GetContentType(); ct != ContentTypeLogfmt {
+		t.Fatalf("expect %s. Got %s", ContentTypeLogfmt, ct)
+	}
+}
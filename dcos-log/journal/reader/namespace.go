@@ -0,0 +1,73 @@
+package reader
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrInvalidNamespace is the error returned by OptionNamespace for a name journald does not accept.
+	ErrInvalidNamespace = errors.New("invalid journal namespace")
+
+	// ErrNamespaceNotFound is the error returned by OptionNamespace if the namespace has no journal directory.
+	ErrNamespaceNotFound = errors.New("journal namespace not found")
+)
+
+// namespacePattern matches the names of the namespaces, the instance names of systemd-journald@.service.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]{0,63}$`)
+
+var (
+	// journalRoots are the directories of the persistent and the volatile journal.
+	journalRoots = []string{"/var/log/journal", "/run/log/journal"}
+
+	// machineIDFile has the machine ID, the prefix of the directories of the namespaces.
+	machineIDFile = "/etc/machine-id"
+)
+
+// OptionNamespace is a functional option that reads the journal of a journald namespace, the entries of the units
+// with LogNamespace= written by systemd-journald@<namespace>, like journalctl --namespace. The namespace journal is
+// in the <machine-id>.<namespace> directories of /var/log/journal and /run/log/journal, which are opened like
+// OptionDirectories, so it must precede the match options and it replaces the directories of OptionDirectories.
+// An empty namespace reads the default journal.
+func OptionNamespace(namespace string) Option {
+	return func(r *Reader) error {
+		if namespace == "" {
+			return nil
+		}
+
+		dirs, err := namespaceDirs(namespace)
+		if err != nil {
+			return err
+		}
+		return OptionDirectories(dirs...)(r)
+	}
+}
+
+// namespaceDirs returns the existing journal directories of a namespace.
+func namespaceDirs(namespace string) ([]string, error) {
+	if !namespacePattern.MatchString(namespace) {
+		return nil, ErrInvalidNamespace
+	}
+
+	id, err := ioutil.ReadFile(machineIDFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, root := range journalRoots {
+		dir := filepath.Join(root, strings.TrimSpace(string(id))+"."+namespace)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil, ErrNamespaceNotFound
+	}
+	return dirs, nil
+}
@@ -0,0 +1,55 @@
+package reader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(roots []string, idFile string) { journalRoots, machineIDFile = roots, idFile }(journalRoots, machineIDFile)
+	journalRoots = []string{filepath.Join(root, "var"), filepath.Join(root, "run")}
+	machineIDFile = filepath.Join(root, "machine-id")
+
+	if err := ioutil.WriteFile(machineIDFile, []byte("0123\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"var/0123.dcos", "run/0123.dcos", "run/0123.other"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dirs, err := namespaceDirs("dcos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{filepath.Join(root, "var/0123.dcos"), filepath.Join(root, "run/0123.dcos")}
+	if !reflect.DeepEqual(dirs, expect) {
+		t.Fatalf("expect %v. Got %v", expect, dirs)
+	}
+
+	if dirs, err := namespaceDirs("other"); err != nil || len(dirs) != 1 {
+		t.Fatalf("expect the volatile journal of other. Got %v, %v", dirs, err)
+	}
+
+	if _, err := namespaceDirs("missing"); err != ErrNamespaceNotFound {
+		t.Fatalf("expect ErrNamespaceNotFound. Got %v", err)
+	}
+
+	for _, namespace := range []string{"../dcos", ".hidden", "a/b"} {
+		if _, err := namespaceDirs(namespace); err != ErrInvalidNamespace {
+			t.Fatalf("expect ErrInvalidNamespace for %q. Got %v", namespace, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package reader
+
+import (
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// ContentTypeNDJSON is a ContentType header for newline delimited JSON logs.
+var ContentTypeNDJSON ContentType = "application/x-ndjson"
+
+// FormatNDJSON implements EntryFormatter for newline delimited JSON logs. Each entry is the compact JSON object
+// of FormatJSON on its own line, without the framing of server sent events.
+type FormatNDJSON struct {
+	// Fields are the entry fields included in the output, all fields are included if empty.
+	Fields []string
+}
+
+// GetContentType returns "application/x-ndjson"
+func (j FormatNDJSON) GetContentType() ContentType {
+	return ContentTypeNDJSON
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a JSON line.
+func (j FormatNDJSON) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends a JSON line to dst.
+func (j FormatNDJSON) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	return appendJournalEntry(dst, entry, j.Fields)
+}
@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatNDJSON(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1",
+		RealtimeTimestamp: 1500000000012345,
+		Fields:            map[string]string{"MESSAGE": "line one\nline two", "_PID": "42"},
+	}
+
+	formatter := NewEntryFormatter(ContentTypeNDJSON.String(), false)
+	if formatter.GetContentType() != ContentTypeNDJSON {
+		t.Fatalf("expect NDJSON formatter. Got %s", formatter.GetContentType())
+	}
+
+	b, err := FormatNDJSON{Fields: []string{"MESSAGE"}}.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Count(b, []byte("\n")) != 1 || b[len(b)-1] != '\n' {
+		t.Fatalf("expect a single line. Got %q", b)
+	}
+
+	var decoded struct {
+		Fields map[string]string `json:"fields"`
+		Cursor string            `json:"cursor"`
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Cursor != "s=1" || len(decoded.Fields) != 1 || decoded.Fields["MESSAGE"] != "line one\nline two" {
+		t.Fatalf("unexpected entry %s", b)
+	}
+}
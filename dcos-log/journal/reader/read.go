@@ -2,18 +2,51 @@ package reader
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
 	"github.com/sirupsen/logrus"
 )
 
-// ErrUninitializedReader is the error returned by Reader is contentFormatter wasn't initialized.
-// An instance of Reader must always be obtained by calling `NewReader` constructor function.
-var ErrUninitializedReader = errors.New("NewReader() must be called before using journal reader")
+var (
+	// ErrUninitializedReader is the error returned by Reader is contentFormatter wasn't initialized.
+	// An instance of Reader must always be obtained by calling `NewReader` constructor function.
+	ErrUninitializedReader = errors.New("NewReader() must be called before using journal reader")
+
+	// ErrRangeEnd is returned by Follow once an entry after the time set by OptionUntil was read.
+	ErrRangeEnd = errors.New("end of time range")
+
+	// ErrCursorNotFound is returned by SeekCursor if the journal has no entry at a valid cursor any more, the
+	// journal file was rotated away or vacuumed.
+	ErrCursorNotFound = errors.New("cursor not found, the entry is no longer in the journal")
+)
+
+// seek types of dcos_log_journal_seek_errors_total.
+const (
+	seekCursor   = "cursor"
+	seekTail     = "tail"
+	seekRealtime = "realtime"
+	seekSkip     = "skip"
+)
+
+// defaultHeartbeat is the interval of the ping comments of an idle event stream.
+const defaultHeartbeat = 15 * time.Second
+
+var seekErrors = metrics.NewCounterVec("dcos_log_journal_seek_errors_total",
+	"Errors moving the journal read position by seek type.", "seek")
+
+// seekError counts a failed seek and returns err.
+func seekError(seek string, err error) error {
+	if err != nil {
+		seekErrors.WithLabelValues(seek).Inc()
+	}
+	return err
+}
 
 // NewReader returns a new instance of journal reader.
 func NewReader(contentFormatter EntryFormatter, options ...Option) (r *Reader, err error) {
@@ -24,6 +57,7 @@ func NewReader(contentFormatter EntryFormatter, options ...Option) (r *Reader, e
 
 	r = &Reader{
 		contentFormatter: contentFormatter,
+		heartbeat:        defaultHeartbeat,
 	}
 
 	r.Journal, err = sdjournal.NewJournal()
@@ -43,7 +77,19 @@ func NewReader(contentFormatter EntryFormatter, options ...Option) (r *Reader, e
 	return r, nil
 }
 
-// Reader is the main Journal Reader structure. It implements Reader interface.
+// EntryReader reads the formatted entries of a journal, the handlers serve the entries of an EntryReader. Reader
+// implements it, testutil.FakeJournal is an in-memory implementation for the tests.
+type EntryReader interface {
+	io.ReadCloser
+
+	// Follow writes the new entries to writer, waiting up to wait if there are none.
+	Follow(wait time.Duration, writer io.Writer) error
+
+	// Rotated returns true once if entries may have been lost by a rotation of the journal files.
+	Rotated() bool
+}
+
+// Reader is the main Journal Reader structure. It implements the EntryReader interface.
 type Reader struct {
 	Journal                  *sdjournal.Journal
 	Cursor                   string
@@ -54,10 +100,37 @@ type Reader struct {
 
 	eofTime          time.Time
 	msgReader        *bytes.Reader
+	entryReader      bytes.Reader
+	buf              []byte
 	contentFormatter EntryFormatter
 	// n represents the number of logs read.
 	n uint64
 
+	// filter skips the entries which do not match, set by OptionFilter.
+	filter func(*sdjournal.JournalEntry) bool
+
+	// ctx stops the reader when a client goes away, set by OptionContext.
+	ctx context.Context
+
+	// maxEntrySize is the maximum size of the entry fields, set by OptionMaxEntrySize.
+	maxEntrySize int
+
+	// heartbeat is the interval of the ping comments of an idle event stream, set by OptionHeartbeat.
+	heartbeat time.Duration
+
+	// until is the end of the time range set by OptionUntil, rangeEnd is set once it was passed. since is the start
+	// of the range of a reverse reader, set by OptionSinceTime.
+	until    time.Time
+	since    time.Time
+	rangeEnd bool
+
+	// rotated is set by Follow if the cursor of the last read entry is not found after journald invalidated the
+	// journal files, the entries written between it and the new files may be lost.
+	rotated bool
+
+	// dirs are the journal directories set by OptionDirectories, the local journal is read if empty.
+	dirs []string
+
 	// matchFns contains a list of match functions the user used in the original constructor.
 	// this is useful to re-apply matches in some cases (for instance journald rotation)
 	matchFns []func(journal *sdjournal.Journal)
@@ -67,49 +140,106 @@ type Reader struct {
 func (r *Reader) SkipNext(n uint64) error {
 	var err error
 	r.SkippedNext, err = r.Journal.NextSkip(n)
-	return err
+	return seekError(seekSkip, err)
 }
 
-// SkipPrev skips a journal by n entries backwards.
+// SkipPrev skips a journal by n entries backwards. The entries which do not pass the filter set by OptionFilter are
+// not counted, so the reader returns the last n matching entries and then follows the journal from the same position.
 func (r *Reader) SkipPrev(n uint64) error {
 	// if Cursor was not specified, move to the tail first
 	if r.Cursor == "" {
 		if err := r.Journal.SeekTail(); err != nil {
-			return fmt.Errorf("Could not move to the end if the journal: %s", err)
+			return fmt.Errorf("Could not move to the end if the journal: %s", seekError(seekTail, err))
 		}
 	}
 
+	if r.filter != nil {
+		return r.skipPrevMatching(n)
+	}
+
 	var err error
 	r.SkippedPrev, err = r.Journal.PreviousSkip(n)
-	return err
+	return seekError(seekSkip, err)
+}
+
+// skipPrevMatching moves the journal backwards until n entries passing the filter were skipped or the head of the
+// journal was reached. SkippedPrev is the number of all skipped entries.
+func (r *Reader) skipPrevMatching(n uint64) error {
+	r.SkippedPrev = 0
+	for matched := uint64(0); matched < n; {
+		c, err := r.Journal.Previous()
+		if err != nil {
+			return seekError(seekSkip, err)
+		}
+
+		if c == 0 {
+			return nil
+		}
+		r.SkippedPrev++
+
+		entry, err := r.Journal.GetEntry()
+		if err != nil {
+			return err
+		}
+
+		if r.filter(entry) {
+			matched++
+		}
+	}
+	return nil
 }
 
 // SeekCursor looks for a specific cursor in the journal and moves to it.
 // Function returns an error if cursor not found.
 func (r *Reader) SeekCursor(c string) error {
 	if err := r.Journal.SeekCursor(c); err != nil {
-		return err
+		return seekError(seekCursor, err)
 	}
 
 	// Advance cursor
 	if _, err := r.Journal.Next(); err != nil {
-		return err
+		return seekError(seekCursor, err)
 	}
 
 	// Verify we got moved the cursor to the desired position
 	if err := r.Journal.TestCursor(c); err != nil {
-		return fmt.Errorf("Cursor %s not found: %s", c, err)
+		return seekError(seekCursor, ErrCursorNotFound)
 	}
 
 	return nil
 }
 
+// HeadCursor returns the cursor of the earliest entry of the journal matching the matches of the reader, the cursor
+// a client continues with once its cursor was not found. The read position is moved to the entry.
+func (r *Reader) HeadCursor() (string, error) {
+	if r.Journal == nil {
+		return "", ErrUninitializedReader
+	}
+
+	if err := r.Journal.SeekHead(); err != nil {
+		return "", err
+	}
+
+	if n, err := r.Journal.Next(); err != nil || n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return "", err
+	}
+	return r.Journal.GetCursor()
+}
+
 // Read is implementation of Reader interface.
 // Most of the code was taken from https://github.com/coreos/go-systemd/blob/master/sdjournal/read.go
 func (r *Reader) Read(b []byte) (int, error) {
+next:
 	if r.msgReader == nil {
-		// check if we reached the limit.
-		if r.UseLimit && r.Limit == 0 {
+		if r.ctx != nil && r.ctx.Err() != nil {
+			return 0, r.ctx.Err()
+		}
+
+		// check if we reached the limit or the end of the time range.
+		if (r.UseLimit && r.Limit == 0) || r.rangeEnd {
 			return 0, io.EOF
 		}
 
@@ -150,12 +280,12 @@ func (r *Reader) Read(b []byte) (int, error) {
 			// EOF detection
 			if c == 0 {
 				// for server sent events content type some proxies may close connection
-				// after a short timeout. We are going to send a ping comment every 15 seconds
+				// after a short timeout. We are going to send a ping comment every heartbeat interval
 				// if no data available. This will ensure the connection is kept alive and
 				// nginx will not drop it with `Connection timed out` error.
 				// https://html.spec.whatwg.org/multipage/comms.html
-				if r.contentFormatter.GetContentType() == ContentTypeEventStream {
-					if time.Since(r.eofTime) < time.Duration(time.Second*15) {
+				if r.contentFormatter.GetContentType() == ContentTypeEventStream && r.heartbeat > 0 {
+					if time.Since(r.eofTime) < r.heartbeat {
 						return 0, io.EOF
 					}
 
@@ -178,13 +308,49 @@ func (r *Reader) Read(b []byte) (int, error) {
 			return 0, err
 		}
 
-		entryBytes, err := r.contentFormatter.FormatEntry(entry)
+		if r.afterUntil(entry) {
+			// the entries are ordered by time, no further entry is in the range.
+			if !r.ReadReverse {
+				r.rangeEnd = true
+				return 0, io.EOF
+			}
+			r.n++
+			goto next
+		}
+
+		if r.beforeSince(entry) {
+			r.rangeEnd = true
+			return 0, io.EOF
+		}
+
+		// the entry counts as read, the next call must advance the journal.
+		if r.filter != nil && !r.filter(entry) {
+			r.n++
+			goto next
+		}
+
+		if r.maxEntrySize > 0 {
+			truncateEntry(entry, r.maxEntrySize)
+		}
+
+		var entryBytes []byte
+		if appender, ok := r.contentFormatter.(EntryAppender); ok {
+			// the previous entry was read, its buffer is reused.
+			if cap(r.buf) > maxPooledBufferSize {
+				r.buf = nil
+			}
+			r.buf, err = appender.AppendEntry(r.buf[:0], entry)
+			entryBytes = r.buf
+		} else {
+			entryBytes, err = r.contentFormatter.FormatEntry(entry)
+		}
 		if err != nil {
 			return 0, err
 		}
 
 		// make a trick and put the entry in array of bytes.
-		r.msgReader = bytes.NewReader(entryBytes)
+		r.entryReader.Reset(entryBytes)
+		r.msgReader = &r.entryReader
 
 		// if we are using a limited number of entries, decrement a counter.
 		if r.UseLimit && r.Limit > 0 {
@@ -213,6 +379,101 @@ reader:
 	return sz, nil
 }
 
+// afterUntil returns true if the entry was written after the end of the time range.
+func (r *Reader) afterUntil(entry *sdjournal.JournalEntry) bool {
+	if r.until.IsZero() {
+		return false
+	}
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	t := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	return t.After(r.until)
+}
+
+// beforeSince returns true if the entry is before the start of the time range of a reverse reader.
+func (r *Reader) beforeSince(entry *sdjournal.JournalEntry) bool {
+	if r.since.IsZero() {
+		return false
+	}
+	return time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond)).Before(r.since)
+}
+
+// Count returns the number of entries Read would return, up to max. The entries are only read if the reader
+// has a filter or OptionUntil, but the position of the journal is moved, the reader must not be used to read the entries
+// afterwards.
+func (r *Reader) Count(max uint64) (uint64, error) {
+	if r.UseLimit && r.Limit < max {
+		max = r.Limit
+	}
+
+	var n uint64
+
+	// the same as in Read, the current entry is returned if the journal was moved backwards.
+	if cursor, err := r.Journal.GetCursor(); err == nil && cursor != r.Cursor && n < max {
+		ok, err := r.matchFilter()
+		if err != nil {
+			return n, err
+		}
+
+		if ok {
+			n++
+		}
+	}
+
+	for n < max && !r.rangeEnd {
+		var (
+			c   uint64
+			err error
+		)
+		if r.ReadReverse {
+			c, err = r.Journal.Previous()
+		} else {
+			c, err = r.Journal.Next()
+		}
+
+		if err != nil {
+			return n, err
+		}
+
+		if c == 0 {
+			break
+		}
+
+		ok, err := r.matchFilter()
+		if err != nil {
+			return n, err
+		}
+
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// matchFilter returns true if the current entry passes the filter and is in the time range.
+func (r *Reader) matchFilter() (bool, error) {
+	if r.filter == nil && r.until.IsZero() && r.since.IsZero() {
+		return true, nil
+	}
+
+	entry, err := r.Journal.GetEntry()
+	if err != nil {
+		return false, err
+	}
+
+	if r.afterUntil(entry) {
+		r.rangeEnd = !r.ReadReverse
+		return false, nil
+	}
+
+	if r.beforeSince(entry) {
+		r.rangeEnd = true
+		return false, nil
+	}
+	return r.filter == nil || r.filter(entry), nil
+}
+
 // Close is a function to close the journal. Along with Read() function it implements io.ReadCloser
 func (r *Reader) Close() error {
 	if r.Journal == nil {
@@ -221,6 +482,14 @@ func (r *Reader) Close() error {
 	return r.Journal.Close()
 }
 
+// Rotated returns true once if the journal files were rotated while following and the reader continues in new
+// files, so the entries between the last read entry and the new files may be lost.
+func (r *Reader) Rotated() bool {
+	rotated := r.rotated
+	r.rotated = false
+	return rotated
+}
+
 // Follow is a wrapper function, which can be called multiple times to mimic a journal tailing.
 func (r *Reader) Follow(wait time.Duration, writer io.Writer) error {
 	n, err := io.Copy(writer, r)
@@ -228,6 +497,10 @@ func (r *Reader) Follow(wait time.Duration, writer io.Writer) error {
 		return err
 	}
 
+	if r.rangeEnd {
+		return ErrRangeEnd
+	}
+
 	// if the number of read lines more then 0, we did not reach the journald bottom and can exit early
 	if n > 0 {
 		return nil
@@ -252,7 +525,7 @@ func (r *Reader) Follow(wait time.Duration, writer io.Writer) error {
 		}
 
 		// open a new journald
-		newJournal, err := sdjournal.NewJournal()
+		newJournal, err := openJournal(r.dirs)
 		if err != nil {
 			return fmt.Errorf("unable to open a new instance of journald: %s", err)
 		}
@@ -276,6 +549,7 @@ func (r *Reader) Follow(wait time.Duration, writer io.Writer) error {
 		// we want to intentionally ignore the error message, since it would indicate rotated systemd file
 		if err := r.SeekCursor(cursor); err != nil {
 			logrus.Errorf("error search cursor %s. %s", cursor, err)
+			r.rotated = true
 		}
 	}
 
@@ -165,6 +165,51 @@ func TestJournalSkipForward(t *testing.T) {
 	}
 }
 
+func TestFollowSkipPrev(t *testing.T) {
+	uniq := getUniqueString()
+	for i := 0; i < 6; i++ {
+		sendEntry(fmt.Sprintf("index-%d", i), "CUSTOM_FIELD", uniq)
+	}
+	// wait for journal entries to commit
+	time.Sleep(time.Millisecond * 100)
+
+	// the odd entries are filtered out, skip_prev counts only the entries which pass the filter.
+	r, err := NewReader(FormatText{}, OptionMatch([]JournalEntryMatch{
+		{
+			Field: "CUSTOM_FIELD",
+			Value: uniq,
+		},
+	}), OptionFilterPattern("index-[0246]"), OptionSkipPrev(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.Follow(time.Millisecond*100, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sendEntry("index-6", "CUSTOM_FIELD", uniq); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(buf.String(), "index-6") && time.Now().Before(deadline) {
+		if err := r.Follow(time.Millisecond*100, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		messages = append(messages, line[strings.LastIndex(line, " ")+1:])
+	}
+
+	if strings.Join(messages, ",") != "index-2,index-4,index-6" {
+		t.Fatalf("expecting entries index-2,index-4,index-6. Got %v", messages)
+	}
+}
+
 func TestOptionMatchOR(t *testing.T) {
 	str1 := getUniqueString()
 	str2 := getUniqueString()
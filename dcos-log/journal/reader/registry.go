@@ -0,0 +1,92 @@
+package reader
+
+import (
+	"sync"
+)
+
+// Format is an entry format registered with RegisterFormat.
+type Format struct {
+	// Name is the value of ?format= parameter selecting the format, formats without a name are selected by
+	// the request header Accept only.
+	Name string
+
+	// ContentType is the media type of the format, it's matched against the request header Accept.
+	ContentType ContentType
+
+	// New returns a formatter of the format, useCursorID is set for the streaming requests which send the
+	// cursor of each entry.
+	New func(useCursorID bool) EntryFormatter
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+func init() {
+	for _, f := range []Format{
+		{Name: "text", ContentType: ContentTypePlainText, New: func(bool) EntryFormatter { return &FormatText{} }},
+		{Name: "json", ContentType: ContentTypeApplicationJSON, New: func(bool) EntryFormatter { return &FormatJSON{} }},
+		{ContentType: ContentTypeEventStream, New: func(useCursorID bool) EntryFormatter {
+			return &FormatSSE{UseCursorID: useCursorID}
+		}},
+		{Name: "cef", ContentType: ContentTypeCEF, New: func(bool) EntryFormatter { return &FormatCEF{} }},
+		{Name: "leef", ContentType: ContentTypeLEEF, New: func(bool) EntryFormatter { return &FormatLEEF{} }},
+		{Name: "elastic", ContentType: ContentTypeElasticBulk, New: func(bool) EntryFormatter { return &FormatElasticBulk{} }},
+		{Name: "logfmt", ContentType: ContentTypeLogfmt, New: func(bool) EntryFormatter { return &FormatLogfmt{} }},
+		{Name: "gelf", ContentType: ContentTypeGELF, New: func(bool) EntryFormatter { return &FormatGELF{} }},
+		{Name: "ndjson", ContentType: ContentTypeNDJSON, New: func(bool) EntryFormatter { return &FormatNDJSON{} }},
+		{Name: "csv", ContentType: ContentTypeCSV, New: func(bool) EntryFormatter { return &FormatCSV{} }},
+	} {
+		RegisterFormat(f)
+	}
+}
+
+// RegisterFormat adds an entry format, registering a content type twice replaces the previous format in place.
+// It's meant to be called by the programs embedding dcos-log before the server is started.
+func RegisterFormat(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for i := range formats {
+		if formats[i].ContentType == f.ContentType {
+			formats[i] = f
+			return
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats in the order they were registered.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	return append([]Format(nil), formats...)
+}
+
+// LookupFormat returns a registered format by its ?format= name.
+func LookupFormat(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for _, f := range formats {
+		if name != "" && f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// formatByContentType returns a registered format by its content type.
+func formatByContentType(contentType string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for _, f := range formats {
+		if f.ContentType.String() == contentType {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
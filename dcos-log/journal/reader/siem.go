@@ -0,0 +1,203 @@
+package reader
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+var (
+	// ContentTypeCEF is a ContentType header for ArcSight Common Event Format logs.
+	ContentTypeCEF ContentType = "text/x-cef"
+
+	// ContentTypeLEEF is a ContentType header for QRadar Log Event Extended Format logs.
+	ContentTypeLEEF ContentType = "text/x-leef"
+)
+
+const (
+	siemVendor  = "Mesosphere"
+	siemProduct = "DC/OS"
+)
+
+// FieldMapping maps journal fields to CEF extension keys or LEEF attributes.
+type FieldMapping map[string]string
+
+// DefaultCEFMapping is a mapping of well known journal fields to CEF extension keys.
+var DefaultCEFMapping = FieldMapping{
+	"_HOSTNAME":         "dvchost",
+	"_PID":              "dvcpid",
+	"_COMM":             "dproc",
+	"_UID":              "duid",
+	"SYSLOG_IDENTIFIER": "deviceProcessName",
+	"_SYSTEMD_UNIT":     "cs1",
+	"FRAMEWORK_ID":      "cs2",
+	"EXECUTOR_ID":       "cs3",
+	"CONTAINER_ID":      "cs4",
+}
+
+// DefaultLEEFMapping is a mapping of well known journal fields to LEEF attributes.
+var DefaultLEEFMapping = FieldMapping{
+	"_HOSTNAME":     "identHostName",
+	"_PID":          "pid",
+	"_COMM":         "proc",
+	"_UID":          "uid",
+	"_SYSTEMD_UNIT": "unit",
+	"FRAMEWORK_ID":  "frameworkId",
+	"EXECUTOR_ID":   "executorId",
+	"CONTAINER_ID":  "containerId",
+}
+
+// ParseFieldMapping parses a comma separated list of FIELD=key pairs.
+func ParseFieldMapping(s string) (FieldMapping, error) {
+	mapping := FieldMapping{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid field mapping %q, must be FIELD=key", pair)
+		}
+		mapping[strings.ToUpper(kv[0])] = kv[1]
+	}
+	return mapping, nil
+}
+
+// merge returns the default mapping overridden by m.
+func (m FieldMapping) merge(defaults FieldMapping) FieldMapping {
+	merged := make(FieldMapping, len(defaults)+len(m))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+
+	for k, v := range m {
+		merged[k] = v
+	}
+	return merged
+}
+
+// siemSeverity converts a syslog priority 0-7 to CEF/LEEF severity 0-10.
+func siemSeverity(entry *sdjournal.JournalEntry) int {
+	priority, err := strconv.Atoi(entry.Fields["PRIORITY"])
+	if err != nil || priority < 0 || priority > 7 {
+		// informational
+		return 3
+	}
+	return []int{10, 9, 8, 7, 6, 4, 3, 1}[priority]
+}
+
+// siemEventID returns the event class of an entry, the unit or identifier which wrote the entry.
+func siemEventID(entry *sdjournal.JournalEntry) string {
+	for _, field := range []string{"_SYSTEMD_UNIT", "UNIT", "SYSLOG_IDENTIFIER", "_COMM"} {
+		if v := entry.Fields[field]; v != "" {
+			return v
+		}
+	}
+	return "journal"
+}
+
+// mappedFields returns the mapped entry fields sorted by key, so the output is stable.
+func mappedFields(entry *sdjournal.JournalEntry, mapping FieldMapping) [][2]string {
+	var fields [][2]string
+	for field, key := range mapping {
+		if v, ok := entry.Fields[field]; ok {
+			fields = append(fields, [2]string{key, v})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i][0] < fields[j][0] })
+	return fields
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefHeaderEscaper   = strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ")
+	leefValueEscaper    = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+)
+
+// FormatCEF implements EntryFormatter for ArcSight Common Event Format.
+// CEF:0|Mesosphere|DC/OS|<version>|<unit>|<message>|<severity>|rt=<ms> msg=<message> <mapped fields>
+type FormatCEF struct {
+	// Mapping overrides DefaultCEFMapping.
+	Mapping FieldMapping
+
+	// Version is the device version in the header.
+	Version string
+}
+
+// GetContentType returns "text/x-cef"
+func (j FormatCEF) GetContentType() ContentType {
+	return ContentTypeCEF
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a CEF line.
+func (j FormatCEF) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	message, ok := entry.Fields["MESSAGE"]
+	if !ok {
+		return nil, nil
+	}
+
+	// CEF name is a short human readable description.
+	name := message
+	if len(name) > 512 {
+		name = name[:512]
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "CEF:0|%s|%s|%s|%s|%s|%d|", siemVendor, cefHeaderEscaper.Replace(siemProduct),
+		cefHeaderEscaper.Replace(j.Version), cefHeaderEscaper.Replace(siemEventID(entry)),
+		cefHeaderEscaper.Replace(name), siemSeverity(entry))
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds
+	fmt.Fprintf(buf, "rt=%d msg=%s", entry.RealtimeTimestamp/1000, cefExtensionEscaper.Replace(message))
+	for _, kv := range mappedFields(entry, j.Mapping.merge(DefaultCEFMapping)) {
+		fmt.Fprintf(buf, " %s=%s", kv[0], cefExtensionEscaper.Replace(kv[1]))
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// FormatLEEF implements EntryFormatter for QRadar Log Event Extended Format 2.0 with tab delimited attributes.
+// LEEF:2.0|Mesosphere|DC/OS|<version>|<unit>|x09|devTime=<ms>\tsev=<severity>\tmsg=<message>\t<mapped fields>
+type FormatLEEF struct {
+	// Mapping overrides DefaultLEEFMapping.
+	Mapping FieldMapping
+
+	// Version is the product version in the header.
+	Version string
+}
+
+// GetContentType returns "text/x-leef"
+func (j FormatLEEF) GetContentType() ContentType {
+	return ContentTypeLEEF
+}
+
+// FormatEntry formats sdjournal.JournalEntry to a LEEF line.
+func (j FormatLEEF) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	message, ok := entry.Fields["MESSAGE"]
+	if !ok {
+		return nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "LEEF:2.0|%s|%s|%s|%s|x09|", siemVendor, leefHeaderEscaper.Replace(siemProduct),
+		leefHeaderEscaper.Replace(j.Version), leefHeaderEscaper.Replace(siemEventID(entry)))
+
+	// entry.RealtimeTimestamp returns a unix time in microseconds, devTimeFormat is not set, so devTime is
+	// in milliseconds since epoch.
+	fmt.Fprintf(buf, "devTime=%d\tsev=%d\tmsg=%s", entry.RealtimeTimestamp/1000, siemSeverity(entry),
+		leefValueEscaper.Replace(message))
+	for _, kv := range mappedFields(entry, j.Mapping.merge(DefaultLEEFMapping)) {
+		fmt.Fprintf(buf, "\t%s=%s", kv[0], leefValueEscaper.Replace(kv[1]))
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
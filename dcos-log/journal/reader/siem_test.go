@@ -0,0 +1,62 @@
+package reader
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+var siemEntry = &sdjournal.JournalEntry{
+	RealtimeTimestamp: 1500000000123456,
+	Fields: map[string]string{
+		"MESSAGE":       "user=root a|b\nsecond line",
+		"PRIORITY":      "3",
+		"_SYSTEMD_UNIT": "dcos-mesos-slave.service",
+		"_HOSTNAME":     "agent1",
+		"_PID":          "42",
+		"CUSTOM":        "value\tx",
+	},
+}
+
+func TestFormatCEF(t *testing.T) {
+	f := FormatCEF{Version: "1.0", Mapping: FieldMapping{"CUSTOM": "cs5", "_PID": "spid"}}
+	b, err := f.FormatEntry(siemEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `CEF:0|Mesosphere|DC/OS|1.0|dcos-mesos-slave.service|user=root a\|b second line|7|` +
+		`rt=1500000000123 msg=user\=root a|b\nsecond line cs1=dcos-mesos-slave.service cs5=value	x dvchost=agent1 spid=42` + "\n"
+	if string(b) != expected {
+		t.Fatalf("expect %s. Got %s", expected, b)
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	f := FormatLEEF{Version: "1.0"}
+	b, err := f.FormatEntry(siemEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "LEEF:2.0|Mesosphere|DC/OS|1.0|dcos-mesos-slave.service|x09|devTime=1500000000123\tsev=7\t" +
+		`msg=user=root a|b\nsecond line` + "\tidentHostName=agent1\tpid=42\tunit=dcos-mesos-slave.service\n"
+	if string(b) != expected {
+		t.Fatalf("expect %q. Got %q", expected, b)
+	}
+}
+
+func TestParseFieldMapping(t *testing.T) {
+	m, err := ParseFieldMapping("custom=cs5, _PID=spid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 2 || m["CUSTOM"] != "cs5" || m["_PID"] != "spid" {
+		t.Fatalf("unexpected mapping %v", m)
+	}
+
+	if _, err := ParseFieldMapping("CUSTOM"); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+const (
+	// MaxTemplateSize is the maximum size of a template source.
+	MaxTemplateSize = 4096
+
+	// maxTemplateOutput is the maximum size of the output of an entry, the rest is cut.
+	maxTemplateOutput = 64 * 1024
+
+	// templateCacheSize is the number of parsed templates kept, the cache is cleared when it is full.
+	templateCacheSize = 256
+)
+
+// ErrTemplateTooLarge is returned by ParseTemplate if the source is longer than MaxTemplateSize.
+var ErrTemplateTooLarge = errors.New("template is too large")
+
+// templateFuncs are the functions available to the templates in addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+var (
+	templateCacheMu sync.Mutex
+	templateCache   = make(map[string]*template.Template)
+)
+
+// ParseTemplate parses a template of FormatTemplate. The templates are cached by their source, so the
+// templates of repeated requests are parsed once.
+func ParseTemplate(text string) (*template.Template, error) {
+	if len(text) > MaxTemplateSize {
+		return nil, ErrTemplateTooLarge
+	}
+
+	templateCacheMu.Lock()
+	defer templateCacheMu.Unlock()
+
+	if tpl, ok := templateCache[text]; ok {
+		return tpl, nil
+	}
+
+	tpl, err := template.New("entry").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templateCache) >= templateCacheSize {
+		templateCache = make(map[string]*template.Template)
+	}
+	templateCache[text] = tpl
+	return tpl, nil
+}
+
+// TemplateEntry is the data of the templates of FormatTemplate.
+type TemplateEntry struct {
+	Fields             map[string]string
+	Cursor             string
+	Time               time.Time
+	MonotonicTimestamp uint64
+	RealtimeTimestamp  uint64
+}
+
+// errTemplateOutputLimit stops the execution of a template once the output limit was reached.
+var errTemplateOutputLimit = errors.New("template output limit reached")
+
+// limitedBuffer is a buffer which keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - len(b.buf); len(p) > n {
+		b.buf, b.truncated = append(b.buf, p[:n]...), true
+		return n, errTemplateOutputLimit
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// FormatTemplate implements EntryFormatter for user defined text/template templates, for instance
+// `{{.Time.Format "15:04:05"}} {{.Fields._PID}} {{.Fields.MESSAGE}}`. Each entry is a line, the output of an entry
+// is cut at 64KiB and an execution error is written in place of the rest of the line.
+type FormatTemplate struct {
+	Template *template.Template
+}
+
+// GetContentType returns "text/plain"
+func (j FormatTemplate) GetContentType() ContentType {
+	return ContentTypePlainText
+}
+
+// FormatEntry formats sdjournal.JournalEntry with the template.
+func (j FormatTemplate) FormatEntry(entry *sdjournal.JournalEntry) ([]byte, error) {
+	return j.AppendEntry(nil, entry)
+}
+
+// AppendEntry appends the output of the template and a new line to dst.
+func (j FormatTemplate) AppendEntry(dst []byte, entry *sdjournal.JournalEntry) ([]byte, error) {
+	data := TemplateEntry{
+		Fields: entry.Fields,
+		Cursor: entry.Cursor,
+		// entry.RealtimeTimestamp returns a unix time in microseconds
+		Time:               time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond)).UTC(),
+		MonotonicTimestamp: entry.MonotonicTimestamp,
+		RealtimeTimestamp:  entry.RealtimeTimestamp,
+	}
+
+	out := &limitedBuffer{buf: dst, max: len(dst) + maxTemplateOutput}
+	err := j.Template.Execute(out, data)
+	switch {
+	case out.truncated:
+		out.buf = append(out.buf, "...[truncated]"...)
+	case err != nil:
+		out.buf = append(out.buf, " ["+err.Error()+"]"...)
+	}
+
+	if len(out.buf) == len(dst) || out.buf[len(out.buf)-1] != '\n' {
+		out.buf = append(out.buf, '\n')
+	}
+	return out.buf, nil
+}
@@ -0,0 +1,57 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestFormatTemplate(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Cursor:            "s=1",
+		RealtimeTimestamp: 1500000000012345,
+		Fields:            map[string]string{"MESSAGE": "connection refused", "_PID": "42"},
+	}
+
+	tpl, err := ParseTemplate(`{{.Time.Format "15:04:05"}} [{{.Fields._PID}}] {{upper .Fields.MESSAGE}}{{.Fields.MISSING}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, _ := ParseTemplate(`{{.Time.Format "15:04:05"}} [{{.Fields._PID}}] {{upper .Fields.MESSAGE}}{{.Fields.MISSING}}`); cached != tpl {
+		t.Fatal("expect the template to be cached")
+	}
+
+	b, err := FormatTemplate{Template: tpl}.FormatEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "02:40:00 [42] CONNECTION REFUSED\n" {
+		t.Fatalf("unexpected output %q", b)
+	}
+
+	tpl, err = ParseTemplate(`{{range $i := .Fields}}{{.}}{{.}}{{.}}{{.}}{{.}}{{.}}{{.}}{{.}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry.Fields["MESSAGE"] = strings.Repeat("x", maxTemplateOutput)
+	b, err = FormatTemplate{Template: tpl}.AppendEntry([]byte("prefix\n"), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != len("prefix\n")+maxTemplateOutput+len("...[truncated]\n") || !strings.HasSuffix(string(b), "...[truncated]\n") {
+		t.Fatalf("expect the output to be cut. Got %d bytes", len(b))
+	}
+
+	if _, err := ParseTemplate(strings.Repeat("x", MaxTemplateSize+1)); err != ErrTemplateTooLarge {
+		t.Fatalf("expect ErrTemplateTooLarge. Got %v", err)
+	}
+
+	if _, err := ParseTemplate("{{.Fields"); err == nil {
+		t.Fatal("expect a parse error")
+	}
+}
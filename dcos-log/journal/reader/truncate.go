@@ -0,0 +1,76 @@
+package reader
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+const (
+	// TruncatedSizeField is added to a truncated entry, the value is the size of the entry before truncation.
+	TruncatedSizeField = "DCOS_LOG_TRUNCATED_SIZE"
+
+	// TruncatedFieldsField is added to a truncated entry, the value is a comma separated list of truncated fields.
+	TruncatedFieldsField = "DCOS_LOG_TRUNCATED_FIELDS"
+)
+
+// entrySize returns the size of the entry fields, the sum of the names and values.
+func entrySize(fields map[string]string) int {
+	size := 0
+	for name, value := range fields {
+		size += len(name) + len(value)
+	}
+	return size
+}
+
+// truncateEntry cuts the largest field values of an entry, so the fields are at most max bytes, and records
+// the original size and the truncated fields in TruncatedSizeField and TruncatedFieldsField. The values are
+// cut at a UTF-8 character boundary. The fields are modified in place.
+func truncateEntry(entry *sdjournal.JournalEntry, max int) {
+	size := entrySize(entry.Fields)
+	if size <= max {
+		return
+	}
+
+	names := make([]string, 0, len(entry.Fields))
+	for name := range entry.Fields {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := len(entry.Fields[names[i]]), len(entry.Fields[names[j]])
+		if a == b {
+			return names[i] < names[j]
+		}
+		return a > b
+	})
+
+	excess := size - max
+	var truncated []string
+	for _, name := range names {
+		if excess <= 0 {
+			break
+		}
+
+		value := entry.Fields[name]
+		keep := len(value) - excess
+		if keep < 0 {
+			keep = 0
+		}
+
+		for keep > 0 && !utf8.RuneStart(value[keep]) {
+			keep--
+		}
+
+		entry.Fields[name] = value[:keep]
+		excess -= len(value) - keep
+		truncated = append(truncated, name)
+	}
+
+	sort.Strings(truncated)
+	entry.Fields[TruncatedSizeField] = strconv.Itoa(size)
+	entry.Fields[TruncatedFieldsField] = strings.Join(truncated, ",")
+}
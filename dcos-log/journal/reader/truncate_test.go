@@ -0,0 +1,60 @@
+package reader
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+func TestTruncateEntry(t *testing.T) {
+	entry := &sdjournal.JournalEntry{Fields: map[string]string{
+		"MESSAGE":  "process crashed",
+		"COREDUMP": strings.Repeat("x", 1000),
+		"UNIT":     "app.service",
+	}}
+
+	truncateEntry(entry, 100)
+	if size := entrySize(entry.Fields) - len(TruncatedSizeField) - len(entry.Fields[TruncatedSizeField]) -
+		len(TruncatedFieldsField) - len(entry.Fields[TruncatedFieldsField]); size != 100 {
+		t.Fatalf("expect fields of 100 bytes. Got %d", size)
+	}
+
+	if entry.Fields["MESSAGE"] != "process crashed" || entry.Fields["UNIT"] != "app.service" {
+		t.Fatalf("expect small fields to be kept. Got %v", entry.Fields)
+	}
+
+	if entry.Fields[TruncatedSizeField] != "1045" || entry.Fields[TruncatedFieldsField] != "COREDUMP" {
+		t.Fatalf("expect truncation marker. Got %v", entry.Fields)
+	}
+
+	// a small entry is not modified.
+	small := &sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "hello"}}
+	truncateEntry(small, 100)
+	if len(small.Fields) != 1 {
+		t.Fatalf("expect no marker. Got %v", small.Fields)
+	}
+}
+
+func TestTruncateEntryMultipleFields(t *testing.T) {
+	entry := &sdjournal.JournalEntry{Fields: map[string]string{
+		"MESSAGE": strings.Repeat("ä", 50),
+		"DATA":    strings.Repeat("y", 60),
+	}}
+	original := entrySize(entry.Fields)
+
+	truncateEntry(entry, 20)
+	if !utf8.ValidString(entry.Fields["MESSAGE"]) {
+		t.Fatalf("expect valid UTF-8. Got %q", entry.Fields["MESSAGE"])
+	}
+
+	if entry.Fields[TruncatedFieldsField] != "DATA,MESSAGE" || entry.Fields[TruncatedSizeField] != strconv.Itoa(original) {
+		t.Fatalf("expect both fields to be truncated. Got %v", entry.Fields)
+	}
+
+	if len(entry.Fields["MESSAGE"])+len(entry.Fields["DATA"]) > 20-len("MESSAGE")-len("DATA") {
+		t.Fatalf("expect fields within the limit. Got %v", entry.Fields)
+	}
+}
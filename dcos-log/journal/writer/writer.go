@@ -0,0 +1,193 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+const (
+	defaultNamespace  = "DCOS_APP_"
+	defaultIdentifier = "dcos-log-ingest"
+	defaultPriority   = journal.PriInfo
+
+	maxFields        = 64
+	maxFieldSize     = 64 * 1024
+	maxFieldNameSize = 64
+)
+
+var (
+	// ErrJournalDisabled is returned by Write if the journald socket is not available.
+	ErrJournalDisabled = errors.New("journald is not available")
+
+	// ErrEmptyMessage is returned by Write if an event has no message.
+	ErrEmptyMessage = errors.New("event message cannot be empty")
+
+	// ErrInvalidPriority is returned by Write if an event priority is not a syslog priority 0-7.
+	ErrInvalidPriority = errors.New("event priority must be in range 0-7")
+
+	// ErrTooManyFields is returned by Write if an event has more than 64 fields.
+	ErrTooManyFields = errors.New("event cannot have more than 64 fields")
+
+	// ErrInvalidNamespace is returned by OptionNamespace if the namespace is not a valid journal field prefix.
+	ErrInvalidNamespace = errors.New("namespace must consist of uppercase letters, numbers and underscores")
+)
+
+// SendFunc writes a single entry to the journal. journal.Send is used by default.
+type SendFunc func(message string, priority journal.Priority, vars map[string]string) error
+
+// Event is a structured application event.
+type Event struct {
+	Message    string            `json:"message"`
+	Priority   *int              `json:"priority,omitempty"`
+	Identifier string            `json:"identifier,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Option is a functional option that configures a Writer.
+type Option func(*Writer) error
+
+// OptionNamespace sets a prefix added to all user provided fields, so they never override
+// journald trusted or well known fields.
+func OptionNamespace(namespace string) Option {
+	return func(w *Writer) error {
+		if namespace == "" || namespace[0] == '_' || normalizeFieldName(namespace) != namespace {
+			return ErrInvalidNamespace
+		}
+		w.namespace = namespace
+		return nil
+	}
+}
+
+// OptionSend sets a function used to write entries to the journal.
+func OptionSend(send SendFunc) Option {
+	return func(w *Writer) error {
+		w.send = send
+		w.enabled = func() bool { return true }
+		return nil
+	}
+}
+
+// Writer writes structured events to journald using the native journal protocol.
+type Writer struct {
+	namespace string
+	send      SendFunc
+	enabled   func() bool
+}
+
+// NewWriter returns a new instance of Writer.
+func NewWriter(opts ...Option) (*Writer, error) {
+	w := &Writer{
+		namespace: defaultNamespace,
+		send:      journal.Send,
+		enabled:   journal.Enabled,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(w); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return w, nil
+}
+
+// Validate checks the event can be written to the journal.
+func Validate(e Event) error {
+	if e.Message == "" {
+		return ErrEmptyMessage
+	}
+
+	if e.Priority != nil && (*e.Priority < int(journal.PriEmerg) || *e.Priority > int(journal.PriDebug)) {
+		return ErrInvalidPriority
+	}
+
+	if len(e.Fields) > maxFields {
+		return ErrTooManyFields
+	}
+
+	for k, v := range e.Fields {
+		if k == "" || len(k) > maxFieldNameSize {
+			return fmt.Errorf("invalid field name %q", k)
+		}
+
+		if len(v) > maxFieldSize {
+			return fmt.Errorf("field %s exceeds %d bytes", k, maxFieldSize)
+		}
+	}
+
+	return nil
+}
+
+// normalizeFieldName converts a name to a valid journal field name: uppercase letters, numbers and underscores.
+func normalizeFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Vars returns the journal fields of an event. User fields are normalized and prefixed with the namespace.
+func (w *Writer) Vars(e Event, extra map[string]string) map[string]string {
+	vars := make(map[string]string, len(e.Fields)+len(extra)+1)
+	for k, v := range e.Fields {
+		vars[w.namespace+normalizeFieldName(k)] = v
+	}
+
+	for k, v := range extra {
+		vars[k] = v
+	}
+
+	identifier := e.Identifier
+	if identifier == "" {
+		identifier = defaultIdentifier
+	}
+	vars["SYSLOG_IDENTIFIER"] = identifier
+
+	return vars
+}
+
+// Send writes a single entry with the fields as is, the fields are not validated or namespaced. It is used
+// to store entries which come from another journal.
+func (w *Writer) Send(message string, priority journal.Priority, vars map[string]string) error {
+	if !w.enabled() {
+		return ErrJournalDisabled
+	}
+	return w.send(message, priority, vars)
+}
+
+// Write validates and writes events to the journal. extra fields are added to every entry as is, they
+// are used to record the metadata of the request.
+func (w *Writer) Write(extra map[string]string, events ...Event) error {
+	if !w.enabled() {
+		return ErrJournalDisabled
+	}
+
+	for i, e := range events {
+		if err := Validate(e); err != nil {
+			return fmt.Errorf("event %d: %s", i, err)
+		}
+	}
+
+	for i, e := range events {
+		priority := defaultPriority
+		if e.Priority != nil {
+			priority = journal.Priority(*e.Priority)
+		}
+
+		if err := w.send(e.Message, priority, w.Vars(e, extra)); err != nil {
+			return fmt.Errorf("unable to write event %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+type sent struct {
+	message  string
+	priority journal.Priority
+	vars     map[string]string
+}
+
+func TestWrite(t *testing.T) {
+	var entries []sent
+	send := func(message string, priority journal.Priority, vars map[string]string) error {
+		entries = append(entries, sent{message, priority, vars})
+		return nil
+	}
+
+	w, err := NewWriter(OptionSend(send))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warning := int(journal.PriWarning)
+	events := []Event{
+		{Message: "first", Fields: map[string]string{"request-id": "1", "_PID": "1"}},
+		{Message: "second", Priority: &warning, Identifier: "myapp"},
+	}
+
+	if err := w.Write(map[string]string{"DCOS_LOG_SOURCE": "ingest"}, events...); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries. Got %d", len(entries))
+	}
+
+	first := entries[0]
+	if first.priority != journal.PriInfo {
+		t.Fatalf("expect default priority info. Got %d", first.priority)
+	}
+
+	expected := map[string]string{
+		"DCOS_APP_REQUEST_ID": "1",
+		"DCOS_APP__PID":       "1",
+		"DCOS_LOG_SOURCE":     "ingest",
+		"SYSLOG_IDENTIFIER":   defaultIdentifier,
+	}
+	for k, v := range expected {
+		if first.vars[k] != v {
+			t.Fatalf("expect %s=%s. Got %v", k, v, first.vars)
+		}
+	}
+
+	if _, ok := first.vars["_PID"]; ok {
+		t.Fatal("trusted fields must not be overridden")
+	}
+
+	second := entries[1]
+	if second.priority != journal.PriWarning || second.vars["SYSLOG_IDENTIFIER"] != "myapp" {
+		t.Fatalf("unexpected entry %+v", second)
+	}
+}
+
+func TestWriteInvalidEvents(t *testing.T) {
+	var calls int
+	send := func(string, journal.Priority, map[string]string) error {
+		calls++
+		return nil
+	}
+
+	w, err := NewWriter(OptionSend(send))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := 8
+	if err := w.Write(nil, Event{Message: "ok"}, Event{Message: "bad", Priority: &invalid}); err == nil {
+		t.Fatal("expect invalid priority error")
+	}
+
+	if err := w.Write(nil, Event{}); err == nil {
+		t.Fatal("expect empty message error")
+	}
+
+	// events are validated before any of them is written.
+	if calls != 0 {
+		t.Fatalf("expect no entries written. Got %d", calls)
+	}
+}
+
+func TestOptionNamespace(t *testing.T) {
+	for _, ns := range []string{"", "_APP", "app_", "APP-"} {
+		if _, err := NewWriter(OptionNamespace(ns)); err != ErrInvalidNamespace {
+			t.Fatalf("expect ErrInvalidNamespace for %q. Got %v", ns, err)
+		}
+	}
+
+	if _, err := NewWriter(OptionNamespace("MYAPP_")); err != nil {
+		t.Fatal(err)
+	}
+}
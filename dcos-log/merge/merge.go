@@ -0,0 +1,185 @@
+// Package merge orders the entries of several streams by timestamp.
+//
+// Entries are kept in a reorder buffer until every open source has sent a newer entry (the watermark) or
+// until they have waited for the delay, so the output is chronologically ordered unless a source is late
+// by more than the delay. Entries older than an already emitted entry are emitted at once, flagged late.
+package merge
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBuffered is the maximum number of entries kept in the buffer, the oldest entry is emitted when
+// the buffer is full.
+const DefaultMaxBuffered = 10000
+
+// Entry is an entry of a merged stream.
+type Entry struct {
+	Time  time.Time
+	Value interface{}
+
+	// Late is set if an entry with a newer time was emitted before the entry.
+	Late bool
+
+	arrived time.Time
+	seq     uint64
+}
+
+type entries []*Entry
+
+func (e entries) Len() int { return len(e) }
+func (e entries) Less(i, j int) bool {
+	if e[i].Time.Equal(e[j].Time) {
+		return e[i].seq < e[j].seq
+	}
+	return e[i].Time.Before(e[j].Time)
+}
+func (e entries) Swap(i, j int)       { e[i], e[j] = e[j], e[i] }
+func (e *entries) Push(x interface{}) { *e = append(*e, x.(*Entry)) }
+func (e *entries) Pop() interface{} {
+	old := *e
+	x := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return x
+}
+
+// Merger is a reorder buffer of several sources. Emit is called with the entries in time order, it is never
+// called concurrently.
+type Merger struct {
+	mu sync.Mutex
+
+	delay       time.Duration
+	maxBuffered int
+	emit        func(Entry)
+	now         func() time.Time
+
+	buffer  entries
+	seq     uint64
+	sources map[string]time.Time
+	last    time.Time
+}
+
+// NewMerger returns a new instance of Merger. Zero delay disables the reordering, the entries are emitted
+// in the order they were pushed.
+func NewMerger(delay time.Duration, emit func(Entry)) *Merger {
+	return &Merger{
+		delay:       delay,
+		maxBuffered: DefaultMaxBuffered,
+		emit:        emit,
+		now:         time.Now,
+		sources:     make(map[string]time.Time),
+	}
+}
+
+// Add registers a source, the entries are held until the source sends an entry, is done or the delay passes.
+func (m *Merger) Add(source string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sources[source] = time.Time{}
+}
+
+// Done removes a source, the watermark no longer waits for it.
+func (m *Merger) Done(source string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sources, source)
+	m.release()
+}
+
+// Push adds an entry of a source, an unknown source is added.
+func (m *Merger) Push(source string, t time.Time, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &Entry{Time: t, Value: value, arrived: m.now(), seq: m.seq}
+	m.seq++
+
+	if m.delay <= 0 {
+		m.emit(*e)
+		return
+	}
+
+	if t.Before(m.last) {
+		e.Late = true
+		m.emit(*e)
+		return
+	}
+
+	if latest, ok := m.sources[source]; !ok || t.After(latest) {
+		m.sources[source] = t
+	}
+
+	heap.Push(&m.buffer, e)
+	m.release()
+}
+
+// Tick emits the entries which have waited for the delay. It should be called periodically.
+func (m *Merger) Tick() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.release()
+}
+
+// Close emits all buffered entries.
+func (m *Merger) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for m.buffer.Len() > 0 {
+		m.pop()
+	}
+}
+
+// watermark returns the time up to which all open sources have sent their entries.
+func (m *Merger) watermark() time.Time {
+	var watermark time.Time
+	first := true
+	for _, latest := range m.sources {
+		if first || latest.Before(watermark) {
+			watermark = latest
+			first = false
+		}
+	}
+	return watermark
+}
+
+func (m *Merger) release() {
+	// no open sources, every entry can be emitted.
+	if len(m.sources) == 0 {
+		for m.buffer.Len() > 0 {
+			m.pop()
+		}
+		return
+	}
+
+	if m.buffer.Len() == 0 {
+		return
+	}
+
+	limit := m.watermark()
+
+	// the entries which have waited for the delay are emitted with all older entries.
+	deadline := m.now().Add(-m.delay)
+	for _, e := range m.buffer {
+		if !e.arrived.After(deadline) && e.Time.After(limit) {
+			limit = e.Time
+		}
+	}
+
+	for m.buffer.Len() > 0 && (!m.buffer[0].Time.After(limit) || m.buffer.Len() > m.maxBuffered) {
+		m.pop()
+	}
+}
+
+func (m *Merger) pop() {
+	e := heap.Pop(&m.buffer).(*Entry)
+	if e.Time.After(m.last) {
+		m.last = e.Time
+	}
+	m.emit(*e)
+}
@@ -0,0 +1,86 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	values []interface{}
+	late   []interface{}
+}
+
+func (r *recorder) emit(e Entry) {
+	r.values = append(r.values, e.Value)
+	if e.Late {
+		r.late = append(r.late, e.Value)
+	}
+}
+
+func TestMergeWatermark(t *testing.T) {
+	r := &recorder{}
+	now := time.Unix(1000, 0)
+	m := NewMerger(time.Second, r.emit)
+	m.now = func() time.Time { return now }
+
+	m.Add("a")
+	m.Add("b")
+
+	m.Push("a", time.Unix(10, 0), "a10")
+	m.Push("a", time.Unix(30, 0), "a30")
+	if len(r.values) != 0 {
+		t.Fatalf("expect entries to wait for source b. Got %v", r.values)
+	}
+
+	m.Push("b", time.Unix(20, 0), "b20")
+	if !reflect.DeepEqual(r.values, []interface{}{"a10", "b20"}) {
+		t.Fatalf("expect a10, b20. Got %v", r.values)
+	}
+
+	// b is late by more than the delay.
+	now = now.Add(2 * time.Second)
+	m.Tick()
+	m.Push("b", time.Unix(25, 0), "b25")
+	m.Done("a")
+	m.Push("b", time.Unix(40, 0), "b40")
+	m.Done("b")
+
+	if !reflect.DeepEqual(r.values, []interface{}{"a10", "b20", "a30", "b25", "b40"}) {
+		t.Fatalf("expect a10, b20, a30, b25, b40. Got %v", r.values)
+	}
+
+	if !reflect.DeepEqual(r.late, []interface{}{"b25"}) {
+		t.Fatalf("expect b25 to be late. Got %v", r.late)
+	}
+}
+
+func TestMergeClose(t *testing.T) {
+	r := &recorder{}
+	m := NewMerger(time.Hour, r.emit)
+	m.maxBuffered = 2
+
+	m.Add("a")
+	m.Add("b")
+	m.Push("a", time.Unix(3, 0), 3)
+	m.Push("a", time.Unix(1, 0), 1)
+	m.Push("a", time.Unix(2, 0), 2)
+	if !reflect.DeepEqual(r.values, []interface{}{1}) {
+		t.Fatalf("expect the oldest entry of a full buffer. Got %v", r.values)
+	}
+
+	m.Close()
+	if !reflect.DeepEqual(r.values, []interface{}{1, 2, 3}) {
+		t.Fatalf("expect 1, 2, 3. Got %v", r.values)
+	}
+}
+
+func TestMergeNoDelay(t *testing.T) {
+	r := &recorder{}
+	m := NewMerger(0, r.emit)
+	m.Push("a", time.Unix(2, 0), 2)
+	m.Push("b", time.Unix(1, 0), 1)
+	if !reflect.DeepEqual(r.values, []interface{}{2, 1}) || len(r.late) != 0 {
+		t.Fatalf("expect arrival order. Got %v", r.values)
+	}
+}
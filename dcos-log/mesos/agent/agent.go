@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+)
+
+// ErrInvalidDuration is returned by ParseDuration if the mesos duration string cannot be parsed.
+var ErrInvalidDuration = errors.New("invalid mesos duration")
+
+// URL returns the base URL of mesos agent running on the current node.
+func URL(nodeInfo nodeutil.NodeInfo, useTLS bool) (*url.URL, error) {
+	ip, err := nodeInfo.DetectIP()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	return &url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(ip.String(), strconv.Itoa(dcos.PortMesosAgent)),
+	}, nil
+}
+
+// mesos duration units, the order matters since some units are prefixes of the others.
+var durationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"weeks", 7 * 24 * time.Hour},
+	{"days", 24 * time.Hour},
+	{"hrs", time.Hour},
+	{"mins", time.Minute},
+	{"secs", time.Second},
+	{"ms", time.Millisecond},
+	{"us", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// ParseDuration parses the mesos flag duration format, for instance "1weeks", "2days", "30mins" or "1.5hrs".
+func ParseDuration(s string) (time.Duration, error) {
+	for _, u := range durationUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil || v < 0 {
+			return 0, ErrInvalidDuration
+		}
+		return time.Duration(v * float64(u.unit)), nil
+	}
+
+	return 0, ErrInvalidDuration
+}
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"1weeks":  7 * 24 * time.Hour,
+		"2days":   48 * time.Hour,
+		"1.5hrs":  90 * time.Minute,
+		"30mins":  30 * time.Minute,
+		"10secs":  10 * time.Second,
+		"100ms":   100 * time.Millisecond,
+		"0ns":     0,
+		"250us":   250 * time.Microsecond,
+		"6.5days": 156 * time.Hour,
+	} {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+
+		if d != expected {
+			t.Fatalf("%s: expect %s. Got %s", s, expected, d)
+		}
+	}
+
+	for _, s := range []string{"", "1week", "-1days", "hrs", "1h"} {
+		if _, err := ParseDuration(s); err != ErrInvalidDuration {
+			t.Fatalf("%s: expect ErrInvalidDuration. Got %v", s, err)
+		}
+	}
+}
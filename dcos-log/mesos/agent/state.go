@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+)
+
+const statePath = "/state"
+
+// State is a subset of the mesos agent /state response.
+// http://mesos.apache.org/documentation/latest/endpoints/slave/state/
+type State struct {
+	ID                  string            `json:"id"`
+	Hostname            string            `json:"hostname"`
+	Flags               map[string]string `json:"flags"`
+	Frameworks          []Framework       `json:"frameworks"`
+	CompletedFrameworks []Framework       `json:"completed_frameworks"`
+}
+
+// Framework is a field in agent state.
+type Framework struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Executors          []Executor `json:"executors"`
+	CompletedExecutors []Executor `json:"completed_executors"`
+}
+
+// Executor is a field in agent state.
+type Executor struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Container      string `json:"container"`
+	Directory      string `json:"directory"`
+	Tasks          []Task `json:"tasks"`
+	CompletedTasks []Task `json:"completed_tasks"`
+}
+
+// Task is a field in agent state.
+type Task struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	FrameworkID string   `json:"framework_id"`
+	ExecutorID  string   `json:"executor_id"`
+	State       string   `json:"state"`
+	Statuses    []Status `json:"statuses"`
+}
+
+// Status is a field in agent state.
+type Status struct {
+	State     string  `json:"state"`
+	Timestamp float64 `json:"timestamp"`
+}
+
+// GetState makes a request to the mesos agent /state endpoint.
+func GetState(ctx context.Context, client *http.Client, agentURL url.URL, header http.Header) (*State, error) {
+	agentURL.Path = statePath
+	agentURL.RawQuery = ""
+
+	req, err := http.NewRequest("GET", agentURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if header != nil {
+		req.Header = header
+	}
+
+	req, span := tracing.StartRequest(req.WithContext(ctx), "mesos agent "+agentURL.Path)
+	defer span.End()
+
+	resp, err := client.Do(req)
+	span.SetError(err)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make a GET request to %s: %s", agentURL.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET request to %s returned response code %d", agentURL.String(), resp.StatusCode)
+	}
+
+	state := &State{}
+	if err := json.NewDecoder(resp.Body).Decode(state); err != nil {
+		return nil, fmt.Errorf("unable to decode agent state: %s", err)
+	}
+
+	return state, nil
+}
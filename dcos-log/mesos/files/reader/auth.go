@@ -0,0 +1,117 @@
+package reader
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dcos/dcos-go/dcos/http/transport"
+)
+
+// HeaderProvider returns the headers of the requests to the agent. It's called per request, so a provider can
+// refresh the credentials of a long running stream, such as the token of a service account which expires while
+// a task log is followed.
+type HeaderProvider interface {
+	Header() (http.Header, error)
+}
+
+// HeaderFunc is a function HeaderProvider.
+type HeaderFunc func() (http.Header, error)
+
+// Header calls f.
+func (f HeaderFunc) Header() (http.Header, error) {
+	return f()
+}
+
+// OptHeaderProvider sets the provider of the request headers, it takes precedence over OptHeaders.
+func OptHeaderProvider(p HeaderProvider) Option {
+	return func(rm *ReadManager) error {
+		rm.headers = p
+		return nil
+	}
+}
+
+// OptRenewHeaderProvider sets the provider of the request headers used once a request sent with the headers of
+// OptHeaders succeeded. The first requests are authorized with the credentials of the user, the provider only
+// keeps a stream the user was allowed to open reading, for instance once the token of the user expired.
+func OptRenewHeaderProvider(p HeaderProvider) Option {
+	return func(rm *ReadManager) error {
+		rm.renewHeaders = p
+		return nil
+	}
+}
+
+// requestHeader returns the headers of a request to the agent, from the provider of OptHeaderProvider if set, or
+// from the provider of OptRenewHeaderProvider once a request succeeded.
+func (rm *ReadManager) requestHeader() (http.Header, error) {
+	if rm.headers != nil {
+		return rm.headers.Header()
+	}
+
+	if rm.renewHeaders != nil && atomic.LoadInt32(&rm.authorized) == 1 {
+		return rm.renewHeaders.Header()
+	}
+	return rm.header, nil
+}
+
+// authorize switches the requests to the provider of OptRenewHeaderProvider after a successful request.
+func (rm *ReadManager) authorize() {
+	if rm.renewHeaders != nil {
+		atomic.StoreInt32(&rm.authorized, 1)
+	}
+}
+
+// DefaultTokenExpire is the lifetime of the service account tokens of NewServiceAccountTokens.
+const DefaultTokenExpire = time.Hour
+
+// ServiceAccountTokens is a HeaderProvider of the Authorization header of a DC/OS service account. The token is
+// requested from the IAM login endpoint of the service account config and requested again once 80% of its lifetime
+// has passed, before the agent rejects it.
+type ServiceAccountTokens struct {
+	mu      sync.Mutex
+	login   transport.Debug
+	expire  time.Duration
+	renewed time.Time
+	now     func() time.Time
+}
+
+// NewServiceAccountTokens logs in with the service account of the IAM config, the file of -iam-config with uid,
+// private_key and login_endpoint. The tokens expire after expire, DefaultTokenExpire if 0. The login requests are
+// sent with rt, http.DefaultTransport if nil.
+func NewServiceAccountTokens(rt http.RoundTripper, iamConfig string, expire time.Duration) (*ServiceAccountTokens, error) {
+	if expire <= 0 {
+		expire = DefaultTokenExpire
+	}
+
+	// the round tripper logs in when it's created, it's not used to send requests.
+	login, err := transport.NewRoundTripper(rt, transport.OptionReadIAMConfig(iamConfig),
+		transport.OptionTokenExpire(expire))
+	if err != nil {
+		return nil, err
+	}
+
+	debug, err := transport.DebugTransport(login)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceAccountTokens{login: debug, expire: expire, renewed: time.Now(), now: time.Now}, nil
+}
+
+// Header returns the Authorization header with the current token, a new token is requested if the current one
+// is about to expire.
+func (s *ServiceAccountTokens) Header() (http.Header, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.now(); now.Sub(s.renewed) >= s.expire*4/5 {
+		if err := s.login.GenerateToken(); err != nil {
+			return nil, err
+		}
+		s.renewed = now
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "token="+s.login.CurrentToken())
+	return header, nil
+}
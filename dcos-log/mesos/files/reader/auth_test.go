@@ -0,0 +1,167 @@
+package reader
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceAccountTokens(t *testing.T) {
+	var logins int32
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		fmt.Fprintf(w, `{"token":"token-%d"}`, n)
+	}))
+	defer iam.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "iam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config, err := json.Marshal(map[string]string{
+		"uid":            "dcos_log",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"login_endpoint": iam.URL + "/acs/api/v1/auth/login",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "iam.json")
+	if err := ioutil.WriteFile(configPath, config, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := NewServiceAccountTokens(nil, configPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+
+	header, err := tokens.Header()
+	if err != nil || header.Get("Authorization") != "token=token-1" {
+		t.Fatalf("expect the token of the first login. Got %v, %v", header, err)
+	}
+
+	// the token is renewed once 80% of its lifetime has passed.
+	now = now.Add(50 * time.Minute)
+	if header, _ := tokens.Header(); header.Get("Authorization") != "token=token-2" {
+		t.Fatalf("expect a renewed token. Got %v", header)
+	}
+
+	if header, _ := tokens.Header(); header.Get("Authorization") != "token=token-2" {
+		t.Fatalf("expect the renewed token. Got %v", header)
+	}
+
+	// every request of the reader gets the header of the provider.
+	var auth atomic.Value
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		w.Write([]byte(`{"data":"","offset":0}`))
+	}))
+	defer agent.Close()
+
+	agentURL, err := url.Parse(agent.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(http.DefaultClient, *agentURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptHeaders(http.Header{"Authorization": {"token=user"}}), OptHeaderProvider(tokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Size(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a := auth.Load(); a != "token=token-2" {
+		t.Fatalf("expect the service account token. Got %v", a)
+	}
+}
+
+func TestRenewHeaderProvider(t *testing.T) {
+	var (
+		auth   atomic.Value
+		denied int32 = 1
+	)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		if atomic.LoadInt32(&denied) == 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":"","offset":0}`))
+	}))
+	defer agent.Close()
+
+	agentURL, err := url.Parse(agent.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serviceAccount := HeaderFunc(func() (http.Header, error) {
+		return http.Header{"Authorization": {"token=service-account"}}, nil
+	})
+
+	r, err := NewLineReader(http.DefaultClient, *agentURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptHeaders(http.Header{"Authorization": {"token=user"}}), OptRenewHeaderProvider(serviceAccount))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a user the agent denies does not get the service account.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Size(); err == nil {
+			t.Fatal("expect the read of a denied user to fail")
+		}
+
+		if a := auth.Load(); a != "token=user" {
+			t.Fatalf("expect the token of the user. Got %v", a)
+		}
+	}
+
+	atomic.StoreInt32(&denied, 0)
+	if _, err := r.Size(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a := auth.Load(); a != "token=user" {
+		t.Fatalf("expect the first read with the token of the user. Got %v", a)
+	}
+
+	if _, err := r.Size(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a := auth.Load(); a != "token=service-account" {
+		t.Fatalf("expect the service account token once a read succeeded. Got %v", a)
+	}
+}
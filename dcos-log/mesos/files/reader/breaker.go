@@ -0,0 +1,152 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+)
+
+// ErrCircuitOpen is returned without a request to the agent while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("files API of the agent keeps failing, circuit breaker is open")
+
+var circuitRejected = metrics.NewCounterVec("dcos_log_files_api_circuit_rejected_total",
+	"Files API requests failed without a request because the circuit breaker of the agent is open.")
+
+// circuits are the circuit breakers of the agents by host, shared by all readers.
+var circuits = newBreaker()
+
+// circuit is the state of the files API of an agent. It's open while failures reached the threshold, until
+// openUntil. probing is set while a single request checks whether the agent recovered.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+func newBreaker() *breaker {
+	return &breaker{circuits: make(map[string]*circuit), now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if a request to host must fail fast: threshold consecutive requests failed and the
+// cooldown has not passed, or another request is probing the agent. Once the cooldown has passed one request is let
+// through, its result closes the circuit or opens it again.
+func (b *breaker) allow(host string, threshold int) error {
+	if threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok || c.failures < threshold {
+		return nil
+	}
+
+	if c.probing || b.now().Before(c.openUntil) {
+		circuitRejected.WithLabelValues().Inc()
+		return ErrCircuitOpen
+	}
+	c.probing = true
+	return nil
+}
+
+// success closes the circuit of host.
+func (b *breaker) success(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.circuits, host)
+}
+
+// failure counts a failed request to host, the circuit is opened for cooldown once threshold requests failed in
+// a row.
+func (b *breaker) failure(host string, threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+
+	c.failures++
+	c.probing = false
+	if c.failures >= threshold {
+		c.openUntil = b.now().Add(cooldown)
+	}
+}
+
+// release ends a probe canceled by the client, it tells nothing about the agent.
+func (b *breaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[host]; ok {
+		c.probing = false
+	}
+}
+
+// breakerFailure returns true if err shows the files API of the agent is failing: the connection failed or timed
+// out or the agent responded with 5xx.
+func breakerFailure(err error) bool {
+	if err == ErrAgentUnavailable {
+		return true
+	}
+
+	switch e := err.(type) {
+	case statusError:
+		return e >= http.StatusInternalServerError
+	case *url.Error:
+		return true
+	}
+	return false
+}
+
+// report records the result of a request in the circuit breaker of the agent.
+func (rm *ReadManager) report(req *http.Request, err error) {
+	if rm.breakerFailures <= 0 {
+		return
+	}
+
+	switch {
+	case req.Context().Err() == context.Canceled:
+		circuits.release(req.URL.Host)
+	case breakerFailure(err):
+		circuits.failure(req.URL.Host, rm.breakerFailures, rm.breakerCooldown)
+	default:
+		circuits.success(req.URL.Host)
+	}
+}
+
+// OptCircuitBreaker fails the reads of an agent with ErrCircuitOpen without a request for cooldown after failures
+// consecutive requests to its files API failed, so the readers of a wedged agent do not wait for timeouts. Then a
+// single request probes the agent, the circuit is closed if it succeeds. The state is shared by all readers. Zero
+// failures disables the breaker.
+func OptCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(rm *ReadManager) error {
+		if failures < 0 {
+			return fmt.Errorf("invalid number of failures %d. Must be zero or positive integer", failures)
+		}
+
+		if failures > 0 && cooldown <= 0 {
+			return fmt.Errorf("invalid circuit breaker cooldown %s. Must be positive", cooldown)
+		}
+
+		rm.breakerFailures = failures
+		rm.breakerCooldown = cooldown
+		return nil
+	}
+}
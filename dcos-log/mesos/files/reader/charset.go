@@ -0,0 +1,205 @@
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charset is an encoding of a sandbox file.
+type Charset string
+
+const (
+	// CharsetUTF8 is the default charset, lines are sent as is.
+	CharsetUTF8 Charset = "UTF-8"
+
+	// CharsetLatin1 is used for lines which are not valid UTF-8.
+	CharsetLatin1 Charset = "ISO-8859-1"
+
+	// CharsetUTF16LE is detected by FF FE byte order mark at the beginning of the file.
+	CharsetUTF16LE Charset = "UTF-16LE"
+
+	// CharsetUTF16BE is detected by FE FF byte order mark at the beginning of the file.
+	CharsetUTF16BE Charset = "UTF-16BE"
+)
+
+var errInvalidJSONString = errors.New("invalid JSON string")
+
+// rawString is a JSON string which keeps the bytes which are not valid UTF-8, encoding/json replaces
+// them with utf8.RuneError. Mesos files API sends the file content as is.
+type rawString string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *rawString) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*s = ""
+		return nil
+	}
+
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errInvalidJSONString
+	}
+	data = data[1 : len(data)-1]
+
+	buf := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '\\' {
+			buf = append(buf, c)
+			continue
+		}
+
+		i++
+		if i == len(data) {
+			return errInvalidJSONString
+		}
+
+		switch data[i] {
+		case '"', '\\', '/':
+			buf = append(buf, data[i])
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, ok := unquoteRune(data[i+1:])
+			if !ok {
+				return errInvalidJSONString
+			}
+			i += 4
+
+			// a character outside of the basic multilingual plane is escaped as a surrogate pair.
+			if utf16.IsSurrogate(r) && i+6 < len(data) && data[i+1] == '\\' && data[i+2] == 'u' {
+				if r2, ok := unquoteRune(data[i+3:]); ok {
+					if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+						r = dec
+						i += 6
+					}
+				}
+			}
+
+			var encoded [utf8.UTFMax]byte
+			buf = append(buf, encoded[:utf8.EncodeRune(encoded[:], r)]...)
+		default:
+			return errInvalidJSONString
+		}
+	}
+
+	*s = rawString(buf)
+	return nil
+}
+
+func unquoteRune(data []byte) (rune, bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+
+	r, err := strconv.ParseUint(string(data[:4]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return rune(r), true
+}
+
+// validUTF8 replaces invalid bytes with utf8.RuneError, the same way encoding/json does.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	buf := make([]rune, 0, len(s))
+	for _, r := range s {
+		buf = append(buf, r)
+	}
+	return string(buf)
+}
+
+// detectBOM returns the charset of UTF-16 byte order mark at the beginning of the data.
+func detectBOM(data string) Charset {
+	switch {
+	case len(data) < 2:
+		return ""
+	case data[0] == 0xff && data[1] == 0xfe:
+		return CharsetUTF16LE
+	case data[0] == 0xfe && data[1] == 0xff:
+		return CharsetUTF16BE
+	}
+	return ""
+}
+
+// isUTF16 returns true if the charset uses 2 bytes code units.
+func (c Charset) isUTF16() bool {
+	return c == CharsetUTF16LE || c == CharsetUTF16BE
+}
+
+// unit returns UTF-16 code unit at i.
+func (c Charset) unit(data string, i int) uint16 {
+	if c == CharsetUTF16BE {
+		return uint16(data[i])<<8 | uint16(data[i+1])
+	}
+	return uint16(data[i+1])<<8 | uint16(data[i])
+}
+
+// newline returns the encoded new line.
+func (c Charset) newline() string {
+	switch c {
+	case CharsetUTF16LE:
+		return "\n\x00"
+	case CharsetUTF16BE:
+		return "\x00\n"
+	}
+	return "\n"
+}
+
+// encode encodes UTF-8 text in the charset.
+func (c Charset) encode(s string) string {
+	if !c.isUTF16() {
+		return s
+	}
+
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if c == CharsetUTF16BE {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return string(b)
+}
+
+// transcode converts a line to UTF-8 and returns the charset the line was decoded from. Lines which are
+// not valid UTF-8 are decoded as Latin-1.
+func (c Charset) transcode(line string) (string, Charset) {
+	if c.isUTF16() {
+		units := make([]uint16, 0, len(line)/2)
+		for i := 0; i+1 < len(line); i += 2 {
+			units = append(units, c.unit(line, i))
+		}
+
+		// drop the byte order mark.
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		return string(utf16.Decode(units)), c
+	}
+
+	if utf8.ValidString(line) {
+		return line, CharsetUTF8
+	}
+
+	runes := make([]rune, len(line))
+	for i := 0; i < len(line); i++ {
+		runes[i] = rune(line[i])
+	}
+	return string(runes), CharsetLatin1
+}
@@ -0,0 +1,110 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"unicode/utf16"
+)
+
+// rawJSONString encodes b as a JSON string the same way Mesos does, the bytes above 0x7f are written as is.
+func rawJSONString(b []byte) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20:
+			fmt.Fprintf(buf, "\\u%04x", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func readRaw(t *testing.T, data []byte, opts ...Option) []byte {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := []byte{}
+		if offset >= 0 && offset < len(data) {
+			d = data[offset:]
+		}
+		fmt.Fprintf(w, `{"data":%s,"offset":%d}`, rawJSONString(d), offset)
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", SSEFormat, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestRawString(t *testing.T) {
+	var s rawString
+	input := []byte(`"caf` + "\xe9" + `\né\/😀"`)
+	if err := json.Unmarshal(input, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "caf\xe9\né/😀"
+	if string(s) != expected {
+		t.Fatalf("expect %q. Got %q", expected, s)
+	}
+}
+
+func TestTranscodeLatin1(t *testing.T) {
+	data := []byte("caf\xe9\nok\n")
+	expected := `data: {"fields":{"AGENT_ID":"1","CHARSET":"ISO-8859-1","CONTAINER_ID":"4","EXECUTOR_ID":"3","FILE":"stdout","FRAMEWORK_ID":"2","MESSAGE":"café"}}`
+	if buf := readRaw(t, data, OptTranscode(true)); !bytes.Contains(buf, []byte(expected)) {
+		t.Fatalf("expect %s. Got %s", expected, buf)
+	}
+
+	// without transcoding the invalid bytes are replaced.
+	if buf := readRaw(t, data); !bytes.Contains(buf, []byte(`"MESSAGE":"caf�"`)) {
+		t.Fatalf("expect replaced invalid byte. Got %s", buf)
+	}
+}
+
+func TestTranscodeUTF16(t *testing.T) {
+	var data []byte
+	for _, u := range utf16.Encode([]rune("\ufeffhéllo\nworld\n")) {
+		data = append(data, byte(u), byte(u>>8))
+	}
+
+	buf := readRaw(t, data, OptTranscode(true))
+	for _, expected := range []string{`"CHARSET":"UTF-16LE"`, `"MESSAGE":"héllo"`, `"MESSAGE":"world"`} {
+		if !bytes.Contains(buf, []byte(expected)) {
+			t.Fatalf("expect %s. Got %s", expected, buf)
+		}
+	}
+
+	// the line sizes are in the original encoding.
+	if !bytes.Contains(buf, []byte("id: 24\n")) {
+		t.Fatalf("expect ids to be the offsets in the file. Got %s", buf)
+	}
+}
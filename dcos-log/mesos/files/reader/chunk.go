@@ -0,0 +1,91 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// chunk is the result of a read of the files API started ahead of time.
+type chunk struct {
+	offset int
+	done   chan struct{}
+
+	data string
+	err  error
+}
+
+// prefetch starts to read the chunk at the current offset in the background. The chunk is read with the context of
+// the reader, it outlives the ReadContext call which started it.
+func (rm *ReadManager) prefetch() {
+	c := &chunk{offset: rm.offset, done: make(chan struct{})}
+	rm.next = c
+
+	parent := rm.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	go func() {
+		defer close(c.done)
+
+		ctx, cancel := context.WithTimeout(parent, time.Second*3)
+		defer cancel()
+		c.data, c.err = rm.readChunkAt(ctx, c.offset)
+	}()
+}
+
+// readChunk returns the raw content of the chunk at the current offset, the prefetched chunk is used if it was read
+// from the same offset. A prefetched chunk which failed or was at the end of the file is read again, the file
+// may have grown since.
+func (rm *ReadManager) readChunk() (string, error) {
+	defer func(start time.Time) {
+		chunkReadDuration.WithLabelValues().Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	// the size is known before a chunk is prefetched.
+	if rm.chunkCache != nil && !rm.stream {
+		rm.loadCacheFileSize()
+	}
+
+	if c := rm.next; c != nil {
+		rm.next = nil
+		if c.offset == rm.offset {
+			select {
+			case <-c.done:
+			case <-rm.parentContext().Done():
+				return "", rm.parentContext().Err()
+			}
+
+			if c.err == nil {
+				chunkPrefetches.WithLabelValues("hit").Inc()
+				return c.data, nil
+			}
+		}
+		chunkPrefetches.WithLabelValues("miss").Inc()
+	}
+
+	ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+	defer cancel()
+	return rm.readChunkAt(ctx, rm.offset)
+}
+
+// OptChunkSize sets the number of bytes requested from the files API at once, 64KiB by default. Larger chunks
+// need fewer requests to page through large files over high latency links.
+func OptChunkSize(n int) Option {
+	return func(rm *ReadManager) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid chunk size %d. Must be positive", n)
+		}
+		rm.chunkSize = n
+		return nil
+	}
+}
+
+// OptReadAhead requests the next chunk of the file while the lines of the current chunk are consumed.
+func OptReadAhead(readAhead bool) Option {
+	return func(rm *ReadManager) error {
+		rm.readAhead = readAhead
+		return nil
+	}
+}
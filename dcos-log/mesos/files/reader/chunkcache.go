@@ -0,0 +1,134 @@
+package reader
+
+import (
+	"container/list"
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+)
+
+var chunkCacheLookups = metrics.NewCounterVec("dcos_log_files_api_chunk_cache_lookups_total",
+	"Lookups of file chunks in the chunk cache by result (hit, miss).", "result")
+
+// chunkKey identifies a chunk of a sandbox file of a given size. A file which grew has a new size, so its chunks
+// are read again.
+type chunkKey struct {
+	host   string
+	path   string
+	offset int
+	length int
+	size   int
+}
+
+type chunkCacheEntry struct {
+	key  chunkKey
+	data string
+}
+
+// ChunkCache is an LRU cache of the chunks of sandbox files, shared by the readers created with OptChunkCache.
+// Repeated reads of the same region of a file which does not grow, like the scrollback of a UI, are not fetched
+// from the agent again.
+type ChunkCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[chunkKey]*list.Element
+	lru     *list.List
+}
+
+// NewChunkCache returns a cache of up to size chunks, nil if size is not positive.
+func NewChunkCache(size int) *ChunkCache {
+	if size <= 0 {
+		return nil
+	}
+	return &ChunkCache{size: size, entries: make(map[chunkKey]*list.Element), lru: list.New()}
+}
+
+func (c *ChunkCache) get(key chunkKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		chunkCacheLookups.WithLabelValues("miss").Inc()
+		return "", false
+	}
+
+	c.lru.MoveToFront(el)
+	chunkCacheLookups.WithLabelValues("hit").Inc()
+	return el.Value.(*chunkCacheEntry).data, true
+}
+
+func (c *ChunkCache) add(key chunkKey, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&chunkCacheEntry{key: key, data: data})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*chunkCacheEntry).key)
+	}
+}
+
+// OptChunkCache reads the chunks of the file through a shared cache. Only the readers which do not stream or follow
+// the file use it, and only the full chunks are cached. The size of the file is requested once per reader, it is
+// part of the key of the chunks. Nil cache disables it.
+func OptChunkCache(c *ChunkCache) Option {
+	return func(rm *ReadManager) error {
+		rm.chunkCache = c
+		return nil
+	}
+}
+
+// loadCacheFileSize requests the size of the file once, it's the size of the cached chunks. The cache is not used
+// by the reader if the size cannot be read.
+func (rm *ReadManager) loadCacheFileSize() {
+	if rm.cacheFileSize != 0 {
+		return
+	}
+
+	rm.cacheFileSize = -1
+	if size, err := rm.Size(); err == nil && size > 0 {
+		rm.cacheFileSize = size
+	}
+}
+
+// chunkKey returns the cache key of the chunk at offset, false if the chunk must not be cached.
+func (rm *ReadManager) chunkKey(offset int) (chunkKey, bool) {
+	if rm.chunkCache == nil || rm.stream || rm.cacheFileSize <= 0 || offset+rm.chunkSize > rm.cacheFileSize {
+		return chunkKey{}, false
+	}
+
+	return chunkKey{
+		host:   rm.readEndpoint.Host,
+		path:   filepath.Join(rm.sandboxPath, rm.file),
+		offset: offset,
+		length: rm.chunkSize,
+		size:   rm.cacheFileSize,
+	}, true
+}
+
+// readChunkAt reads the chunk of the file at offset, from the cache if the same chunk was read before.
+func (rm *ReadManager) readChunkAt(ctx context.Context, offset int) (string, error) {
+	key, ok := rm.chunkKey(offset)
+	if !ok {
+		return rm.readFile(ctx, rm.file, offset, rm.chunkSize)
+	}
+
+	if data, ok := rm.chunkCache.get(key); ok {
+		return data, nil
+	}
+
+	data, err := rm.readFile(ctx, rm.file, offset, rm.chunkSize)
+	if err == nil && len(data) == rm.chunkSize {
+		rm.chunkCache.add(key, data)
+	}
+	return data, err
+}
@@ -0,0 +1,54 @@
+package reader
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// NewLineReaderContext is NewLineReader with the requests to the agent canceled when ctx is done, such as the
+// context of the HTTP request the file is read for. It's the same as passing OptContext(ctx) first.
+func NewLineReaderContext(ctx context.Context, client *http.Client, agentURL url.URL, agentID, frameworkID, executorID,
+	containerID, taskPath, file string, format Formatter, opts ...Option) (*ReadManager, error) {
+	return NewLineReader(client, agentURL, agentID, frameworkID, executorID, containerID, taskPath, file, format,
+		append([]Option{OptContext(ctx)}, opts...)...)
+}
+
+// ReadContext is Read with the requests to the agent made by the call canceled when ctx or the context of the
+// reader is done, the error of the context is returned.
+func (rm *ReadManager) ReadContext(ctx context.Context, b []byte) (int, error) {
+	defer rm.withCallContext(ctx)()
+	return rm.Read(b)
+}
+
+// NextLine returns the next formatted line, or the next chunk of the file read with OptRaw, io.EOF at the end of
+// the file or once the limit is reached. The rest of a line partially returned by Read is returned first. The
+// requests to the agent are canceled when ctx or the context of the reader is done.
+func (rm *ReadManager) NextLine(ctx context.Context) (string, error) {
+	if rm.pending != "" {
+		line := rm.pending
+		rm.pending = ""
+		return line, nil
+	}
+
+	defer rm.withCallContext(ctx)()
+	return rm.nextEntry()
+}
+
+// withCallContext makes ctx, bound to the context of the reader, the context of the requests until the returned
+// function is called.
+func (rm *ReadManager) withCallContext(ctx context.Context) func() {
+	if rm.ctx == nil {
+		rm.callCtx = ctx
+		return func() { rm.callCtx = nil }
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(rm.ctx, cancel)
+	rm.callCtx = ctx
+	return func() {
+		stop()
+		cancel()
+		rm.callCtx = nil
+	}
+}
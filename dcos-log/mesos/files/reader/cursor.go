@@ -0,0 +1,193 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// fingerprintSize is the number of bytes at the beginning of a file used to identify it.
+	fingerprintSize = 256
+
+	// maxGenerations is the number of rotated files checked when a cursor is resolved.
+	maxGenerations = 9
+)
+
+var (
+	// ErrInvalidCursor is returned by ParseCursor if the cursor is not in fingerprint.generation.offset format.
+	ErrInvalidCursor = errors.New("invalid cursor, must be fingerprint.generation.offset")
+
+	// ErrCursorExpired is returned if the file a cursor points to was rotated away.
+	ErrCursorExpired = errors.New("cursor points to a file which was rotated away")
+)
+
+// Cursor is a position in a sandbox file which remains valid when the file is rotated. Mesos log rotation
+// renames stdout to stdout.1, stdout.1 to stdout.2 and so on, Generation is the number of the file the
+// offset belongs to and Fingerprint identifies the content of the file before the offset.
+type Cursor struct {
+	Fingerprint string
+	Generation  int
+	Offset      int
+}
+
+// String returns the cursor in fingerprint.generation.offset format.
+func (c Cursor) String() string {
+	return fmt.Sprintf("%s.%d.%d", c.Fingerprint, c.Generation, c.Offset)
+}
+
+// ParseCursor parses a cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	generation, err := strconv.Atoi(parts[1])
+	if err != nil || generation < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil || offset < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Fingerprint: parts[0], Generation: generation, Offset: offset}, nil
+}
+
+// fingerprint returns a hash of the first fingerprintSize bytes of the file before the offset.
+func fingerprint(head string, offset int) string {
+	if offset < len(head) {
+		head = head[:offset]
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(head))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// generationFile returns the name of a rotated file.
+func generationFile(file string, generation int) string {
+	if generation == 0 {
+		return file
+	}
+	return file + "." + strconv.Itoa(generation)
+}
+
+// OptCursor moves the reader to a position of the cursor. If the file was rotated since the cursor was
+// returned, the reader follows the content to the rotated file. The reader returns rotation stable SSE ids.
+func OptCursor(c Cursor) Option {
+	return func(rm *ReadManager) error {
+		ctx, cancel := context.WithTimeout(rm.parentContext(), 3*time.Second)
+		defer cancel()
+
+		rm.stableCursors = true
+		return rm.resolveCursor(ctx, c)
+	}
+}
+
+// OptStableCursors makes the reader return rotation stable cursors as SSE ids instead of offsets.
+func OptStableCursors(stable bool) Option {
+	return func(rm *ReadManager) error {
+		rm.stableCursors = stable
+		return nil
+	}
+}
+
+func (rm *ReadManager) resolveCursor(ctx context.Context, c Cursor) error {
+	size := fingerprintSize
+	if c.Offset < size {
+		size = c.Offset
+	}
+
+	base := rm.file
+	for generation := c.Generation; generation <= c.Generation+maxGenerations; generation++ {
+		file := generationFile(base, generation)
+
+		var head string
+		if size > 0 {
+			var err error
+			head, err = rm.readFile(ctx, file, 0, size)
+			if err == ErrFileNotFound {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if len(head) > size {
+				head = head[:size]
+			}
+		}
+
+		if len(head) != size || fingerprint(head, c.Offset) != c.Fingerprint {
+			continue
+		}
+
+		offset := c.Offset
+
+		// the end of a rotated file, continue at the beginning of the next generation.
+		if generation > 0 {
+			fileSize, err := rm.fileSize(ctx, file)
+			if err != nil {
+				return err
+			}
+
+			if offset >= fileSize {
+				generation--
+				file = generationFile(base, generation)
+				offset = 0
+			}
+		}
+
+		rm.file, rm.generation, rm.offset, rm.head = file, generation, offset, ""
+		return nil
+	}
+
+	return ErrCursorExpired
+}
+
+// Cursor returns a rotation stable cursor of the position right after the last line returned by Read, or of
+// the start position if no line was read. A new reader with OptCursor continues from the next line.
+func (rm *ReadManager) Cursor() string {
+	stable := rm.stableCursors
+	rm.stableCursors = true
+	defer func() { rm.stableCursors = stable }()
+
+	return rm.cursorID(rm.position)
+}
+
+// cursorID returns an SSE id for a given offset.
+func (rm *ReadManager) cursorID(offset int) string {
+	if !rm.stableCursors {
+		return strconv.Itoa(offset)
+	}
+
+	// the head of the file does not change until the file is rotated.
+	if len(rm.head) < fingerprintSize && len(rm.head) < offset {
+		ctx, cancel := context.WithTimeout(rm.parentContext(), 3*time.Second)
+		defer cancel()
+
+		head, err := rm.readFile(ctx, rm.file, 0, fingerprintSize)
+		if err != nil {
+			return strconv.Itoa(offset)
+		}
+
+		if len(head) > fingerprintSize {
+			head = head[:fingerprintSize]
+		}
+		rm.head = head
+	}
+
+	if len(rm.head) < fingerprintSize && len(rm.head) < offset {
+		return strconv.Itoa(offset)
+	}
+
+	return Cursor{Fingerprint: fingerprint(rm.head, offset), Generation: rm.generation, Offset: offset}.String()
+}
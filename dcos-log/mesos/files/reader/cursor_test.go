@@ -0,0 +1,184 @@
+package reader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newSandboxServer serves files API read requests for the files in a sandbox.
+func newSandboxServer(t *testing.T, files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[path.Base(r.URL.Query().Get("path"))]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := &response{Offset: offset}
+		if offset == -1 {
+			resp.Offset = len(data)
+		} else if offset < len(data) {
+			resp.Data = rawString(data[offset:])
+			if length, err := strconv.Atoi(r.URL.Query().Get("length")); err == nil && length < len(resp.Data) {
+				resp.Data = resp.Data[:length]
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+}
+
+func newSandboxReader(t *testing.T, ts *httptest.Server, format Formatter, opts ...Option) (*ReadManager, error) {
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", format, opts...)
+}
+
+func TestParseCursor(t *testing.T) {
+	c := Cursor{Fingerprint: "af63bd4c8601b7be", Generation: 1, Offset: 42}
+	parsed, err := ParseCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed != c {
+		t.Fatalf("expect %+v. Got %+v", c, parsed)
+	}
+
+	for _, invalid := range []string{"", "42", "fp.1", "fp.-1.2", "fp.1.x"} {
+		if _, err := ParseCursor(invalid); err != ErrInvalidCursor {
+			t.Fatalf("%s: expect ErrInvalidCursor. Got %v", invalid, err)
+		}
+	}
+}
+
+func TestCursorRotation(t *testing.T) {
+	files := map[string]string{"stdout": "one\ntwo\nthree\n"}
+	ts := newSandboxServer(t, files)
+	defer ts.Close()
+
+	r, err := newSandboxReader(t, ts, SSEFormat, OptStableCursors(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	var ids []string
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			break
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.HasPrefix(line, "id: ") {
+				ids = append(ids, strings.TrimPrefix(line, "id: "))
+			}
+		}
+	}
+
+	if len(ids) != 3 {
+		t.Fatalf("expect 3 ids. Got %v", ids)
+	}
+
+	cursor, err := ParseCursor(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cursor.Generation != 0 || cursor.Offset != 7 {
+		t.Fatalf("unexpected cursor %+v", cursor)
+	}
+
+	// the file is rotated, the cursor follows the content to stdout.1
+	files["stdout.1"] = files["stdout"]
+	files["stdout"] = "four\n"
+
+	if buf := readCursor(t, ts, cursor); buf != "three\n" {
+		t.Fatalf("expect three. Got %q", buf)
+	}
+
+	// the end of the rotated file continues at the beginning of stdout.
+	cursor = Cursor{Fingerprint: fingerprint(files["stdout.1"], 14), Generation: 1, Offset: 14}
+	if buf := readCursor(t, ts, cursor); buf != "four\n" {
+		t.Fatalf("expect four. Got %q", buf)
+	}
+
+	delete(files, "stdout.1")
+	if _, err := newSandboxReader(t, ts, LineFormat, OptCursor(cursor)); err != ErrCursorExpired {
+		t.Fatalf("expect ErrCursorExpired. Got %v", err)
+	}
+}
+
+func readCursor(t *testing.T, ts *httptest.Server, cursor Cursor) string {
+	r, err := newSandboxReader(t, ts, LineFormat, OptCursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output string
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return output
+		}
+		output += string(buf[:n])
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	files := map[string]string{"stdout": "one\ntwo\nthree\nfour\n"}
+	ts := newSandboxServer(t, files)
+	defer ts.Close()
+
+	var (
+		pages  []string
+		cursor Cursor
+	)
+	for i := 0; i < 3; i++ {
+		opts := []Option{OptLines(2)}
+		if i > 0 {
+			opts = append(opts, OptCursor(cursor))
+		}
+
+		r, err := newSandboxReader(t, ts, LineFormat, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, string(buf))
+
+		if cursor, err = ParseCursor(r.Cursor()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expect := []string{"one\ntwo\n", "three\nfour\n", ""}; strings.Join(pages, "|") != strings.Join(expect, "|") {
+		t.Fatalf("expect %q. Got %q", expect, pages)
+	}
+
+	if cursor.Offset != 18 {
+		t.Fatalf("expect the cursor at the end of the last line. Got %+v", cursor)
+	}
+}
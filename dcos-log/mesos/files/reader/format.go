@@ -1,17 +1,23 @@
 package reader
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dcos/dcos-log/dcos-log/transform"
 	"github.com/sirupsen/logrus"
 )
 
 // Formatter is an interface for formatter functions.
 type Formatter func(l Line, rm *ReadManager) string
 
-// SSEFormat implement server sent events format.
-func SSEFormat(l Line, rm *ReadManager) (output string) {
+// SSEFormat implement server sent events format. The data is a JSON object with the message and the task fields,
+// the id is the offset right after the line, which is the position a reconnecting client resumes from.
+func SSEFormat(l Line, rm *ReadManager) string {
 
 	var line Line
 	// try using the json in response
@@ -23,12 +29,11 @@ func SSEFormat(l Line, rm *ReadManager) (output string) {
 		line = l
 	}
 
-	if line.Offset > 0 && line.Size > 0 {
-		output += fmt.Sprintf("id: %d\n", line.Offset+line.Size)
+	// a single concatenation allocates the output once.
+	if line.Offset+line.Size > 0 {
+		return "id: " + rm.cursorID(line.Offset+line.Size) + "\ndata: " + line.Message + "\n\n"
 	}
-
-	output += fmt.Sprintf("data: %s\n\n", line.Message)
-	return output
+	return "data: " + line.Message + "\n\n"
 }
 
 // LineFormat is a simple \readLimit separates format.
@@ -45,6 +50,22 @@ func jsonifyLine(l Line, rm *ReadManager) (*Line, error) {
 			"FRAMEWORK_ID": rm.frameworkID, "CONTAINER_ID": rm.containerID, "FILE": rm.file},
 	}
 
+	if rm.taskPath != "" {
+		structMsg.Fields["TASK_PATH"] = rm.taskPath
+	}
+
+	if l.Charset != "" {
+		structMsg.Fields["CHARSET"] = l.Charset
+	}
+
+	if !l.Time.IsZero() {
+		structMsg.Fields[TimeField] = l.Time.Format(time.RFC3339Nano)
+	}
+
+	for k, v := range l.Fields {
+		structMsg.Fields[k] = v
+	}
+
 	marshaledStructMessage, err := json.Marshal(structMsg)
 	if err != nil {
 		return nil, err
@@ -55,3 +76,172 @@ func jsonifyLine(l Line, rm *ReadManager) (*Line, error) {
 
 	return &newLine, nil
 }
+
+// TransformFormat returns a Formatter which applies fn to the line message before formatting it with format.
+func TransformFormat(format Formatter, fn func(string) string) Formatter {
+	if fn == nil {
+		return format
+	}
+
+	return func(l Line, rm *ReadManager) string {
+		l.Message = fn(l.Message)
+		return format(l, rm)
+	}
+}
+
+// FieldsFormat returns a Formatter which calls fn with the fields of the line and formats the line with the
+// updated MESSAGE and fields. The lines fn returns false for are dropped, their output is empty.
+func FieldsFormat(format Formatter, fn func(map[string]string) bool) Formatter {
+	if fn == nil {
+		return format
+	}
+
+	return func(l Line, rm *ReadManager) string {
+		fields := rm.lineFields(l)
+		if !fn(fields) {
+			return ""
+		}
+
+		l.Message = fields["MESSAGE"]
+		delete(fields, "MESSAGE")
+		l.Fields = fields
+		return format(l, rm)
+	}
+}
+
+// CoalesceFormat returns a Formatter which collapses the runs of consecutive lines with the same message. The first
+// line of a run is formatted, the repeats are held back. Once the run ends, the last repeat is formatted before the
+// next line with the message of transform.Repeated and transform.RepeatCountField set to the number of repeats, so
+// its offset is the position right after the run. A run still going on at the end of a read is sent as its first
+// line only. The Formatter keeps the run of a single reader and must not be shared.
+func CoalesceFormat(format Formatter) Formatter {
+	var (
+		last    Line
+		repeats int
+		started bool
+	)
+
+	return func(l Line, rm *ReadManager) string {
+		if started && l.Message == last.Message && l.Fields["FILE"] == last.Fields["FILE"] {
+			repeats++
+			last = l
+			return ""
+		}
+
+		var out string
+		switch {
+		case repeats == 1:
+			out = format(last, rm)
+		case repeats > 1:
+			fields := make(map[string]string, len(last.Fields)+1)
+			for k, v := range last.Fields {
+				fields[k] = v
+			}
+			fields[transform.RepeatCountField] = strconv.Itoa(repeats)
+
+			repeated := last
+			repeated.Message = transform.Repeated(last.Message, repeats)
+			repeated.Fields = fields
+			out = format(repeated, rm)
+		}
+
+		last, repeats, started = l, 0, true
+		return out + format(l, rm)
+	}
+}
+
+// maxJSONFields is the number of fields JSONFieldsFormat promotes from a line, the keys are promoted in sorted order
+// and the others are dropped.
+const maxJSONFields = 64
+
+// taskFields are the fields set by the reader, a JSON line cannot override them.
+var taskFields = map[string]bool{"MESSAGE": true, "AGENT_ID": true, "FRAMEWORK_ID": true, "EXECUTOR_ID": true,
+	"CONTAINER_ID": true, "FILE": true, "TASK_PATH": true, "CHARSET": true, TimeField: true}
+
+// JSONFieldsFormat returns a Formatter which promotes the keys of the lines which are JSON objects to fields of the
+// line, the message is kept as is. The keys are upper cased with the characters other than letters, digits and
+// underscores replaced by underscores and the leading underscores removed, like journal field names. The keys of the
+// task fields are prefixed with JSON_. String values are promoted as is, null as empty and the other values JSON
+// encoded. It's meant for JSON based formats, the fields are not part of text lines.
+func JSONFieldsFormat(format Formatter) Formatter {
+	return func(l Line, rm *ReadManager) string {
+		trimmed := strings.TrimSpace(l.Message)
+		if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+			return format(l, rm)
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &object); err != nil {
+			return format(l, rm)
+		}
+
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fields := make(map[string]string, len(l.Fields)+len(object))
+		for _, k := range keys {
+			if len(fields) == maxJSONFields {
+				break
+			}
+
+			name := jsonFieldName(k)
+			if name == "" {
+				continue
+			}
+
+			if taskFields[name] {
+				name = "JSON_" + name
+			}
+
+			var s string
+			if err := json.Unmarshal(object[k], &s); err != nil {
+				s = string(bytes.TrimSpace(object[k]))
+			}
+			fields[name] = s
+		}
+
+		// the fields of the reader, such as FILE of rotated files, are kept.
+		for k, v := range l.Fields {
+			fields[k] = v
+		}
+
+		l.Fields = fields
+		return format(l, rm)
+	}
+}
+
+// jsonFieldName returns the field name of a JSON key, empty if nothing is left of it.
+func jsonFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+	return strings.TrimLeft(name, "_")
+}
+
+// lineFields returns the message and the task fields of a line.
+func (rm *ReadManager) lineFields(l Line) map[string]string {
+	fields := map[string]string{"MESSAGE": l.Message, "AGENT_ID": rm.agentID, "EXECUTOR_ID": rm.executorID,
+		"FRAMEWORK_ID": rm.frameworkID, "CONTAINER_ID": rm.containerID, "FILE": rm.file}
+	if rm.taskPath != "" {
+		fields["TASK_PATH"] = rm.taskPath
+	}
+
+	if !l.Time.IsZero() {
+		fields[TimeField] = l.Time.Format(time.RFC3339Nano)
+	}
+
+	// the lines of rotated files have their own FILE field.
+	for k, v := range l.Fields {
+		fields[k] = v
+	}
+	return fields
+}
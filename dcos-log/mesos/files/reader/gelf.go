@@ -0,0 +1,74 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// gelfLevelError and gelfLevelInfo are the syslog levels of stderr and stdout lines.
+	gelfLevelError = 3
+	gelfLevelInfo  = 6
+)
+
+// gelfFieldName is the format of GELF additional field names without the leading underscore.
+var gelfFieldName = regexp.MustCompile(`^[\w.\-]+$`)
+
+// GELFFormat returns a Formatter of GELF 1.1 messages, one JSON message per line. The timestamp is the time of the
+// line set by OptTimestamps, or the time the line was read. The lines of stderr have level 3 (error), the other
+// files have level 6 (informational). The task fields are sent as additional fields.
+func GELFFormat(host string) Formatter {
+	return func(l Line, rm *ReadManager) string {
+		now := time.Now()
+		if !l.Time.IsZero() {
+			now = l.Time
+		}
+
+		msg := map[string]interface{}{
+			"version":       "1.1",
+			"host":          host,
+			"short_message": l.Message,
+			"timestamp":     json.Number(fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)),
+			"level":         gelfLevelInfo,
+			"_offset":       l.Offset,
+		}
+
+		if strings.HasPrefix(path.Base(rm.file), "stderr") {
+			msg["level"] = gelfLevelError
+		}
+
+		fields := rm.lineFields(l)
+		for k, v := range l.Fields {
+			fields[k] = v
+		}
+
+		if l.Charset != "" {
+			fields["CHARSET"] = string(l.Charset)
+		}
+
+		for k, v := range fields {
+			if k == "MESSAGE" {
+				continue
+			}
+
+			// GELF reserves _id.
+			name := strings.ToLower(strings.TrimLeft(k, "_"))
+			if name != "id" && gelfFieldName.MatchString(name) {
+				msg["_"+name] = v
+			}
+		}
+
+		b, err := json.Marshal(msg)
+		if err != nil {
+			logrus.Errorf("unable to encode a GELF message: %s", err)
+			return ""
+		}
+		return string(b) + "\n"
+	}
+}
@@ -0,0 +1,78 @@
+package reader
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DefaultWorkDir is mesos agent --work_dir on DC/OS, the sandboxes are in its slaves directory.
+const DefaultWorkDir = "/var/lib/mesos/slave"
+
+// Sandbox is an executor run with a sandbox directory on the agent.
+type Sandbox struct {
+	FrameworkID string
+	ExecutorID  string
+	ContainerID string
+}
+
+// AgentSandboxes walks the frameworks, executors and runs directories of an agent with a given work directory and
+// returns the sandboxes which still exist. The browseURL is the files API /files/browse URL or the operator API URL. The runs/latest symlink is
+// skipped, it points to one of the runs.
+func AgentSandboxes(client *http.Client, browseURL url.URL, header http.Header, workDir,
+	agentID string) ([]Sandbox, error) {
+	frameworksDir := path.Join(workDir, "slaves", agentID, "frameworks")
+	frameworks, err := browseSubdirs(client, browseURL, header, frameworksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sandboxes []Sandbox
+	for _, frameworkID := range frameworks {
+		executorsDir := path.Join(frameworksDir, frameworkID, "executors")
+		executors, err := browseSubdirs(client, browseURL, header, executorsDir)
+		if err == ErrFileNotFound {
+			// the framework directory was garbage collected in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, executorID := range executors {
+			runs, err := browseSubdirs(client, browseURL, header, path.Join(executorsDir, executorID, "runs"))
+			if err == ErrFileNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			for _, containerID := range runs {
+				if containerID == "latest" {
+					continue
+				}
+				sandboxes = append(sandboxes, Sandbox{FrameworkID: frameworkID, ExecutorID: executorID,
+					ContainerID: containerID})
+			}
+		}
+	}
+	return sandboxes, nil
+}
+
+// browseSubdirs returns the names of the directories in an agent directory.
+func browseSubdirs(client *http.Client, browseURL url.URL, header http.Header, dir string) ([]string, error) {
+	files, err := browseDir(client, browseURL, header, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Mode, "d") {
+			dirs = append(dirs, f.Name)
+		}
+	}
+	return dirs, nil
+}
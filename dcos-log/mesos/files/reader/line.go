@@ -1,8 +1,23 @@
 package reader
 
+import "time"
+
 // Line is a structure for a line message with offset.
 type Line struct {
 	Message string
 	Offset  int
 	Size    int
+
+	// Truncated is the number of bytes at the end of the line which were dropped, see OptTruncateLines. Size
+	// includes them.
+	Truncated int
+
+	// Charset is set if the line was transcoded to UTF-8.
+	Charset Charset
+
+	// Time is the time at the beginning of the line or of a previous line, set by OptTimestamps.
+	Time time.Time
+
+	// Fields are set by FieldsFormat, they override the fields of JSON formatted lines.
+	Fields map[string]string
 }
@@ -0,0 +1,81 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"regexp"
+)
+
+// maxRecordLines is the number of lines merged into a record, the next line starts a new record.
+const maxRecordLines = 1000
+
+// Multiline tells the lines which continue a record written over several lines, such as a stack trace, from the
+// lines which start a new record. Either Start or Continuation is set.
+type Multiline struct {
+	// Start matches the first line of a record, the lines which do not match continue the previous record. For
+	// instance ^\d{4}-\d{2}-\d{2} for the records starting with a date.
+	Start *regexp.Regexp
+
+	// Continuation matches the lines which continue the previous record. For instance ^\s for the indented lines of
+	// a Java stack trace.
+	Continuation *regexp.Regexp
+}
+
+func (m *Multiline) continues(message string) bool {
+	if m.Start != nil {
+		return !m.Start.MatchString(message)
+	}
+	return m.Continuation.MatchString(message)
+}
+
+// OptMultiline merges the lines of a record into a single line, the message of the lines joined with new lines.
+// The offset of the merged line is the offset of the first line and its size spans to the end of the last one, so
+// the cursor of a record is the position after it. The last record read is held back until the next record starts
+// or the file does not grow for a read: at the end of the file of a range read, or for a follow interval of a
+// stream. Filters, skip and limit apply to the merged lines, the lines skipped backwards are lines.
+func OptMultiline(m Multiline) Option {
+	return func(rm *ReadManager) error {
+		if (m.Start == nil) == (m.Continuation == nil) {
+			return errors.New("multiline needs either a start or a continuation pattern")
+		}
+		rm.multiline = &m
+		return nil
+	}
+}
+
+// mergeLines merges the lines returned by scanLines into records. err is the error of scanLines, io.EOF is returned
+// as is unless a held record is complete.
+func (rm *ReadManager) mergeLines(lines []Line, err error) ([]Line, error) {
+	if err == io.EOF && rm.record != nil && (rm.recordIdle || (!rm.stream && rm.follow == 0)) {
+		record := *rm.record
+		rm.record, rm.recordIdle = nil, false
+		return []Line{record}, nil
+	}
+
+	if err != nil {
+		if err == io.EOF && rm.record != nil {
+			rm.recordIdle = true
+		}
+		return nil, err
+	}
+
+	var records []Line
+	for _, line := range lines {
+		if rm.record != nil && rm.recordLines < maxRecordLines && rm.multiline.continues(line.Message) {
+			rm.record.Message += "\n" + line.Message
+			rm.record.Size = line.Offset + line.Size - rm.record.Offset
+			rm.recordLines++
+			continue
+		}
+
+		if rm.record != nil {
+			records = append(records, *rm.record)
+		}
+
+		record := line
+		rm.record, rm.recordLines = &record, 1
+	}
+
+	rm.recordIdle = false
+	return records, nil
+}
@@ -0,0 +1,34 @@
+package reader
+
+import (
+	"encoding/json"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NDJSONFormat implements newline delimited JSON format, a JSON object per line with the message and the task
+// fields like the data of SSEFormat. The cursor is the offset right after the line, the position a client
+// resumes from.
+func NDJSONFormat(l Line, rm *ReadManager) string {
+	line := struct {
+		Fields map[string]string `json:"fields"`
+		Cursor string            `json:"cursor,omitempty"`
+	}{
+		Fields: rm.lineFields(l),
+	}
+
+	if l.Charset != "" {
+		line.Fields["CHARSET"] = string(l.Charset)
+	}
+
+	if l.Offset+l.Size > 0 {
+		line.Cursor = rm.cursorID(l.Offset + l.Size)
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		logrus.Errorf("unable to encode a JSON line: %s", err)
+		return ""
+	}
+	return string(b) + "\n"
+}
@@ -0,0 +1,186 @@
+package reader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/sirupsen/logrus"
+)
+
+// operatorPath is the path of the mesos v1 operator API of the agent.
+// http://mesos.apache.org/documentation/latest/operator-http-api/
+const operatorPath = "/api/v1"
+
+// file type bits of st_mode in the file infos of LIST_FILES.
+const (
+	modeTypeMask = 0170000
+	modeDir      = 0040000
+	modeSymlink  = 0120000
+)
+
+// operatorCall is a READ_FILE or LIST_FILES call of the operator API.
+type operatorCall struct {
+	Type      string             `json:"type"`
+	ReadFile  *operatorReadFile  `json:"read_file,omitempty"`
+	ListFiles *operatorListFiles `json:"list_files,omitempty"`
+}
+
+type operatorReadFile struct {
+	Path   string `json:"path"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+type operatorListFiles struct {
+	Path string `json:"path"`
+}
+
+// operatorResponse is the response of a READ_FILE or LIST_FILES call, data is base64 encoded.
+type operatorResponse struct {
+	ReadFile struct {
+		Size int    `json:"size"`
+		Data []byte `json:"data"`
+	} `json:"read_file"`
+	ListFiles struct {
+		FileInfos []operatorFileInfo `json:"file_infos"`
+	} `json:"list_files"`
+}
+
+// operatorFileInfo is a file info of LIST_FILES, mode is st_mode and mtime is in nanoseconds.
+type operatorFileInfo struct {
+	Path  string `json:"path"`
+	NLink uint   `json:"nlink"`
+	Size  uint64 `json:"size"`
+	MTime struct {
+		Nanoseconds int64 `json:"nanoseconds"`
+	} `json:"mtime"`
+	Mode uint32 `json:"mode"`
+	UID  string `json:"uid"`
+	GID  string `json:"gid"`
+}
+
+// OptOperatorAPI reads the files and lists the directories with READ_FILE and LIST_FILES calls of the mesos v1
+// operator API instead of the legacy /files/read and /files/browse endpoints, which are deprecated. Download
+// still uses /files/download, the operator API has no raw download.
+func OptOperatorAPI(enable bool) Option {
+	return func(rm *ReadManager) error {
+		rm.operatorAPI = enable
+		return nil
+	}
+}
+
+// OperatorURL returns the operator API URL of the agent of a files API URL.
+func OperatorURL(filesURL url.URL) url.URL {
+	filesURL.Path = operatorPath
+	filesURL.RawQuery = ""
+	return filesURL
+}
+
+// newOperatorRequest returns a POST request of an operator API call with a copy of the header.
+func newOperatorRequest(operatorURL url.URL, header http.Header, call operatorCall) (*http.Request, error) {
+	body, err := json.Marshal(call)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", operatorURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = http.Header{}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// readOperator reads length bytes of a file at offset with READ_FILE call. The response has the data and the size
+// of the file as offset, like a /files/read response.
+func (rm *ReadManager) readOperator(ctx context.Context, file string, offset, length int) (*response, error) {
+	call := operatorCall{
+		Type:     "READ_FILE",
+		ReadFile: &operatorReadFile{Path: file, Offset: offset, Length: length},
+	}
+
+	header, err := rm.requestHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newOperatorRequest(OperatorURL(rm.readEndpoint), header, call)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("READ_FILE %s offset %d length %d", file, offset, length)
+	return rm.do(req.WithContext(ctx))
+}
+
+// decodeOperator decodes READ_FILE response into a /files/read response.
+func decodeOperator(data *operatorResponse) *response {
+	return &response{Data: rawString(data.ReadFile.Data), Offset: data.ReadFile.Size}
+}
+
+// listFiles lists the files of an agent directory with LIST_FILES call.
+func listFiles(client *http.Client, operatorURL url.URL, header http.Header, dir string) ([]SandboxFile, error) {
+	req, err := newOperatorRequest(operatorURL, header, operatorCall{
+		Type:      "LIST_FILES",
+		ListFiles: &operatorListFiles{Path: dir},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make a LIST_FILES call: %s. URL %s", err, operatorURL.String())
+	}
+	defer resp.Body.Close()
+
+	logrus.Debugf("LIST_FILES %s", dir)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromStatus(resp.StatusCode)
+	}
+
+	data := &operatorResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return nil, fmt.Errorf("unable to decode operator API response: %s. URL %s", err, operatorURL.String())
+	}
+
+	files := make([]SandboxFile, 0, len(data.ListFiles.FileInfos))
+	for _, info := range data.ListFiles.FileInfos {
+		files = append(files, SandboxFile{
+			GID:   info.GID,
+			Mode:  modeString(info.Mode),
+			MTime: mTime(info.MTime.Nanoseconds / 1e9),
+			NLink: info.NLink,
+			Path:  info.Path,
+			Size:  info.Size,
+			UID:   info.UID,
+			Name:  path.Base(info.Path),
+		})
+	}
+	return files, nil
+}
+
+// modeString formats st_mode like the mode of /files/browse, for instance drwxr-xr-x.
+func modeString(mode uint32) string {
+	prefix := "-"
+	switch mode & modeTypeMask {
+	case modeDir:
+		prefix = "d"
+	case modeSymlink:
+		prefix = "l"
+	}
+	return prefix + os.FileMode(mode & 0777).String()[1:]
+}
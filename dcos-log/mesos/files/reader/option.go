@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"path"
 	"time"
 )
 
@@ -58,6 +59,33 @@ func OptStream(stream bool) Option {
 	}
 }
 
+// OptFollow makes Read block at the end of the file and poll the agent for new lines every interval, until
+// the context set by OptContext is done. Like OptStream, the limit is ignored and a line is not returned until
+// it is terminated by a new line.
+func OptFollow(interval time.Duration) Option {
+	return func(rm *ReadManager) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid follow interval %s. Must be positive", interval)
+		}
+		rm.follow = interval
+		rm.stream = true
+		return nil
+	}
+}
+
+// OptFollowBackoff doubles the interval of OptFollow after every poll which finds no new lines, up to max, so idle
+// files are polled less often. The interval is reset once the file grows. A max not greater than the follow
+// interval disables the backoff. It must follow OptFollow.
+func OptFollowBackoff(max time.Duration) Option {
+	return func(rm *ReadManager) error {
+		if max < 0 {
+			return fmt.Errorf("invalid follow backoff %s. Must be zero or positive", max)
+		}
+		rm.followMax = max
+		return nil
+	}
+}
+
 // OptOffset sets the offset in the file.
 func OptOffset(offset int) Option {
 	return func(rm *ReadManager) error {
@@ -69,10 +97,19 @@ func OptOffset(offset int) Option {
 	}
 }
 
+// OptContext cancels the requests to the agent when the context is done, Read returns the error of the context.
+// It must precede the options which read the file, such as OptReadFromEnd and OptCursor.
+func OptContext(ctx context.Context) Option {
+	return func(rm *ReadManager) error {
+		rm.ctx = ctx
+		return nil
+	}
+}
+
 // OptReadFromEnd moves the cursor to the end of file.
 func OptReadFromEnd() Option {
 	return func(rm *ReadManager) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		ctx, cancel := context.WithTimeout(rm.parentContext(), 3*time.Second)
 		defer cancel()
 
 		offset, err := rm.fileLen(ctx)
@@ -83,3 +120,89 @@ func OptReadFromEnd() Option {
 		return OptOffset(offset)(rm)
 	}
 }
+
+// OptBinaryWindow makes the reader return ErrBinaryFile if n bytes of the file contain no new line, instead of
+// returning them as a single line. Zero value disables the check.
+func OptBinaryWindow(n int) Option {
+	return func(rm *ReadManager) error {
+		if n < 0 {
+			return fmt.Errorf("invalid binary window %d. Must be zero or positive integer", n)
+		}
+		rm.binaryWindow = n
+		return nil
+	}
+}
+
+// OptMaxScanBytes makes the reader return ErrScanLimit if more than n bytes from the end of the file must be read
+// to skip the lines backwards, so skipping a few lines of a file with huge lines cannot read the whole file. Zero
+// value is no maximum.
+func OptMaxScanBytes(n int) Option {
+	return func(rm *ReadManager) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max scan bytes %d. Must be zero or positive integer", n)
+		}
+		rm.maxScanBytes = n
+		return nil
+	}
+}
+
+// OptTranscode enables charset detection. Files starting with UTF-16 byte order mark and lines which are not
+// valid UTF-8 (decoded as Latin-1) are transcoded to UTF-8, such lines have Line.Charset set.
+func OptTranscode(transcode bool) Option {
+	return func(rm *ReadManager) error {
+		rm.transcode = transcode
+		return nil
+	}
+}
+
+// OptFilter skips the lines for which fn returns false. fn is called with MESSAGE field and the task fields
+// AGENT_ID, FRAMEWORK_ID, EXECUTOR_ID, CONTAINER_ID and FILE. Limit and positive skip count the matching lines,
+// negative skip counts all lines.
+func OptFilter(fn func(map[string]string) bool) Option {
+	return func(rm *ReadManager) error {
+		rm.filter = fn
+		return nil
+	}
+}
+
+// OptWorkDir sets mesos agent --work_dir the sandboxes are in, DefaultWorkDir by default. It must precede the options
+// which set the sandbox, such as OptTaskPath and OptNestedContainer, and the options which read the file.
+func OptWorkDir(dir string) Option {
+	return func(rm *ReadManager) error {
+		if !path.IsAbs(dir) {
+			return fmt.Errorf("invalid work directory %q. Must be an absolute path", dir)
+		}
+
+		rm.workDir = path.Clean(dir)
+		rm.sandboxPath = rm.taskSandboxPath(rm.taskPath)
+		return nil
+	}
+}
+
+// OptTaskPath reads a file of a task of a pod, the task given to NewLineReader is replaced. It must precede the
+// options which read the file, such as OptReadFromEnd and OptCursor.
+func OptTaskPath(taskPath string) Option {
+	return func(rm *ReadManager) error {
+		if taskPath == "" || path.Base(taskPath) != taskPath {
+			return fmt.Errorf("invalid task path %q", taskPath)
+		}
+
+		rm.taskPath = taskPath
+		rm.sandboxPath = rm.taskSandboxPath(taskPath)
+		return nil
+	}
+}
+
+// OptNestedContainer reads a file of a container nested in the executor container, such as a task launched by the
+// UCR default executor, the sandbox is runs/<containerID>/containers/<nestedContainerID>. It must precede the options
+// which read the file, such as OptReadFromEnd and OptCursor.
+func OptNestedContainer(nestedContainerID string) Option {
+	return func(rm *ReadManager) error {
+		if nestedContainerID == "" || path.Base(nestedContainerID) != nestedContainerID {
+			return fmt.Errorf("invalid nested container ID %q", nestedContainerID)
+		}
+
+		rm.sandboxPath = path.Join(rm.executorSandboxPath(), "containers", nestedContainerID)
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package reader
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// Plan describes how a reader would read a file.
+type Plan struct {
+	Path      string `json:"path"`
+	Offset    int    `json:"offset"`
+	Direction string `json:"direction"`
+	Skip      int    `json:"skip"`
+	Limit     int    `json:"limit"`
+	Stream    bool   `json:"stream"`
+	Transcode bool   `json:"transcode"`
+
+	// Size is the size of the file, EstimatedBytes is the upper bound of the number of bytes read.
+	Size           int `json:"size"`
+	EstimatedBytes int `json:"estimated_bytes"`
+}
+
+// OptDryRun creates a reader which does not read the file, the reader must only be used to get the Plan.
+func OptDryRun() Option {
+	return func(rm *ReadManager) error {
+		rm.dryRun = true
+		return nil
+	}
+}
+
+// Plan returns the plan of the reader. The size of the file is requested from the files API, the content
+// of the file is not read.
+func (rm *ReadManager) Plan(ctx context.Context) (Plan, error) {
+	p := Plan{
+		Path:      filepath.Join(rm.sandboxPath, rm.file),
+		Offset:    rm.offset,
+		Direction: "forward",
+		Skip:      rm.skip,
+		Limit:     rm.readLimit,
+		Stream:    rm.stream,
+		Transcode: rm.transcode,
+	}
+
+	size, err := rm.fileLen(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Size = size
+
+	// negative skip moves the offset backwards before the file is read forward, the lines are not counted.
+	p.EstimatedBytes = size - rm.offset
+	if rm.readDirection == BottomToTop {
+		p.Direction = "backward"
+		p.EstimatedBytes = size
+	}
+
+	if p.EstimatedBytes < 0 {
+		p.EstimatedBytes = 0
+	}
+	return p, nil
+}
@@ -0,0 +1,50 @@
+package reader
+
+import "io"
+
+// OptRaw makes the reader return the content of the file as is, it is not split into lines or formatted. The
+// bytes are passed through the JSON of the files API unchanged, so binary files and lines without new line at
+// the end of the file are not altered. The start position is set by the other options as usual, the limit,
+// positive skip, filter and binary window are ignored. With OptFollow the reader waits for new data at the end
+// of the file.
+func OptRaw() Option {
+	return func(rm *ReadManager) error {
+		rm.raw = true
+		return nil
+	}
+}
+
+// readRaw returns the next chunk of the file at the current offset.
+func (rm *ReadManager) readRaw() (string, error) {
+	for {
+		if err := rm.parentContext().Err(); err != nil {
+			return "", err
+		}
+
+		data, err := rm.readChunk()
+		if err != nil {
+			return "", err
+		}
+
+		if data == "" {
+			if rm.follow > 0 {
+				if err := rm.wait(); err != nil {
+					return "", err
+				}
+				continue
+			}
+			return "", io.EOF
+		}
+
+		rm.idlePolls = 0
+		rm.offset += len(data)
+		rm.position = rm.offset
+
+		// a full chunk is likely followed by more data.
+		if len(data) >= rm.chunkSize && rm.readAhead {
+			rm.prefetch()
+		}
+
+		return data, nil
+	}
+}
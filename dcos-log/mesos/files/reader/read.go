@@ -15,12 +15,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	chunkSize = 1 << 16
-)
+// defaultChunkSize is the number of bytes requested from the files API at once, see OptChunkSize.
+const defaultChunkSize = 1 << 16
 
 const (
 	pathParam   = "path"
@@ -41,15 +42,48 @@ var (
 
 	// ErrFileNotFound is raised if the request file is not found in mesos files API.
 	ErrFileNotFound = errors.New("file not found")
+
+	// ErrUnauthorized is returned if the agent responds with 401 or 403, the credentials do not allow to read the
+	// sandbox.
+	ErrUnauthorized = errors.New("not authorized to read the sandbox")
+
+	// ErrAgentUnavailable is returned if the agent responds with 502, 503 or 504.
+	ErrAgentUnavailable = errors.New("agent unavailable")
+
+	// ErrOffsetOutOfRange is returned if the agent rejects the offset or the length of a read with 400 or 416.
+	ErrOffsetOutOfRange = errors.New("offset out of range")
+
+	// ErrBinaryFile is returned if a chunk of the file has no new line within the binary window. Such file
+	// is likely binary and must be downloaded instead of being read line by line.
+	ErrBinaryFile = errors.New("binary file, use download endpoint")
+
+	// ErrScanLimit is returned if the lines to skip from the end of the file do not fit in the max scan bytes, see
+	// OptMaxScanBytes.
+	ErrScanLimit = errors.New("lines to skip exceed the maximum number of bytes scanned from the end of the file")
+)
+
+var (
+	filesAPIDuration = metrics.NewHistogramVec("dcos_log_files_api_request_duration_seconds",
+		"Latency of Mesos files API requests by endpoint and status code.", metrics.DefaultLatencyBuckets, "endpoint", "code")
+
+	filesAPIRetries = metrics.NewCounterVec("dcos_log_files_api_retries_total",
+		"Mesos files API requests sent again after an error by endpoint.", "endpoint")
+
+	filesAPIReadBytes = metrics.NewCounterVec("dcos_log_files_api_read_bytes_total",
+		"Bytes of sandbox files read from the Mesos files API.")
+
+	chunkReadDuration = metrics.NewHistogramVec("dcos_log_files_api_chunk_read_duration_seconds",
+		"Time a task log read waited for a chunk of the file, including the retries.", metrics.DefaultLatencyBuckets)
+
+	chunkPrefetches = metrics.NewCounterVec("dcos_log_files_api_prefetch_total",
+		"Chunks read ahead of time by result, used by the next read (hit) or read again (miss).", "result")
 )
 
 type response struct {
-	Data   string `json:"data"`
-	Offset int    `json:"offset"`
+	Data   rawString `json:"data"`
+	Offset int       `json:"offset"`
 }
 
-type modifier func(s string) string
-
 func notEmpty(args map[string]string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("parameters cannot be empty")
@@ -64,8 +98,10 @@ func notEmpty(args map[string]string) error {
 	return nil
 }
 
-// NewLineReader is a ReadManager constructor.
-func NewLineReader(client *http.Client, masterURL url.URL, agentID, frameworkID, executorID, containerID, taskPath, file string,
+// NewLineReader is a ReadManager constructor. agentURL is the files API endpoint of the agent running the task,
+// /files/read, /files/browse or /files/download. The sandboxes are read from the agent directly, so the reader does
+// not depend on the leading master. The readers created with nil client share a tuned client, see NewTransport.
+func NewLineReader(client *http.Client, agentURL url.URL, agentID, frameworkID, executorID, containerID, taskPath, file string,
 	format Formatter, opts ...Option) (*ReadManager, error) {
 
 	// make sure the required parameters are set properly
@@ -74,24 +110,27 @@ func NewLineReader(client *http.Client, masterURL url.URL, agentID, frameworkID,
 		return nil, err
 	}
 
-	sandboxPath := path.Join("/var/lib/mesos/slave/slaves", agentID, "/frameworks", frameworkID, "/executors", executorID, "/runs", containerID)
-	if taskPath != "" {
-		sandboxPath = path.Join(sandboxPath, path.Join("tasks", taskPath))
+	if client == nil {
+		client = sharedClient
 	}
 
 	rm := &ReadManager{
 		client: client,
 
 		file:         file,
-		readEndpoint: masterURL,
-		sandboxPath:  sandboxPath,
+		chunkSize:    defaultChunkSize,
+		maxLineSize:  defaultMaxLineSize,
+		readEndpoint: agentURL,
+		workDir:      DefaultWorkDir,
 		formatFn:     format,
 
 		agentID:     agentID,
 		frameworkID: frameworkID,
 		executorID:  executorID,
 		containerID: containerID,
+		taskPath:    taskPath,
 	}
+	rm.sandboxPath = rm.taskSandboxPath(taskPath)
 
 	for _, opt := range opts {
 		if opt != nil {
@@ -101,15 +140,22 @@ func NewLineReader(client *http.Client, masterURL url.URL, agentID, frameworkID,
 		}
 	}
 
-	if rm.readDirection == BottomToTop && rm.skip != 0 {
+	// the byte order mark is at the beginning of the file, which is not read if the reader starts at the end.
+	if rm.transcode && !rm.dryRun {
+		if err := rm.detectCharset(); err != nil {
+			return nil, err
+		}
+	}
+
+	if rm.readDirection == BottomToTop && rm.skip != 0 && !rm.dryRun {
 		var (
 			offset int
 			length int
 		)
 
-		if rm.offset > chunkSize {
-			offset = rm.offset - chunkSize
-			length = chunkSize
+		if rm.offset > rm.chunkSize {
+			offset = rm.offset - rm.chunkSize
+			length = rm.chunkSize
 		} else {
 			// offset 0
 			length = rm.offset
@@ -121,59 +167,119 @@ func NewLineReader(client *http.Client, masterURL url.URL, agentID, frameworkID,
 		}
 	}
 
+	// the lines matching a filter are counted by Read.
+	if rm.readDirection != BottomToTop && rm.skip > 0 && rm.filter == nil && !rm.raw && !rm.dryRun {
+		if err := rm.seekLine(); err != nil {
+			return nil, err
+		}
+	}
+
 	// guard against negative offset
 	if rm.offset < 0 {
 		rm.offset = 0
 	}
+	rm.position = rm.offset
 
 	return rm, nil
 }
 
+// executorSandboxPath returns the path of the executor sandbox, the sandbox of a pod.
+func (rm *ReadManager) executorSandboxPath() string {
+	return path.Join(rm.workDir, "slaves", rm.agentID, "/frameworks", rm.frameworkID, "/executors", rm.executorID,
+		"/runs", rm.containerID)
+}
+
+// taskSandboxPath returns the path of the sandbox of a task of a pod, or of the executor if taskPath is empty.
+func (rm *ReadManager) taskSandboxPath(taskPath string) string {
+	if taskPath == "" {
+		return rm.executorSandboxPath()
+	}
+	return path.Join(rm.executorSandboxPath(), path.Join("tasks", taskPath))
+}
+
+// calcOffset moves the reader to the beginning of the skip-th line from the end. The file is read backwards in
+// chunks, starting with the chunk at offset. Only the offsets of the lines are kept, and ErrScanLimit is returned
+// once more than the max scan bytes of the file are read without finding the line.
 func calcOffset(offset, length int, rm *ReadManager) error {
-	var foundLines int
+	skip := rm.skip
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		lines, delta, err := rm.read(ctx, offset, length, reverse)
-		if err != nil {
-			cancel()
-			return err
+	// make skip a positive number
+	if skip < 0 {
+		skip = rm.skip * -1
+	}
+
+	// empty lines are not returned by Read, they are not counted.
+	var found int
+	count := func(start, size int) bool {
+		if size == 0 {
+			return true
 		}
 
-		cancel()
+		found++
+		if found == skip {
+			rm.offset = start
+			return false
+		}
+		return true
+	}
 
-		skip := rm.skip
+	var scanned int
+	scanner := newReverseScanner(rm.charset, rm.delim(), offset+length)
+	for {
+		// the chunk is shortened to the bytes left to scan.
+		if rm.maxScanBytes > 0 {
+			left := rm.maxScanBytes - scanned
+			if left <= 0 {
+				return ErrScanLimit
+			}
 
-		// make skip a positive number
-		if skip < 0 {
-			skip = rm.skip * -1
+			if length > left {
+				offset += length - left
+				length = left
+			}
 		}
+		scanned += length
 
-		// if the required number of lines found, we need to calculate an offset
-		if foundLines+len(lines) >= skip {
-			for i, skipped := 0, 0; skipped < skip && i < len(lines); i++ {
-				if lines[i].Message != "" {
-					skipped++
-				}
-				rm.offset -= len(lines[i].Message) + 1
+		var data string
+		if length > 0 {
+			ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+			var err error
+
+			// the raw content, a character split at the chunk edge must keep its size in bytes.
+			data, err = rm.readFile(ctx, rm.file, offset, length)
+			cancel()
+			if err != nil {
+				return err
+			}
+
+			if len(data) > length {
+				data = data[:length]
 			}
-			return nil
 		}
 
-		// if the current chunk contains less then requested lines, then add to a counter
-		// and continue search.
-		foundLines += len(lines)
+		if rm.binaryWindow > 0 && len(data) >= rm.binaryWindow && !strings.Contains(data[:rm.binaryWindow], rm.delim()) {
+			return ErrBinaryFile
+		}
 
-		length = chunkSize
-		offset -= chunkSize - delta
-		rm.offset = offset
+		if !scanner.scan(data, offset, count) {
+			return nil
+		}
 
-		// if the offset is 0 or negative value, the means we reached the top of the file.
-		// we can just set the offset to 0 and read the entire file
-		if offset < 0 {
+		if offset == 0 {
+			if size, ok := scanner.flush(); ok && !count(0, size) {
+				return nil
+			}
+
+			// the top of the file is reached, the file has less lines than requested.
 			rm.offset = 0
+			rm.missing = skip - found
 			return nil
 		}
+
+		if length = rm.chunkSize; length > offset {
+			length = offset
+		}
+		offset -= length
 	}
 }
 
@@ -185,6 +291,11 @@ type ReadManager struct {
 	readEndpoint url.URL
 	sandboxPath  string
 	header       http.Header
+	headers      HeaderProvider
+	renewHeaders HeaderProvider
+
+	// authorized is set to 1 once a request succeeded, the next requests use renewHeaders.
+	authorized int32
 
 	readDirection ReadDirection
 	readLimit     int
@@ -196,11 +307,112 @@ type ReadManager struct {
 	offset int
 	lines  []Line
 
+	// chunkSize is the number of bytes requested at once, set by OptChunkSize.
+	chunkSize int
+
+	// readAhead enables prefetching of the next chunk, set by OptReadAhead. next is the prefetched chunk.
+	readAhead bool
+	next      *chunk
+
+	// scanner splits the chunks into lines, it is created by the first Read at the current offset. maxLineSize
+	// is the longest line kept in memory, set by OptMaxLineSize, and truncateLines drops the end of the longer
+	// lines, set by OptTruncateLines.
+	scanner       *lineScanner
+	maxLineSize   int
+	truncateLines bool
+
+	// pending is the part of a formatted line which was not returned by Read yet.
+	pending string
+
+	// position is the offset right after the last line returned by Read.
+	position int
+
 	readLines int
 	stream    bool
 
+	// binaryWindow is the number of bytes which must contain a new line, 0 disables the check.
+	binaryWindow int
+
+	// maxScanBytes is the number of bytes read from the end of the file to skip lines backwards, set by
+	// OptMaxScanBytes. 0 is no maximum.
+	maxScanBytes int
+
+	// transcode enables charset detection, charset is the detected charset of the file.
+	transcode bool
+	charset   Charset
+
+	// stableCursors enables rotation stable SSE ids. generation is the rotation generation of the file and
+	// head is the beginning of the file used to compute the fingerprint.
+	stableCursors bool
+	generation    int
+	head          string
+
+	// filter skips the lines which do not match, set by OptFilter.
+	filter func(map[string]string) bool
+
+	// rotations enables reading the rotated files, set by OptRotations. missing is the number of lines
+	// requested from the end of the file which are before the beginning of the file.
+	rotations bool
+	missing   int
+
+	// delimiter separates the lines instead of a new line, set by OptDelimiter.
+	delimiter string
+
+	// multiline merges the lines of a record, set by OptMultiline. record is the record held back until its end is
+	// read, recordLines is its number of lines and recordIdle is set if the file did not grow since it was held.
+	multiline   *Multiline
+	record      *Line
+	recordLines int
+	recordIdle  bool
+
+	// times extracts the time of the lines, set by OptTimestamps. lastTime is the time of the last line with a
+	// time, since and until are the time range set by OptTimeRange and rangeEnd is set once a line after until
+	// was read.
+	times        *timeParser
+	lastTime     time.Time
+	since, until time.Time
+	rangeEnd     bool
+
+	// raw disables the line splitting and formatting, set by OptRaw.
+	raw bool
+
+	// dryRun disables the reads in the constructor, the reader is only used to explain the request.
+	dryRun bool
+
+	// ctx cancels the requests to the agent, set by OptContext. callCtx is the context of the current ReadContext
+	// or NextLine call.
+	ctx     context.Context
+	callCtx context.Context
+
+	// follow is the interval the end of the file is polled for new lines, set by OptFollow. followMax is the longest
+	// interval of an idle file, set by OptFollowBackoff, and idlePolls is the number of polls without new lines.
+	follow    time.Duration
+	followMax time.Duration
+	idlePolls int
+
+	// retries is the number of times a failed request is sent again and retryDelay is the delay before the first
+	// retry, set by OptRetry.
+	retries    int
+	retryDelay time.Duration
+
+	// chunkCache caches the chunks of the file, set by OptChunkCache. cacheFileSize is the size of the file when the
+	// first chunk was read, 0 if unknown yet and -1 if it could not be read.
+	chunkCache    *ChunkCache
+	cacheFileSize int
+
+	// breakerFailures is the number of consecutive failed requests which open the circuit breaker of the agent for
+	// breakerCooldown, set by OptCircuitBreaker.
+	breakerFailures int
+	breakerCooldown time.Duration
+
+	// operatorAPI reads the files with the mesos v1 operator API, set by OptOperatorAPI.
+	operatorAPI bool
+
 	formatFn Formatter
 
+	// workDir is mesos agent --work_dir, set by OptWorkDir.
+	workDir string
+
 	agentID     string
 	frameworkID string
 	executorID  string
@@ -208,20 +420,85 @@ type ReadManager struct {
 	taskPath    string
 }
 
+// doRequest sends a request to the files API with a given client and observes the latency by endpoint and
+// status code. The request is traced with a client span, the trace context is sent in traceparent header.
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	endpoint := path.Base(req.URL.Path)
+	req, span := tracing.StartRequest(req, "files "+endpoint)
+	defer span.End()
+
+	start := time.Now()
+	resp, err := client.Do(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	filesAPIDuration.WithLabelValues(endpoint, code).Observe(time.Since(start).Seconds())
+
+	span.SetAttribute("http.status_code", code)
+	span.SetError(err)
+	return resp, err
+}
+
+// do sends a files API read request, retrying it as configured by OptRetry. ErrCircuitOpen is returned without a
+// request if the circuit breaker of the agent is open.
 func (rm *ReadManager) do(req *http.Request) (*response, error) {
-	resp, err := rm.client.Do(req)
+	for attempt := 0; ; attempt++ {
+		// the body of an operator API call is read by the previous attempt.
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		if err := circuits.allow(req.URL.Host, rm.breakerFailures); err != nil {
+			return nil, err
+		}
+
+		data, err := rm.doOnce(req)
+		rm.report(req, err)
+		if err == nil {
+			rm.authorize()
+		}
+
+		if err == nil || attempt >= rm.retries || !retryable(req, err) {
+			return data, err
+		}
+
+		delay := backoff(rm.retryDelay, attempt)
+		logrus.Debugf("retrying %s in %s: %s", req.URL, delay, err)
+		filesAPIRetries.WithLabelValues(path.Base(req.URL.Path)).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (rm *ReadManager) doOnce(req *http.Request) (*response, error) {
+	resp, err := doRequest(rm.client, req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		break
-	case http.StatusNotFound:
-		return nil, ErrFileNotFound
-	default:
-		return nil, fmt.Errorf("bad status %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromStatus(resp.StatusCode)
+	}
+
+	if rm.operatorAPI {
+		data := &operatorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+			return nil, err
+		}
+		return decodeOperator(data), nil
 	}
 
 	data := &response{}
@@ -233,8 +510,20 @@ func (rm *ReadManager) do(req *http.Request) (*response, error) {
 }
 
 func (rm *ReadManager) fileLen(ctx context.Context) (int, error) {
+	return rm.fileSize(ctx, rm.file)
+}
+
+func (rm *ReadManager) fileSize(ctx context.Context, file string) (int, error) {
+	if rm.operatorAPI {
+		resp, err := rm.readOperator(ctx, filepath.Join(rm.sandboxPath, file), 0, 0)
+		if err != nil {
+			return 0, err
+		}
+		return resp.Offset, nil
+	}
+
 	v := url.Values{}
-	v.Add(pathParam, filepath.Join(rm.sandboxPath, rm.file))
+	v.Add(pathParam, filepath.Join(rm.sandboxPath, file))
 	v.Add(offsetParam, "-1")
 	newURL := rm.readEndpoint
 	newURL.RawQuery = v.Encode()
@@ -244,7 +533,10 @@ func (rm *ReadManager) fileLen(ctx context.Context) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	req.Header = rm.header
+
+	if req.Header, err = rm.requestHeader(); err != nil {
+		return 0, err
+	}
 
 	resp, err := rm.do(req.WithContext(ctx))
 	if err != nil {
@@ -254,16 +546,35 @@ func (rm *ReadManager) fileLen(ctx context.Context) (int, error) {
 	return resp.Offset, nil
 }
 
-func (rm *ReadManager) read(ctx context.Context, offset, length int, modifier modifier) ([]Line, int, error) {
+func (rm *ReadManager) readData(ctx context.Context, offset, length int) (string, error) {
+	data, err := rm.readFile(ctx, rm.file, offset, length)
+	if err != nil {
+		return "", err
+	}
+
+	// without transcoding the bytes which are not valid UTF-8 are replaced with utf8.RuneError.
+	if !rm.transcode {
+		return validUTF8(data), nil
+	}
+	return data, nil
+}
+
+// readFile returns the raw content of a sandbox file.
+func (rm *ReadManager) readFile(ctx context.Context, file string, offset, length int) (string, error) {
+	if rm.operatorAPI {
+		resp, err := rm.readOperator(ctx, filepath.Join(rm.sandboxPath, file), offset, length)
+		if err != nil {
+			return "", err
+		}
+		filesAPIReadBytes.WithLabelValues().Add(float64(len(resp.Data)))
+		return string(resp.Data), nil
+	}
+
 	v := url.Values{}
-	v.Add(pathParam, filepath.Join(rm.sandboxPath, rm.file))
+	v.Add(pathParam, filepath.Join(rm.sandboxPath, file))
 	v.Add(offsetParam, strconv.Itoa(offset))
 	v.Add(lengthParam, strconv.Itoa(length))
 
-	if modifier == nil {
-		modifier = func(s string) string { return s }
-	}
-
 	newURL := rm.readEndpoint
 	newURL.RawQuery = v.Encode()
 
@@ -271,42 +582,146 @@ func (rm *ReadManager) read(ctx context.Context, offset, length int, modifier mo
 
 	req, err := http.NewRequest("GET", newURL.String(), nil)
 	if err != nil {
-		return nil, 0, err
+		return "", err
 	}
 
-	req.Header = rm.header
+	if req.Header, err = rm.requestHeader(); err != nil {
+		return "", err
+	}
 	resp, err := rm.do(req.WithContext(ctx))
 	if err != nil {
-		return nil, 0, err
+		return "", err
 	}
+	filesAPIReadBytes.WithLabelValues().Add(float64(len(resp.Data)))
+	return string(resp.Data), nil
+}
+
+// parentContext returns the context of the requests to the agent.
+func (rm *ReadManager) parentContext() context.Context {
+	if rm.callCtx != nil {
+		return rm.callCtx
+	}
+
+	if rm.ctx == nil {
+		return context.Background()
+	}
+	return rm.ctx
+}
 
-	if resp.Data == "" || resp.Data == "\n" {
-		return nil, 0, io.EOF
+// detectCharset reads the byte order mark at the beginning of the file.
+func (rm *ReadManager) detectCharset() error {
+	ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+	defer cancel()
+
+	data, err := rm.readData(ctx, 0, 2)
+	if err != nil {
+		return err
 	}
 
-	lines := strings.Split(modifier(resp.Data), "\n")
+	rm.charset = detectBOM(data)
+	return nil
+}
 
-	delta := 0
-	// calculate delta only for chunks with offset > 0
-	// this is required to distinguish the chunk that start from the beginning, because it's does not have delta.
-	if offset > 0 && len(lines) > 1 {
-		delta = len(lines[len(lines)-1])
-		lines = lines[:len(lines)-1]
+// scanLines reads the file chunk by chunk until the scanner returns lines which are not empty. io.EOF is
+// returned at the end of the file. Streams wait for the writer to finish the last line of the file, so a line
+// is never split between the entries read and the entries followed. A non streaming read returns the last
+// line without new line at the end of the file.
+func (rm *ReadManager) scanLines() ([]Line, error) {
+	if rm.scanner == nil {
+		rm.scanner = newLineScanner(rm.charset, rm.delim(), rm.offset, rm.maxLineSize)
+		rm.scanner.truncate = rm.truncateLines
 	}
 
-	linesWithOffset := make([]Line, len(lines))
-	// accumulates the position of the line + \readLimit
-	accumulator := 0
-	for i := 0; i < len(lines); i++ {
-		linesWithOffset[i] = Line{
-			Message: lines[i],
-			Offset:  offset + accumulator,
-			Size:    len(lines[i]),
+	for {
+		data, err := rm.readChunk()
+		if err != nil {
+			return nil, err
+		}
+
+		if rm.binaryWindow > 0 && len(data) >= rm.binaryWindow && !strings.Contains(data[:rm.binaryWindow], rm.delim()) {
+			return nil, ErrBinaryFile
+		}
+
+		lines := rm.scanner.scan(data)
+		full := len(data) >= rm.chunkSize
+		if !full && !rm.stream {
+			if line, ok := rm.scanner.flush(); ok {
+				lines = append(lines, line)
+			}
+		}
+		rm.offset = rm.scanner.end()
+
+		lines = rm.decode(lines)
+		if rm.times != nil {
+			rm.stampLines(lines)
+		}
+
+		// a full chunk is likely followed by more data.
+		if full && rm.readAhead && (rm.stream || rm.readLimit == 0 || rm.readLines+len(lines) < rm.readLimit) {
+			rm.prefetch()
+		}
+
+		if len(lines) > 0 {
+			return lines, nil
+		}
+
+		if !full {
+			return nil, io.EOF
+		}
+	}
+}
+
+// decode converts the messages of the scanned lines to UTF-8 and drops the empty lines. Without transcoding the
+// bytes which are not valid UTF-8 are replaced with utf8.RuneError.
+func (rm *ReadManager) decode(lines []Line) []Line {
+	decoded := lines[:0]
+	for _, line := range lines {
+		if rm.transcode {
+			message, charset := rm.charset.transcode(line.Message)
+			if charset != CharsetUTF8 {
+				line.Message = message
+				line.Charset = charset
+			}
+		} else {
+			line.Message = validUTF8(line.Message)
+		}
+
+		if line.Truncated > 0 {
+			line.Message += fmt.Sprintf("...[truncated %d bytes]", line.Truncated)
+		}
+
+		if line.Message != "" {
+			decoded = append(decoded, line)
 		}
-		accumulator += len(lines[i]) + 1
 	}
+	return decoded
+}
 
-	return linesWithOffset, delta, nil
+// followDelay returns the follow interval doubled for every poll without new lines, up to followMax.
+func (rm *ReadManager) followDelay() time.Duration {
+	delay := rm.follow
+	for i := 0; i < rm.idlePolls && delay < rm.followMax; i++ {
+		delay *= 2
+	}
+
+	if delay > rm.followMax && rm.followMax > rm.follow {
+		delay = rm.followMax
+	}
+	return delay
+}
+
+// wait waits for the follow interval, the error of the context is returned if it is done first.
+func (rm *ReadManager) wait() error {
+	timer := time.NewTimer(rm.followDelay())
+	defer timer.Stop()
+	rm.idlePolls++
+
+	select {
+	case <-rm.parentContext().Done():
+		return rm.parentContext().Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 // Prepend the lines to a buffer.
@@ -333,38 +748,139 @@ func (rm *ReadManager) Pop() *Line {
 
 // Read implements io.Reader interface.
 func (rm *ReadManager) Read(b []byte) (int, error) {
+	// a formatted line is returned in parts if it does not fit into the buffer.
+	if rm.pending == "" {
+		entry, err := rm.nextEntry()
+		if err != nil {
+			return 0, err
+		}
+		rm.pending = entry
+	}
+
+	n := copy(b, rm.pending)
+	rm.pending = rm.pending[n:]
+	return n, nil
+}
+
+// EntryWriter is called by WriteEntries with every formatted line, or a chunk of the file read with OptRaw.
+type EntryWriter func(entry string) error
+
+// WriteEntries calls fn with the entries of the file until the end of the file or the limit, whole entries are
+// passed regardless of their size. The errors of the reader other than io.EOF and of fn are returned.
+func (rm *ReadManager) WriteEntries(fn EntryWriter) error {
+	if rm.pending != "" {
+		entry := rm.pending
+		rm.pending = ""
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	for {
+		entry, err := rm.nextEntry()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteTo implements io.WriterTo interface, so io.Copy writes the entries without an intermediate buffer. Every
+// entry is written by a single Write, a writer which flushes every write sends the lines as they are read.
+func (rm *ReadManager) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	err := rm.WriteEntries(func(entry string) error {
+		n, err := io.WriteString(w, entry)
+		written += int64(n)
+		return err
+	})
+	return written, err
+}
+
+// nextEntry returns the next formatted line, or the next chunk of the file read with OptRaw.
+func (rm *ReadManager) nextEntry() (string, error) {
+	if rm.raw {
+		return rm.readRaw()
+	}
+
 start:
-	if !rm.stream && rm.readLimit > 0 && rm.readLines == rm.readLimit {
-		return 0, io.EOF
+	if (!rm.stream && rm.readLimit > 0 && rm.readLines == rm.readLimit) || rm.rangeEnd {
+		return "", io.EOF
 	}
 
 	if len(rm.lines) == 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
+		if err := rm.parentContext().Err(); err != nil {
+			return "", err
+		}
 
-		lines, delta, err := rm.read(ctx, rm.offset, chunkSize, nil)
-		if err != nil {
-			return 0, err
+		if rm.rotations && rm.missing > 0 {
+			n := rm.missing
+			rm.missing = 0
+
+			lines, err := rm.rotatedLines(n)
+			if err != nil {
+				logrus.Warnf("unable to read the rotated files of %s: %s", rm.file, err)
+			}
+
+			if len(lines) > 0 {
+				for _, line := range lines {
+					rm.Prepend(line)
+				}
+				goto start
+			}
 		}
 
-		if len(lines) > 0 {
-			linesLen := 0
-			for _, line := range lines {
-				rm.Prepend(line)
-				linesLen += len(line.Message) + 1
+		lines, err := rm.scanLines()
+		if rm.multiline != nil {
+			// the lines of a record which is held back are not returned yet.
+			if lines, err = rm.mergeLines(lines, err); err == nil && len(lines) == 0 {
+				rm.idlePolls = 0
+				goto start
 			}
+		}
 
-			if linesLen < chunkSize {
-				rm.offset = rm.offset + linesLen - 1
-			} else {
-				rm.offset = (rm.offset + chunkSize) - delta - 1
+		if err == io.EOF && rm.follow > 0 {
+			if err := rm.wait(); err != nil {
+				return "", err
 			}
+			goto start
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		rm.idlePolls = 0
+		for _, line := range lines {
+			rm.Prepend(line)
 		}
 	}
 
 	line := rm.Pop()
 	if line == nil {
-		return 0, ErrNoData
+		return "", ErrNoData
+	}
+
+	if rm.times != nil {
+		ok, err := rm.inRange(line)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			goto start
+		}
+	}
+
+	if rm.filter != nil && !rm.filter(rm.lineFields(*line)) {
+		goto start
 	}
 
 	if rm.skip > 0 && rm.skipped < rm.skip {
@@ -373,7 +889,14 @@ start:
 	}
 
 	rm.readLines++
-	return strings.NewReader(rm.formatFn(*line, rm)).Read(b)
+	rm.position = line.Offset + line.Size
+	formatted := rm.formatFn(*line, rm)
+	if formatted == "" {
+		// the line was dropped by the formatter, it still counts as read.
+		goto start
+	}
+
+	return formatted, nil
 }
 
 // SandboxFile represents a file object located in mesos sandbox.
@@ -385,6 +908,9 @@ type SandboxFile struct {
 	Path  string `json:"path"`
 	Size  uint64 `json:"size"`
 	UID   string `json:"uid"`
+
+	// Name is the base name of the path, the name to use in the task log endpoints.
+	Name string `json:"name"`
 }
 
 type mTime uint64
@@ -403,10 +929,64 @@ func (mt *mTime) UnmarshalJSON(data []byte) error {
 
 // BrowseSandbox returns a url to browse files in the sandbox.
 func (rm ReadManager) BrowseSandbox() ([]SandboxFile, error) {
+	return rm.browse(rm.sandboxPath)
+}
+
+// Stat returns the sandbox entry of the file, the entry is found by browsing the directory of the file. The reader
+// must be created with /files/browse URL.
+func (rm ReadManager) Stat() (SandboxFile, error) {
+	filePath := path.Join(rm.sandboxPath, rm.file)
+	files, err := rm.browse(path.Dir(filePath))
+	if err != nil {
+		return SandboxFile{}, err
+	}
+
+	for _, f := range files {
+		if path.Clean(f.Path) == filePath {
+			return f, nil
+		}
+	}
+	return SandboxFile{}, ErrFileNotFound
+}
+
+// PodTasks returns the names of the tasks of a pod, the directories in the tasks directory of the executor
+// sandbox. The reader must be created with /files/browse URL.
+func (rm ReadManager) PodTasks() ([]string, error) {
+	header, err := rm.requestHeader()
+	if err != nil {
+		return nil, err
+	}
+	return browseSubdirs(rm.client, rm.browseEndpoint(), header, path.Join(rm.executorSandboxPath(), "tasks"))
+}
+
+// browse lists the files of a sandbox directory.
+func (rm ReadManager) browse(dir string) ([]SandboxFile, error) {
+	header, err := rm.requestHeader()
+	if err != nil {
+		return nil, err
+	}
+	return browseDir(rm.client, rm.browseEndpoint(), header, dir)
+}
+
+// browseEndpoint returns the URL the directories are listed with, the operator API URL with OptOperatorAPI.
+func (rm ReadManager) browseEndpoint() url.URL {
+	if rm.operatorAPI {
+		return OperatorURL(rm.readEndpoint)
+	}
+	return rm.readEndpoint
+}
+
+// browseDir lists the files of an agent directory with the files API /files/browse endpoint, or with the operator
+// API LIST_FILES call if browseURL is the operator API URL.
+func browseDir(client *http.Client, browseURL url.URL, header http.Header, dir string) ([]SandboxFile, error) {
+	if browseURL.Path == operatorPath {
+		return listFiles(client, browseURL, header, dir)
+	}
+
 	v := url.Values{}
-	v.Add(pathParam, rm.sandboxPath)
+	v.Add(pathParam, dir)
 
-	newURL := rm.readEndpoint
+	newURL := browseURL
 	newURL.RawQuery = v.Encode()
 
 	req, err := http.NewRequest("GET", newURL.String(), nil)
@@ -414,9 +994,9 @@ func (rm ReadManager) BrowseSandbox() ([]SandboxFile, error) {
 		return nil, err
 	}
 
-	req.Header = rm.header
+	req.Header = header
 
-	resp, err := rm.client.Do(req)
+	resp, err := doRequest(client, req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to make a GET request: %s. URL %s", err, newURL.String())
 	}
@@ -425,16 +1005,25 @@ func (rm ReadManager) BrowseSandbox() ([]SandboxFile, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromStatus(resp.StatusCode)
+	}
+
 	var files []SandboxFile
 
 	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
 		return nil, fmt.Errorf("unable to decode files API response: %s. URL %s", err, newURL.String())
 	}
 
+	for i := range files {
+		files[i].Name = path.Base(files[i].Path)
+	}
+
 	return files, nil
 }
 
 // Download makes a request to download endpoint and returns a raw http.Response for client to read and close.
+// The content is not split into lines or formatted.
 func (rm ReadManager) Download() (*http.Response, error) {
 	v := url.Values{}
 	v.Add(pathParam, filepath.Join(rm.sandboxPath, rm.file))
@@ -449,15 +1038,86 @@ func (rm ReadManager) Download() (*http.Response, error) {
 
 	logrus.Debugf("download %s", newURL.String())
 
-	req.Header = rm.header
+	if req.Header, err = rm.requestHeader(); err != nil {
+		return nil, err
+	}
+
+	// a large file may take longer than the timeout of the client, the download is canceled with the context.
+	client := *rm.client
+	client.Timeout = 0
+	return doRequest(&client, req.WithContext(rm.parentContext()))
+}
+
+// Size returns the size of the file in bytes.
+func (rm *ReadManager) Size() (int, error) {
+	ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+	defer cancel()
+	return rm.fileLen(ctx)
+}
+
+// ReadBytes returns at most length bytes of the file starting at offset, read with a single files API request, so
+// the reader must be created with /files/read URL. Fewer bytes are returned at the end of the file, none beyond it.
+// The content is not split into lines or formatted.
+func (rm *ReadManager) ReadBytes(offset, length int) (string, error) {
+	ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+	defer cancel()
+
+	data, err := rm.readFile(ctx, rm.file, offset, length)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > length {
+		data = data[:length]
+	}
+	return data, nil
+}
+
+// ReadRange returns a reader of length bytes of the file starting at offset. The content is read in chunks from
+// the files API read endpoint, so the reader must be created with /files/read URL. It is not split into lines
+// or formatted. io.ErrUnexpectedEOF is returned if the file ends before the range.
+func (rm *ReadManager) ReadRange(offset, length int) io.Reader {
+	return &rangeReader{rm: rm, offset: offset, remaining: length}
+}
 
-	return rm.client.Do(req)
+type rangeReader struct {
+	rm        *ReadManager
+	offset    int
+	remaining int
+	buf       string
 }
 
-func reverse(s string) string {
-	runes := []rune(s)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
+func (r *rangeReader) Read(b []byte) (int, error) {
+	if r.buf == "" {
+		if r.remaining <= 0 {
+			return 0, io.EOF
+		}
+
+		length := r.rm.chunkSize
+		if length > r.remaining {
+			length = r.remaining
+		}
+
+		ctx, cancel := context.WithTimeout(r.rm.parentContext(), time.Second*3)
+		data, err := r.rm.readFile(ctx, r.rm.file, r.offset, length)
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+
+		if data == "" {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		if len(data) > r.remaining {
+			data = data[:r.remaining]
+		}
+		r.offset += len(data)
+		r.remaining -= len(data)
+		r.buf = data
 	}
-	return string(runes)
+
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
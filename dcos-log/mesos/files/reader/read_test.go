@@ -2,14 +2,23 @@ package reader
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
+	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -48,7 +57,7 @@ func createHandler(data []byte, forceSendResponse bool, t *testing.T) http.Handl
 		}
 
 		resp := &response{
-			Data:   string(d),
+			Data:   rawString(d),
 			Offset: offset,
 		}
 
@@ -94,6 +103,40 @@ func TestRangeRead(t *testing.T) {
 	}
 }
 
+func TestFilesAPIDuration(t *testing.T) {
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := filesAPIDuration.WithLabelValues("read", "200").Count()
+	beforeBytes := filesAPIReadBytes.WithLabelValues().Value()
+	beforeChunks := chunkReadDuration.WithLabelValues().Count()
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if filesAPIDuration.WithLabelValues("read", "200").Count() <= before {
+		t.Fatal("expect the files API requests to be observed")
+	}
+
+	if n := filesAPIReadBytes.WithLabelValues().Value() - beforeBytes; n < float64(len(data)) {
+		t.Fatalf("expect at least %d bytes read. Got %v", len(data), n)
+	}
+
+	if chunkReadDuration.WithLabelValues().Count() <= beforeChunks {
+		t.Fatal("expect the chunk reads to be observed")
+	}
+}
+
 func TestSkip(t *testing.T) {
 	expectedResponse := []byte(`two
 three
@@ -117,6 +160,204 @@ five
 	}
 }
 
+func TestLastLinesMultiByte(t *testing.T) {
+	multiByte := []byte("één\r\ntwo\r\n\nlong line spanning chunks\r\nünï\r\n")
+
+	for _, chunkSize := range []int{3, 4, 7, 64} {
+		buf := doRead(t, multiByte, OptChunkSize(chunkSize), OptReadDirection(BottomToTop), OptReadFromEnd(),
+			OptSkip(-2))
+		if expect := "long line spanning chunks\r\nünï\r\n"; string(buf) != expect {
+			t.Fatalf("chunk size %d: expect %q. Got %q", chunkSize, expect, buf)
+		}
+
+		buf = doRead(t, multiByte, OptChunkSize(chunkSize), OptReadDirection(BottomToTop), OptReadFromEnd(),
+			OptSkip(-4))
+		if expect := "één\r\ntwo\r\nlong line spanning chunks\r\nünï\r\n"; string(buf) != expect {
+			t.Fatalf("chunk size %d: expect %q. Got %q", chunkSize, expect, buf)
+		}
+	}
+}
+
+func TestDelimiter(t *testing.T) {
+	nul := []byte("one\x00two\nlines\x00three\x00")
+	for _, chunkSize := range []int{2, 64} {
+		buf := doRead(t, nul, OptChunkSize(chunkSize), OptDelimiter("\x00"))
+		if expect := "one\ntwo\nlines\nthree\n"; string(buf) != expect {
+			t.Fatalf("chunk size %d: expect %q. Got %q", chunkSize, expect, buf)
+		}
+
+		buf = doRead(t, nul, OptChunkSize(chunkSize), OptDelimiter("\x00"), OptReadDirection(BottomToTop),
+			OptReadFromEnd(), OptSkip(-2))
+		if expect := "two\nlines\nthree\n"; string(buf) != expect {
+			t.Fatalf("chunk size %d: expect %q. Got %q", chunkSize, expect, buf)
+		}
+	}
+
+	crlf := []byte("one\r\ntwo\rthree\r\n")
+	for _, chunkSize := range []int{1, 3, 64} {
+		buf := doRead(t, crlf, OptChunkSize(chunkSize), OptDelimiter("\r\n"))
+		if expect := "one\ntwo\rthree\n"; string(buf) != expect {
+			t.Fatalf("chunk size %d: expect %q. Got %q", chunkSize, expect, buf)
+		}
+	}
+
+	if delim := CharsetUTF16LE.encode("\r\n"); delim != "\r\x00\n\x00" {
+		t.Fatalf("expect UTF-16LE delimiter. Got %q", delim)
+	}
+
+	if err := OptDelimiter("")(&ReadManager{}); err == nil {
+		t.Fatal("expect an empty delimiter error")
+	}
+}
+
+func TestReverseScanner(t *testing.T) {
+	type span struct{ offset, size int }
+
+	var lines []span
+	collect := func(offset, size int) bool {
+		lines = append(lines, span{offset, size})
+		return true
+	}
+
+	data := "one\nlöng\n\nthree"
+	s := newReverseScanner(CharsetUTF8, "\n", len(data))
+	for end := len(data); end > 0; end -= 4 {
+		offset := end - 4
+		if offset < 0 {
+			offset = 0
+		}
+		s.scan(data[offset:end], offset, collect)
+	}
+
+	if size, ok := s.flush(); ok {
+		collect(0, size)
+	}
+
+	expect := []span{{11, 5}, {10, 0}, {4, 5}, {0, 3}}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %+v. Got %+v", expect, lines)
+	}
+
+	// the delimiter is split at the chunk edge.
+	lines = nil
+	utf16 := "\x00o\x00\n\x00\n\x00t\x00w"
+	s = newReverseScanner(CharsetUTF16BE, CharsetUTF16BE.newline(), len(utf16))
+	s.scan(utf16[5:], 5, collect)
+	s.scan(utf16[:5], 0, collect)
+	if size, ok := s.flush(); ok {
+		collect(0, size)
+	}
+
+	expect = []span{{6, 4}, {4, 0}, {0, 2}}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %+v. Got %+v", expect, lines)
+	}
+
+	// the scan stops once fn returns false.
+	lines = nil
+	s = newReverseScanner(CharsetUTF8, "\n", len(data))
+	if s.scan(data, 0, func(offset, size int) bool { return !collect(offset, size) }) {
+		t.Fatal("expect the scan to stop")
+	}
+
+	if expect := []span{{11, 5}}; !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %+v. Got %+v", expect, lines)
+	}
+}
+
+func TestMaxScanBytes(t *testing.T) {
+	long := []byte("first\n" + strings.Repeat("x", 100) + "\nlast\n")
+
+	buf := doRead(t, long, OptChunkSize(8), OptMaxScanBytes(10), OptReadDirection(BottomToTop), OptReadFromEnd(),
+		OptSkip(-1))
+	if expect := "last\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	ts := httptest.NewServer(createHandler(long, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptChunkSize(8), OptMaxScanBytes(64), OptReadDirection(BottomToTop), OptReadFromEnd(), OptSkip(-2))
+	if err != ErrScanLimit {
+		t.Fatalf("expect %v. Got %v", ErrScanLimit, err)
+	}
+
+	if err := OptMaxScanBytes(-1)(&ReadManager{}); err == nil {
+		t.Fatal("expect a negative max scan bytes error")
+	}
+}
+
+// entryRecorder records every write.
+type entryRecorder struct {
+	writes []string
+}
+
+func (e *entryRecorder) Write(p []byte) (int, error) {
+	e.writes = append(e.writes, string(p))
+	return len(p), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	long := strings.Repeat("x", 40000)
+	ts := httptest.NewServer(createHandler([]byte("one\n"+long+"\nthree\n"), true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newReader := func() *ReadManager {
+		r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// io.Copy uses WriteTo, the long line is not split by the copy buffer.
+	rec := &entryRecorder{}
+	n, err := io.Copy(rec, newReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"one\n", long + "\n", "three\n"}
+	if !reflect.DeepEqual(rec.writes, expect) || n != int64(len(long)+11) {
+		t.Fatalf("expect %d writes of %d bytes. Got %d writes of %d bytes", len(expect), len(long)+11,
+			len(rec.writes), n)
+	}
+
+	// the rest of a line partially returned by Read is the first entry.
+	r := newReader()
+	if _, err := r.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	errStop := errors.New("stop")
+	var entries []string
+	err = r.WriteEntries(func(entry string) error {
+		entries = append(entries, entry)
+		if len(entries) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("expect %v. Got %v", errStop, err)
+	}
+
+	if expect := []string{"e\n", long + "\n"}; !reflect.DeepEqual(entries, expect) {
+		t.Fatalf("expect %d entries. Got %d", len(expect), len(entries))
+	}
+}
+
 func TestLimit(t *testing.T) {
 	expectedResponse := []byte(`one
 two
@@ -173,6 +414,107 @@ func TestEmptyData(t *testing.T) {
 	}
 }
 
+func TestMultiline(t *testing.T) {
+	trace := []byte("2018-01-01 starting\n2018-01-01 failed\njava.lang.Exception: boom\n\tat Main.run\n2018-01-01 done\n")
+
+	buf := doRead(t, trace, OptMultiline(Multiline{Start: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)}), OptSkip(1),
+		OptLines(1))
+	expected := "2018-01-01 failed\njava.lang.Exception: boom\n\tat Main.run\n"
+	if string(buf) != expected {
+		t.Fatalf("expect %q. Got %q", expected, buf)
+	}
+
+	buf = doRead(t, trace, OptMultiline(Multiline{Continuation: regexp.MustCompile(`^\s`)}))
+	expected = "2018-01-01 starting\n2018-01-01 failed\njava.lang.Exception: boom\n\tat Main.run\n2018-01-01 done\n"
+	if string(buf) != expected {
+		t.Fatalf("expect %q. Got %q", expected, buf)
+	}
+
+	if _, err := NewLineReader(&http.Client{}, url.URL{}, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptMultiline(Multiline{})); err == nil {
+		t.Fatal("expect an error without a pattern")
+	}
+
+	// a stream holds the last record back until the file did not grow for a read.
+	ts := httptest.NewServer(createHandler(trace, true, t))
+	defer ts.Close()
+
+	agentURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *agentURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptStream(true),
+		OptMultiline(Multiline{Continuation: regexp.MustCompile(`^(\s|java\.)`)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first) != "2018-01-01 starting\n2018-01-01 failed\njava.lang.Exception: boom\n\tat Main.run\n" {
+		t.Fatalf("expect the records before the last one. Got %q", first)
+	}
+
+	last, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the position is the end of the last line, before its new line.
+	if string(last) != "2018-01-01 done\n" || r.position != len(trace)-1 {
+		t.Fatalf("expect the last record ending at %d. Got %q at %d", len(trace)-1, last, r.position)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	p := &timeParser{layouts: DefaultTimeLayouts, now: func() time.Time {
+		return time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	}}
+
+	for message, expected := range map[string]string{
+		"2018-01-02T03:04:05.123Z starting":   "2018-01-02T03:04:05.123Z",
+		"2018-01-02 03:04:05,250 INFO main":   "2018-01-02T03:04:05.25Z",
+		"[2018/01/02 03:04:05] ready":         "2018-01-02T03:04:05Z",
+		"2018-01-02 03:04:05+01:00 ready":     "2018-01-02T03:04:05+01:00",
+		"Dec 31 23:59:59 host app[1]: stop":   "2017-12-31T23:59:59Z",
+		"Feb  3 10:00:00 host app[1]: start":  "2018-02-03T10:00:00Z",
+		"\tat com.example.Main(Main.java:10)": "",
+		"12:00 no date":                       "",
+	} {
+		got := ""
+		if parsed := p.parse(message); !parsed.IsZero() {
+			got = parsed.Format(time.RFC3339Nano)
+		}
+
+		if got != expected {
+			t.Fatalf("expect %q of %q. Got %q", expected, message, got)
+		}
+	}
+
+	if custom, ok := parseLeadingTime("02/01/2006 15:04", "03/02/2018 10:30 custom"); !ok || custom.Month() != time.February {
+		t.Fatalf("expect a custom layout to be parsed. Got %s, %t", custom, ok)
+	}
+
+	lines := []byte("2018-01-01T00:00:00Z one\n2018-01-01T00:01:00Z two\n\tat trace\n2018-01-01T00:02:00Z three\n" +
+		"2018-01-01T00:03:00Z four\n")
+	since := time.Date(2018, 1, 1, 0, 1, 0, 0, time.UTC)
+	until := time.Date(2018, 1, 1, 0, 2, 30, 0, time.UTC)
+	buf := doRead(t, lines, OptTimeRange(since, until))
+	expected := "2018-01-01T00:01:00Z two\n\tat trace\n2018-01-01T00:02:00Z three\n"
+	if string(buf) != expected {
+		t.Fatalf("expect %q. Got %q", expected, buf)
+	}
+
+	format := NDJSONFormat(Line{Message: "two", Time: since}, &ReadManager{file: "stdout"})
+	if !strings.Contains(format, `"TIMESTAMP":"2018-01-01T00:01:00Z"`) {
+		t.Fatalf("expect a TIMESTAMP field. Got %s", format)
+	}
+}
+
 func TestBrowseSandbox(t *testing.T) {
 	sandboxResponse := []byte(`[{
 "gid":"root",
@@ -219,6 +561,10 @@ func TestBrowseSandbox(t *testing.T) {
 		t.Fatalf("expect path %s. Got %s", expectedPath, item.Path)
 	}
 
+	if item.Name != "one" {
+		t.Fatalf("expect name one. Got %s", item.Name)
+	}
+
 	if item.GID != "root" {
 		t.Fatalf("expect gid root. Got %s", item.GID)
 	}
@@ -232,60 +578,1305 @@ func TestBrowseSandbox(t *testing.T) {
 	}
 }
 
-func TestDownload(t *testing.T) {
-	body := []byte("one two three")
-	ts := httptest.NewServer(createHandler(body, false, t))
-	defer ts.Close()
+func TestPodTasks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4/tasks"
+		if p := r.URL.Query().Get("path"); p != expect {
+			t.Fatalf("expect path %s. Got %s", expect, p)
+		}
 
-	client := &http.Client{}
+		w.Write([]byte(`[{"mode":"drwxr-xr-x","path":"/tasks/one"},{"mode":"-rw-r--r--","path":"/tasks/file"},` +
+			`{"mode":"drwxr-xr-x","path":"/tasks/two"}]`))
+	}))
+	defer ts.Close()
 
 	masterURL, err := url.Parse(ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	r, err := NewLineReader(client, *masterURL, "1", "2", "3", "4", "",
-		"stdout", LineFormat)
+	r, err := NewLineReader(http.DefaultClient, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptDryRun())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	dl, err := r.Download()
+	tasks, err := r.PodTasks()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer dl.Body.Close()
 
-	buf, err := ioutil.ReadAll(dl.Body)
+	if strings.Join(tasks, ",") != "one,two" {
+		t.Fatalf("expect tasks one,two. Got %s", tasks)
+	}
+
+	if err := OptTaskPath("one")(r); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4/tasks/one"
+	if r.sandboxPath != expect {
+		t.Fatalf("expect sandbox %s. Got %s", expect, r.sandboxPath)
+	}
+
+	if err := OptTaskPath("../one")(r); err == nil {
+		t.Fatal("expect an invalid task path error")
+	}
+}
+
+func TestNestedContainer(t *testing.T) {
+	r, err := NewLineReader(http.DefaultClient, url.URL{}, "1", "2", "3", "4", "", "stdout", LineFormat, OptDryRun(),
+		OptNestedContainer("5"))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if bytes.Compare(body, buf) != 0 {
-		t.Fatalf("expect %s. Got %s", body, buf)
+	expect := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4/containers/5"
+	if r.sandboxPath != expect {
+		t.Fatalf("expect sandbox %s. Got %s", expect, r.sandboxPath)
+	}
+
+	if err := OptNestedContainer("../5")(r); err == nil {
+		t.Fatal("expect an invalid nested container ID error")
 	}
 }
 
-func TestHeaderSet(t *testing.T) {
-	h := http.Header{}
-	h.Add("foo", "bar")
+func TestWorkDir(t *testing.T) {
+	r, err := NewLineReader(http.DefaultClient, url.URL{}, "1", "2", "3", "4", "web", "stdout", LineFormat, OptDryRun(),
+		OptWorkDir("/mnt/mesos/"))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	opts := []Option{OptHeaders(h)}
+	expect := "/mnt/mesos/slaves/1/frameworks/2/executors/3/runs/4/tasks/web"
+	if r.sandboxPath != expect {
+		t.Fatalf("expect sandbox %s. Got %s", expect, r.sandboxPath)
+	}
 
-	r, err := NewLineReader(http.DefaultClient, url.URL{}, "1", "2", "3", "4",
-		"", "stdout", LineFormat, opts...)
+	if err := OptWorkDir("mesos")(r); err == nil {
+		t.Fatal("expect a relative work directory error")
+	}
+}
+
+func TestFollowDelay(t *testing.T) {
+	r, err := NewLineReader(http.DefaultClient, url.URL{}, "1", "2", "3", "4", "", "stdout", LineFormat, OptDryRun(),
+		OptFollow(time.Second), OptFollowBackoff(5*time.Second))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if r.header.Get("foo") != "bar" {
-		t.Fatalf("expected header foo with value bar. Got %+v", r.header)
+	for idle, expect := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+		5 * time.Second} {
+		r.idlePolls = idle
+		if d := r.followDelay(); d != expect {
+			t.Fatalf("expect delay %s after %d idle polls. Got %s", expect, idle, d)
+		}
+	}
+
+	if err := OptFollowBackoff(0)(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := r.followDelay(); d != time.Second {
+		t.Fatalf("expect the follow interval without backoff. Got %s", d)
 	}
 }
 
-func TestSkipBoundary(t *testing.T) {
-	// Test the values from -100 to 100 are acceptable and not causing panic
-	for i := -100; i < 100; i++ {
-		doRead(t, data, OptReadDirection(BottomToTop), OptSkip(i))
+func TestStat(t *testing.T) {
+	sandbox := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := r.URL.Query().Get("path"); p != sandbox && p != sandbox+"/logs" {
+			t.Fatalf("expect the directory of the file. Got %s", p)
+		}
+
+		w.Write([]byte(`[{"mode":"-rw-r--r--","path":"` + sandbox + `/stdout","size":10,"mtime":1513020278.0},` +
+			`{"mode":"-rw-r--r--","path":"` + sandbox + `/logs/app.log","size":42,"mtime":1513020279.0}]`))
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, size := range map[string]uint64{"stdout": 10, "logs/app.log": 42} {
+		r, err := NewLineReader(http.DefaultClient, *masterURL, "1", "2", "3", "4", "", file, LineFormat, OptDryRun())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := r.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.Size != size || f.Name != path.Base(file) {
+			t.Fatalf("expect %s of %d bytes. Got %s of %d bytes", file, size, f.Name, f.Size)
+		}
+	}
+
+	r, err := NewLineReader(http.DefaultClient, *masterURL, "1", "2", "3", "4", "", "stderr", LineFormat, OptDryRun())
+	if err != nil {
+		t.Fatal(err)
 	}
-}
\ No newline at end of file
+
+	if _, err := r.Stat(); err != ErrFileNotFound {
+		t.Fatalf("expect ErrFileNotFound. Got %v", err)
+	}
+}
+
+func TestAgentSandboxes(t *testing.T) {
+	dirs := map[string]string{
+		"/var/lib/mesos/slave/slaves/1/frameworks": `[{"mode":"drwxr-xr-x","path":"/frameworks/f1"},` +
+			`{"mode":"drwxr-xr-x","path":"/frameworks/f2"}]`,
+		"/var/lib/mesos/slave/slaves/1/frameworks/f1/executors": `[{"mode":"drwxr-xr-x","path":"/executors/e1"}]`,
+		"/var/lib/mesos/slave/slaves/1/frameworks/f1/executors/e1/runs": `[{"mode":"drwxr-xr-x","path":"/runs/c1"},` +
+			`{"mode":"drwxr-xr-x","path":"/runs/c2"},{"mode":"drwxr-xr-x","path":"/runs/latest"},` +
+			`{"mode":"-rw-r--r--","path":"/runs/file"}]`,
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := dirs[r.URL.Query().Get("path")]
+		if !ok {
+			// f2 was garbage collected after the frameworks directory was listed.
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	browseURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sandboxes, err := AgentSandboxes(http.DefaultClient, *browseURL, nil, DefaultWorkDir, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Sandbox{{"f1", "e1", "c1"}, {"f1", "e1", "c2"}}
+	if !reflect.DeepEqual(sandboxes, expect) {
+		t.Fatalf("expect sandboxes %v. Got %v", expect, sandboxes)
+	}
+}
+
+func TestOperatorAPI(t *testing.T) {
+	sandbox := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4"
+	content := []byte("one\ntwo\n")
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1" {
+			t.Fatalf("expect POST /api/v1. Got %s %s", r.Method, r.URL.Path)
+		}
+
+		call := operatorCall{}
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first call fails, it is retried with the same body.
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		switch call.Type {
+		case "READ_FILE":
+			if call.ReadFile.Path != sandbox+"/stdout" {
+				t.Fatalf("expect stdout path. Got %s", call.ReadFile.Path)
+			}
+
+			end := call.ReadFile.Offset + call.ReadFile.Length
+			if end > len(content) {
+				end = len(content)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"type": "READ_FILE", "read_file": map[string]interface{}{
+				"size": len(content), "data": content[call.ReadFile.Offset:end]}})
+		case "LIST_FILES":
+			w.Write([]byte(`{"type":"LIST_FILES","list_files":{"file_infos":[` +
+				`{"path":"` + sandbox + `/stdout","nlink":1,"size":8,"mtime":{"nanoseconds":1513020278000000000},` +
+				`"mode":33188,"uid":"root","gid":"root"},{"path":"` + sandbox + `/tasks","mode":16877}]}}`))
+		default:
+			t.Fatalf("unexpected call %s", call.Type)
+		}
+	}))
+	defer ts.Close()
+
+	readURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(http.DefaultClient, *readURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptDryRun(), OptOperatorAPI(true), OptRetry(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err := r.Size(); err != nil || size != len(content) {
+		t.Fatalf("expect size %d. Got %d, %v", len(content), size, err)
+	}
+
+	data, err := ioutil.ReadAll(r.ReadRange(4, 4))
+	if err != nil || string(data) != "two\n" {
+		t.Fatalf("expect two. Got %q, %v", data, err)
+	}
+
+	f, err := r.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Name != "stdout" || f.Mode != "-rw-r--r--" || f.MTime != 1513020278 || f.Size != 8 {
+		t.Fatalf("expect the stdout entry. Got %+v", f)
+	}
+
+	if modeString(16877) != "drwxr-xr-x" {
+		t.Fatalf("expect drwxr-xr-x. Got %s", modeString(16877))
+	}
+}
+
+func TestDownload(t *testing.T) {
+	body := []byte("one two three")
+	ts := httptest.NewServer(createHandler(body, false, t))
+	defer ts.Close()
+
+	client := &http.Client{}
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(client, *masterURL, "1", "2", "3", "4", "",
+		"stdout", LineFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl, err := r.Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dl.Body.Close()
+
+	buf, err := ioutil.ReadAll(dl.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Compare(body, buf) != 0 {
+		t.Fatalf("expect %s. Got %s", body, buf)
+	}
+}
+
+func TestHeaderSet(t *testing.T) {
+	h := http.Header{}
+	h.Add("foo", "bar")
+
+	opts := []Option{OptHeaders(h)}
+
+	r, err := NewLineReader(http.DefaultClient, url.URL{}, "1", "2", "3", "4",
+		"", "stdout", LineFormat, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.header.Get("foo") != "bar" {
+		t.Fatalf("expected header foo with value bar. Got %+v", r.header)
+	}
+}
+
+func TestSkipBoundary(t *testing.T) {
+	// Test the values from -100 to 100 are acceptable and not causing panic
+	for i := -100; i < 100; i++ {
+		doRead(t, data, OptReadDirection(BottomToTop), OptSkip(i))
+	}
+}
+func TestSeekLine(t *testing.T) {
+	file := []byte("one\r\n\r\ntwo\r\nthree\r\nfour")
+
+	for _, chunkSize := range []int{1, 2, 3, 5, 64} {
+		for skip, expect := range map[int]string{
+			1: "two\nthree\nfour\n",
+			2: "three\nfour\n",
+			3: "four\n",
+			4: "",
+			9: "",
+		} {
+			buf := doRead(t, file, OptChunkSize(chunkSize), OptDelimiter("\r\n"), OptSkip(skip))
+			if string(buf) != expect {
+				t.Fatalf("chunk size %d, skip %d: expect %q. Got %q", chunkSize, skip, expect, buf)
+			}
+		}
+	}
+
+	// the skipped lines are not returned, the cursor points after them.
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptSkip(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.offset != 14 || r.skipped != 3 {
+		t.Fatalf("expect offset 14 after 3 lines. Got %d after %d lines", r.offset, r.skipped)
+	}
+}
+
+func TestBinaryWindow(t *testing.T) {
+	ts := httptest.NewServer(createHandler(bytes.Repeat([]byte{0xff, 0x00}, 64), true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptBinaryWindow(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ioutil.ReadAll(r); err != ErrBinaryFile {
+		t.Fatalf("expect ErrBinaryFile. Got %v", err)
+	}
+
+	if buf := doRead(t, data, OptBinaryWindow(4)); bytes.Compare(buf, data) != 0 {
+		t.Fatalf("expect %s. Got %s", data, buf)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptContext(ctx),
+		OptStream(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 100)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := ioutil.ReadAll(r); err != context.Canceled {
+		t.Fatalf("expect context.Canceled. Got %v", err)
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// the end of the file is polled rarely, the calls are canceled while they wait.
+	r, err := NewLineReaderContext(ctx, &http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptFollow(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for len(lines) < 5 {
+		line, err := r.NextLine(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+
+	if buf := strings.Join(lines, ""); buf != string(data) {
+		t.Fatalf("expect %s. Got %s", data, buf)
+	}
+
+	// the call gives up waiting for new lines, the reader is still usable.
+	callCtx, callCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer callCancel()
+	if _, err := r.ReadContext(callCtx, make([]byte, 100)); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded. Got %v", err)
+	}
+
+	// the context of the reader cancels the call too.
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := r.NextLine(context.Background()); err != context.Canceled {
+		t.Fatalf("expect context.Canceled. Got %v", err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		file = []byte("one\ntwo\n")
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		createHandler(file, true, t)(w, r)
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptContext(ctx),
+		OptFollow(10*time.Millisecond), OptLines(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 100)
+	var lines []string
+	for len(lines) < 2 {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(buf[:n]))
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		file = append(file, "three\n"...)
+		mu.Unlock()
+	}()
+
+	// Read blocks until the new line is written.
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line := string(buf[:n]); line != "three\n" {
+		t.Fatalf("expect three. Got %q", line)
+	}
+
+	cancel()
+	if _, err := r.Read(buf); err != context.Canceled {
+		t.Fatalf("expect context.Canceled. Got %v", err)
+	}
+
+	if _, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptFollow(0)); err == nil {
+		t.Fatal("expect an error on zero interval")
+	}
+}
+
+func TestSSEFormat(t *testing.T) {
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", SSEFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := string(output)
+	var ids []string
+	for _, line := range strings.Split(buf, "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		}
+	}
+
+	// every line has an id, including the first one.
+	if expect := "3 7 13 18 23"; strings.Join(ids, " ") != expect {
+		t.Fatalf("expect ids %s. Got %v", expect, ids)
+	}
+
+	if !strings.Contains(buf, `data: {"fields":{"AGENT_ID":"1",`) {
+		t.Fatalf("expect JSON data. Got %s", buf)
+	}
+}
+
+func TestFieldsFormat(t *testing.T) {
+	format := FieldsFormat(SSEFormat, func(fields map[string]string) bool {
+		fields["DATACENTER"] = "east"
+		fields["MESSAGE"] = strings.ToUpper(fields["MESSAGE"])
+		return fields["MESSAGE"] != "DROP"
+	})
+
+	rm := &ReadManager{agentID: "1", frameworkID: "2", executorID: "3", containerID: "4", file: "stdout"}
+	output := format(Line{Message: "one"}, rm)
+	expected := `data: {"fields":{"AGENT_ID":"1","CONTAINER_ID":"4","DATACENTER":"east","EXECUTOR_ID":"3","FILE":"stdout","FRAMEWORK_ID":"2","MESSAGE":"ONE"}}`
+	if !strings.Contains(output, expected) {
+		t.Fatalf("expect %s. Got %s", expected, output)
+	}
+
+	if output := format(Line{Message: "drop"}, rm); output != "" {
+		t.Fatalf("expect the line to be dropped. Got %s", output)
+	}
+
+	if output := FieldsFormat(LineFormat, nil)(Line{Message: "one"}, rm); output != "one\n" {
+		t.Fatalf("expect one. Got %s", output)
+	}
+}
+
+func TestJSONFieldsFormat(t *testing.T) {
+	format := JSONFieldsFormat(NDJSONFormat)
+	rm := &ReadManager{agentID: "1", frameworkID: "2", executorID: "3", containerID: "4", file: "stdout"}
+
+	message := `{"level":"warn","msg":"disk full","request.id":7,"ctx":{"user":"a"},"AGENT_ID":"spoofed","_x":null}`
+	output := format(Line{Message: message}, rm)
+	expected := `{"fields":{"AGENT_ID":"1","CONTAINER_ID":"4","CTX":"{\"user\":\"a\"}","EXECUTOR_ID":"3","FILE":"stdout",` +
+		`"FRAMEWORK_ID":"2","JSON_AGENT_ID":"spoofed","LEVEL":"warn","MESSAGE":` + strconv.Quote(message) +
+		`,"MSG":"disk full","REQUEST_ID":"7","X":""}}` + "\n"
+	if output != expected {
+		t.Fatalf("expect %s. Got %s", expected, output)
+	}
+
+	for _, message := range []string{"plain text", "{not json}", `["an", "array"]`} {
+		if output := format(Line{Message: message}, rm); output != NDJSONFormat(Line{Message: message}, rm) {
+			t.Fatalf("expect %q to be formatted as is. Got %s", message, output)
+		}
+	}
+}
+
+func TestCoalesceFormat(t *testing.T) {
+	format := CoalesceFormat(SSEFormat)
+	rm := &ReadManager{file: "stdout"}
+
+	var output string
+	for i, message := range []string{"one", "spam", "spam", "spam", "two", "two", "three"} {
+		output += format(Line{Message: message, Offset: i * 10, Size: 10}, rm)
+	}
+
+	for _, expected := range []string{
+		`id: 20` + "\n" + `data: {"fields":{"AGENT_ID":"","CONTAINER_ID":"","EXECUTOR_ID":"","FILE":"stdout","FRAMEWORK_ID":"","MESSAGE":"spam"}}`,
+		`id: 40` + "\n" + `data: {"fields":{"AGENT_ID":"","CONTAINER_ID":"","EXECUTOR_ID":"","FILE":"stdout","FRAMEWORK_ID":"","MESSAGE":"message repeated 2 times: [spam]","REPEAT_COUNT":"2"}}`,
+		`id: 50` + "\n" + `data: {"fields":{"AGENT_ID":"","CONTAINER_ID":"","EXECUTOR_ID":"","FILE":"stdout","FRAMEWORK_ID":"","MESSAGE":"two"}}`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("expect %s. Got %s", expected, output)
+		}
+	}
+
+	if n := strings.Count(output, "data: "); n != 6 {
+		t.Fatalf("expect 6 events, a single repeat is sent as is. Got %d: %s", n, output)
+	}
+}
+
+func TestGELFFormat(t *testing.T) {
+	format := FieldsFormat(GELFFormat("agent1"), func(fields map[string]string) bool {
+		fields["_ID"] = "reserved"
+		return true
+	})
+
+	rm := &ReadManager{agentID: "1", frameworkID: "2", executorID: "3", containerID: "4", file: "stderr"}
+	output := format(Line{Message: "one", Offset: 10}, rm)
+	if !strings.HasSuffix(output, "\n") {
+		t.Fatalf("expect a new line at the end. Got %s", output)
+	}
+
+	msg := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(output), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]interface{}{"version": "1.1", "host": "agent1", "short_message": "one", "level": 3.0,
+		"_offset": 10.0, "_agent_id": "1", "_framework_id": "2", "_executor_id": "3", "_container_id": "4", "_file": "stderr"} {
+		if msg[k] != v {
+			t.Fatalf("expect %s=%v. Got %v", k, v, msg[k])
+		}
+	}
+
+	if _, ok := msg["_id"]; ok {
+		t.Fatalf("expect reserved _id to be skipped. Got %s", output)
+	}
+
+	if ts, ok := msg["timestamp"].(float64); !ok || time.Since(time.Unix(int64(ts), 0)) > time.Minute {
+		t.Fatalf("expect the current time. Got %v", msg["timestamp"])
+	}
+}
+
+func TestNDJSONFormat(t *testing.T) {
+	rm := &ReadManager{agentID: "1", frameworkID: "2", executorID: "3", containerID: "4", file: "stdout"}
+	output := NDJSONFormat(Line{Message: "one", Offset: 10, Size: 4}, rm)
+	if strings.Count(output, "\n") != 1 || !strings.HasSuffix(output, "\n") {
+		t.Fatalf("expect a single line. Got %q", output)
+	}
+
+	var line struct {
+		Fields map[string]string `json:"fields"`
+		Cursor string            `json:"cursor"`
+	}
+	if err := json.Unmarshal([]byte(output), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	if line.Fields["MESSAGE"] != "one" || line.Fields["AGENT_ID"] != "1" || line.Cursor != rm.cursorID(14) {
+		t.Fatalf("unexpected line %s", output)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ts := httptest.NewServer(createHandler(data, true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptDryRun(),
+		OptOffset(4), OptLines(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Plan{
+		Path:           "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4/stdout",
+		Offset:         4,
+		Direction:      "forward",
+		Limit:          2,
+		Size:           len(data),
+		EstimatedBytes: len(data) - 4,
+	}
+	if plan != expected {
+		t.Fatalf("expect %+v. Got %+v", expected, plan)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	buf := doRead(t, data, OptFilter(func(fields map[string]string) bool {
+		return strings.Contains(fields["MESSAGE"], "o") && fields["FILE"] == "stdout"
+	}), OptLines(2))
+
+	if string(buf) != "one\ntwo\n" {
+		t.Fatalf("expect one and two. Got %s", buf)
+	}
+
+	buf = doRead(t, data, OptFilter(func(fields map[string]string) bool {
+		return strings.HasPrefix(fields["MESSAGE"], "f")
+	}), OptSkip(1))
+
+	if string(buf) != "five\n" {
+		t.Fatalf("expect five. Got %s", buf)
+	}
+}
+
+// growingFile is a files API handler of a file which is written concurrently.
+type growingFile struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (f *growingFile) write(b []byte) {
+	f.mu.Lock()
+	f.data = append(f.data, b...)
+	f.mu.Unlock()
+}
+
+func (f *growingFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	data := f.data
+	f.mu.Unlock()
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset == -1 {
+		json.NewEncoder(w).Encode(response{Offset: len(data)})
+		return
+	}
+
+	length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+	d := []byte{}
+	if offset < len(data) {
+		d = data[offset:]
+	}
+	if len(d) > length {
+		d = d[:length]
+	}
+	json.NewEncoder(w).Encode(response{Data: rawString(d), Offset: offset})
+}
+
+func TestStreamHandover(t *testing.T) {
+	const lines = 300
+	f := &growingFile{}
+	line := func(i int) string {
+		return fmt.Sprintf("%04d %s", i, strings.Repeat("x", 1000))
+	}
+
+	// half of the lines are read from the file, the rest is followed while they are written in two parts.
+	for i := 0; i < lines/2; i++ {
+		f.write([]byte(line(i) + "\n"))
+	}
+
+	go func() {
+		for i := lines / 2; i < lines; i++ {
+			l := line(i)
+			f.write([]byte(l[:500]))
+			time.Sleep(time.Millisecond)
+			f.write([]byte(l[500:] + "\n"))
+		}
+	}()
+
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptStream(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []string
+	buf := make([]byte, defaultChunkSize)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(received) < lines && time.Now().Before(deadline) {
+		n, err := r.Read(buf)
+		if err == ErrNoData || err == io.EOF {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, strings.TrimSuffix(string(buf[:n]), "\n"))
+	}
+
+	if len(received) != lines {
+		t.Fatalf("expect %d lines. Got %d", lines, len(received))
+	}
+
+	for i, l := range received {
+		if l != line(i) {
+			t.Fatalf("expect line %d to be sent once and complete. Got %.20s", i, l)
+		}
+	}
+}
+
+func TestErrorFromStatus(t *testing.T) {
+	for code, expect := range map[int]error{
+		http.StatusNotFound:           ErrFileNotFound,
+		http.StatusUnauthorized:       ErrUnauthorized,
+		http.StatusForbidden:          ErrUnauthorized,
+		http.StatusBadGateway:         ErrAgentUnavailable,
+		http.StatusServiceUnavailable: ErrAgentUnavailable,
+		http.StatusGatewayTimeout:     ErrAgentUnavailable,
+		http.StatusBadRequest:         ErrOffsetOutOfRange,
+		http.StatusTeapot:             statusError(http.StatusTeapot),
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+
+		readURL, err := url.Parse(ts.URL + "/files/read")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewLineReader(&http.Client{}, *readURL, "1", "2", "3", "4", "", "stdout", LineFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.Size(); err != expect {
+			t.Fatalf("status %d: expect %v. Got %v", code, expect, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		failures int
+		status   = http.StatusServiceUnavailable
+	)
+
+	handler := createHandler(data, true, t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures > 0
+		if fail {
+			failures--
+		}
+		mu.Unlock()
+
+		if fail {
+			w.WriteHeader(status)
+			return
+		}
+		handler(w, r)
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(opts ...Option) ([]byte, error) {
+		r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	failures = 2
+	retries := filesAPIRetries.WithLabelValues("read").Value()
+	buf, err := read(OptRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := filesAPIRetries.WithLabelValues("read").Value() - retries; n != 2 {
+		t.Fatalf("expect 2 retries to be counted. Got %v", n)
+	}
+
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("expect %s. Got %s", data, buf)
+	}
+
+	failures = 3
+	if _, err := read(OptRetry(2, time.Millisecond)); err != ErrAgentUnavailable {
+		t.Fatalf("expect bad status 503 after 2 retries. Got %v", err)
+	}
+
+	failures, status = 1, http.StatusForbidden
+	if _, err := read(OptRetry(2, time.Millisecond)); err != ErrUnauthorized {
+		t.Fatalf("expect 403 not to be retried. Got %v", err)
+	}
+
+	if _, err := read(OptRetry(1, 0)); err == nil {
+		t.Fatal("expect error for zero retry delay")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		d := backoff(100*time.Millisecond, attempt)
+		if d < max/2 || d > max {
+			t.Fatalf("expect delay of attempt %d between %s and %s. Got %s", attempt, max/2, max, d)
+		}
+	}
+
+	if d := backoff(time.Second, 40); d > maxRetryDelay {
+		t.Fatalf("expect delay capped at %s. Got %s", maxRetryDelay, d)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	readURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() error {
+		r, err := NewLineReader(&http.Client{}, *readURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+			OptCircuitBreaker(2, time.Hour))
+		if err != nil {
+			return err
+		}
+		_, err = ioutil.ReadAll(r)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := read(); err != ErrAgentUnavailable {
+			t.Fatalf("expect bad status 503. Got %v", err)
+		}
+	}
+
+	mu.Lock()
+	sent := requests
+	mu.Unlock()
+
+	if err := read(); err != ErrCircuitOpen {
+		t.Fatalf("expect the circuit to be open after 2 failures. Got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != sent {
+		t.Fatalf("expect no request while the circuit is open. Got %d", requests-sent)
+	}
+
+	// the cooldown has passed, a single request probes the agent.
+	now := time.Now()
+	b := newBreaker()
+	b.now = func() time.Time { return now }
+	b.failure("agent", 1, time.Minute)
+	if b.allow("agent", 1) != ErrCircuitOpen {
+		t.Fatal("expect the circuit to be open")
+	}
+
+	now = now.Add(time.Minute)
+	if b.allow("agent", 1) != nil || b.allow("agent", 1) != ErrCircuitOpen {
+		t.Fatal("expect a single probe after the cooldown")
+	}
+
+	b.success("agent")
+	if b.allow("agent", 1) != nil {
+		t.Fatal("expect the circuit to be closed by a successful probe")
+	}
+
+	if _, err := NewLineReader(&http.Client{}, *readURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+		OptCircuitBreaker(1, 0)); err == nil {
+		t.Fatal("expect error for zero cooldown")
+	}
+}
+
+func TestChunkSizeReadAhead(t *testing.T) {
+	var long []byte
+	for i := 0; i < 100; i++ {
+		long = append(long, fmt.Sprintf("line %d\n", i)...)
+	}
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		if offset > len(long) {
+			offset = len(long)
+		}
+
+		end := offset + length
+		if end > len(long) {
+			end = len(long)
+		}
+
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		json.NewEncoder(w).Encode(response{Data: rawString(long[offset:end]), Offset: offset})
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		opts   []Option
+		expect []byte
+	}{
+		{[]Option{OptChunkSize(16)}, long},
+		{[]Option{OptChunkSize(16), OptReadAhead(true)}, long},
+		{[]Option{OptChunkSize(16), OptReadAhead(true), OptLines(5)}, long[:len("line 0\nline 1\nline 2\nline 3\nline 4\n")]},
+	} {
+		requests = 0
+		hits := chunkPrefetches.WithLabelValues("hit").Value()
+		r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, tc.expect) {
+			t.Fatalf("expect %d bytes. Got %d bytes", len(tc.expect), len(buf))
+		}
+
+		mu.Lock()
+		if requests < len(tc.expect)/16 {
+			t.Fatalf("expect the file to be read in 16 byte chunks. Got %d requests", requests)
+		}
+		mu.Unlock()
+
+		if readAhead := len(tc.opts) > 1; readAhead != (chunkPrefetches.WithLabelValues("hit").Value() > hits) {
+			t.Fatalf("expect the prefetched chunks to be used only with read ahead %v", tc.opts)
+		}
+	}
+
+	if _, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptChunkSize(0)); err == nil {
+		t.Fatal("expect error for zero chunk size")
+	}
+}
+
+func TestChunkCache(t *testing.T) {
+	var long []byte
+	for i := 0; i < 100; i++ {
+		long = append(long, fmt.Sprintf("line %d\n", i)...)
+	}
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset < 0 {
+			json.NewEncoder(w).Encode(response{Offset: len(long)})
+			return
+		}
+
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		end := offset + length
+		if end > len(long) {
+			end = len(long)
+		}
+		json.NewEncoder(w).Encode(response{Data: rawString(long[offset:end]), Offset: offset})
+	}))
+	defer ts.Close()
+
+	readURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewChunkCache(100)
+	read := func() int {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+
+		r, err := NewLineReader(&http.Client{}, *readURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+			OptChunkSize(16), OptChunkCache(cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, long) {
+			t.Fatalf("expect %d bytes. Got %d bytes", len(long), len(buf))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	// the size, the last partial chunk and the end of the file are requested again.
+	if first, second := read(), read(); first < len(long)/16 || second > 3 {
+		t.Fatalf("expect the full chunks to be read from the cache. Got %d and %d requests", first, second)
+	}
+
+	if NewChunkCache(0) != nil {
+		t.Fatal("expect no cache of size 0")
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	data := "short\n" + long + "\nü€ü€ü€ü€\nlast"
+
+	// the data is sent as is like Mesos does, encoding/json would replace the characters split by a chunk.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		if offset == -1 || offset > len(data) {
+			offset = len(data)
+		}
+
+		end := offset + length
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(w, `{"data":"%s","offset":%d}`, strings.Replace(data[offset:end], "\n", `\n`, -1), offset)
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		opts   []Option
+		expect string
+	}{
+		// lines longer than a chunk and characters at the chunk edges are not broken.
+		{[]Option{OptChunkSize(7)}, "short\n" + long + "\nü€ü€ü€ü€\nlast\n"},
+		{[]Option{OptChunkSize(7), OptReadAhead(true)}, "short\n" + long + "\nü€ü€ü€ü€\nlast\n"},
+		// lines longer than the max line size are returned in parts.
+		{[]Option{OptChunkSize(7), OptMaxLineSize(40)}, "short\n" + strings.Repeat(long[:40]+"\n", 2) + long[:20] +
+			"\nü€ü€ü€ü€\nlast\n"},
+		{[]Option{OptChunkSize(7), OptMaxLineSize(8)}, "short\n" + strings.Repeat(long[:8]+"\n", 12) + long[:4] +
+			"\nü€ü\n€ü€\nü€\nlast\n"},
+		// or truncated.
+		{[]Option{OptChunkSize(7), OptMaxLineSize(40), OptTruncateLines(true)}, "short\n" + long[:40] +
+			"...[truncated 60 bytes]\nü€ü€ü€ü€\nlast\n"},
+		{[]Option{OptChunkSize(7), OptMaxLineSize(8), OptTruncateLines(true)}, "short\n" + long[:8] +
+			"...[truncated 92 bytes]\nü€ü...[truncated 13 bytes]\nlast\n"},
+	} {
+		r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(buf) != tc.expect {
+			t.Fatalf("expect %q. Got %q", tc.expect, buf)
+		}
+	}
+
+	if _, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptMaxLineSize(1)); err == nil {
+		t.Fatal("expect error for max line size 1")
+	}
+	// the offsets of a truncated line include the dropped bytes.
+	scanner := newLineScanner(CharsetUTF8, "\n", 0, 4)
+	scanner.truncate = true
+	lines := append(scanner.scan("abcdefgh"), scanner.scan("ij\nk")...)
+	expect := []Line{{Message: "abcd", Offset: 0, Size: 10, Truncated: 6}}
+	if !reflect.DeepEqual(lines, expect) || scanner.end() != 12 {
+		t.Fatalf("expect %+v ending at 12. Got %+v ending at %d", expect, lines, scanner.end())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ts := httptest.NewServer(createHandler([]byte("a\nerror 1\nb\nc\nerror 2\nerror 3\nd\n"), true, t))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(n int) []Match {
+		r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat,
+			OptChunkSize(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var matches []Match
+		if err := r.Search(regexp.MustCompile(`^error`), n, func(m Match) error {
+			matches = append(matches, m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return matches
+	}
+
+	matches := search(0)
+	expect := []Match{
+		{SearchLine: SearchLine{Offset: 2, Message: "error 1"}},
+		{SearchLine: SearchLine{Offset: 14, Message: "error 2"}},
+		{SearchLine: SearchLine{Offset: 22, Message: "error 3"}},
+	}
+	if !reflect.DeepEqual(matches, expect) {
+		t.Fatalf("expect %+v. Got %+v", expect, matches)
+	}
+
+	matches = search(1)
+	expect = []Match{
+		{SearchLine: SearchLine{Offset: 2, Message: "error 1"}, Before: []SearchLine{{0, "a"}},
+			After: []SearchLine{{10, "b"}}},
+		{SearchLine: SearchLine{Offset: 14, Message: "error 2"}, Before: []SearchLine{{12, "c"}},
+			After: []SearchLine{{22, "error 3"}}},
+		{SearchLine: SearchLine{Offset: 22, Message: "error 3"}, Before: []SearchLine{{14, "error 2"}},
+			After: []SearchLine{{30, "d"}}},
+	}
+	if !reflect.DeepEqual(matches, expect) {
+		t.Fatalf("expect %+v. Got %+v", expect, matches)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	f := &growingFile{}
+	f.write(data)
+
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(&http.Client{}, *masterURL, "1", "2", "3", "4", "", "stdout", LineFormat, OptChunkSize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err := r.Size(); err != nil || size != len(data) {
+		t.Fatalf("expect size %d. Got %d, %v", len(data), size, err)
+	}
+
+	buf, err := ioutil.ReadAll(r.ReadRange(4, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := data[4:14]; !bytes.Equal(buf, expect) {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	if _, err := ioutil.ReadAll(r.ReadRange(20, 10)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF. Got %v", err)
+	}
+}
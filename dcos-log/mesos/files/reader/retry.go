@@ -0,0 +1,85 @@
+package reader
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRetryDelay caps the exponential backoff between two attempts.
+const maxRetryDelay = 10 * time.Second
+
+// statusError is an unexpected status code of the files API.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("bad status %d", int(e))
+}
+
+// errorFromStatus returns the error of a files API response with status code other than 200. The known codes are
+// mapped to ErrFileNotFound, ErrUnauthorized, ErrAgentUnavailable and ErrOffsetOutOfRange, the others to
+// statusError.
+func errorFromStatus(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return ErrFileNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrAgentUnavailable
+	case http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable:
+		return ErrOffsetOutOfRange
+	}
+	return statusError(code)
+}
+
+// retryable returns true if a request which failed with err may succeed if it's sent again: the connection
+// failed or the server responded with 5xx.
+func retryable(req *http.Request, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	if err == ErrAgentUnavailable {
+		return true
+	}
+
+	switch e := err.(type) {
+	case statusError:
+		return e >= http.StatusInternalServerError
+	case *url.Error:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before a retry, attempt is 0 for the first retry. The delay doubles with every
+// attempt and a random half of it is added as jitter, so readers of the same agent do not retry at once.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	if d > maxRetryDelay || d <= 0 {
+		d = maxRetryDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// OptRetry sends the requests of the files API reads up to max more times if the connection fails or the agent
+// responds with 5xx, waiting baseDelay before the first retry and twice as long before every next one, with
+// jitter. The wait is cut short if the request context is done. Zero max disables the retries.
+func OptRetry(max int, baseDelay time.Duration) Option {
+	return func(rm *ReadManager) error {
+		if max < 0 {
+			return fmt.Errorf("invalid number of retries %d. Must be zero or positive integer", max)
+		}
+
+		if max > 0 && baseDelay <= 0 {
+			return fmt.Errorf("invalid retry delay %s. Must be positive", baseDelay)
+		}
+
+		rm.retries = max
+		rm.retryDelay = baseDelay
+		return nil
+	}
+}
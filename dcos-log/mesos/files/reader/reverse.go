@@ -0,0 +1,92 @@
+package reader
+
+import (
+	"strings"
+)
+
+// reverseScanner finds the lines of a file read from the end chunk by chunk, the last line first. Only the offsets
+// and sizes of the lines are tracked, in bytes of the file, so they are exact for multi-byte characters, \r\n new
+// lines and lines spanning several chunks. The memory used does not depend on the size of the lines: besides the
+// chunk being scanned only the beginning of the previous chunk is kept, so a delimiter split at the chunk edge is
+// found.
+type reverseScanner struct {
+	charset Charset
+	delim   string
+
+	// tail is the beginning of the chunk scanned before, shorter than the delimiter. end is the offset of the byte
+	// following the line being scanned.
+	tail string
+	end  int
+}
+
+// newReverseScanner returns a scanner of the chunks of a file before the offset end.
+func newReverseScanner(charset Charset, delim string, end int) *reverseScanner {
+	return &reverseScanner{
+		charset: charset,
+		delim:   delim,
+		end:     end,
+	}
+}
+
+// scan scans a chunk starting at offset, the chunk must end where the previous chunk starts. fn is called with the
+// offset and size without the delimiter of every line starting in the chunk, the last line first, until it returns
+// false. scan returns false if fn stopped the scan.
+func (s *reverseScanner) scan(data string, offset int, fn func(offset, size int) bool) bool {
+	buf := data + s.tail
+	if n := s.end - offset; n < len(buf) {
+		buf = buf[:n]
+	}
+
+	if n := len(s.delim) - 1; n < len(buf) {
+		s.tail = buf[:n]
+	} else {
+		s.tail = buf
+	}
+
+	newline := len(s.delim)
+	for end := len(buf); ; {
+		i := s.lastIndex(buf[:end], offset)
+		if i < 0 {
+			return true
+		}
+
+		start := offset + i + newline
+		size := s.end - start
+		s.end, end = offset+i, i
+		if !fn(start, size) {
+			return false
+		}
+	}
+}
+
+// flush returns the size of the first line of the file, false is returned at the beginning of a line. It must be
+// called after the chunk at the beginning of the file is scanned.
+func (s *reverseScanner) flush() (int, bool) {
+	if s.end == 0 {
+		return 0, false
+	}
+
+	size := s.end
+	s.tail, s.end = "", 0
+	return size, true
+}
+
+// lastIndex returns the index of the last delimiter in data starting at offset of the file or -1. A UTF-16
+// delimiter is searched at code unit boundaries of the file only.
+func (s *reverseScanner) lastIndex(data string, offset int) int {
+	if !s.charset.isUTF16() {
+		return strings.LastIndex(data, s.delim)
+	}
+
+	i := len(data) - len(s.delim)
+	if (offset+i)%2 != 0 {
+		i--
+	}
+
+	for ; i >= 0; i -= 2 {
+		if data[i:i+len(s.delim)] == s.delim {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,153 @@
+package reader
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotation is a file rotated by the Mesos logrotate module, stdout.1 or stdout.2.gz for stdout.
+type rotation struct {
+	name       string
+	generation int
+	gzip       bool
+}
+
+// OptRotations reads the rotated files of the Mesos logrotate module when the lines requested from the end of
+// the file, OptReadFromEnd with a negative skip, are before the beginning of the file. The rotated files are
+// found with /files/browse and downloaded with /files/download, gzip compressed rotations are decompressed.
+// Their lines have FILE field of the rotated file and no offset.
+func OptRotations(enable bool) Option {
+	return func(rm *ReadManager) error {
+		rm.rotations = enable
+		return nil
+	}
+}
+
+// sibling returns a copy of the reader which uses another endpoint of the files API, such as browse or download.
+func (rm *ReadManager) sibling(endpoint string) ReadManager {
+	s := *rm
+	s.readEndpoint.Path = path.Join(path.Dir(rm.readEndpoint.Path), endpoint)
+	return s
+}
+
+// rotatedFiles returns the rotated files of the file, the latest first.
+func (rm *ReadManager) rotatedFiles() ([]rotation, error) {
+	files, err := rm.sibling("browse").browse(rm.sandboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var rotations []rotation
+	for _, f := range files {
+		if strings.HasPrefix(f.Mode, "d") || !strings.HasPrefix(f.Name, rm.file+".") {
+			continue
+		}
+
+		r := rotation{name: f.Name}
+		suffix := strings.TrimPrefix(f.Name, rm.file+".")
+		if strings.HasSuffix(suffix, ".gz") {
+			r.gzip = true
+			suffix = strings.TrimSuffix(suffix, ".gz")
+		}
+
+		r.generation, err = strconv.Atoi(suffix)
+		if err != nil || r.generation < 1 {
+			continue
+		}
+		rotations = append(rotations, r)
+	}
+
+	sort.Slice(rotations, func(i, j int) bool { return rotations[i].generation < rotations[j].generation })
+	return rotations, nil
+}
+
+// rotatedLines returns the last n lines of the rotated files in the order they were written.
+func (rm *ReadManager) rotatedLines(n int) ([]Line, error) {
+	rotations, err := rm.rotatedFiles()
+	if err == ErrFileNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	for _, r := range rotations {
+		fileLines, err := rm.lastLines(r, n-len(lines))
+		if err != nil {
+			return lines, err
+		}
+
+		lines = append(fileLines, lines...)
+		if len(lines) >= n {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// lastLines downloads a rotated file and returns at most its last n lines. Only n lines are kept in memory.
+func (rm *ReadManager) lastLines(r rotation, n int) ([]Line, error) {
+	download := rm.sibling("download")
+	download.file = r.name
+
+	resp, err := download.Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromStatus(resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	if r.gzip {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var lines []Line
+	keep := func(scanned []Line) {
+		for _, line := range rm.decode(scanned) {
+			line.Offset, line.Size = 0, 0
+			line.Fields = map[string]string{"FILE": r.name}
+			lines = append(lines, line)
+		}
+
+		if len(lines) > n {
+			lines = append(lines[:0], lines[len(lines)-n:]...)
+		}
+	}
+
+	scanner := newLineScanner(rm.charset, rm.delim(), 0, rm.maxLineSize)
+	scanner.truncate = rm.truncateLines
+	buf := make([]byte, rm.chunkSize)
+	for {
+		size, err := body.Read(buf)
+		keep(scanner.scan(string(buf[:size])))
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if line, ok := scanner.flush(); ok {
+		keep([]Line{line})
+	}
+	return lines, nil
+}
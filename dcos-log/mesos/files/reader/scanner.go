@@ -0,0 +1,206 @@
+package reader
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxLineSize is the longest line kept in memory by default, see OptMaxLineSize.
+const defaultMaxLineSize = 1 << 20
+
+// lineScanner splits the content of a file read chunk by chunk into lines at the encoded delimiter delim. The
+// unterminated end of a chunk is kept and completed by the next chunks, so a line is never broken at a chunk edge.
+// A line longer than maxSize is returned in parts of at most maxSize bytes or truncated, which bounds the memory
+// used by a single line.
+type lineScanner struct {
+	charset Charset
+	delim   string
+	maxSize int
+
+	// tail is the line read so far without a delimiter and offset is its position in the file. searched is
+	// the number of bytes of the tail known not to start a delimiter.
+	tail     string
+	offset   int
+	searched int
+
+	// truncate drops the end of the lines longer than maxSize instead of returning it in parts. long is the
+	// beginning of such a line until its end is found.
+	truncate bool
+	long     *Line
+}
+
+func newLineScanner(charset Charset, delim string, offset, maxSize int) *lineScanner {
+	return &lineScanner{
+		charset: charset,
+		delim:   delim,
+		maxSize: maxSize,
+		offset:  offset,
+	}
+}
+
+// end returns the offset of the byte following the data scanned so far.
+func (s *lineScanner) end() int {
+	return s.offset + len(s.tail)
+}
+
+// scan appends the data to the tail and returns the complete lines, the messages are not decoded.
+func (s *lineScanner) scan(data string) []Line {
+	s.tail += data
+
+	var lines []Line
+	for {
+		i := s.index()
+		switch {
+		case s.long != nil && i < 0:
+			s.drop()
+			return lines
+		case s.long != nil:
+			lines = append(lines, s.truncated(s.cut(i, len(s.delim))))
+		case s.maxSize > 0 && (i > s.maxSize || i < 0 && len(s.tail) > s.maxSize):
+			part := s.cut(s.partSize(), 0)
+			if s.truncate {
+				s.long = &part
+				continue
+			}
+			lines = append(lines, part)
+		case i >= 0:
+			lines = append(lines, s.cut(i, len(s.delim)))
+		default:
+			return lines
+		}
+	}
+}
+
+// flush returns the tail as the last line of the file, false is returned if the tail is empty.
+func (s *lineScanner) flush() (Line, bool) {
+	if s.long != nil {
+		return s.truncated(s.cut(len(s.tail), 0)), true
+	}
+
+	if s.tail == "" {
+		return Line{}, false
+	}
+	return s.cut(len(s.tail), 0), true
+}
+
+// drop removes the tail of a truncated line, except the bytes which may be the beginning of a delimiter.
+func (s *lineScanner) drop() {
+	n := len(s.tail) - len(s.delim) + 1
+	if s.charset.isUTF16() {
+		n &^= 1
+	}
+
+	if n > 0 {
+		s.long.Truncated += n
+		s.long.Size += n
+		s.tail = s.tail[n:]
+		s.offset += n
+		s.searched = 0
+	}
+}
+
+// truncated returns the truncated line ending with the rest of it.
+func (s *lineScanner) truncated(rest Line) Line {
+	line := *s.long
+	line.Truncated += rest.Size
+	line.Size += rest.Size
+	s.long = nil
+	return line
+}
+
+// index returns the index of the first delimiter in the tail or -1. A UTF-16 delimiter is searched at code unit
+// boundaries only.
+func (s *lineScanner) index() int {
+	if !s.charset.isUTF16() {
+		if i := strings.Index(s.tail[s.searched:], s.delim); i >= 0 {
+			return s.searched + i
+		}
+
+		// the end of the tail may be the beginning of a delimiter.
+		if s.searched = len(s.tail) - len(s.delim) + 1; s.searched < 0 {
+			s.searched = 0
+		}
+		return -1
+	}
+
+	i := s.searched
+	for ; i+len(s.delim) <= len(s.tail); i += 2 {
+		if s.tail[i:i+len(s.delim)] == s.delim {
+			return i
+		}
+	}
+	s.searched = i
+	return -1
+}
+
+// cut removes a line of size bytes followed by a delimiter of delim bytes from the tail.
+func (s *lineScanner) cut(size, delim int) Line {
+	line := Line{
+		Message: s.tail[:size],
+		Offset:  s.offset,
+		Size:    size,
+	}
+
+	s.tail = s.tail[size+delim:]
+	s.offset += size + delim
+	s.searched = 0
+	return line
+}
+
+// partSize returns the size of a part of an oversized line. The part does not end in the middle of a UTF-8
+// character or a UTF-16 code unit.
+func (s *lineScanner) partSize() int {
+	if s.charset.isUTF16() {
+		return s.maxSize &^ 1
+	}
+
+	for i := s.maxSize; i > 0 && i > s.maxSize-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s.tail[i]) {
+			return i
+		}
+	}
+	return s.maxSize
+}
+
+// OptMaxLineSize sets the longest line in bytes the reader keeps in memory, 1MiB by default. Longer lines are
+// returned in parts of at most n bytes.
+func OptMaxLineSize(n int) Option {
+	return func(rm *ReadManager) error {
+		if n < utf8.UTFMax {
+			return fmt.Errorf("invalid max line size %d. Must be at least %d", n, utf8.UTFMax)
+		}
+		rm.maxLineSize = n
+		return nil
+	}
+}
+
+// OptTruncateLines truncates the lines longer than the max line size instead of returning them in parts, the
+// message ends with "...[truncated N bytes]". The end of such lines is not kept in memory, the offsets of the
+// next lines are not changed.
+func OptTruncateLines(truncate bool) Option {
+	return func(rm *ReadManager) error {
+		rm.truncateLines = truncate
+		return nil
+	}
+}
+
+// OptDelimiter splits the file into lines at a delimiter instead of a new line, for instance "\r\n" or "\x00" for
+// NUL separated logs. The delimiter is encoded in the charset of the file.
+func OptDelimiter(delimiter string) Option {
+	return func(rm *ReadManager) error {
+		if delimiter == "" {
+			return fmt.Errorf("delimiter cannot be empty")
+		}
+		rm.delimiter = delimiter
+		return nil
+	}
+}
+
+// delim returns the encoded line delimiter of the file.
+func (rm *ReadManager) delim() string {
+	if rm.delimiter == "" {
+		return rm.charset.newline()
+	}
+	return rm.charset.encode(rm.delimiter)
+}
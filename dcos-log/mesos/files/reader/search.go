@@ -0,0 +1,81 @@
+package reader
+
+import (
+	"io"
+	"regexp"
+)
+
+// SearchLine is a line of a search result.
+type SearchLine struct {
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+}
+
+// Match is a line matching a search with the lines around it.
+type Match struct {
+	SearchLine
+	Before []SearchLine `json:"before,omitempty"`
+	After  []SearchLine `json:"after,omitempty"`
+}
+
+// Search scans the file from the current position chunk by chunk and calls fn with every line matching re and at
+// most n lines before and after it. The lines are split and decoded like by Read, the filter is not applied. The
+// file is never kept in memory, only the context of the matches. The error of fn stops the search and is returned.
+func (rm *ReadManager) Search(re *regexp.Regexp, n int, fn func(Match) error) error {
+	var (
+		before  []SearchLine
+		pending []*Match
+	)
+
+	for {
+		lines, err := rm.scanLines()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, line := range lines {
+			current := SearchLine{Offset: line.Offset, Message: line.Message}
+
+			// the line is the context after the previous matches, the earliest matches are complete first.
+			for _, m := range pending {
+				m.After = append(m.After, current)
+			}
+
+			for len(pending) > 0 && len(pending[0].After) == n {
+				if err := fn(*pending[0]); err != nil {
+					return err
+				}
+				pending = pending[1:]
+			}
+
+			if re.MatchString(line.Message) {
+				m := &Match{SearchLine: current, Before: append([]SearchLine(nil), before...)}
+				if n == 0 {
+					if err := fn(*m); err != nil {
+						return err
+					}
+				} else {
+					pending = append(pending, m)
+				}
+			}
+
+			if n > 0 {
+				if before = append(before, current); len(before) > n {
+					before = before[1:]
+				}
+			}
+		}
+	}
+
+	// the matches at the end of the file have less context after them.
+	for _, m := range pending {
+		if err := fn(*m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package reader
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// seekLine moves the reader forward over the lines to skip, starting at the offset. The chunks are only searched
+// for the delimiters, so the skipped lines are not split, formatted or kept in memory and skipping a million lines
+// costs a scan of the file, not a million lines decoded. Like the backward skip a line longer than the max line size
+// counts as one line and the empty lines are not counted. The lines left to skip at the end of the file, such as a
+// last line without delimiter, are skipped by Read.
+func (rm *ReadManager) seekLine() error {
+	delim := rm.delim()
+
+	// start is the offset of the line being searched for its end. carry is the end of the data scanned so far
+	// which may be the beginning of a delimiter split at the chunk edge.
+	start, offset := rm.offset, rm.offset
+	var carry string
+	for rm.skipped < rm.skip {
+		ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+		data, err := rm.readFile(ctx, rm.file, offset, rm.chunkSize)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if data == "" {
+			break
+		}
+
+		if rm.binaryWindow > 0 && len(data) >= rm.binaryWindow && !strings.Contains(data[:rm.binaryWindow], delim) {
+			return ErrBinaryFile
+		}
+
+		buf := carry + data
+		bufOffset := offset - len(carry)
+		pos := start - bufOffset
+		if pos < 0 {
+			pos = 0
+		}
+
+		for rm.skipped < rm.skip {
+			i := rm.indexFrom(buf, bufOffset, pos)
+			if i < 0 {
+				break
+			}
+
+			if bufOffset+i > start {
+				rm.skipped++
+			}
+			start = bufOffset + i + len(delim)
+			pos = i + len(delim)
+		}
+
+		offset += len(data)
+		if n := len(buf) - len(delim) + 1; n > pos {
+			pos = n
+		}
+		carry = buf[pos:]
+	}
+
+	rm.offset = start
+	return nil
+}
+
+// indexFrom returns the index of the first delimiter in data at index from or later, -1 if there is none. data
+// starts at offset of the file, a UTF-16 delimiter is searched at code unit boundaries only.
+func (rm *ReadManager) indexFrom(data string, offset, from int) int {
+	delim := rm.delim()
+	if !rm.charset.isUTF16() {
+		if i := strings.Index(data[from:], delim); i >= 0 {
+			return from + i
+		}
+		return -1
+	}
+
+	i := from
+	if (offset+i)%2 != 0 {
+		i++
+	}
+
+	for ; i+len(delim) <= len(data); i += 2 {
+		if data[i:i+len(delim)] == delim {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,206 @@
+package reader
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxTarballDepth is the number of nested directories of the sandbox walked by TarballFiles.
+	maxTarballDepth = 16
+
+	// maxTarballFiles is the number of files a tarball has at most, TarballFiles returns an error for more files.
+	maxTarballFiles = 10000
+)
+
+// TarballFile is a sandbox file of a tarball, Name is the path relative to the sandbox.
+type TarballFile struct {
+	SandboxFile
+	Name string
+}
+
+// ValidTarballPatterns returns an error if a pattern of TarballFiles is malformed.
+func ValidTarballPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// tarballMatch returns true if the file at the relative path name matches one of the patterns, or if there are
+// no patterns. A pattern without slash matches the base name of the file in any directory, such as *.log, a
+// pattern with slash matches the path relative to the sandbox, such as logs/*.log.
+func tarballMatch(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		target := name
+		if !strings.Contains(p, "/") {
+			target = path.Base(name)
+		}
+
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TarballFiles walks the sandbox directories with /files/browse and returns the files matching the glob patterns,
+// all the files if there are no patterns. The reader must be created with /files/read URL.
+func (rm *ReadManager) TarballFiles(patterns []string) ([]TarballFile, error) {
+	if err := ValidTarballPatterns(patterns); err != nil {
+		return nil, err
+	}
+
+	browser := rm.sibling("browse")
+	var files []TarballFile
+
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		entries, err := browser.browse(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			name := strings.TrimPrefix(path.Clean(e.Path), rm.sandboxPath+"/")
+			if strings.HasPrefix(e.Mode, "d") {
+				if depth < maxTarballDepth {
+					if err := walk(path.Clean(e.Path), depth+1); err != nil && err != ErrFileNotFound {
+						return err
+					}
+				}
+				continue
+			}
+
+			if !strings.HasPrefix(e.Mode, "-") || !tarballMatch(patterns, name) {
+				continue
+			}
+
+			if len(files) == maxTarballFiles {
+				return fmt.Errorf("sandbox has more than %d files, select the files with a glob", maxTarballFiles)
+			}
+			files = append(files, TarballFile{SandboxFile: e, Name: name})
+		}
+		return nil
+	}
+
+	if err := walk(rm.sandboxPath, 0); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// WriteTarball writes a gzip compressed tar archive of the sandbox files to w, the content of each file is read in
+// chunks with /files/read. A file that shrank while it was read is padded with zeros to the size in its header,
+// the growth of a file after it was listed is not included.
+func (rm *ReadManager) WriteTarball(w io.Writer, files []TarballFile) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range files {
+		if err := rm.parentContext().Err(); err != nil {
+			return err
+		}
+
+		if err := rm.writeTarballFile(tw, f); err != nil {
+			return fmt.Errorf("unable to archive %s: %s", f.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (rm *ReadManager) writeTarballFile(tw *tar.Writer, f TarballFile) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     f.Name,
+		Size:     int64(f.Size),
+		Mode:     int64(parseFileMode(f.Mode)),
+		ModTime:  time.Unix(int64(f.MTime), 0),
+		Uname:    f.UID,
+		Gname:    f.GID,
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	var written int64
+	for written < hdr.Size {
+		length := rm.chunkSize
+		if remaining := hdr.Size - written; remaining < int64(length) {
+			length = int(remaining)
+		}
+
+		ctx, cancel := context.WithTimeout(rm.parentContext(), time.Second*3)
+		data, err := rm.readFile(ctx, f.Name, int(written), length)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if data == "" {
+			break
+		}
+
+		if len(data) > length {
+			data = data[:length]
+		}
+
+		n, err := io.WriteString(tw, data)
+		written += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if written < hdr.Size {
+		logrus.Warnf("%s shrank to %d bytes while it was archived, padded to %d bytes", f.Name, written, hdr.Size)
+		if _, err := io.CopyN(tw, zeroReader{}, hdr.Size-written); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFileMode returns the permission bits of a mode listed by /files/browse, such as -rw-r--r--.
+func parseFileMode(mode string) os.FileMode {
+	if len(mode) < 9 {
+		return 0644
+	}
+
+	var m os.FileMode
+	for i, c := range mode[len(mode)-9:] {
+		if c != '-' {
+			m |= 1 << uint(8-i)
+		}
+	}
+	return m
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package reader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTarball(t *testing.T) {
+	sandbox := "/var/lib/mesos/slave/slaves/1/frameworks/2/executors/3/runs/4"
+	contents := map[string]string{
+		sandbox + "/stdout":         "one\ntwo\n",
+		sandbox + "/stderr":         "error\n",
+		sandbox + "/logs/app.log":   "app\n",
+		sandbox + "/logs/short.log": "ab",
+	}
+
+	// short.log shrank after it was listed with 4 bytes.
+	listings := map[string]string{
+		sandbox: `[{"mode":"-rw-r--r--","path":"` + sandbox + `/stdout","size":8,"mtime":1513020278.0,"uid":"root","gid":"root"},` +
+			`{"mode":"-rw-------","path":"` + sandbox + `/stderr","size":6},` +
+			`{"mode":"drwxr-xr-x","path":"` + sandbox + `/logs"}]`,
+		sandbox + "/logs": `[{"mode":"-rw-r--r--","path":"` + sandbox + `/logs/app.log","size":4},` +
+			`{"mode":"-rw-r--r--","path":"` + sandbox + `/logs/short.log","size":4}]`,
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Query().Get("path")
+		if r.URL.Path == "/files/browse" {
+			listing, ok := listings[p]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(listing))
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		data := contents[p]
+		if offset > len(data) {
+			offset = len(data)
+		}
+		if offset+length < len(data) {
+			data = data[:offset+length]
+		}
+		json.NewEncoder(w).Encode(&response{Data: rawString(data[offset:]), Offset: offset})
+	}))
+	defer ts.Close()
+
+	readURL, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewLineReader(http.DefaultClient, *readURL, "1", "2", "3", "4", "", "", LineFormat, OptChunkSize(3),
+		OptDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.TarballFiles([]string{"["}); err == nil {
+		t.Fatal("expect an error for a malformed glob")
+	}
+
+	files, err := r.TarballFiles([]string{"std*", "logs/*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if expect := []string{"stdout", "stderr", "logs/app.log", "logs/short.log"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect files %v. Got %v", expect, names)
+	}
+
+	files, err = r.TarballFiles([]string{"*.log"})
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expect the two log files. Got %v, %v", files, err)
+	}
+
+	files, err = r.TarballFiles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteTarball(buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{"stdout": "one\ntwo\n", "stderr": "error\n", "logs/app.log": "app\n",
+		"logs/short.log": "ab\x00\x00"}
+	got := map[string]string{}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(data)
+
+		switch hdr.Name {
+		case "stdout":
+			if hdr.Mode != 0644 || hdr.ModTime.Unix() != 1513020278 || hdr.Uname != "root" {
+				t.Fatalf("unexpected header of stdout %+v", hdr)
+			}
+		case "stderr":
+			if hdr.Mode != 0600 {
+				t.Fatalf("expect mode 0600 of stderr. Got %o", hdr.Mode)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %q. Got %q", expect, got)
+	}
+}
@@ -0,0 +1,136 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// TimeField is the field of the JSON formats with the time of a line extracted by OptTimestamps, in RFC3339 format.
+const TimeField = "TIMESTAMP"
+
+// DefaultTimeLayouts are the layouts OptTimestamps detects without configured layouts: RFC3339, the same with a
+// space instead of T and dots or commas before the fraction of seconds, with slashes in the date, and syslog.
+var DefaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	time.Stamp,
+}
+
+// timeParser extracts the time at the beginning of the lines.
+type timeParser struct {
+	layouts []string
+
+	// last is the index of the layout of the last parsed line, which is tried first.
+	last int
+
+	// now returns the current time, the year of the layouts without year is the current one.
+	now func() time.Time
+}
+
+// parse returns the time at the beginning of the message, the zero time if none of the layouts matches. The time may
+// be enclosed in brackets; the times without zone are UTC.
+func (p *timeParser) parse(message string) time.Time {
+	for i := range p.layouts {
+		j := (p.last + i) % len(p.layouts)
+		if t, ok := parseLeadingTime(p.layouts[j], message); ok {
+			p.last = j
+			return p.withYear(p.layouts[j], t)
+		}
+	}
+	return time.Time{}
+}
+
+// withYear sets the current year of a time parsed with a layout without year, the previous year if the time would
+// be more than a day in the future.
+func (p *timeParser) withYear(layout string, t time.Time) time.Time {
+	if strings.Contains(layout, "2006") || t.Year() != 0 {
+		return t
+	}
+
+	now := p.now()
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// parseLeadingTime parses as many space separated words at the beginning of the message as the layout has.
+func parseLeadingTime(layout, message string) (time.Time, bool) {
+	words := strings.Count(strings.Join(strings.Fields(layout), " "), " ") + 1
+	fields := strings.Fields(strings.TrimPrefix(message, "["))
+	if len(fields) < words {
+		return time.Time{}, false
+	}
+
+	value := strings.TrimRight(strings.Join(fields[:words], " "), "]:,")
+	t, err := time.Parse(layout, value)
+	return t, err == nil
+}
+
+// OptTimestamps extracts the time at the beginning of the lines with the layouts, in Go reference time format, or with
+// DefaultTimeLayouts if there are none. The lines without time, such as the lines of a stack trace, have the time
+// of the previous line. The time is sent in TimeField of the JSON formats and used by OptTimeRange.
+func OptTimestamps(layouts ...string) Option {
+	return func(rm *ReadManager) error {
+		if len(layouts) == 0 {
+			layouts = DefaultTimeLayouts
+		}
+
+		for _, layout := range layouts {
+			if strings.TrimSpace(layout) == "" {
+				return errors.New("time layout cannot be empty")
+			}
+		}
+
+		rm.times = &timeParser{layouts: layouts, now: time.Now}
+		return nil
+	}
+}
+
+// OptTimeRange reads the lines with a time between since and until, a zero time is no limit. The lines are expected
+// to be written in time order: the lines before since are skipped and a read ends at the first line after until.
+// It enables OptTimestamps with the default layouts, unless they are set.
+func OptTimeRange(since, until time.Time) Option {
+	return func(rm *ReadManager) error {
+		if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+			return errors.New("since must be before until")
+		}
+
+		if rm.times == nil {
+			rm.times = &timeParser{layouts: DefaultTimeLayouts, now: time.Now}
+		}
+		rm.since, rm.until = since, until
+		return nil
+	}
+}
+
+// RangeEnd returns true once a line after the end of the time range of OptTimeRange was read, there are no more
+// lines to read.
+func (rm *ReadManager) RangeEnd() bool {
+	return rm.rangeEnd
+}
+
+// stampLines sets the time of the scanned lines.
+func (rm *ReadManager) stampLines(lines []Line) {
+	for i := range lines {
+		if t := rm.times.parse(lines[i].Message); !t.IsZero() {
+			rm.lastTime = t
+		}
+		lines[i].Time = rm.lastTime
+	}
+}
+
+// inRange returns io.EOF if the line is after the end of the time range and false if it's before its beginning.
+func (rm *ReadManager) inRange(line *Line) (bool, error) {
+	if !rm.until.IsZero() && line.Time.After(rm.until) {
+		rm.rangeEnd = true
+		return false, io.EOF
+	}
+	return rm.since.IsZero() || !line.Time.Before(rm.since), nil
+}
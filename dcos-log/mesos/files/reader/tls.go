@@ -0,0 +1,106 @@
+package reader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// TLSOption modifies the TLS config used to connect to the Mesos files API.
+type TLSOption func(*tls.Config) error
+
+// TLSClientCertificate sets a PEM encoded client certificate and key, presented to masters and agents which
+// require client certificates.
+func TLSClientCertificate(certFile, keyFile string) TLSOption {
+	return func(c *tls.Config) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// TLSCACertificate verifies the server certificates with a PEM encoded CA bundle instead of the system roots.
+func TLSCACertificate(file string) TLSOption {
+	return func(c *tls.Config) error {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", file)
+		}
+		c.RootCAs = pool
+		c.InsecureSkipVerify = false
+		return nil
+	}
+}
+
+// TLSServerName sets the name the server certificates are verified against, for masters and agents reached
+// by IP address.
+func TLSServerName(name string) TLSOption {
+	return func(c *tls.Config) error {
+		if name == "" {
+			return errors.New("server name cannot be empty")
+		}
+		c.ServerName = name
+		return nil
+	}
+}
+
+// ConfigureTransport applies the options to the TLS config of a transport.
+func ConfigureTransport(tr *http.Transport, opts ...TLSOption) error {
+	c := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		c = tr.TLSClientConfig.Clone()
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+
+	tr.TLSClientConfig = c
+	return nil
+}
+
+// OptTLS applies the options to a copy of the client transport, the client passed to NewLineReader is not
+// modified. The client transport must be an *http.Transport or nil. It must precede the options which read
+// the file, such as OptReadFromEnd and OptCursor.
+func OptTLS(opts ...TLSOption) Option {
+	return func(rm *ReadManager) error {
+		client := &http.Client{}
+		if rm.client != nil {
+			*client = *rm.client
+		}
+
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+
+		tr, ok := base.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("unable to configure TLS of transport %T", base)
+		}
+
+		// the copy keeps all the settings of a tuned transport, http.Transport cannot be copied by value.
+		transport := tr.Clone()
+
+		if err := ConfigureTransport(transport, opts...); err != nil {
+			return err
+		}
+
+		client.Transport = transport
+		rm.client = client
+		return nil
+	}
+}
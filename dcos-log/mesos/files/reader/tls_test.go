@@ -0,0 +1,136 @@
+package reader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCertificate writes a self signed client certificate and its key to dir.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dcos-log"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestOptTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "dcos-log-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	client := &http.Client{}
+	newReader := func(opts ...TLSOption) *ReadManager {
+		rm, err := NewLineReader(client, url.URL{}, "agent", "framework", "executor", "container", "", "stdout",
+			LineFormat, OptTLS(opts...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rm
+	}
+
+	// the certificate of the test server is valid for example.com and 127.0.0.1.
+	rm := newReader(TLSCACertificate(caFile), TLSClientCertificate(certFile, keyFile), TLSServerName("example.com"))
+	resp, err := rm.client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if client.Transport != nil {
+		t.Fatal("expect the client passed to NewLineReader not to be modified")
+	}
+
+	if _, err := newReader(TLSCACertificate(caFile), TLSServerName("other.example.com")).client.Get(ts.URL); err == nil {
+		t.Fatal("expect the server certificate not to be valid for other.example.com")
+	}
+
+	if _, err := NewLineReader(client, url.URL{}, "agent", "framework", "executor", "container", "", "stdout",
+		LineFormat, OptTLS(TLSCACertificate(filepath.Join(dir, "client.key")))); err == nil {
+		t.Fatal("expect error for a bundle without certificates")
+	}
+}
+
+func TestTuneTransport(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+	TuneTransport(tr, 0)
+
+	if tr.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || tr.DialContext == nil || !tr.ForceAttemptHTTP2 {
+		t.Fatalf("expect a tuned transport. Got %+v", tr)
+	}
+
+	if tr.TLSClientConfig != tlsConfig {
+		t.Fatal("expect the TLS config to be kept")
+	}
+
+	// the readers created without a client share one, OptTLS copies its settings.
+	rm, err := NewLineReader(nil, url.URL{}, "agent", "framework", "executor", "container", "", "stdout", LineFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rm.client != sharedClient {
+		t.Fatal("expect the shared client")
+	}
+
+	rm, err = NewLineReader(nil, url.URL{}, "agent", "framework", "executor", "container", "", "stdout", LineFormat,
+		OptTLS(TLSServerName("example.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copied := rm.client.Transport.(*http.Transport); copied.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Fatalf("expect the settings of the shared transport to be copied. Got %d idle connections per host",
+			copied.MaxIdleConnsPerHost)
+	}
+}
@@ -0,0 +1,49 @@
+package reader
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxIdleConnsPerHost is the number of idle connections kept open to an agent by a tuned transport. The
+// default of net/http is 2, so the concurrent task log reads of an agent kept opening new connections.
+const DefaultMaxIdleConnsPerHost = 64
+
+// settings of a tuned transport.
+const (
+	dialTimeout           = 5 * time.Second
+	dialKeepAlive         = 30 * time.Second
+	idleConnTimeout       = 90 * time.Second
+	tlsHandshakeTimeout   = 5 * time.Second
+	expectContinueTimeout = time.Second
+)
+
+// sharedClient is the client of the readers created without one, so they share the connections to the agents.
+var sharedClient = &http.Client{Transport: NewTransport(DefaultMaxIdleConnsPerHost)}
+
+// NewTransport returns a transport tuned for many concurrent reads of the same agents, see TuneTransport.
+func NewTransport(maxIdleConnsPerHost int) *http.Transport {
+	tr := &http.Transport{}
+	TuneTransport(tr, maxIdleConnsPerHost)
+	return tr
+}
+
+// TuneTransport keeps up to maxIdleConnsPerHost idle keep-alive connections to every agent, sets the dial and TLS
+// handshake timeouts, and uses HTTP/2 with the agents which support it over TLS. The TLS config and the dialer of
+// the transport are kept.
+func TuneTransport(tr *http.Transport, maxIdleConnsPerHost int) {
+	if tr.DialContext == nil {
+		tr.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: dialKeepAlive}).DialContext
+	}
+
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	tr.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	tr.IdleConnTimeout = idleConnTimeout
+	tr.TLSHandshakeTimeout = tlsHandshakeTimeout
+	tr.ExpectContinueTimeout = expectContinueTimeout
+	tr.ForceAttemptHTTP2 = true
+}
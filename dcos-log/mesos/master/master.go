@@ -0,0 +1,114 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dcos/dcos-go/dcos"
+	"github.com/dcos/dcos-go/dcos/nodeutil"
+	"github.com/dcos/dcos-log/dcos-log/tracing"
+)
+
+const (
+	agentsPath = "/slaves"
+	tasksPath  = "/tasks"
+
+	// maxTasks is the limit of a /tasks request.
+	maxTasks = 10000
+)
+
+// Agent is a subset of an agent object of the mesos master /slaves response.
+// http://mesos.apache.org/documentation/latest/endpoints/master/slaves/
+type Agent struct {
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	Active   bool   `json:"active"`
+
+	// Attributes are the --attributes of the agent, text values are strings and scalar values are numbers.
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// URL returns the base URL of the leading mesos master.
+func URL(useTLS bool) url.URL {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	return url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(dcos.DNSRecordLeader, strconv.Itoa(dcos.PortMesosMaster)),
+	}
+}
+
+// get decodes the JSON response of a mesos master endpoint into v.
+func get(ctx context.Context, client *http.Client, masterURL url.URL, header http.Header, v interface{}) error {
+	req, err := http.NewRequest("GET", masterURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if header != nil {
+		req.Header = header
+	}
+
+	req, span := tracing.StartRequest(req.WithContext(ctx), "mesos master "+masterURL.Path)
+	defer span.End()
+
+	resp, err := client.Do(req)
+	span.SetError(err)
+	if err != nil {
+		return fmt.Errorf("unable to make a GET request to %s: %s", masterURL.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET request to %s returned response code %d", masterURL.String(), resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode the response of %s: %s", masterURL.String(), err)
+	}
+	return nil
+}
+
+// GetAgents makes a request to the mesos master /slaves endpoint.
+func GetAgents(ctx context.Context, client *http.Client, masterURL url.URL, header http.Header) ([]Agent, error) {
+	masterURL.Path = agentsPath
+	masterURL.RawQuery = ""
+
+	agents := struct {
+		Agents []Agent `json:"slaves"`
+	}{}
+	if err := get(ctx, client, masterURL, header, &agents); err != nil {
+		return nil, err
+	}
+
+	return agents.Agents, nil
+}
+
+// GetFrameworkTasks makes a request to the mesos master /tasks endpoint and returns the tasks of a framework,
+// the running tasks and the completed tasks the master still knows about.
+// http://mesos.apache.org/documentation/latest/endpoints/master/tasks/
+func GetFrameworkTasks(ctx context.Context, client *http.Client, masterURL url.URL, header http.Header,
+	frameworkID string) ([]nodeutil.Task, error) {
+	masterURL.Path = tasksPath
+	masterURL.RawQuery = url.Values{
+		"framework_id": {frameworkID},
+		"limit":        {strconv.Itoa(maxTasks)},
+	}.Encode()
+
+	tasks := struct {
+		Tasks []nodeutil.Task `json:"tasks"`
+	}{}
+	if err := get(ctx, client, masterURL, header, &tasks); err != nil {
+		return nil, err
+	}
+
+	return tasks.Tasks, nil
+}
@@ -0,0 +1,77 @@
+package master
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGetAgents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/slaves" {
+			t.Fatalf("expect /slaves. Got %s", r.URL.Path)
+		}
+
+		if r.Header.Get("Authorization") != "token=abc" {
+			t.Fatalf("expect Authorization header. Got %v", r.Header)
+		}
+
+		w.Write([]byte(`{"slaves": [{"id": "S1", "hostname": "10.0.0.1", "active": true, "pid": "slave(1)@10.0.0.1:5051",
+			"attributes": {"rack": "r1", "cores": 4}},
+			{"id": "S2", "hostname": "10.0.0.2", "active": false}]}`))
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "token=abc")
+	agents, err := GetAgents(context.Background(), &http.Client{}, *masterURL, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(agents) != 2 || agents[0].ID != "S1" || agents[0].Hostname != "10.0.0.1" || !agents[0].Active ||
+		agents[1].Active {
+		t.Fatalf("expect two agents, S2 inactive. Got %+v", agents)
+	}
+
+	if agents[0].Attributes["rack"] != "r1" || agents[0].Attributes["cores"] != 4.0 {
+		t.Fatalf("expect the attributes of S1. Got %v", agents[0].Attributes)
+	}
+}
+
+func TestGetFrameworkTasks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tasks" || r.URL.Query().Get("framework_id") != "f1" {
+			t.Fatalf("expect /tasks of framework f1. Got %s", r.URL)
+		}
+
+		w.Write([]byte(`{"tasks": [{"id": "web.1", "framework_id": "f1", "slave_id": "S1", "state": "TASK_RUNNING",
+			"statuses": [{"container_status": {"container_id": {"value": "c1"}}}]}]}`))
+	}))
+	defer ts.Close()
+
+	masterURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := GetFrameworkTasks(context.Background(), &http.Client{}, *masterURL, nil, "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[0].ID != "web.1" || tasks[0].SlaveID != "S1" || tasks[0].State != "TASK_RUNNING" {
+		t.Fatalf("expect task web.1. Got %+v", tasks)
+	}
+
+	if ids, err := tasks[0].ContainerIDs(); err != nil || len(ids) != 1 || ids[0] != "c1" {
+		t.Fatalf("expect container c1. Got %v, %v", ids, err)
+	}
+}
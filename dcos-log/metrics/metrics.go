@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the prometheus text exposition format content type.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+const contentType = "text/plain; version=0.0.4"
+
+var (
+	// DefaultLatencyBuckets are histogram buckets in seconds for request latencies.
+	DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultDurationBuckets are histogram buckets in seconds for long lived connections.
+	DefaultDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 14400}
+)
+
+// DefaultRegistry is a registry used by package level constructors and Handler.
+var DefaultRegistry = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics exposed together.
+type Registry struct {
+	sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("duplicate metric " + c.name())
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all registered metrics in prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	buf := &bytes.Buffer{}
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler returns an http.Handler which exposes the metrics of DefaultRegistry.
+func Handler() http.Handler {
+	return HandlerFor(DefaultRegistry)
+}
+
+// HandlerFor returns an http.Handler which exposes the metrics of a given registry.
+func HandlerFor(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.WriteTo(w)
+	})
+}
+
+// vec is a set of series of the same metric partitioned by label values.
+type vec struct {
+	sync.Mutex
+	metricName string
+	help       string
+	metricType string
+	labels     []string
+	series     map[string]*series
+	newValue   func() value
+}
+
+type value interface {
+	write(w io.Writer, name, labels string)
+}
+
+type series struct {
+	labelValues []string
+	value       value
+}
+
+func newVec(name, help, metricType string, labels []string, newValue func() value) *vec {
+	return &vec{
+		metricName: name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		series:     make(map[string]*series),
+		newValue:   newValue,
+	}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+func (v *vec) get(labelValues []string) value {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.metricName, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.Lock()
+	defer v.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), value: v.newValue()}
+		v.series[key] = s
+	}
+	return s.value
+}
+
+func (v *vec) write(w io.Writer) {
+	v.Lock()
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	v.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, v.metricType)
+	for _, s := range all {
+		s.value.write(w, v.metricName, formatLabels(v.labels, s.labelValues))
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = names[i] + `="` + escapeLabelValue(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeSample(w io.Writer, name, labels string, v float64) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(v))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.", "upstream")
+	c.WithLabelValues("agent").Inc()
+	c.WithLabelValues("agent").Add(2)
+	c.WithLabelValues("master").Inc()
+
+	buf := &bytes.Buffer{}
+	if _, err := r.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{upstream="agent"} 3
+test_total{upstream="master"} 1
+`
+	if buf.String() != expected {
+		t.Fatalf("expect %s. Got %s", expected, buf.String())
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("test_seconds", "Test histogram.", []float64{1, 0.1}, "route")
+	h.WithLabelValues("/v2/component").Observe(0.05)
+	h.WithLabelValues("/v2/component").Observe(0.5)
+	h.WithLabelValues("/v2/component").Observe(5)
+
+	buf := &bytes.Buffer{}
+	if _, err := r.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/v2/component",le="0.1"} 1
+test_seconds_bucket{route="/v2/component",le="1"} 2
+test_seconds_bucket{route="/v2/component",le="+Inf"} 3
+test_seconds_sum{route="/v2/component"} 5.55
+test_seconds_count{route="/v2/component"} 3
+`
+	if buf.String() != expected {
+		t.Fatalf("expect %s. Got %s", expected, buf.String())
+	}
+}
+
+func TestGaugeAndEscaping(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_gauge", "Test gauge.", "name")
+	g.WithLabelValues(`a"b\c`).Inc()
+	g.WithLabelValues(`a"b\c`).Dec()
+	g.WithLabelValues(`a"b\c`).Add(7)
+
+	w := httptest.NewRecorder()
+	HandlerFor(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != contentType {
+		t.Fatalf("expect content type %s. Got %s", contentType, ct)
+	}
+
+	if !strings.Contains(w.Body.String(), `test_gauge{name="a\"b\\c"} 7`) {
+		t.Fatalf("expect escaped label value. Got %s", w.Body.String())
+	}
+}
+
+func TestDuplicateMetric(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test counter.")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect duplicate registration to panic")
+		}
+	}()
+	r.NewGaugeVec("test_total", "Test gauge.")
+}
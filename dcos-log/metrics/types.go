@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	sync.Mutex
+	v float64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds a non negative value to the counter.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+
+	c.Lock()
+	c.v += v
+	c.Unlock()
+}
+
+// Value returns the current counter value.
+func (c *Counter) Value() float64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.v
+}
+
+func (c *Counter) write(w io.Writer, name, labels string) {
+	writeSample(w, name, labels, c.Value())
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec creates a CounterVec and registers it in DefaultRegistry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates a CounterVec and registers it in the registry.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() value { return &Counter{} })}
+	r.register(c)
+	return c
+}
+
+// WithLabelValues returns the counter for given label values, creating it if needed.
+func (c *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return c.get(labelValues).(*Counter)
+}
+
+// Gauge is a value which can go up and down.
+type Gauge struct {
+	sync.Mutex
+	v float64
+}
+
+// Set sets the gauge value.
+func (g *Gauge) Set(v float64) {
+	g.Lock()
+	g.v = v
+	g.Unlock()
+}
+
+// Add adds a value to the gauge, the value can be negative.
+func (g *Gauge) Add(v float64) {
+	g.Lock()
+	g.v += v
+	g.Unlock()
+}
+
+// Inc increments the gauge by 1.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by 1.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 {
+	g.Lock()
+	defer g.Unlock()
+	return g.v
+}
+
+func (g *Gauge) write(w io.Writer, name, labels string) {
+	writeSample(w, name, labels, g.Value())
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec creates a GaugeVec and registers it in DefaultRegistry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec creates a GaugeVec and registers it in the registry.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels, func() value { return &Gauge{} })}
+	r.register(g)
+	return g
+}
+
+// WithLabelValues returns the gauge for given label values, creating it if needed.
+func (g *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return g.get(labelValues).(*Gauge)
+}
+
+// Values returns the current values of all gauges keyed by comma separated label values.
+func (g *GaugeVec) Values() map[string]float64 {
+	g.Lock()
+	defer g.Unlock()
+
+	values := make(map[string]float64, len(g.series))
+	for _, s := range g.series {
+		values[strings.Join(s.labelValues, ",")] = s.value.(*Gauge).Value()
+	}
+	return values
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Count returns the total number of observations.
+func (h *Histogram) Count() uint64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer, name, labels string) {
+	h.Lock()
+	defer h.Unlock()
+
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+
+	for i, upper := range h.buckets {
+		writeSample(w, name+"_bucket", prefix+`le="`+formatFloat(upper)+`"`, float64(h.counts[i]))
+	}
+	writeSample(w, name+"_bucket", prefix+`le="+Inf"`, float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	*vec
+}
+
+// NewHistogramVec creates a HistogramVec and registers it in DefaultRegistry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates a HistogramVec and registers it in the registry.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{newVec(name, help, "histogram", labels, func() value { return newHistogram(sorted) })}
+	r.register(h)
+	return h
+}
+
+// WithLabelValues returns the histogram for given label values, creating it if needed.
+func (h *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return h.get(labelValues).(*Histogram)
+}
@@ -0,0 +1,253 @@
+// Package query implements a small query language for log entries which is used with both journal and
+// sandbox sources.
+//
+//	unit:dcos-marathon priority<=warning "connection refused" since:1h
+//
+// field:value terms match the field exactly, priority<=, priority<, priority>= and priority> select a range
+// of syslog priorities, since:duration selects the entries newer than the duration and the other terms,
+// bare words or quoted phrases, must be contained in the message. All terms must match.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnterminatedQuote is returned by Parse if a quoted phrase is not closed.
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// priorities are syslog priority names, the index is the priority value.
+var priorities = [][]string{
+	{"emerg", "emergency"},
+	{"alert"},
+	{"crit", "critical"},
+	{"err", "error"},
+	{"warning", "warn"},
+	{"notice"},
+	{"info", "informational"},
+	{"debug"},
+}
+
+// fieldAliases are the short names of journal fields.
+var fieldAliases = map[string]string{
+	"unit":       "_SYSTEMD_UNIT",
+	"identifier": "SYSLOG_IDENTIFIER",
+	"host":       "_HOSTNAME",
+	"pid":        "_PID",
+}
+
+// Match is a field:value term.
+type Match struct {
+	Field, Value string
+}
+
+// Query is a parsed query.
+type Query struct {
+	Matches []Match
+
+	// MinPriority and MaxPriority are the range of priorities, the values are inclusive.
+	MinPriority, MaxPriority int
+
+	// Text are the words and phrases the message must contain.
+	Text []string
+
+	// Since is zero if the query has no since: term.
+	Since time.Duration
+}
+
+// Parse parses a query.
+func Parse(s string) (*Query, error) {
+	terms, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{MinPriority: 0, MaxPriority: len(priorities) - 1}
+	for _, term := range terms {
+		if term.quoted {
+			q.Text = append(q.Text, term.value)
+			continue
+		}
+
+		if err := q.parseTerm(term.value); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.MinPriority > q.MaxPriority {
+		return nil, errors.New("priority terms select no priority")
+	}
+	return q, nil
+}
+
+func (q *Query) parseTerm(term string) error {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		i := strings.Index(term, op)
+		if i < 0 {
+			continue
+		}
+
+		if field := strings.ToLower(term[:i]); field != "priority" {
+			return fmt.Errorf("%s: only priority can be compared, use field:value", term)
+		}
+
+		p, err := ParsePriority(term[i+len(op):])
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case "<=":
+			q.MaxPriority = min(q.MaxPriority, p)
+		case "<":
+			q.MaxPriority = min(q.MaxPriority, p-1)
+		case ">=":
+			q.MinPriority = max(q.MinPriority, p)
+		case ">":
+			q.MinPriority = max(q.MinPriority, p+1)
+		}
+		return nil
+	}
+
+	i := strings.Index(term, ":")
+	if i <= 0 {
+		q.Text = append(q.Text, term)
+		return nil
+	}
+
+	field, value := strings.ToLower(term[:i]), term[i+1:]
+	switch field {
+	case "since":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s: invalid duration, use a value like 30m or 1h", term)
+		}
+		q.Since = d
+	case "priority":
+		p, err := ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		q.MinPriority, q.MaxPriority = max(q.MinPriority, p), min(q.MaxPriority, p)
+	default:
+		if alias, ok := fieldAliases[field]; ok {
+			field = alias
+		}
+		q.Matches = append(q.Matches, Match{Field: strings.ToUpper(field), Value: value})
+	}
+	return nil
+}
+
+// ParsePriority parses a syslog priority, a number 0-7 or a name like warning.
+func ParsePriority(s string) (int, error) {
+	if p, err := strconv.Atoi(s); err == nil && p >= 0 && p < len(priorities) {
+		return p, nil
+	}
+
+	for p, names := range priorities {
+		for _, name := range names {
+			if strings.EqualFold(s, name) {
+				return p, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid priority %q, use 0-7 or a name like warning", s)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Priorities returns the PRIORITY values selected by the query, nil if the query selects all priorities.
+func (q *Query) Priorities() []string {
+	if q.MinPriority == 0 && q.MaxPriority == len(priorities)-1 {
+		return nil
+	}
+
+	values := []string{}
+	for p := q.MinPriority; p <= q.MaxPriority; p++ {
+		values = append(values, strconv.Itoa(p))
+	}
+	return values
+}
+
+// Match returns true if the fields of an entry match the query. MESSAGE field is used for the text terms,
+// since: term is not checked.
+func (q *Query) Match(fields map[string]string) bool {
+	for _, m := range q.Matches {
+		if fields[m.Field] != m.Value {
+			return false
+		}
+	}
+
+	if q.Priorities() != nil {
+		p, err := strconv.Atoi(fields["PRIORITY"])
+		if err != nil || p < q.MinPriority || p > q.MaxPriority {
+			return false
+		}
+	}
+
+	for _, text := range q.Text {
+		if !strings.Contains(fields["MESSAGE"], text) {
+			return false
+		}
+	}
+	return true
+}
+
+type term struct {
+	value  string
+	quoted bool
+}
+
+// split splits the query by spaces, quoted phrases are kept together. A quote inside of a term,
+// as in unit:"my unit", quotes the rest of the term.
+func split(s string) ([]term, error) {
+	var (
+		terms   []term
+		current []rune
+		quoted  bool
+		inQuote bool
+	)
+
+	flush := func() {
+		if len(current) > 0 || quoted {
+			terms = append(terms, term{value: string(current), quoted: quoted})
+		}
+		current, quoted = nil, false
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			// only a term starting with a quote is a phrase.
+			if !inQuote && len(current) == 0 {
+				quoted = true
+			}
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t'):
+			flush()
+		default:
+			current = append(current, r)
+		}
+	}
+
+	if inQuote {
+		return nil, ErrUnterminatedQuote
+	}
+	flush()
+	return terms, nil
+}
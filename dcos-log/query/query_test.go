@@ -0,0 +1,72 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`unit:dcos-marathon priority<=warning "connection refused" since:1h timeout identifier:"my app"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Query{
+		Matches:     []Match{{"_SYSTEMD_UNIT", "dcos-marathon"}, {"SYSLOG_IDENTIFIER", "my app"}},
+		MinPriority: 0,
+		MaxPriority: 4,
+		Text:        []string{"connection refused", "timeout"},
+		Since:       time.Hour,
+	}
+	if !reflect.DeepEqual(q, expected) {
+		t.Fatalf("expect %+v. Got %+v", expected, q)
+	}
+
+	if p := strings.Join(q.Priorities(), ","); p != "0,1,2,3,4" {
+		t.Fatalf("expect priorities 0-4. Got %s", p)
+	}
+
+	q, err = Parse(`priority>3 priority<6 "error: disk"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := strings.Join(q.Priorities(), ","); p != "4,5" {
+		t.Fatalf("expect priorities 4,5. Got %s", p)
+	}
+
+	if len(q.Text) != 1 || q.Text[0] != "error: disk" {
+		t.Fatalf("expect phrase with colon. Got %v", q.Text)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{`"unterminated`, `since:1x`, `priority<=loud`, `unit>=3`, `priority<2 priority>5`} {
+		if _, err := Parse(s); err == nil {
+			t.Fatalf("expect error for %s", s)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	q, err := Parse(`unit:dcos-marathon priority<=err refused`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[string]string{"_SYSTEMD_UNIT": "dcos-marathon", "PRIORITY": "3", "MESSAGE": "connection refused"}
+	if !q.Match(fields) {
+		t.Fatalf("expect %v to match", fields)
+	}
+
+	fields["PRIORITY"] = "6"
+	if q.Match(fields) {
+		t.Fatalf("expect %v not to match", fields)
+	}
+
+	if q, _ := Parse(""); !q.Match(nil) {
+		t.Fatal("expect empty query to match everything")
+	}
+}
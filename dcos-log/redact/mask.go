@@ -0,0 +1,206 @@
+package redact
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultReplacement replaces the values matched by a mask without replacement.
+const DefaultReplacement = "[REDACTED]"
+
+// valueGroup is the name of the subexpression of a pattern which is replaced instead of the whole match.
+const valueGroup = "value"
+
+// detector is a named pattern of sensitive values, valid filters out the matches which look alike but are not.
+type detector struct {
+	pattern string
+	valid   func(string) bool
+}
+
+// detectors are the named patterns a mask can use instead of a pattern of its own.
+var detectors = map[string]detector{
+	// JWTs, the DC/OS "token=" and the bearer Authorization header values.
+	"token": {pattern: `eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*|(?i:\b(?:token=|bearer\s+))(?P<value>[A-Za-z0-9._~+/-]{8,}=*)`},
+
+	// the values of password, secret and key assignments, password=x, "secret": "x" or --api-key x.
+	"password": {pattern: `(?i)\b(?:passwd|password|pwd|secret|api[_-]?key|access[_-]?key|private[_-]?key)"?\s*(?:[:=]\s*|\s+)(?P<value>"[^"]*"|'[^']*'|[^\s,;&"']+)`},
+
+	// 13 to 19 digits, optionally grouped with spaces or dashes, which pass the Luhn check.
+	"credit-card": {pattern: `\b\d(?:[ -]?\d){12,18}\b`, valid: luhn},
+}
+
+// Mask replaces the sensitive values in the fields of the entries, for every user. The values are found by a
+// named detector or a regular expression; if the expression has a subexpression named value only it is replaced,
+// so password=(?P<value>\S+) keeps the key. Fields are path.Match patterns of the masked fields, MESSAGE if empty.
+type Mask struct {
+	Detector    string   `json:"detector,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Fields      []string `json:"fields,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+
+	re    *regexp.Regexp
+	group int
+	valid func(string) bool
+}
+
+// compile validates the mask and compiles its pattern.
+func (m *Mask) compile() error {
+	pattern := m.Pattern
+	switch {
+	case m.Detector != "" && m.Pattern != "":
+		return fmt.Errorf("detector and pattern are mutually exclusive")
+	case m.Detector != "":
+		d, ok := detectors[m.Detector]
+		if !ok {
+			return fmt.Errorf("unknown detector %q, use token, password or credit-card", m.Detector)
+		}
+		pattern, m.valid = d.pattern, d.valid
+	case m.Pattern == "":
+		return fmt.Errorf("detector or pattern is required")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+	m.re = re
+	for i, name := range re.SubexpNames() {
+		if name == valueGroup {
+			m.group = i
+		}
+	}
+
+	if len(m.Fields) == 0 {
+		m.Fields = []string{"MESSAGE"}
+	}
+
+	for _, field := range m.Fields {
+		if _, err := path.Match(field, ""); err != nil {
+			return fmt.Errorf("invalid field pattern %q: %s", field, err)
+		}
+	}
+
+	if m.Replacement == "" {
+		m.Replacement = DefaultReplacement
+	}
+	return nil
+}
+
+// masks returns true if the mask applies to a field.
+func (m *Mask) masks(field string) bool {
+	for _, pattern := range m.Fields {
+		if ok, _ := path.Match(pattern, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the value with the matches replaced.
+func (m *Mask) apply(value string) string {
+	matches := m.re.FindAllStringSubmatchIndex(value, -1)
+	if matches == nil {
+		return value
+	}
+
+	var (
+		b        strings.Builder
+		last     int
+		replaced bool
+	)
+	for _, loc := range matches {
+		start, end := loc[0], loc[1]
+		if m.group > 0 && loc[2*m.group] >= 0 {
+			start, end = loc[2*m.group], loc[2*m.group+1]
+		}
+
+		if m.valid != nil && !m.valid(value[start:end]) {
+			continue
+		}
+
+		b.WriteString(value[last:start])
+		b.WriteString(m.Replacement)
+		last, replaced = end, true
+	}
+
+	if !replaced {
+		return value
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// Masking returns true if the policy has masks.
+func (p *Policy) Masking() bool {
+	return p != nil && len(p.Masks) > 0
+}
+
+// MaskValue returns the value of a field with the sensitive values replaced.
+func (p *Policy) MaskValue(field, value string) string {
+	if p == nil {
+		return value
+	}
+
+	for i := range p.Masks {
+		if p.Masks[i].masks(field) {
+			value = p.Masks[i].apply(value)
+		}
+	}
+	return value
+}
+
+// MaskValues returns the distinct values of a field with the sensitive values replaced, the values which only
+// differ by a masked value are returned once. values is modified.
+func (p *Policy) MaskValues(field string, values []string) []string {
+	if !p.Masking() {
+		return values
+	}
+
+	seen := make(map[string]bool, len(values))
+	masked := values[:0]
+	for _, v := range values {
+		if v = p.MaskValue(field, v); !seen[v] {
+			seen[v] = true
+			masked = append(masked, v)
+		}
+	}
+	return masked
+}
+
+// Mask replaces the sensitive values of the fields. The addresses of the entry in the journal, such as __CURSOR,
+// are kept.
+func (p *Policy) Mask(fields map[string]string) {
+	if !p.Masking() {
+		return
+	}
+
+	for field, value := range fields {
+		if strings.HasPrefix(field, "__") {
+			continue
+		}
+		fields[field] = p.MaskValue(field, value)
+	}
+}
+
+// luhn returns true if the digits of s pass the Luhn checksum of the payment card numbers.
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
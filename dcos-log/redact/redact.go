@@ -0,0 +1,173 @@
+// Package redact hides journal fields from the users of a role, for instance _CMDLINE or source addresses
+// from the users which are not operators.
+//
+// A policy is a JSON file with a list of roles:
+//
+//	{"roles": [
+//	  {"name": "operators", "uids": ["bootstrapuser"], "hide": []},
+//	  {"name": "default", "hide": ["_CMDLINE", "_EXE", "*_ADDR"]}
+//	]}
+//
+// A user gets the first role listing the uid of the user, or the first role without uids. Hide patterns use
+// path.Match syntax.
+//
+// The masks of a policy replace the sensitive values in the fields, such as tokens and passwords in the messages,
+// for every user:
+//
+//	{"masks": [
+//	  {"detector": "password"},
+//	  {"pattern": "ssn=(?P<value>\\d{3}-\\d{2}-\\d{4})", "fields": ["MESSAGE", "_CMDLINE"]}
+//	]}
+package redact
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrNoRoles is returned by Parse if a policy has neither roles nor masks.
+var ErrNoRoles = errors.New("redaction policy must have at least one role or mask")
+
+// Role is a set of fields hidden from the users with given uids.
+type Role struct {
+	Name string   `json:"name"`
+	UIDs []string `json:"uids,omitempty"`
+	Hide []string `json:"hide"`
+}
+
+// Hidden returns true if a field is hidden from the role. Nothing is hidden from a nil role.
+func (r *Role) Hidden(field string) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, pattern := range r.Hide {
+		// patterns are validated by Parse.
+		if ok, _ := path.Match(pattern, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact removes the hidden fields.
+func (r *Role) Redact(fields map[string]string) {
+	for field := range fields {
+		if r.Hidden(field) {
+			delete(fields, field)
+		}
+	}
+}
+
+// Policy is a list of roles and the masks applied for all of them.
+type Policy struct {
+	Roles []Role `json:"roles"`
+	Masks []Mask `json:"masks,omitempty"`
+}
+
+// Parse parses a JSON policy.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	if len(p.Roles) == 0 && len(p.Masks) == 0 {
+		return nil, ErrNoRoles
+	}
+
+	for _, role := range p.Roles {
+		for _, pattern := range role.Hide {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("role %s: invalid pattern %q: %s", role.Name, pattern, err)
+			}
+		}
+	}
+
+	for i := range p.Masks {
+		if err := p.Masks[i].compile(); err != nil {
+			return nil, fmt.Errorf("mask %d: %s", i, err)
+		}
+	}
+	return p, nil
+}
+
+// Load reads a policy file.
+func Load(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Role returns the role of a user, nil if no role applies to the user or the policy is nil.
+func (p *Policy) Role(uid string) *Role {
+	if p == nil {
+		return nil
+	}
+
+	var fallback *Role
+	for i, role := range p.Roles {
+		if len(role.UIDs) == 0 && fallback == nil {
+			fallback = &p.Roles[i]
+		}
+
+		for _, u := range role.UIDs {
+			if uid != "" && u == uid {
+				return &p.Roles[i]
+			}
+		}
+	}
+	return fallback
+}
+
+// UID returns the uid claim of an Authorization header value "token=<JWT>". The signature is not verified,
+// the token must be validated by a proxy in front of dcos-log, as Admin Router does. Empty string is returned
+// if the token cannot be decoded.
+func UID(token string) string {
+	parts := strings.Split(strings.TrimPrefix(token, "token="), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	claims := struct {
+		UID string `json:"uid"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.UID
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultPolicy *Policy
+)
+
+// SetDefault sets the policy used by the API handlers.
+func SetDefault(p *Policy) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultPolicy = p
+}
+
+// Default returns the policy used by the API handlers, nil if no fields are redacted.
+func Default() *Policy {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultPolicy
+}
@@ -0,0 +1,114 @@
+package redact
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const testPolicy = `{"roles": [
+  {"name": "operators", "uids": ["bootstrapuser"], "hide": []},
+  {"name": "default", "hide": ["_CMDLINE", "*_ADDR"]}
+]}`
+
+func testToken(payload string) string {
+	return "token=eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role := p.Role("bootstrapuser"); role == nil || role.Name != "operators" {
+		t.Fatalf("expect operators role. Got %v", role)
+	}
+
+	role := p.Role("alice")
+	if role == nil || role.Name != "default" {
+		t.Fatalf("expect default role. Got %v", role)
+	}
+
+	fields := map[string]string{"MESSAGE": "hello", "_CMDLINE": "/bin/app --password=secret", "DCOS_LOG_REMOTE_ADDR": "10.0.0.1:514"}
+	role.Redact(fields)
+	if len(fields) != 1 || fields["MESSAGE"] != "hello" {
+		t.Fatalf("expect only MESSAGE. Got %v", fields)
+	}
+
+	if (*Role)(nil).Hidden("_CMDLINE") || (*Policy)(nil).Role("alice") != nil {
+		t.Fatal("expect nothing hidden without a policy")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse([]byte(`{"roles": []}`)); err != ErrNoRoles {
+		t.Fatalf("expect ErrNoRoles. Got %v", err)
+	}
+
+	if _, err := Parse([]byte(`{"roles": [{"name": "default", "hide": ["[A-"]}]}`)); err == nil {
+		t.Fatal("expect invalid pattern error")
+	}
+}
+
+func TestUID(t *testing.T) {
+	if uid := UID(testToken(`{"uid":"alice","exp":1}`)); uid != "alice" {
+		t.Fatalf("expect alice. Got %s", uid)
+	}
+
+	for _, token := range []string{"", "token=abc", testToken("not json")} {
+		if uid := UID(token); uid != "" {
+			t.Fatalf("expect empty uid for %s. Got %s", token, uid)
+		}
+	}
+}
+
+func TestMasks(t *testing.T) {
+	p, err := Parse([]byte(`{"masks": [
+	  {"detector": "token"},
+	  {"detector": "password", "fields": ["MESSAGE", "_CMDLINE"]},
+	  {"detector": "credit-card"},
+	  {"pattern": "ssn=(?P<value>\\d{3}-\\d{2}-\\d{4})", "replacement": "***"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		field, value, expect string
+	}{
+		{"MESSAGE", "Authorization: token=eyJhbGciOiJSUzI1NiJ9.eyJ1aWQiOiJhIn0.c2ln", "Authorization: token=[REDACTED]"},
+		{"MESSAGE", "Authorization: Bearer abcdefgh12345678", "Authorization: Bearer [REDACTED]"},
+		{"MESSAGE", `login password=hunter2 user=alice`, "login password=[REDACTED] user=alice"},
+		{"MESSAGE", `{"secret": "s3cr3t", "id": 1}`, `{"secret": [REDACTED], "id": 1}`},
+		{"_CMDLINE", "/bin/app --api-key abc123", "/bin/app --api-key [REDACTED]"},
+		{"MESSAGE", "paid with 4111 1111 1111 1111 for order 1234567890123", "paid with [REDACTED] for order 1234567890123"},
+		{"MESSAGE", "ssn=123-45-6789", "ssn=***"},
+		{"_PID", "password=x", "password=x"},
+	} {
+		if masked := p.MaskValue(tc.field, tc.value); masked != tc.expect {
+			t.Fatalf("expect %s=%q. Got %q", tc.field, tc.expect, masked)
+		}
+	}
+
+	fields := map[string]string{"MESSAGE": "password=x", "__CURSOR": "s=1;password=x"}
+	p.Mask(fields)
+	if fields["MESSAGE"] != "password=[REDACTED]" || fields["__CURSOR"] != "s=1;password=x" {
+		t.Fatalf("expect the message masked and the cursor kept. Got %v", fields)
+	}
+
+	values := p.MaskValues("MESSAGE", []string{"password=a", "password=b", "hello"})
+	if len(values) != 2 || values[0] != "password=[REDACTED]" || values[1] != "hello" {
+		t.Fatalf("expect the distinct masked values. Got %v", values)
+	}
+
+	for _, policy := range []string{
+		`{"masks": [{"detector": "ssn"}]}`,
+		`{"masks": [{"detector": "token", "pattern": "x"}]}`,
+		`{"masks": [{}]}`,
+		`{"masks": [{"pattern": "("}]}`,
+	} {
+		if _, err := Parse([]byte(policy)); err == nil {
+			t.Fatalf("expect an error for %s", policy)
+		}
+	}
+}
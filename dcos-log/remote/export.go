@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxEntrySize is the maximum size of the fields of a single entry.
+	maxEntrySize = 1 << 20
+
+	maxFieldNameSize = 64
+)
+
+var (
+	// ErrEntryTooLarge is returned by Decode if the fields of an entry exceed 1MB.
+	ErrEntryTooLarge = errors.New("journal entry too large")
+
+	// ErrInvalidBinaryField is returned by Decode if the data of a binary field is not followed by a new line.
+	ErrInvalidBinaryField = errors.New("binary field data must be followed by a new line")
+)
+
+// Decoder reads the entries of the journal export format, the format systemd-journal-upload sends.
+// https://www.freedesktop.org/wiki/Software/systemd/export/
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new instance of Decoder.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the fields of the next entry, io.EOF is returned if there are no more entries. If a field
+// occurs more than once, the last value is returned.
+func (d *Decoder) Decode() (map[string]string, error) {
+	entry := make(map[string]string)
+	size := 0
+	for {
+		line, err := d.readLine(maxEntrySize - size)
+		if err == io.EOF && len(entry) > 0 {
+			return entry, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// an empty line terminates the entry.
+		if len(line) == 0 {
+			if len(entry) == 0 {
+				continue
+			}
+			return entry, nil
+		}
+
+		var name, value string
+		if i := bytes.IndexByte(line, '='); i >= 0 {
+			name, value = string(line[:i]), string(line[i+1:])
+		} else {
+			// binary fields are the name, a little endian 64 bit size, the data and a new line.
+			name = string(line)
+
+			var n uint64
+			if err := binary.Read(d.r, binary.LittleEndian, &n); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			if n > uint64(maxEntrySize-size-len(name)) {
+				return nil, ErrEntryTooLarge
+			}
+
+			data := make([]byte, n+1)
+			if _, err := io.ReadFull(d.r, data); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			if data[n] != '\n' {
+				return nil, ErrInvalidBinaryField
+			}
+			value = string(data[:n])
+		}
+
+		if !validFieldName(name) {
+			return nil, fmt.Errorf("invalid field name %q", name)
+		}
+
+		size += len(name) + len(value)
+		if size > maxEntrySize {
+			return nil, ErrEntryTooLarge
+		}
+		entry[name] = value
+	}
+}
+
+// readLine reads a line without the new line, up to max bytes.
+func (d *Decoder) readLine(max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := d.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > max+1 {
+			return nil, ErrEntryTooLarge
+		}
+
+		switch err {
+		case nil:
+			return line[:len(line)-1], nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// validFieldName returns true if a name consists of uppercase letters, numbers and underscores. Underscore
+// prefixed names are trusted fields and double underscore prefixed names are export metadata.
+func validFieldName(name string) bool {
+	if name == "" || len(name) > maxFieldNameSize {
+		return false
+	}
+
+	for _, r := range name {
+		if !('A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+	"github.com/dcos/dcos-log/dcos-log/journal/writer"
+)
+
+func binaryField(name string, data []byte) []byte {
+	buf := bytes.NewBufferString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(data)))
+	buf.Write(data)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func exportEntries() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("__CURSOR=s=1;i=1\n__REALTIME_TIMESTAMP=1500000000000000\n_HOSTNAME=agent-1\n")
+	buf.WriteString("_SYSTEMD_UNIT=dcos-mesos-slave.service\nPRIORITY=3\nMESSAGE=first\n\n")
+	buf.WriteString("__CURSOR=s=1;i=2\nSYSLOG_IDENTIFIER=app\nUNIT=dcos-mesos-master.service\nADDR=10.0.0.1:1\n")
+	buf.WriteString("DCOS_LOG_SOURCE=local\n")
+	buf.Write(binaryField("MESSAGE", []byte("multi\nline")))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	d := NewDecoder(bytes.NewReader(exportEntries()))
+
+	first, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first["MESSAGE"] != "first" || first["_HOSTNAME"] != "agent-1" || first["__REALTIME_TIMESTAMP"] != "1500000000000000" {
+		t.Fatalf("unexpected entry %v", first)
+	}
+
+	second, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second["MESSAGE"] != "multi\nline" || second["SYSLOG_IDENTIFIER"] != "app" || len(second) != 6 {
+		t.Fatalf("unexpected entry %v", second)
+	}
+
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expect io.EOF. Got %v", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for input, expectErr := range map[string]error{
+		"MESSAGE=unterminated":                                  io.ErrUnexpectedEOF,
+		"MESSAGE\n\x05\x00\x00\x00\x00\x00\x00\x00hello!":       ErrInvalidBinaryField,
+		"MESSAGE\n\x00\x00\x00\x00\x01\x00\x00\x00":             ErrEntryTooLarge,
+		"MESSAGE=" + strings.Repeat("a", maxEntrySize) + "\n\n": ErrEntryTooLarge,
+	} {
+		if _, err := NewDecoder(strings.NewReader(input)).Decode(); err != expectErr {
+			t.Fatalf("expect %v. Got %v", expectErr, err)
+		}
+	}
+
+	if _, err := NewDecoder(strings.NewReader("message=lowercase\n\n")).Decode(); err == nil {
+		t.Fatal("expect invalid field name error")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		entries []map[string]string
+	)
+
+	w, err := writer.NewWriter(writer.OptionSend(func(message string, priority journal.Priority, vars map[string]string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		vars["MESSAGE"] = message
+		vars["PRIORITY"] = string('0' + byte(priority))
+		entries = append(entries, vars)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer("127.0.0.1:0", OptionSink(JournalSink(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", UploadPath, bytes.NewReader(exportEntries()))
+	req.Header.Set("Content-Type", ContentType)
+	s.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expect status 202. Got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries. Got %v", entries)
+	}
+
+	first := entries[0]
+	if first["MESSAGE"] != "first" || first["PRIORITY"] != "3" || first["DCOS_LOG_SOURCE"] != "journal-remote" {
+		t.Fatalf("unexpected entry %v", first)
+	}
+
+	if first["DCOS_LOG_REMOTE_HOSTNAME"] != "agent-1" || first["DCOS_LOG_REMOTE_SYSTEMD_UNIT"] != "dcos-mesos-slave.service" ||
+		first["DCOS_LOG_REMOTE_REALTIME_TIMESTAMP"] != "1500000000000000" {
+		t.Fatalf("expect trusted fields to be prefixed. Got %v", first)
+	}
+
+	if _, ok := first["_HOSTNAME"]; ok {
+		t.Fatalf("expect no trusted fields. Got %v", first)
+	}
+
+	if _, ok := first["__CURSOR"]; ok {
+		t.Fatalf("expect no remote cursor. Got %v", first)
+	}
+
+	second := entries[1]
+	if second["DCOS_LOG_REMOTE_SYSLOG_IDENTIFIER"] != "app" || second["DCOS_LOG_REMOTE_UNIT"] != "dcos-mesos-master.service" ||
+		second["PRIORITY"] != "6" {
+		t.Fatalf("expect remote fields to be prefixed. Got %v", second)
+	}
+
+	for _, name := range []string{"SYSLOG_IDENTIFIER", "UNIT"} {
+		if _, ok := second[name]; ok {
+			t.Fatalf("expect no %s field. Got %v", name, second)
+		}
+	}
+
+	if second["DCOS_LOG_SOURCE"] != "journal-remote" || second["DCOS_LOG_REMOTE_ADDR"] != "192.0.2.1:1234" {
+		t.Fatalf("expect provenance fields not to be overwritten. Got %v", second)
+	}
+
+	resp = httptest.NewRecorder()
+	s.ServeHTTP(resp, httptest.NewRequest("POST", UploadPath, bytes.NewReader(exportEntries())))
+	if resp.Code != http.StatusNotAcceptable {
+		t.Fatalf("expect status 406 without content type. Got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	s.ServeHTTP(resp, httptest.NewRequest("GET", UploadPath, nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect status 405. Got %d", resp.Code)
+	}
+}
+
+// writeCertificate writes a self signed certificate for 127.0.0.1 and its key to dir, the certificate is used
+// by the server, as the client CA and by the client.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dcos-log"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "remote.crt"), filepath.Join(dir, "remote.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcos-log-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	received := make(chan string, 1)
+	s, err := NewServer("127.0.0.1:0", OptionSink(func(fields map[string]string, remoteAddr string) error {
+		received <- fields["MESSAGE"]
+		return nil
+	}), OptionTLS(certFile, keyFile, certFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(data)
+
+	post := func(tlsConfig *tls.Config) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		return client.Post("https://"+s.Addr().String()+UploadPath, ContentType, strings.NewReader("MESSAGE=hello\n\n"))
+	}
+
+	if _, err := post(&tls.Config{RootCAs: pool}); err == nil {
+		t.Fatal("expect an upload without a client certificate to be rejected")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := post(&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expect status 202. Got %d", resp.StatusCode)
+	}
+
+	if m := <-received; m != "hello" {
+		t.Fatalf("expect hello. Got %s", m)
+	}
+
+	if _, err := NewServer("127.0.0.1:0", OptionTLS(certFile, keyFile, keyFile)); err == nil {
+		t.Fatal("expect error for a client CA bundle without certificates")
+	}
+
+	cancel()
+	<-done
+}
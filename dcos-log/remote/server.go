@@ -0,0 +1,238 @@
+// Package remote implements a receiver of the systemd-journal-remote upload protocol. Other nodes push
+// their journals with systemd-journal-upload and the entries are written to the local journald, so they
+// are served by the same API as the local entries.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+	"github.com/dcos/dcos-log/dcos-log/journal/writer"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UploadPath is the path systemd-journal-upload sends the entries to.
+	UploadPath = "/upload"
+
+	// ContentType is the content type of the journal export format.
+	ContentType = "application/vnd.fdo.journal"
+
+	// fieldPrefix is a prefix of the fields of a remote entry, journald does not accept trusted fields from
+	// clients and the other fields must not pass for the fields of the local entries.
+	fieldPrefix = "DCOS_LOG_REMOTE_"
+)
+
+var entriesTotal = metrics.NewCounterVec("dcos_log_journal_remote_entries_total",
+	"Entries received by journal remote listener by processing status.", "status")
+
+// Sink processes the fields of an entry received from remoteAddr.
+type Sink func(fields map[string]string, remoteAddr string) error
+
+// JournalSink returns a Sink which writes entries to journald. The fields of an entry are stored with the
+// DCOS_LOG_REMOTE_ prefix, so a remote node cannot set UNIT, SYSLOG_IDENTIFIER or the other fields of the
+// local entries: _HOSTNAME as DCOS_LOG_REMOTE_HOSTNAME, SYSLOG_IDENTIFIER as DCOS_LOG_REMOTE_SYSLOG_IDENTIFIER
+// and the time of the entry on the remote node as DCOS_LOG_REMOTE_REALTIME_TIMESTAMP. DCOS_LOG_SOURCE and
+// DCOS_LOG_REMOTE_ADDR are set by the receiver.
+func JournalSink(w *writer.Writer) Sink {
+	return func(fields map[string]string, remoteAddr string) error {
+		// journald does not store entries without a message.
+		message := fields["MESSAGE"]
+		if message == "" {
+			return nil
+		}
+
+		priority := journal.PriInfo
+		if p, err := strconv.Atoi(fields["PRIORITY"]); err == nil && p >= int(journal.PriEmerg) && p <= int(journal.PriDebug) {
+			priority = journal.Priority(p)
+		}
+
+		vars := make(map[string]string, len(fields)+2)
+		for name, value := range fields {
+			switch {
+			case name == "MESSAGE" || name == "PRIORITY":
+			case name == "__REALTIME_TIMESTAMP":
+				vars[fieldPrefix+"REALTIME_TIMESTAMP"] = value
+			case strings.HasPrefix(name, "__"):
+				// the cursor and the monotonic timestamp are only valid in the remote journal.
+			case strings.HasPrefix(name, "_"):
+				vars[fieldPrefix+name[1:]] = value
+			default:
+				vars[fieldPrefix+name] = value
+			}
+		}
+
+		// the provenance fields are set last, the remote fields cannot overwrite them.
+		vars["DCOS_LOG_SOURCE"] = "journal-remote"
+		vars["DCOS_LOG_REMOTE_ADDR"] = remoteAddr
+		return w.Send(message, priority, vars)
+	}
+}
+
+// Option is a functional option that configures a Server.
+type Option func(*Server) error
+
+// OptionSink sets a sink for the received entries. Entries are written to journald by default.
+func OptionSink(sink Sink) Option {
+	return func(s *Server) error {
+		s.sink = sink
+		return nil
+	}
+}
+
+// OptionTLS serves the listener over TLS with a PEM certificate and key, and only accepts the uploads with a
+// client certificate signed by the PEM CA bundle clientCAFile.
+func OptionTLS(certFile, keyFile, clientCAFile string) Option {
+	return func(s *Server) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load certificate: %s", err)
+		}
+
+		data, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+
+		s.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		}
+		return nil
+	}
+}
+
+// Server receives the entries of systemd-journal-upload and passes them to a sink.
+type Server struct {
+	addr      string
+	sink      Sink
+	tlsConfig *tls.Config
+	listener  net.Listener
+}
+
+// NewServer returns a new instance of Server listening on a given address.
+func NewServer(addr string, opts ...Option) (*Server, error) {
+	s := &Server{addr: addr}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if s.sink == nil {
+		w, err := writer.NewWriter()
+		if err != nil {
+			return nil, err
+		}
+		s.sink = JournalSink(w)
+	}
+
+	return s, nil
+}
+
+// Listen opens the socket, the connections are served over TLS if the server has a TLS config.
+func (s *Server) Listen() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %s", s.addr, err)
+	}
+
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+	s.listener = l
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve receives the entries until the context is canceled. Listen must be called first.
+func (s *Server) Serve(ctx context.Context) {
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	if err := srv.Serve(s.listener); err != nil && ctx.Err() == nil {
+		logrus.Errorf("journal remote listener stopped: %s", err)
+	}
+}
+
+// ServeHTTP implements POST /upload of systemd-journal-remote. The entries are processed as they are
+// received, so a following systemd-journal-upload can keep the request open.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != UploadPath {
+		http.NotFound(w, req)
+		return
+	}
+
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || mediaType != ContentType {
+		http.Error(w, "Content-Type: "+ContentType+" is required.", http.StatusNotAcceptable)
+		return
+	}
+
+	d := NewDecoder(req.Body)
+	for {
+		fields, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			entriesTotal.WithLabelValues("invalid").Inc()
+			code := http.StatusBadRequest
+			if err == ErrEntryTooLarge {
+				code = http.StatusRequestEntityTooLarge
+			}
+			logrus.Debugf("invalid journal upload from %s: %s", req.RemoteAddr, err)
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		if err := s.sink(fields, req.RemoteAddr); err != nil {
+			entriesTotal.WithLabelValues("error").Inc()
+			code := http.StatusInternalServerError
+			if err == writer.ErrJournalDisabled {
+				code = http.StatusServiceUnavailable
+			}
+			logrus.Errorf("unable to process journal entry from %s: %s", req.RemoteAddr, err)
+			http.Error(w, err.Error(), code)
+			return
+		}
+		entriesTotal.WithLabelValues("ok").Inc()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "OK.\n")
+}
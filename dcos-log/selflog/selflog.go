@@ -0,0 +1,186 @@
+package selflog
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBufferSize = 1000
+
+	// subscriberBufferSize is a number of entries buffered for a slow subscriber before entries are dropped.
+	subscriberBufferSize = 100
+)
+
+// Default is a hook which keeps the recent log entries of dcos-log.
+var Default = NewHook(defaultBufferSize)
+
+// Entry is a single log entry of dcos-log service.
+type Entry struct {
+	ID      uint64                 `json:"id"`
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Text returns the entry as a single text line.
+func (e Entry) Text() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s [%s] %s", e.Time.Format("2006-01-02 15:04:05"), e.Level, e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(buf, " %s=%v", k, e.Fields[k])
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// Stats describes the state of the hook buffer.
+type Stats struct {
+	Size        int    `json:"size"`
+	Buffered    int    `json:"buffered"`
+	Total       uint64 `json:"total"`
+	Subscribers int    `json:"subscribers"`
+	Dropped     uint64 `json:"dropped"`
+}
+
+// Hook is a logrus hook which stores the last entries in a ring buffer and sends new entries
+// to subscribers.
+type Hook struct {
+	sync.Mutex
+	entries     []Entry
+	size        int
+	total       uint64
+	dropped     uint64
+	subscribers map[chan Entry]struct{}
+}
+
+// NewHook returns a new Hook which keeps up to size entries.
+func NewHook(size int) *Hook {
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	return &Hook{
+		entries:     make([]Entry, 0, size),
+		size:        size,
+		subscribers: make(map[chan Entry]struct{}),
+	}
+}
+
+// Levels implements logrus.Hook.
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. Fire never blocks, entries are dropped for subscribers which
+// do not keep up.
+func (h *Hook) Fire(e *logrus.Entry) error {
+	var fields map[string]interface{}
+	if len(e.Data) > 0 {
+		fields = make(map[string]interface{}, len(e.Data))
+		for k, v := range e.Data {
+			// errors are not json serializable.
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			fields[k] = v
+		}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.total++
+	entry := Entry{
+		ID:      h.total,
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+		Fields:  fields,
+	}
+
+	if len(h.entries) < h.size {
+		h.entries = append(h.entries, entry)
+	} else {
+		h.entries[int((h.total-1)%uint64(h.size))] = entry
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			h.dropped++
+		}
+	}
+	return nil
+}
+
+// Entries returns up to limit most recent entries with ID greater than afterID, oldest first.
+// Zero limit returns all buffered entries.
+func (h *Hook) Entries(afterID uint64, limit int) []Entry {
+	h.Lock()
+	defer h.Unlock()
+
+	ordered := make([]Entry, 0, len(h.entries))
+	if len(h.entries) < h.size {
+		ordered = append(ordered, h.entries...)
+	} else {
+		start := int(h.total % uint64(h.size))
+		ordered = append(ordered, h.entries[start:]...)
+		ordered = append(ordered, h.entries[:start]...)
+	}
+
+	result := ordered[:0]
+	for _, e := range ordered {
+		if e.ID > afterID {
+			result = append(result, e)
+		}
+	}
+
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// Subscribe returns a channel which receives new entries and a function to unsubscribe.
+func (h *Hook) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, subscriberBufferSize)
+
+	h.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.Unlock()
+
+	return ch, func() {
+		h.Lock()
+		delete(h.subscribers, ch)
+		h.Unlock()
+	}
+}
+
+// Stats returns the current state of the hook.
+func (h *Hook) Stats() Stats {
+	h.Lock()
+	defer h.Unlock()
+
+	return Stats{
+		Size:        h.size,
+		Buffered:    len(h.entries),
+		Total:       h.total,
+		Subscribers: len(h.subscribers),
+		Dropped:     h.dropped,
+	}
+}
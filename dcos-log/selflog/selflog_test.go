@@ -0,0 +1,81 @@
+package selflog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func fire(t *testing.T, h *Hook, msg string, fields logrus.Fields) {
+	entry := logrus.NewEntry(logrus.New()).WithFields(fields)
+	entry.Message = msg
+	entry.Level = logrus.InfoLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHookRingBuffer(t *testing.T) {
+	h := NewHook(3)
+	for i := 1; i <= 5; i++ {
+		fire(t, h, fmt.Sprintf("entry %d", i), nil)
+	}
+
+	entries := h.Entries(0, 0)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries. Got %d", len(entries))
+	}
+
+	for i, e := range entries {
+		expected := fmt.Sprintf("entry %d", i+3)
+		if e.Message != expected {
+			t.Fatalf("expect %s. Got %s", expected, e.Message)
+		}
+	}
+
+	if entries := h.Entries(4, 0); len(entries) != 1 || entries[0].ID != 5 {
+		t.Fatalf("expect a single entry after ID 4. Got %v", entries)
+	}
+
+	if entries := h.Entries(0, 2); len(entries) != 2 || entries[0].ID != 4 {
+		t.Fatalf("expect 2 most recent entries. Got %v", entries)
+	}
+
+	stats := h.Stats()
+	if stats.Total != 5 || stats.Buffered != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHookSubscribe(t *testing.T) {
+	h := NewHook(10)
+	entries, unsubscribe := h.Subscribe()
+
+	fire(t, h, "hello", logrus.Fields{"error": errors.New("boom")})
+	e := <-entries
+	if e.Message != "hello" {
+		t.Fatalf("expect hello. Got %s", e.Message)
+	}
+
+	if e.Fields["error"] != "boom" {
+		t.Fatalf("expect error field to be a string. Got %v", e.Fields["error"])
+	}
+
+	unsubscribe()
+	if h.Stats().Subscribers != 0 {
+		t.Fatal("expect no subscribers")
+	}
+
+	// slow subscribers must not block the logger.
+	_, unsubscribe = h.Subscribe()
+	defer unsubscribe()
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		fire(t, h, "flood", nil)
+	}
+
+	if h.Stats().Dropped != 1 {
+		t.Fatalf("expect 1 dropped entry. Got %d", h.Stats().Dropped)
+	}
+}
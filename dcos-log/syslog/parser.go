@@ -0,0 +1,218 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// message formats
+const (
+	FormatRFC3164 = "rfc3164"
+	FormatRFC5424 = "rfc5424"
+)
+
+const nilValue = "-"
+
+var (
+	// ErrInvalidPriority is returned by Parse if a message does not start with a valid <PRI> part.
+	ErrInvalidPriority = errors.New("invalid syslog priority")
+
+	// ErrInvalidStructuredData is returned by Parse if RFC5424 structured data is malformed.
+	ErrInvalidStructuredData = errors.New("invalid syslog structured data")
+)
+
+// Message is a parsed syslog message.
+type Message struct {
+	Format    string
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+
+	// StructuredData contains RFC5424 structured data params flattened to <sd-id>.<param> keys.
+	StructuredData map[string]string
+	Message        string
+}
+
+// Parse parses an RFC5424 or RFC3164 message. RFC3164 parsing is lenient, the header fields which
+// cannot be parsed are left empty and the rest of the line is used as a message.
+func Parse(b []byte, now time.Time) (*Message, error) {
+	line := strings.TrimRight(string(b), "\r\n\x00")
+	if len(line) < 3 || line[0] != '<' {
+		return nil, ErrInvalidPriority
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return nil, ErrInvalidPriority
+	}
+
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, ErrInvalidPriority
+	}
+
+	m := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+
+	rest := line[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		return m, parseRFC5424(m, rest[2:])
+	}
+
+	parseRFC3164(m, rest, now)
+	return m, nil
+}
+
+// nextField returns the next space separated field and the rest of the string.
+func nextField(s string) (string, string) {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func nilToEmpty(s string) string {
+	if s == nilValue {
+		return ""
+	}
+	return s
+}
+
+func parseRFC5424(m *Message, s string) error {
+	m.Format = FormatRFC5424
+
+	var timestamp string
+	timestamp, s = nextField(s)
+	if timestamp != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return err
+		}
+		m.Timestamp = t
+	}
+
+	var field string
+	field, s = nextField(s)
+	m.Hostname = nilToEmpty(field)
+
+	field, s = nextField(s)
+	m.AppName = nilToEmpty(field)
+
+	field, s = nextField(s)
+	m.ProcID = nilToEmpty(field)
+
+	field, s = nextField(s)
+	m.MsgID = nilToEmpty(field)
+
+	if strings.HasPrefix(s, nilValue) {
+		s = strings.TrimPrefix(s[1:], " ")
+	} else if strings.HasPrefix(s, "[") {
+		var err error
+		m.StructuredData, s, err = parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	// strip UTF-8 BOM
+	m.Message = strings.TrimPrefix(s, "\ufeff")
+	return nil
+}
+
+// parseStructuredData parses one or more [id param="value" ...] elements.
+func parseStructuredData(s string) (map[string]string, string, error) {
+	sd := make(map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		var id string
+		i := strings.IndexAny(s, " ]")
+		if i < 0 {
+			return nil, "", ErrInvalidStructuredData
+		}
+		id, s = s[:i], s[i:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+				return nil, "", ErrInvalidStructuredData
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			value := &bytes.Buffer{}
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+
+			if !closed {
+				return nil, "", ErrInvalidStructuredData
+			}
+			sd[id+"."+name] = value.String()
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", ErrInvalidStructuredData
+		}
+		s = s[1:]
+	}
+
+	return sd, strings.TrimPrefix(s, " "), nil
+}
+
+func parseRFC3164(m *Message, s string, now time.Time) {
+	m.Format = FormatRFC3164
+
+	// timestamp "Mmm dd hh:mm:ss", the day is space padded.
+	const stampLen = len(time.Stamp)
+	if len(s) >= stampLen {
+		if t, err := time.ParseInLocation(time.Stamp, s[:stampLen], now.Location()); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+
+			// messages from december received in january belong to the previous year.
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = t
+			s = strings.TrimPrefix(s[stampLen:], " ")
+
+			m.Hostname, s = nextField(s)
+		}
+	}
+
+	// TAG[pid]: message
+	if i := strings.IndexByte(s, ':'); i > 0 && !strings.ContainsAny(s[:i], " ") {
+		tag := s[:i]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			m.ProcID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		m.AppName = tag
+		s = strings.TrimPrefix(s[i+1:], " ")
+	}
+
+	m.Message = s
+}
@@ -0,0 +1,371 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-log/dcos-log/journal/writer"
+	"github.com/dcos/dcos-log/dcos-log/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxMessageSize is the maximum size of a single syslog message.
+	maxMessageSize = 64 * 1024
+
+	// maxLengthDigits is the maximum number of digits of the octet counting frame length, maxMessageSize has 5.
+	maxLengthDigits = 5
+
+	tcpIdleTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrNoListeners is returned by NewServer if neither UDP nor TCP address is set.
+	ErrNoListeners = errors.New("at least one of UDP or TCP address must be set")
+
+	// ErrMessageTooLarge is returned by a TCP frame reader if a message exceeds 64KB.
+	ErrMessageTooLarge = errors.New("syslog message too large")
+)
+
+var messagesTotal = metrics.NewCounterVec("dcos_log_syslog_messages_total",
+	"Syslog messages received by transport and processing status.", "transport", "status")
+
+// Sink processes a parsed message received from remoteAddr.
+type Sink func(m *Message, remoteAddr string) error
+
+// JournalSink returns a Sink which writes messages to journald. The header fields of a message are
+// stored in DCOS_LOG_SYSLOG_* fields and structured data params in the writer namespace.
+func JournalSink(w *writer.Writer) Sink {
+	return func(m *Message, remoteAddr string) error {
+		// journald does not store entries without a message.
+		if m.Message == "" {
+			return nil
+		}
+
+		identifier := m.AppName
+		if identifier == "" {
+			identifier = "syslog"
+		}
+
+		severity := m.Severity
+		event := writer.Event{
+			Message:    m.Message,
+			Priority:   &severity,
+			Identifier: identifier,
+			Fields:     m.StructuredData,
+		}
+
+		extra := map[string]string{
+			"DCOS_LOG_SOURCE":          "syslog",
+			"DCOS_LOG_REMOTE_ADDR":     remoteAddr,
+			"DCOS_LOG_SYSLOG_FORMAT":   m.Format,
+			"SYSLOG_FACILITY":          strconv.Itoa(m.Facility),
+			"DCOS_LOG_SYSLOG_HOSTNAME": m.Hostname,
+		}
+
+		if m.ProcID != "" {
+			extra["SYSLOG_PID"] = m.ProcID
+		}
+
+		if m.MsgID != "" {
+			extra["DCOS_LOG_SYSLOG_MSGID"] = m.MsgID
+		}
+
+		if !m.Timestamp.IsZero() {
+			extra["SYSLOG_TIMESTAMP"] = m.Timestamp.Format(time.RFC3339Nano)
+		}
+
+		return w.Write(extra, event)
+	}
+}
+
+// Option is a functional option that configures a Server.
+type Option func(*Server) error
+
+// OptionUDP sets an address to receive syslog messages over UDP, one message per datagram.
+func OptionUDP(addr string) Option {
+	return func(s *Server) error {
+		s.udpAddr = addr
+		return nil
+	}
+}
+
+// OptionTCP sets an address to receive syslog messages over TCP. Both octet counting and
+// newline delimited framing (RFC6587) are supported.
+func OptionTCP(addr string) Option {
+	return func(s *Server) error {
+		s.tcpAddr = addr
+		return nil
+	}
+}
+
+// OptionSink sets a sink for the received messages. Messages are written to journald by default.
+func OptionSink(sink Sink) Option {
+	return func(s *Server) error {
+		s.sink = sink
+		return nil
+	}
+}
+
+// Server receives syslog messages from the network and passes them to a sink.
+type Server struct {
+	udpAddr string
+	tcpAddr string
+	sink    Sink
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	wg          sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewServer returns a new instance of Server.
+func NewServer(opts ...Option) (*Server, error) {
+	s := &Server{conns: make(map[net.Conn]struct{})}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if s.udpAddr == "" && s.tcpAddr == "" {
+		return nil, ErrNoListeners
+	}
+
+	if s.sink == nil {
+		w, err := writer.NewWriter()
+		if err != nil {
+			return nil, err
+		}
+		s.sink = JournalSink(w)
+	}
+
+	return s, nil
+}
+
+// Listen opens the configured sockets.
+func (s *Server) Listen() error {
+	if s.udpAddr != "" {
+		conn, err := net.ListenPacket("udp", s.udpAddr)
+		if err != nil {
+			return fmt.Errorf("unable to listen on udp %s: %s", s.udpAddr, err)
+		}
+		s.udpConn = conn
+	}
+
+	if s.tcpAddr != "" {
+		l, err := net.Listen("tcp", s.tcpAddr)
+		if err != nil {
+			if s.udpConn != nil {
+				s.udpConn.Close()
+			}
+			return fmt.Errorf("unable to listen on tcp %s: %s", s.tcpAddr, err)
+		}
+		s.tcpListener = l
+	}
+
+	return nil
+}
+
+// Serve receives the messages until the context is canceled. Listen must be called first.
+func (s *Server) Serve(ctx context.Context) {
+	if s.udpConn != nil {
+		s.wg.Add(1)
+		go s.serveUDP()
+	}
+
+	if s.tcpListener != nil {
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+
+	<-ctx.Done()
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Addrs returns the addresses the server listens on.
+func (s *Server) Addrs() (udp, tcp net.Addr) {
+	if s.udpConn != nil {
+		udp = s.udpConn.LocalAddr()
+	}
+
+	if s.tcpListener != nil {
+		tcp = s.tcpListener.Addr()
+	}
+	return udp, tcp
+}
+
+func (s *Server) handle(transport string, b []byte, remoteAddr string) {
+	m, err := Parse(b, time.Now())
+	if err != nil {
+		messagesTotal.WithLabelValues(transport, "invalid").Inc()
+		logrus.Debugf("invalid syslog message from %s: %s", remoteAddr, err)
+		return
+	}
+
+	if err := s.sink(m, remoteAddr); err != nil {
+		messagesTotal.WithLabelValues(transport, "error").Inc()
+		logrus.Errorf("unable to process syslog message from %s: %s", remoteAddr, err)
+		return
+	}
+
+	messagesTotal.WithLabelValues(transport, "ok").Inc()
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		s.handle("udp", buf[:n], addr.String())
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		frame, err := readFrame(r)
+		if len(frame) > 0 {
+			s.handle("tcp", frame, conn.RemoteAddr().String())
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				logrus.Debugf("closing syslog connection from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame reads a single message using octet counting "<length> <message>" framing if a frame
+// starts with a digit, otherwise the message is terminated by a new line.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		length, err := readFrameLength(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if length > maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+
+		frame := make([]byte, length)
+		_, err = io.ReadFull(r, frame)
+		return frame, err
+	}
+
+	var frame []byte
+	for {
+		line, isPrefix, err := r.ReadLine()
+		frame = append(frame, line...)
+		if len(frame) > maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+
+		if err != nil || !isPrefix {
+			return frame, err
+		}
+	}
+}
+
+// readFrameLength reads the "<length> " prefix of an octet counting frame. A prefix longer than maxLengthDigits is
+// rejected, a peer which never sends the space cannot make the reader buffer grow.
+func readFrameLength(r *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if b == ' ' {
+			break
+		}
+
+		if b < '0' || b > '9' || len(digits) == maxLengthDigits {
+			return 0, fmt.Errorf("invalid frame length %q", append(digits, b))
+		}
+		digits = append(digits, b)
+	}
+
+	length, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return 0, fmt.Errorf("invalid frame length %q", digits)
+	}
+	return length, nil
+}
@@ -0,0 +1,179 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRFC5424(t *testing.T) {
+	line := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication"] An application event`
+	m, err := Parse([]byte(line), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Format != FormatRFC5424 || m.Facility != 20 || m.Severity != 5 {
+		t.Fatalf("unexpected header %+v", m)
+	}
+
+	if m.Hostname != "mymachine.example.com" || m.AppName != "evntslog" || m.ProcID != "1234" || m.MsgID != "ID47" {
+		t.Fatalf("unexpected header fields %+v", m)
+	}
+
+	if m.StructuredData["exampleSDID@32473.eventSource"] != `App"lication` || m.StructuredData["exampleSDID@32473.iut"] != "3" {
+		t.Fatalf("unexpected structured data %v", m.StructuredData)
+	}
+
+	if m.Message != "An application event" {
+		t.Fatalf("expect message. Got %q", m.Message)
+	}
+
+	if m.Timestamp.Year() != 2003 {
+		t.Fatalf("unexpected timestamp %s", m.Timestamp)
+	}
+}
+
+func TestParseRFC5424NilValues(t *testing.T) {
+	m, err := Parse([]byte("<13>1 - - - - - - message"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Hostname != "" || m.AppName != "" || m.StructuredData != nil || m.Message != "message" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	now := time.Date(2017, time.January, 2, 0, 0, 0, 0, time.UTC)
+	m, err := Parse([]byte("<34>Dec 31 22:14:15 mymachine su[42]: 'su root' failed\n"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Format != FormatRFC3164 || m.Facility != 4 || m.Severity != 2 {
+		t.Fatalf("unexpected header %+v", m)
+	}
+
+	if m.Hostname != "mymachine" || m.AppName != "su" || m.ProcID != "42" {
+		t.Fatalf("unexpected header fields %+v", m)
+	}
+
+	if m.Message != "'su root' failed" {
+		t.Fatalf("expect message. Got %q", m.Message)
+	}
+
+	// december message received in january belongs to the previous year.
+	if m.Timestamp.Year() != 2016 {
+		t.Fatalf("expect year 2016. Got %s", m.Timestamp)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{"", "no priority", "<abc>message", "<192>message"} {
+		if _, err := Parse([]byte(line), time.Now()); err != ErrInvalidPriority {
+			t.Fatalf("expect ErrInvalidPriority for %q. Got %v", line, err)
+		}
+	}
+
+	if _, err := Parse([]byte(`<13>1 - - - - - [id key="value] message`), time.Now()); err != ErrInvalidStructuredData {
+		t.Fatalf("expect ErrInvalidStructuredData. Got %v", err)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("10 <13>first\n<13>second\n<13>third"))
+	for _, expected := range []string{"<13>first\n", "<13>second", "<13>third"} {
+		frame, err := readFrame(r)
+		if string(frame) != expected {
+			t.Fatalf("expect %q. Got %q (%v)", expected, frame, err)
+		}
+	}
+
+	// the length prefix is at most 5 digits, the reader does not wait for a space forever.
+	r = bufio.NewReader(strings.NewReader(strings.Repeat("1", 1<<20)))
+	if _, err := readFrame(r); err == nil || !strings.Contains(err.Error(), "invalid frame length") {
+		t.Fatalf("expect an invalid frame length error. Got %v", err)
+	}
+
+	if _, err := readFrame(bufio.NewReader(strings.NewReader("99999 <13>x"))); err != ErrMessageTooLarge {
+		t.Fatalf("expect ErrMessageTooLarge. Got %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		messages []string
+		received = make(chan struct{}, 10)
+	)
+
+	sink := func(m *Message, remoteAddr string) error {
+		mu.Lock()
+		messages = append(messages, m.Message)
+		mu.Unlock()
+		received <- struct{}{}
+		return nil
+	}
+
+	s, err := NewServer(OptionUDP("127.0.0.1:0"), OptionTCP("127.0.0.1:0"), OptionSink(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+
+	udpAddr, tcpAddr := s.Addrs()
+	udp, err := net.Dial("udp", udpAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<13>1 - host app - - - over udp")
+
+	tcp, err := net.Dial("tcp", tcpAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(tcp, "<13>app: over tcp\n")
+	tcp.Close()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Join(messages, ",")
+	if !strings.Contains(got, "over udp") || !strings.Contains(got, "over tcp") {
+		t.Fatalf("expect udp and tcp messages. Got %v", messages)
+	}
+}
+
+func TestNewServerNoListeners(t *testing.T) {
+	if _, err := NewServer(); err != ErrNoListeners {
+		t.Fatalf("expect ErrNoListeners. Got %v", err)
+	}
+}
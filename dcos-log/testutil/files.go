@@ -0,0 +1,264 @@
+// Package testutil provides in-process fakes for tests of the packages which read logs: a fake of the Mesos
+// agent files API, a fake journal and journal fixtures. No DC/OS cluster or journald is needed.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxReadLength is the maximum number of bytes returned by /files/read, Mesos caps a read at 16 pages.
+const MaxReadLength = 16 * 4096
+
+// SandboxPath returns the sandbox path of a container, the same path mesos/files/reader requests.
+func SandboxPath(agentID, frameworkID, executorID, containerID, taskPath string) string {
+	p := path.Join("/var/lib/mesos/slave/slaves", agentID, "frameworks", frameworkID, "executors", executorID,
+		"runs", containerID)
+	if taskPath != "" {
+		p = path.Join(p, "tasks", taskPath)
+	}
+	return p
+}
+
+type fakeFile struct {
+	data  []byte
+	mtime time.Time
+}
+
+// FakeFiles is a fake of Mesos agent files API. It serves /files/read, /files/browse and /files/download
+// for the files written with Write and Append, the requests of other paths get 404.
+//
+//	fake := testutil.NewFakeFiles()
+//	fake.Write(testutil.SandboxPath("agent", "framework", "executor", "container", "")+"/stdout", data)
+//	ts := httptest.NewServer(fake)
+type FakeFiles struct {
+	mu    sync.Mutex
+	files map[string]*fakeFile
+
+	// Requests counts the requests per endpoint, for instance Requests["/files/read"].
+	Requests map[string]int
+}
+
+// NewFakeFiles returns a new instance of FakeFiles.
+func NewFakeFiles() *FakeFiles {
+	return &FakeFiles{files: make(map[string]*fakeFile), Requests: make(map[string]int)}
+}
+
+// Write creates or replaces a file.
+func (f *FakeFiles) Write(file string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files[path.Clean(file)] = &fakeFile{data: append([]byte(nil), data...), mtime: time.Now()}
+}
+
+// Append appends data to a file, the file is created if it does not exist.
+func (f *FakeFiles) Append(file string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file = path.Clean(file)
+	ff, ok := f.files[file]
+	if !ok {
+		ff = &fakeFile{}
+		f.files[file] = ff
+	}
+	ff.data = append(ff.data, data...)
+	ff.mtime = time.Now()
+}
+
+// Remove removes a file.
+func (f *FakeFiles) Remove(file string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.files, path.Clean(file))
+}
+
+// Rotate rotates a file the way Mesos log rotation does: file.N-1 is renamed to file.N, ..., file to file.1
+// and an empty file is created. At most keep rotated files are kept.
+func (f *FakeFiles) Rotate(file string, keep int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file = path.Clean(file)
+	generation := func(n int) string {
+		if n == 0 {
+			return file
+		}
+		return file + "." + strconv.Itoa(n)
+	}
+
+	delete(f.files, generation(keep))
+	for n := keep - 1; n >= 0; n-- {
+		if ff, ok := f.files[generation(n)]; ok {
+			f.files[generation(n+1)] = ff
+		}
+	}
+	f.files[file] = &fakeFile{mtime: time.Now()}
+}
+
+// ServeHTTP implements http.Handler.
+func (f *FakeFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoint := r.URL.Path
+	if i := strings.Index(endpoint, "/files/"); i >= 0 {
+		endpoint = endpoint[i:]
+	}
+	f.Requests[endpoint]++
+
+	switch endpoint {
+	case "/files/read", "/files/read.json":
+		f.read(w, r)
+	case "/files/browse", "/files/browse.json":
+		f.browse(w, r)
+	case "/files/download", "/files/download.json":
+		f.download(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// read implements /files/read. offset=-1 returns the size of the file in offset, a read past the end of the
+// file returns no data.
+func (f *FakeFiles) read(w http.ResponseWriter, r *http.Request) {
+	ff, ok := f.files[path.Clean(r.URL.Query().Get("path"))]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	offset, err := intParam(r, "offset", 0)
+	if err != nil || offset < -1 {
+		http.Error(w, "Failed to parse offset", http.StatusBadRequest)
+		return
+	}
+
+	length, err := intParam(r, "length", MaxReadLength)
+	if err != nil || length < 0 {
+		http.Error(w, "Failed to parse length", http.StatusBadRequest)
+		return
+	}
+
+	if length > MaxReadLength {
+		length = MaxReadLength
+	}
+
+	size := len(ff.data)
+	var data []byte
+	switch {
+	case offset == -1 || offset >= size:
+		offset = size
+	case offset+length > size:
+		data = ff.data[offset:]
+	default:
+		data = ff.data[offset : offset+length]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"data":%s,"offset":%d}`, quoteRaw(data), offset)
+}
+
+// browse implements /files/browse, the files and directories directly in the path are listed.
+func (f *FakeFiles) browse(w http.ResponseWriter, r *http.Request) {
+	dir := path.Clean(r.URL.Query().Get("path"))
+
+	type entry struct {
+		GID   string `json:"gid"`
+		Mode  string `json:"mode"`
+		MTime int64  `json:"mtime"`
+		NLink uint   `json:"nlink"`
+		Path  string `json:"path"`
+		Size  int    `json:"size"`
+		UID   string `json:"uid"`
+	}
+
+	found := false
+	seen := make(map[string]bool)
+	entries := []entry{}
+	for name, ff := range f.files {
+		if !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+		found = true
+
+		rel := strings.TrimPrefix(name, dir+"/")
+		if i := strings.Index(rel, "/"); i >= 0 {
+			sub := path.Join(dir, rel[:i])
+			if !seen[sub] {
+				seen[sub] = true
+				entries = append(entries, entry{GID: "root", Mode: "drwxr-xr-x", MTime: ff.mtime.Unix(), NLink: 2, Path: sub, Size: 4096, UID: "root"})
+			}
+			continue
+		}
+
+		entries = append(entries, entry{GID: "root", Mode: "-rw-r--r--", MTime: ff.mtime.Unix(), NLink: 1, Path: name, Size: len(ff.data), UID: "root"})
+	}
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// download implements /files/download, the content of the file is sent as is.
+func (f *FakeFiles) download(w http.ResponseWriter, r *http.Request) {
+	file := path.Clean(r.URL.Query().Get("path"))
+	ff, ok := f.files[file]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename="+path.Base(file))
+	w.Header().Set("Content-Length", strconv.Itoa(len(ff.data)))
+	w.Write(ff.data)
+}
+
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// quoteRaw returns a JSON string of the data, the bytes which are not valid UTF-8 are sent as is, as Mesos does.
+func quoteRaw(data []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+2))
+	buf.WriteByte('"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c < 0x20:
+			fmt.Fprintf(buf, `\u%04x`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.Bytes()
+}
@@ -0,0 +1,263 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/remote"
+)
+
+// FixtureTime is the realtime timestamp in microseconds of the first entry of JournalFixture.
+const FixtureTime = 1500000000000000
+
+// JournalFixture returns n entries of a unit, the same for every call. The i-th entry, from 0, has the cursor
+// s=fixture;i=<i+1 in hex>, the realtime timestamp FixtureTime + i seconds and the message "<unit> entry <i>".
+func JournalFixture(unit string, n int) []*sdjournal.JournalEntry {
+	entries := make([]*sdjournal.JournalEntry, n)
+	for i := range entries {
+		entries[i] = &sdjournal.JournalEntry{
+			Cursor:             fmt.Sprintf("s=fixture;i=%x", i+1),
+			RealtimeTimestamp:  FixtureTime + uint64(i)*uint64(time.Second/time.Microsecond),
+			MonotonicTimestamp: uint64(i+1) * uint64(time.Second/time.Microsecond),
+			Fields: map[string]string{
+				"MESSAGE":           fmt.Sprintf("%s entry %d", unit, i),
+				"PRIORITY":          "6",
+				"SYSLOG_IDENTIFIER": strings.TrimSuffix(unit, ".service"),
+				"_SYSTEMD_UNIT":     unit,
+			},
+		}
+	}
+	return entries
+}
+
+// FakeJournal is an in-memory journal which formats its entries with a formatter of the journal reader, like
+// reader.Reader, and implements reader.EntryReader. Read returns the entries not read yet and io.EOF at the end,
+// Follow waits for the entries added with Append.
+//
+//	j := testutil.NewFakeJournal(reader.FormatSSE{}, testutil.JournalFixture("dcos-log.service", 3)...)
+//	err := j.Follow(100*time.Millisecond, w)
+type FakeJournal struct {
+	formatter jr.EntryFormatter
+
+	mu       sync.Mutex
+	entries  []*sdjournal.JournalEntry
+	next     int
+	appended chan struct{}
+
+	buf bytes.Buffer
+}
+
+// NewFakeJournal returns a journal of the entries formatted by formatter.
+func NewFakeJournal(formatter jr.EntryFormatter, entries ...*sdjournal.JournalEntry) *FakeJournal {
+	return &FakeJournal{formatter: formatter, entries: entries, appended: make(chan struct{})}
+}
+
+// Append adds entries at the end of the journal and wakes up Follow.
+func (j *FakeJournal) Append(entries ...*sdjournal.JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, entries...)
+	close(j.appended)
+	j.appended = make(chan struct{})
+}
+
+// Read implements io.Reader.
+func (j *FakeJournal) Read(b []byte) (int, error) {
+	for j.buf.Len() == 0 {
+		j.mu.Lock()
+		if j.next >= len(j.entries) {
+			j.mu.Unlock()
+			return 0, io.EOF
+		}
+		entry := j.entries[j.next]
+		j.next++
+		j.mu.Unlock()
+
+		data, err := j.formatter.FormatEntry(entry)
+		if err != nil {
+			return 0, err
+		}
+		j.buf.Write(data)
+	}
+	return j.buf.Read(b)
+}
+
+// Close implements io.Closer, the entries can still be read.
+func (j *FakeJournal) Close() error {
+	return nil
+}
+
+// Rotated returns false, the entries of a FakeJournal are never lost.
+func (j *FakeJournal) Rotated() bool {
+	return false
+}
+
+// Follow writes the entries not read yet to writer. If there are none, it waits up to wait for new entries and
+// returns, like reader.Reader.Follow, the new entries are written by the next call.
+func (j *FakeJournal) Follow(wait time.Duration, writer io.Writer) error {
+	j.mu.Lock()
+	appended := j.appended
+	j.mu.Unlock()
+
+	n, err := io.Copy(writer, j)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	select {
+	case <-appended:
+	case <-time.After(wait):
+	}
+	return nil
+}
+
+// LoadJournal reads journal entries from a fixture. The fixture is the output of `journalctl -o export` or
+// `journalctl -o json`, the format is detected by the first byte. __CURSOR, __REALTIME_TIMESTAMP and
+// __MONOTONIC_TIMESTAMP set the fields of the entry struct, the fields starting with __ are not added to
+// Fields, as sdjournal does.
+func LoadJournal(r io.Reader) ([]*sdjournal.JournalEntry, error) {
+	br := bufio.NewReader(r)
+	first, err := firstByte(br)
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*sdjournal.JournalEntry
+	if first == '{' {
+		decoder := json.NewDecoder(br)
+		for {
+			fields := make(map[string]interface{})
+			if err := decoder.Decode(&fields); err == io.EOF {
+				return entries, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("entry %d: %s", len(entries), err)
+			}
+
+			entry, err := newJournalEntry(jsonFields(fields))
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %s", len(entries), err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	decoder := remote.NewDecoder(br)
+	for {
+		fields, err := decoder.Decode()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", len(entries), err)
+		}
+
+		entry, err := newJournalEntry(fields)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", len(entries), err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// LoadJournalFile reads journal entries from a fixture file, see LoadJournal.
+func LoadJournalFile(name string) ([]*sdjournal.JournalEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadJournal(f)
+}
+
+func firstByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		r.ReadByte()
+	}
+}
+
+// jsonFields converts the values of `journalctl -o json` to strings. Binary values are arrays of bytes,
+// fields which occur more than once are arrays of values, the last value is used.
+func jsonFields(fields map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			result[name] = v
+		case []interface{}:
+			result[name] = jsonArray(v)
+		case nil:
+		default:
+			result[name] = fmt.Sprint(v)
+		}
+	}
+	return result
+}
+
+func jsonArray(values []interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	data := make([]byte, 0, len(values))
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			data = append(data, byte(v))
+		case string:
+			return values[len(values)-1].(string)
+		case []interface{}:
+			return jsonArray(values[len(values)-1].([]interface{}))
+		}
+	}
+	return string(data)
+}
+
+func newJournalEntry(fields map[string]string) (*sdjournal.JournalEntry, error) {
+	entry := &sdjournal.JournalEntry{Fields: make(map[string]string, len(fields))}
+	for name, value := range fields {
+		var err error
+		switch name {
+		case sdjournal.SD_JOURNAL_FIELD_CURSOR:
+			entry.Cursor = value
+		case sdjournal.SD_JOURNAL_FIELD_REALTIME_TIMESTAMP:
+			entry.RealtimeTimestamp, err = strconv.ParseUint(value, 10, 64)
+		case sdjournal.SD_JOURNAL_FIELD_MONOTONIC_TIMESTAMP:
+			entry.MonotonicTimestamp, err = strconv.ParseUint(value, 10, 64)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", name, err)
+		}
+
+		// sdjournal does not return the address fields.
+		if !strings.HasPrefix(name, "__") {
+			entry.Fields[name] = value
+		}
+	}
+	return entry, nil
+}
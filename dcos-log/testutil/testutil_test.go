@@ -0,0 +1,387 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jr "github.com/dcos/dcos-log/dcos-log/journal/reader"
+	"github.com/dcos/dcos-log/dcos-log/mesos/files/reader"
+)
+
+func newReader(t *testing.T, ts *httptest.Server, endpoint string, opts ...reader.Option) *reader.ReadManager {
+	u, err := url.Parse(ts.URL + endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NewLineReader(http.DefaultClient, *u, "agent", "framework", "executor", "container", "",
+		"stdout", reader.LineFormat, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestFakeFilesRead(t *testing.T) {
+	fake := NewFakeFiles()
+	stdout := SandboxPath("agent", "framework", "executor", "container", "") + "/stdout"
+	fake.Write(stdout, []byte("one\ntwo\n"))
+	fake.Append(stdout, []byte("three \"\x01\"\n"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	buf, err := ioutil.ReadAll(newReader(t, ts, "/files/read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "one\ntwo\nthree \"\x01\"\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptReadFromEnd(), reader.OptSkip(-1),
+		reader.OptReadDirection(reader.BottomToTop)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "three \"\x01\"\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	if fake.Requests["/files/read"] == 0 {
+		t.Fatal("expect requests to /files/read")
+	}
+
+	fake.Remove(stdout)
+	if _, err := ioutil.ReadAll(newReader(t, ts, "/files/read")); err != reader.ErrFileNotFound {
+		t.Fatalf("expect ErrFileNotFound. Got %v", err)
+	}
+}
+
+func TestFakeFilesReadLength(t *testing.T) {
+	fake := NewFakeFiles()
+	fake.Write("/sandbox/stdout", []byte("0123456789"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	for query, expect := range map[string]string{
+		"offset=2&length=3": `{"data":"234","offset":2}`,
+		"offset=8&length=5": `{"data":"89","offset":8}`,
+		"offset=20":         `{"data":"","offset":10}`,
+		"offset=-1":         `{"data":"","offset":10}`,
+	} {
+		resp, err := http.Get(ts.URL + "/files/read?path=/sandbox/stdout&" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != expect {
+			t.Fatalf("%s: expect %s. Got %s", query, expect, body)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/files/read?path=/sandbox/stdout&length=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect status 400. Got %d", resp.StatusCode)
+	}
+}
+
+func TestFakeFilesRotate(t *testing.T) {
+	fake := NewFakeFiles()
+	stdout := SandboxPath("agent", "framework", "executor", "container", "") + "/stdout"
+	fake.Write(stdout, []byte("one\ntwo\nthree\n"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL + "/files/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NewLineReader(http.DefaultClient, *u, "agent", "framework", "executor", "container", "",
+		"stdout", reader.SSEFormat, reader.OptStableCursors(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		}
+	}
+
+	if len(ids) != 3 {
+		t.Fatalf("expect 3 ids. Got %s", buf)
+	}
+
+	cursor, err := reader.ParseCursor(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Rotate(stdout, 1)
+	fake.Append(stdout, []byte("four\n"))
+
+	// the cursor follows the content to stdout.1.
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptCursor(cursor)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "three\n"; !strings.HasPrefix(string(buf), expect) {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptFile("stdout.1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "one\ntwo\nthree\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	// only one rotated file is kept.
+	fake.Rotate(stdout, 1)
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptFile("stdout.1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "four\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	if _, err := ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptFile("stdout.2"))); err != reader.ErrFileNotFound {
+		t.Fatalf("expect ErrFileNotFound. Got %v", err)
+	}
+}
+
+func TestFakeFilesRotations(t *testing.T) {
+	fake := NewFakeFiles()
+	stdout := SandboxPath("agent", "framework", "executor", "container", "") + "/stdout"
+
+	gz := &bytes.Buffer{}
+	w := gzip.NewWriter(gz)
+	w.Write([]byte("one\ntwo\n"))
+	w.Close()
+
+	fake.Write(stdout+".2.gz", gz.Bytes())
+	fake.Write(stdout+".1", []byte("three\nfour\n"))
+	fake.Write(stdout, []byte("five\n"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	buf, err := ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptRotations(true),
+		reader.OptReadDirection(reader.BottomToTop), reader.OptReadFromEnd(), reader.OptSkip(-4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "two\nthree\nfour\nfive\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	// the rotated files are only read if the lines are before the beginning of the file.
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptRotations(true),
+		reader.OptReadDirection(reader.BottomToTop), reader.OptReadFromEnd(), reader.OptSkip(-1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "five\n"; string(buf) != expect {
+		t.Fatalf("expect %q. Got %q", expect, buf)
+	}
+
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptReadDirection(reader.BottomToTop),
+		reader.OptReadFromEnd(), reader.OptSkip(-4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "five\n"; string(buf) != expect {
+		t.Fatalf("expect %q without rotations. Got %q", expect, buf)
+	}
+}
+
+func TestFakeFilesRaw(t *testing.T) {
+	fake := NewFakeFiles()
+	stdout := SandboxPath("agent", "framework", "executor", "container", "") + "/stdout"
+	data := []byte("one\r\ntwo\x00\xff\xfe\"three\"")
+	fake.Write(stdout, data)
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	buf, err := ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptRaw(), reader.OptChunkSize(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("expect %q. Got %q", data, buf)
+	}
+
+	buf, err = ioutil.ReadAll(newReader(t, ts, "/files/read", reader.OptRaw(), reader.OptOffset(5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, data[5:]) {
+		t.Fatalf("expect %q. Got %q", data[5:], buf)
+	}
+}
+
+func TestFakeFilesBrowse(t *testing.T) {
+	fake := NewFakeFiles()
+	sandbox := SandboxPath("agent", "framework", "executor", "container", "")
+	fake.Write(sandbox+"/stdout", []byte("one\n"))
+	fake.Write(sandbox+"/stderr", []byte("error\n"))
+	fake.Write(sandbox+"/tasks/task/stdout", []byte("task\n"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	files, err := newReader(t, ts, "/files/browse").BrowseSandbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, strings.TrimPrefix(f.Path, sandbox+"/"))
+	}
+
+	if expect := "stderr stdout tasks"; strings.Join(paths, " ") != expect {
+		t.Fatalf("expect %s. Got %v", expect, paths)
+	}
+
+	if files[1].Size != 4 || files[2].Mode != "drwxr-xr-x" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+}
+
+func TestFakeFilesDownload(t *testing.T) {
+	fake := NewFakeFiles()
+	fake.Write(SandboxPath("agent", "framework", "executor", "container", "")+"/stdout", []byte("one two three"))
+
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	resp, err := newReader(t, ts, "/files/download").Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != "one two three" {
+		t.Fatalf("expect one two three. Got %s", buf)
+	}
+}
+
+func TestLoadJournal(t *testing.T) {
+	fixtures := map[string]string{
+		"export": "__CURSOR=s=1\n__REALTIME_TIMESTAMP=1500000000000000\n__MONOTONIC_TIMESTAMP=42\nMESSAGE=hello\n" +
+			"_SYSTEMD_UNIT=dcos-log.service\n\n__CURSOR=s=2\nMESSAGE\n\x05\x00\x00\x00\x00\x00\x00\x00wor\nd\n\n",
+		"json": `{"__CURSOR":"s=1","__REALTIME_TIMESTAMP":"1500000000000000","__MONOTONIC_TIMESTAMP":"42",` +
+			`"MESSAGE":"hello","_SYSTEMD_UNIT":"dcos-log.service"}` + "\n" +
+			`{"__CURSOR":"s=2","MESSAGE":[119,111,114,10,100]}`,
+	}
+
+	for name, fixture := range fixtures {
+		entries, err := LoadJournal(strings.NewReader(fixture))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if len(entries) != 2 {
+			t.Fatalf("%s: expect 2 entries. Got %d", name, len(entries))
+		}
+
+		e := entries[0]
+		if e.Cursor != "s=1" || e.RealtimeTimestamp != 1500000000000000 || e.MonotonicTimestamp != 42 {
+			t.Fatalf("%s: unexpected entry %+v", name, e)
+		}
+
+		if e.Fields["MESSAGE"] != "hello" || e.Fields["_SYSTEMD_UNIT"] != "dcos-log.service" {
+			t.Fatalf("%s: unexpected fields %v", name, e.Fields)
+		}
+
+		if _, ok := e.Fields["__CURSOR"]; ok {
+			t.Fatalf("%s: expect no __CURSOR field. Got %v", name, e.Fields)
+		}
+
+		if msg := entries[1].Fields["MESSAGE"]; msg != "wor\nd" {
+			t.Fatalf("%s: expect binary message. Got %q", name, msg)
+		}
+	}
+
+	if _, err := LoadJournal(strings.NewReader(`{"__REALTIME_TIMESTAMP":"x"}`)); err == nil {
+		t.Fatal("expect an error on invalid timestamp")
+	}
+}
+
+func TestFakeJournal(t *testing.T) {
+	fixture := JournalFixture("dcos-log.service", 3)
+	if e := fixture[2]; e.Cursor != "s=fixture;i=3" || e.RealtimeTimestamp != FixtureTime+2000000 ||
+		e.Fields["MESSAGE"] != "dcos-log.service entry 2" || e.Fields["SYSLOG_IDENTIFIER"] != "dcos-log" {
+		t.Fatalf("unexpected fixture entry %+v", e)
+	}
+
+	j := NewFakeJournal(jr.FormatText{}, fixture[:2]...)
+	buf := &bytes.Buffer{}
+	if err := j.Follow(time.Millisecond, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 || !strings.Contains(buf.String(), "entry 1") {
+		t.Fatalf("expect 2 entries. Got %q", buf.String())
+	}
+
+	// the appended entry is written by the waiting Follow or the next one.
+	buf.Reset()
+	done := make(chan error)
+	go func() { done <- j.Follow(time.Minute, buf) }()
+	j.Append(fixture[2])
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.Follow(time.Millisecond, buf); err != nil || !strings.Contains(buf.String(), "entry 2") {
+		t.Fatalf("expect the appended entry. Got %q, %v", buf.String(), err)
+	}
+}
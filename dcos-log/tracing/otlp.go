@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	otlpBatchSize     = 512
+	otlpFlushInterval = 5 * time.Second
+
+	// otlpQueueSize is the number of spans waiting for export, the spans are dropped when the queue is full.
+	otlpQueueSize = 4096
+
+	// otlpStatusError is the status code of a failed span.
+	otlpStatusError = 2
+)
+
+// OTLPExporter sends the spans to an OpenTelemetry collector with OTLP/HTTP in JSON encoding. The spans are
+// queued and sent in batches by Run.
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type OTLPExporter struct {
+	client  *http.Client
+	url     string
+	service string
+	spans   chan *Span
+}
+
+// NewOTLPExporter returns a new instance of OTLPExporter. tracesURL is the traces endpoint of the collector,
+// for instance http://localhost:4318/v1/traces.
+func NewOTLPExporter(client *http.Client, tracesURL, service string) *OTLPExporter {
+	return &OTLPExporter{
+		client:  client,
+		url:     tracesURL,
+		service: service,
+		spans:   make(chan *Span, otlpQueueSize),
+	}
+}
+
+// Export queues the span.
+func (e *OTLPExporter) Export(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		logrus.Debugf("tracing: queue is full, dropping span %s", s.Name)
+	}
+}
+
+// Run sends the queued spans until the context is canceled, then it sends the spans left in the queue.
+func (e *OTLPExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case <-ctx.Done():
+			e.drain(batch)
+			return
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) < otlpBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := e.send(ctx, batch); err != nil {
+			logrus.Errorf("tracing: unable to export %d spans: %s", len(batch), err)
+		}
+		batch = nil
+	}
+}
+
+// drain sends the batch and the queued spans of a stopped exporter.
+func (e *OTLPExporter) drain(batch []*Span) {
+	// Run is the only receiver.
+	for len(e.spans) > 0 {
+		batch = append(batch, <-e.spans)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpFlushInterval)
+	defer cancel()
+	if err := e.send(ctx, batch); err != nil {
+		logrus.Errorf("tracing: unable to export %d spans on shutdown: %s", len(batch), err)
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i].Key = k
+		kvs[i].Value.StringValue = attributes[k]
+	}
+	return kvs
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+func newOTLPSpan(s *Span) otlpSpan {
+	end, attributes, err := s.snapshot()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.Context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.Context.SpanID[:]),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        otlpAttributes(attributes),
+	}
+
+	if s.ParentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+	}
+
+	if err != "" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: err}
+	}
+	return span
+}
+
+// request returns the ExportTraceServiceRequest of the spans.
+func (e *OTLPExporter) request(spans []*Span) interface{} {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		otlpSpans[i] = newOTLPSpan(s)
+	}
+
+	type scopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	scope := scopeSpans{Spans: otlpSpans}
+	scope.Scope.Name = "github.com/dcos/dcos-log/dcos-log/tracing"
+
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	resource := resourceSpans{ScopeSpans: []scopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]string{"service.name": e.service})
+	return map[string][]resourceSpans{"resourceSpans": {resource}}
+}
+
+func (e *OTLPExporter) send(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
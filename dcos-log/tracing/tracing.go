@@ -0,0 +1,258 @@
+// Package tracing implements the subset of OpenTelemetry tracing dcos-log needs: spans, W3C Trace Context
+// propagation and an OTLP/HTTP exporter. A trace started by Admin Router or a client is continued from the
+// incoming traceparent header and propagated to the Mesos APIs.
+// https://www.w3.org/TR/trace-context/
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the header of W3C Trace Context.
+const TraceparentHeader = "traceparent"
+
+// ErrInvalidTraceparent is returned by ParseTraceparent if a header value is malformed.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// Kind is the kind of a span, the values are the OTLP span kinds.
+type Kind int
+
+// span kinds
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span in a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid returns true if trace and span IDs are set.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent returns the traceparent header value of the span context.
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", c.TraceID, c.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Future versions are accepted as long as the fields of
+// version 00 are valid.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var c SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return c, ErrInvalidTraceparent
+	}
+
+	var flags [1]byte
+	for _, field := range []struct {
+		s   string
+		dst []byte
+	}{{parts[1], c.TraceID[:]}, {parts[2], c.SpanID[:]}, {parts[3], flags[:]}} {
+		if len(field.s) != 2*len(field.dst) || strings.ToLower(field.s) != field.s {
+			return c, ErrInvalidTraceparent
+		}
+
+		if _, err := hex.Decode(field.dst, []byte(field.s)); err != nil {
+			return c, ErrInvalidTraceparent
+		}
+	}
+
+	if !c.IsValid() {
+		return c, ErrInvalidTraceparent
+	}
+
+	c.Sampled = flags[0]&1 == 1
+	return c, nil
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+	Name     string
+	Kind     Kind
+	Context  SpanContext
+	ParentID [8]byte
+	Start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]string
+	err        string
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed, nil is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span and exports it if the trace is sampled. Only the first call has an effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	mu.Lock()
+	e := exporter
+	mu.Unlock()
+
+	if e != nil && s.Context.Sampled {
+		e.Export(s)
+	}
+}
+
+// snapshot returns the end time, the attributes and the error of an ended span.
+func (s *Span) snapshot() (time.Time, map[string]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attributes := make(map[string]string, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+	return s.end, attributes, s.err
+}
+
+// Exporter sends the ended spans of sampled traces to a tracing backend.
+type Exporter interface {
+	Export(*Span)
+}
+
+var (
+	mu          sync.Mutex
+	exporter    Exporter
+	sampleRatio = 1.0
+)
+
+// SetExporter sets the exporter of the spans and the ratio of the traces started by dcos-log which are sampled.
+// The traces continued from a traceparent header keep the sampling decision of the caller. A nil exporter
+// disables the export, the trace context is still propagated.
+func SetExporter(e Exporter, ratio float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	exporter, sampleRatio = e, ratio
+}
+
+func sampled() bool {
+	mu.Lock()
+	ratio := sampleRatio
+	mu.Unlock()
+
+	if ratio >= 1 {
+		return true
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<30))
+	return err == nil && float64(n.Int64()) < ratio*(1<<30)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// FromContext returns the current span, nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the context of the current span or the remote parent extracted from a request.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s := FromContext(ctx); s != nil {
+		return s.Context, true
+	}
+
+	c, ok := ctx.Value(remoteKey).(SpanContext)
+	return c, ok
+}
+
+// Start starts a span, a child of the current span or the remote parent, or a new trace.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{Name: name, Kind: kind, Start: time.Now()}
+	rand.Read(s.Context.SpanID[:])
+
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.Context.TraceID = parent.TraceID
+		s.Context.Sampled = parent.Sampled
+		s.ParentID = parent.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+		s.Context.Sampled = sampled()
+	}
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Extract returns a context with the remote parent from the traceparent header, an invalid header is ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	c, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey, c)
+}
+
+// Inject sets the traceparent header of the current span.
+func Inject(ctx context.Context, h http.Header) {
+	if c, ok := SpanContextFromContext(ctx); ok {
+		h.Set(TraceparentHeader, c.Traceparent())
+	}
+}
+
+// StartRequest starts a client span of an outbound request and returns a copy of the request with the span
+// context and the traceparent header. The headers are copied, so a header shared by requests is not modified.
+func StartRequest(req *http.Request, name string) (*http.Request, *Span) {
+	ctx, span := Start(req.Context(), name, KindClient)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	header := make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	Inject(ctx, header)
+
+	req = req.WithContext(ctx)
+	req.Header = header
+	return req, span
+}
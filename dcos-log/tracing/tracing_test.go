@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(s *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	c, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Sampled || c.TraceID[0] != 0x0a || c.SpanID[7] != 0x31 {
+		t.Fatalf("unexpected span context %+v", c)
+	}
+
+	if c.Traceparent() != header {
+		t.Fatalf("expect %s. Got %s", header, c.Traceparent())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err != ErrInvalidTraceparent {
+			t.Fatalf("expect ErrInvalidTraceparent for %q. Got %v", invalid, err)
+		}
+	}
+
+	if _, err := ParseTraceparent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00-extra"); err != nil {
+		t.Fatalf("expect a future version to be accepted. Got %s", err)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	r := &recorder{}
+	SetExporter(r, 1)
+	defer SetExporter(nil, 1)
+
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx, server := Start(Extract(context.Background(), in), "GET /v2/component", KindServer)
+
+	shared := http.Header{"Authorization": {"token=x"}}
+	req, _ := http.NewRequest("GET", "http://agent:5051/files/read?path=/stdout", nil)
+	req.Header = shared
+	req, client := StartRequest(req.WithContext(ctx), "files read")
+	client.SetError(errors.New("timeout"))
+	client.End()
+	client.End()
+	server.End()
+
+	if shared.Get(TraceparentHeader) != "" {
+		t.Fatalf("expect the shared header to be unchanged. Got %v", shared)
+	}
+
+	c, err := ParseTraceparent(req.Header.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.TraceID != server.Context.TraceID || c.SpanID != client.Context.SpanID || client.ParentID != server.Context.SpanID {
+		t.Fatalf("expect the client span in the trace of the request. Got %s", req.Header.Get(TraceparentHeader))
+	}
+
+	if server.ParentID[0] != 0xb7 {
+		t.Fatalf("expect the remote parent. Got %x", server.ParentID)
+	}
+
+	if len(r.spans) != 2 || r.spans[0] != client || r.spans[1] != server {
+		t.Fatalf("expect the spans to be exported once. Got %v", r.spans)
+	}
+}
+
+func TestNotSampled(t *testing.T) {
+	r := &recorder{}
+	SetExporter(r, 0)
+	defer SetExporter(nil, 1)
+
+	_, span := Start(context.Background(), "root", KindInternal)
+	span.End()
+
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	_, child := Start(Extract(context.Background(), in), "child", KindServer)
+	child.End()
+
+	if len(r.spans) != 1 || r.spans[0] != child {
+		t.Fatalf("expect the caller sampling decision. Got %v", r.spans)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer ts.Close()
+
+	e := NewOTLPExporter(http.DefaultClient, ts.URL, "dcos-log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, span := Start(context.Background(), "journal read", KindInternal)
+	span.SetAttribute("journal.bytes", "42")
+	span.End()
+	if err := e.send(ctx, []*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case body := <-received:
+		b, _ := json.Marshal(body)
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Fatal(err)
+		}
+
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		if len(spans) != 1 || spans[0].Name != "journal read" || len(spans[0].TraceID) != 32 ||
+			spans[0].Attributes[0].Value.StringValue != "42" {
+			t.Fatalf("unexpected request %s", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect a request to the collector")
+	}
+}
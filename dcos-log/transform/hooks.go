@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"sync"
+)
+
+// Sources of the entries passed to hooks.
+const (
+	SourceJournal = "journal"
+	SourceSandbox = "sandbox"
+)
+
+// Stage is a step of the pipeline a log entry passes before it is formatted. It can mutate, annotate or drop the
+// fields of an entry: returning false drops the entry. Journal entries have all journal fields, sandbox lines
+// have MESSAGE, AGENT_ID, FRAMEWORK_ID, EXECUTOR_ID, CONTAINER_ID and FILE. Changes to MESSAGE are visible in
+// all formats, the other fields are only sent in JSON based formats. Stages are called concurrently and must be
+// safe for concurrent use.
+type Stage func(source string, fields map[string]string) bool
+
+// Hook is a Stage which keeps all entries.
+type Hook func(source string, fields map[string]string)
+
+// Pipeline applies stages to the fields of an entry, it returns false if the entry is dropped.
+type Pipeline func(fields map[string]string) bool
+
+type namedStage struct {
+	name  string
+	stage Stage
+}
+
+var (
+	stagesMu sync.RWMutex
+	stages   []namedStage
+)
+
+// RegisterStage adds a named stage, stages are called in the order they were registered until one of them drops
+// the entry. Registering the same name twice replaces the previous stage in place. It's meant to be called by the
+// programs embedding dcos-log before the server is started.
+func RegisterStage(name string, s Stage) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+
+	for i := range stages {
+		if stages[i].name == name {
+			stages[i].stage = s
+			return
+		}
+	}
+	stages = append(stages, namedStage{name: name, stage: s})
+}
+
+// RegisterHook adds a named stage which calls h and keeps the entry.
+func RegisterHook(name string, h Hook) {
+	RegisterStage(name, func(source string, fields map[string]string) bool {
+		h(source, fields)
+		return true
+	})
+}
+
+// UnregisterHook removes a named stage or hook.
+func UnregisterHook(name string) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+
+	for i := range stages {
+		if stages[i].name == name {
+			stages = append(stages[:i], stages[i+1:]...)
+			return
+		}
+	}
+}
+
+// HookNames returns the names of registered stages and hooks.
+func HookNames() []string {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+
+	names := make([]string, len(stages))
+	for i, s := range stages {
+		names[i] = s.name
+	}
+	return names
+}
+
+// Stages returns the pipeline of the registered stages for the entries of a given source, nil is returned if
+// there are no stages.
+func Stages(source string) Pipeline {
+	stagesMu.RLock()
+	current := make([]Stage, len(stages))
+	for i, s := range stages {
+		current[i] = s.stage
+	}
+	stagesMu.RUnlock()
+
+	if len(current) == 0 {
+		return nil
+	}
+
+	return func(fields map[string]string) bool {
+		for _, s := range current {
+			if !s(source, fields) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Then returns a pipeline which applies fn to the fields of the entries p keeps. Either of p and fn can be nil,
+// nil is returned if both are.
+func (p Pipeline) Then(fn func(map[string]string)) Pipeline {
+	switch {
+	case fn == nil:
+		return p
+	case p == nil:
+		return func(fields map[string]string) bool {
+			fn(fields)
+			return true
+		}
+	}
+
+	return func(fields map[string]string) bool {
+		if !p(fields) {
+			return false
+		}
+		fn(fields)
+		return true
+	}
+}
@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	if Stages(SourceJournal) != nil {
+		t.Fatal("expect nil pipeline")
+	}
+
+	RegisterHook("dc", func(source string, fields map[string]string) {
+		fields["DATACENTER"] = "east"
+	})
+	RegisterHook("scrub", func(source string, fields map[string]string) {
+		if source == SourceSandbox {
+			fields["MESSAGE"] = "scrubbed"
+		}
+	})
+	defer UnregisterHook("dc")
+	defer UnregisterHook("scrub")
+
+	RegisterHook("dc", func(source string, fields map[string]string) {
+		fields["DATACENTER"] = "west"
+	})
+
+	if names := HookNames(); len(names) != 2 || names[0] != "dc" || names[1] != "scrub" {
+		t.Fatalf("expect [dc scrub]. Got %v", names)
+	}
+
+	fields := map[string]string{"MESSAGE": "secret"}
+	if !Stages(SourceSandbox)(fields) || fields["DATACENTER"] != "west" || fields["MESSAGE"] != "scrubbed" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+
+	fields = map[string]string{"MESSAGE": "secret"}
+	Stages(SourceJournal)(fields)
+	if fields["MESSAGE"] != "secret" {
+		t.Fatalf("expect journal message to be kept. Got %v", fields)
+	}
+}
+
+func TestStages(t *testing.T) {
+	RegisterStage("healthcheck", func(source string, fields map[string]string) bool {
+		return !strings.HasPrefix(fields["MESSAGE"], "GET /health")
+	})
+	RegisterHook("tag", func(source string, fields map[string]string) {
+		fields["TAGGED"] = "1"
+	})
+	defer UnregisterHook("healthcheck")
+	defer UnregisterHook("tag")
+
+	var redacted bool
+	p := Stages(SourceJournal).Then(func(fields map[string]string) { redacted = true })
+
+	fields := map[string]string{"MESSAGE": "GET /health 200"}
+	if p(fields) || fields["TAGGED"] != "" || redacted {
+		t.Fatalf("expect the entry to be dropped by the first stage. Got %v", fields)
+	}
+
+	fields = map[string]string{"MESSAGE": "GET /v1 200"}
+	if !p(fields) || fields["TAGGED"] != "1" || !redacted {
+		t.Fatalf("expect the entry to pass all stages. Got %v", fields)
+	}
+
+	if Pipeline(nil).Then(nil) != nil {
+		t.Fatal("expect nil pipeline")
+	}
+
+	if !Pipeline(nil).Then(func(map[string]string) {})(nil) {
+		t.Fatal("expect the entry to be kept")
+	}
+}
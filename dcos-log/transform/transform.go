@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RepeatCountField is set on the entry which ends a coalesced run of identical entries, it's the number of entries
+// the entry stands for.
+const RepeatCountField = "REPEAT_COUNT"
+
+// ansiRegexp matches CSI sequences (colors, cursor movement), OSC sequences (window titles, hyperlinks)
+// and the other two byte escape sequences.
+var ansiRegexp = regexp.MustCompile("\x1b(?:\\[[0-?]*[ -/]*[@-~]|\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|[@-Z\\\\-_])")
+
+// crlfReplacer converts CRLF line endings to LF.
+var crlfReplacer = strings.NewReplacer("\r\n", "\n")
+
+// Func transforms a log message.
+type Func func(string) string
+
+// StripANSI removes ANSI escape sequences from s.
+func StripANSI(s string) string {
+	if !strings.ContainsRune(s, '\x1b') {
+		return s
+	}
+	return ansiRegexp.ReplaceAllString(s, "")
+}
+
+// NormalizeNewlines converts CRLF line endings to LF and removes a trailing CR, which is left behind when
+// CRLF terminated files are split into lines.
+func NormalizeNewlines(s string) string {
+	if !strings.ContainsRune(s, '\r') {
+		return s
+	}
+	return strings.TrimSuffix(crlfReplacer.Replace(s), "\r")
+}
+
+// Repeated returns the message of the entry which stands for n repeats of a message, like syslog does.
+func Repeated(message string, n int) string {
+	return fmt.Sprintf("message repeated %d times: [%s]", n, message)
+}
+
+// isControl returns true for C0 control characters and DEL, except tab and new line.
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t' && r != '\n') || r == 0x7f
+}
+
+// StripControl removes NUL and the other control characters except tab and new line.
+func StripControl(s string) string {
+	if strings.IndexFunc(s, isControl) == -1 {
+		return s
+	}
+
+	return strings.Map(func(r rune) rune {
+		if isControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// isEscaped returns true for the control characters EscapeControl escapes: C0 controls except tab and new line, DEL
+// and the C1 controls terminals interpret, such as the single byte CSI.
+func isEscaped(r rune) bool {
+	return isControl(r) || (r >= 0x80 && r <= 0x9f)
+}
+
+// EscapeControl replaces ESC and the other control characters except tab and new line with their \x1b or \u009b
+// escapes, so ANSI sequences are shown instead of being interpreted by the terminal of a reader.
+func EscapeControl(s string) string {
+	if strings.IndexFunc(s, isEscaped) == -1 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for _, r := range s {
+		switch {
+		case r < 0x80 && isEscaped(r):
+			fmt.Fprintf(&b, "\\x%02x", r)
+		case isEscaped(r):
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Chain returns a Func which applies fns in order. Nil functions are ignored, if there is nothing to
+// apply Chain returns nil.
+func Chain(fns ...Func) Func {
+	var chain []Func
+	for _, fn := range fns {
+		if fn != nil {
+			chain = append(chain, fn)
+		}
+	}
+
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+
+	return func(s string) string {
+		for _, fn := range chain {
+			s = fn(s)
+		}
+		return s
+	}
+}
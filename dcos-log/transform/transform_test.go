@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripANSI(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain text":                               "plain text",
+		"\x1b[31mred\x1b[0m":                       "red",
+		"\x1b[1;32mINFO\x1b[m started":             "INFO started",
+		"\x1b[2K\x1b[1Gprogress":                   "progress",
+		"\x1b]0;title\x07text":                     "text",
+		"\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\": "link",
+		"\x1bMreverse":                             "reverse",
+	} {
+		if output := StripANSI(input); output != expected {
+			t.Fatalf("expect %q. Got %q", expected, output)
+		}
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	for input, expected := range map[string]string{
+		"line":           "line",
+		"line\r":         "line",
+		"one\r\ntwo\r\n": "one\ntwo\n",
+		"progress\r50%":  "progress\r50%",
+	} {
+		if output := NormalizeNewlines(input); output != expected {
+			t.Fatalf("expect %q. Got %q", expected, output)
+		}
+	}
+}
+
+func TestStripControl(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain\ttext\n":     "plain\ttext\n",
+		"nul\x00byte":       "nulbyte",
+		"bell\x07\x08\x7f!": "bell!",
+		"\x1b[31mred":       "[31mred",
+	} {
+		if output := StripControl(input); output != expected {
+			t.Fatalf("expect %q. Got %q", expected, output)
+		}
+	}
+}
+
+func TestEscapeControl(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain\ttext":             "plain\ttext",
+		"\x1b[31mred\x1b[0m":      "\\x1b[31mred\\x1b[0m",
+		"bell\x07 and \u009b2J":   "bell\\x07 and \\u009b2J",
+		"line\r\n":                "line\\x0d\n",
+		"\x1b]0;title\x07ünïcode": "\\x1b]0;title\\x07ünïcode",
+	} {
+		if output := EscapeControl(input); output != expected {
+			t.Fatalf("expect %q. Got %q", expected, output)
+		}
+	}
+}
+
+func TestRepeated(t *testing.T) {
+	if s := Repeated("connection refused", 3); s != "message repeated 3 times: [connection refused]" {
+		t.Fatalf("expect a syslog like message. Got %s", s)
+	}
+}
+
+func TestChain(t *testing.T) {
+	if Chain(nil, nil) != nil {
+		t.Fatal("expect nil chain")
+	}
+
+	fn := Chain(StripANSI, nil, strings.ToUpper)
+	if output := fn("\x1b[31mred\x1b[0m"); output != "RED" {
+		t.Fatalf("expect RED. Got %s", output)
+	}
+}
@@ -0,0 +1,29 @@
+package version
+
+import "runtime"
+
+// Build information, set at link time with
+// -ldflags "-X github.com/dcos/dcos-log/dcos-log/version.Version=<version>".
+var (
+	Version   = "dev"
+	GitSHA    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the dcos-log build.
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,293 @@
+// Package websocket implements the server side of the WebSocket protocol (RFC 6455) dcos-log needs to push
+// log entries to browsers: the opening handshake, text, binary and close messages and replies to pings.
+// Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Message types are the opcodes of data and control frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes sent in close messages.
+const (
+	CloseNormal        = 1000
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+	CloseInternalError = 1011
+)
+
+// MaxMessageSize is the maximum size of a message read from a client.
+const MaxMessageSize = 64 * 1024
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrBadHandshake is returned by Upgrade if the request is not a valid WebSocket handshake.
+	ErrBadHandshake = errors.New("not a websocket handshake")
+
+	// ErrMessageTooLarge is returned by ReadMessage if a client message is larger than MaxMessageSize.
+	ErrMessageTooLarge = errors.New("websocket message too large")
+
+	// ErrProtocol is returned by ReadMessage if a client violates the protocol.
+	ErrProtocol = errors.New("websocket protocol error")
+)
+
+// headerContains returns true if a comma separated header contains a token, case insensitive.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUpgrade returns true if the request asks to switch to the WebSocket protocol.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// acceptKey returns Sec-WebSocket-Accept value for a client key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+acceptGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Upgrade completes the opening handshake and returns the connection. If the request is not a valid handshake,
+// an HTTP error is sent to the client. The request context is not canceled when the connection is closed.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != "GET" || !IsUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key header", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket is not supported by the connection", http.StatusInternalServerError)
+		return nil, errors.New("response does not implement http.Hijacker")
+	}
+
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// the client must wait for the handshake response before it sends frames.
+	if rw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, ErrBadHandshake
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := io.WriteString(netConn, response); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: netConn, br: rw.Reader}, nil
+}
+
+// Conn is a server side WebSocket connection. WriteMessage may be called concurrently with ReadMessage, but
+// only a single goroutine may call ReadMessage.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu        sync.Mutex
+	closeSent bool
+}
+
+// WriteMessage sends a message in a single frame.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return io.ErrClosedPipe
+	}
+
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// writeFrame writes an unmasked final frame, servers must not mask the frames.
+func (c *Conn) writeFrame(opcode int, data []byte) error {
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(opcode))
+
+	switch {
+	case len(data) < 126:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(data)))
+	}
+
+	_, err := c.conn.Write(append(frame, data...))
+	return err
+}
+
+// CloseWithReason sends a close message with a status code and reason and closes the connection.
+func (c *Conn) CloseWithReason(code int, reason string) error {
+	// control frames are limited to 125 bytes, 2 of them are the code.
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	c.WriteMessage(CloseMessage, append(payload, reason...))
+	return c.conn.Close()
+}
+
+// Close sends a normal close message and closes the connection.
+func (c *Conn) Close() error {
+	return c.CloseWithReason(CloseNormal, "")
+}
+
+// ReadMessage returns the next text or binary message of the client. Pings are answered and pongs are
+// ignored. If the client sends a close message, the close is confirmed and io.EOF is returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		messageType int
+		message     []byte
+	)
+
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			return 0, nil, err
+		}
+
+		fin, opcode := header[0]&0x80 != 0, int(header[0]&0x0f)
+		masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+
+		// extensions are not negotiated and the client frames must be masked.
+		if header[0]&0x70 != 0 || !masked {
+			return c.fail(CloseProtocolError, ErrProtocol)
+		}
+
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+
+		control := opcode >= CloseMessage
+		if control && (!fin || length > 125) {
+			return c.fail(CloseProtocolError, ErrProtocol)
+		}
+
+		if length > MaxMessageSize || uint64(len(message))+length > MaxMessageSize {
+			return c.fail(CloseTooLarge, ErrMessageTooLarge)
+		}
+
+		var mask [4]byte
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return 0, nil, err
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return 0, nil, err
+		}
+
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			// echo the status code of the client.
+			c.WriteMessage(CloseMessage, payload[:min(len(payload), 2)])
+			return 0, nil, io.EOF
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return c.fail(CloseProtocolError, ErrProtocol)
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return c.fail(CloseProtocolError, ErrProtocol)
+			}
+		default:
+			return c.fail(CloseProtocolError, fmt.Errorf("%s: unknown opcode %d", ErrProtocol, opcode))
+		}
+
+		message = append(message, payload...)
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+// fail closes the connection with a status code and returns err.
+func (c *Conn) fail(code int, err error) (int, []byte, error) {
+	c.CloseWithReason(code, err.Error())
+	return 0, nil, err
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dial performs the opening handshake and returns the connection and the handshake response.
+func dial(t *testing.T, url string, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func handshakeHeader() http.Header {
+	return http.Header{
+		"Connection":            {"keep-alive, Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+	}
+}
+
+// writeClientFrame writes a masked frame.
+func writeClientFrame(t *testing.T, w io.Writer, fin bool, opcode int, data []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(data))}
+	if len(data) >= 126 {
+		frame = []byte{b0, 0x80 | 126, byte(len(data) >> 8), byte(len(data))}
+	}
+	frame = append(frame, mask...)
+	for i, c := range data {
+		frame = append(frame, c^mask[i%4])
+	}
+
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (int, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatal(err)
+	}
+	return int(header[0] & 0x0f), data
+}
+
+func TestConn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// echo the messages in upper case.
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(messageType, []byte(strings.ToUpper(string(data)))); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	conn, br, resp := dial(t, ts.URL, handshakeHeader())
+	defer conn.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect status 101. Got %d", resp.StatusCode)
+	}
+
+	// the example of RFC 6455.
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expect accept key s3pPLMBiTxaQ9kYGzzhZRbK+xOo=. Got %s", accept)
+	}
+
+	writeClientFrame(t, conn, true, PingMessage, []byte("are you there"))
+	if opcode, data := readServerFrame(t, br); opcode != PongMessage || string(data) != "are you there" {
+		t.Fatalf("expect pong with the ping payload. Got %d %s", opcode, data)
+	}
+
+	// a fragmented message.
+	writeClientFrame(t, conn, false, TextMessage, []byte("hel"))
+	writeClientFrame(t, conn, true, continuationFrame, []byte("lo"))
+	if opcode, data := readServerFrame(t, br); opcode != TextMessage || string(data) != "HELLO" {
+		t.Fatalf("expect text message HELLO. Got %d %s", opcode, data)
+	}
+
+	// a message with 16 bit length.
+	long := strings.Repeat("a", 300)
+	writeClientFrame(t, conn, true, BinaryMessage, []byte(long))
+	if opcode, data := readServerFrame(t, br); opcode != BinaryMessage || string(data) != strings.ToUpper(long) {
+		t.Fatalf("expect binary message of 300 bytes. Got %d %d bytes", opcode, len(data))
+	}
+
+	writeClientFrame(t, conn, true, CloseMessage, []byte{0x03, 0xe8})
+	if opcode, data := readServerFrame(t, br); opcode != CloseMessage || binary.BigEndian.Uint16(data) != CloseNormal {
+		t.Fatalf("expect close confirmation. Got %d %v", opcode, data)
+	}
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := Upgrade(w, r); err == nil {
+			conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		modify func(http.Header)
+		code   int
+	}{
+		{func(h http.Header) { h.Del("Upgrade") }, http.StatusBadRequest},
+		{func(h http.Header) { h.Set("Sec-Websocket-Version", "8") }, http.StatusUpgradeRequired},
+		{func(h http.Header) { h.Del("Sec-Websocket-Key") }, http.StatusBadRequest},
+	} {
+		header := handshakeHeader()
+		tc.modify(header)
+
+		conn, _, resp := dial(t, ts.URL, header)
+		conn.Close()
+		if resp.StatusCode != tc.code {
+			t.Fatalf("expect status %d. Got %d", tc.code, resp.StatusCode)
+		}
+	}
+}
+
+func TestUnmaskedFrame(t *testing.T) {
+	done := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+
+		_, _, err = conn.ReadMessage()
+		done <- err
+	}))
+	defer ts.Close()
+
+	conn, br, _ := dial(t, ts.URL, handshakeHeader())
+	defer conn.Close()
+
+	conn.Write([]byte{0x81, 0x01, 'a'})
+	if err := <-done; err != ErrProtocol {
+		t.Fatalf("expect protocol error. Got %v", err)
+	}
+
+	if opcode, data := readServerFrame(t, br); opcode != CloseMessage || binary.BigEndian.Uint16(data) != CloseProtocolError {
+		t.Fatalf("expect close with protocol error. Got %d %v", opcode, data)
+	}
+}